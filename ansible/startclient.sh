@@ -63,7 +63,7 @@ done
 source /etc/profile.d/dfcpaths.sh
 cd $DFCSRC/../cmd/dfcloader
 sudo rm -rf screenlog.0
-screen -mdSL client go run main.go worker.go -ip=$PROXYIP -port=$PROXYPORT -bucket=$bucket -local=true -minsize=$minsize -maxsize=$maxsize -statsinterval=1 -readertype=rand -cleanup=$cleanup -pctput=$pctput -duration=$duration -totalputsize=4048000000 -numworkers=$threads
+screen -mdSL client go run main.go worker.go sizedist.go -ip=$PROXYIP -port=$PROXYPORT -bucket=$bucket -local=true -minsize=$minsize -maxsize=$maxsize -statsinterval=1 -readertype=rand -cleanup=$cleanup -pctput=$pctput -duration=$duration -totalputsize=4048000000 -numworkers=$threads
 
 echo "started dfcloader, wait for screnlog file to show up with timeout of 2min"
 x=0
@@ -78,7 +78,7 @@ echo "screenlog file created"
 if grep -q 'Failed to boot strap' screenlog.0; then
 	echo 'Failed to boot strap, restarting one more time'
 	sudo rm -rf screenlog.0
-	screen -mdSL client go run main.go worker.go -ip=$PROXYIP -port=$PROXYPORT -bucket=$bucket -local=true -minsize=$minsize -maxsize=$maxsize -statsinterval=1 -readertype=rand -cleanup=false -pctput=$pctput -duration=$duration -totalputsize=4048000000 -numworkers=64
+	screen -mdSL client go run main.go worker.go sizedist.go -ip=$PROXYIP -port=$PROXYPORT -bucket=$bucket -local=true -minsize=$minsize -maxsize=$maxsize -statsinterval=1 -readertype=rand -cleanup=false -pctput=$pctput -duration=$duration -totalputsize=4048000000 -numworkers=64
 	echo "started dfcloader, wait for screnlog file to show up with timeout of 2min"
 	x=0
 	while [ "$x" -lt 24 -a ! -f screenlog.0 ]
@@ -0,0 +1,262 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/NVIDIA/dfcpub/3rdparty/glog"
+	"github.com/NVIDIA/dfcpub/dfc"
+	"github.com/dgrijalva/jwt-go"
+)
+
+const (
+	apiKeyListFile = "apikeys.json"
+)
+
+type (
+	// API key is a long-lived token issued for automation (CI jobs, data
+	// pipelines etc). Every key belongs to a registered user (a service account)
+	// and can be limited to a set of buckets and HTTP verbs. Unlike user tokens
+	// API keys survive authn restart and are managed only by superuser
+	apiKeyInfo struct {
+		ID      string    `json:"id"`
+		Owner   string    `json:"owner"`
+		Buckets []string  `json:"buckets,omitempty"`
+		Verbs   []string  `json:"verbs,omitempty"`
+		Issued  time.Time `json:"issued"`
+		Expires time.Time `json:"expires"`
+		Token   string    `json:"token,omitempty"`
+		// true if Token is encrypted with master key: API key contains
+		// user credentials, so it is encrypted in the same way
+		Encrypted bool `json:"encrypted,omitempty"`
+	}
+)
+
+func apiKeyPath(userDBPath string) string {
+	return filepath.Join(filepath.Dir(userDBPath), apiKeyListFile)
+}
+
+// Loads saved API keys. Expired keys are dropped
+func (m *userManager) loadAPIKeys() {
+	path := apiKeyPath(m.Path)
+	if _, err := os.Stat(path); err != nil {
+		if !os.IsNotExist(err) {
+			glog.Fatalf("Failed to load API key list: %v\n", err)
+		}
+		return
+	}
+	if err := dfc.LocalLoad(path, &m.apiKeys); err != nil {
+		glog.Fatalf("Failed to load API key list: %v\n", err)
+	}
+	now := m.clock.Now()
+	for id, key := range m.apiKeys {
+		if key.Expires.Before(now) {
+			delete(m.apiKeys, id)
+			continue
+		}
+		if !key.Encrypted {
+			continue
+		}
+		if m.masterKey == nil {
+			glog.Fatalf("API key %s is encrypted, master key must be set in %s\n", id, masterKeyEnvVar)
+		}
+		token, err := decryptData(m.masterKey, key.Token)
+		if err != nil {
+			glog.Fatalf("Failed to decrypt API key %s: %v\n", id, err)
+		}
+		key.Token, key.Encrypted = string(token), false
+	}
+}
+
+// If master key is set, tokens are saved encrypted
+// It is called from functions of this module that acquire lock, so it needs no locks
+func (m *userManager) saveAPIKeys() (err error) {
+	keys := m.apiKeys
+	if m.masterKey != nil {
+		keys = make(map[string]*apiKeyInfo, len(m.apiKeys))
+		for id, key := range m.apiKeys {
+			enc := &apiKeyInfo{}
+			*enc = *key
+			if enc.Token, err = encryptData(m.masterKey, []byte(key.Token)); err != nil {
+				return fmt.Errorf("UserManager: Failed to encrypt API key %s: %v", id, err)
+			}
+			enc.Encrypted = true
+			keys[id] = enc
+		}
+	}
+	if err = dfc.LocalSave(apiKeyPath(m.Path), &keys); err != nil {
+		err = fmt.Errorf("UserManager: Failed to save API key list: %v", err)
+	}
+	return err
+}
+
+func validateVerbs(verbs []string) error {
+	for _, verb := range verbs {
+		switch verb {
+		case "GET", "HEAD", "PUT", "POST", "DELETE":
+		default:
+			return fmt.Errorf("Invalid verb: %s", verb)
+		}
+	}
+	return nil
+}
+
+// Generates a signed API key. Besides the fields of a user token, the key
+// contains its ID and its scope: allowed buckets and verbs, and the owner's access
+func (m *userManager) signAPIKey(key *apiKeyInfo, creds map[string]string, access []string) (string, error) {
+	tokenString, err := signToken(jwt.MapClaims{
+		"issued":   tokenTime(key.Issued),
+		"expires":  tokenTime(key.Expires),
+		"username": key.Owner,
+		"creds":    creds,
+		"apikey":   key.ID,
+		"buckets":  key.Buckets,
+		"verbs":    key.Verbs,
+		"access":   access,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to generate API key: %v", err)
+	}
+	return tokenString, nil
+}
+
+// Creates a new API key for a registered user
+func (m *userManager) addAPIKey(owner string, buckets, verbs []string) (*apiKeyInfo, error) {
+	if err := validateVerbs(verbs); err != nil {
+		return nil, err
+	}
+	id, err := generateRandomID()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to generate API key ID: %v", err)
+	}
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	user, ok := m.Users[owner]
+	if !ok {
+		return nil, fmt.Errorf("User %s does not exist", owner)
+	}
+	if buckets, err = capScope(user.Buckets, buckets); err != nil {
+		return nil, fmt.Errorf("Invalid bucket scope: %v", err)
+	}
+
+	issued := m.clock.Now()
+	key := &apiKeyInfo{
+		ID:      id,
+		Owner:   owner,
+		Buckets: buckets,
+		Verbs:   verbs,
+		Issued:  issued,
+		Expires: issued.Add(conf.Auth.APIKeyExpirePeriod),
+	}
+	creds, err := m.userCreds(user)
+	if err != nil {
+		return nil, err
+	}
+	if key.Token, err = m.signAPIKey(key, creds, user.Access); err != nil {
+		return nil, err
+	}
+	m.apiKeys[id] = key
+	if err = m.saveAPIKeys(); err != nil {
+		delete(m.apiKeys, id)
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// Replaces API key token with a new one. The key keeps its ID and scope,
+// the old token is revoked
+func (m *userManager) rotateAPIKey(id string) (*apiKeyInfo, error) {
+	m.mtx.Lock()
+	key, ok := m.apiKeys[id]
+	if !ok {
+		m.mtx.Unlock()
+		return nil, fmt.Errorf("API key %s does not exist", id)
+	}
+	user, ok := m.Users[key.Owner]
+	if !ok {
+		m.mtx.Unlock()
+		return nil, fmt.Errorf("User %s does not exist", key.Owner)
+	}
+
+	creds, err := m.userCreds(user)
+	if err != nil {
+		m.mtx.Unlock()
+		return nil, err
+	}
+
+	rotated := &apiKeyInfo{}
+	*rotated = *key
+	rotated.Issued = m.clock.Now()
+	rotated.Expires = rotated.Issued.Add(conf.Auth.APIKeyExpirePeriod)
+	token, err := m.signAPIKey(rotated, creds, user.Access)
+	if err != nil {
+		m.mtx.Unlock()
+		return nil, err
+	}
+	rotated.Token = token
+	m.apiKeys[id] = rotated
+	m.markRevoked(key.Token, key.Expires)
+	err = m.saveAPIKeys()
+	m.mtx.Unlock()
+
+	go m.sendRevokedTokensToProxy(key.Token)
+	return rotated, err
+}
+
+// Deletes API key and revokes its token
+func (m *userManager) revokeAPIKey(id string) error {
+	m.mtx.Lock()
+	key, ok := m.apiKeys[id]
+	if !ok {
+		m.mtx.Unlock()
+		return fmt.Errorf("API key %s does not exist", id)
+	}
+	delete(m.apiKeys, id)
+	m.markRevoked(key.Token, key.Expires)
+	err := m.saveAPIKeys()
+	m.mtx.Unlock()
+
+	go m.sendRevokedTokensToProxy(key.Token)
+	return err
+}
+
+// Returns all API keys without tokens
+func (m *userManager) listAPIKeys() []*apiKeyInfo {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	keys := make([]*apiKeyInfo, 0, len(m.apiKeys))
+	for _, key := range m.apiKeys {
+		info := &apiKeyInfo{}
+		*info = *key
+		info.Token = ""
+		keys = append(keys, info)
+	}
+	return keys
+}
+
+// Removes all API keys of a user and returns their tokens to revoke
+// It is called from functions of this module that acquire lock, so it needs no locks
+func (m *userManager) delUserAPIKeys(userID string) []string {
+	tokens := make([]string, 0)
+	for id, key := range m.apiKeys {
+		if key.Owner == userID {
+			tokens = append(tokens, key.Token)
+			m.markRevoked(key.Token, key.Expires)
+			delete(m.apiKeys, id)
+		}
+	}
+	if len(tokens) != 0 {
+		if err := m.saveAPIKeys(); err != nil {
+			glog.Errorf("Delete user failed to save API key list: %v", err)
+		}
+	}
+	return tokens
+}
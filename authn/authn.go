@@ -11,10 +11,16 @@ import (
 )
 
 var (
-	configPath string
-	conf       = &config{}
+	configPath      string
+	rotateMasterKey bool
+	conf            = &config{}
 )
 
+func init() {
+	flag.BoolVar(&rotateMasterKey, "rotatekey", false,
+		"re-encrypt user credentials with the master key from "+newMasterKeyEnvVar+" and exit")
+}
+
 // Set up glog with options from configuration file
 func updateLogOptions() error {
 	err := flag.Lookup("log_dir").Value.Set(conf.Log.Dir)
@@ -65,12 +71,26 @@ func main() {
 	if err = updateLogOptions(); err != nil {
 		glog.Fatalf("Failed to set up logger: %v\n", err)
 	}
+	go conf.refreshSecrets()
 
 	smapFile := filepath.Join(conf.ConfDir, smapConfig)
 	proxy := newProxy(smapFile, conf.Proxy.URL)
 
 	dbPath := filepath.Join(conf.ConfDir, userListFile)
-	srv := newAuthServ(newUserManager(dbPath, proxy))
+	mgr := newUserManager(dbPath, proxy)
+	if rotateMasterKey {
+		newKey, err := masterKeyFromEnv(newMasterKeyEnvVar)
+		if err != nil || newKey == nil {
+			glog.Fatalf("Invalid new master key in %s: %v\n", newMasterKeyEnvVar, err)
+		}
+		if err = mgr.rotateMasterKey(newKey); err != nil {
+			glog.Fatalf("Failed to rotate master key: %v\n", err)
+		}
+		glog.Infoln("Master key rotated")
+		glog.Flush()
+		return
+	}
+	srv := newAuthServ(mgr)
 	if err := srv.run(); err != nil {
 		glog.Fatalf(err.Error())
 	}
@@ -1,12 +1,28 @@
 package main
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/NVIDIA/dfcpub/dfc"
+	"github.com/dgrijalva/jwt-go"
+	"golang.org/x/crypto/bcrypt"
 )
 
 const (
@@ -23,6 +39,13 @@ func init() {
 	if conf.Auth.ExpirePeriod == 0 {
 		conf.Auth.ExpirePeriod = time.Minute * 30
 	}
+	if conf.Auth.APIKeyExpirePeriod == 0 {
+		conf.Auth.APIKeyExpirePeriod = defaultAPIKeyExpirePeriod
+	}
+	// the cheapest password hashes keep the tests fast
+	if conf.Auth.PasswordCost == 0 {
+		conf.Auth.PasswordCost = bcrypt.MinCost
+	}
 }
 
 func createUsers(mgr *userManager, t *testing.T) {
@@ -67,6 +90,7 @@ func deleteUsers(mgr *userManager, skipNotExist bool, t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
+	os.Remove(apiKeyPath(dbPath))
 }
 
 func testInvalidUser(mgr *userManager, t *testing.T) {
@@ -111,7 +135,7 @@ func testUserDelete(mgr *userManager, t *testing.T) {
 		t.Errorf("Expected %d users but found %d", len(users)+1, len(mgr.Users))
 	}
 
-	token, err := mgr.issueToken(username, userpass)
+	token, err := mgr.issueToken(username, userpass, nil, nil)
 	if err != nil || token == "" {
 		t.Errorf("Failed to generate token for %s: %v", username, err)
 	}
@@ -123,7 +147,7 @@ func testUserDelete(mgr *userManager, t *testing.T) {
 	if len(mgr.Users) != len(users) {
 		t.Errorf("Expected %d users but found %d", len(users), len(mgr.Users))
 	}
-	token, err = mgr.issueToken(username, userpass)
+	token, err = mgr.issueToken(username, userpass, nil, nil)
 	if token != "" || err == nil || !strings.Contains(err.Error(), "credential") {
 		t.Errorf("Token issued for deleted user  %s: %v", username, token)
 	}
@@ -291,10 +315,12 @@ func TestToken(t *testing.T) {
 	if mgr == nil {
 		t.Fatal("Manager has not been created")
 	}
+	clock := dfc.NewFakeClock(time.Now())
+	mgr.clock = clock
 	createUsers(mgr, t)
 
 	// correct user creds
-	token, err = mgr.issueToken(users[1], passs[1])
+	token, err = mgr.issueToken(users[1], passs[1], nil, nil)
 	if err != nil || token == "" {
 		t.Errorf("Failed to generate token for %s: %v", users[1], err)
 	}
@@ -311,19 +337,17 @@ func TestToken(t *testing.T) {
 	}
 
 	// incorrect user creds
-	tokenInval, err := mgr.issueToken(users[1], passs[0])
+	tokenInval, err := mgr.issueToken(users[1], passs[0], nil, nil)
 	if tokenInval != "" || err == nil {
 		t.Errorf("Some token generated for incorrect user creds: %v", tokenInval)
 	}
 
 	// expired token test
-	tokeninfo, ok := mgr.tokens[users[1]]
+	tokeninfo, ok := mgr.tokens[token]
 	if !ok || tokeninfo == nil {
 		t.Errorf("No token found for %s", users[1])
 	}
-	if tokeninfo != nil {
-		tokeninfo.Expires = time.Now().Add(-1 * time.Hour)
-	}
+	clock.Advance(conf.Auth.ExpirePeriod + time.Minute)
 	info, err = mgr.userByToken(token)
 	if info != nil || err == nil {
 		t.Errorf("Token %s expected to be expired[%x]: %v", token, info, err)
@@ -332,7 +356,7 @@ func TestToken(t *testing.T) {
 	}
 
 	// revoke token test
-	token, err = mgr.issueToken(users[1], passs[1])
+	token, err = mgr.issueToken(users[1], passs[1], nil, nil)
 	if err == nil {
 		_, err = mgr.userByToken(token)
 	}
@@ -352,3 +376,662 @@ func TestToken(t *testing.T) {
 
 	deleteUsers(mgr, false, t)
 }
+
+func TestAPIKey(t *testing.T) {
+	proxy := &proxy{}
+	mgr := newUserManager(dbPath, proxy)
+	if mgr == nil {
+		t.Fatal("Manager has not been created")
+	}
+	createUsers(mgr, t)
+
+	// API key for non-existing user and with invalid verb
+	if _, err := mgr.addAPIKey("someuser", nil, nil); err == nil || !strings.Contains(err.Error(), "does not exist") {
+		t.Errorf("API key created for non-existing user: %v", err)
+	}
+	if _, err := mgr.addAPIKey(users[0], nil, []string{"PATCH"}); err == nil || !strings.Contains(err.Error(), "verb") {
+		t.Errorf("API key created with invalid verb: %v", err)
+	}
+
+	key, err := mgr.addAPIKey(users[0], []string{"bucket1"}, []string{"GET", "HEAD"})
+	if err != nil || key == nil || key.Token == "" {
+		t.Fatalf("Failed to create API key for %s: %v", users[0], err)
+	}
+	if key.Expires.Sub(key.Issued) != conf.Auth.APIKeyExpirePeriod {
+		t.Errorf("Invalid API key lifetime: %v", key.Expires.Sub(key.Issued))
+	}
+
+	// API keys must survive restart
+	newmgr := newUserManager(dbPath, proxy)
+	if loaded, ok := newmgr.apiKeys[key.ID]; !ok || loaded.Token != key.Token || len(loaded.Verbs) != 2 {
+		t.Errorf("API key %s not found in reloaded list", key.ID)
+	}
+	for _, info := range mgr.listAPIKeys() {
+		if info.Token != "" {
+			t.Errorf("API key list contains token for %s", info.ID)
+		}
+	}
+
+	// rotate keeps ID and scope but changes token
+	rotated, err := mgr.rotateAPIKey(key.ID)
+	if err != nil {
+		t.Errorf("Failed to rotate API key %s: %v", key.ID, err)
+	} else if rotated.ID != key.ID || rotated.Token == "" || rotated.Buckets[0] != "bucket1" {
+		t.Errorf("Invalid rotated API key: %+v", rotated)
+	}
+
+	// revoke
+	if err = mgr.revokeAPIKey(key.ID); err != nil {
+		t.Errorf("Failed to revoke API key %s: %v", key.ID, err)
+	}
+	if err = mgr.revokeAPIKey(key.ID); err == nil || !strings.Contains(err.Error(), "does not exist") {
+		t.Errorf("Revoked API key %s was revoked twice: %v", key.ID, err)
+	}
+
+	// deleting a user removes all its keys
+	if _, err = mgr.addAPIKey(users[1], nil, nil); err != nil {
+		t.Errorf("Failed to create API key for %s: %v", users[1], err)
+	}
+	if err = mgr.delUser(users[1]); err != nil {
+		t.Errorf("Failed to delete user %s: %v", users[1], err)
+	}
+	if len(mgr.apiKeys) != 0 {
+		t.Errorf("API keys of deleted user %s were not removed", users[1])
+	}
+
+	deleteUsers(mgr, true, t)
+}
+
+func TestTokenScope(t *testing.T) {
+	proxy := &proxy{}
+	mgr := newUserManager(dbPath, proxy)
+	if mgr == nil {
+		t.Fatal("Manager has not been created")
+	}
+	createUsers(mgr, t)
+	userID, pass := users[2], passs[2]
+
+	if err := mgr.updatePermissions(userID, nil, []string{"execute"}); err == nil || !strings.Contains(err.Error(), "access") {
+		t.Errorf("Invalid access was set: %v", err)
+	}
+	if err := mgr.updatePermissions(userID, []string{"bucket1", "bucket2"}, []string{dfc.AccessRead}); err != nil {
+		t.Fatalf("Failed to update permissions for %s: %v", userID, err)
+	}
+
+	// empty scope gets all user permissions
+	token, err := mgr.issueToken(userID, pass, nil, nil)
+	if err != nil || token == "" {
+		t.Fatalf("Failed to generate token for %s: %v", userID, err)
+	}
+	info := mgr.tokens[token]
+	if len(info.Buckets) != 2 || len(info.Access) != 1 || info.Access[0] != dfc.AccessRead {
+		t.Errorf("Invalid token scope: %v %v", info.Buckets, info.Access)
+	}
+
+	// a scope out of user permissions
+	if _, err = mgr.issueToken(userID, pass, []string{"bucket3"}, nil); err == nil {
+		t.Error("Token issued for not permitted bucket")
+	}
+	if _, err = mgr.issueToken(userID, pass, nil, []string{dfc.AccessWrite}); err == nil {
+		t.Error("Token issued for not permitted access")
+	}
+
+	// narrower scope gets a new token
+	scoped, err := mgr.issueToken(userID, pass, []string{"bucket2"}, nil)
+	if err != nil || scoped == "" || scoped == token {
+		t.Errorf("Failed to generate scoped token for %s: %v", userID, err)
+	}
+	if info = mgr.tokens[scoped]; len(info.Buckets) != 1 || info.Buckets[0] != "bucket2" {
+		t.Errorf("Invalid token scope: %v", info.Buckets)
+	}
+
+	key, err := mgr.addAPIKey(userID, []string{"bucket1", "bucket2"}, nil)
+	if err != nil {
+		t.Fatalf("Failed to create API key for %s: %v", userID, err)
+	}
+
+	// changing permissions revokes all user's tokens and API keys
+	if err = mgr.updatePermissions(userID, []string{"bucket2"}, nil); err != nil {
+		t.Errorf("Failed to update permissions for %s: %v", userID, err)
+	}
+	for _, tk := range []string{token, scoped} {
+		if _, err = mgr.userByToken(tk); err == nil {
+			t.Error("Token is valid after permissions changed")
+		}
+	}
+	if tinfo := mgr.introspectToken(key.Token); tinfo.Valid {
+		t.Errorf("API key %s is valid after permissions narrowed: %+v", key.ID, tinfo)
+	}
+	if _, ok := mgr.revoked[dfc.TokenDigest(key.Token)]; !ok {
+		t.Errorf("API key %s is not revoked after permissions narrowed", key.ID)
+	}
+
+	deleteUsers(mgr, false, t)
+}
+
+func TestSessions(t *testing.T) {
+	proxy := &proxy{}
+	mgr := newUserManager(dbPath, proxy)
+	if mgr == nil {
+		t.Fatal("Manager has not been created")
+	}
+	createUsers(mgr, t)
+
+	// every login creates a new session
+	tokens := make([]string, 0, 3)
+	for i := 0; i < 3; i++ {
+		token, err := mgr.issueToken(users[0], passs[0], nil, nil)
+		if err != nil || token == "" {
+			t.Fatalf("Failed to generate token for %s: %v", users[0], err)
+		}
+		for _, tk := range tokens {
+			if tk == token {
+				t.Errorf("Token %s issued twice", token)
+			}
+		}
+		tokens = append(tokens, token)
+	}
+	other, err := mgr.issueToken(users[1], passs[1], nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to generate token for %s: %v", users[1], err)
+	}
+
+	// introspection
+	tinfo := mgr.introspectToken(tokens[1])
+	if !tinfo.Valid || tinfo.UserID != users[0] || tinfo.APIKey != "" {
+		t.Errorf("Invalid token info: %+v", tinfo)
+	}
+	key, err := mgr.addAPIKey(users[0], []string{"bucket1"}, nil)
+	if err != nil {
+		t.Fatalf("Failed to create API key for %s: %v", users[0], err)
+	}
+	tinfo = mgr.introspectToken(key.Token)
+	if !tinfo.Valid || tinfo.APIKey != key.ID || len(tinfo.Buckets) != 1 {
+		t.Errorf("Invalid API key info: %+v", tinfo)
+	}
+	if tinfo = mgr.introspectToken("invalid"); tinfo.Valid || tinfo.Reason == "" {
+		t.Errorf("Invalid token introspected as valid: %+v", tinfo)
+	}
+
+	// sessions are revoked independently
+	mgr.revokeToken(tokens[0])
+	if _, err = mgr.userByToken(tokens[0]); err == nil {
+		t.Error("Revoked token is still valid")
+	}
+	if tinfo = mgr.introspectToken(tokens[0]); tinfo.Valid {
+		t.Error("Revoked token introspected as valid")
+	}
+	if info, err := mgr.userByToken(tokens[1]); err != nil || info.UserID != users[0] {
+		t.Errorf("Token of another session was revoked: %v", err)
+	}
+
+	// revoke all sessions of a user
+	if err = mgr.revokeUserTokens(users[0]); err != nil {
+		t.Errorf("Failed to revoke tokens of %s: %v", users[0], err)
+	}
+	for _, tk := range tokens {
+		if _, err = mgr.userByToken(tk); err == nil {
+			t.Errorf("Token %s is valid after revoking all sessions", tk)
+		}
+	}
+	if _, err = mgr.userByToken(other); err != nil {
+		t.Errorf("Token of %s was revoked: %v", users[1], err)
+	}
+	if err = mgr.revokeUserTokens("someuser"); err == nil {
+		t.Error("Tokens of non-existing user were revoked")
+	}
+
+	deleteUsers(mgr, false, t)
+}
+
+func TestEncryptedCreds(t *testing.T) {
+	const awsCreds = "aws_access_key_id = KEY"
+	masterKey := make([]byte, dataKeyLen)
+	copy(masterKey, "0123456789abcdef0123456789abcdef")
+	newKey := make([]byte, dataKeyLen)
+	copy(newKey, "fedcba9876543210fedcba9876543210")
+
+	proxy := &proxy{}
+	conf.Auth.MasterKey = masterKey
+	defer func() { conf.Auth.MasterKey = nil }()
+	mgr := newUserManager(dbPath, proxy)
+	if mgr == nil {
+		t.Fatal("Manager has not been created")
+	}
+	createUsers(mgr, t)
+	userID := users[0]
+
+	if _, err := mgr.updateCredentials(userID, dfc.ProviderAmazon, awsCreds); err != nil {
+		t.Fatalf("Failed to update credentials: %v", err)
+	}
+	user := mgr.Users[userID]
+	if user.DataKey == "" || user.Creds[dfc.ProviderAmazon] == awsCreds {
+		t.Error("Credentials are not encrypted")
+	}
+	if creds, err := mgr.userCreds(user); err != nil || creds[dfc.ProviderAmazon] != awsCreds {
+		t.Errorf("Failed to decrypt credentials: %v", err)
+	}
+	// the same credentials do not change anything
+	if changed, err := mgr.updateCredentials(userID, dfc.ProviderAmazon, awsCreds); changed || err != nil {
+		t.Errorf("Credentials changed: %v", err)
+	}
+	key, err := mgr.addAPIKey(userID, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to create API key: %v", err)
+	}
+
+	// rotate master key and reload
+	if err = mgr.rotateMasterKey(newKey); err != nil {
+		t.Fatalf("Failed to rotate master key: %v", err)
+	}
+	conf.Auth.MasterKey = newKey
+	newmgr := newUserManager(dbPath, proxy)
+	user = newmgr.Users[userID]
+	if creds, err := newmgr.userCreds(user); err != nil || creds[dfc.ProviderAmazon] != awsCreds {
+		t.Errorf("Failed to decrypt credentials after master key rotation: %v", err)
+	}
+	if loaded, ok := newmgr.apiKeys[key.ID]; !ok || loaded.Token != key.Token {
+		t.Errorf("Failed to load API key %s after master key rotation", key.ID)
+	}
+
+	// old master key cannot decrypt credentials
+	newmgr.masterKey = masterKey
+	if _, err = newmgr.userCreds(user); err == nil {
+		t.Error("Credentials decrypted with old master key")
+	}
+
+	// a failed rotation keeps the current master key in memory and on disk
+	thirdKey := make([]byte, dataKeyLen)
+	copy(thirdKey, "00112233445566778899aabbccddeeff")
+	blocker := apiKeyPath(dbPath) + ".tmp" // API keys cannot be saved
+	if err = os.Mkdir(blocker, 0755); err != nil {
+		t.Fatal(err)
+	}
+	err = mgr.rotateMasterKey(thirdKey)
+	os.Remove(blocker)
+	if err == nil {
+		t.Error("Master key rotated while API keys could not be saved")
+	}
+	if string(mgr.masterKey) != string(newKey) {
+		t.Error("Master key changed after failed rotation")
+	}
+	newmgr = newUserManager(dbPath, proxy)
+	if creds, err := newmgr.userCreds(newmgr.Users[userID]); err != nil || creds[dfc.ProviderAmazon] != awsCreds {
+		t.Errorf("Failed to decrypt credentials after failed master key rotation: %v", err)
+	}
+	if loaded, ok := newmgr.apiKeys[key.ID]; !ok || loaded.Token != key.Token {
+		t.Errorf("Failed to load API key %s after failed master key rotation", key.ID)
+	}
+
+	deleteUsers(mgr, false, t)
+}
+
+func TestSessionList(t *testing.T) {
+	var (
+		received []string
+		mtx      sync.Mutex
+	)
+	proxyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokenList := &dfc.TokenList{}
+		if err := json.NewDecoder(r.Body).Decode(tokenList); err != nil {
+			t.Errorf("Failed to decode token list: %v", err)
+		}
+		mtx.Lock()
+		for _, token := range tokenList.Revoked {
+			received = append(received, token.Digest)
+		}
+		mtx.Unlock()
+	}))
+	defer proxyServer.Close()
+
+	mgr := newUserManager(dbPath, &proxy{URL: proxyServer.URL})
+	createUsers(mgr, t)
+	defer deleteUsers(mgr, false, t)
+
+	tokens := make(map[string]string)
+	for i := 0; i < 2; i++ {
+		token, err := mgr.issueToken(users[i], passs[i], nil, nil)
+		if err != nil {
+			t.Fatalf("Failed to generate token for %s: %v", users[i], err)
+		}
+		tokens[users[i]] = token
+	}
+	list := mgr.listTokens()
+	if len(list) != 2 {
+		t.Fatalf("Expected 2 active tokens, found %d", len(list))
+	}
+	var session string
+	for _, info := range list {
+		if info.Token != "" || info.Session == "" || info.Expires.IsZero() {
+			t.Errorf("Invalid token list entry: %+v", info)
+		}
+		if info.UserID == users[0] {
+			session = info.Session
+		}
+	}
+
+	// revoke by session
+	if err := mgr.revokeSession(session); err != nil {
+		t.Fatalf("Failed to revoke session %s: %v", session, err)
+	}
+	if _, err := mgr.userByToken(tokens[users[0]]); err == nil {
+		t.Error("Token of revoked session is still valid")
+	}
+	if err := mgr.revokeSession("invalid"); err == nil {
+		t.Error("Non-existing session was revoked")
+	}
+	if len(mgr.listTokens()) != 1 {
+		t.Errorf("Expected 1 active token, found %d", len(mgr.listTokens()))
+	}
+
+	// resync sends all revoked tokens that have not expired yet
+	key, err := mgr.addAPIKey(users[1], nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to create API key: %v", err)
+	}
+	if err = mgr.revokeAPIKey(key.ID); err != nil {
+		t.Fatalf("Failed to revoke API key: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond) // revoked tokens are sent asynchronously
+	mtx.Lock()
+	received = nil
+	mtx.Unlock()
+	cnt, err := mgr.resyncRevokedTokens()
+	if err != nil || cnt != 2 || len(received) != 2 {
+		t.Fatalf("Expected 2 revoked tokens resent, sent %d(%v), received %d", cnt, err, len(received))
+	}
+	for _, digest := range received {
+		if digest != dfc.TokenDigest(tokens[users[0]]) && digest != dfc.TokenDigest(key.Token) {
+			t.Errorf("Unexpected revoked token resent: %s", digest)
+		}
+	}
+	if revoked := mgr.revokedTokenList(); len(revoked) != 2 {
+		t.Errorf("Expected 2 revoked tokens, found %d", len(revoked))
+	}
+}
+
+func TestUserImport(t *testing.T) {
+	mgr := newUserManager(dbPath, &proxy{})
+	createUsers(mgr, t)
+	defer deleteUsers(mgr, true, t)
+
+	csvList := "name,password,access,buckets,aws\n" +
+		"user4,pass4,read,b1;b2,\"[default]\naws_access_key_id = key\n\"\n" +
+		"user1,pass1,,,\n" + // already registered
+		"user5,,,,\n" + // no password
+		"user6,pass6,execute,,\n" + // invalid access
+		"user7,pass7,,,\n"
+	records, err := parseUserRecordsCSV(strings.NewReader(csvList))
+	if err != nil || len(records) != 5 {
+		t.Fatalf("Failed to parse CSV user list: %d records, %v", len(records), err)
+	}
+	if rec := records[0]; len(rec.Buckets) != 2 || rec.Access[0] != dfc.AccessRead || !strings.Contains(rec.Creds["aws"], "key") {
+		t.Errorf("Invalid CSV record: %+v", rec)
+	}
+	if _, err = parseUserRecordsCSV(strings.NewReader("name,password,azure\n")); err == nil {
+		t.Error("CSV with unknown provider column was parsed")
+	}
+
+	// dry run validates the records and does not add users
+	result := mgr.importUsers(records, true)
+	if !result.DryRun || result.Imported != 2 || len(result.Errors) != 3 {
+		t.Fatalf("Invalid dry run result: %+v", result)
+	}
+	for idx, record := range []int{2, 3, 4} {
+		if result.Errors[idx].Record != record || result.Errors[idx].Error == "" {
+			t.Errorf("Invalid error report: %+v", result.Errors[idx])
+		}
+	}
+	if len(mgr.Users) != len(users) {
+		t.Errorf("Dry run added users: %d users", len(mgr.Users))
+	}
+
+	// invalid records are skipped
+	result = mgr.importUsers(records, false)
+	if result.DryRun || result.Imported != 2 || len(result.Errors) != 3 {
+		t.Fatalf("Invalid import result: %+v", result)
+	}
+	if _, err = mgr.issueToken("user4", "pass4", nil, nil); err != nil {
+		t.Errorf("Imported user failed to log in: %v", err)
+	}
+	if _, err = mgr.issueToken("user7", "pass7", nil, nil); err != nil {
+		t.Errorf("Imported user failed to log in: %v", err)
+	}
+	reloadFromFile(mgr, t)
+
+	// export does not include secrets
+	exported := mgr.exportUsers()
+	if len(exported) != len(users)+2 {
+		t.Fatalf("Expected %d users exported, got %d", len(users)+2, len(exported))
+	}
+	for _, rec := range exported {
+		if rec.Password != "" || len(rec.Creds) != 0 {
+			t.Errorf("Secrets of %s exported", rec.Name)
+		}
+		if rec.Name == "user4" && (len(rec.Providers) != 1 || rec.Providers[0] != "aws" || len(rec.Buckets) != 2) {
+			t.Errorf("Invalid exported record: %+v", rec)
+		}
+	}
+	for _, name := range []string{"user4", "user7"} {
+		if err = mgr.delUser(name); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestTokenLifetime(t *testing.T) {
+	oldconf := conf.Auth
+	defer func() { conf.Auth = oldconf }()
+	conf.Auth.Roles = map[string]*roleconfig{
+		"admin":   {ExpirePeriod: 10 * time.Minute},
+		"service": {ExpirePeriod: 24 * time.Hour},
+	}
+	conf.Auth.MaxExpirePeriod = 12 * time.Hour
+
+	mgr := newUserManager(dbPath, &proxy{})
+	createUsers(mgr, t)
+	defer deleteUsers(mgr, false, t)
+
+	if err := mgr.updateTokenLifetime(users[0], "root", ""); err == nil {
+		t.Error("Unknown role was set")
+	}
+	if err := mgr.updateTokenLifetime(users[0], "", "13h"); err == nil {
+		t.Error("Token lifetime above the maximum was set")
+	}
+	if err := mgr.updateTokenLifetime(users[0], "admin", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := mgr.updateTokenLifetime(users[1], "admin", "2h"); err != nil {
+		t.Fatal(err)
+	}
+	if err := mgr.updateTokenLifetime(users[2], "service", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// user's own lifetime overrides the role's one, the role's one is capped;
+	// the lifetimes survive restart
+	reloaded := newUserManager(dbPath, &proxy{})
+	expected := []time.Duration{10 * time.Minute, 2 * time.Hour, 12 * time.Hour}
+	for idx, user := range users {
+		token, err := reloaded.issueToken(user, passs[idx], nil, nil)
+		if err != nil {
+			t.Fatalf("Failed to generate token for %s: %v", user, err)
+		}
+		info := reloaded.introspectToken(token)
+		if lifetime := info.Expires.Sub(info.Issued); lifetime != expected[idx] {
+			t.Errorf("Expected %s token lifetime %v, got %v", user, expected[idx], lifetime)
+		}
+	}
+
+	// reset to the default
+	if err := mgr.updateTokenLifetime(users[0], "", ""); err != nil {
+		t.Fatal(err)
+	}
+	if lifetime := tokenLifetime(mgr.Users[users[0]]); lifetime != conf.Auth.ExpirePeriod {
+		t.Errorf("Expected default token lifetime %v, got %v", conf.Auth.ExpirePeriod, lifetime)
+	}
+	if longest := mgr.longestTokenLifetime(); longest != conf.Auth.MaxExpirePeriod {
+		t.Errorf("Expected the longest token lifetime %v, got %v", conf.Auth.MaxExpirePeriod, longest)
+	}
+}
+
+func TestAsymmetricSigning(t *testing.T) {
+	oldconf := conf.Auth
+	defer func() { conf.Auth = oldconf }()
+	dir, err := ioutil.TempDir("", "authn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecDER, err := x509.MarshalECPrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaFile, ecFile := filepath.Join(dir, "rsa.pem"), filepath.Join(dir, "ec.pem")
+	ioutil.WriteFile(rsaFile, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}), 0600)
+	ioutil.WriteFile(ecFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: ecDER}), 0600)
+
+	conf.Auth.SigningMethod, conf.Auth.PrivateKeyFile = signingES256, rsaFile
+	if err = conf.Auth.loadSigningKey(); err == nil {
+		t.Error("ES256 signing with RSA key was set up")
+	}
+	conf.Auth.SigningMethod, conf.Auth.PrivateKeyFile = signingRS256, ""
+	if err = conf.Auth.loadSigningKey(); err == nil {
+		t.Error("RS256 signing without private key was set up")
+	}
+
+	mgr := newUserManager(dbPath, &proxy{})
+	createUsers(mgr, t)
+	defer deleteUsers(mgr, false, t)
+	for method, file := range map[string]string{signingRS256: rsaFile, signingES256: ecFile} {
+		conf.Auth.SigningMethod, conf.Auth.PrivateKeyFile = method, file
+		if err = conf.Auth.loadSigningKey(); err != nil {
+			t.Fatalf("Failed to set up %s signing: %v", method, err)
+		}
+		set, err := publicKeys()
+		if err != nil || len(set.Keys) != 1 || set.Keys[0].Alg != method {
+			t.Fatalf("Invalid %s public keys %+v, err: %v", method, set, err)
+		}
+
+		// a token verifies with the published public key, and not with the secret
+		token, err := mgr.issueToken(users[0], passs[0], nil, nil)
+		if err != nil {
+			t.Fatalf("Failed to generate %s token: %v", method, err)
+		}
+		parsed, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
+			if kid := token.Header["kid"]; kid != set.Keys[0].Kid {
+				return nil, fmt.Errorf("unexpected key %v", kid)
+			}
+			return set.Keys[0].PublicKey()
+		})
+		if err != nil || !parsed.Valid || parsed.Method.Alg() != method {
+			t.Errorf("Failed to verify %s token: %v", method, err)
+		}
+		if _, err = jwt.Parse(token, func(*jwt.Token) (interface{}, error) { return []byte(conf.Auth.Secret), nil }); err == nil {
+			t.Errorf("%s token verified with the secret", method)
+		}
+	}
+
+	conf.Auth.SigningMethod = ""
+	if err = conf.Auth.loadSigningKey(); err != nil {
+		t.Fatal(err)
+	}
+	if set, err := publicKeys(); err != nil || len(set.Keys) != 0 {
+		t.Errorf("Expected no public keys for HMAC signing, got %+v, err: %v", set, err)
+	}
+}
+
+func TestPasswordHashing(t *testing.T) {
+	oldcost := conf.Auth.PasswordCost
+	defer func() { conf.Auth.PasswordCost = oldcost }()
+
+	// user list saved by an older AuthN: base64-encoded password
+	old := map[string]*userInfo{
+		users[0]: {UserID: users[0], Password: base64.StdEncoding.EncodeToString([]byte(passs[0]))},
+	}
+	if err := dfc.LocalSave(dbPath, &old); err != nil {
+		t.Fatal(err)
+	}
+	mgr := newUserManager(dbPath, &proxy{})
+	defer deleteUsers(mgr, true, t)
+	hash := mgr.Users[users[0]].Password
+	if !isPasswordHashed(hash) || !checkPassword(hash, passs[0]) {
+		t.Fatalf("Password was not migrated: %s", hash)
+	}
+	saved := make(map[string]*userInfo)
+	if err := dfc.LocalLoad(dbPath, &saved); err != nil || saved[users[0]].Password != hash {
+		t.Fatalf("Migrated user list was not saved: %v", err)
+	}
+	if _, err := mgr.issueToken(users[0], passs[0], nil, nil); err != nil {
+		t.Errorf("Failed to log in with migrated password: %v", err)
+	}
+	if _, err := mgr.issueToken(users[0], passs[1], nil, nil); err == nil {
+		t.Error("Logged in with a wrong password")
+	}
+
+	// a new cost applies to new users and to existing ones when they log in
+	conf.Auth.PasswordCost = bcrypt.MinCost + 1
+	if err := mgr.addUser(users[1], passs[1]); err != nil {
+		t.Fatal(err)
+	}
+	if cost, _ := bcrypt.Cost([]byte(mgr.Users[users[1]].Password)); cost != conf.Auth.PasswordCost {
+		t.Errorf("Expected cost %d, got %d", conf.Auth.PasswordCost, cost)
+	}
+	if _, err := mgr.issueToken(users[0], passs[0], nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	rehashed := mgr.Users[users[0]].Password
+	if cost, _ := bcrypt.Cost([]byte(rehashed)); rehashed == hash || cost != conf.Auth.PasswordCost {
+		t.Errorf("Password was not rehashed with cost %d", conf.Auth.PasswordCost)
+	}
+	if _, err := mgr.issueToken(users[0], passs[0], nil, nil); err != nil {
+		t.Errorf("Failed to log in with rehashed password: %v", err)
+	}
+}
+
+func TestSecretsRefresh(t *testing.T) {
+	oldauth, oldsecrets := conf.Auth, conf.Secrets
+	defer func() { conf.Auth, conf.Secrets = oldauth, oldsecrets }()
+	path := filepath.Join(os.TempDir(), "authn-secrets.json")
+	defer os.Remove(path)
+
+	secrets := map[string]string{dfc.SecretAuth: "secret1", secretSuperuserPass: "pass1"}
+	if err := dfc.LocalSave(path, secrets); err != nil {
+		t.Fatal(err)
+	}
+	conf.Secrets = secretsconfig{Provider: dfc.SecretsProviderFile, Path: path}
+	if err := conf.loadSecrets(); err != nil {
+		t.Fatal(err)
+	}
+	if _, password := conf.Auth.superuser(); conf.Auth.secret() != "secret1" || password != "pass1" {
+		t.Fatalf("Secrets were not loaded: %q, %q", conf.Auth.secret(), password)
+	}
+
+	// rotated by the secrets provider: the new secret signs tokens
+	if conf.Auth.applySecrets(map[string]string{dfc.SecretAuth: "secret1"}) {
+		t.Error("Unchanged secret reported as updated")
+	}
+	if !conf.Auth.applySecrets(map[string]string{dfc.SecretAuth: "secret2"}) {
+		t.Error("Rotated secret was not reported as updated")
+	}
+	conf.Auth.signing = nil
+	token, err := signToken(jwt.MapClaims{"username": users[0]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = jwt.Parse(token, func(*jwt.Token) (interface{}, error) { return []byte("secret2"), nil }); err != nil {
+		t.Errorf("Token was not signed with the rotated secret: %v", err)
+	}
+	if _, password := conf.Auth.superuser(); password != "pass1" {
+		t.Errorf("Superuser password changed without the secret: %q", password)
+	}
+}
@@ -2,7 +2,20 @@ package main
 
 import (
 	"fmt"
+	"sync"
 	"time"
+
+	"github.com/NVIDIA/dfcpub/3rdparty/glog"
+	"github.com/NVIDIA/dfcpub/dfc"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const defaultAPIKeyExpirePeriod = time.Hour * 24 * 365
+
+// authn-only secret names (see dfc.Secret* enum for common ones)
+const (
+	secretSuperuserPass = "su_password"
+	secretMasterKey     = "master_key" // base64-encoded, overrides AUTHN_MASTER_KEY
 )
 
 type config struct {
@@ -12,6 +25,7 @@ type config struct {
 	Net     netconfig     `json:"net"`
 	Auth    authconfig    `json:"auth"`
 	Timeout timeoutconfig `json:"timeout"`
+	Secrets secretsconfig `json:"secrets"`
 }
 type proxyconfig struct {
 	URL string `json:"url"`
@@ -30,12 +44,40 @@ type httpconfig struct {
 	Key         string `json:"server_key"`
 }
 type authconfig struct {
-	Secret          string        `json:"secret"`
-	Username        string        `json:"username"`
-	Password        string        `json:"password"`
+	Secret                string                 `json:"secret"`
+	Username              string                 `json:"username"`
+	Password              string                 `json:"password"`
+	ExpirePeriodStr       string                 `json:"expiration_time"`
+	ExpirePeriod          time.Duration          `json:"-"`
+	APIKeyExpirePeriodStr string                 `json:"apikey_expiration_time"`
+	APIKeyExpirePeriod    time.Duration          `json:"-"`
+	MaxExpirePeriodStr    string                 `json:"max_expiration_time"` // caps token lifetime of all roles and users, empty - no cap
+	MaxExpirePeriod       time.Duration          `json:"-"`
+	Roles                 map[string]*roleconfig `json:"roles"`
+	SigningMethod         string                 `json:"signing_method"` // HS256(default), RS256 or ES256
+	PrivateKeyFile        string                 `json:"private_key"`    // PEM file, required for RS256 and ES256
+	TimeFormat            string                 `json:"time_format"`    // token times: RFC3339Nano(default) or RFC822 for older DFC
+	PasswordCost          int                    `json:"password_cost"`  // bcrypt cost of password hashes, 0 - bcrypt default(10)
+	MasterKey             []byte                 `json:"-"`              // read from environment, never saved
+	signing               *signingKey            // nil for HS256
+}
+
+// token lifetime of users with the role, overrides the default expiration time
+type roleconfig struct {
 	ExpirePeriodStr string        `json:"expiration_time"`
 	ExpirePeriod    time.Duration `json:"-"`
 }
+type secretsconfig struct {
+	Provider   string        `json:"provider"`     // empty - secrets are in this config, or one of dfc.SecretsProvider* enum
+	URL        string        `json:"url"`          // vault: server address
+	Path       string        `json:"path"`         // file: path to JSON file, vault: secret path
+	RefreshStr string        `json:"refresh_time"` // how often to re-read secrets, empty or 0 - never
+	Refresh    time.Duration `json:"-"`            // omitempty
+}
+
+// protects the secrets that are replaced on refresh: Auth.Secret and Auth.Password
+var secretsMtx sync.RWMutex
+
 type timeoutconfig struct {
 	DefaultStr string        `json:"default_timeout"`
 	Default    time.Duration `json:"-"` // omitempty
@@ -45,6 +87,124 @@ func (c *config) validate() (err error) {
 	if c.Auth.ExpirePeriod, err = time.ParseDuration(c.Auth.ExpirePeriodStr); err != nil {
 		return fmt.Errorf("Bad expire time format %s, err: %v", c.Auth.ExpirePeriodStr, err)
 	}
+	if c.Auth.APIKeyExpirePeriodStr == "" {
+		c.Auth.APIKeyExpirePeriod = defaultAPIKeyExpirePeriod
+	} else if c.Auth.APIKeyExpirePeriod, err = time.ParseDuration(c.Auth.APIKeyExpirePeriodStr); err != nil {
+		return fmt.Errorf("Bad API key expire time format %s, err: %v", c.Auth.APIKeyExpirePeriodStr, err)
+	}
+	if c.Auth.MaxExpirePeriodStr != "" {
+		if c.Auth.MaxExpirePeriod, err = time.ParseDuration(c.Auth.MaxExpirePeriodStr); err != nil {
+			return fmt.Errorf("Bad max expire time format %s, err: %v", c.Auth.MaxExpirePeriodStr, err)
+		}
+	}
+	if err = c.Auth.validateLifetime(c.Auth.ExpirePeriod); err != nil {
+		return fmt.Errorf("Invalid expire time: %v", err)
+	}
+	for name, role := range c.Auth.Roles {
+		if role.ExpirePeriod, err = time.ParseDuration(role.ExpirePeriodStr); err != nil {
+			return fmt.Errorf("Bad expire time format %s of role %s, err: %v", role.ExpirePeriodStr, name, err)
+		}
+		if err = c.Auth.validateLifetime(role.ExpirePeriod); err != nil {
+			return fmt.Errorf("Invalid expire time of role %s: %v", name, err)
+		}
+	}
+	if c.Auth.MasterKey, err = masterKeyFromEnv(masterKeyEnvVar); err != nil {
+		return err
+	}
+	if err = c.Auth.loadSigningKey(); err != nil {
+		return err
+	}
+	if c.Auth.PasswordCost != 0 && (c.Auth.PasswordCost < bcrypt.MinCost || c.Auth.PasswordCost > bcrypt.MaxCost) {
+		return fmt.Errorf("Invalid password cost %d, must be between %d and %d", c.Auth.PasswordCost, bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	if c.Auth.TimeFormat != "" && c.Auth.TimeFormat != timeFormatRFC3339Nano && c.Auth.TimeFormat != timeFormatRFC822 {
+		return fmt.Errorf("Invalid time format %s", c.Auth.TimeFormat)
+	}
+	if c.Secrets.RefreshStr != "" {
+		if c.Secrets.Refresh, err = time.ParseDuration(c.Secrets.RefreshStr); err != nil {
+			return fmt.Errorf("Bad secrets refresh_time format %s, err %v", c.Secrets.RefreshStr, err)
+		}
+	}
+
+	return c.loadSecrets()
+}
+
+// Token lifetime must be positive and must not exceed the cap
+func (c *authconfig) validateLifetime(lifetime time.Duration) error {
+	if lifetime <= 0 {
+		return fmt.Errorf("%v is not positive", lifetime)
+	}
+	if c.MaxExpirePeriod != 0 && lifetime > c.MaxExpirePeriod {
+		return fmt.Errorf("%v exceeds the maximum %v", lifetime, c.MaxExpirePeriod)
+	}
+	return nil
+}
 
+// Reads sensitive configuration from secrets provider: it overrides
+// the values from configuration file and environment
+func (c *config) loadSecrets() error {
+	if c.Secrets.Provider == "" {
+		return nil
+	}
+	secrets, err := dfc.FetchSecrets(c.Secrets.Provider, c.Secrets.URL, c.Secrets.Path)
+	if err != nil {
+		return err
+	}
+	c.Auth.applySecrets(secrets)
+	if encoded := secrets[secretMasterKey]; encoded != "" {
+		if c.Auth.MasterKey, err = decodeMasterKey(encoded); err != nil {
+			return fmt.Errorf("Invalid %s: %v", secretMasterKey, err)
+		}
+	}
 	return nil
 }
+
+// Re-reads secrets every refresh_time, so that the token secret can be rotated
+// in step with DFC without restarting AuthN. The master key is not refreshed:
+// changing it requires re-encrypting user credentials (see -rotatekey).
+// On error the previously loaded secrets stay in use
+func (c *config) refreshSecrets() {
+	if c.Secrets.Provider == "" || c.Secrets.Refresh == 0 {
+		return
+	}
+	ticker := time.NewTicker(c.Secrets.Refresh)
+	defer ticker.Stop()
+	for range ticker.C {
+		secrets, err := dfc.FetchSecrets(c.Secrets.Provider, c.Secrets.URL, c.Secrets.Path)
+		if err != nil {
+			glog.Errorf("Failed to refresh secrets: %v", err)
+			continue
+		}
+		if c.Auth.applySecrets(secrets) {
+			glog.Infof("%s has been updated", dfc.SecretAuth)
+		}
+	}
+}
+
+// Replaces the token secret and superuser password with the ones defined
+// by secrets provider. Returns true if the token secret has changed
+func (c *authconfig) applySecrets(secrets map[string]string) (updated bool) {
+	secretsMtx.Lock()
+	if secret := secrets[dfc.SecretAuth]; secret != "" {
+		updated = secret != c.Secret
+		c.Secret = secret
+	}
+	if password := secrets[secretSuperuserPass]; password != "" {
+		c.Password = password
+	}
+	secretsMtx.Unlock()
+	return
+}
+
+// Returns the key to sign tokens with HS256
+func (c *authconfig) secret() string {
+	secretsMtx.RLock()
+	defer secretsMtx.RUnlock()
+	return c.Secret
+}
+
+func (c *authconfig) superuser() (username, password string) {
+	secretsMtx.RLock()
+	defer secretsMtx.RUnlock()
+	return c.Username, c.Password
+}
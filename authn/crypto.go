@@ -0,0 +1,245 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package main
+
+// Envelope encryption of user credentials.
+// Every user gets a random data key that encrypts the user's cloud
+// credentials. The data key is stored encrypted with the master key. The
+// master key never gets to disk: it is read from the environment at startup.
+// Credentials are decrypted only when a token or an API key is generated.
+// Changing the master key requires re-encrypting data keys only (see
+// rotateMasterKey) - the credentials themselves are not touched.
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/NVIDIA/dfcpub/3rdparty/glog"
+)
+
+const (
+	masterKeyEnvVar    = "AUTHN_MASTER_KEY"     // base64-encoded 32-byte key
+	newMasterKeyEnvVar = "AUTHN_NEW_MASTER_KEY" // used by master key rotation
+	dataKeyLen         = 32                     // AES-256
+)
+
+// Reads base64-encoded master key from environment variable. Returns nil if
+// the variable is not set - credentials are stored unencrypted in this case
+func masterKeyFromEnv(name string) ([]byte, error) {
+	encoded := os.Getenv(name)
+	if encoded == "" {
+		return nil, nil
+	}
+	key, err := decodeMasterKey(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid %s: %v", name, err)
+	}
+	return key, nil
+}
+
+func decodeMasterKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != dataKeyLen {
+		return nil, fmt.Errorf("invalid key length %d (expecting %d bytes)", len(key), dataKeyLen)
+	}
+	return key, nil
+}
+
+// Encrypts data with AES-GCM and returns base64-encoded nonce+ciphertext
+func encryptData(key, plain []byte) (string, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, plain, nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func decryptData(key []byte, encoded string) ([]byte, error) {
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, fmt.Errorf("Encrypted data is too short")
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, nil)
+}
+
+// Returns user's data key decrypted with the master key
+func (m *userManager) userDataKey(user *userInfo) ([]byte, error) {
+	if m.masterKey == nil {
+		return nil, fmt.Errorf("Credentials of %s are encrypted but master key is not set", user.UserID)
+	}
+	key, err := decryptData(m.masterKey, user.DataKey)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decrypt data key of %s: %v", user.UserID, err)
+	}
+	return key, nil
+}
+
+// Generates a new data key for a user and encrypts all user's credentials
+// with it. Used for users created or loaded without encryption
+func (m *userManager) encryptUserCreds(user *userInfo) error {
+	if m.masterKey == nil || user.DataKey != "" {
+		return nil
+	}
+	key := make([]byte, dataKeyLen)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return err
+	}
+	encrypted := make(map[string]string, len(user.Creds))
+	for provider, creds := range user.Creds {
+		enc, err := encryptData(key, []byte(creds))
+		if err != nil {
+			return err
+		}
+		encrypted[provider] = enc
+	}
+	wrapped, err := encryptData(m.masterKey, key)
+	if err != nil {
+		return err
+	}
+	user.DataKey = wrapped
+	user.Creds = encrypted
+	return nil
+}
+
+// Returns decrypted credentials of a user for a cloud provider
+func (m *userManager) userCred(user *userInfo, provider string) (string, error) {
+	value, ok := user.Creds[provider]
+	if !ok || user.DataKey == "" {
+		return value, nil
+	}
+	key, err := m.userDataKey(user)
+	if err != nil {
+		return "", err
+	}
+	plain, err := decryptData(key, value)
+	if err != nil {
+		return "", fmt.Errorf("Failed to decrypt %s credentials of %s: %v", provider, user.UserID, err)
+	}
+	return string(plain), nil
+}
+
+// Returns all decrypted credentials of a user
+func (m *userManager) userCreds(user *userInfo) (map[string]string, error) {
+	if user.DataKey == "" {
+		return user.Creds, nil
+	}
+	creds := make(map[string]string, len(user.Creds))
+	for provider := range user.Creds {
+		value, err := m.userCred(user, provider)
+		if err != nil {
+			return nil, err
+		}
+		creds[provider] = value
+	}
+	return creds, nil
+}
+
+// Sets user's credentials for a cloud provider, encrypting them if needed
+func (m *userManager) setUserCred(user *userInfo, provider, value string) error {
+	if user.DataKey == "" {
+		user.Creds[provider] = value
+		return nil
+	}
+	key, err := m.userDataKey(user)
+	if err != nil {
+		return err
+	}
+	enc, err := encryptData(key, []byte(value))
+	if err != nil {
+		return err
+	}
+	user.Creds[provider] = enc
+	return nil
+}
+
+// Re-encrypts all data keys and API keys with a new master key and saves
+// the result. User credentials are encrypted with data keys, so they do
+// not change. If saving fails, the old master key and data keys are restored
+// in memory and saved again, so that memory and disk stay in sync
+func (m *userManager) rotateMasterKey(newKey []byte) error {
+	if len(newKey) != dataKeyLen {
+		return fmt.Errorf("Invalid master key length %d (expecting %d bytes)", len(newKey), dataKeyLen)
+	}
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	wrapped := make(map[string]string, len(m.Users))
+	for userID, user := range m.Users {
+		if user.DataKey == "" {
+			continue
+		}
+		key, err := m.userDataKey(user)
+		if err != nil {
+			return err
+		}
+		if wrapped[userID], err = encryptData(newKey, key); err != nil {
+			return err
+		}
+	}
+
+	// apply changes only when all data keys are re-encrypted successfully
+	oldKey, oldUsers := m.masterKey, make(map[string]userInfo, len(m.Users))
+	for userID, user := range m.Users {
+		oldUsers[userID] = *user
+	}
+	rollback := func(err error) error {
+		m.masterKey = oldKey
+		for userID, user := range oldUsers {
+			m.Users[userID].DataKey, m.Users[userID].Creds = user.DataKey, user.Creds
+		}
+		if rerr := m.saveUsers(); rerr != nil {
+			glog.Errorf("Failed to restore user list after master key rotation failure: %v", rerr)
+		}
+		if rerr := m.saveAPIKeys(); rerr != nil {
+			glog.Errorf("Failed to restore API key list after master key rotation failure: %v", rerr)
+		}
+		return err
+	}
+	for userID, key := range wrapped {
+		m.Users[userID].DataKey = key
+	}
+	m.masterKey = newKey
+	for _, user := range m.Users {
+		if err := m.encryptUserCreds(user); err != nil {
+			return rollback(err)
+		}
+	}
+	if err := m.saveUsers(); err != nil {
+		return rollback(err)
+	}
+	if err := m.saveAPIKeys(); err != nil {
+		return rollback(err)
+	}
+	return nil
+}
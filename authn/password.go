@@ -0,0 +1,64 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Passwords are saved to the user list as bcrypt hashes. Older user lists
+// keep passwords base64-encoded: they are hashed when the list is loaded.
+// The cost of new hashes is configurable (auth.password_cost); a password
+// hashed with another cost is rehashed when its user logs in
+
+// bcrypt hashes start with "$2a$", "$2b$" or "$2y$", base64 never contains '$'
+func isPasswordHashed(stored string) bool {
+	return strings.HasPrefix(stored, "$2")
+}
+
+func (c *authconfig) passwordCost() int {
+	if c.PasswordCost == 0 {
+		return bcrypt.DefaultCost
+	}
+	return c.PasswordCost
+}
+
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), conf.Auth.passwordCost())
+	if err != nil {
+		return "", fmt.Errorf("Failed to hash password: %v", err)
+	}
+	return string(hash), nil
+}
+
+func checkPassword(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// Returns true if the password hash was made with other than the configured cost
+func passwordNeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost != conf.Auth.passwordCost()
+}
+
+// Replaces the base64-encoded password of a user loaded from an older user
+// list with its hash. Returns false if the password is hashed already
+func migratePassword(info *userInfo) (bool, error) {
+	if isPasswordHashed(info.Password) {
+		return false, nil
+	}
+	password, err := base64.StdEncoding.DecodeString(info.Password)
+	if err != nil {
+		return false, err
+	}
+	if info.Password, err = hashPassword(string(password)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
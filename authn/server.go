@@ -23,9 +23,13 @@ import (
 )
 
 const (
-	pathUsers  = "users"
-	pathTokens = "tokens"
-	smapConfig = "smap.json"
+	pathUsers    = "users"
+	pathTokens   = "tokens"
+	pathAPIKeys  = "apikeys"
+	pathSessions = "sessions"
+	pathRevoked  = "revoked"
+	pathJWKS     = "jwks"
+	smapConfig   = "smap.json"
 )
 
 // a message to generate token
@@ -33,18 +37,72 @@ const (
 //		Body: <loginMsg>
 //	Returns: <tokenMsg>
 type loginMsg struct {
-	Password string `json:"password"`
+	Password string   `json:"password"`
+	Buckets  []string `json:"buckets,omitempty"` // requested token scope
+	Access   []string `json:"access,omitempty"`  // requested token scope
+}
+
+// bulk user import and export (see userdb.go)
+// import: PUT <version>/<pathUsers>[?dryrun=true]
+//		Body: [<userRecord>] or CSV with Content-Type: text/csv
+//	Returns: <importResult>
+// export: GET <version>/<pathUsers>[?format=csv]
+//	Returns: [<userRecord>] or CSV
+
+// a message to update user permissions and token lifetime
+// PUT <version>/<pathUsers>/<username>
+//		Body: <permissionsMsg>
+type permissionsMsg struct {
+	Buckets      []string `json:"buckets,omitempty"`
+	Access       []string `json:"access,omitempty"`
+	Role         string   `json:"role,omitempty"`
+	ExpirePeriod string   `json:"expiration_time,omitempty"`
 }
 
 // a message to test token validity and to revoke existing token
 // check: GET <version>/<pathTokens>
 //		Body: <tokenMsg>
+//	Returns: <dfc.TokenInfo>
 // revoke: DEL <version>/<pathTokens>
 //		Body: <tokenMsg>
+// revoke all user's tokens: DEL <version>/<pathTokens>/<username>
+// resend all revoked tokens to the proxy: PUT <version>/<pathTokens>
+//	Returns: <resyncMsg>
 type tokenMsg struct {
 	Token string `json:"token"`
 }
 
+// the result of revoked token list resync
+type resyncMsg struct {
+	Tokens int `json:"tokens"` // number of revoked tokens sent to the proxy
+}
+
+// revoked tokens that have not expired yet, pulled by DFC daemons at startup
+// list: GET <version>/<pathRevoked>
+//	Returns: <dfc.TokenList> with token digests only, no authorization required
+
+// public keys that verify tokens signed with RS256 or ES256 (see signing.go)
+// list: GET <version>/<pathJWKS>
+//	Returns: <dfc.JWKSet>, no authorization required
+
+// active tokens(sessions)
+// list: GET <version>/<pathSessions>
+//	Returns: [<tokenInfo>] without tokens
+// revoke: DEL <version>/<pathSessions>/<session>
+
+// a message to create API key for a user(service account)
+// create: POST <version>/<pathAPIKeys>
+//		Body: <apiKeyMsg>
+//	Returns: <apiKeyInfo>
+// rotate: PUT <version>/<pathAPIKeys>/<id>
+// revoke: DEL <version>/<pathAPIKeys>/<id>
+// list: GET <version>/<pathAPIKeys>
+type apiKeyMsg struct {
+	Owner   string   `json:"owner"`
+	Buckets []string `json:"buckets,omitempty"`
+	Verbs   []string `json:"verbs,omitempty"`
+}
+
 //-------------------------------------
 // global functions (borrowed from DFC)
 //-------------------------------------
@@ -60,7 +118,7 @@ func invalhdlr(w http.ResponseWriter, r *http.Request, msg string, errcode ...in
 		s += ", " + msg
 	}
 
-	http.Error(w, s, code)
+	dfc.WriteError(w, r, dfc.NewError(code, "%s", s))
 }
 
 func isSyscallWriteError(err error) bool {
@@ -128,20 +186,31 @@ func (a *authServ) run() error {
 	return nil
 }
 
+// registers the handler for the path under every supported API version
 func (a *authServ) registerHandler(path string, handler func(http.ResponseWriter, *http.Request)) {
-	a.mux.HandleFunc(path, handler)
-	if !strings.HasSuffix(path, "/") {
-		a.mux.HandleFunc(path+"/", handler)
+	handler = dfc.APIVersionHandler(handler)
+	for _, ver := range dfc.APIVersions {
+		p := dfc.URLPath(ver, path)
+		a.mux.HandleFunc(p, handler)
+		if !strings.HasSuffix(p, "/") {
+			a.mux.HandleFunc(p+"/", handler)
+		}
 	}
 }
 
 func (a *authServ) registerPublicHandlers() {
-	a.registerHandler(dfc.URLPath(dfc.Rversion, pathUsers), a.userHandler)
-	a.registerHandler(dfc.URLPath(dfc.Rversion, pathTokens), a.tokenHandler)
+	a.registerHandler(pathUsers, a.userHandler)
+	a.registerHandler(pathTokens, a.tokenHandler)
+	a.registerHandler(pathAPIKeys, a.apiKeyHandler)
+	a.registerHandler(pathSessions, a.sessionHandler)
+	a.registerHandler(pathRevoked, a.revokedHandler)
+	a.registerHandler(pathJWKS, a.jwksHandler)
 }
 
 func (a *authServ) userHandler(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
+	case http.MethodGet:
+		a.httpUserExport(w, r)
 	case http.MethodDelete:
 		a.httpUserDel(w, r)
 	case http.MethodPost:
@@ -157,11 +226,75 @@ func (a *authServ) tokenHandler(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodDelete:
 		a.httpRevokeToken(w, r)
+	case http.MethodGet:
+		a.httpCheckToken(w, r)
+	case http.MethodPut:
+		a.httpResyncTokens(w, r)
 	default:
 		invalhdlr(w, r, "Unsupported method", http.StatusBadRequest)
 	}
 }
 
+func (a *authServ) apiKeyHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		a.httpAPIKeyList(w, r)
+	case http.MethodPost:
+		a.httpAPIKeyAdd(w, r)
+	case http.MethodPut:
+		a.httpAPIKeyRotate(w, r)
+	case http.MethodDelete:
+		a.httpAPIKeyRevoke(w, r)
+	default:
+		invalhdlr(w, r, "Unsupported method", http.StatusBadRequest)
+	}
+}
+
+func (a *authServ) sessionHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		a.httpSessionList(w, r)
+	case http.MethodDelete:
+		a.httpSessionRevoke(w, r)
+	default:
+		invalhdlr(w, r, "Unsupported method", http.StatusBadRequest)
+	}
+}
+
+// Returns the revoked token list. It contains token digests that cannot be
+// used as tokens, so the list is available without authorization
+func (a *authServ) revokedHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		invalhdlr(w, r, "Unsupported method", http.StatusBadRequest)
+		return
+	}
+	jsbytes, err := json.Marshal(&dfc.TokenList{Revoked: a.users.revokedTokenList(), Full: true})
+	if err != nil {
+		invalhdlr(w, r, fmt.Sprintf("Failed to marshal token list: %v", err))
+		return
+	}
+	a.writeJSON(w, r, jsbytes, "list revoked tokens")
+}
+
+// Returns the public keys DFC daemons verify tokens with
+func (a *authServ) jwksHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		invalhdlr(w, r, "Unsupported method", http.StatusBadRequest)
+		return
+	}
+	set, err := publicKeys()
+	if err != nil {
+		invalhdlr(w, r, fmt.Sprintf("Failed to get public keys: %v", err))
+		return
+	}
+	jsbytes, err := json.Marshal(set)
+	if err != nil {
+		invalhdlr(w, r, fmt.Sprintf("Failed to marshal public keys: %v", err))
+		return
+	}
+	a.writeJSON(w, r, jsbytes, "list public keys")
+}
+
 // divide URL into words, throw away all before the word 'takeAfter' (including
 // it) and returns the rest
 func (a *authServ) restAPIItems(unescapedPath string, takeAfter string) []string {
@@ -176,10 +309,41 @@ func (a *authServ) restAPIItems(unescapedPath string, takeAfter string) []string
 	return nil
 }
 
+// Token introspection: returns token validity, owner, scope and expiration time
+func (a *authServ) httpCheckToken(w http.ResponseWriter, r *http.Request) {
+	apiItems := a.restAPIItems(r.URL.Path, pathTokens)
+	if len(apiItems) != 0 {
+		invalhdlr(w, r, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	msg := &tokenMsg{}
+	if err := a.readJSON(w, r, msg); err != nil {
+		glog.Errorf("Failed to read request: %v\n", err)
+		return
+	}
+	if msg.Token == "" {
+		invalhdlr(w, r, "Token is not defined", http.StatusBadRequest)
+		return
+	}
+
+	jsbytes, err := json.Marshal(a.users.introspectToken(msg.Token))
+	if err != nil {
+		invalhdlr(w, r, fmt.Sprintf("Failed to marshal token info: %v", err))
+		return
+	}
+	a.writeJSON(w, r, jsbytes, "check token")
+}
+
 // Deletes existing token, a.k.a log out
+// If the request contains user name, all user's tokens are deleted
 func (a *authServ) httpRevokeToken(w http.ResponseWriter, r *http.Request) {
 	var err error
 	apiItems := a.restAPIItems(r.URL.Path, pathTokens)
+	if len(apiItems) == 1 {
+		a.revokeUserTokens(w, r, apiItems[0])
+		return
+	}
 	if len(apiItems) != 0 {
 		invalhdlr(w, r, "Invalid request", http.StatusBadRequest)
 		return
@@ -194,6 +358,44 @@ func (a *authServ) httpRevokeToken(w http.ResponseWriter, r *http.Request) {
 	a.users.revokeToken(msg.Token)
 }
 
+// Sends all revoked tokens that have not expired yet to the proxy, e.g,
+// after the proxy has restarted
+func (a *authServ) httpResyncTokens(w http.ResponseWriter, r *http.Request) {
+	apiItems := a.restAPIItems(r.URL.Path, pathTokens)
+	if len(apiItems) != 0 {
+		invalhdlr(w, r, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	if err := a.checkAuthorization(w, r); err != nil {
+		glog.Errorf("Not authorized: %v\n", err)
+		return
+	}
+
+	cnt, err := a.users.resyncRevokedTokens()
+	if err != nil {
+		invalhdlr(w, r, fmt.Sprintf("Failed to send revoked tokens: %v", err))
+		return
+	}
+	jsbytes, err := json.Marshal(&resyncMsg{Tokens: cnt})
+	if err != nil {
+		invalhdlr(w, r, fmt.Sprintf("Failed to marshal resync result: %v", err))
+		return
+	}
+	a.writeJSON(w, r, jsbytes, "resync tokens")
+}
+
+// Revokes all tokens of a user: log out from all sessions
+func (a *authServ) revokeUserTokens(w http.ResponseWriter, r *http.Request, userID string) {
+	if err := a.checkAuthorization(w, r); err != nil {
+		glog.Errorf("Not authorized: %v\n", err)
+		return
+	}
+
+	if err := a.users.revokeUserTokens(userID); err != nil {
+		invalhdlr(w, r, fmt.Sprintf("Failed to revoke tokens: %v", err), http.StatusBadRequest)
+	}
+}
+
 func (a *authServ) httpUserDel(w http.ResponseWriter, r *http.Request) {
 	apiItems := a.restAPIItems(r.URL.Path, pathUsers)
 	if len(apiItems) == 0 {
@@ -226,20 +428,24 @@ func (a *authServ) httpUserPost(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// Updates user credentials
+// Updates user credentials or permissions
 // If user did not have credentials before updating or the credentials changes
 //   then new user list is saved and sent to the proxy to update the cluster
 func (a *authServ) httpUserPut(w http.ResponseWriter, r *http.Request) {
 	apiItems := a.restAPIItems(r.URL.Path, pathUsers)
-	if len(apiItems) < 2 {
-		invalhdlr(w, r, "Invalid request")
-		return
-	}
 	err := a.checkAuthorization(w, r)
 	if err != nil {
 		glog.Errorf("Not authorized: %v\n", err)
 		return
 	}
+	if len(apiItems) == 0 {
+		a.userImport(w, r)
+		return
+	}
+	if len(apiItems) == 1 {
+		a.userUpdatePermissions(w, r)
+		return
+	}
 
 	userID := apiItems[0]
 	provider := apiItems[1]
@@ -275,11 +481,27 @@ func (a *authServ) userAdd(w http.ResponseWriter, r *http.Request) {
 		glog.Errorf("Failed to read credentials: %v\n", err)
 		return
 	}
+	if err = validateTokenLifetime(info.Role, info.ExpirePeriodStr); err != nil {
+		invalhdlr(w, r, fmt.Sprintf("Failed to add user: %v", err), http.StatusBadRequest)
+		return
+	}
 
 	if err = a.users.addUser(info.UserID, info.Password); err != nil {
 		invalhdlr(w, r, fmt.Sprintf("Failed to add user: %v", err))
 		return
 	}
+	if len(info.Buckets) != 0 || len(info.Access) != 0 {
+		if err = a.users.updatePermissions(info.UserID, info.Buckets, info.Access); err != nil {
+			invalhdlr(w, r, fmt.Sprintf("Failed to set user permissions: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+	if info.Role != "" || info.ExpirePeriodStr != "" {
+		if err = a.users.updateTokenLifetime(info.UserID, info.Role, info.ExpirePeriodStr); err != nil {
+			invalhdlr(w, r, fmt.Sprintf("Failed to set token lifetime: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
 	if glog.V(4) {
 		glog.Infof("Added a user %s\n", info.UserID)
 	}
@@ -288,6 +510,66 @@ func (a *authServ) userAdd(w http.ResponseWriter, r *http.Request) {
 	a.writeJSON(w, r, msg, "create user")
 }
 
+// Adds users from a JSON or CSV list. Invalid records are skipped and
+// reported in the response; dry run only validates the records
+func (a *authServ) userImport(w http.ResponseWriter, r *http.Request) {
+	var (
+		records []*userRecord
+		err     error
+	)
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "text/csv") {
+		records, err = parseUserRecordsCSV(r.Body)
+	} else {
+		var b []byte
+		if b, err = ioutil.ReadAll(r.Body); err == nil {
+			records, err = parseUserRecordsJSON(b)
+		}
+	}
+	if err != nil {
+		invalhdlr(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result := a.users.importUsers(records, r.URL.Query().Get("dryrun") == "true")
+	if glog.V(4) {
+		glog.Infof("Imported %d users of %d, dry run: %t\n", result.Imported, len(records), result.DryRun)
+	}
+	jsbytes, err := json.Marshal(result)
+	if err != nil {
+		invalhdlr(w, r, fmt.Sprintf("Failed to marshal import result: %v", err))
+		return
+	}
+	a.writeJSON(w, r, jsbytes, "import users")
+}
+
+// Returns all users without passwords and credentials
+func (a *authServ) httpUserExport(w http.ResponseWriter, r *http.Request) {
+	apiItems := a.restAPIItems(r.URL.Path, pathUsers)
+	if len(apiItems) != 0 {
+		invalhdlr(w, r, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	if err := a.checkAuthorization(w, r); err != nil {
+		glog.Errorf("Not authorized: %v\n", err)
+		return
+	}
+
+	records := a.users.exportUsers()
+	if r.URL.Query().Get("format") == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+		if err := writeUserRecordsCSV(w, records); err != nil {
+			glog.Errorf("Failed to write user list: %v\n", err)
+		}
+		return
+	}
+	jsbytes, err := json.Marshal(records)
+	if err != nil {
+		invalhdlr(w, r, fmt.Sprintf("Failed to marshal user list: %v", err))
+		return
+	}
+	a.writeJSON(w, r, jsbytes, "export users")
+}
+
 // Checks if the request header contains super-user credentials and they are
 // valid. Super-user is a user created at deployment time that cannot be
 // deleted/created via REST API
@@ -310,7 +592,7 @@ func (a *authServ) checkAuthorization(w http.ResponseWriter, r *http.Request) er
 		return fmt.Errorf("Invalid header authorization")
 	}
 
-	if pair[0] != conf.Auth.Username || pair[1] != conf.Auth.Password {
+	if username, password := conf.Auth.superuser(); pair[0] != username || pair[1] != password {
 		invalhdlr(w, r, "Not authorized", http.StatusUnauthorized)
 		return fmt.Errorf("Invalid credentials")
 	}
@@ -318,9 +600,8 @@ func (a *authServ) checkAuthorization(w http.ResponseWriter, r *http.Request) er
 	return nil
 }
 
-// Generate a token for a user if provided credentials are valid.
-// If a token is already issued and it is not expired yet then the old
-// token is returned
+// Generate a new token for a user if provided credentials are valid.
+// Previously issued tokens stay valid
 func (a *authServ) userLogin(w http.ResponseWriter, r *http.Request) {
 	var err error
 
@@ -347,7 +628,7 @@ func (a *authServ) userLogin(w http.ResponseWriter, r *http.Request) {
 		glog.Infof("User: %s, pass: %s\n", userID, pass)
 	}
 
-	tokenString, err := a.users.issueToken(userID, pass)
+	tokenString, err := a.users.issueToken(userID, pass, msg.Buckets, msg.Access)
 	if err != nil {
 		glog.Errorf("Failed to generate token: %v\n", err)
 		invalhdlr(w, r, "Not authorized", http.StatusUnauthorized)
@@ -407,6 +688,34 @@ func (a *authServ) readJSON(w http.ResponseWriter, r *http.Request, out interfac
 	return nil
 }
 
+// Sets the buckets and access a user is allowed to, and the user's role and
+// token lifetime
+func (a *authServ) userUpdatePermissions(w http.ResponseWriter, r *http.Request) {
+	apiItems := a.restAPIItems(r.URL.Path, pathUsers)
+	userID := apiItems[0]
+
+	msg := &permissionsMsg{}
+	if err := a.readJSON(w, r, msg); err != nil {
+		glog.Errorf("Failed to read request: %v\n", err)
+		return
+	}
+	if err := validateTokenLifetime(msg.Role, msg.ExpirePeriod); err != nil {
+		invalhdlr(w, r, fmt.Sprintf("Failed to update permissions: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if err := a.users.updatePermissions(userID, msg.Buckets, msg.Access); err != nil {
+		invalhdlr(w, r, fmt.Sprintf("Failed to update permissions: %v", err), http.StatusBadRequest)
+		return
+	}
+	if err := a.users.updateTokenLifetime(userID, msg.Role, msg.ExpirePeriod); err != nil {
+		invalhdlr(w, r, fmt.Sprintf("Failed to update token lifetime: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	a.writeJSON(w, r, []byte("Permissions updated successfully"), "update permissions")
+}
+
 // Removes user credentials
 // On successful update the function sends new credentials list to primary
 //   proxy to update the cluster
@@ -432,3 +741,134 @@ func (a *authServ) userRemoveCredentials(w http.ResponseWriter, r *http.Request)
 
 	a.writeJSON(w, r, []byte("Credentials updated successfully"), "update credentials")
 }
+
+func (a *authServ) httpAPIKeyList(w http.ResponseWriter, r *http.Request) {
+	apiItems := a.restAPIItems(r.URL.Path, pathAPIKeys)
+	if len(apiItems) != 0 {
+		invalhdlr(w, r, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	if err := a.checkAuthorization(w, r); err != nil {
+		glog.Errorf("Not authorized: %v\n", err)
+		return
+	}
+
+	jsbytes, err := json.Marshal(a.users.listAPIKeys())
+	if err != nil {
+		invalhdlr(w, r, fmt.Sprintf("Failed to marshal API key list: %v", err))
+		return
+	}
+	a.writeJSON(w, r, jsbytes, "list API keys")
+}
+
+// Creates a new API key for an existing user
+func (a *authServ) httpAPIKeyAdd(w http.ResponseWriter, r *http.Request) {
+	apiItems := a.restAPIItems(r.URL.Path, pathAPIKeys)
+	if len(apiItems) != 0 {
+		invalhdlr(w, r, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	if err := a.checkAuthorization(w, r); err != nil {
+		glog.Errorf("Not authorized: %v\n", err)
+		return
+	}
+
+	msg := &apiKeyMsg{}
+	if err := a.readJSON(w, r, msg); err != nil {
+		glog.Errorf("Failed to read request: %v\n", err)
+		return
+	}
+
+	key, err := a.users.addAPIKey(msg.Owner, msg.Buckets, msg.Verbs)
+	if err != nil {
+		invalhdlr(w, r, fmt.Sprintf("Failed to create API key: %v", err), http.StatusBadRequest)
+		return
+	}
+	if glog.V(4) {
+		glog.Infof("Created API key %s for %s\n", key.ID, key.Owner)
+	}
+
+	a.writeAPIKey(w, r, key, "create API key")
+}
+
+// Issues a new token for an existing API key and revokes the old one
+func (a *authServ) httpAPIKeyRotate(w http.ResponseWriter, r *http.Request) {
+	apiItems := a.restAPIItems(r.URL.Path, pathAPIKeys)
+	if len(apiItems) != 1 {
+		invalhdlr(w, r, "API key ID is not defined", http.StatusBadRequest)
+		return
+	}
+	if err := a.checkAuthorization(w, r); err != nil {
+		glog.Errorf("Not authorized: %v\n", err)
+		return
+	}
+
+	key, err := a.users.rotateAPIKey(apiItems[0])
+	if err != nil {
+		invalhdlr(w, r, fmt.Sprintf("Failed to rotate API key: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	a.writeAPIKey(w, r, key, "rotate API key")
+}
+
+func (a *authServ) httpAPIKeyRevoke(w http.ResponseWriter, r *http.Request) {
+	apiItems := a.restAPIItems(r.URL.Path, pathAPIKeys)
+	if len(apiItems) != 1 {
+		invalhdlr(w, r, "API key ID is not defined", http.StatusBadRequest)
+		return
+	}
+	if err := a.checkAuthorization(w, r); err != nil {
+		glog.Errorf("Not authorized: %v\n", err)
+		return
+	}
+
+	if err := a.users.revokeAPIKey(apiItems[0]); err != nil {
+		invalhdlr(w, r, fmt.Sprintf("Failed to revoke API key: %v", err), http.StatusBadRequest)
+	}
+}
+
+// Lists active tokens: owners, scopes and expiration times, without tokens
+func (a *authServ) httpSessionList(w http.ResponseWriter, r *http.Request) {
+	apiItems := a.restAPIItems(r.URL.Path, pathSessions)
+	if len(apiItems) != 0 {
+		invalhdlr(w, r, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	if err := a.checkAuthorization(w, r); err != nil {
+		glog.Errorf("Not authorized: %v\n", err)
+		return
+	}
+
+	jsbytes, err := json.Marshal(a.users.listTokens())
+	if err != nil {
+		invalhdlr(w, r, fmt.Sprintf("Failed to marshal token list: %v", err))
+		return
+	}
+	a.writeJSON(w, r, jsbytes, "list sessions")
+}
+
+func (a *authServ) httpSessionRevoke(w http.ResponseWriter, r *http.Request) {
+	apiItems := a.restAPIItems(r.URL.Path, pathSessions)
+	if len(apiItems) != 1 {
+		invalhdlr(w, r, "Session is not defined", http.StatusBadRequest)
+		return
+	}
+	if err := a.checkAuthorization(w, r); err != nil {
+		glog.Errorf("Not authorized: %v\n", err)
+		return
+	}
+
+	if err := a.users.revokeSession(apiItems[0]); err != nil {
+		invalhdlr(w, r, fmt.Sprintf("Failed to revoke session: %v", err), http.StatusBadRequest)
+	}
+}
+
+func (a *authServ) writeAPIKey(w http.ResponseWriter, r *http.Request, key *apiKeyInfo, tag string) {
+	jsbytes, err := json.Marshal(key)
+	if err != nil {
+		invalhdlr(w, r, fmt.Sprintf("Failed to marshal API key: %v", err))
+		return
+	}
+	a.writeJSON(w, r, jsbytes, tag)
+}
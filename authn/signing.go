@@ -0,0 +1,129 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package main
+
+// Token signing. By default tokens are signed with HMAC (HS256) and the
+// shared secret that every DFC daemon must know. With RS256 or ES256 tokens
+// are signed with a private key that only AuthN has; DFC daemons verify the
+// tokens with the public key they fetch from AuthN JWKS endpoint (see
+// dfc/jwks.go). Token header "kid" identifies the key.
+
+import (
+	"crypto"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/NVIDIA/dfcpub/dfc"
+	"github.com/dgrijalva/jwt-go"
+)
+
+const (
+	signingHS256 = "HS256"
+	signingRS256 = "RS256"
+	signingES256 = "ES256"
+
+	timeFormatRFC3339Nano = "RFC3339Nano"
+	timeFormatRFC822      = "RFC822"
+)
+
+// the key tokens are signed with for asymmetric signing methods
+type signingKey struct {
+	method  jwt.SigningMethod
+	private interface{} // *rsa.PrivateKey or *ecdsa.PrivateKey
+	public  crypto.PublicKey
+	kid     string
+}
+
+// Reads the private key for asymmetric signing method from PEM file
+func (c *authconfig) loadSigningKey() error {
+	switch c.SigningMethod {
+	case "", signingHS256:
+		c.signing = nil
+		return nil
+	case signingRS256, signingES256:
+	default:
+		return fmt.Errorf("Invalid signing method: %s", c.SigningMethod)
+	}
+	if c.PrivateKeyFile == "" {
+		return fmt.Errorf("Private key is required for %s signing", c.SigningMethod)
+	}
+	pemBytes, err := ioutil.ReadFile(c.PrivateKeyFile)
+	if err != nil {
+		return fmt.Errorf("Failed to read private key: %v", err)
+	}
+
+	key := &signingKey{}
+	if c.SigningMethod == signingRS256 {
+		private, err := jwt.ParseRSAPrivateKeyFromPEM(pemBytes)
+		if err != nil {
+			return fmt.Errorf("Invalid RSA private key: %v", err)
+		}
+		key.method, key.private, key.public = jwt.SigningMethodRS256, private, &private.PublicKey
+	} else {
+		private, err := jwt.ParseECPrivateKeyFromPEM(pemBytes)
+		if err != nil {
+			return fmt.Errorf("Invalid EC private key: %v", err)
+		}
+		if private.Curve != elliptic.P256() {
+			return fmt.Errorf("ES256 requires P-256 key, got %s", private.Curve.Params().Name)
+		}
+		key.method, key.private, key.public = jwt.SigningMethodES256, private, &private.PublicKey
+	}
+	if key.kid, err = publicKeyID(key.public); err != nil {
+		return err
+	}
+	c.signing = key
+	return nil
+}
+
+// Key ID is derived from the public key, so it changes with the key
+func publicKeyID(pub crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", fmt.Errorf("Failed to marshal public key: %v", err)
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:8]), nil
+}
+
+// Signs the token claims with the configured method
+func signToken(claims jwt.MapClaims) (string, error) {
+	key := conf.Auth.signing
+	if key == nil {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(conf.Auth.secret()))
+	}
+	t := jwt.NewWithClaims(key.method, claims)
+	t.Header["kid"] = key.kid
+	return t.SignedString(key.private)
+}
+
+// Formats token issue and expiration times. DFC versions before RFC3339Nano
+// support parse only RFC822 that has no seconds
+func tokenTime(t time.Time) string {
+	if conf.Auth.TimeFormat == timeFormatRFC822 {
+		return t.Format(time.RFC822)
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+// Returns the public keys that verify tokens, empty for HMAC signing
+func publicKeys() (*dfc.JWKSet, error) {
+	set := &dfc.JWKSet{Keys: make([]*dfc.JWK, 0, 1)}
+	key := conf.Auth.signing
+	if key == nil {
+		return set, nil
+	}
+	jwk, err := dfc.NewJWK(key.kid, key.method.Alg(), key.public)
+	if err != nil {
+		return nil, err
+	}
+	set.Keys = append(set.Keys, jwk)
+	return set, nil
+}
@@ -0,0 +1,275 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Bulk user import and export. Users are imported from a JSON list of
+// userRecord or from CSV with a header: name, password, buckets, access, role
+// and expiration_time columns, and a column per cloud provider with the
+// user's credentials; list
+// values (buckets and access) are separated with ';'. Records are validated
+// one by one: invalid records are reported and skipped, valid ones are
+// imported unless it is a dry run. Export does not include passwords and
+// credentials, only the providers the user has credentials for.
+
+const csvListSep = ";"
+
+type (
+	// a user in an import or export file
+	userRecord struct {
+		Name         string            `json:"name"`
+		Password     string            `json:"password,omitempty"`
+		Buckets      []string          `json:"buckets,omitempty"`
+		Access       []string          `json:"access,omitempty"`
+		Role         string            `json:"role,omitempty"`
+		ExpirePeriod string            `json:"expiration_time,omitempty"`
+		Creds        map[string]string `json:"creds,omitempty"`     // import only: provider -> credentials
+		Providers    []string          `json:"providers,omitempty"` // export only: providers the user has credentials for
+	}
+	importError struct {
+		Record int    `json:"record"` // 1-based, not counting CSV header
+		Name   string `json:"name"`
+		Error  string `json:"error"`
+	}
+	importResult struct {
+		DryRun   bool           `json:"dryrun"`
+		Imported int            `json:"imported"` // the number of users imported or, for dry run, valid records
+		Errors   []*importError `json:"errors,omitempty"`
+	}
+)
+
+func parseUserRecordsJSON(b []byte) ([]*userRecord, error) {
+	records := make([]*userRecord, 0)
+	if err := json.Unmarshal(b, &records); err != nil {
+		return nil, fmt.Errorf("Invalid user list: %v", err)
+	}
+	return records, nil
+}
+
+func parseUserRecordsCSV(r io.Reader) ([]*userRecord, error) {
+	rows, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("Invalid user list: %v", err)
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("Invalid user list: header is missing")
+	}
+	header := rows[0]
+	hasName := false
+	for _, column := range header {
+		switch column {
+		case "name":
+			hasName = true
+		case "password", "buckets", "access", "role", "expiration_time":
+		default:
+			if !isValidProvider(column) {
+				return nil, fmt.Errorf("Invalid user list: unknown column %q", column)
+			}
+		}
+	}
+	if !hasName {
+		return nil, fmt.Errorf("Invalid user list: name column is missing")
+	}
+
+	records := make([]*userRecord, 0, len(rows)-1)
+	for _, row := range rows[1:] {
+		rec := &userRecord{}
+		for idx, value := range row {
+			switch column := header[idx]; column {
+			case "name":
+				rec.Name = value
+			case "password":
+				rec.Password = value
+			case "buckets":
+				rec.Buckets = splitCSVList(value)
+			case "access":
+				rec.Access = splitCSVList(value)
+			case "role":
+				rec.Role = value
+			case "expiration_time":
+				rec.ExpirePeriod = value
+			default:
+				if value == "" {
+					continue
+				}
+				if rec.Creds == nil {
+					rec.Creds = make(map[string]string)
+				}
+				rec.Creds[column] = value
+			}
+		}
+		records = append(records, rec)
+	}
+	return records, nil
+}
+
+func splitCSVList(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, csvListSep)
+}
+
+// Writes exported users as CSV: the same columns as for import except for
+// passwords, and credentials columns contain "yes" if the user has credentials
+func writeUserRecordsCSV(w io.Writer, records []*userRecord) error {
+	providers := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, rec := range records {
+		for _, provider := range rec.Providers {
+			if !seen[provider] {
+				seen[provider] = true
+				providers = append(providers, provider)
+			}
+		}
+	}
+	sort.Strings(providers)
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(append([]string{"name", "buckets", "access", "role", "expiration_time"}, providers...)); err != nil {
+		return err
+	}
+	for _, rec := range records {
+		row := []string{rec.Name, strings.Join(rec.Buckets, csvListSep), strings.Join(rec.Access, csvListSep),
+			rec.Role, rec.ExpirePeriod}
+		for _, provider := range providers {
+			value := ""
+			for _, p := range rec.Providers {
+				if p == provider {
+					value = "yes"
+					break
+				}
+			}
+			row = append(row, value)
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// Validates and, unless it is a dry run, adds the users. The user list is
+// saved once, after all valid records are imported
+func (m *userManager) importUsers(records []*userRecord, dryRun bool) *importResult {
+	result := &importResult{DryRun: dryRun}
+
+	// bcrypt is slow: validate the records and hash the passwords before taking
+	// the lock, so that a bulk import does not block logins
+	errs := make([]error, len(records))
+	hashes := make([]string, len(records))
+	for idx, rec := range records {
+		if errs[idx] = validateUserRecord(rec); errs[idx] != nil || dryRun {
+			continue
+		}
+		hashes[idx], errs[idx] = hashPassword(rec.Password)
+	}
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	names := make(map[string]bool, len(records))
+	for idx, rec := range records {
+		fail := func(format string, a ...interface{}) {
+			result.Errors = append(result.Errors, &importError{Record: idx + 1, Name: rec.Name, Error: fmt.Sprintf(format, a...)})
+		}
+		if errs[idx] != nil {
+			fail("%v", errs[idx])
+			continue
+		}
+		if _, ok := m.Users[rec.Name]; ok || names[rec.Name] {
+			fail("User '%s' already registered", rec.Name)
+			continue
+		}
+		names[rec.Name] = true
+		if dryRun {
+			result.Imported++
+			continue
+		}
+
+		info := &userInfo{
+			UserID:          rec.Name,
+			Password:        hashes[idx],
+			Creds:           make(map[string]string, len(rec.Creds)),
+			Buckets:         rec.Buckets,
+			Access:          rec.Access,
+			Role:            rec.Role,
+			ExpirePeriodStr: rec.ExpirePeriod,
+		}
+		if err := m.encryptUserCreds(info); err != nil {
+			fail("Failed to generate data key: %v", err)
+			continue
+		}
+		var err error
+		for provider, creds := range rec.Creds {
+			if err = m.setUserCred(info, provider, creds); err != nil {
+				break
+			}
+		}
+		if err != nil {
+			fail("%v", err)
+			continue
+		}
+		m.Users[rec.Name] = info
+		result.Imported++
+	}
+
+	if !dryRun && result.Imported != 0 {
+		if err := m.saveUsers(); err != nil {
+			result.Errors = append(result.Errors, &importError{Error: err.Error()})
+		}
+	}
+	return result
+}
+
+// Checks a user record except whether the user is already registered
+func validateUserRecord(rec *userRecord) error {
+	if rec.Name == "" || rec.Password == "" {
+		return fmt.Errorf("Invalid credentials")
+	}
+	if err := validateAccess(rec.Access); err != nil {
+		return err
+	}
+	if err := validateTokenLifetime(rec.Role, rec.ExpirePeriod); err != nil {
+		return err
+	}
+	for provider := range rec.Creds {
+		if !isValidProvider(provider) {
+			return fmt.Errorf("Invalid cloud provider: %s", provider)
+		}
+	}
+	return nil
+}
+
+// Returns all users sorted by name, without passwords and credentials
+func (m *userManager) exportUsers() []*userRecord {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	records := make([]*userRecord, 0, len(m.Users))
+	for _, user := range m.Users {
+		rec := &userRecord{
+			Name:         user.UserID,
+			Buckets:      user.Buckets,
+			Access:       user.Access,
+			Role:         user.Role,
+			ExpirePeriod: user.ExpirePeriodStr,
+		}
+		for provider := range user.Creds {
+			rec.Providers = append(rec.Providers, provider)
+		}
+		sort.Strings(rec.Providers)
+		records = append(records, rec)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].Name < records[j].Name })
+	return records
+}
@@ -6,7 +6,8 @@ package main
 
 import (
 	"bytes"
-	"encoding/base64"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"net"
@@ -25,28 +26,40 @@ const (
 	tokenFile      = ".tokens"
 	proxyTimeout   = time.Minute * 2 // maximum time for syncing Authn data with primary proxy
 	proxyRetryTime = time.Second * 5 // an interval between primary proxy detection attempts
+	randomIDLen    = 8               // bytes of randomness in API key and session IDs
 )
 
 type (
 	userInfo struct {
 		UserID          string            `json:"name"`
 		Password        string            `json:"password,omitempty"`
-		Creds           map[string]string `json:"creds,omitempty"`
-		passwordDecoded string
+		Creds           map[string]string `json:"creds,omitempty"`           // encrypted with DataKey if it is set
+		DataKey         string            `json:"data_key,omitempty"`        // user's data key encrypted with master key
+		Buckets         []string          `json:"buckets,omitempty"`         // buckets the user can access (empty - all)
+		Access          []string          `json:"access,omitempty"`          // read and/or write (empty - all)
+		Role            string            `json:"role,omitempty"`            // one of conf.Auth.Roles, defines token lifetime
+		ExpirePeriodStr string            `json:"expiration_time,omitempty"` // token lifetime, overrides the role's one
 	}
 	tokenInfo struct {
 		UserID  string    `json:"username"`
+		Session string    `json:"session"` // identifies the token when it is listed without the token itself
 		Issued  time.Time `json:"issued"`
 		Expires time.Time `json:"expires"`
-		Token   string    `json:"token"`
+		Token   string    `json:"token,omitempty"`
+		Buckets []string  `json:"buckets,omitempty"`
+		Access  []string  `json:"access,omitempty"`
 	}
 	userManager struct {
-		mtx    sync.Mutex
-		Path   string               `json:"-"`
-		Users  map[string]*userInfo `json:"users"`
-		tokens map[string]*tokenInfo
-		client *http.Client
-		proxy  *proxy
+		mtx       sync.Mutex
+		Path      string                `json:"-"`
+		Users     map[string]*userInfo  `json:"users"`
+		tokens    map[string]*tokenInfo // token -> info, a user can have many tokens(sessions)
+		revoked   map[string]time.Time  // revoked tokens that have not expired yet: token digest -> expiration time
+		apiKeys   map[string]*apiKeyInfo
+		masterKey []byte // encrypts users' data keys, nil - credentials are not encrypted
+		client    *http.Client
+		proxy     *proxy
+		clock     dfc.Clock // token and API key expiration
 	}
 )
 
@@ -71,19 +84,30 @@ func createHTTPClient() *http.Client {
 	return &http.Client{Transport: transport, Timeout: conf.Timeout.Default}
 }
 
+func generateRandomID() (string, error) {
+	b := make([]byte, randomIDLen)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
 // Creates a new user manager. If user DB exists, it loads the data from the
-// file and decrypts passwords
+// file. Base64-encoded passwords of older user lists are hashed and, if master
+// key is set, credentials of users loaded unencrypted are encrypted; then the
+// user DB is saved
 func newUserManager(dbPath string, proxy *proxy) *userManager {
-	var (
-		err   error
-		bytes []byte
-	)
+	var err error
 	mgr := &userManager{
-		Path:   dbPath,
-		Users:  make(map[string]*userInfo, 0),
-		tokens: make(map[string]*tokenInfo, 0),
-		client: createHTTPClient(),
-		proxy:  proxy,
+		Path:      dbPath,
+		Users:     make(map[string]*userInfo, 0),
+		tokens:    make(map[string]*tokenInfo, 0),
+		revoked:   make(map[string]time.Time, 0),
+		apiKeys:   make(map[string]*apiKeyInfo, 0),
+		masterKey: conf.Auth.MasterKey,
+		client:    createHTTPClient(),
+		proxy:     proxy,
+		clock:     dfc.SystemClock{},
 	}
 	if _, err = os.Stat(dbPath); err != nil {
 		if !os.IsNotExist(err) {
@@ -102,12 +126,29 @@ func newUserManager(dbPath string, proxy *proxy) *userManager {
 		}
 	}
 
+	migrated := false
 	for _, info := range mgr.Users {
-		if bytes, err = base64.StdEncoding.DecodeString(info.Password); err != nil {
-			glog.Fatalf("Failed to read user list: %v\n", err)
+		hashed, err := migratePassword(info)
+		if err != nil {
+			glog.Fatalf("Failed to read password of %s: %v\n", info.UserID, err)
+		}
+		migrated = migrated || hashed
+		if info.DataKey != "" && mgr.masterKey == nil {
+			glog.Fatalf("Credentials of %s are encrypted, master key must be set in %s\n", info.UserID, masterKeyEnvVar)
+		}
+		if info.DataKey == "" && mgr.masterKey != nil {
+			if err = mgr.encryptUserCreds(info); err != nil {
+				glog.Fatalf("Failed to encrypt credentials of %s: %v\n", info.UserID, err)
+			}
+			migrated = true
+		}
+	}
+	if migrated {
+		if err = mgr.saveUsers(); err != nil {
+			glog.Fatalf("Failed to save migrated user list: %v\n", err)
 		}
-		info.passwordDecoded = string(bytes)
 	}
+	mgr.loadAPIKeys()
 
 	return mgr
 }
@@ -128,18 +169,27 @@ func (m *userManager) addUser(userID, userPass string) error {
 		return fmt.Errorf("Invalid credentials")
 	}
 
+	// bcrypt is slow: hash before taking the lock
+	hash, err := hashPassword(userPass)
+	if err != nil {
+		return err
+	}
+
 	m.mtx.Lock()
 	defer m.mtx.Unlock()
 
 	if _, ok := m.Users[userID]; ok {
 		return fmt.Errorf("User '%s' already registered", userID)
 	}
-	m.Users[userID] = &userInfo{
-		UserID:          userID,
-		passwordDecoded: userPass,
-		Password:        base64.StdEncoding.EncodeToString([]byte(userPass)),
-		Creds:           make(map[string]string, 0),
+	info := &userInfo{
+		UserID:   userID,
+		Password: hash,
+		Creds:    make(map[string]string, 0),
+	}
+	if err := m.encryptUserCreds(info); err != nil {
+		return fmt.Errorf("Failed to generate data key: %v", err)
 	}
+	m.Users[userID] = info
 
 	return m.saveUsers()
 }
@@ -152,89 +202,180 @@ func (m *userManager) delUser(userID string) error {
 		return fmt.Errorf("User %s does not exist", userID)
 	}
 	delete(m.Users, userID)
-	token, ok := m.tokens[userID]
-	delete(m.tokens, userID)
+	revoked := m.delUserAPIKeys(userID)
+	revoked = append(revoked, m.delUserTokens(userID)...)
 	err := m.saveUsers()
 	m.mtx.Unlock()
 
-	if ok {
-		go m.sendRevokedTokensToProxy(token.Token)
+	if len(revoked) != 0 {
+		go m.sendRevokedTokensToProxy(revoked...)
 	}
 
 	return err
 }
 
-// Generates a token for a user if user credentials are valid. If the token is
-// already generated and is not expired yet the existing token is returned.
-// Token includes information about userID, AWS/GCP creds and expire token time.
+// Generates a token for a user if user credentials are valid. Every call
+// generates a new token, so a user can have many concurrent sessions that
+// expire and can be revoked independently.
+// Token includes information about userID, AWS/GCP creds, expire token time
+// and the scope: buckets and access the token grants. Requested scope is
+// capped by the user's permissions, empty scope means all user's permissions
 // If a new token was generated then it sends the proxy a new valid token list
-func (m *userManager) issueToken(userID, pwd string) (string, error) {
+func (m *userManager) issueToken(userID, pwd string, buckets, access []string) (string, error) {
 	var (
-		user  *userInfo
-		token *tokenInfo
-		ok    bool
-		err   error
+		user *userInfo
+		ok   bool
+		err  error
 	)
 
-	// check user name and pass in DB
+	// check user name and pass in DB; bcrypt is slow by design, so the
+	// password is checked without holding the lock
 	m.mtx.Lock()
-	defer m.mtx.Unlock()
 	if user, ok = m.Users[userID]; !ok {
+		m.mtx.Unlock()
 		return "", fmt.Errorf("Invalid credentials")
 	}
-	passwordDecoded := user.passwordDecoded
-	creds := user.Creds
+	hash := user.Password
+	m.mtx.Unlock()
 
-	if passwordDecoded != pwd {
+	if !checkPassword(hash, pwd) {
 		return "", fmt.Errorf("Invalid username or password")
 	}
+	rehash := ""
+	if passwordNeedsRehash(hash) {
+		if rehash, err = hashPassword(pwd); err != nil {
+			glog.Errorf("Failed to rehash password of %s: %v", userID, err)
+		}
+	}
 
-	// check if a user is already has got token. If existing token expired then
-	// delete it and reissue a new token
-	if token, ok = m.tokens[userID]; ok {
-		if token.Expires.After(time.Now()) {
-			return token.Token, nil
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	// the user may have been deleted in the meantime
+	if user, ok = m.Users[userID]; !ok || user.Password != hash {
+		return "", fmt.Errorf("Invalid username or password")
+	}
+	if rehash != "" {
+		user.Password = rehash
+		if err = m.saveUsers(); err != nil {
+			glog.Errorf("Failed to save rehashed password of %s: %v", userID, err)
 		}
-		delete(m.tokens, userID)
+	}
+	creds, err := m.userCreds(user)
+	if err != nil {
+		return "", err
+	}
+
+	if err = validateAccess(access); err != nil {
+		return "", err
+	}
+	if buckets, err = capScope(user.Buckets, buckets); err != nil {
+		return "", fmt.Errorf("Invalid bucket scope: %v", err)
+	}
+	if access, err = capScope(user.Access, access); err != nil {
+		return "", fmt.Errorf("Invalid access scope: %v", err)
+	}
+
+	sessionID, err := generateRandomID()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate session ID: %v", err)
 	}
 
 	// generate token
-	issued := time.Now()
-	expires := issued.Add(conf.Auth.ExpirePeriod)
+	issued := m.clock.Now()
+	expires := issued.Add(tokenLifetime(user))
+	m.cleanupExpiredTokens(issued)
 
 	// put all useful info into token: who owns the token, when it was issued,
-	// when it expires and credentials to log in AWS, GCP etc
-	t := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"issued":   issued.Format(time.RFC822),
-		"expires":  expires.Format(time.RFC822),
+	// when it expires, credentials to log in AWS, GCP etc, and token scope.
+	// Session ID makes tokens of the same user issued at the same time different
+	tokenString, err := signToken(jwt.MapClaims{
+		"issued":   tokenTime(issued),
+		"expires":  tokenTime(expires),
+		"session":  sessionID,
 		"username": userID,
 		"creds":    creds,
+		"buckets":  buckets,
+		"access":   access,
 	})
-	tokenString, err := t.SignedString([]byte(conf.Auth.Secret))
 	if err != nil {
 		return "", fmt.Errorf("failed to generate token: %v", err)
 	}
 
-	token = &tokenInfo{
+	token := &tokenInfo{
 		UserID:  userID,
+		Session: sessionID,
 		Issued:  issued,
 		Expires: expires,
 		Token:   tokenString,
+		Buckets: buckets,
+		Access:  access,
 	}
-	m.tokens[userID] = token
+	m.tokens[tokenString] = token
 
 	return tokenString, nil
 }
 
+// Removes expired tokens from the list of active ones
+// It is called from functions of this module that acquire lock, so it needs no locks
+func (m *userManager) cleanupExpiredTokens(now time.Time) {
+	for token, info := range m.tokens {
+		if info.Expires.Before(now) {
+			delete(m.tokens, token)
+		}
+	}
+	for digest, expires := range m.revoked {
+		if expires.Before(now) {
+			delete(m.revoked, digest)
+		}
+	}
+}
+
+// Remembers a revoked token until it expires to resend it to the proxy on resync
+// It is called from functions of this module that acquire lock, so it needs no locks
+func (m *userManager) markRevoked(token string, expires time.Time) {
+	m.revoked[dfc.TokenDigest(token)] = expires
+}
+
+// Removes all tokens of a user and returns them to revoke
+// It is called from functions of this module that acquire lock, so it needs no locks
+func (m *userManager) delUserTokens(userID string) []string {
+	tokens := make([]string, 0)
+	for token, info := range m.tokens {
+		if info.UserID == userID {
+			tokens = append(tokens, token)
+			m.markRevoked(token, info.Expires)
+			delete(m.tokens, token)
+		}
+	}
+	return tokens
+}
+
+// Revokes all tokens of a user, a.k.a log out from all sessions. API keys
+// are not affected
+func (m *userManager) revokeUserTokens(userID string) error {
+	m.mtx.Lock()
+	if _, ok := m.Users[userID]; !ok {
+		m.mtx.Unlock()
+		return fmt.Errorf("User %s does not exist", userID)
+	}
+	revoked := m.delUserTokens(userID)
+	m.mtx.Unlock()
+
+	if len(revoked) != 0 {
+		go m.sendRevokedTokensToProxy(revoked...)
+	}
+	return nil
+}
+
 // Delete existing token, a.k.a log out
 // If the token was removed successfully then it sends the proxy a new valid token list
 func (m *userManager) revokeToken(token string) {
 	m.mtx.Lock()
-	for id, info := range m.tokens {
-		if info.Token == token {
-			delete(m.tokens, id)
-			break
-		}
+	if info, ok := m.tokens[token]; ok {
+		m.markRevoked(token, info.Expires)
+		delete(m.tokens, token)
+	} else {
+		m.markRevoked(token, m.clock.Now().Add(m.longestTokenLifetime()))
 	}
 	m.mtx.Unlock()
 
@@ -243,7 +384,8 @@ func (m *userManager) revokeToken(token string) {
 	go m.sendRevokedTokensToProxy(token)
 }
 
-// update list of valid token on a proxy
+// update list of valid token on a proxy. The proxy receives token digests,
+// not the tokens (see markRevoked)
 func (m *userManager) sendRevokedTokensToProxy(tokens ...string) {
 	if len(tokens) == 0 {
 		return
@@ -253,34 +395,148 @@ func (m *userManager) sendRevokedTokensToProxy(tokens ...string) {
 		return
 	}
 
-	tokenList := dfc.TokenList{Tokens: tokens}
+	tokenList := dfc.TokenList{Revoked: make([]*dfc.RevokedToken, 0, len(tokens))}
+	m.mtx.Lock()
+	for _, token := range tokens {
+		digest := dfc.TokenDigest(token)
+		// the token may have expired in the meantime
+		if expires, ok := m.revoked[digest]; ok {
+			tokenList.Revoked = append(tokenList.Revoked, &dfc.RevokedToken{Digest: digest, Expires: expires})
+		}
+	}
+	m.mtx.Unlock()
+	if len(tokenList.Revoked) == 0 {
+		return
+	}
 	injson, _ := json.Marshal(tokenList)
 	if err := m.proxyRequest(http.MethodDelete, dfc.Rtokens, injson); err != nil {
 		glog.Errorf("Failed to send token list: %v", err)
 	}
 }
 
+// Returns the active tokens without the tokens themselves
+func (m *userManager) listTokens() []*tokenInfo {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.cleanupExpiredTokens(m.clock.Now())
+	tokens := make([]*tokenInfo, 0, len(m.tokens))
+	for _, token := range m.tokens {
+		info := &tokenInfo{}
+		*info = *token
+		info.Token = ""
+		tokens = append(tokens, info)
+	}
+	return tokens
+}
+
+// Revokes the token of a session, see listTokens
+func (m *userManager) revokeSession(sessionID string) error {
+	m.mtx.Lock()
+	for token, info := range m.tokens {
+		if info.Session == sessionID {
+			m.mtx.Unlock()
+			m.revokeToken(token)
+			return nil
+		}
+	}
+	m.mtx.Unlock()
+	return fmt.Errorf("Session %s does not exist", sessionID)
+}
+
+// Sends the proxy all revoked tokens that have not expired yet, e.g, after
+// the proxy has lost its list. Returns the number of tokens sent
+func (m *userManager) resyncRevokedTokens() (int, error) {
+	tokens := m.revokedTokenList()
+	if len(tokens) == 0 {
+		return 0, nil
+	}
+	if m.proxy.URL == "" {
+		return 0, fmt.Errorf("Primary proxy is not defined")
+	}
+	injson, _ := json.Marshal(dfc.TokenList{Revoked: tokens, Full: true})
+	if err := m.proxyRequest(http.MethodDelete, dfc.Rtokens, injson); err != nil {
+		return 0, err
+	}
+	return len(tokens), nil
+}
+
+// Returns digests of the revoked tokens that have not expired yet
+func (m *userManager) revokedTokenList() []*dfc.RevokedToken {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.cleanupExpiredTokens(m.clock.Now())
+	tokens := make([]*dfc.RevokedToken, 0, len(m.revoked))
+	for digest, expires := range m.revoked {
+		tokens = append(tokens, &dfc.RevokedToken{Digest: digest, Expires: expires})
+	}
+	return tokens
+}
+
 func (m *userManager) userByToken(token string) (*userInfo, error) {
 	m.mtx.Lock()
 	defer m.mtx.Unlock()
 
-	for id, info := range m.tokens {
-		if info.Token == token {
-			if info.Expires.Before(time.Now()) {
-				delete(m.tokens, id)
-				return nil, fmt.Errorf("Token expired")
-			}
+	info, ok := m.tokens[token]
+	if !ok {
+		return nil, fmt.Errorf("Token not found")
+	}
+	if info.Expires.Before(m.clock.Now()) {
+		delete(m.tokens, token)
+		return nil, fmt.Errorf("Token expired")
+	}
 
-			user, ok := m.Users[id]
-			if !ok {
-				return nil, fmt.Errorf("Invalid token")
-			}
+	user, ok := m.Users[info.UserID]
+	if !ok {
+		return nil, fmt.Errorf("Invalid token")
+	}
+
+	return user, nil
+}
+
+// Returns information about a token: user token or API key
+func (m *userManager) introspectToken(token string) *dfc.TokenInfo {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	now := m.clock.Now()
+	if info, ok := m.tokens[token]; ok {
+		if info.Expires.Before(now) {
+			delete(m.tokens, token)
+			return &dfc.TokenInfo{Reason: "Token expired"}
+		}
+		return &dfc.TokenInfo{
+			Valid:   true,
+			UserID:  info.UserID,
+			Buckets: info.Buckets,
+			Access:  info.Access,
+			Issued:  info.Issued,
+			Expires: info.Expires,
+		}
+	}
 
-			return user, nil
+	for _, key := range m.apiKeys {
+		if key.Token != token {
+			continue
+		}
+		if key.Expires.Before(now) {
+			return &dfc.TokenInfo{Reason: "Token expired"}
+		}
+		tinfo := &dfc.TokenInfo{
+			Valid:   true,
+			UserID:  key.Owner,
+			APIKey:  key.ID,
+			Buckets: key.Buckets,
+			Verbs:   key.Verbs,
+			Issued:  key.Issued,
+			Expires: key.Expires,
 		}
+		if user, ok := m.Users[key.Owner]; ok {
+			tinfo.Access = user.Access
+		}
+		return tinfo
 	}
 
-	return nil, fmt.Errorf("Token not found")
+	return &dfc.TokenInfo{Reason: "Token not found"}
 }
 
 // Generic function to send everything to primary proxy
@@ -337,12 +593,17 @@ func (m *userManager) updateCredentials(userID, provider, userCreds string) (boo
 		return false, err
 	}
 
-	changed := user.Creds[provider] != userCreds
+	current, err := m.userCred(user, provider)
+	if err != nil {
+		return false, err
+	}
+	changed := current != userCreds
 	if changed {
-		user.Creds[provider] = userCreds
-		if token, ok := m.tokens[userID]; ok {
-			delete(m.tokens, userID)
-			go m.sendRevokedTokensToProxy(token.Token)
+		if err = m.setUserCred(user, provider, userCreds); err != nil {
+			return false, err
+		}
+		if revoked := m.delUserTokens(userID); len(revoked) != 0 {
+			go m.sendRevokedTokensToProxy(revoked...)
 		}
 	}
 
@@ -377,3 +638,129 @@ func (m *userManager) deleteCredentials(userID, provider string) (bool, error) {
 
 	return false, nil
 }
+
+// Updates the list of buckets and access the user is allowed to. The user's
+// active tokens and API keys are revoked because they may grant more than the
+// new permissions
+func (m *userManager) updatePermissions(userID string, buckets, access []string) error {
+	if err := validateAccess(access); err != nil {
+		return err
+	}
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	user, ok := m.Users[userID]
+	if !ok {
+		return fmt.Errorf("User %s does not exist", userID)
+	}
+	user.Buckets = buckets
+	user.Access = access
+	revoked := m.delUserAPIKeys(userID)
+	revoked = append(revoked, m.delUserTokens(userID)...)
+	if len(revoked) != 0 {
+		go m.sendRevokedTokensToProxy(revoked...)
+	}
+
+	return m.saveUsers()
+}
+
+// Sets the user's role and token lifetime; an empty value resets it. The new
+// lifetime applies to the tokens issued after the update
+func (m *userManager) updateTokenLifetime(userID, role, lifetime string) error {
+	if err := validateTokenLifetime(role, lifetime); err != nil {
+		return err
+	}
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	user, ok := m.Users[userID]
+	if !ok {
+		return fmt.Errorf("User %s does not exist", userID)
+	}
+	user.Role = role
+	user.ExpirePeriodStr = lifetime
+	return m.saveUsers()
+}
+
+func validateTokenLifetime(role, lifetime string) error {
+	if _, ok := conf.Auth.Roles[role]; role != "" && !ok {
+		return fmt.Errorf("Invalid role: %s", role)
+	}
+	if lifetime == "" {
+		return nil
+	}
+	period, err := time.ParseDuration(lifetime)
+	if err != nil {
+		return fmt.Errorf("Bad expire time format %s, err: %v", lifetime, err)
+	}
+	return conf.Auth.validateLifetime(period)
+}
+
+// Returns the lifetime of the user's tokens: the user's own, the role's, or
+// the default one, whichever is defined first, capped by the maximum lifetime
+func tokenLifetime(user *userInfo) time.Duration {
+	lifetime := conf.Auth.ExpirePeriod
+	if role, ok := conf.Auth.Roles[user.Role]; ok {
+		lifetime = role.ExpirePeriod
+	}
+	if user.ExpirePeriodStr != "" {
+		if period, err := time.ParseDuration(user.ExpirePeriodStr); err == nil {
+			lifetime = period
+		} else {
+			glog.Errorf("Invalid token lifetime of %s: %v", user.UserID, err)
+		}
+	}
+	if conf.Auth.MaxExpirePeriod != 0 && lifetime > conf.Auth.MaxExpirePeriod {
+		lifetime = conf.Auth.MaxExpirePeriod
+	}
+	return lifetime
+}
+
+// Returns the longest lifetime a token can have: revoked tokens of unknown
+// sessions are kept for this long
+// It is called from functions of this module that acquire lock, so it needs no locks
+func (m *userManager) longestTokenLifetime() time.Duration {
+	if conf.Auth.MaxExpirePeriod != 0 {
+		return conf.Auth.MaxExpirePeriod
+	}
+	longest := conf.Auth.ExpirePeriod
+	for _, user := range m.Users {
+		if lifetime := tokenLifetime(user); lifetime > longest {
+			longest = lifetime
+		}
+	}
+	return longest
+}
+
+func validateAccess(access []string) error {
+	for _, a := range access {
+		if a != dfc.AccessRead && a != dfc.AccessWrite {
+			return fmt.Errorf("Invalid access: %s", a)
+		}
+	}
+	return nil
+}
+
+// Returns the requested scope limited by allowed one. Empty allowed scope
+// means no limits, empty requested scope means the whole allowed scope
+func capScope(allowed, requested []string) ([]string, error) {
+	if len(allowed) == 0 {
+		return requested, nil
+	}
+	if len(requested) == 0 {
+		return allowed, nil
+	}
+	for _, item := range requested {
+		found := false
+		for _, a := range allowed {
+			if a == item {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%s is not permitted", item)
+		}
+	}
+	return requested, nil
+}
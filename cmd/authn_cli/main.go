@@ -0,0 +1,345 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ */
+
+// 'authn_cli' is a command line tool to administer users and tokens of the
+// DFC authentication server (AuthN). It uses AuthN REST API and requires
+// superuser credentials. Run with -help for usage information.
+
+// Examples:
+// 1. Add a user who can only read bucket 'imagenet':
+//    authn_cli -buckets=imagenet -access=read useradd alice alicepass
+// 2. Set AWS credentials of the user:
+//    authn_cli credset alice aws ~/.aws/credentials
+// 3. List active tokens and revoke one of them:
+//    authn_cli tokens
+//    authn_cli revoke 3f2a9c0e1b7d4e65
+// 4. Resend all revoked tokens to the primary proxy, e.g, after the proxy restart:
+//    authn_cli resync
+// 5. Validate a user list and import it; back up the users (without secrets):
+//    authn_cli -dryrun import users.csv
+//    authn_cli import users.csv
+//    authn_cli -format=csv export > users-backup.csv
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// AuthN REST API version; not importing dfc keeps dfc command line flags out of the usage
+const apiVersion = "v1"
+
+type (
+	params struct {
+		url      string
+		user     string
+		password string
+		buckets  []string
+		access   []string
+		role     string
+		lifetime string
+		dryRun   bool
+		format   string
+		args     []string
+	}
+	verb struct {
+		nargs int
+		usage string
+		run   func(p params) error
+	}
+
+	// AuthN messages
+	userMsg struct {
+		Name         string   `json:"name"`
+		Password     string   `json:"password"`
+		Buckets      []string `json:"buckets,omitempty"`
+		Access       []string `json:"access,omitempty"`
+		Role         string   `json:"role,omitempty"`
+		ExpirePeriod string   `json:"expiration_time,omitempty"`
+	}
+	permissionsMsg struct {
+		Buckets      []string `json:"buckets,omitempty"`
+		Access       []string `json:"access,omitempty"`
+		Role         string   `json:"role,omitempty"`
+		ExpirePeriod string   `json:"expiration_time,omitempty"`
+	}
+	tokenInfo struct {
+		UserID  string    `json:"username"`
+		Session string    `json:"session"`
+		Issued  time.Time `json:"issued"`
+		Expires time.Time `json:"expires"`
+		Buckets []string  `json:"buckets,omitempty"`
+		Access  []string  `json:"access,omitempty"`
+	}
+	resyncMsg struct {
+		Tokens int `json:"tokens"`
+	}
+	importError struct {
+		Record int    `json:"record"`
+		Name   string `json:"name"`
+		Error  string `json:"error"`
+	}
+	importResult struct {
+		DryRun   bool           `json:"dryrun"`
+		Imported int            `json:"imported"`
+		Errors   []*importError `json:"errors,omitempty"`
+	}
+)
+
+var verbs = map[string]verb{
+	"useradd":    {2, "useradd USER PASSWORD: add a user with -buckets, -access, -role and -lifetime", userAdd},
+	"userdel":    {1, "userdel USER: delete a user, revoking the user's tokens and API keys", userDel},
+	"setperm":    {1, "setperm USER: set the user's -buckets, -access, -role and -lifetime", setPermissions},
+	"credset":    {3, "credset USER PROVIDER FILE: set the user's cloud credentials from the file", credSet},
+	"creddel":    {2, "creddel USER PROVIDER: delete the user's cloud credentials", credDel},
+	"tokens":     {0, "tokens: list active tokens with their sessions and expiration times", tokenList},
+	"revoke":     {1, "revoke SESSION: revoke the token of the session", revokeSession},
+	"revokeuser": {1, "revokeuser USER: revoke all tokens of the user", revokeUser},
+	"resync":     {0, "resync: resend all revoked tokens to the primary proxy", resync},
+	"import":     {1, "import FILE: add users from the JSON or CSV (*.csv) file; with -dryrun only validate", userImport},
+	"export":     {0, "export: print all users without passwords and credentials in -format", userExport},
+}
+
+func parseCmdLine() (params, string, error) {
+	var p params
+
+	// Command line options
+	flag.StringVar(&p.url, "url", "http://localhost:8203", "AuthN URL")
+	flag.StringVar(&p.user, "user", os.Getenv("AUTH_SU_NAME"), "Superuser name, default is $AUTH_SU_NAME")
+	flag.StringVar(&p.password, "password", os.Getenv("AUTH_SU_PASS"), "Superuser password, default is $AUTH_SU_PASS")
+	buckets := flag.String("buckets", "", "Comma separated buckets the user can access; empty - all")
+	access := flag.String("access", "", "Comma separated access the user has: read, write; empty - all")
+	flag.StringVar(&p.role, "role", "", "User role that defines the user's token lifetime")
+	flag.StringVar(&p.lifetime, "lifetime", "", "User token lifetime, e.g, 2h; overrides the role's one")
+	flag.BoolVar(&p.dryRun, "dryrun", false, "Validate the imported users without adding them")
+	flag.StringVar(&p.format, "format", "json", "Export format: json or csv")
+	flag.Usage = func() {
+		names := make([]string, 0, len(verbs))
+		for name := range verbs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] command [arguments]\nCommands:\n", os.Args[0])
+		for _, name := range names {
+			fmt.Fprintf(os.Stderr, "  %s\n", verbs[name].usage)
+		}
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		return params{}, "", fmt.Errorf("Command is not defined")
+	}
+	name := flag.Arg(0)
+	v, ok := verbs[name]
+	if !ok {
+		return params{}, "", fmt.Errorf("Invalid command %q", name)
+	}
+	p.args = flag.Args()[1:]
+	if len(p.args) != v.nargs {
+		return params{}, "", fmt.Errorf("Invalid number of arguments: %s", v.usage)
+	}
+	if p.user == "" || p.password == "" {
+		return params{}, "", fmt.Errorf("Superuser credentials are not defined")
+	}
+	if p.format != "json" && p.format != "csv" {
+		return params{}, "", fmt.Errorf("Invalid export format %q", p.format)
+	}
+	p.buckets = splitList(*buckets)
+	p.access = splitList(*access)
+	p.url = strings.TrimSuffix(p.url, "/")
+	return p, name, nil
+}
+
+func splitList(s string) (list []string) {
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return
+}
+
+// do sends a request to AuthN with superuser credentials and returns the response body
+func do(p params, method string, body []byte, path ...string) ([]byte, error) {
+	return doQuery(p, method, "application/json", "", body, path...)
+}
+
+func doQuery(p params, method, contentType, query string, body []byte, path ...string) ([]byte, error) {
+	url := p.url + "/" + apiVersion + "/" + strings.Join(path, "/")
+	if query != "" {
+		url += "?" + query
+	}
+	req, err := http.NewRequest(method, url, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create request, err = %v", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.SetBasicAuth(p.user, p.password)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to do request, err = %v", err)
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read response body, err = %v", err)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil, fmt.Errorf("%s %s failed, status %d: %s", method, url, resp.StatusCode, strings.TrimSpace(string(b)))
+	}
+	return b, nil
+}
+
+func userAdd(p params) error {
+	msg, err := json.Marshal(&userMsg{Name: p.args[0], Password: p.args[1], Buckets: p.buckets, Access: p.access,
+		Role: p.role, ExpirePeriod: p.lifetime})
+	if err != nil {
+		return err
+	}
+	_, err = do(p, http.MethodPost, msg, "users")
+	return err
+}
+
+func userDel(p params) error {
+	_, err := do(p, http.MethodDelete, nil, "users", p.args[0])
+	return err
+}
+
+func setPermissions(p params) error {
+	msg, err := json.Marshal(&permissionsMsg{Buckets: p.buckets, Access: p.access, Role: p.role, ExpirePeriod: p.lifetime})
+	if err != nil {
+		return err
+	}
+	_, err = do(p, http.MethodPut, msg, "users", p.args[0])
+	return err
+}
+
+func credSet(p params) error {
+	creds, err := ioutil.ReadFile(p.args[2])
+	if err != nil {
+		return err
+	}
+	_, err = do(p, http.MethodPut, creds, "users", p.args[0], p.args[1])
+	return err
+}
+
+func credDel(p params) error {
+	_, err := do(p, http.MethodDelete, nil, "users", p.args[0], p.args[1])
+	return err
+}
+
+func tokenList(p params) error {
+	b, err := do(p, http.MethodGet, nil, "sessions")
+	if err != nil {
+		return err
+	}
+	var tokens []*tokenInfo
+	if err = json.Unmarshal(b, &tokens); err != nil {
+		return fmt.Errorf("Failed to unmarshal token list, err: %v - [%s]", err, string(b))
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].Expires.Before(tokens[j].Expires) })
+
+	fmt.Printf("%-18s%-16s%-22s%-22s%s\n", "Session", "User", "Issued", "Expires", "Scope")
+	for _, token := range tokens {
+		scope := strings.Join(token.Buckets, ",")
+		if len(token.Access) != 0 {
+			scope += " (" + strings.Join(token.Access, ",") + ")"
+		}
+		fmt.Printf("%-18s%-16s%-22s%-22s%s\n", token.Session, token.UserID,
+			token.Issued.Format(time.RFC822), token.Expires.Format(time.RFC822), scope)
+	}
+	return nil
+}
+
+func revokeSession(p params) error {
+	_, err := do(p, http.MethodDelete, nil, "sessions", p.args[0])
+	return err
+}
+
+func revokeUser(p params) error {
+	_, err := do(p, http.MethodDelete, nil, "tokens", p.args[0])
+	return err
+}
+
+func resync(p params) error {
+	b, err := do(p, http.MethodPut, nil, "tokens")
+	if err != nil {
+		return err
+	}
+	msg := &resyncMsg{}
+	if err = json.Unmarshal(b, msg); err != nil {
+		return fmt.Errorf("Failed to unmarshal resync result, err: %v - [%s]", err, string(b))
+	}
+	fmt.Printf("%d revoked tokens sent to the proxy\n", msg.Tokens)
+	return nil
+}
+
+func userImport(p params) error {
+	users, err := ioutil.ReadFile(p.args[0])
+	if err != nil {
+		return err
+	}
+	contentType, query := "application/json", ""
+	if strings.HasSuffix(strings.ToLower(p.args[0]), ".csv") {
+		contentType = "text/csv"
+	}
+	if p.dryRun {
+		query = "dryrun=true"
+	}
+	b, err := doQuery(p, http.MethodPut, contentType, query, users, "users")
+	if err != nil {
+		return err
+	}
+	result := &importResult{}
+	if err = json.Unmarshal(b, result); err != nil {
+		return fmt.Errorf("Failed to unmarshal import result, err: %v - [%s]", err, string(b))
+	}
+	for _, e := range result.Errors {
+		fmt.Printf("Record %d (%s): %s\n", e.Record, e.Name, e.Error)
+	}
+	if result.DryRun {
+		fmt.Printf("%d valid users\n", result.Imported)
+	} else {
+		fmt.Printf("%d users imported\n", result.Imported)
+	}
+	if len(result.Errors) != 0 {
+		return fmt.Errorf("%d invalid records", len(result.Errors))
+	}
+	return nil
+}
+
+func userExport(p params) error {
+	b, err := doQuery(p, http.MethodGet, "application/json", "format="+p.format, nil, "users")
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(b)
+	return err
+}
+
+func main() {
+	p, name, err := parseCmdLine()
+	if err != nil {
+		fmt.Println(err)
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err = verbs[name].run(p); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,135 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ */
+
+// 'dfcadm' is a command line tool to administer a DFC cluster.
+// It sends requests to a proxy server fronting targets.
+// Run with -help for usage information.
+
+// Examples:
+// 1. Run the cluster self-test with local buckets only:
+//    dfcadm selftest
+// 2. Run the cluster self-test with 16MB objects, including cold GET from two cloud buckets:
+//    dfcadm -ip=10.0.0.1 -size=16777216 -cloudbuckets=myS3bucket,myGCPbucket selftest
+// 3. Validate the tar shards of a bucket against their manifests:
+//    dfcadm -bucket=imagenet-shards validate
+// 4. Validate and repair the shards from the original dataset:
+//    dfcadm -bucket=imagenet-shards -repair=/data/imagenet validate
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/NVIDIA/dfcpub/dfc"
+	"github.com/NVIDIA/dfcpub/pkg/client"
+)
+
+type params struct {
+	proxyURL     string
+	size         int64
+	cloudBuckets []string
+	bucket       string
+	repairDir    string
+}
+
+// verbs maps each command to its handler; the handler returns the exit status
+var verbs = map[string]func(p params) int{
+	"selftest": selftest,
+	"validate": validate,
+}
+
+func parseCmdLine() (params, string, error) {
+	var p params
+
+	// Command line options
+	ip := flag.String("ip", "localhost", "IP address for proxy server")
+	port := flag.Int("port", 8080, "Port number for proxy server")
+	flag.Int64Var(&p.size, "size", 0, "selftest: size of the test objects in bytes; 0 = the cluster's default")
+	cloudBuckets := flag.String("cloudbuckets", "", "selftest: comma separated cloud buckets to test cold GET with")
+	flag.StringVar(&p.bucket, "bucket", "", "validate: bucket of tar shards")
+	flag.StringVar(&p.repairDir, "repair", "", "validate: directory with the original files to repair the shards from")
+	flag.Usage = func() {
+		names := make([]string, 0, len(verbs))
+		for name := range verbs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] {%s}\n", os.Args[0], strings.Join(names, " | "))
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		return params{}, "", fmt.Errorf("Expected exactly one command, got %d", flag.NArg())
+	}
+	verb := flag.Arg(0)
+	if _, ok := verbs[verb]; !ok {
+		return params{}, "", fmt.Errorf("Invalid command %q", verb)
+	}
+	if p.size < 0 {
+		return params{}, "", fmt.Errorf("Invalid option: size %d", p.size)
+	}
+	if verb == "validate" && p.bucket == "" {
+		return params{}, "", fmt.Errorf("Command %q requires a bucket", verb)
+	}
+	for _, bucket := range strings.Split(*cloudBuckets, ",") {
+		if bucket = strings.TrimSpace(bucket); bucket != "" {
+			p.cloudBuckets = append(p.cloudBuckets, bucket)
+		}
+	}
+
+	p.proxyURL = "http://" + *ip + ":" + strconv.Itoa(*port)
+	return p, verb, nil
+}
+
+// selftest runs the cluster self-test and prints its report
+func selftest(p params) int {
+	report, err := client.SelfTest(p.proxyURL, &dfc.SelfTestMsg{Size: p.size, CloudBuckets: p.cloudBuckets})
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	fmt.Printf("%-6s%-10s%-22s%-36s%-12s%s\n", "", "Check", "Target", "Mountpath/Bucket", "Duration", "Error")
+	failed := 0
+	for _, check := range report.Checks {
+		result := "PASS"
+		if !check.Passed {
+			result = "FAIL"
+			failed++
+		}
+		location := check.Mountpath
+		if check.Bucket != "" {
+			location = check.Bucket
+			if check.Provider != "" {
+				location += " (" + check.Provider + ")"
+			}
+		}
+		fmt.Printf("%-6s%-10s%-22s%-36s%-12v%s\n", result, check.Name, check.Target, location,
+			check.Duration, check.Error)
+	}
+
+	if !report.Passed {
+		fmt.Printf("Self-test failed: %d of %d checks failed\n", failed, len(report.Checks))
+		return 1
+	}
+	fmt.Printf("Self-test passed: %d checks\n", len(report.Checks))
+	return 0
+}
+
+func main() {
+	p, verb, err := parseCmdLine()
+	if err != nil {
+		fmt.Println(err)
+		flag.Usage()
+		os.Exit(2)
+	}
+	os.Exit(verbs[verb](p))
+}
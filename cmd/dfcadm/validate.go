@@ -0,0 +1,331 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ */
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/NVIDIA/dfcpub/dfc"
+	"github.com/NVIDIA/dfcpub/pkg/client"
+	"github.com/NVIDIA/dfcpub/pkg/client/readers"
+)
+
+// Dataset validation. The bucket holds tar shards, each <name>.tar object
+// accompanied by its manifest <name>.tar.json (see the bucket export in the
+// README). validate reads every shard from the cluster and checks each of its
+// members against the manifest: the name, the offset of the data within the
+// shard, the size and the xxhash checksum. With -repair=dir, a shard that
+// fails the check is rebuilt, in the manifest's order, from its intact
+// members and the files <dir>/<member-name>, which must match the manifest;
+// the rebuilt shard and its updated manifest replace the originals.
+
+const manifestExt = ".json"
+
+type (
+	// member is a tar record of the downloaded shard
+	member struct {
+		offset int64 // of the data within the shard
+		size   int64
+		cksum  string
+	}
+	shardCheck struct {
+		manifest   *dfc.ExportManifest
+		members    map[string]*member
+		extra      []string // in the shard, not in the manifest
+		problems   []string // one per member
+		workfile   string   // the downloaded shard; repair only
+		unreadable error
+	}
+	countingReader struct {
+		r io.Reader
+		n int64
+	}
+	countingWriter struct {
+		w io.Writer
+		n int64
+	}
+)
+
+func (cr *countingReader) Read(p []byte) (n int, err error) {
+	n, err = cr.r.Read(p)
+	cr.n += int64(n)
+	return
+}
+
+func (cw *countingWriter) Write(p []byte) (n int, err error) {
+	n, err = cw.w.Write(p)
+	cw.n += int64(n)
+	return
+}
+
+// validate checks all shards of the bucket and repairs them, if requested
+func validate(p params) int {
+	names, err := client.ListObjects(p.proxyURL, p.bucket, "", 0)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	objects := make(map[string]bool, len(names))
+	for _, name := range names {
+		objects[name] = true
+	}
+
+	var shards, members, failed, repaired int
+	fmt.Printf("%-40s%-48s%s\n", "Shard", "Member", "Problem")
+	for _, name := range names {
+		if !strings.HasSuffix(name, ".tar"+manifestExt) {
+			continue
+		}
+		shard := strings.TrimSuffix(name, manifestExt)
+		manifest, err := getManifest(p, name)
+		if err != nil {
+			fmt.Printf("%-40s%-48s%v\n", shard, "", err)
+			failed++
+			continue
+		}
+		manifest.Shard = shard
+		shards++
+		members += len(manifest.Objects)
+
+		check := &shardCheck{manifest: manifest, members: make(map[string]*member)}
+		if !objects[shard] {
+			check.unreadable = fmt.Errorf("shard %s does not exist", shard)
+		} else {
+			check.download(p)
+		}
+		check.compare()
+		if check.unreadable != nil {
+			fmt.Printf("%-40s%-48s%v\n", shard, "", check.unreadable)
+		}
+		for _, problem := range check.problems {
+			fmt.Printf("%-40s%s\n", shard, problem)
+		}
+		if check.unreadable == nil && len(check.problems) == 0 {
+			continue
+		}
+		if p.repairDir == "" {
+			failed++
+		} else if err = check.repair(p); err != nil {
+			fmt.Printf("%-40s%-48s%v\n", shard, "", err)
+			failed++
+		} else {
+			fmt.Printf("%-40s%-48s%s\n", shard, "", "repaired")
+			repaired++
+		}
+		if check.workfile != "" {
+			os.Remove(check.workfile)
+		}
+	}
+
+	fmt.Printf("Validated %d shards, %d members: %d repaired, %d failed\n", shards, members, repaired, failed)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+func getManifest(p params, name string) (*dfc.ExportManifest, error) {
+	buf := &bytes.Buffer{}
+	if _, _, err := client.GetFile(p.proxyURL, p.bucket, name, nil, nil, true /* silent */, false /* validate */, buf); err != nil {
+		return nil, err
+	}
+	manifest := &dfc.ExportManifest{}
+	if err := json.Unmarshal(buf.Bytes(), manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest %s: %v", name, err)
+	}
+	return manifest, nil
+}
+
+// download reads the shard from the cluster; to repair it later the shard is
+// also saved to a local file
+func (check *shardCheck) download(p params) {
+	pr, pw := io.Pipe()
+	go func() {
+		_, _, err := client.GetFile(p.proxyURL, p.bucket, check.manifest.Shard, nil, nil, true, false, pw)
+		pw.CloseWithError(err)
+	}()
+	defer pr.Close()
+
+	var r io.Reader = pr
+	if p.repairDir != "" {
+		file, err := ioutil.TempFile("", "dfcadm-shard")
+		if err != nil {
+			check.unreadable = err
+			return
+		}
+		defer file.Close()
+		check.workfile = file.Name()
+		r = io.TeeReader(pr, file)
+	}
+	check.unreadable = check.read(r)
+}
+
+// read records the members of the tar stream
+func (check *shardCheck) read(r io.Reader) error {
+	cr := &countingReader{r: r}
+	tr := tar.NewReader(cr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read shard %s, err: %v", check.manifest.Shard, err)
+		}
+		if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA {
+			continue
+		}
+		m := &member{offset: cr.n}
+		if m.size, m.cksum, err = client.ReadWriteWithHash(tr, ioutil.Discard); err != nil {
+			return fmt.Errorf("failed to read %s of shard %s, err: %v", hdr.Name, check.manifest.Shard, err)
+		}
+		if _, ok := check.members[hdr.Name]; ok {
+			check.problems = append(check.problems, fmt.Sprintf("%-48s%s", hdr.Name, "duplicate"))
+			continue
+		}
+		check.members[hdr.Name] = m
+	}
+	// drain the trailing padding, so that the local copy is complete
+	_, err := io.Copy(ioutil.Discard, cr)
+	return err
+}
+
+// compare checks the members against the manifest
+func (check *shardCheck) compare() {
+	listed := make(map[string]bool, len(check.manifest.Objects))
+	for _, obj := range check.manifest.Objects {
+		listed[obj.Name] = true
+		if problem := check.verify(obj); problem != "" {
+			check.problems = append(check.problems, fmt.Sprintf("%-48s%s", obj.Name, problem))
+		}
+	}
+	for name := range check.members {
+		if !listed[name] {
+			check.extra = append(check.extra, name)
+			check.problems = append(check.problems, fmt.Sprintf("%-48s%s", name, "not in the manifest"))
+		}
+	}
+}
+
+// verify returns the problem with the member, if any
+func (check *shardCheck) verify(obj *dfc.ExportedObject) string {
+	m, ok := check.members[obj.Name]
+	switch {
+	case !ok:
+		return "missing"
+	case m.size != obj.Size:
+		return fmt.Sprintf("corrupt: size %d, expected %d", m.size, obj.Size)
+	case obj.Checksum != "" && m.cksum != obj.Checksum:
+		return fmt.Sprintf("corrupt: checksum %s, expected %s", m.cksum, obj.Checksum)
+	case m.offset != obj.Offset:
+		return fmt.Sprintf("misplaced: offset %d, expected %d", m.offset, obj.Offset)
+	}
+	return ""
+}
+
+// repair rebuilds the shard and stores it with the updated manifest. Members
+// that are not in the manifest are kept and appended to it
+func (check *shardCheck) repair(p params) error {
+	var (
+		manifest = check.manifest
+		shard    *os.File
+		err      error
+	)
+	if check.workfile != "" {
+		if shard, err = os.Open(check.workfile); err != nil {
+			return err
+		}
+		defer shard.Close()
+	}
+	file, err := ioutil.TempFile("", "dfcadm-repair")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		file.Close()
+		os.Remove(file.Name())
+	}()
+	cw := &countingWriter{w: file}
+	tw := tar.NewWriter(cw)
+
+	objects := manifest.Objects
+	for _, name := range check.extra {
+		m := check.members[name]
+		objects = append(objects, &dfc.ExportedObject{Name: name, Size: m.size, Checksum: m.cksum})
+	}
+	for _, obj := range objects {
+		var r io.ReadCloser
+		if m, ok := check.members[obj.Name]; ok && shard != nil && m.size == obj.Size &&
+			(obj.Checksum == "" || m.cksum == obj.Checksum) {
+			r = ioutil.NopCloser(io.NewSectionReader(shard, m.offset, m.size))
+		} else if r, err = openSource(p.repairDir, obj); err != nil {
+			return err
+		}
+		if obj.ModifiedAt.IsZero() {
+			obj.ModifiedAt = time.Now()
+		}
+		hdr := &tar.Header{Typeflag: tar.TypeReg, Name: obj.Name, Size: obj.Size, Mode: 0644, ModTime: obj.ModifiedAt}
+		if err = tw.WriteHeader(hdr); err == nil {
+			obj.Offset = cw.n
+			_, err = io.Copy(tw, r)
+		}
+		r.Close()
+		if err != nil {
+			return fmt.Errorf("failed to write %s, err: %v", obj.Name, err)
+		}
+	}
+	manifest.Objects = objects
+	if err = tw.Close(); err != nil {
+		return err
+	}
+
+	mfile := file.Name() + manifestExt
+	if err = dfc.LocalSave(mfile, manifest); err != nil {
+		return err
+	}
+	defer os.Remove(mfile)
+	for name, fn := range map[string]string{manifest.Shard: file.Name(), manifest.Shard + manifestExt: mfile} {
+		reader, err := readers.NewFileReaderFromFile(fn, true /* withHash */)
+		if err != nil {
+			return err
+		}
+		if err = client.Put(p.proxyURL, reader, p.bucket, name, true /* silent */); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// openSource opens the source file of the member and makes sure it matches
+// the manifest
+func openSource(dir string, obj *dfc.ExportedObject) (*os.File, error) {
+	fqn := filepath.Join(dir, filepath.FromSlash(obj.Name))
+	file, err := os.Open(fqn)
+	if err != nil {
+		return nil, fmt.Errorf("cannot repair %s: %v", obj.Name, err)
+	}
+	size, cksum, err := client.ReadWriteWithHash(file, ioutil.Discard)
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("cannot repair %s: %v", obj.Name, err)
+	}
+	if size != obj.Size || (obj.Checksum != "" && cksum != obj.Checksum) {
+		file.Close()
+		return nil, fmt.Errorf("cannot repair %s: %s does not match the manifest", obj.Name, fqn)
+	}
+	return file, nil
+}
@@ -0,0 +1,78 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ */
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/NVIDIA/dfcpub/dfc"
+	"github.com/NVIDIA/dfcpub/pkg/client"
+)
+
+func TestShardCheck(t *testing.T) {
+	members := map[string]string{"a.jpg": "aaaa", "b.jpg": "bbbbbbbb", "c.jpg": "cc", "x.jpg": "x"}
+	buf := &bytes.Buffer{}
+	cw := &countingWriter{w: buf}
+	tw := tar.NewWriter(cw)
+	manifest := &dfc.ExportManifest{Shard: "s.tar"}
+	for _, name := range []string{"a.jpg", "b.jpg", "x.jpg"} {
+		data := members[name]
+		if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: name, Size: int64(len(data)), Mode: 0644}); err != nil {
+			t.Fatal(err)
+		}
+		obj := &dfc.ExportedObject{Name: name, Size: int64(len(data)), Offset: cw.n}
+		_, obj.Checksum, _ = client.ReadWriteWithHash(strings.NewReader(data), tw)
+		if name != "x.jpg" {
+			manifest.Objects = append(manifest.Objects, obj)
+		}
+	}
+	tw.Close()
+	_, cksum, _ := client.ReadWriteWithHash(strings.NewReader(members["c.jpg"]), ioutil.Discard)
+	manifest.Objects = append(manifest.Objects, &dfc.ExportedObject{Name: "c.jpg", Size: 2, Checksum: cksum})
+	manifest.Objects[1].Checksum = "0123456789abcdef" // b.jpg is corrupt
+
+	check := &shardCheck{manifest: manifest, members: make(map[string]*member)}
+	if err := check.read(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	check.compare()
+	sort.Strings(check.problems)
+	if len(check.problems) != 3 ||
+		!strings.HasPrefix(check.problems[0], "b.jpg") || !strings.Contains(check.problems[0], "corrupt") ||
+		!strings.HasPrefix(check.problems[1], "c.jpg") || !strings.Contains(check.problems[1], "missing") ||
+		!strings.HasPrefix(check.problems[2], "x.jpg") || !strings.Contains(check.problems[2], "not in the manifest") {
+		t.Fatalf("Unexpected problems %q", check.problems)
+	}
+	if a := check.members["a.jpg"]; a == nil || a.offset != manifest.Objects[0].Offset {
+		t.Errorf("Unexpected member a.jpg %+v", a)
+	}
+
+	dir, err := ioutil.TempDir("", "validate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err = ioutil.WriteFile(filepath.Join(dir, "c.jpg"), []byte(members["c.jpg"]), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(dir, "b.jpg"), []byte(members["b.jpg"]), 0644); err != nil {
+		t.Fatal(err)
+	}
+	file, err := openSource(dir, manifest.Objects[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+	if _, err = openSource(dir, manifest.Objects[1]); err == nil {
+		t.Error("Expected a source that does not match the manifest to fail")
+	}
+}
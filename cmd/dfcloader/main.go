@@ -13,10 +13,17 @@
 //    dfcloader -bucket=liding-dfc -duration 10s -numworkers=3 -minsize=1024 -maxsize=1048 -pctput=100 -local=true
 // 3. Put limit based cloud bucket mixed put(30%) and get(70%):
 //    dfcloader -bucket=liding-dfc -duration 0s -numworkers=3 -minsize=1024 -maxsize=1048 -pctput=30 -local=false -totalputsize=10240
+// 4. Time based local bucket mixed put(20%) and get(80%) of 4KB(90%) and 16MB(10%) objects:
+//    dfcloader -bucket=liding-dfc -duration 1m -numworkers=16 -pctput=20 -sizedist=4:90,16384:10
+//
+// Puts and gets are run by the workload engine (pkg/client/workload): a worker
+// never gets an object that another worker is putting, and once -numkeys new
+// objects are created, puts overwrite them.
 
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -24,6 +31,7 @@ import (
 	"math/rand"
 	"os"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -32,6 +40,7 @@ import (
 	"github.com/NVIDIA/dfcpub/dfc/statsd"
 	"github.com/NVIDIA/dfcpub/pkg/client"
 	"github.com/NVIDIA/dfcpub/pkg/client/readers"
+	"github.com/NVIDIA/dfcpub/pkg/client/workload"
 )
 
 const (
@@ -45,9 +54,6 @@ const (
 type (
 	workOrder struct {
 		op        int
-		proxyURL  string
-		bucket    string
-		isLocal   bool
 		objName   string // In the format of 'virtual dir' + "/" + objname
 		size      int64
 		err       error
@@ -65,7 +71,10 @@ type (
 		putSizeUpperBound int64         // Stops after written at least this much data
 		minSize           int
 		maxSize           int
+		sizeDist          *sizeDist // distribution of sizes of new objects
+		percentiles       []float64 // latency percentiles to report at the end of run
 		numWorkers        int
+		numKeys           int  // number of new objects to create
 		verifyHash        bool // verify xxHash during get
 		cleanUp           bool
 		statsShowInterval int
@@ -88,17 +97,17 @@ type (
 )
 
 var (
-	runParams            params
-	nonDeterministicRand = rand.New(rand.NewSource(time.Now().UnixNano()))
-	workOrders           chan *workOrder
-	workOrderResults     chan *workOrder
-	intervalStats        sts
-	accumulatedStats     sts
-	allObjects           []string // All objects created under virtual directory myName
-	statsPrintHeader     = "%-10s%-6s%-22s\t%-22s\t%-36s\t%-22s\t%-10s\n"
-	statsdC              statsd.Client
-	getPending           int64
-	putPending           int64
+	runParams        params
+	engine           *workload.Engine
+	workOrderResults chan *workOrder
+	intervalStats    sts
+	accumulatedStats sts
+	allObjects       []string        // All objects created under virtual directory myName
+	knownObjects     map[string]bool // allObjects as a set
+	statsPrintHeader = "%-10s%-6s%-22s\t%-22s\t%-36s\t%-22s\t%-10s\n"
+	statsdC          statsd.Client
+	getPending       int64
+	putPending       int64
 )
 
 func parseCmdLine() (params, error) {
@@ -113,6 +122,7 @@ func parseCmdLine() (params, error) {
 	flag.DurationVar(&p.duration, "duration", time.Minute, "How long to run the test; 0 = Unbounded."+
 		"If duration is 0 and totalputsize is also 0, it is a no op.")
 	flag.IntVar(&p.numWorkers, "numworkers", 10, "Number of go routines sending requests in parallel")
+	flag.IntVar(&p.numKeys, "numkeys", 100000, "Number of new objects to create; once all are created, puts overwrite them")
 	flag.IntVar(&p.putPct, "pctput", 0, "Percentage of put requests")
 	flag.StringVar(&p.tmpDir, "tmpdir", "/tmp/dfc", "Local temporary directory used to store temporary files")
 	flag.Int64Var(&p.putSizeUpperBound, "totalputsize", 0, "Stops after total put size exceeds this (in KB); 0 = no limit")
@@ -127,6 +137,10 @@ func parseCmdLine() (params, error) {
 	flag.IntVar(&p.statsdPort, "statsdport", 8125, "UDP port number for local statsd server")
 	flag.IntVar(&p.batchSize, "batchsize", 100, "List and delete batch size")
 	flag.BoolVar(&p.getConfig, "getconfig", false, "True if send get proxy config requests only")
+	sizeDistStr := flag.String("sizedist", sizeDistUniform,
+		fmt.Sprintf("Object size distribution: %s | %s | %s within [minsize, maxsize], "+
+			"or a mix of sizes in KB with weights, e.g. 4:70,1024:30", sizeDistUniform, sizeDistNormal, sizeDistExp))
+	pctls := flag.String("percentiles", "50,90,99,99.9", "Comma separated latency percentiles to report")
 
 	flag.Parse()
 	p.usingSG = p.readerType == readers.ReaderTypeSG
@@ -141,10 +155,30 @@ func parseCmdLine() (params, error) {
 		return params{}, fmt.Errorf("Invalid option: put percent %d", p.putPct)
 	}
 
+	if p.numWorkers <= 0 {
+		return params{}, fmt.Errorf("Invalid option: number of workers %d", p.numWorkers)
+	}
+
+	if p.numKeys < 0 {
+		return params{}, fmt.Errorf("Invalid option: number of keys %d", p.numKeys)
+	}
+
 	if p.statsShowInterval < 0 {
 		return params{}, fmt.Errorf("Invalid option: stats show interval %d", p.statsShowInterval)
 	}
 
+	var err error
+	if p.sizeDist, err = parseSizeDist(*sizeDistStr, p.minSize, p.maxSize); err != nil {
+		return params{}, err
+	}
+	for _, s := range strings.Split(*pctls, ",") {
+		pct, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil || pct <= 0 || pct > 100 {
+			return params{}, fmt.Errorf("Invalid option: latency percentile %q", s)
+		}
+		p.percentiles = append(p.percentiles, pct)
+	}
+
 	p.proxyURL = "http://" + *ip + ":" + strconv.Itoa(*port)
 	p.putSizeUpperBound *= 1024
 	return p, nil
@@ -193,7 +227,7 @@ func main() {
 	}
 
 	if runParams.usingFile {
-		err = dfc.CreateDir(runParams.tmpDir + "/" + myName)
+		err = dfc.CreateDir(runParams.tmpDir)
 		if err != nil {
 			fmt.Println("Failed to create local test directory", runParams.tmpDir, "err = ", err)
 			return
@@ -231,6 +265,37 @@ func main() {
 		fmt.Printf("Found %d existing objects\n", len(allObjects))
 	}
 
+	workOrderResults = make(chan *workOrder, runParams.numWorkers)
+	if !runParams.getConfig {
+		numKeys := runParams.numKeys
+		if runParams.putPct == 0 {
+			numKeys = 0
+		}
+		engine, err = workload.New(workload.Scenario{
+			ProxyURL: runParams.proxyURL,
+			Bucket:   runParams.bucket,
+			Prefix:   myName + "/",
+			NumKeys:  numKeys,
+			Existing: allObjects,
+			Ratio:    map[workload.Op]int{workload.OpPut: runParams.putPct, workload.OpGet: 100 - runParams.putPct},
+			Workers:  runParams.numWorkers,
+			Sizes: func(rnd *rand.Rand) int64 {
+				return int64(runParams.sizeDist.next(rnd)) * 1024
+			},
+			Reader:   runParams.readerType,
+			TmpDir:   runParams.tmpDir,
+			Validate: runParams.verifyHash,
+			Seed:     time.Now().UnixNano(),
+			OnOp: func(res *workload.Result) {
+				workOrderResults <- resultWorkOrder(res)
+			},
+		})
+		if err != nil {
+			fmt.Println("Failed to create workload, err = ", err)
+			return
+		}
+	}
+
 	logRunParams(runParams, os.Stdout)
 
 	host, err := os.Hostname()
@@ -246,13 +311,6 @@ func main() {
 	}
 	defer statsdC.Close()
 
-	workOrders = make(chan *workOrder, runParams.numWorkers)
-	workOrderResults = make(chan *workOrder, runParams.numWorkers)
-	for i := 0; i < runParams.numWorkers; i++ {
-		wg.Add(1)
-		go worker(workOrders, workOrderResults, &wg)
-	}
-
 	var statsTicker *time.Ticker
 	timer := time.NewTimer(runParams.duration)
 
@@ -270,17 +328,23 @@ func main() {
 	writeStatsHeader(statsWriter)
 
 	// Get the workers started
-	for i := 0; i < runParams.numWorkers; i++ {
-		if runParams.getConfig {
-			workOrders <- newGetConfigWorkOrder()
-		} else {
-			if runParams.putPct == 0 {
-				workOrders <- newGetWorkOrder()
-			} else {
-				workOrders <- newPutWorkOrder()
-			}
+	ctx, cancel := context.WithCancel(context.Background())
+	if runParams.getConfig {
+		for i := 0; i < runParams.numWorkers; i++ {
+			wg.Add(1)
+			go getConfigWorker(ctx, workOrderResults, &wg)
 		}
+	} else {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			engine.Run(ctx)
+		}()
 	}
+	go func() {
+		wg.Wait()
+		close(workOrderResults)
+	}()
 
 L:
 	for {
@@ -294,23 +358,18 @@ L:
 			break L
 		case wo := <-workOrderResults:
 			completeWorkOrder(wo)
-			newWorkOrder()
 		case <-statsTicker.C:
 			accumulatedStats.aggregate(intervalStats)
 			writeStats(statsWriter, false /* final */, intervalStats, accumulatedStats)
 			intervalStats = newStats(time.Now())
-		default:
-			// Do nothing
 		}
 	}
 
 	timer.Stop()
 	statsTicker.Stop()
-	close(workOrders)
-	wg.Wait() // wait until all workers are done (notified by closing work order channel)
+	cancel() // workers finish their current requests and stop
 
 	// Process left over work orders
-	close(workOrderResults)
 	for wo := range workOrderResults {
 		completeWorkOrder(wo)
 	}
@@ -335,7 +394,9 @@ func logRunParams(p params, to *os.File) {
 		PutPct        int    `json:"put %"`
 		MinSize       int    `json:"minimal object size in KB"`
 		MaxSize       int    `json:"maximal object size in KB"`
+		SizeDist      string `json:"object size distribution"`
 		NumWorkers    int    `json:"# workers"`
+		NumKeys       int    `json:"# new objects"`
 		StatsInterval string `json:"stats interval"`
 		Backing       string `json:"backed by"`
 		Cleanup       bool   `json:"cleanup"`
@@ -348,7 +409,9 @@ func logRunParams(p params, to *os.File) {
 		PutPct:        p.putPct,
 		MinSize:       p.minSize,
 		MaxSize:       p.maxSize,
+		SizeDist:      p.sizeDist.String(),
 		NumWorkers:    p.numWorkers,
+		NumKeys:       p.numKeys,
 		StatsInterval: time.Duration(time.Second * time.Duration(runParams.statsShowInterval)).String(),
 		Backing:       p.readerType,
 		Cleanup:       p.cleanUp,
@@ -449,6 +512,7 @@ func writeStats(to *os.File, final bool, s, t sts) {
 			pl(t.getConfig.MinLatency(), t.getConfig.AvgLatency(), t.getConfig.MaxLatency()),
 			pb(t.getConfig.Throughput(t.getConfig.Start(), time.Now())),
 			pn(t.getConfig.TotalErrs()))
+		writePercentiles(to, t)
 	} else {
 		// show interval stats; some fields are shown of both interval and total, for example, gets, puts, etc
 		if s.put.Total() != 0 {
@@ -478,64 +542,31 @@ func writeStats(to *os.File, final bool, s, t sts) {
 	}
 }
 
-func newPutWorkOrder() *workOrder {
-	var size int
-
-	if runParams.maxSize == runParams.minSize {
-		size = runParams.minSize
-	} else {
-		size = nonDeterministicRand.Intn(runParams.maxSize-runParams.minSize) + runParams.minSize
-	}
-
-	putPending++
-	return &workOrder{
-		proxyURL: runParams.proxyURL,
-		bucket:   runParams.bucket,
-		isLocal:  runParams.isLocal,
-		op:       opPut,
-		objName:  myName + "/" + client.FastRandomFilename(nonDeterministicRand, 32),
-		size:     int64(size * 1024),
-	}
-}
-
-func newGetWorkOrder() *workOrder {
-	n := len(allObjects)
-	if n == 0 {
-		return nil
-	}
-
-	getPending++
-	return &workOrder{
-		proxyURL: runParams.proxyURL,
-		bucket:   runParams.bucket,
-		isLocal:  runParams.isLocal,
-		op:       opGet,
-		objName:  allObjects[nonDeterministicRand.Intn(n)],
+// writePercentiles writes latency percentiles of all operations to the writer
+func writePercentiles(to *os.File, t sts) {
+	fmt.Fprintf(to, "\n%-10s%-6s", "Latency", "OP")
+	for _, pct := range runParams.percentiles {
+		fmt.Fprintf(to, "%-11s", "p"+strconv.FormatFloat(pct, 'f', -1, 64))
 	}
-}
+	fmt.Fprintln(to)
 
-func newGetConfigWorkOrder() *workOrder {
-	return &workOrder{
-		proxyURL: runParams.proxyURL,
-		op:       opConfig,
+	ops := []struct {
+		name string
+		req  *stats.HTTPReq
+	}{
+		{"Put", &t.put},
+		{"Get", &t.get},
+		{"CFG", &t.getConfig},
 	}
-}
-
-func newWorkOrder() {
-	var wo *workOrder
-
-	if runParams.getConfig {
-		wo = newGetConfigWorkOrder()
-	} else {
-		if nonDeterministicRand.Intn(99) < runParams.putPct {
-			wo = newPutWorkOrder()
-		} else {
-			wo = newGetWorkOrder()
+	for _, op := range ops {
+		if op.req.Total() == 0 {
+			continue
 		}
-	}
-
-	if wo != nil {
-		workOrders <- wo
+		fmt.Fprintf(to, "%-10s%-6s", "", op.name)
+		for _, pct := range runParams.percentiles {
+			fmt.Fprintf(to, "%-11s", prettyDuration(op.req.Percentile(pct)))
+		}
+		fmt.Fprintln(to)
 	}
 }
 
@@ -544,7 +575,7 @@ func completeWorkOrder(wo *workOrder) {
 
 	switch wo.op {
 	case opGet:
-		getPending--
+		getPending = engine.Pending(workload.OpGet)
 		statsdC.Send("get",
 			statsd.Metric{
 				Type:  statsd.Gauge,
@@ -638,7 +669,7 @@ func completeWorkOrder(wo *workOrder) {
 			)
 		}
 	case opPut:
-		putPending--
+		putPending = engine.Pending(workload.OpPut)
 		statsdC.Send("put",
 			statsd.Metric{
 				Type:  statsd.Gauge,
@@ -647,7 +678,10 @@ func completeWorkOrder(wo *workOrder) {
 			},
 		)
 		if wo.err == nil {
-			allObjects = append(allObjects, wo.objName)
+			if !knownObjects[wo.objName] {
+				knownObjects[wo.objName] = true
+				allObjects = append(allObjects, wo.objName)
+			}
 			intervalStats.put.Add(wo.size, delta)
 			statsdC.Send("put",
 				statsd.Metric{
@@ -742,15 +776,6 @@ func cleanUp() {
 				fmt.Println("delete err ", err)
 			}
 		}
-
-		if runParams.usingFile {
-			for _, obj := range objs {
-				err := os.Remove(runParams.tmpDir + "/" + obj)
-				if err != nil {
-					fmt.Println("delete local file err ", err)
-				}
-			}
-		}
 	}
 
 	w := runParams.numWorkers
@@ -778,5 +803,9 @@ func cleanUp() {
 func bootStrap() error {
 	var err error
 	allObjects, err = client.ListObjects(runParams.proxyURL, runParams.bucket, myName, 0)
+	knownObjects = make(map[string]bool, len(allObjects))
+	for _, obj := range allObjects {
+		knownObjects[obj] = true
+	}
 	return err
 }
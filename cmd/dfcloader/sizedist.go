@@ -0,0 +1,103 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ */
+
+// object size distributions
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+const (
+	sizeDistUniform = "uniform" // any size between minsize and maxsize is equally likely
+	sizeDistNormal  = "normal"  // sizes concentrate around the middle of [minsize, maxsize]
+	sizeDistExp     = "exp"     // small objects prevail: the mean is 1/4 of [minsize, maxsize]
+)
+
+type (
+	// sizeDist generates object sizes (in KB) within [min, max]
+	sizeDist struct {
+		kind    string
+		min     int
+		max     int
+		mix     []sizeWeight // non-empty for a mix of fixed sizes
+		weights int          // sum of all weights of the mix
+	}
+
+	sizeWeight struct {
+		size   int // in KB
+		weight int
+	}
+)
+
+// Parses the object size distribution: either a distribution name or a mix of
+// fixed sizes in format "size:weight[,size:weight...]", e.g. "4:70,1024:25,65536:5"
+// means 70% of 4KB objects, 25% of 1MB objects and 5% of 64MB objects
+func parseSizeDist(s string, min, max int) (*sizeDist, error) {
+	d := &sizeDist{kind: s, min: min, max: max}
+	switch s {
+	case sizeDistUniform, sizeDistNormal, sizeDistExp:
+		return d, nil
+	}
+
+	for _, item := range strings.Split(s, ",") {
+		pair := strings.SplitN(item, ":", 2)
+		if len(pair) != 2 {
+			return nil, fmt.Errorf("Invalid size distribution %q: expecting %s, %s, %s or size:weight list",
+				s, sizeDistUniform, sizeDistNormal, sizeDistExp)
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(pair[0]))
+		if err != nil || size <= 0 {
+			return nil, fmt.Errorf("Invalid object size %q in size distribution %q", pair[0], s)
+		}
+		weight, err := strconv.Atoi(strings.TrimSpace(pair[1]))
+		if err != nil || weight <= 0 {
+			return nil, fmt.Errorf("Invalid weight %q in size distribution %q", pair[1], s)
+		}
+		d.mix = append(d.mix, sizeWeight{size: size, weight: weight})
+		d.weights += weight
+	}
+	return d, nil
+}
+
+// Returns the next object size in KB
+func (d *sizeDist) next(rnd *rand.Rand) int {
+	if len(d.mix) != 0 {
+		n := rnd.Intn(d.weights)
+		for _, sw := range d.mix {
+			if n < sw.weight {
+				return sw.size
+			}
+			n -= sw.weight
+		}
+	}
+	if d.max == d.min {
+		return d.min
+	}
+
+	span := float64(d.max - d.min)
+	var v float64
+	switch d.kind {
+	case sizeDistNormal:
+		// 99.7% of sizes are within 3 standard deviations, i.e. in [min, max]
+		v = span/2 + rnd.NormFloat64()*span/6
+	case sizeDistExp:
+		v = rnd.ExpFloat64() * span / 4
+	default:
+		return rnd.Intn(d.max-d.min) + d.min
+	}
+	return d.min + int(math.Min(math.Max(v, 0), span))
+}
+
+func (d *sizeDist) String() string {
+	if len(d.mix) != 0 {
+		return d.kind
+	}
+	return fmt.Sprintf("%s [%dKB, %dKB]", d.kind, d.min, d.max)
+}
@@ -0,0 +1,50 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ */
+
+package main
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestSizeDistRange(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for _, kind := range []string{sizeDistUniform, sizeDistNormal, sizeDistExp} {
+		d, err := parseSizeDist(kind, 16, 1024)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 10000; i++ {
+			if size := d.next(rnd); size < 16 || size > 1024 {
+				t.Fatalf("%s: size %d is out of range [16, 1024]", kind, size)
+			}
+		}
+	}
+}
+
+func TestSizeDistMix(t *testing.T) {
+	const num = 100000
+	d, err := parseSizeDist("4:70, 1024:30", 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rnd := rand.New(rand.NewSource(1))
+	counts := make(map[int]int)
+	for i := 0; i < num; i++ {
+		counts[d.next(rnd)]++
+	}
+	if len(counts) != 2 {
+		t.Fatalf("Expected 2 different sizes, got %v", counts)
+	}
+	if pct := counts[4] * 100 / num; pct < 68 || pct > 72 {
+		t.Errorf("Expected 70%% of 4KB objects, got %d%%", pct)
+	}
+
+	for _, invalid := range []string{"", "zipf", "4:70,1024", "0:10", "4:-1", "x:1"} {
+		if _, err := parseSizeDist(invalid, 1, 1); err == nil {
+			t.Errorf("Expected error for size distribution %q", invalid)
+		}
+	}
+}
@@ -6,6 +6,13 @@ import (
 	"time"
 )
 
+// Latency histogram: bucket i counts latencies in [histBase^(i-1), histBase^i)
+// microseconds, so a percentile is reported with (at most) 5% error
+const (
+	histBase    = 1.05
+	histBuckets = 512 // up to histBase^511 microseconds (about 18 hours)
+)
+
 // HTTPReq is used for keeping track of http requests stats including number of ops, latency, throughput, etc.
 // Assume single threaded access, it doesn't provide any locking on updates.
 type HTTPReq struct {
@@ -18,6 +25,7 @@ type HTTPReq struct {
 	// self maintained fields
 	minLatency time.Duration
 	maxLatency time.Duration
+	hist       [histBuckets]int64 // latency histogram to compute percentiles
 }
 
 func minDuration(a, b time.Duration) time.Duration {
@@ -51,6 +59,19 @@ func (s *HTTPReq) Add(size int64, delta time.Duration) {
 	s.latency += delta
 	s.minLatency = minDuration(s.minLatency, delta)
 	s.maxLatency = maxDuration(s.maxLatency, delta)
+	s.hist[histBucket(delta)]++
+}
+
+func histBucket(delta time.Duration) int {
+	us := float64(delta) / float64(time.Microsecond)
+	if us < 1 {
+		return 0
+	}
+	idx := int(math.Log(us)/math.Log(histBase)) + 1
+	if idx >= histBuckets {
+		idx = histBuckets - 1
+	}
+	return idx
 }
 
 // AddErr increases the number of failed count by 1
@@ -92,6 +113,25 @@ func (s *HTTPReq) AvgLatency() int64 {
 	return int64(s.latency) / s.cnt
 }
 
+// Percentile returns the latency in nano second below which the given
+// percentage (0 < pct <= 100) of requests fall.
+func (s *HTTPReq) Percentile(pct float64) int64 {
+	if s.cnt == 0 {
+		return 0
+	}
+	rank := int64(math.Ceil(pct / 100 * float64(s.cnt)))
+	var n int64
+	for i, cnt := range s.hist {
+		n += cnt
+		if n >= rank {
+			// the upper bound of the bucket, within the observed range
+			latency := time.Duration(math.Pow(histBase, float64(i)) * float64(time.Microsecond))
+			return int64(maxDuration(minDuration(latency, s.maxLatency), s.minLatency))
+		}
+	}
+	return int64(s.maxLatency)
+}
+
 // Throughput returns throughput of requests (bytes/per second).
 func (s *HTTPReq) Throughput(start, end time.Time) int64 {
 	if start == end {
@@ -119,4 +159,7 @@ func (s *HTTPReq) Aggregate(other HTTPReq) {
 
 	s.minLatency = minDuration(s.minLatency, other.minLatency)
 	s.maxLatency = maxDuration(s.maxLatency, other.maxLatency)
+	for i, cnt := range other.hist {
+		s.hist[i] += cnt
+	}
 }
@@ -66,3 +66,34 @@ func TestStats(t *testing.T) {
 	verify(t, "Max latency", 100000000, total.MaxLatency())
 	verify(t, "Throughput", 5, total.Throughput(start, start.Add(70*time.Second)))
 }
+
+func TestPercentile(t *testing.T) {
+	s := stats.NewHTTPReq(time.Now())
+	verify(t, "Empty", 0, s.Percentile(50))
+
+	// 1ms, 2ms, ... 100ms
+	for i := 1; i <= 100; i++ {
+		s.Add(1, time.Duration(i)*time.Millisecond)
+	}
+
+	within := func(msg string, exp time.Duration, act int64) {
+		// histogram buckets are 5% wide
+		if float64(act) < float64(exp) || float64(act) > float64(exp)*1.05 {
+			t.Fatalf("Error: %s, expected = %d (+5%%), actual = %d", msg, exp, act)
+		}
+	}
+	within("p50", 50*time.Millisecond, s.Percentile(50))
+	within("p90", 90*time.Millisecond, s.Percentile(90))
+	within("p99", 99*time.Millisecond, s.Percentile(99))
+	verify(t, "p100", int64(100*time.Millisecond), s.Percentile(100))
+	within("p1", time.Millisecond, s.Percentile(1))
+
+	// percentiles of aggregated stats
+	other := stats.NewHTTPReq(time.Now())
+	for i := 0; i < 100; i++ {
+		other.Add(1, time.Second)
+	}
+	s.Aggregate(other)
+	within("p50 of aggregated", 100*time.Millisecond, s.Percentile(50))
+	verify(t, "p99 of aggregated", int64(time.Second), s.Percentile(99))
+}
@@ -7,69 +7,38 @@
 package main
 
 import (
+	"context"
 	"sync"
 	"time"
 
-	"github.com/NVIDIA/dfcpub/dfc"
-	"github.com/NVIDIA/dfcpub/pkg/client/readers"
-
 	"github.com/NVIDIA/dfcpub/pkg/client"
+	"github.com/NVIDIA/dfcpub/pkg/client/workload"
 )
 
-func doPut(wo *workOrder) {
-	var sgl *dfc.SGLIO
-	if runParams.usingSG {
-		sgl = dfc.NewSGLIO(uint64(wo.size))
-		defer sgl.Free()
+// resultWorkOrder converts the result of a put or get performed by the workload
+// engine into a completed work order
+func resultWorkOrder(res *workload.Result) *workOrder {
+	wo := &workOrder{
+		op:        opGet,
+		objName:   res.Key,
+		size:      res.Size,
+		err:       res.Err,
+		end:       time.Now(),
+		latencies: res.Latencies,
 	}
-
-	r, err := readers.NewReader(readers.ParamReader{
-		Type: runParams.readerType,
-		SGL:  sgl,
-		Path: runParams.tmpDir,
-		Name: wo.objName,
-		Size: wo.size,
-	})
-
-	if err != nil {
-		wo.err = err
-		return
+	if res.Op == workload.OpPut {
+		wo.op = opPut
 	}
-
-	wo.err = client.Put(wo.proxyURL, r, wo.bucket, wo.objName, true /* silent */)
-}
-
-func doGet(wo *workOrder) {
-	wo.size, wo.latencies, wo.err = client.Get(wo.proxyURL, wo.bucket, wo.objName, nil /* wg */, nil /* errch */, true, /* silent */
-		runParams.verifyHash /* validate */)
+	wo.start = wo.end.Add(-res.Latency)
+	return wo
 }
 
-func doGetConfig(wo *workOrder) {
-	wo.latencies, wo.err = client.GetConfig(wo.proxyURL)
-}
-
-func worker(wos <-chan *workOrder, results chan<- *workOrder, wg *sync.WaitGroup) {
+func getConfigWorker(ctx context.Context, results chan<- *workOrder, wg *sync.WaitGroup) {
 	defer wg.Done()
 
-	for {
-		wo, more := <-wos
-		if !more {
-			return
-		}
-
-		wo.start = time.Now()
-
-		switch wo.op {
-		case opPut:
-			doPut(wo)
-		case opGet:
-			doGet(wo)
-		case opConfig:
-			doGetConfig(wo)
-		default:
-			// Should not come here
-		}
-
+	for ctx.Err() == nil {
+		wo := &workOrder{op: opConfig, start: time.Now()}
+		wo.latencies, wo.err = client.GetConfig(runParams.proxyURL)
 		wo.end = time.Now()
 		results <- wo
 	}
@@ -19,6 +19,7 @@ const (
 	ActShutdown    = "shutdown"
 	ActRebalance   = "rebalance"
 	ActLRU         = "lru"
+	ActResilver    = "resilver"
 	ActSyncLB      = "synclb"
 	ActCreateLB    = "createlb"
 	ActDestroyLB   = "destroylb"
@@ -26,7 +27,9 @@ const (
 	ActSetConfig   = "setconfig"
 	ActSetProps    = "setprops"
 	ActListObjects = "listobjects"
+	ActLocate      = "locate"
 	ActRename      = "rename"
+	ActRestore     = "restore"
 	ActEvict       = "evict"
 	ActDelete      = "delete"
 	ActPrefetch    = "prefetch"
@@ -35,6 +38,30 @@ const (
 	ActUnregTarget = "unregtarget"
 	ActUnregProxy  = "unregproxy"
 	ActNewPrimary  = "newprimary"
+	ActInjectFault = "injectfault"
+	ActClearFaults = "clearfaults"
+	ActBenchmark   = "benchmark"
+	ActSelfTest    = "selftest"
+	ActRotateID    = "rotateid"
+	ActImport      = "import"
+	ActExport      = "export"
+	ActGetBatch    = "getbatch"
+	ActPrefetchJob = "prefetchjob"
+	ActJobPosition = "jobposition"
+	ActJobStop     = "jobstop"
+	ActConvert     = "convert"
+	ActClaimEpoch  = "claimepoch"
+	ActUndestroyLB = "undestroylb"
+	ActPin         = "pin"
+	ActUnpin       = "unpin"
+	ActWarmup      = "warmup"
+	ActPublish     = "publish"
+	ActRollback    = "rollback"
+	ActBackup      = "backup"
+	ActRestoreBak  = "restorebackup"
+	ActBackupStop  = "backupstop"
+	ActHeadObjects = "headobjects"
+	ActResetStats  = "resetstats"
 )
 
 // Cloud Provider enum
@@ -44,6 +71,12 @@ const (
 	ProviderDfc    = "dfc"
 )
 
+// Token access scope enum
+const (
+	AccessRead  = "read"  // GET and HEAD requests, listing objects
+	AccessWrite = "write" // PUT, POST and DELETE requests
+)
+
 // Header Key enum
 const (
 	CloudProvider         = "CloudProvider"         // from Cloud Provider enum
@@ -51,13 +84,51 @@ const (
 	NextTierURL           = "NextTierURL"           // URL of the next tier in a DFC multi-tier environment
 	ReadPolicy            = "ReadPolicy"            // Policy used for reading in a DFC multi-tier environment
 	WritePolicy           = "WritePolicy"           // Policy used for writing in a DFC multi-tier environment
+	Encryption            = "Encryption"            // Encryption of cached objects at rest: "enabled"/"disabled"
+	CloudSSE              = "CloudSSE"              // Cloud server-side encryption: "AES256", "aws:kms" or "none"
+	CloudSSEKeyID         = "CloudSSEKeyID"         // KMS key ID used for cloud server-side encryption
+	StorageClass          = "StorageClass"          // Cloud storage class of an object or of new objects of a bucket
+	RequesterPays         = "RequesterPays"         // Requester pays for cloud bucket access: "enabled"/"disabled"
+	Restore               = "Restore"               // Restore status of an archived object
+	Fsync                 = "Fsync"                 // Fsync policy of the bucket's objects: "never", "file" or "dir"
+	MpathLabel            = "MpathLabel"            // Preferred mountpath label of the bucket's objects
+	IngressLimit          = "IngressLimit"          // PUT bandwidth limit of the bucket, bytes per second per target
+	EgressLimit           = "EgressLimit"           // GET bandwidth limit of the bucket, bytes per second per target
+	EgressBudget          = "EgressBudget"          // monthly cloud egress budget of the bucket, bytes
+	Protected             = "Protected"             // Local bucket cannot be destroyed: "true"
+	DestroyAt             = "DestroyAt"             // Time (RFC 3339) the local bucket is to be destroyed at
+	ServeStale            = "ServeStale"            // Cached objects of the Cloud bucket are served when the Cloud fails: "true"
+	MaxStale              = "MaxStale"              // Max age of the stale cached objects served, e.g. "1h"
+	WORM                  = "WORM"                  // Objects of the local bucket are write-once: "true"
+	Retention             = "Retention"             // Retention of the write-once objects, e.g. "720h"; none - forever
+	ECData                = "ECData"                // Number of erasure coding data slices of the local bucket's objects
+	ECParity              = "ECParity"              // Number of erasure coding parity slices
+	ECMinSize             = "ECMinSize"             // Objects smaller than this are replicated rather than sliced, bytes
+	Copies                = "Copies"                // Number of copies of each object on distinct mountpaths of its target
+	HeaderWarning         = "Warning"               // Stale cached object served, RFC 7234 warn-code 110 or 111
 	HeaderDfcChecksumType = "HeaderDfcChecksumType" // Checksum Type (xxhash, md5, none)
 	HeaderDfcChecksumVal  = "HeaderDfcChecksumVal"  // Checksum Value
 	HeaderDfcObjVersion   = "HeaderDfcObjVersion"   // Object version/generation
+	HeaderDfcCustomerKey  = "HeaderDfcCustomerKey"  // Customer-supplied encryption key: base64-encoded AES-256 key
+	HeaderDfcCustomerHash = "HeaderDfcCustomerHash" // SHA256 of customer-supplied key that protects an object
+	HeaderDfcPlacement    = "HeaderDfcPlacement"    // Placement group of an object
+	HeaderDfcBatchCount   = "HeaderDfcBatchCount"   // Number of batches in the epoch (see BatchMsg)
 	HeaderPrimaryProxyURL = "PrimaryProxyURL"       // URL of Primary Proxy
 	HeaderPrimaryProxyID  = "PrimaryProxyID"        // ID of Primary Proxy
+	HeaderDfcEpoch        = "HeaderDfcEpoch"        // Cluster epoch of the primary proxy (see fencing.go)
+	HeaderRequestID       = "X-Dfc-Request-Id"      // Request ID: set by a client or by DFC in error responses
+	HeaderAPIVersion      = "X-Dfc-Api-Version"     // API version negotiated for the request
+	HeaderAPIVersions     = "X-Dfc-Api-Versions"    // Comma-separated API versions supported by the server
 	Size                  = "Size"                  // Size of object in bytes
 	Version               = "Version"               // Object version number
+	Atime                 = "Atime"                 // Last access time of the cached object
+	Cached                = "Cached"                // Object is cached by its target: "true"/"false"
+	HeaderDfcMetaPrefix   = "X-Dfc-Meta-"           // Prefix of the headers with custom metadata of an object
+	HeaderRange           = "Range"                 // Byte range of the object to GET, RFC 7233: "bytes=first-last"
+	HeaderContentRange    = "Content-Range"         // Byte range of the object returned with 206 Partial Content
+	HeaderAcceptRanges    = "Accept-Ranges"         // "bytes": objects can be read by ranges
+	HeaderIfMatch         = "If-Match"              // DELETE only if the object has one of the versions or checksums
+	HeaderIfUnmodified    = "If-Unmodified-Since"   // DELETE only if the object was not modified after the HTTP date
 )
 
 // URL Query Parameter enum
@@ -78,6 +149,20 @@ const (
 	URLParamLength           = "length"       // Length, the total number of bytes that need to be read from the offset
 	URLParamWhat             = "what"         // "config" | "stats" | "xaction" ...
 	URLParamProps            = "props"        // e.g. "checksum, size" | "atime, size" | "ctime, iscached" | "bucket, size" | xaction type
+	URLParamPlacementGroup   = "pgroup"       // objects of the same placement group are stored by the same target
+	URLParamSmapVersion      = "smap_version" // Smap version of a client that sends requests directly to targets
+	URLParamName             = "name"         // what=samples: name of the sample (tar member)
+	URLParamCount            = "count"        // what=samples: number of random samples
+	URLParamExt              = "ext"          // what=samples: extension of the random samples, e.g. ".jpg"
+	URLParamSeed             = "seed"         // what=samples: seed of the random selection
+	URLParamReload           = "reload"       // what=samples: true - rebuild the index; what=summary: true - bypass the cache
+	URLParamPrefix           = "prefix"       // what=digest|pinned|summary: only the objects which names start with the prefix
+	URLParamDataset          = "dataset"      // what=datasets|datasetdiff: name of the dataset
+	URLParamFromVersion      = "from_version" // what=datasetdiff: version to compare
+	URLParamToVersion        = "to_version"   // what=datasetdiff: version to compare with
+	URLParamBucket           = "bucket"       // what=objects|bucketstats: only the objects (the stats) of the bucket
+	URLParamMarker           = "marker"       // what=objects: the page starts after this object (fqn)
+	URLParamLimit            = "limit"        // what=objects: max number of objects in the page
 )
 
 // TODO: sort and some props are TBD
@@ -85,16 +170,20 @@ const (
 type GetMsg struct {
 	GetSort       string `json:"sort"`        // "ascending, atime" | "descending, name"
 	GetProps      string `json:"props"`       // e.g. "checksum, size" | "atime, size" | "ctime, iscached" | "bucket, size"
-	GetTimeFormat string `json:"time_format"` // "RFC822" default - see the enum below
+	GetTimeFormat string `json:"time_format"` // "RFC3339Nano" default - see the enum below
 	GetPrefix     string `json:"prefix"`      // object name filter: return only objects which name starts with prefix
 	GetPageMarker string `json:"pagemarker"`  // AWS/GCP: marker
 	GetPageSize   int    `json:"pagesize"`    // maximum number of entries returned by list bucket call
+	GetDelimiter  string `json:"delimiter"`   // e.g. "/": group names that contain delimiter after prefix into common prefixes
+	GetStartAfter string `json:"startafter"`  // AWS: list the objects which names follow this one (the first page only)
 }
 
 // RangeListMsgBase contains fields common to Range and List operations
 type RangeListMsgBase struct {
 	Deadline time.Duration `json:"deadline,omitempty"`
 	Wait     bool          `json:"wait,omitempty"`
+	Plan     bool          `json:"plan,omitempty"`    // prefetch: return the estimated cost instead of prefetching
+	Confirm  bool          `json:"confirm,omitempty"` // prefetch: proceed regardless of the estimated cost
 }
 
 // ListMsg contains a list of files and a duration within which to get them
@@ -111,6 +200,521 @@ type RangeMsg struct {
 	Range  string `json:"range"`
 }
 
+// RestoreMsg contains parameters to restore an archived (e.g., S3 GLACIER) object
+type RestoreMsg struct {
+	Days int64  `json:"days"`           // number of days to keep the restored copy
+	Tier string `json:"tier,omitempty"` // retrieval tier: "Standard" (default), "Bulk" or "Expedited"
+}
+
+// BenchmarkMsg contains parameters of the target's disk and network benchmark;
+// zero values select the defaults
+type BenchmarkMsg struct {
+	FileSize int64 `json:"file_size,omitempty"` // bytes written and read per mountpath
+	NetSize  int64 `json:"net_size,omitempty"`  // bytes sent to each of the other targets
+}
+
+// BenchmarkResult is the outcome of the target's benchmark
+type BenchmarkResult struct {
+	DaemonID   string                     `json:"daemon_id"`
+	Time       time.Time                  `json:"time"`
+	Mountpaths map[string]*MpathBenchmark `json:"mountpaths"`
+	Targets    map[string]float64         `json:"targets"` // target ID => MB/s sent
+	Errors     []string                   `json:"errors,omitempty"`
+}
+
+// MpathBenchmark is the throughput (MB/s) and IOPS (4KiB) of a mountpath
+type MpathBenchmark struct {
+	SeqWriteMBps  float64 `json:"seq_write_mbps"`
+	SeqReadMBps   float64 `json:"seq_read_mbps"`
+	RandWriteIOPS float64 `json:"rand_write_iops"`
+	RandReadIOPS  float64 `json:"rand_read_iops"`
+}
+
+// ImportMsg contains parameters of the bulk import of a directory tree into a local bucket
+type ImportMsg struct {
+	Dir     string `json:"dir,omitempty"`     // absolute path at the targets; empty - the targets' staging areas
+	Shared  bool   `json:"shared,omitempty"`  // Dir is shared by the targets (e.g., NFS): each imports the objects it owns
+	Prefix  string `json:"prefix,omitempty"`  // prepended to the relative paths of the files to name the objects
+	Workers int    `json:"workers,omitempty"` // files checksummed and stored in parallel, default 8
+}
+
+// ImportResult is the outcome of the target's import
+type ImportResult struct {
+	DaemonID string          `json:"daemon_id"`
+	Bucket   string          `json:"bucket"`
+	Dir      string          `json:"dir,omitempty"`
+	Started  time.Time       `json:"started"`
+	Finished time.Time       `json:"finished"` // zero while in progress
+	Imported int64           `json:"imported"`
+	Failed   int64           `json:"failed"`
+	Bytes    int64           `json:"bytes"`
+	Files    []*ImportedFile `json:"files"`
+}
+
+// ImportedFile is the result of importing one file
+type ImportedFile struct {
+	Path   string `json:"path"`
+	Name   string `json:"name"` // object name
+	Size   int64  `json:"size"`
+	Cksum  string `json:"cksum,omitempty"`  // xxhash, unless checksumming is disabled
+	Target string `json:"target,omitempty"` // ID of the target that stores the object
+	Error  string `json:"error,omitempty"`
+}
+
+// ExportMsg contains parameters of the export of a bucket to tar shards: the
+// shards are written either to Dir or to the local bucket Bucket
+type ExportMsg struct {
+	Prefix      string `json:"prefix,omitempty"`       // export the objects with the prefix only
+	ShardSize   int64  `json:"shard_size,omitempty"`   // bytes of objects per shard, default 1GiB
+	ShardPrefix string `json:"shard_prefix,omitempty"` // shard name prefix, default "<bucket>-"
+	Dir         string `json:"dir,omitempty"`          // absolute path at the targets
+	Bucket      string `json:"bucket,omitempty"`       // local bucket
+}
+
+// ExportResult is the outcome of the target's export
+type ExportResult struct {
+	DaemonID string    `json:"daemon_id"`
+	Bucket   string    `json:"bucket"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"` // zero while in progress
+	Shards   []string  `json:"shards"`   // names of the shards written so far
+	Objects  int64     `json:"objects"`
+	Bytes    int64     `json:"bytes"`
+	Errors   []string  `json:"errors,omitempty"`
+}
+
+// Shard formats
+const (
+	FormatTar      = "tar"      // <name>.tar
+	FormatTFRecord = "tfrecord" // <name>.tfrecord
+	FormatRecordIO = "recordio" // <name>.rec
+)
+
+// ConvertMsg contains parameters of the conversion of the shards of a bucket
+// into another format
+type ConvertMsg struct {
+	Format string `json:"format"`           // FormatTar, FormatTFRecord or FormatRecordIO
+	Bucket string `json:"bucket"`           // local bucket for the converted shards
+	Prefix string `json:"prefix,omitempty"` // convert the shards with the prefix only
+}
+
+// ConvertResult is the outcome of the target's conversion
+type ConvertResult struct {
+	DaemonID string    `json:"daemon_id"`
+	Bucket   string    `json:"bucket"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"` // zero while in progress
+	Shards   []string  `json:"shards"`   // names of the converted shards written so far
+	Samples  int64     `json:"samples"`
+	Errors   []string  `json:"errors,omitempty"`
+}
+
+// BackupMsg contains parameters of the backup of a local bucket to a Cloud
+// bucket and of the restore in the other direction: local object <name> is
+// backed up as Cloud object <Prefix><name>
+type BackupMsg struct {
+	Bucket      string `json:"bucket"`                // Cloud bucket
+	Prefix      string `json:"prefix,omitempty"`      // Cloud object name prefix, default "<local-bucket>/"
+	Incremental bool   `json:"incremental,omitempty"` // copy only the objects whose checksums differ
+}
+
+// BackupResult is the outcome (or the progress) of the target's backup or restore
+type BackupResult struct {
+	DaemonID    string    `json:"daemon_id"`
+	Action      string    `json:"action"` // ActBackup or ActRestoreBak
+	Bucket      string    `json:"bucket"` // local bucket
+	CloudBucket string    `json:"cloud_bucket"`
+	Prefix      string    `json:"prefix"`
+	Incremental bool      `json:"incremental"`
+	Started     time.Time `json:"started"`
+	Finished    time.Time `json:"finished"` // zero while in progress
+	Objects     int64     `json:"objects"`  // to copy or to skip; restore counts them as it lists the Cloud bucket
+	Copied      int64     `json:"copied"`
+	Skipped     int64     `json:"skipped"` // unchanged
+	Bytes       int64     `json:"bytes"`   // copied
+	Aborted     bool      `json:"aborted"`
+	Errors      []string  `json:"errors,omitempty"`
+}
+
+// BackupManifest records the objects of the local bucket a target has backed
+// up; stored as Cloud object <prefix>.dfc-backup/<target-ID>.json
+type BackupManifest struct {
+	DaemonID    string                   `json:"daemon_id"`
+	Bucket      string                   `json:"bucket"`
+	CloudBucket string                   `json:"cloud_bucket"`
+	Prefix      string                   `json:"prefix"`
+	Time        time.Time                `json:"time"`
+	Objects     map[string]*BackupObject `json:"objects"` // local object name => its backup
+}
+
+// BackupObject is the backup of a local object
+type BackupObject struct {
+	Name     string    `json:"name"` // Cloud object name
+	Size     int64     `json:"size"`
+	Checksum string    `json:"checksum"`          // xxhash
+	Version  string    `json:"version,omitempty"` // Cloud object version, if versioned
+	Time     time.Time `json:"time"`              // when copied
+}
+
+// ConnPoolStats contains the connection counters of the daemon's
+// intra-cluster HTTP clients
+type ConnPoolStats struct {
+	PerPeer bool                      `json:"per_peer"`
+	Peers   map[string]*PeerConnStats `json:"peers"` // daemon ID or "*" (shared clients) => counters
+}
+
+// PeerConnStats contains the connection counters of the client(s)
+type PeerConnStats struct {
+	Dialed int64 `json:"dialed"`
+	Reused int64 `json:"reused"`
+	Open   int64 `json:"open"`
+}
+
+// GossipMsg carries the heartbeat counters a target knows of, including its own
+type GossipMsg struct {
+	From       string           `json:"from"`
+	Heartbeats map[string]int64 `json:"heartbeats"` // target ID => counter
+}
+
+// GossipReport lists the targets whose heartbeats the reporting target
+// has not seen advance for the suspect time
+type GossipReport struct {
+	From     string   `json:"from"`
+	Suspects []string `json:"suspects"`
+}
+
+// ZeroCopyRequest asks the target for a descriptor of the cached object; it
+// is sent over the target's zero-copy socket (see zerocopy.go)
+type ZeroCopyRequest struct {
+	Bucket  string `json:"bucket"`
+	Objname string `json:"objname"`
+	Offset  int64  `json:"offset,omitempty"`
+	Length  int64  `json:"length,omitempty"` // 0 - to the end of the object
+}
+
+// ZeroCopyResponse describes the extent of the file whose descriptor comes
+// along with the response
+type ZeroCopyResponse struct {
+	Size   int64  `json:"size"` // object size
+	Offset int64  `json:"offset"`
+	Length int64  `json:"length"`
+	Error  string `json:"error,omitempty"` // no descriptor if not empty
+}
+
+// ExportManifest describes the objects of an exported tar shard; it is
+// stored next to the shard as <shard-name>.json
+type ExportManifest struct {
+	Shard   string            `json:"shard"`
+	Bucket  string            `json:"bucket"`
+	Objects []*ExportedObject `json:"objects"` // in the order of the tar records
+}
+
+// ExportedObject is the metadata of an object in an exported tar shard
+type ExportedObject struct {
+	Name       string    `json:"name"`
+	Offset     int64     `json:"offset"` // of the object's data in the shard
+	Size       int64     `json:"size"`
+	Checksum   string    `json:"checksum,omitempty"` // xxhash, if computed
+	Version    string    `json:"version,omitempty"`
+	Placement  string    `json:"pgroup,omitempty"` // placement group
+	ModifiedAt time.Time `json:"mtime"`
+}
+
+// SampleLocation is the location of a sample (tar member) in the exported shards
+type SampleLocation struct {
+	Name     string `json:"name"`
+	Shard    string `json:"shard"`  // object name of the shard
+	Offset   int64  `json:"offset"` // of the sample's data in the shard
+	Size     int64  `json:"size"`
+	Checksum string `json:"checksum,omitempty"`
+}
+
+// SampleIndexInfo describes the sample index of a bucket
+type SampleIndexInfo struct {
+	Bucket  string    `json:"bucket"`
+	Shards  int       `json:"shards"`
+	Samples int       `json:"samples"`
+	Loaded  time.Time `json:"loaded"`
+}
+
+// DigestEntry is the checksum of an object
+type DigestEntry struct {
+	Name     string `json:"name"`
+	Checksum string `json:"checksum"` // xxhash
+}
+
+// DigestPage is the digest of consecutive objects of the bucket digest
+type DigestPage struct {
+	First   string `json:"first"` // name of the first object
+	Last    string `json:"last"`
+	Objects int    `json:"objects"`
+	Digest  string `json:"digest"`
+}
+
+// TargetDigest is the digest of the objects of a bucket stored by a target
+type TargetDigest struct {
+	Objects int            `json:"objects"`
+	Digest  string         `json:"digest"`
+	Errors  []string       `json:"errors,omitempty"`  // objects that could not be checksummed
+	Entries []*DigestEntry `json:"entries,omitempty"` // sorted by name; returned by the targets only
+}
+
+// BucketDigest is the digest of a bucket: of all its objects sorted by name
+type BucketDigest struct {
+	Bucket  string                   `json:"bucket"`
+	Prefix  string                   `json:"prefix,omitempty"`
+	Objects int                      `json:"objects"`
+	Digest  string                   `json:"digest"`
+	Pages   []*DigestPage            `json:"pages"`
+	Targets map[string]*TargetDigest `json:"targets"`
+	Errors  []string                 `json:"errors,omitempty"`
+}
+
+// TargetSummary is the size of the objects of a bucket stored by a target
+type TargetSummary struct {
+	Objects  int64 `json:"objects"`
+	Size     int64 `json:"size"`      // logical bytes
+	DiskSize int64 `json:"disk_size"` // bytes stored, including e.g. encryption overhead
+}
+
+// BucketSummary is the number and the size of the objects of a bucket (see summary.go)
+type BucketSummary struct {
+	Bucket        string                    `json:"bucket"`
+	Prefix        string                    `json:"prefix,omitempty"`
+	Objects       int64                     `json:"objects"`        // Cloud buckets: in the Cloud, unless cachedonly
+	Size          int64                     `json:"size"`           // logical bytes
+	CachedObjects int64                     `json:"cached_objects"` // objects stored by the targets
+	CachedSize    int64                     `json:"cached_size"`    // bytes stored by the targets
+	Time          time.Time                 `json:"time"`           // when computed: the summary may be cached
+	Targets       map[string]*TargetSummary `json:"targets"`
+}
+
+// RawObject is an object as stored by a target (see objwalk.go)
+type RawObject struct {
+	FQN      string `json:"fqn"`
+	Bucket   string `json:"bucket"`
+	Name     string `json:"name"`
+	IsLocal  bool   `json:"islocal"`
+	Size     int64  `json:"size"`
+	Checksum string `json:"checksum,omitempty"` // stored xxhash, if any
+}
+
+// ObjectWalkPage is a page of the objects stored by a target
+type ObjectWalkPage struct {
+	Objects []*RawObject `json:"objects"`
+	Marker  string       `json:"marker,omitempty"` // the next page starts after it; empty - the last page
+}
+
+// ObjectMeta contains the properties of an object set by the user (see objmeta.go)
+type ObjectMeta struct {
+	Pinned   bool              `json:"pinned,omitempty"`   // never evicted by LRU
+	Expires  string            `json:"expires,omitempty"`  // RFC 3339 time the TTL of the object expires at
+	Tags     map[string]string `json:"tags,omitempty"`     // custom tags
+	Replicas int               `json:"replicas,omitempty"` // desired number of copies of the object
+}
+
+// ObjectMetaPatch changes the properties of an object; nil - unchanged
+type ObjectMetaPatch struct {
+	Pinned   *bool             `json:"pinned,omitempty"`
+	TTL      *string           `json:"ttl,omitempty"`  // from now, e.g. "24h"; "" - no TTL
+	Tags     map[string]string `json:"tags,omitempty"` // added to the tags; an empty value removes the tag
+	Replicas *int              `json:"replicas,omitempty"`
+}
+
+// PinMsg pins or unpins the objects of a bucket with the prefix (see pin.go)
+type PinMsg struct {
+	Prefix string `json:"prefix"`
+}
+
+// TargetPins describes the pinned objects of a bucket stored by a target
+type TargetPins struct {
+	Objects    []string `json:"objects,omitempty"`     // objects pinned one at a time, sorted
+	Size       int64    `json:"size"`                  // total size of the pinned objects of the bucket
+	Used       int64    `json:"used"`                  // total size of the pinned objects of all buckets
+	Capacity   int64    `json:"capacity"`              // pin.capacity; 0 - unlimited
+	PrefixSize int64    `json:"prefix_size,omitempty"` // size of the objects with the requested prefix not pinned yet
+}
+
+// PinnedList lists the pinned prefixes and objects of a bucket
+type PinnedList struct {
+	Bucket   string                 `json:"bucket"`
+	Prefixes []string               `json:"prefixes,omitempty"`
+	Objects  []string               `json:"objects,omitempty"`
+	Size     int64                  `json:"size"`
+	Targets  map[string]*TargetPins `json:"targets"`
+}
+
+// WarmupMsg is the warm-up manifest of a Cloud bucket: the objects its targets
+// prefetch upon startup and rebalance (see warmup.go). No objects - no manifest
+type WarmupMsg struct {
+	Objnames []string `json:"objnames"`
+}
+
+// PublishMsg publishes a version of a dataset of a local bucket: the objects
+// of the manifest, uploaded under <dataset>/<version>/ (see publish.go).
+// Rollback makes the given version, one of the kept ones, current again
+type PublishMsg struct {
+	Dataset  string   `json:"dataset"`
+	Version  string   `json:"version"`
+	Objnames []string `json:"objnames,omitempty"` // relative to <dataset>/<version>/
+}
+
+// DatasetInfo describes a published dataset
+type DatasetInfo struct {
+	Name     string   `json:"name"`
+	Current  string   `json:"current"`  // the version <dataset>/latest/ refers to
+	Versions []string `json:"versions"` // the versions kept, oldest first
+}
+
+// DatasetDiff lists the objects added, removed and changed between two
+// versions of a dataset
+type DatasetDiff struct {
+	Dataset string   `json:"dataset"`
+	From    string   `json:"from"`
+	To      string   `json:"to"`
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+	Changed []string `json:"changed"` // different checksums or sizes
+}
+
+// BatchMsg requests a batch of samples of a dataset of exported shards. The
+// dataset is shuffled with the seed and the epoch and divided into batches of
+// the batch size; the samples of the batch are returned as a tar archive
+type BatchMsg struct {
+	Shards    []BatchShard `json:"shards"` // the dataset
+	Seed      int64        `json:"seed"`   // same seed and epoch - same order
+	Epoch     int64        `json:"epoch"`
+	BatchSize int          `json:"batch_size"`
+	Batch     int          `json:"batch"` // number of the batch in the epoch, starting from 0
+}
+
+// BatchShard is a shard of the dataset and the indices of its samples in the
+// shard's manifest; no indices - all samples of the shard
+type BatchShard struct {
+	Name    string `json:"name"`
+	Members []int  `json:"members,omitempty"`
+}
+
+// PrefetchJobMsg starts a prefetch job: the shards of a Cloud bucket are
+// prefetched in the order a training job reads them, a few shards ahead of
+// the job's position (see JobPositionMsg)
+type PrefetchJobMsg struct {
+	Shards    []string `json:"shards,omitempty"` // access order; empty - the objects with the prefix
+	Prefix    string   `json:"prefix,omitempty"`
+	Shuffle   bool     `json:"shuffle,omitempty"` // shuffle the shards with the seed, anew every epoch
+	Seed      int64    `json:"seed,omitempty"`
+	Epochs    int      `json:"epochs,omitempty"`    // 0 - until stopped
+	Lookahead int      `json:"lookahead,omitempty"` // shards prefetched ahead of the position, default 4
+	Evict     bool     `json:"evict,omitempty"`     // evict the consumed shards
+	Bandwidth int64    `json:"bandwidth,omitempty"` // bytes per second, 0 - unlimited
+}
+
+// JobPositionMsg reports the position of the consumer of a prefetch job: the
+// number of shards of the epoch it has read. Stopping the job requires the ID only
+type JobPositionMsg struct {
+	ID       string `json:"id"`
+	Epoch    int    `json:"epoch"`
+	Position int    `json:"position"`
+}
+
+// PrefetchJobInfo is the progress of a prefetch job
+type PrefetchJobInfo struct {
+	ID         string    `json:"id"`
+	Bucket     string    `json:"bucket"`
+	Shards     int       `json:"shards"`     // per epoch
+	Epoch      int       `json:"epoch"`      // of the consumer
+	Position   int       `json:"position"`   // of the consumer
+	Prefetched int64     `json:"prefetched"` // shards prefetched, all epochs
+	Bytes      int64     `json:"bytes"`      // prefetched
+	Evicted    int64     `json:"evicted"`    // shards
+	Failed     int64     `json:"failed"`     // shards that failed to prefetch
+	Running    bool      `json:"running"`
+	Started    time.Time `json:"started"`
+	Finished   time.Time `json:"finished,omitempty"`
+	Error      string    `json:"error,omitempty"` // the last one
+}
+
+// SelfTestMsg contains parameters of the cluster self-test
+type SelfTestMsg struct {
+	Size         int64    `json:"size,omitempty"`          // size of the canary objects, default 1MiB
+	CloudBuckets []string `json:"cloud_buckets,omitempty"` // cloud buckets to test cold GET with
+}
+
+// SelfTestReport is the result of the cluster self-test
+type SelfTestReport struct {
+	Passed bool             `json:"passed"`
+	Checks []*SelfTestCheck `json:"checks"`
+}
+
+// SelfTestCheck is the result of one of the self-test checks
+type SelfTestCheck struct {
+	Name      string        `json:"name"` // the SelfTest* enum
+	Target    string        `json:"target,omitempty"`
+	Mountpath string        `json:"mountpath,omitempty"`
+	Bucket    string        `json:"bucket,omitempty"`
+	Provider  string        `json:"provider,omitempty"`
+	Passed    bool          `json:"passed"`
+	Error     string        `json:"error,omitempty"`
+	Duration  time.Duration `json:"duration"`
+}
+
+// SelfTestCheck.Name enum
+const (
+	SelfTestMountpath = "mountpath" // write, read back and remove a file on each mountpath of each target
+	SelfTestObject    = "object"    // PUT, GET and DELETE an object stored on each target
+	SelfTestColdGet   = "coldget"   // PUT, evict, cold GET and DELETE an object of each cloud bucket
+)
+
+// FaultMsg describes a fault to inject into a daemon (debug build only): with
+// probability Prob the daemon delays or drops its HTTP responses, or fails
+// disk writes or cloud calls
+type FaultMsg struct {
+	Kind  string  `json:"kind"`            // the Fault Kind enum below
+	Prob  float64 `json:"prob"`            // (0, 1]
+	Delay string  `json:"delay,omitempty"` // FaultDelay only, e.g. "500ms"
+	Seed  int64   `json:"seed,omitempty"`  // non-zero: the daemon produces the same sequence of faults
+}
+
+// Fault Kind enum
+const (
+	FaultDelay     = "delay"     // delay HTTP responses
+	FaultDrop      = "drop"      // process HTTP requests and drop the responses
+	FaultDiskWrite = "diskwrite" // fail writes of objects to local filesystems
+	FaultCloud     = "cloud"     // fail calls to the cloud provider
+)
+
+// ObjectLocation describes the target that owns an object (the HRW target)
+// and whether the object is cached there
+type ObjectLocation struct {
+	Name      string `json:"name"`      // name of the object
+	TargetID  string `json:"targetid"`  // ID of the owning target
+	TargetURL string `json:"targetURL"` // direct URL of the owning target
+	IsCached  bool   `json:"iscached"`  // true if the target has the object
+}
+
+// LocateResult is the response to "locate" action: the locations of the
+// requested objects in the same order
+type LocateResult struct {
+	Objects []*ObjectLocation `json:"objects"`
+}
+
+// ObjectStatus is the status of an object in the response to "headobjects"
+// action; Error is set if the status could not be determined
+type ObjectStatus struct {
+	Name    string `json:"name"`              // name of the object
+	Exists  bool   `json:"exists"`            // the object exists: cached or, for Cloud buckets, in the Cloud
+	Cached  bool   `json:"cached"`            // the owning target has the object
+	Size    int64  `json:"size,omitempty"`    // size of the object in bytes
+	Version string `json:"version,omitempty"` // version of the object, if any
+	Error   string `json:"error,omitempty"`
+}
+
+// HeadObjectsResult is the response to "headobjects" action: the statuses of
+// the requested objects in the same order
+type HeadObjectsResult struct {
+	Objects []*ObjectStatus `json:"objects"`
+}
+
 // SmapVoteMsg contains the cluster map and a bool representing whether or not a vote is currently happening.
 type SmapVoteMsg struct {
 	VoteInProgress bool      `json:"vote_in_progress"`
@@ -126,12 +730,33 @@ type SmapVoteMsg struct {
 
 // URLParamWhat enum
 const (
-	GetWhatFile     = "file" // { "what": "file" } is implied by default and can be omitted
-	GetWhatConfig   = "config"
-	GetWhatSmap     = "smap"
-	GetWhatStats    = "stats"
-	GetWhatXaction  = "xaction"
-	GetWhatSmapVote = "smapvote"
+	GetWhatFile      = "file" // { "what": "file" } is implied by default and can be omitted
+	GetWhatConfig    = "config"
+	GetWhatSmap      = "smap"
+	GetWhatStats     = "stats"
+	GetWhatXaction   = "xaction"
+	GetWhatSmapVote  = "smapvote"
+	GetWhatBenchmark = "benchmark"
+	GetWhatLoad      = "load"
+	GetWhatDaemonID  = "daemonid"
+	GetWhatEgress    = "egress"
+	GetWhatImport    = "import"
+	GetWhatExport    = "export"
+	GetWhatSamples   = "samples"
+	GetWhatJobs      = "prefetchjobs"
+	GetWhatConvert   = "convert"
+	GetWhatConnPool  = "connpool"
+	GetWhatDigest    = "digest"
+	GetWhatObjMeta   = "objmeta"
+	GetWhatPinned    = "pinned"
+	GetWhatWarmup    = "warmup"
+	GetWhatDatasets  = "datasets"
+	GetWhatDiff      = "datasetdiff"
+	GetWhatSummary   = "summary"
+	GetWhatObjects   = "objects"
+	GetWhatBackup    = "backup"
+	GetWhatBckStats  = "bucketstats"
+	GetWhatPGroup    = "pgroup" // placement group of the stored object (target only)
 )
 
 // GetMsg.GetSort enum
@@ -141,26 +766,31 @@ const (
 )
 
 // GetMsg.GetTimeFormat enum
+// The format can be given either as the layout or as the name of the constant,
+// e.g. "RFC3339Nano"; the default is defined by the config time_format
 const (
-	RFC822     = time.RFC822     // default
-	Stamp      = time.Stamp      // e.g. "Jan _2 15:04:05"
-	StampMilli = time.StampMilli // e.g. "Jan 12 15:04:05.000"
-	RFC822Z    = time.RFC822Z
-	RFC1123    = time.RFC1123
-	RFC1123Z   = time.RFC1123Z
-	RFC3339    = time.RFC3339
+	RFC822      = time.RFC822     // the default of older versions
+	Stamp       = time.Stamp      // e.g. "Jan _2 15:04:05"
+	StampMilli  = time.StampMilli // e.g. "Jan 12 15:04:05.000"
+	RFC822Z     = time.RFC822Z
+	RFC1123     = time.RFC1123
+	RFC1123Z    = time.RFC1123Z
+	RFC3339     = time.RFC3339
+	RFC3339Nano = time.RFC3339Nano // default
 )
 
 // GetMsg.GetProps enum
 const (
-	GetPropsChecksum = "checksum"
-	GetPropsSize     = "size"
-	GetPropsAtime    = "atime"
-	GetPropsCtime    = "ctime"
-	GetPropsIsCached = "iscached"
-	GetPropsBucket   = "bucket"
-	GetPropsVersion  = "version"
-	GetTargetURL     = "targetURL"
+	GetPropsChecksum     = "checksum"
+	GetPropsSize         = "size"
+	GetPropsAtime        = "atime"
+	GetPropsCtime        = "ctime"
+	GetPropsIsCached     = "iscached"
+	GetPropsBucket       = "bucket"
+	GetPropsVersion      = "version"
+	GetTargetURL         = "targetURL"
+	GetPropsStorageClass = "storageclass"
+	GetPropsTargetID     = "targetid"
 )
 
 //===================
@@ -172,22 +802,25 @@ const (
 // BucketEntry corresponds to a single entry in the BucketList and
 // contains file and directory metadata as per the GetMsg
 type BucketEntry struct {
-	Name      string `json:"name"`                // name of the object - note: does not include the bucket name
-	Size      int64  `json:"size"`                // size in bytes
-	Ctime     string `json:"ctime"`               // formatted as per GetMsg.GetTimeFormat
-	Checksum  string `json:"checksum"`            // checksum
-	Type      string `json:"type"`                // "file" OR "directory"
-	Atime     string `json:"atime"`               // formatted as per GetMsg.GetTimeFormat
-	Bucket    string `json:"bucket"`              // parent bucket name
-	Version   string `json:"version"`             // version/generation ID. In GCP it is int64, in AWS it is a string
-	IsCached  bool   `json:"iscached"`            // if the file is cached on one of targets
-	TargetURL string `json:"targetURL,omitempty"` // URL of target which has the entry
+	Name         string `json:"name"`                   // name of the object - note: does not include the bucket name
+	Size         int64  `json:"size"`                   // size in bytes
+	Ctime        string `json:"ctime"`                  // formatted as per GetMsg.GetTimeFormat
+	Checksum     string `json:"checksum"`               // checksum
+	Type         string `json:"type"`                   // "file" OR "directory"
+	Atime        string `json:"atime"`                  // formatted as per GetMsg.GetTimeFormat
+	Bucket       string `json:"bucket"`                 // parent bucket name
+	Version      string `json:"version"`                // version/generation ID. In GCP it is int64, in AWS it is a string
+	IsCached     bool   `json:"iscached"`               // if the file is cached on one of targets
+	TargetURL    string `json:"targetURL,omitempty"`    // URL of target which has the entry
+	StorageClass string `json:"storageclass,omitempty"` // cloud storage class of the object
+	TargetID     string `json:"targetid,omitempty"`     // ID of target which has the entry
 }
 
 // BucketList represents the contents of a given bucket - somewhat analogous to the 'ls <bucket-name>'
 type BucketList struct {
-	Entries    []*BucketEntry `json:"entries"`
-	PageMarker string         `json:"pagemarker"`
+	Entries        []*BucketEntry `json:"entries"`
+	PageMarker     string         `json:"pagemarker"`
+	CommonPrefixes []string       `json:"commonprefixes,omitempty"` // "directories" when listed with delimiter
 }
 
 // All bucket names known to the system
@@ -196,9 +829,10 @@ type BucketNames struct {
 	Local []string `json:"local"`
 }
 
-// RESTful URL path: /v1/....
+// RESTful URL path: /v1/.... (or /v2/...., see APIVersions)
 const (
 	Rversion   = "v1"
+	RversionV2 = "v2"
 	Rbuckets   = "buckets"
 	Robjects   = "objects"
 	Rcluster   = "cluster"
@@ -214,12 +848,16 @@ const (
 	Rvoteinit  = "init"
 	Rtokens    = "tokens"
 	Rmetasync  = "metasync"
+	Rbenchmark = "benchmark"
+	Rgossip    = "gossip"
+	Rslices    = "slices"
 )
 
 const (
 	// Used by various Xaction APIs
 	XactionRebalance = ActRebalance
 	XactionPrefetch  = ActPrefetch
+	XactionDestroy   = ActDestroyLB
 
 	// Denote the status of an Xaction
 	XactionStatusInProgress = "InProgress"
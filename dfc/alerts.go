@@ -0,0 +1,263 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/smtp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/NVIDIA/dfcpub/3rdparty/glog"
+)
+
+// Alerting. Every alertconf.Interval the primary proxy evaluates the
+// configured rules against the load reported by the targets (see load.go).
+// An alert fires once, when its condition becomes true, and is resolved once,
+// when the condition clears; an alert is identified by its rule, target and,
+// for mountpath rules, mountpath. Alert events are POST-ed as JSON to the
+// configured webhooks and/or emailed; SNMP traps and other notification
+// channels can be plugged in via a webhook receiver.
+
+// Alert kinds (alertrule.Kind)
+const (
+	AlertMpathDown = "mountpath_down" // mountpath disabled by the target
+	AlertCapacity  = "capacity"       // mountpath used above threshold %
+	AlertErrorRate = "error_rate"     // errors above threshold % of requests since the previous evaluation
+	// synthetic probes (see probe.go)
+	AlertProbeAvailability = "probe_availability" // successful probes below threshold %
+	AlertProbeLatency      = "probe_latency"      // average PUT, GET or list latency above threshold milliseconds
+)
+
+// Alert statuses (AlertEvent.Status)
+const (
+	AlertFiring   = "firing"
+	AlertResolved = "resolved"
+)
+
+// AlertEvent is sent when an alert fires or is resolved
+type AlertEvent struct {
+	Kind      string    `json:"kind"`
+	Status    string    `json:"status"`
+	Target    string    `json:"target"`
+	Mountpath string    `json:"mountpath,omitempty"`
+	Value     float64   `json:"value"`
+	Threshold float64   `json:"threshold"`
+	Since     time.Time `json:"since"` // when the alert fired
+	Time      time.Time `json:"time"`
+	Message   string    `json:"message"`
+}
+
+type alertrunner struct {
+	namedrunner
+	p      *proxyrunner
+	conf   *alertconf
+	active map[string]*AlertEvent // firing alerts by key
+	prev   map[string]*TargetLoad // previous load of each target, to compute rates
+	chstop chan struct{}
+}
+
+func validateAlertRule(rule alertrule) error {
+	switch rule.Kind {
+	case AlertMpathDown:
+	case AlertCapacity, AlertErrorRate, AlertProbeAvailability:
+		if rule.Threshold < 0 || rule.Threshold > 100 {
+			return fmt.Errorf("Invalid %s alert threshold: %v", rule.Kind, rule.Threshold)
+		}
+	case AlertProbeLatency:
+		if rule.Threshold <= 0 {
+			return fmt.Errorf("Invalid %s alert threshold: %v", rule.Kind, rule.Threshold)
+		}
+	default:
+		return fmt.Errorf("Invalid alert kind: %s", rule.Kind)
+	}
+	return nil
+}
+
+func newalertrunner(p *proxyrunner, conf *alertconf) *alertrunner {
+	return &alertrunner{
+		p:      p,
+		conf:   conf,
+		active: make(map[string]*AlertEvent),
+		prev:   make(map[string]*TargetLoad),
+		chstop: make(chan struct{}, 4),
+	}
+}
+
+func (r *alertrunner) run() error {
+	glog.Infof("Starting %s", r.name)
+	ticker := time.NewTicker(r.conf.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			// non-primary proxies do not receive the load reports
+			if !r.p.smapowner.get().isPrimary(r.p.si) {
+				continue
+			}
+			if events := r.evaluate(r.p.clusterLoad(), time.Now()); len(events) > 0 {
+				r.notify(events)
+			}
+		case <-r.chstop:
+			return nil
+		}
+	}
+}
+
+func (r *alertrunner) stop(err error) {
+	glog.Infof("Stopping %s, err: %v", r.name, err)
+	var v struct{}
+	r.chstop <- v
+	close(r.chstop)
+}
+
+// evaluate applies the rules to the cluster load and returns the events of
+// the alerts that have fired or been resolved since the previous evaluation
+func (r *alertrunner) evaluate(cload *ClusterLoad, now time.Time) (events []*AlertEvent) {
+	current := make(map[string]*AlertEvent)
+	alert := func(rule alertrule, sid, mpath string, value float64, format string, a ...interface{}) {
+		key := alertkey(rule, sid, mpath)
+		current[key] = &AlertEvent{
+			Kind:      rule.Kind,
+			Status:    AlertFiring,
+			Target:    sid,
+			Mountpath: mpath,
+			Value:     value,
+			Threshold: rule.Threshold,
+			Since:     now,
+			Time:      now,
+			Message:   fmt.Sprintf(format, a...),
+		}
+	}
+	for sid, load := range cload.Targets {
+		prev := r.prev[sid]
+		for _, rule := range r.conf.Rules {
+			switch rule.Kind {
+			case AlertMpathDown:
+				for _, mpath := range load.Offline {
+					alert(rule, sid, mpath, 0, "Target %s: mountpath %s is down", sid, mpath)
+				}
+			case AlertCapacity:
+				for mpath, usedpct := range load.Capacity {
+					if float64(usedpct) > rule.Threshold {
+						alert(rule, sid, mpath, float64(usedpct), "Target %s: mountpath %s is %d%% full", sid, mpath, usedpct)
+					}
+				}
+			case AlertErrorRate:
+				if prev == nil || !load.Time.After(prev.Time) {
+					// no new report: the alert, if any, stays as is
+					key := alertkey(rule, sid, "")
+					if event, ok := r.active[key]; ok {
+						current[key] = event
+					}
+					continue
+				}
+				requests, errors := load.Requests-prev.Requests, load.Errors-prev.Errors
+				if requests <= 0 || errors < 0 {
+					continue
+				}
+				if rate := float64(errors) * 100 / float64(requests); rate > rule.Threshold {
+					alert(rule, sid, "", rate, "Target %s: %d errors in %d requests (%.1f%%)", sid, errors, requests, rate)
+				}
+			}
+		}
+		if prev == nil || load.Time.After(prev.Time) {
+			r.prev[sid] = load
+		}
+	}
+	for sid := range r.prev {
+		if _, ok := cload.Targets[sid]; !ok {
+			delete(r.prev, sid)
+		}
+	}
+	for sid, sli := range cload.Probes {
+		for _, rule := range r.conf.Rules {
+			switch rule.Kind {
+			case AlertProbeAvailability:
+				if sli.Availability < rule.Threshold {
+					alert(rule, sid, "", sli.Availability, "Target %s: %.1f%% of the probes succeeded, last error: %s",
+						sid, sli.Availability, sli.LastError)
+				}
+			case AlertProbeLatency:
+				latency := sli.PutLatency
+				if sli.GetLatency > latency {
+					latency = sli.GetLatency
+				}
+				if sli.ListLatency > latency {
+					latency = sli.ListLatency
+				}
+				if ms := float64(latency) / float64(time.Millisecond); ms > rule.Threshold {
+					alert(rule, sid, "", ms, "Target %s: probe latency %v", sid, latency)
+				}
+			}
+		}
+	}
+	// deduplicate: fire new alerts, resolve the ones that cleared
+	for key, event := range current {
+		if active, ok := r.active[key]; ok {
+			current[key] = active
+			continue
+		}
+		events = append(events, event)
+	}
+	for key, active := range r.active {
+		if _, ok := current[key]; ok {
+			continue
+		}
+		resolved := *active
+		resolved.Status, resolved.Time = AlertResolved, now
+		events = append(events, &resolved)
+	}
+	r.active = current
+	sort.Slice(events, func(i, j int) bool { return events[i].Message < events[j].Message })
+	return
+}
+
+// notify sends the events to the webhooks and emails them
+func (r *alertrunner) notify(events []*AlertEvent) {
+	for _, event := range events {
+		glog.Warningf("Alert %s: %s", event.Status, event.Message)
+	}
+	for _, url := range r.conf.Webhooks {
+		for _, event := range events {
+			jsbytes, err := json.Marshal(event)
+			assert(err == nil, err)
+			response, err := r.p.httpclient.Post(url, "application/json", bytes.NewBuffer(jsbytes))
+			if err != nil {
+				glog.Errorf("Failed to send alert to %s, err: %v", url, err)
+				break
+			}
+			response.Body.Close()
+			if response.StatusCode >= http.StatusBadRequest {
+				glog.Errorf("Failed to send alert to %s, status %d", url, response.StatusCode)
+			}
+		}
+	}
+	if r.conf.SMTP != "" {
+		if err := r.email(events); err != nil {
+			glog.Errorf("Failed to email alerts via %s, err: %v", r.conf.SMTP, err)
+		}
+	}
+}
+
+func (r *alertrunner) email(events []*AlertEvent) error {
+	var body bytes.Buffer
+	fmt.Fprintf(&body, "From: %s\r\nTo: %s\r\n", r.conf.From, strings.Join(r.conf.To, ", "))
+	fmt.Fprintf(&body, "Subject: DFC alerts: %d events\r\n\r\n", len(events))
+	for _, event := range events {
+		fmt.Fprintf(&body, "[%s] %s %s (since %s)\r\n", event.Status, event.Time.Format(time.RFC3339),
+			event.Message, event.Since.Format(time.RFC3339))
+	}
+	return smtp.SendMail(r.conf.SMTP, nil, r.conf.From, r.conf.To, body.Bytes())
+}
+
+func alertkey(rule alertrule, sid, mpath string) string {
+	return fmt.Sprintf("%s|%v|%s|%s", rule.Kind, rule.Threshold, sid, mpath)
+}
@@ -0,0 +1,113 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ */
+package dfc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAlerts(t *testing.T) {
+	var received []*AlertEvent
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		event := &AlertEvent{}
+		if err := json.NewDecoder(r.Body).Decode(event); err != nil {
+			t.Errorf("Failed to decode alert, err: %v", err)
+		}
+		received = append(received, event)
+	}))
+	defer webhook.Close()
+
+	conf := &alertconf{
+		Rules: []alertrule{
+			{Kind: AlertMpathDown},
+			{Kind: AlertCapacity, Threshold: 90},
+			{Kind: AlertErrorRate, Threshold: 5},
+		},
+		Webhooks: []string{webhook.URL},
+	}
+	for _, rule := range conf.Rules {
+		if err := validateAlertRule(rule); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if validateAlertRule(alertrule{Kind: "temperature"}) == nil {
+		t.Error("Expected unknown alert kind to be invalid")
+	}
+	proxy := &proxyrunner{}
+	proxy.httpclient = &http.Client{}
+	r := newalertrunner(proxy, conf)
+
+	start := time.Now()
+	load := func(sec int, usedpct uint32, requests, errors int64, offline ...string) *ClusterLoad {
+		return &ClusterLoad{Targets: map[string]*TargetLoad{
+			"t1": {
+				Time:     start.Add(time.Duration(sec) * time.Second),
+				Capacity: map[string]uint32{"/mp1": usedpct, "/mp2": 10},
+				Offline:  offline,
+				Requests: requests,
+				Errors:   errors,
+			},
+		}}
+	}
+	kinds := func(events []*AlertEvent) (m map[string]string) {
+		m = make(map[string]string)
+		for _, event := range events {
+			m[event.Kind+":"+event.Mountpath] = event.Status
+		}
+		return
+	}
+
+	if events := r.evaluate(load(0, 50, 100, 0), start); len(events) != 0 {
+		t.Fatalf("Expected no alerts, got %v", kinds(events))
+	}
+	// full mountpath, mountpath down, 10% errors
+	events := r.evaluate(load(10, 95, 200, 10, "/mp3"), start.Add(10*time.Second))
+	expected := map[string]string{
+		AlertCapacity + ":/mp1":  AlertFiring,
+		AlertMpathDown + ":/mp3": AlertFiring,
+		AlertErrorRate + ":":     AlertFiring,
+	}
+	if got := kinds(events); len(got) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, got)
+	} else {
+		for k, v := range expected {
+			if got[k] != v {
+				t.Errorf("Expected %s %s, got %v", k, v, got)
+			}
+		}
+	}
+	r.notify(events)
+	if len(received) != 3 {
+		t.Errorf("Expected 3 alerts sent to the webhook, got %d", len(received))
+	}
+
+	// no new report: nothing changes
+	if events = r.evaluate(load(10, 95, 200, 10, "/mp3"), start.Add(15*time.Second)); len(events) != 0 {
+		t.Errorf("Expected the alerts to be deduplicated, got %v", kinds(events))
+	}
+	// the errors stop and the mountpath is back: resolved
+	events = r.evaluate(load(20, 95, 300, 10), start.Add(20*time.Second))
+	expected = map[string]string{
+		AlertMpathDown + ":/mp3": AlertResolved,
+		AlertErrorRate + ":":     AlertResolved,
+	}
+	if got := kinds(events); len(got) != len(expected) || got[AlertMpathDown+":/mp3"] != AlertResolved ||
+		got[AlertErrorRate+":"] != AlertResolved {
+		t.Fatalf("Expected %v, got %v", expected, got)
+	}
+	for _, event := range events {
+		if !event.Since.Equal(start.Add(10 * time.Second)) {
+			t.Errorf("Expected %s alert since %v, got %v", event.Kind, start.Add(10*time.Second), event.Since)
+		}
+	}
+	// the target leaves the cluster: the remaining alert is resolved
+	events = r.evaluate(&ClusterLoad{}, start.Add(30*time.Second))
+	if got := kinds(events); len(got) != 1 || got[AlertCapacity+":/mp1"] != AlertResolved {
+		t.Errorf("Expected the capacity alert to be resolved, got %v", got)
+	}
+}
@@ -0,0 +1,104 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// API versions. Every route is served under each supported version: /v1/...
+// and /v2/... A client selects the version with the path or, for /v1 paths,
+// with the Accept header (application/vnd.dfc.v2+json). Responses differ
+// between versions only where a format has changed:
+//   v1 - errors are plain-text messages
+//   v2 - errors are JSON envelopes (see Error)
+// Every response carries the negotiated version in HeaderAPIVersion; responses
+// to a deprecated version also carry the Deprecation header.
+
+// APIVersions lists the supported API versions, oldest first
+var APIVersions = []string{Rversion, RversionV2}
+
+// versions that are still served but will be removed
+var deprecatedAPIVersions = map[string]bool{}
+
+const mediaTypePrefix = "application/vnd.dfc."
+
+// APIVersion returns the API version negotiated for the request
+func APIVersion(r *http.Request) string {
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	for _, ver := range APIVersions[1:] {
+		if path == ver || strings.HasPrefix(path, ver+"/") {
+			return ver
+		}
+	}
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mt := strings.TrimSpace(strings.SplitN(accept, ";", 2)[0])
+		if !strings.HasPrefix(mt, mediaTypePrefix) {
+			continue
+		}
+		ver := strings.TrimSuffix(strings.TrimPrefix(mt, mediaTypePrefix), "+json")
+		if isAPIVersion(ver) {
+			return ver
+		}
+	}
+	return Rversion
+}
+
+// APIMediaType returns the Accept header value that selects the version
+func APIMediaType(ver string) string {
+	return mediaTypePrefix + ver + "+json"
+}
+
+// APIVersionHandler wraps the handler to set the version headers
+func APIVersionHandler(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ver := APIVersion(r)
+		hdr := w.Header()
+		hdr.Set(HeaderAPIVersion, ver)
+		hdr.Set(HeaderAPIVersions, strings.Join(APIVersions, ","))
+		if deprecatedAPIVersions[ver] {
+			hdr.Set("Deprecation", "true")
+			hdr.Set("Warning", fmt.Sprintf("299 - \"API version %s is deprecated, use %s\"",
+				ver, APIVersions[len(APIVersions)-1]))
+		}
+		handler(w, r)
+	}
+}
+
+func isAPIVersion(ver string) bool {
+	for _, v := range APIVersions {
+		if v == ver {
+			return true
+		}
+	}
+	return false
+}
+
+// versionedPaths returns the path under every supported version,
+// given the path under Rversion
+func versionedPaths(path string) []string {
+	prefix := "/" + Rversion
+	if path != prefix && !strings.HasPrefix(path, prefix+"/") {
+		return []string{path}
+	}
+	paths := make([]string, 0, len(APIVersions))
+	for _, ver := range APIVersions {
+		paths = append(paths, "/"+ver+path[len(prefix):])
+	}
+	return paths
+}
+
+// stripAPIVersion removes the version from the path
+func stripAPIVersion(path string) string {
+	for _, ver := range APIVersions {
+		if strings.HasPrefix(path, "/"+ver+"/") {
+			return path[len(ver)+1:]
+		}
+	}
+	return path
+}
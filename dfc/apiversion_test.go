@@ -0,0 +1,93 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ */
+package dfc
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAPIVersion(t *testing.T) {
+	h := &httprunner{}
+	h.registerhdlr(URLPath(Rversion, Robjects)+"/", func(w http.ResponseWriter, r *http.Request) {
+		apitems := h.restAPIItems(r.URL.Path, 5)
+		if apitems = h.checkRestAPI(w, r, apitems, 2, Rversion, Robjects); apitems == nil {
+			return
+		}
+		WriteError(w, r, NewError(http.StatusNotFound, "%s/%s does not exist", apitems[0], apitems[1]))
+	})
+	s := httptest.NewServer(h.mux)
+	defer s.Close()
+
+	tcs := []struct {
+		path   string
+		accept string
+		ver    string
+	}{
+		{"/v1/objects/b/o", "", Rversion},
+		{"/v2/objects/b/o", "", RversionV2},
+		{"/v1/objects/b/o", "application/json, " + APIMediaType(RversionV2) + ";q=0.9", RversionV2},
+		{"/v1/objects/b/o", APIMediaType("v9"), Rversion},
+		{"/v2/objects/b/o", APIMediaType(Rversion), RversionV2}, // the path takes precedence
+	}
+	for _, tc := range tcs {
+		req, _ := http.NewRequest(http.MethodGet, s.URL+tc.path, nil)
+		if tc.accept != "" {
+			req.Header.Set("Accept", tc.accept)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if ver := resp.Header.Get(HeaderAPIVersion); ver != tc.ver {
+			t.Errorf("%s (Accept: %q): expected version %s, got %s", tc.path, tc.accept, tc.ver, ver)
+		}
+		if vers := resp.Header.Get(HeaderAPIVersions); vers != strings.Join(APIVersions, ",") {
+			t.Errorf("%s: unexpected supported versions %q", tc.path, vers)
+		}
+		if resp.StatusCode != http.StatusNotFound || resp.Header.Get(HeaderRequestID) == "" {
+			t.Errorf("%s: unexpected response status %d, headers %v", tc.path, resp.StatusCode, resp.Header)
+		}
+		e := ErrorFromJSON(body)
+		if tc.ver == Rversion {
+			if e != nil || strings.TrimSpace(string(body)) != "b/o does not exist" {
+				t.Errorf("%s: expected plain-text error, got %q", tc.path, body)
+			}
+			continue
+		}
+		if e == nil || e.Code != ErrCodeNotFound || e.Bucket != "b" || e.Object != "o" {
+			t.Errorf("%s: expected error envelope, got %q", tc.path, body)
+		}
+	}
+
+	resp, err := http.Get(s.URL + "/v3/objects/b/o")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound || resp.Header.Get(HeaderAPIVersion) != "" {
+		t.Errorf("Expected unsupported version not to be served, got status %d", resp.StatusCode)
+	}
+}
+
+func TestAPIVersionDeprecation(t *testing.T) {
+	deprecatedAPIVersions[Rversion] = true
+	defer delete(deprecatedAPIVersions, Rversion)
+
+	handler := APIVersionHandler(func(w http.ResponseWriter, r *http.Request) {})
+	for _, ver := range APIVersions {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodGet, URLPath(ver, Rhealth), nil))
+		deprecated := w.Header().Get("Deprecation") == "true" && w.Header().Get("Warning") != ""
+		if deprecated != (ver == Rversion) {
+			t.Errorf("Version %s: unexpected headers %v", ver, w.Header())
+		}
+	}
+}
@@ -31,6 +31,7 @@ type atimerunner struct {
 	chfqn    chan string // FIXME: consider { fqn, xxhash }
 	chstop   chan struct{}
 	atimemap *atimemap
+	clock    Clock
 }
 
 func (r *atimerunner) run() error {
@@ -45,7 +46,7 @@ loop:
 			}
 		case fqn := <-r.chfqn:
 			r.atimemap.Lock()
-			r.atimemap.m[fqn] = time.Now()
+			r.atimemap.m[fqn] = r.clock.Now()
 			r.atimemap.Unlock()
 		case <-r.chstop:
 			ticker.Stop() // NOTE: not flushing cached atimes
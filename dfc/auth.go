@@ -18,16 +18,22 @@
 //       region = AWSREGION
 //       aws_access_key_id = USERACCESSKEY
 //       aws_secret_access_key = USERSECRETKEY
-//      GCP: credentials from memory saved to file <config.Auth.CredDir>/<ProvideGoogle>/<UserID>.json.
+//      GCP: credentials from memory saved to temporary file in <config.Auth.CredDir>/<ProvideGoogle>/.
 //	    Then GCP session is intialized with the file content (GCP API does
-//          not have a way to load credentials from memory)
+//          not have a way to load credentials from memory) and the file is removed
 // 3. If anything goes wrong: no user credentials found, invalid credentials
 //    format etc then default session is created (as if AuthN is disabled)
 package dfc
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
 	"sync"
 	"time"
 
@@ -38,16 +44,58 @@ import (
 // Declare a new type for Context field names
 type contextID string
 
+// Revoked token list is pulled from AuthN at startup (see pullRevokedList)
 const (
-	ctxUserID    contextID = "userID"    // a field name of a context that contains userID
-	ctxCredsDir  contextID = "credDir"   // a field of a context that contains path to directory with credentials
-	ctxUserCreds contextID = "userCreds" // a field of a context that contains user credentials
+	authnRevokedPath    = "/" + Rversion + "/revoked"
+	authnRequestTimeout = 30 * time.Second
+)
+
+const (
+	ctxUserID      contextID = "userID"      // a field name of a context that contains userID
+	ctxCredsDir    contextID = "credDir"     // a field of a context that contains path to directory with credentials
+	ctxUserCreds   contextID = "userCreds"   // a field of a context that contains user credentials
+	ctxCustomerKey contextID = "customerKey" // a field of a context that contains customer-supplied encryption key
+	ctxPGroup      contextID = "pgroup"      // a field of a context that contains placement group of an object
+	ctxPrecond     contextID = "precond"     // a field of a context that contains preconditions of a DELETE
 )
 
 type (
-	// TokenList is a list of tokens pushed by authn
+	// TokenList is a list of revoked tokens pushed by authn. Tokens are
+	// identified by their digests, so raw tokens are not distributed over
+	// the cluster; raw tokens are still accepted from older authn servers
 	TokenList struct {
-		Tokens []string `json:"tokens"`
+		Tokens  []string        `json:"tokens,omitempty"`
+		Revoked []*RevokedToken `json:"revoked,omitempty"`
+		Full    bool            `json:"full,omitempty"` // all tokens revoked by authn, not just the latest ones
+	}
+
+	// RevokedToken is a digest of a revoked token (see TokenDigest) and the
+	// time the token expires: after that the digest can be forgotten
+	RevokedToken struct {
+		Digest  string    `json:"digest"`
+		Expires time.Time `json:"expires"`
+	}
+
+	// TokenMsg is a request to check a token
+	TokenMsg struct {
+		Token string `json:"token"`
+	}
+
+	// TokenInfo is a result of token introspection: whether the token is valid
+	// and, for a valid token, its owner, scope and expiration time
+	TokenInfo struct {
+		Valid   bool      `json:"valid"`
+		Reason  string    `json:"reason,omitempty"` // why the token is invalid
+		UserID  string    `json:"username,omitempty"`
+		APIKey  string    `json:"apikey,omitempty"`
+		Buckets []string  `json:"buckets,omitempty"`
+		Access  []string  `json:"access,omitempty"`
+		Verbs   []string  `json:"verbs,omitempty"`
+		Issued  time.Time `json:"issued"`
+		Expires time.Time `json:"expires"`
+		// the token was validated before the full revoked token list was
+		// received, so it may have been revoked
+		Unverified bool `json:"unverified,omitempty"`
 	}
 
 	authRec struct {
@@ -55,20 +103,40 @@ type (
 		issued  time.Time
 		expires time.Time
 		creds   simplekvs
+		// token scope
+		buckets []string // buckets the token can access (empty - all)
+		access  []string // read and/or write (empty - all)
+		// API key fields: empty for interactive user tokens
+		apiKey string
+		verbs  []string // HTTP methods an API key can use (empty - all)
+		// validated before the full revoked token list was received
+		unverified bool
 	}
 
-	authList map[string]*authRec
+	authList map[string]*authRec // token digest -> decrypted token
 
 	authManager struct {
 		sync.Mutex
 		// cache of decrypted tokens
 		tokens authList
-		// list of invalid tokens(revoked or of deleted users)
-		// Authn sends these tokens to primary for broadcasting
-		revokedTokens map[string]bool
+		// digests of invalid tokens(revoked or of deleted users) and their
+		// expiration times. Authn sends these tokens to primary for broadcasting
+		revokedTokens map[string]time.Time
+		// the full revoked token list has been received since startup. Until
+		// then tokens are validated cryptographically and the validated ones
+		// are marked unverified; the full list drops the revoked ones
+		synced bool
+		clock  Clock
 	}
 )
 
+// TokenDigest returns the identifier of a token in the revoked token list
+// and in the token cache
+func TokenDigest(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
 // Decrypts JWT token and returns all encrypted information.
 // Used by proxy - to check a user access and token validity(e.g, expiration),
 // and by target - only to get a user name for AWS/GCP access
@@ -79,11 +147,20 @@ func decryptToken(tokenStr string) (*authRec, error) {
 	)
 	rec := &authRec{}
 	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		switch token.Method.(type) {
+		case *jwt.SigningMethodHMAC:
+			// no secret - only asymmetrically signed tokens are accepted
+			secret := authSecret()
+			if secret == "" {
+				return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
+			}
+			return []byte(secret), nil
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodECDSA:
+			kid, _ := token.Header["kid"].(string)
+			return authnKeys.get(kid)
+		default:
 			return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
 		}
-
-		return []byte(ctx.config.Auth.Secret), nil
 	})
 	if err != nil {
 		return nil, err
@@ -99,13 +176,13 @@ func decryptToken(tokenStr string) (*authRec, error) {
 	if issueStr, ok = claims["issued"].(string); !ok {
 		return nil, invalTokenErr
 	}
-	if rec.issued, err = time.Parse(time.RFC822, issueStr); err != nil {
+	if rec.issued, err = ParseTime(issueStr); err != nil {
 		return nil, invalTokenErr
 	}
 	if expireStr, ok = claims["expires"].(string); !ok {
 		return nil, invalTokenErr
 	}
-	if rec.expires, err = time.Parse(time.RFC822, expireStr); err != nil {
+	if rec.expires, err = ParseTime(expireStr); err != nil {
 		return nil, invalTokenErr
 	}
 	rec.creds = make(simplekvs, 0)
@@ -120,10 +197,53 @@ func decryptToken(tokenStr string) (*authRec, error) {
 	} else {
 		glog.Info("Token for %s does not contain credentials", rec.userID)
 	}
+	rec.buckets = claimToStrings(claims["buckets"])
+	rec.access = claimToStrings(claims["access"])
+	if rec.apiKey, ok = claims["apikey"].(string); ok {
+		rec.verbs = claimToStrings(claims["verbs"])
+	}
 
 	return rec, nil
 }
 
+// Converts a JSON array claim to a list of strings. Non-string values are skipped
+func claimToStrings(claim interface{}) []string {
+	list, ok := claim.([]interface{})
+	if !ok {
+		return nil
+	}
+	values := make([]string, 0, len(list))
+	for _, value := range list {
+		if asStr, ok := value.(string); ok {
+			values = append(values, asStr)
+		}
+	}
+	return values
+}
+
+// Returns the access scope required to execute the HTTP method
+func methodAccess(method string) string {
+	if method == http.MethodGet || method == http.MethodHead {
+		return AccessRead
+	}
+	return AccessWrite
+}
+
+// Returns true if the token scope allows to execute the HTTP method that
+// requires the access for the bucket
+func (a *authRec) allows(bucket, method, access string) bool {
+	if len(a.verbs) != 0 && !stringInSlice(method, a.verbs) {
+		return false
+	}
+	if len(a.access) != 0 && !stringInSlice(access, a.access) {
+		return false
+	}
+	if len(a.buckets) != 0 && !stringInSlice(bucket, a.buckets) {
+		return false
+	}
+	return true
+}
+
 // Retreives a string from context field or empty string if nothing found or
 //   the field is not of string type
 func getStringFromContext(ct context.Context, fieldName contextID) string {
@@ -155,42 +275,70 @@ func userCredsFromContext(ct context.Context) simplekvs {
 }
 
 // Add tokens to list of invalid ones. After that it cleans up the list
-// from expired tokens
-func (a *authManager) updateRevokedList(tokens *TokenList) {
+// from expired tokens. Returns the added tokens as digests, raw tokens are
+// converted; revoked tokens with zero expiration time are kept forever
+func (a *authManager) updateRevokedList(tokens *TokenList) *TokenList {
+	revoked := &TokenList{}
 	if tokens == nil {
-		return
+		return revoked
 	}
+	revoked.Full = tokens.Full
 
-	a.Lock()
 	for _, token := range tokens.Tokens {
-		a.revokedTokens[token] = true
-		delete(a.tokens, token)
+		rec, err := decryptToken(token)
+		if err != nil {
+			// a token that cannot be decrypted is never valid
+			continue
+		}
+		revoked.Revoked = append(revoked.Revoked, &RevokedToken{Digest: TokenDigest(token), Expires: rec.expires})
+	}
+	revoked.Revoked = append(revoked.Revoked, tokens.Revoked...)
+
+	a.Lock()
+	for _, token := range revoked.Revoked {
+		a.revokedTokens[token.Digest] = token.Expires
+		if rec, ok := a.tokens[token.Digest]; ok && rec.unverified {
+			glog.Warningf("Token of %s was accepted before it was known to be revoked", rec.userID)
+		}
+		delete(a.tokens, token.Digest)
+	}
+	if revoked.Full {
+		if !a.synced {
+			glog.Infof("Received %d revoked tokens", len(revoked.Revoked))
+		}
+		a.synced = true
+		for _, rec := range a.tokens {
+			rec.unverified = false
+		}
 	}
 	// clean up the list from obsolete data
-	for token := range a.revokedTokens {
-		rec, err := a.extractTokenData(token)
-		if err == nil && rec.expires.Before(time.Now()) {
-			delete(a.revokedTokens, token)
+	now := a.clock.Now()
+	for digest, expires := range a.revokedTokens {
+		if !expires.IsZero() && expires.Before(now) {
+			delete(a.revokedTokens, digest)
 		}
 	}
 	a.Unlock()
+	return revoked
 }
 
 // Checks if a token is valid:
 //   - must not be revoked one
 //   - must not be expired
+//   - user token must not live longer than the cluster allows
 //   - must have all mandatory fields: userID, creds, issued, expires
 // Returns decrypted token information if it is valid
 func (a *authManager) validateToken(token string) (ar *authRec, err error) {
+	digest := TokenDigest(token)
 	a.Lock()
 
-	if _, ok := a.revokedTokens[token]; ok {
+	if _, ok := a.revokedTokens[digest]; ok {
 		ar, err = nil, fmt.Errorf("Invalid token")
 		a.Unlock()
 		return
 	}
 
-	ar, err = a.extractTokenData(token)
+	ar, err = a.extractTokenData(token, digest)
 	a.Unlock()
 	return
 }
@@ -199,27 +347,101 @@ func (a *authManager) validateToken(token string) (ar *authRec, err error) {
 // was issued. Return error is the token expired or does not include all
 // mandatory fields
 // It is internal service function, so it does not lock anything
-func (a *authManager) extractTokenData(token string) (*authRec, error) {
+func (a *authManager) extractTokenData(token, digest string) (*authRec, error) {
 	var err error
 
-	auth, ok := a.tokens[token]
+	auth, ok := a.tokens[digest]
 	if !ok || auth == nil {
 		if auth, err = decryptToken(token); err != nil {
-			glog.Errorf("Invalid token was recieved: %s", token)
+			glog.Errorf("Invalid token was recieved: %s", digest)
 			return nil, fmt.Errorf("Invalid token")
 		}
-		a.tokens[token] = auth
+		auth.unverified = !a.synced
+		a.tokens[digest] = auth
 	}
 
 	if auth == nil {
 		return nil, fmt.Errorf("Invalid token")
 	}
 
-	if auth.expires.Before(time.Now()) {
-		glog.Errorf("Expired token was used: %s", token)
-		delete(a.tokens, token)
+	if auth.expires.Before(a.clock.Now()) {
+		glog.Errorf("Expired token was used: %s", digest)
+		delete(a.tokens, digest)
 		return nil, fmt.Errorf("Token expired")
 	}
+	// token times have minute precision, hence the extra minute
+	maxLifetime := ctx.config.Auth.MaxTokenLifetime
+	if auth.apiKey == "" && maxLifetime != 0 && auth.expires.Sub(auth.issued) > maxLifetime+time.Minute {
+		glog.Errorf("Token of %s lives longer than %v: %s", auth.userID, maxLifetime, digest)
+		delete(a.tokens, digest)
+		return nil, fmt.Errorf("Token lifetime exceeds the limit")
+	}
 
 	return auth, nil
 }
+
+// Returns information about a token for introspection API
+func (a *authManager) introspectToken(token string) *TokenInfo {
+	rec, err := a.validateToken(token)
+	if err != nil {
+		return &TokenInfo{Reason: err.Error()}
+	}
+	a.Lock()
+	unverified := rec.unverified
+	a.Unlock()
+	return &TokenInfo{
+		Valid:      true,
+		UserID:     rec.userID,
+		APIKey:     rec.apiKey,
+		Buckets:    rec.buckets,
+		Access:     rec.access,
+		Verbs:      rec.verbs,
+		Issued:     rec.issued,
+		Expires:    rec.expires,
+		Unverified: unverified,
+	}
+}
+
+// Pulls the full revoked token list from AuthN, so a restarted daemon does
+// not have to wait for AuthN to resync it. Retries until it succeeds or the
+// list is pushed by AuthN
+func (a *authManager) pullRevokedList(authnURL string) {
+	for {
+		a.Lock()
+		synced := a.synced
+		a.Unlock()
+		if synced {
+			return
+		}
+		tokens, err := fetchRevokedList(authnURL)
+		if err == nil {
+			a.updateRevokedList(tokens)
+			return
+		}
+		glog.Errorf("Failed to pull revoked tokens: %v", err)
+		time.Sleep(ctx.config.Periodic.RetrySyncTime)
+	}
+}
+
+func fetchRevokedList(authnURL string) (*TokenList, error) {
+	reqURL := strings.TrimSuffix(authnURL, "/") + authnRevokedPath
+	client := &http.Client{Timeout: authnRequestTimeout}
+	r, err := client.Get(reqURL)
+	if err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read %s: %v", reqURL, err)
+	}
+	if r.StatusCode >= http.StatusBadRequest {
+		return nil, fmt.Errorf("Failed to read %s: status %d", reqURL, r.StatusCode)
+	}
+	tokens := &TokenList{}
+	if err = json.Unmarshal(b, tokens); err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal %s: %v", reqURL, err)
+	}
+	tokens.Full = true
+	return tokens, nil
+}
@@ -0,0 +1,266 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ */
+package dfc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestTokenScope(t *testing.T) {
+	ctx.config.Auth.Secret = "aBitLongSecretKey"
+	issued := time.Now()
+	tcs := []struct {
+		claims  jwt.MapClaims
+		bucket  string
+		method  string
+		allowed bool
+	}{
+		{jwt.MapClaims{}, "bucket1", http.MethodPut, true},
+		{jwt.MapClaims{"buckets": []string{"bucket1"}}, "bucket1", http.MethodDelete, true},
+		{jwt.MapClaims{"buckets": []string{"bucket1"}}, "bucket2", http.MethodGet, false},
+		{jwt.MapClaims{"access": []string{AccessRead}}, "bucket2", http.MethodHead, true},
+		{jwt.MapClaims{"access": []string{AccessRead}}, "bucket2", http.MethodPost, false},
+		{jwt.MapClaims{"access": []string{AccessRead, AccessWrite}}, "bucket2", http.MethodPut, true},
+		{jwt.MapClaims{"apikey": "key1", "verbs": []string{http.MethodGet}}, "bucket1", http.MethodGet, true},
+		{jwt.MapClaims{"apikey": "key1", "verbs": []string{http.MethodGet}}, "bucket1", http.MethodHead, false},
+		// verbs are ignored for user tokens
+		{jwt.MapClaims{"verbs": []string{http.MethodGet}}, "bucket1", http.MethodHead, true},
+	}
+
+	for _, tc := range tcs {
+		tc.claims["issued"] = issued.Format(time.RFC822)
+		tc.claims["expires"] = issued.Add(time.Hour).Format(time.RFC822)
+		tc.claims["username"] = "user"
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, tc.claims).SignedString([]byte(ctx.config.Auth.Secret))
+		if err != nil {
+			t.Fatalf("Failed to generate token: %v", err)
+		}
+		rec, err := decryptToken(token)
+		if err != nil {
+			t.Fatalf("Failed to decrypt token: %v", err)
+		}
+		if rec.allows(tc.bucket, tc.method, methodAccess(tc.method)) != tc.allowed {
+			t.Errorf("%v: %s %s expected allowed=%v", tc.claims, tc.method, tc.bucket, tc.allowed)
+		}
+	}
+}
+
+func TestTokenTimeFormats(t *testing.T) {
+	ctx.config.Auth.Secret = "aBitLongSecretKey"
+	issued := time.Date(2018, time.July, 1, 12, 0, 0, 123456789, time.UTC)
+	for _, layout := range []string{time.RFC3339Nano, time.RFC822} {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"issued":   issued.Format(layout),
+			"expires":  issued.Add(time.Hour).Format(layout),
+			"username": "user",
+		}).SignedString([]byte(ctx.config.Auth.Secret))
+		if err != nil {
+			t.Fatalf("Failed to generate token: %v", err)
+		}
+		rec, err := decryptToken(token)
+		if err != nil {
+			t.Fatalf("%s: failed to decrypt token: %v", layout, err)
+		}
+		expected, _ := time.Parse(layout, issued.Format(layout))
+		if !rec.issued.Equal(expected) {
+			t.Errorf("%s: issued %v, expected %v", layout, rec.issued, expected)
+		}
+	}
+}
+
+func TestIntrospectToken(t *testing.T) {
+	ctx.config.Auth.Secret = "aBitLongSecretKey"
+	mgr := &authManager{tokens: make(authList), revokedTokens: make(map[string]time.Time), clock: SystemClock{}}
+	issued := time.Now()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"issued":   issued.Format(time.RFC822),
+		"expires":  issued.Add(time.Hour).Format(time.RFC822),
+		"username": "user",
+		"buckets":  []string{"bucket1"},
+	}).SignedString([]byte(ctx.config.Auth.Secret))
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+
+	info := mgr.introspectToken(token)
+	if !info.Valid || info.UserID != "user" || len(info.Buckets) != 1 || info.Buckets[0] != "bucket1" {
+		t.Errorf("Invalid token info: %+v", info)
+	}
+
+	mgr.updateRevokedList(&TokenList{Tokens: []string{token}})
+	if info = mgr.introspectToken(token); info.Valid || info.Reason == "" {
+		t.Errorf("Revoked token introspected as valid: %+v", info)
+	}
+	if info = mgr.introspectToken("invalid"); info.Valid {
+		t.Errorf("Invalid token introspected as valid: %+v", info)
+	}
+}
+
+func TestTokenExpiration(t *testing.T) {
+	ctx.config.Auth.Secret = "aBitLongSecretKey"
+	issued := time.Date(2018, time.July, 1, 12, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(issued)
+	mgr := &authManager{tokens: make(authList), revokedTokens: make(map[string]time.Time), clock: clock}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"issued":   issued.Format(time.RFC822),
+		"expires":  issued.Add(time.Hour).Format(time.RFC822),
+		"username": "user",
+	}).SignedString([]byte(ctx.config.Auth.Secret))
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+
+	clock.Advance(59 * time.Minute)
+	if _, err = mgr.validateToken(token); err != nil {
+		t.Errorf("Token expired too early: %v", err)
+	}
+	clock.Advance(2 * time.Minute)
+	if _, err = mgr.validateToken(token); err == nil {
+		t.Error("Expired token validated")
+	}
+	if _, ok := mgr.tokens[TokenDigest(token)]; ok {
+		t.Error("Expired token was not removed from the cache")
+	}
+}
+
+func TestTokenMaxLifetime(t *testing.T) {
+	ctx.config.Auth.Secret = "aBitLongSecretKey"
+	oldmax := ctx.config.Auth.MaxTokenLifetime
+	defer func() { ctx.config.Auth.MaxTokenLifetime = oldmax }()
+	ctx.config.Auth.MaxTokenLifetime = time.Hour
+
+	issued := time.Now()
+	mgr := &authManager{tokens: make(authList), revokedTokens: make(map[string]time.Time), clock: SystemClock{}}
+	tcs := []struct {
+		lifetime time.Duration
+		apiKey   string
+		valid    bool
+	}{
+		{time.Hour, "", true},
+		{2 * time.Hour, "", false},
+		// API keys are long-lived by design
+		{24 * time.Hour, "key1", true},
+	}
+	for _, tc := range tcs {
+		claims := jwt.MapClaims{
+			"issued":   issued.Format(time.RFC822),
+			"expires":  issued.Add(tc.lifetime).Format(time.RFC822),
+			"username": "user",
+		}
+		if tc.apiKey != "" {
+			claims["apikey"] = tc.apiKey
+		}
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(ctx.config.Auth.Secret))
+		if err != nil {
+			t.Fatalf("Failed to generate token: %v", err)
+		}
+		if _, err = mgr.validateToken(token); (err == nil) != tc.valid {
+			t.Errorf("Token with lifetime %v (API key %q): expected valid=%t, err: %v", tc.lifetime, tc.apiKey, tc.valid, err)
+		}
+	}
+}
+
+func TestRevokedTokenDigests(t *testing.T) {
+	ctx.config.Auth.Secret = "aBitLongSecretKey"
+	now := time.Date(2018, time.July, 1, 12, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(now)
+	mgr := &authManager{tokens: make(authList), revokedTokens: make(map[string]time.Time), clock: clock}
+	tokens := make([]string, 0, 3)
+	for i := 1; i <= 3; i++ {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"issued":   now.Format(time.RFC822),
+			"expires":  now.Add(time.Duration(i) * time.Hour).Format(time.RFC822),
+			"username": "user",
+		}).SignedString([]byte(ctx.config.Auth.Secret))
+		if err != nil {
+			t.Fatalf("Failed to generate token: %v", err)
+		}
+		if _, err = mgr.validateToken(token); err != nil {
+			t.Fatalf("Token is invalid: %v", err)
+		}
+		tokens = append(tokens, token)
+	}
+	for digest := range mgr.tokens {
+		if digest != TokenDigest(tokens[0]) && digest != TokenDigest(tokens[1]) && digest != TokenDigest(tokens[2]) {
+			t.Errorf("Token cache is not keyed by token digests: %s", digest)
+		}
+	}
+
+	// a raw token from an older authn is converted to its digest
+	revoked := mgr.updateRevokedList(&TokenList{
+		Tokens:  []string{tokens[0]},
+		Revoked: []*RevokedToken{{Digest: TokenDigest(tokens[1]), Expires: now.Add(2 * time.Hour)}},
+	})
+	if len(revoked.Tokens) != 0 || len(revoked.Revoked) != 2 ||
+		revoked.Revoked[0].Digest != TokenDigest(tokens[0]) || !revoked.Revoked[0].Expires.Equal(now.Add(time.Hour)) {
+		t.Errorf("Unexpected revoked token list %+v", revoked)
+	}
+	for i, token := range tokens {
+		if _, err := mgr.validateToken(token); (err == nil) != (i == 2) {
+			t.Errorf("Token %d: expected valid=%t, err: %v", i, i == 2, err)
+		}
+	}
+	if len(mgr.tokens) != 1 {
+		t.Errorf("Revoked tokens were not removed from the cache: %d tokens", len(mgr.tokens))
+	}
+
+	// digests are forgotten once the tokens expire
+	clock.Advance(90 * time.Minute)
+	mgr.updateRevokedList(&TokenList{})
+	if len(mgr.revokedTokens) != 1 {
+		t.Errorf("Expected 1 revoked token, found %d", len(mgr.revokedTokens))
+	}
+}
+
+func TestPullRevokedList(t *testing.T) {
+	ctx.config.Auth.Secret = "aBitLongSecretKey"
+	issued := time.Now()
+	tokens := make([]string, 0, 2)
+	for _, user := range []string{"user1", "user2"} {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"issued":   issued.Format(time.RFC822),
+			"expires":  issued.Add(time.Hour).Format(time.RFC822),
+			"username": user,
+		}).SignedString([]byte(ctx.config.Auth.Secret))
+		if err != nil {
+			t.Fatalf("Failed to generate token: %v", err)
+		}
+		tokens = append(tokens, token)
+	}
+	authn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != authnRevokedPath {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		list := &TokenList{Revoked: []*RevokedToken{{Digest: TokenDigest(tokens[0]), Expires: issued.Add(time.Hour)}}}
+		jsbytes, _ := json.Marshal(list)
+		w.Write(jsbytes)
+	}))
+	defer authn.Close()
+
+	// before the revoked token list is received tokens are only validated cryptographically
+	mgr := &authManager{tokens: make(authList), revokedTokens: make(map[string]time.Time), clock: SystemClock{}}
+	for _, token := range tokens {
+		if info := mgr.introspectToken(token); !info.Valid || !info.Unverified {
+			t.Errorf("Expected valid unverified token, got %+v", info)
+		}
+	}
+
+	mgr.pullRevokedList(authn.URL)
+	if info := mgr.introspectToken(tokens[0]); info.Valid {
+		t.Errorf("Revoked token is valid after the revoked token list was pulled: %+v", info)
+	}
+	if info := mgr.introspectToken(tokens[1]); !info.Valid || info.Unverified {
+		t.Errorf("Expected valid verified token, got %+v", info)
+	}
+	if _, err := fetchRevokedList(authn.URL + "/invalid"); err == nil {
+		t.Error("Expected an error fetching revoked tokens from invalid URL")
+	}
+}
@@ -8,12 +8,11 @@ package dfc
 import (
 	"context"
 	"encoding/json"
-	"fmt"
+	"io"
 	"net/http"
-	"os"
 	"strconv"
 	"strings"
-	"time"
+	"sync"
 
 	"github.com/NVIDIA/dfcpub/3rdparty/glog"
 	"github.com/aws/aws-sdk-go/aws"
@@ -29,10 +28,29 @@ const (
 	awsPutDfcHashVal  = "x-amz-meta-dfc-hash-val"
 	awsGetDfcHashType = "X-Amz-Meta-Dfc-Hash-Type"
 	awsGetDfcHashVal  = "X-Amz-Meta-Dfc-Hash-Val"
+	awsMetaPrefix     = "X-Amz-Meta-"
 	awsMultipartDelim = "-"
 	awsMaxPageSize    = 1000
+	awsVersionLookups = 16 // workers looking up the versions of a page of objects
+	// error code of GetBucketEncryption when the bucket has no default encryption
+	awsNoEncryptionConfig = "ServerSideEncryptionConfigurationNotFoundError"
+	// error code of GetObject when the object is archived and must be restored first
+	awsInvalidObjectState = "InvalidObjectState"
+	// transient errors
+	awsSlowDown       = "SlowDown"
+	awsRequestTimeout = "RequestTimeout"
 )
 
+// S3 storage classes DFC can write objects with
+var awsStorageClasses = map[string]bool{
+	s3.StorageClassStandard:          true,
+	s3.StorageClassReducedRedundancy: true,
+	s3.StorageClassStandardIa:        true,
+	s3.StorageClassOnezoneIa:         true,
+	"INTELLIGENT_TIERING":            true, // no s3.StorageClass* constants in the pinned SDK
+	"GLACIER":                        true,
+}
+
 //======
 //
 // implements cloudif
@@ -93,7 +111,7 @@ func extractAWSCreds(credsList map[string]string) *awsCreds {
 
 //======
 //
-// session FIXME: optimize
+// session
 //
 //======
 // A new session is created in two ways:
@@ -111,40 +129,77 @@ func extractAWSCreds(credsList map[string]string) *awsCreds {
 //    aws_secret_access_key = USERSECRET
 // If creation of a session with provided directory and userID fails, it
 // tries to create a session with default parameters
+// The sessions are cached and reused (see awssession.go)
 func createSession(ct context.Context) *session.Session {
-	// TODO: avoid creating sessions for each request
+	if awsEndpoint != "" {
+		// fake S3 (see fakes3.go)
+		return awsSessions.get("", awsEndpoint, func() *session.Session {
+			return session.Must(session.NewSessionWithOptions(session.Options{Config: aws.Config{
+				Endpoint:         aws.String(awsEndpoint),
+				Region:           aws.String(fakes3Region),
+				S3ForcePathStyle: aws.Bool(true),
+				Credentials:      credentials.NewStaticCredentials("fakes3", "fakes3", ""),
+			}}))
+		})
+	}
 	userID := getStringFromContext(ct, ctxUserID)
 	userCreds := userCredsFromContext(ct)
 	if userID == "" || userCreds == nil {
 		if glog.V(5) {
 			glog.Info("No user ID or empty credentials: opening default session")
 		}
-		// default session
-		return session.Must(session.NewSessionWithOptions(session.Options{
-			SharedConfigState: session.SharedConfigEnable}))
+		return defaultSession()
 	}
 
 	creds := extractAWSCreds(userCreds)
 	if creds == nil {
 		glog.Errorf("Failed to retrieve %s credentials %s", ProviderAmazon, userID)
+		return defaultSession()
+	}
+
+	return awsSessions.get(userID, awsUserTag(creds), func() *session.Session {
+		awsCreds := credentials.NewStaticCredentials(creds.key, creds.secret, "")
+		conf := aws.Config{
+			Region:      aws.String(creds.region),
+			Credentials: awsCreds,
+		}
+		return session.Must(session.NewSessionWithOptions(session.Options{Config: conf}))
+	})
+}
+
+func defaultSession() *session.Session {
+	return awsSessions.get("", awsSharedFilesTag(), func() *session.Session {
 		return session.Must(session.NewSessionWithOptions(session.Options{
 			SharedConfigState: session.SharedConfigEnable}))
-	}
+	})
+}
 
-	awsCreds := credentials.NewStaticCredentials(creds.key, creds.secret, "")
-	conf := aws.Config{
-		Region:      aws.String(creds.region),
-		Credentials: awsCreds,
+// awsError converts an error returned by AWS SDK into Error, keeping the S3
+// error code as the detail. S3 asks to retry the requests that failed with
+// SlowDown and RequestTimeout regardless of HTTP status
+func awsError(err error, format string, a ...interface{}) *Error {
+	status, detail := http.StatusInternalServerError, ""
+	if reqErr, ok := err.(awserr.RequestFailure); ok {
+		status = reqErr.StatusCode()
 	}
-	return session.Must(session.NewSessionWithOptions(session.Options{Config: conf}))
+	if awsErr, ok := err.(awserr.Error); ok {
+		detail = awsErr.Code()
+	}
+	cerr := cloudError(ProviderAmazon, status, detail, format, a...)
+	if detail == awsSlowDown || detail == awsRequestTimeout {
+		cerr.Retryable = true
+	}
+	return cerr
 }
 
-func awsErrorToHTTP(awsError error) int {
-	if reqErr, ok := awsError.(awserr.RequestFailure); ok {
-		return reqErr.StatusCode()
+// Returns RequestPayer parameter for requests to the bucket: nil if the
+// bucket owner pays
+func (awsimpl *awsimpl) requestPayer(bucket string) *string {
+	_, props := awsimpl.t.bmdowner.get().get(bucket, false)
+	if props.RequesterPays {
+		return aws.String(s3.RequestPayerRequester)
 	}
-
-	return http.StatusInternalServerError
+	return nil
 }
 
 func awsIsVersionSet(version *string) bool {
@@ -156,19 +211,24 @@ func awsIsVersionSet(version *string) bool {
 // bucket operations
 //
 //==================
-func (awsimpl *awsimpl) listbucket(ct context.Context, bucket string, msg *GetMsg) (jsbytes []byte, errstr string, errcode int) {
+func (awsimpl *awsimpl) listbucket(ct context.Context, bucket string, msg *GetMsg) (jsbytes []byte, cerr *Error) {
 	if glog.V(4) {
 		glog.Infof("listbucket %s", bucket)
 	}
 	sess := createSession(ct)
 	svc := s3.New(sess)
 
-	params := &s3.ListObjectsInput{Bucket: aws.String(bucket)}
+	params := &s3.ListObjectsV2Input{Bucket: aws.String(bucket), RequestPayer: awsimpl.requestPayer(bucket)}
 	if msg.GetPrefix != "" {
 		params.Prefix = aws.String(msg.GetPrefix)
 	}
 	if msg.GetPageMarker != "" {
-		params.Marker = aws.String(msg.GetPageMarker)
+		params.ContinuationToken = aws.String(msg.GetPageMarker)
+	} else if msg.GetStartAfter != "" {
+		params.StartAfter = aws.String(msg.GetStartAfter)
+	}
+	if msg.GetDelimiter != "" {
+		params.Delimiter = aws.String(msg.GetDelimiter)
 	}
 	if msg.GetPageSize != 0 {
 		if msg.GetPageSize > awsMaxPageSize {
@@ -179,33 +239,17 @@ func (awsimpl *awsimpl) listbucket(ct context.Context, bucket string, msg *GetMs
 		params.MaxKeys = aws.Int64(int64(msg.GetPageSize))
 	}
 
-	resp, err := svc.ListObjects(params)
+	resp, err := svc.ListObjectsV2(params)
 	if err != nil {
-		errstr = err.Error()
-		errcode = awsErrorToHTTP(err)
+		cerr = awsError(err, "Failed to list objects of bucket %s, err: %v", bucket, err)
 		return
 	}
 
-	verParams := &s3.ListObjectVersionsInput{Bucket: aws.String(bucket)}
-	if msg.GetPrefix != "" {
-		verParams.Prefix = aws.String(msg.GetPrefix)
-	}
-
-	var versions map[string]*string
+	var versions map[string]string
 	if strings.Contains(msg.GetProps, GetPropsVersion) {
-		verResp, err := svc.ListObjectVersions(verParams)
-		if err != nil {
-			errstr = err.Error()
-			errcode = awsErrorToHTTP(err)
+		if versions, cerr = awsimpl.versions(svc, bucket, resp.Contents); cerr != nil {
 			return
 		}
-
-		versions = make(map[string]*string, initialBucketListSize)
-		for _, vers := range verResp.Versions {
-			if *(vers.IsLatest) && awsIsVersionSet(vers.VersionId) {
-				versions[*(vers.Key)] = vers.VersionId
-			}
-		}
 	}
 
 	// var msg GetMsg
@@ -218,35 +262,34 @@ func (awsimpl *awsimpl) listbucket(ct context.Context, bucket string, msg *GetMs
 		}
 		if strings.Contains(msg.GetProps, GetPropsCtime) {
 			t := *(key.LastModified)
-			switch msg.GetTimeFormat {
-			case "":
-				fallthrough
-			case RFC822:
-				entry.Ctime = t.Format(time.RFC822)
-			default:
-				entry.Ctime = t.Format(msg.GetTimeFormat)
-			}
+			entry.Ctime = formatTime(t, msg.GetTimeFormat)
 		}
 		if strings.Contains(msg.GetProps, GetPropsChecksum) {
 			omd5, _ := strconv.Unquote(*key.ETag)
 			entry.Checksum = omd5
 		}
 		if strings.Contains(msg.GetProps, GetPropsVersion) {
-			if val, ok := versions[*(key.Key)]; ok && awsIsVersionSet(val) {
-				entry.Version = *val
+			entry.Version = versions[*(key.Key)]
+		}
+		if strings.Contains(msg.GetProps, GetPropsStorageClass) {
+			entry.StorageClass = s3.StorageClassStandard
+			if key.StorageClass != nil {
+				entry.StorageClass = *key.StorageClass
 			}
 		}
 		// TODO: other GetMsg props TBD
 		reslist.Entries = append(reslist.Entries, entry)
 	}
+	for _, prefix := range resp.CommonPrefixes {
+		reslist.CommonPrefixes = append(reslist.CommonPrefixes, *prefix.Prefix)
+	}
 	if glog.V(4) {
-		glog.Infof("listbucket count %d", len(reslist.Entries))
+		glog.Infof("listbucket count %d, prefixes %d", len(reslist.Entries), len(reslist.CommonPrefixes))
 	}
 
-	if *resp.IsTruncated {
-		// For AWS, resp.NextMarker is only set when a query has a delimiter.
-		// Without a delimiter, NextMarker should be the last returned key.
-		reslist.PageMarker = reslist.Entries[len(reslist.Entries)-1].Name
+	// the marker of the next page is the opaque continuation token
+	if aws.BoolValue(resp.IsTruncated) {
+		reslist.PageMarker = aws.StringValue(resp.NextContinuationToken)
 	}
 
 	jsbytes, err = json.Marshal(reslist)
@@ -254,7 +297,72 @@ func (awsimpl *awsimpl) listbucket(ct context.Context, bucket string, msg *GetMs
 	return
 }
 
-func (awsimpl *awsimpl) headbucket(ct context.Context, bucket string) (bucketprops simplekvs, errstr string, errcode int) {
+// versions returns the latest versions of the listed objects. The versions
+// are resolved lazily: not at all if versioning has never been enabled for
+// the bucket, and otherwise only for the objects of the page - by a pool of
+// at most awsVersionLookups workers sending HEAD requests. Objects deleted
+// since listed are skipped; the first other error stops the lookups
+func (awsimpl *awsimpl) versions(svc *s3.S3, bucket string, objects []*s3.Object) (map[string]string, *Error) {
+	versions := make(map[string]string, len(objects))
+	if len(objects) == 0 {
+		return versions, nil
+	}
+	result, err := svc.GetBucketVersioning(&s3.GetBucketVersioningInput{Bucket: aws.String(bucket)})
+	if err != nil {
+		return nil, awsError(err, "Failed to get versioning of bucket %s, err: %v", bucket, err)
+	}
+	if aws.StringValue(result.Status) == "" { // never versioned
+		return versions, nil
+	}
+
+	var (
+		keys    = make(chan string, len(objects))
+		mu      = &sync.Mutex{}
+		wg      = &sync.WaitGroup{}
+		cerr    *Error
+		workers = awsVersionLookups
+	)
+	for _, obj := range objects {
+		keys <- aws.StringValue(obj.Key)
+	}
+	close(keys)
+	if workers > len(objects) {
+		workers = len(objects)
+	}
+	lookup := func(key string) bool {
+		input := &s3.HeadObjectInput{Bucket: aws.String(bucket), Key: aws.String(key),
+			RequestPayer: awsimpl.requestPayer(bucket)}
+		headOutput, err := svc.HeadObject(input)
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			if e := awsError(err, "Failed to get the version of %s/%s, err: %v", bucket, key, err); e.Status != http.StatusNotFound && cerr == nil {
+				cerr = e
+			}
+		} else if awsIsVersionSet(headOutput.VersionId) {
+			versions[key] = *headOutput.VersionId
+		}
+		return cerr == nil
+	}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for key := range keys {
+				if !lookup(key) {
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if cerr != nil {
+		return nil, cerr
+	}
+	return versions, nil
+}
+
+func (awsimpl *awsimpl) headbucket(ct context.Context, bucket string) (bucketprops simplekvs, cerr *Error) {
 	if glog.V(4) {
 		glog.Infof("headbucket %s", bucket)
 	}
@@ -266,8 +374,7 @@ func (awsimpl *awsimpl) headbucket(ct context.Context, bucket string) (bucketpro
 
 	_, err := svc.HeadBucket(input)
 	if err != nil {
-		errcode = awsErrorToHTTP(err)
-		errstr = fmt.Sprintf("The bucket %s either does not exist or is not accessible, err: %v", bucket, err)
+		cerr = awsError(err, "The bucket %s either does not exist or is not accessible, err: %v", bucket, err)
 		return
 	}
 	bucketprops[CloudProvider] = ProviderAmazon
@@ -275,8 +382,7 @@ func (awsimpl *awsimpl) headbucket(ct context.Context, bucket string) (bucketpro
 	inputVers := &s3.GetBucketVersioningInput{Bucket: aws.String(bucket)}
 	result, err := svc.GetBucketVersioning(inputVers)
 	if err != nil {
-		errcode = awsErrorToHTTP(err)
-		errstr = fmt.Sprintf("The bucket %s either does not exist or is not accessible, err: %v", bucket, err)
+		cerr = awsError(err, "The bucket %s either does not exist or is not accessible, err: %v", bucket, err)
 	} else {
 		if result.Status != nil && *result.Status == s3.BucketVersioningStatusEnabled {
 			bucketprops[Versioning] = VersionCloud
@@ -284,16 +390,34 @@ func (awsimpl *awsimpl) headbucket(ct context.Context, bucket string) (bucketpro
 			bucketprops[Versioning] = VersionNone
 		}
 	}
+
+	// default encryption is optional information: reading it may be denied
+	bucketprops[CloudSSE] = "none"
+	inputEnc := &s3.GetBucketEncryptionInput{Bucket: aws.String(bucket)}
+	encResult, err := svc.GetBucketEncryption(inputEnc)
+	if err != nil {
+		if awsErr, ok := err.(awserr.Error); !ok || awsErr.Code() != awsNoEncryptionConfig {
+			glog.Warningf("Failed to read %s default encryption, err: %v", bucket, err)
+		}
+	} else if encResult.ServerSideEncryptionConfiguration != nil {
+		for _, rule := range encResult.ServerSideEncryptionConfiguration.Rules {
+			if rule.ApplyServerSideEncryptionByDefault == nil {
+				continue
+			}
+			bucketprops[CloudSSE] = aws.StringValue(rule.ApplyServerSideEncryptionByDefault.SSEAlgorithm)
+			bucketprops[CloudSSEKeyID] = aws.StringValue(rule.ApplyServerSideEncryptionByDefault.KMSMasterKeyID)
+			break
+		}
+	}
 	return
 }
 
-func (awsimpl *awsimpl) getbucketnames(ct context.Context) (buckets []string, errstr string, errcode int) {
+func (awsimpl *awsimpl) getbucketnames(ct context.Context) (buckets []string, cerr *Error) {
 	sess := createSession(ct)
 	svc := s3.New(sess)
 	result, err := svc.ListBuckets(&s3.ListBucketsInput{})
 	if err != nil {
-		errcode = awsErrorToHTTP(err)
-		errstr = fmt.Sprintf("Failed to list all buckets, err: %v", err)
+		cerr = awsError(err, "Failed to list all buckets, err: %v", err)
 		return
 	}
 	buckets = make([]string, 0, 16)
@@ -311,7 +435,7 @@ func (awsimpl *awsimpl) getbucketnames(ct context.Context) (buckets []string, er
 // object meta
 //
 //============
-func (awsimpl *awsimpl) headobject(ct context.Context, bucket string, objname string) (objmeta simplekvs, errstr string, errcode int) {
+func (awsimpl *awsimpl) headobject(ct context.Context, bucket string, objname string) (objmeta simplekvs, cerr *Error) {
 	if glog.V(4) {
 		glog.Infof("headobject %s/%s", bucket, objname)
 	}
@@ -319,18 +443,41 @@ func (awsimpl *awsimpl) headobject(ct context.Context, bucket string, objname st
 
 	sess := createSession(ct)
 	svc := s3.New(sess)
-	input := &s3.HeadObjectInput{Bucket: aws.String(bucket), Key: aws.String(objname)}
+	input := &s3.HeadObjectInput{Bucket: aws.String(bucket), Key: aws.String(objname),
+		RequestPayer: awsimpl.requestPayer(bucket)}
 
 	headOutput, err := svc.HeadObject(input)
 	if err != nil {
-		errcode = awsErrorToHTTP(err)
-		errstr = fmt.Sprintf("Failed to retrieve %s/%s metadata, err: %v", bucket, objname, err)
+		cerr = awsError(err, "Failed to retrieve %s/%s metadata, err: %v", bucket, objname, err)
 		return
 	}
 	objmeta[CloudProvider] = ProviderAmazon
+	objmeta[Size] = strconv.FormatInt(aws.Int64Value(headOutput.ContentLength), 10)
 	if awsIsVersionSet(headOutput.VersionId) {
 		objmeta["version"] = *headOutput.VersionId
 	}
+	if headOutput.ServerSideEncryption != nil {
+		objmeta[CloudSSE] = *headOutput.ServerSideEncryption
+		if headOutput.SSEKMSKeyId != nil {
+			objmeta[CloudSSEKeyID] = *headOutput.SSEKMSKeyId
+		}
+	}
+	// S3 does not return storage class for STANDARD objects
+	objmeta[StorageClass] = s3.StorageClassStandard
+	if headOutput.StorageClass != nil {
+		objmeta[StorageClass] = *headOutput.StorageClass
+	}
+	if headOutput.Restore != nil {
+		objmeta[Restore] = *headOutput.Restore
+	}
+	if v := awsDfcHash(headOutput.Metadata); v != nil {
+		objmeta[HeaderDfcChecksumType], objmeta[HeaderDfcChecksumVal] = v.get()
+	}
+	for k, v := range headOutput.Metadata {
+		if k != awsGetDfcHashType && k != awsGetDfcHashVal && v != nil {
+			objmeta[HeaderDfcMetaPrefix+strings.TrimPrefix(k, awsMetaPrefix)] = *v
+		}
+	}
 	return
 }
 
@@ -339,39 +486,34 @@ func (awsimpl *awsimpl) headobject(ct context.Context, bucket string, objname st
 // object data operations
 //
 //=======================
-func (awsimpl *awsimpl) getobj(ct context.Context, fqn, bucket, objname string) (props *objectProps, errstr string, errcode int) {
-	var v cksumvalue
+func (awsimpl *awsimpl) getobj(ct context.Context, fqn, bucket, objname string) (props *objectProps, cerr *Error) {
 	sess := createSession(ct)
 	svc := s3.New(sess)
+	if awsimpl.t.parallelColdGet(bucket) {
+		var done bool
+		if props, cerr, done = awsimpl.getobjParts(ct, svc, fqn, bucket, objname); done {
+			return
+		}
+	}
 	obj, err := svc.GetObject(&s3.GetObjectInput{
-		Bucket: aws.String(bucket),
-		Key:    aws.String(objname),
+		Bucket:       aws.String(bucket),
+		Key:          aws.String(objname),
+		RequestPayer: awsimpl.requestPayer(bucket),
 	})
 	if err != nil {
-		errcode = awsErrorToHTTP(err)
-		errstr = fmt.Sprintf("Failed to GET %s/%s, err: %v", bucket, objname, err)
+		cerr = awsGetError(err, bucket, objname)
 		return
 	}
-	// may not have dfc metadata
-	if htype, ok := obj.Metadata[awsGetDfcHashType]; ok {
-		if hval, ok := obj.Metadata[awsGetDfcHashVal]; ok {
-			v = newcksumvalue(*htype, *hval)
-		}
-	}
-	md5, _ := strconv.Unquote(*obj.ETag)
-	// FIXME: multipart
-	if strings.Contains(md5, awsMultipartDelim) {
-		if glog.V(3) {
-			glog.Infof("Warning: multipart object %s/%s - not validating checksum %s", bucket, objname, md5)
-		}
-		md5 = ""
-	}
+	v := awsDfcHash(obj.Metadata)
+	md5 := awsObjectMD5(bucket, objname, obj.ETag, obj.ServerSideEncryption)
 	props = &objectProps{}
 	if obj.VersionId != nil {
 		props.version = *obj.VersionId
 	}
-	if _, props.nhobj, props.size, errstr = awsimpl.t.receive(fqn, objname, md5, v, obj.Body); errstr != "" {
+	cksum := cloudCksum{kind: CloudCksumMD5, val: md5}
+	if errstr := awsimpl.t.receiveCloud(fqn, bucket, objname, cksum, v, obj.Body, props); errstr != "" {
 		obj.Body.Close()
+		cerr = errorFromStr(errstr, http.StatusInternalServerError)
 		return
 	}
 	if glog.V(4) {
@@ -381,7 +523,111 @@ func (awsimpl *awsimpl) getobj(ct context.Context, fqn, bucket, objname string)
 	return
 }
 
-func (awsimpl *awsimpl) putobj(ct context.Context, file *os.File, bucket, objname string, ohash cksumvalue) (version string, errstr string, errcode int) {
+// getobjrange reads the range of the object: S3 resolves it and returns
+// Content-Range - or InvalidRange (416) if it is not satisfiable
+func (awsimpl *awsimpl) getobjrange(ct context.Context, bucket, objname string, rng *httpRange) (rr *rangeReader, cerr *Error) {
+	svc := s3.New(createSession(ct))
+	obj, err := svc.GetObjectWithContext(ct, &s3.GetObjectInput{
+		Bucket:       aws.String(bucket),
+		Key:          aws.String(objname),
+		RequestPayer: awsimpl.requestPayer(bucket),
+		Range:        aws.String(rng.String()),
+	})
+	if err != nil {
+		return nil, awsGetError(err, bucket, objname)
+	}
+	rr = &rangeReader{ReadCloser: obj.Body, version: aws.StringValue(obj.VersionId)}
+	if obj.ContentRange == nil {
+		// the whole object
+		rr.length = aws.Int64Value(obj.ContentLength)
+		rr.size = rr.length
+		return
+	}
+	if rr.offset, rr.length, rr.size, err = parseContentRange(*obj.ContentRange); err != nil {
+		obj.Body.Close()
+		return nil, NewError(http.StatusInternalServerError, "GET %s/%s %s: %v", bucket, objname, rng, err)
+	}
+	return
+}
+
+// getobjParts downloads the object with concurrent range requests if the object
+// is larger than a part; otherwise, returns done = false without downloading
+func (awsimpl *awsimpl) getobjParts(ct context.Context, svc *s3.S3, fqn, bucket, objname string) (props *objectProps, cerr *Error, done bool) {
+	head, err := svc.HeadObject(&s3.HeadObjectInput{
+		Bucket:       aws.String(bucket),
+		Key:          aws.String(objname),
+		RequestPayer: awsimpl.requestPayer(bucket),
+	})
+	if err != nil {
+		return nil, awsError(err, "Failed to retrieve %s/%s metadata, err: %v", bucket, objname, err), true
+	}
+	size := aws.Int64Value(head.ContentLength)
+	if size <= ctx.config.ColdGet.PartSize {
+		return
+	}
+	props = &objectProps{}
+	if head.VersionId != nil {
+		props.version = *head.VersionId
+	}
+	cksum := cloudCksum{kind: CloudCksumMD5, val: awsObjectMD5(bucket, objname, head.ETag, head.ServerSideEncryption)}
+	// all parts must come from the same object: fail if it changes in the meantime
+	getpart := func(ct context.Context, offset, length int64) (io.ReadCloser, *Error) {
+		obj, err := svc.GetObjectWithContext(ct, &s3.GetObjectInput{
+			Bucket:       aws.String(bucket),
+			Key:          aws.String(objname),
+			RequestPayer: awsimpl.requestPayer(bucket),
+			Range:        aws.String(rangeHeader(offset, length)),
+			IfMatch:      head.ETag,
+		})
+		if err != nil {
+			return nil, awsGetError(err, bucket, objname)
+		}
+		return obj.Body, nil
+	}
+	cerr = awsimpl.t.receiveParts(ct, fqn, bucket, objname, size, cksum, awsDfcHash(head.Metadata), props, getpart)
+	if cerr == nil && glog.V(4) {
+		glog.Infof("GET %s/%s in parts, size %d", bucket, objname, size)
+	}
+	return props, cerr, true
+}
+
+func awsGetError(err error, bucket, objname string) *Error {
+	if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == awsInvalidObjectState {
+		return cloudError(ProviderAmazon, http.StatusConflict, awsInvalidObjectState,
+			"%s/%s is archived: restore it first (action %q), err: %v", bucket, objname, ActRestore, err)
+	}
+	return awsError(err, "Failed to GET %s/%s, err: %v", bucket, objname, err)
+}
+
+// DFC checksum of the object, if it was PUT by DFC
+func awsDfcHash(metadata map[string]*string) (v cksumvalue) {
+	// may not have dfc metadata
+	if htype, ok := metadata[awsGetDfcHashType]; ok {
+		if hval, ok := metadata[awsGetDfcHashVal]; ok {
+			v = newcksumvalue(*htype, *hval)
+		}
+	}
+	return
+}
+
+// MD5 of the object data from ETag, if the ETag is one
+func awsObjectMD5(bucket, objname string, etag, sse *string) string {
+	md5, _ := strconv.Unquote(aws.StringValue(etag))
+	// FIXME: multipart
+	if strings.Contains(md5, awsMultipartDelim) {
+		if glog.V(3) {
+			glog.Infof("Warning: multipart object %s/%s - not validating checksum %s", bucket, objname, md5)
+		}
+		return ""
+	}
+	// ETag of an object encrypted with SSE-KMS is not MD5 of the object data
+	if aws.StringValue(sse) == CloudSSEKMS {
+		return ""
+	}
+	return md5
+}
+
+func (awsimpl *awsimpl) putobj(ct context.Context, file io.Reader, bucket, objname string, ohash cksumvalue) (version string, cerr *Error) {
 	var (
 		err          error
 		htype, hval  string
@@ -394,17 +640,30 @@ func (awsimpl *awsimpl) putobj(ct context.Context, file *os.File, bucket, objnam
 		md[awsPutDfcHashType] = aws.String(htype)
 		md[awsPutDfcHashVal] = aws.String(hval)
 	}
-	sess := createSession(ct)
-	uploader := s3manager.NewUploader(sess)
-	uploadoutput, err = uploader.Upload(&s3manager.UploadInput{
+	input := &s3manager.UploadInput{
 		Bucket:   aws.String(bucket),
 		Key:      aws.String(objname),
 		Body:     file,
 		Metadata: md,
-	})
+	}
+	_, props := awsimpl.t.bmdowner.get().get(bucket, false)
+	if props.RequesterPays {
+		input.RequestPayer = aws.String(s3.RequestPayerRequester)
+	}
+	if props.StorageClass != "" {
+		input.StorageClass = aws.String(props.StorageClass)
+	}
+	if props.CloudSSE != "" {
+		input.ServerSideEncryption = aws.String(props.CloudSSE)
+		if props.CloudSSEKeyID != "" {
+			input.SSEKMSKeyId = aws.String(props.CloudSSEKeyID)
+		}
+	}
+	sess := createSession(ct)
+	uploader := s3manager.NewUploader(sess)
+	uploadoutput, err = uploader.Upload(input)
 	if err != nil {
-		errcode = awsErrorToHTTP(err)
-		errstr = fmt.Sprintf("Failed to PUT %s/%s, err: %v", bucket, objname, err)
+		cerr = awsError(err, "Failed to PUT %s/%s, err: %v", bucket, objname, err)
 		return
 	}
 	if glog.V(4) {
@@ -418,13 +677,34 @@ func (awsimpl *awsimpl) putobj(ct context.Context, file *os.File, bucket, objnam
 	return
 }
 
-func (awsimpl *awsimpl) deleteobj(ct context.Context, bucket, objname string) (errstr string, errcode int) {
+func (awsimpl *awsimpl) deleteobj(ct context.Context, bucket, objname string) (cerr *Error) {
 	sess := createSession(ct)
 	svc := s3.New(sess)
-	_, err := svc.DeleteObject(&s3.DeleteObjectInput{Bucket: aws.String(bucket), Key: aws.String(objname)})
+	// S3 has no conditional DELETE: the object is checked right before
+	if pc := preconditionFromContext(ct); pc != nil {
+		headOutput, err := svc.HeadObject(&s3.HeadObjectInput{Bucket: aws.String(bucket), Key: aws.String(objname),
+			RequestPayer: awsimpl.requestPayer(bucket)})
+		if err != nil {
+			cerr = awsError(err, "Failed to HEAD %s/%s, err: %v", bucket, objname, err)
+			return
+		}
+		st := &objstate{modified: aws.TimeValue(headOutput.LastModified)}
+		if awsIsVersionSet(headOutput.VersionId) {
+			st.version = *headOutput.VersionId
+		}
+		if v := awsDfcHash(headOutput.Metadata); v != nil {
+			_, hval := v.get()
+			st.cksums = append(st.cksums, hval)
+		}
+		st.cksums = append(st.cksums, awsObjectMD5(bucket, objname, headOutput.ETag, headOutput.ServerSideEncryption))
+		if cerr = pc.check(bucket, objname, st); cerr != nil {
+			return
+		}
+	}
+	_, err := svc.DeleteObject(&s3.DeleteObjectInput{Bucket: aws.String(bucket), Key: aws.String(objname),
+		RequestPayer: awsimpl.requestPayer(bucket)})
 	if err != nil {
-		errcode = awsErrorToHTTP(err)
-		errstr = fmt.Sprintf("Failed to DELETE %s/%s, err: %v", bucket, objname, err)
+		cerr = awsError(err, "Failed to DELETE %s/%s, err: %v", bucket, objname, err)
 		return
 	}
 	if glog.V(4) {
@@ -432,3 +712,35 @@ func (awsimpl *awsimpl) deleteobj(ct context.Context, bucket, objname string) (e
 	}
 	return
 }
+
+// Requests a temporary copy of an archived object. Restoring takes time:
+// HEAD object reports its status in Restore header
+func (awsimpl *awsimpl) restoreobj(ct context.Context, bucket, objname string, msg *RestoreMsg) (cerr *Error) {
+	tier := msg.Tier
+	if tier == "" {
+		tier = s3.TierStandard
+	}
+	if tier != s3.TierStandard && tier != s3.TierBulk && tier != s3.TierExpedited {
+		return NewError(http.StatusBadRequest, "Invalid restore tier: %s, must be one of (%s | %s | %s)",
+			tier, s3.TierStandard, s3.TierBulk, s3.TierExpedited)
+	}
+	sess := createSession(ct)
+	svc := s3.New(sess)
+	_, err := svc.RestoreObject(&s3.RestoreObjectInput{
+		Bucket:       aws.String(bucket),
+		Key:          aws.String(objname),
+		RequestPayer: awsimpl.requestPayer(bucket),
+		RestoreRequest: &s3.RestoreRequest{
+			Days:                 aws.Int64(msg.Days),
+			GlacierJobParameters: &s3.GlacierJobParameters{Tier: aws.String(tier)},
+		},
+	})
+	if err != nil {
+		cerr = awsError(err, "Failed to restore %s/%s, err: %v", bucket, objname, err)
+		return
+	}
+	if glog.V(4) {
+		glog.Infof("RESTORE %s/%s, %d days, tier %s", bucket, objname, msg.Days, tier)
+	}
+	return
+}
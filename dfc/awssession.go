@@ -0,0 +1,101 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// ============================= Background ==================================
+// Creating an AWS session loads the shared config and credentials files and
+// resolves the endpoints - too much to do for every GET, PUT and HEAD. The
+// target keeps the sessions, one per user ("" - the default session), and
+// reuses a session until:
+//   * awsSessionTTL expires, so that e.g. refreshed environment credentials
+//     are eventually picked up
+//   * the credentials change: the user presents other credentials, or the
+//     shared credentials or config file is modified (mtime) - for the default
+//     session
+// A session created with other credentials replaces (evicts) the user's
+// session right away; expired sessions are dropped upon the next creation.
+// ============================= Background ==================================
+
+const awsSessionTTL = 30 * time.Minute
+
+type (
+	awsSession struct {
+		sess    *session.Session
+		tag     string // identifies the credentials the session was created with
+		expires time.Time
+	}
+	awsSessionCache struct {
+		mtx      sync.Mutex
+		sessions map[string]*awsSession // user ID => session
+	}
+)
+
+var awsSessions = &awsSessionCache{}
+
+// get returns the cached session of the user created with the same
+// credentials or creates a new one
+func (sc *awsSessionCache) get(userID, tag string, create func() *session.Session) *session.Session {
+	sc.mtx.Lock()
+	defer sc.mtx.Unlock()
+	now := time.Now()
+	if s, ok := sc.sessions[userID]; ok && s.tag == tag && now.Before(s.expires) {
+		return s.sess
+	}
+	if sc.sessions == nil {
+		sc.sessions = make(map[string]*awsSession)
+	}
+	for id, s := range sc.sessions {
+		if !now.Before(s.expires) {
+			delete(sc.sessions, id)
+		}
+	}
+	s := &awsSession{sess: create(), tag: tag, expires: now.Add(awsSessionTTL)}
+	sc.sessions[userID] = s
+	return s.sess
+}
+
+// awsUserTag identifies the credentials of a user
+func awsUserTag(creds *awsCreds) string {
+	sum := sha256.Sum256([]byte(creds.region + "\n" + creds.key + "\n" + creds.secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// awsSharedFilesTag identifies the versions of the shared credentials and
+// config files the default session is created with
+func awsSharedFilesTag() string {
+	var (
+		home  = os.Getenv("HOME")
+		creds = os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+		conf  = os.Getenv("AWS_CONFIG_FILE")
+		tag   string
+	)
+	if creds == "" {
+		creds = filepath.Join(home, ".aws", "credentials")
+	}
+	if conf == "" {
+		conf = filepath.Join(home, ".aws", "config")
+	}
+	for _, fname := range []string{creds, conf} {
+		if finfo, err := os.Stat(fname); err == nil {
+			tag += fmt.Sprintf("%s:%d:%d;", fname, finfo.ModTime().UnixNano(), finfo.Size())
+		} else {
+			tag += fname + ";"
+		}
+	}
+	return tag
+}
@@ -0,0 +1,79 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+func TestAWSSessionCache(t *testing.T) {
+	var (
+		sc      = &awsSessionCache{}
+		created int
+	)
+	create := func() *session.Session {
+		created++
+		return &session.Session{}
+	}
+	s1 := sc.get("user", "creds1", create)
+	if s2 := sc.get("user", "creds1", create); s2 != s1 || created != 1 {
+		t.Fatalf("Expected the session to be reused, created %d", created)
+	}
+	if sc.get("other", "creds1", create); created != 2 {
+		t.Fatalf("Expected a session per user, created %d", created)
+	}
+	// other credentials evict the session
+	if s3 := sc.get("user", "creds2", create); s3 == s1 || created != 3 {
+		t.Fatalf("Expected a new session for new credentials, created %d", created)
+	}
+	// expired sessions are recreated and dropped
+	sc.sessions["other"].expires = time.Now().Add(-time.Second)
+	sc.get("user", "creds2", create)
+	if _, ok := sc.sessions["other"]; !ok || created != 3 {
+		t.Fatalf("Expected the expired session to stay until the next creation, created %d", created)
+	}
+	sc.get("third", "creds1", create)
+	if _, ok := sc.sessions["other"]; ok || created != 4 {
+		t.Fatalf("Expected the expired session to be dropped, created %d", created)
+	}
+	if sc.get("other", "creds1", create); created != 5 {
+		t.Fatalf("Expected the expired session to be recreated, created %d", created)
+	}
+}
+
+func TestAWSSharedFilesTag(t *testing.T) {
+	dir, err := ioutil.TempDir("", "awscreds")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fname := filepath.Join(dir, "credentials")
+	defer os.Setenv("AWS_SHARED_CREDENTIALS_FILE", os.Getenv("AWS_SHARED_CREDENTIALS_FILE"))
+	os.Setenv("AWS_SHARED_CREDENTIALS_FILE", fname)
+
+	missing := awsSharedFilesTag()
+	if err = ioutil.WriteFile(fname, []byte("[default]\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	created := awsSharedFilesTag()
+	if created == missing {
+		t.Fatal("Expected the tag to change when the credentials file is created")
+	}
+	if err = os.Chtimes(fname, time.Now(), time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if modified := awsSharedFilesTag(); modified == created {
+		t.Error("Expected the tag to change when the credentials file is modified")
+	}
+	if awsUserTag(&awsCreds{"us-east-1", "key", "secret"}) == awsUserTag(&awsCreds{"us-east-1", "key", "secret2"}) {
+		t.Error("Expected the tag to change with the credentials")
+	}
+}
@@ -0,0 +1,488 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NVIDIA/dfcpub/3rdparty/glog"
+	"github.com/OneOfOne/xxhash"
+)
+
+// Bucket backup. Upon POST {"action": "backup"} /v1/buckets/bucket-name each
+// target copies the objects of the local bucket it stores to the Cloud bucket
+// BackupMsg.Bucket, object <name> as <prefix><name>, and records the copies -
+// names, sizes, xxhash checksums and Cloud versions - in its manifest, Cloud
+// object <prefix>.dfc-backup/<target-ID>.json (see BackupManifest). An
+// incremental backup copies only the objects whose checksums differ from the
+// ones recorded by the manifests of all targets, so that objects moved by
+// rebalance are not copied again. Upon POST {"action": "restorebackup"} each
+// target lists the Cloud bucket and copies into the local bucket the objects
+// it owns (HRW), verifying them against the manifests; an incremental restore
+// skips the objects whose local copies have the recorded checksums. Backup
+// never deletes Cloud objects, and restore never deletes local ones.
+//
+// One backup or restore runs at a time per target, in the background. Its
+// progress and results are returned by GET /v1/daemon?what=backup and, for all
+// targets, by GET /v1/cluster?what=backup; POST {"action": "backupstop"}
+// aborts it.
+
+const (
+	backupname        = "backup.json"
+	backupManifestDir = ".dfc-backup/" // <prefix>.dfc-backup/<target-ID>.json
+)
+
+func parseBackupMsg(bucket string, msg *ActionMsg) (*BackupMsg, error) {
+	bakmsg := &BackupMsg{}
+	if msg.Value != nil {
+		b, err := json.Marshal(msg.Value)
+		if err == nil {
+			err = json.Unmarshal(b, bakmsg)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Invalid %s parameters %v, err: %v", msg.Action, msg.Value, err)
+		}
+	}
+	if bakmsg.Bucket == "" {
+		return nil, fmt.Errorf("%s requires the Cloud bucket", msg.Action)
+	}
+	if bakmsg.Bucket == bucket {
+		return nil, fmt.Errorf("Cannot %s bucket %s to itself", msg.Action, bucket)
+	}
+	if bakmsg.Prefix == "" {
+		bakmsg.Prefix = bucket + "/"
+	}
+	return bakmsg, nil
+}
+
+func backupManifestName(prefix, daemonID string) string {
+	return prefix + backupManifestDir + daemonID + ".json"
+}
+
+//
+// target
+//
+
+// startBackup starts the backup or the restore in the background
+func (t *targetrunner) startBackup(w http.ResponseWriter, r *http.Request, msg *ActionMsg) {
+	apitems := t.restAPIItems(r.URL.Path, 5)
+	if apitems = t.checkRestAPI(w, r, apitems, 1, Rversion, Rbuckets); apitems == nil {
+		return
+	}
+	bucket := apitems[0]
+	bakmsg, err := parseBackupMsg(bucket, msg)
+	if err != nil {
+		t.invalmsghdlr(w, r, err.Error())
+		return
+	}
+	bucketmd := t.bmdowner.get()
+	if !bucketmd.islocal(bucket) {
+		t.invalmsghdlr(w, r, fmt.Sprintf("Cannot %s %s: not a local bucket", msg.Action, bucket))
+		return
+	}
+	if bucketmd.islocal(bakmsg.Bucket) {
+		t.invalmsghdlr(w, r, fmt.Sprintf("Cannot %s %s: %s is not a Cloud bucket", msg.Action, bucket, bakmsg.Bucket))
+		return
+	}
+	xbak, errstr := t.xactinp.renewBackup(t, msg.Action, bucket, bakmsg)
+	if errstr != "" {
+		t.invalmsghdlr(w, r, errstr, http.StatusConflict)
+		return
+	}
+	if msg.Action == ActBackup {
+		go t.runBackup(xbak)
+	} else {
+		go t.runRestore(xbak)
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// stopBackup aborts the backup or the restore of the bucket, if any
+func (t *targetrunner) stopBackup(w http.ResponseWriter, r *http.Request) {
+	apitems := t.restAPIItems(r.URL.Path, 5)
+	if apitems = t.checkRestAPI(w, r, apitems, 1, Rversion, Rbuckets); apitems == nil {
+		return
+	}
+	if xbak := t.xactinp.abortBackup(apitems[0]); xbak != nil {
+		glog.Infof("%s: aborting", xbak.tostring())
+	}
+}
+
+func newBackupResult(t *targetrunner, kind, bucket string, msg *BackupMsg) *BackupResult {
+	result := &BackupResult{Action: kind, Bucket: bucket, CloudBucket: msg.Bucket, Prefix: msg.Prefix,
+		Incremental: msg.Incremental, Started: time.Now()}
+	if t.si != nil {
+		result.DaemonID = t.si.DaemonID
+	}
+	return result
+}
+
+func (t *targetrunner) runBackup(xbak *xactBackup) *BackupResult {
+	glog.Infoln(xbak.tostring())
+	var (
+		ct       = context.Background()
+		msg      = xbak.msg
+		objects  []*RawObject
+		manifest = &BackupManifest{DaemonID: t.si.DaemonID, Bucket: xbak.bucket, CloudBucket: msg.Bucket,
+			Prefix: msg.Prefix, Objects: make(map[string]*BackupObject)}
+	)
+	// the previous backups: to compare with (incremental) and to keep the
+	// records of if aborted
+	backups, err := t.loadBackupManifests(ct, msg)
+	if err != nil {
+		xbak.failed(err.Error())
+		return t.finishBackup(xbak)
+	}
+	err = t.walkObjects(xbak.bucket, "", func(obj *RawObject) bool {
+		if obj.IsLocal {
+			objects = append(objects, obj)
+		}
+		return true
+	})
+	if err != nil {
+		xbak.failed(fmt.Sprintf("Failed to traverse %s, err: %v", xbak.bucket, err))
+		return t.finishBackup(xbak)
+	}
+	xbak.mu.Lock()
+	xbak.result.Objects = int64(len(objects))
+	xbak.mu.Unlock()
+
+	for i, obj := range objects {
+		if xbak.aborted() {
+			xbak.failed(fmt.Sprintf("%s aborted", xbak.tostring()))
+			// keep the records of the objects not visited
+			for _, obj := range objects[i:] {
+				if backup, ok := backups[obj.Name]; ok {
+					manifest.Objects[obj.Name] = backup
+				}
+			}
+			break
+		}
+		if strings.HasPrefix(obj.Name, backupManifestDir) {
+			xbak.failed(fmt.Sprintf("Skipping %s: %s is reserved for the backup manifests", obj.Name, backupManifestDir))
+			continue
+		}
+		var prev *BackupObject
+		if msg.Incremental {
+			prev = backups[obj.Name]
+		}
+		backup, copied, err := t.backupObject(ct, xbak, obj, prev)
+		if err != nil {
+			xbak.failed(err.Error())
+			continue
+		}
+		if backup == nil { // deleted in the meantime
+			continue
+		}
+		manifest.Objects[obj.Name] = backup
+		xbak.progress(copied, backup.Size)
+	}
+
+	manifest.Time = time.Now()
+	jsbytes, err := json.Marshal(manifest)
+	assert(err == nil, err)
+	mname := backupManifestName(msg.Prefix, t.si.DaemonID)
+	if _, cerr := t.cloudif.putobj(ct, bytes.NewReader(jsbytes), msg.Bucket, mname, nil); cerr != nil {
+		xbak.failed(fmt.Sprintf("Failed to store manifest %s/%s, err: %v", msg.Bucket, mname, cerr))
+	}
+	return t.finishBackup(xbak)
+}
+
+// backupObject copies the object to the Cloud bucket unless its previous
+// backup has the same checksum; returns nil if the object does not exist
+func (t *targetrunner) backupObject(ct context.Context, xbak *xactBackup, obj *RawObject,
+	prev *BackupObject) (backup *BackupObject, copied bool, err error) {
+	uname := uniquename(xbak.bucket, obj.Name)
+	t.rtnamemap.lockname(uname, false, &pendinginfo{Time: time.Now(), fqn: obj.FQN}, time.Second)
+	defer t.rtnamemap.unlockname(uname, false)
+
+	if csekhash, _ := Getxattr(obj.FQN, XattrCustomerKeyHash); csekhash != nil {
+		return nil, false, fmt.Errorf("Skipping %s: protected with a customer-supplied key", obj.Name)
+	}
+	reader, size, err := openObject(obj.FQN)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("Failed to read %s, err: %v", obj.FQN, err)
+	}
+	defer reader.Close()
+	backup = &BackupObject{Name: xbak.msg.Prefix + obj.Name, Size: size}
+	if val, _ := Getxattr(obj.FQN, XattrXXHashVal); val != nil {
+		backup.Checksum = string(val)
+	} else {
+		// checksumming is disabled, or the object predates it
+		var errstr string
+		slab := selectslab(size)
+		buf := slab.alloc()
+		backup.Checksum, errstr = ComputeXXHash(reader, buf, xxhash.New64())
+		slab.free(buf)
+		if errstr != "" {
+			return nil, false, fmt.Errorf("Failed to checksum %s: %s", obj.FQN, errstr)
+		}
+		if _, err = reader.Seek(0, io.SeekStart); err != nil {
+			return nil, false, fmt.Errorf("Unexpected fseek failure when reading %s, err: %v", obj.FQN, err)
+		}
+	}
+	if prev != nil && prev.Size == backup.Size && prev.Checksum == backup.Checksum {
+		return prev, false, nil
+	}
+	cksum := newcksumvalue(ChecksumXXHash, backup.Checksum)
+	version, cerr := t.cloudif.putobj(ct, reader, xbak.msg.Bucket, backup.Name, cksum)
+	if cerr != nil {
+		return nil, false, fmt.Errorf("Failed to back up %s as %s/%s, err: %v", obj.Name, xbak.msg.Bucket, backup.Name, cerr)
+	}
+	backup.Version, backup.Time = version, time.Now()
+	return backup, true, nil
+}
+
+func (t *targetrunner) runRestore(xbak *xactBackup) *BackupResult {
+	glog.Infoln(xbak.tostring())
+	var (
+		ct     = context.Background()
+		msg    = xbak.msg
+		smap   = t.smapowner.get()
+		getmsg = &GetMsg{GetPrefix: msg.Prefix, GetProps: GetPropsSize}
+	)
+	backups, err := t.loadBackupManifests(ct, msg)
+	if err != nil {
+		xbak.failed(err.Error())
+		return t.finishBackup(xbak)
+	}
+pages:
+	for {
+		jsbytes, cerr := t.cloudif.listbucket(ct, msg.Bucket, getmsg)
+		if cerr != nil {
+			xbak.failed(fmt.Sprintf("Failed to list %s, err: %v", msg.Bucket, cerr))
+			break
+		}
+		reslist := &BucketList{}
+		if err = json.Unmarshal(jsbytes, reslist); err != nil {
+			xbak.failed(fmt.Sprintf("Failed to unmarshal the list of %s, err: %v", msg.Bucket, err))
+			break
+		}
+		for _, entry := range reslist.Entries {
+			if xbak.aborted() {
+				xbak.failed(fmt.Sprintf("%s aborted", xbak.tostring()))
+				break pages
+			}
+			name := strings.TrimPrefix(entry.Name, msg.Prefix)
+			if name == "" || strings.HasSuffix(name, "/") || strings.HasPrefix(name, backupManifestDir) {
+				continue
+			}
+			si, errstr := HrwTarget(xbak.bucket, name, smap)
+			if errstr != "" {
+				xbak.failed(errstr)
+				break pages
+			}
+			if si.DaemonID != t.si.DaemonID {
+				continue
+			}
+			xbak.mu.Lock()
+			xbak.result.Objects++
+			xbak.mu.Unlock()
+			copied, size, err := t.restoreObject(ct, xbak, name, entry.Name, backups[name])
+			if err != nil {
+				xbak.failed(err.Error())
+				continue
+			}
+			xbak.progress(copied, size)
+		}
+		if reslist.PageMarker == "" {
+			break
+		}
+		getmsg.GetPageMarker = reslist.PageMarker
+	}
+	return t.finishBackup(xbak)
+}
+
+// restoreObject copies the Cloud object into the local bucket unless the
+// local copy has the checksum of the backup; returns the size copied
+func (t *targetrunner) restoreObject(ct context.Context, xbak *xactBackup, name, cloudname string,
+	backup *BackupObject) (copied bool, size int64, err error) {
+	bucket := xbak.bucket
+	if xbak.msg.Incremental && backup != nil {
+		if val, _ := Getxattr(t.lookupfqn(bucket, name, true), XattrXXHashVal); val != nil && string(val) == backup.Checksum {
+			return false, 0, nil
+		}
+	}
+	fqn, hrwmpath := t.placefqn(bucket, name, true)
+	putfqn := t.fqn2workfile(fqn)
+	props, cerr := t.cloudif.getobj(ct, putfqn, xbak.msg.Bucket, cloudname)
+	if cerr != nil {
+		os.Remove(putfqn)
+		return false, 0, fmt.Errorf("Failed to restore %s from %s/%s, err: %v", name, xbak.msg.Bucket, cloudname, cerr)
+	}
+	if backup != nil && props.nhobj != nil {
+		if _, val := props.nhobj.get(); val != backup.Checksum {
+			os.Remove(putfqn)
+			return false, 0, fmt.Errorf("Failed to restore %s: %s/%s has checksum %s, the backup - %s",
+				name, xbak.msg.Bucket, cloudname, val, backup.Checksum)
+		}
+	}
+	props.version, props.displaced = "", hrwmpath // the Cloud version does not apply to the local bucket
+	if errstr, _ := t.putCommit(ct, bucket, name, putfqn, fqn, props, false /*rebalance*/); errstr != "" {
+		return false, 0, errors.New(errstr)
+	}
+	return true, props.size, nil
+}
+
+// loadBackupManifests returns the latest backups of the objects recorded by
+// the manifests of all targets, by object name
+func (t *targetrunner) loadBackupManifests(ct context.Context, msg *BackupMsg) (map[string]*BackupObject, error) {
+	backups := make(map[string]*BackupObject)
+	list, _, err := t.getListFromRangeCloud(ct, msg.Bucket, &GetMsg{GetPrefix: msg.Prefix + backupManifestDir})
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range list.Entries {
+		manifest, err := t.loadBackupManifest(ct, msg.Bucket, entry.Name)
+		if err != nil {
+			return nil, err
+		}
+		for name, backup := range manifest.Objects {
+			if prev, ok := backups[name]; !ok || prev.Time.Before(backup.Time) {
+				backups[name] = backup
+			}
+		}
+	}
+	return backups, nil
+}
+
+func (t *targetrunner) loadBackupManifest(ct context.Context, bucket, objname string) (*BackupManifest, error) {
+	var workfqn string
+	// any mountpath's work directory - orphans are removed at startup
+	for mpath := range ctx.mountpaths.Available {
+		workfqn = filepath.Join(mpath, mpathWorkDir, ActBackup+"-"+strings.Replace(objname, "/", "_", -1))
+		break
+	}
+	if workfqn == "" {
+		return nil, fmt.Errorf("No mountpaths to load manifest %s", objname)
+	}
+	defer os.Remove(workfqn)
+	if _, cerr := t.cloudif.getobj(ct, workfqn, bucket, objname); cerr != nil {
+		return nil, fmt.Errorf("Failed to load manifest %s/%s, err: %v", bucket, objname, cerr)
+	}
+	reader, _, err := openObject(workfqn)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read manifest %s/%s, err: %v", bucket, objname, err)
+	}
+	defer reader.Close()
+	manifest := &BackupManifest{}
+	if err = json.NewDecoder(reader).Decode(manifest); err != nil {
+		return nil, fmt.Errorf("Invalid manifest %s/%s, err: %v", bucket, objname, err)
+	}
+	return manifest, nil
+}
+
+func (t *targetrunner) finishBackup(xbak *xactBackup) *BackupResult {
+	xbak.mu.Lock()
+	result := xbak.result
+	result.Finished = time.Now()
+	result.Aborted = xbak.aborted()
+	xbak.mu.Unlock()
+	if err := LocalSave(filepath.Join(ctx.config.Confdir, backupname), result); err != nil {
+		glog.Errorf("Failed to store the %s results, err: %v", xbak.kind, err)
+	}
+	xbak.etime = time.Now()
+	glog.Infof("%s: %d objects, %d copied (%d bytes), %d skipped, %d errors", xbak.tostring(),
+		result.Objects, result.Copied, result.Bytes, result.Skipped, len(result.Errors))
+	t.xactinp.del(xbak.id)
+	return result
+}
+
+func (xact *xactBackup) failed(errstr string) {
+	glog.Errorf("%s: %s", xact.tostring(), errstr)
+	xact.mu.Lock()
+	xact.result.Errors = append(xact.result.Errors, errstr)
+	xact.mu.Unlock()
+}
+
+func (xact *xactBackup) progress(copied bool, size int64) {
+	xact.mu.Lock()
+	if copied {
+		xact.result.Copied++
+		xact.result.Bytes += size
+	} else {
+		xact.result.Skipped++
+	}
+	xact.mu.Unlock()
+}
+
+// backupResult returns the progress of the running backup or restore, if
+// any, or else the results of the last one; nil if none
+func (t *targetrunner) backupResult() (*BackupResult, error) {
+	for _, kind := range []string{ActBackup, ActRestoreBak} {
+		if _, xx := t.xactinp.findL(kind); xx != nil {
+			xbak := xx.(*xactBackup)
+			xbak.mu.Lock()
+			result := *xbak.result
+			result.Errors = append([]string{}, xbak.result.Errors...)
+			xbak.mu.Unlock()
+			return &result, nil
+		}
+	}
+	result := &BackupResult{}
+	if err := LocalLoad(filepath.Join(ctx.config.Confdir, backupname), result); err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return result, nil
+}
+
+//
+// proxy
+//
+
+// backupBucket starts (or aborts) the backup or the restore at all targets
+func (p *proxyrunner) backupBucket(w http.ResponseWriter, r *http.Request, bucket string, msg *ActionMsg) {
+	bucketmd := p.bmdowner.get()
+	if !bucketmd.islocal(bucket) {
+		p.invalmsghdlr(w, r, fmt.Sprintf("Cannot %s %s: not a local bucket", msg.Action, bucket))
+		return
+	}
+	if msg.Action != ActBackupStop {
+		bakmsg, err := parseBackupMsg(bucket, msg)
+		if err != nil {
+			p.invalmsghdlr(w, r, err.Error())
+			return
+		}
+		if bucketmd.islocal(bakmsg.Bucket) {
+			p.invalmsghdlr(w, r, fmt.Sprintf("Cannot %s %s: %s is not a Cloud bucket", msg.Action, bucket, bakmsg.Bucket))
+			return
+		}
+	}
+	jsbytes, err := json.Marshal(msg)
+	assert(err == nil, err)
+	q := url.Values{}
+	q.Set(URLParamLocal, strconv.FormatBool(true))
+	results := p.broadcastTargets(URLPath(Rversion, Rbuckets, bucket), q, http.MethodPost, jsbytes,
+		p.smapowner.get(), ctx.config.Timeout.Default)
+	for res := range results {
+		if res.err != nil {
+			p.invalmsghdlr(w, r, fmt.Sprintf("Failed to %s at %s: %v (%d: %s)",
+				msg.Action, res.si.DaemonID, res.err, res.status, res.errstr))
+			return
+		}
+	}
+	if msg.Action != ActBackupStop {
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
@@ -0,0 +1,129 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ */
+package dfc
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBackupRestore(t *testing.T) {
+	const bucket, cloudbucket = "backupbucket", "cloudbucket"
+	dir, err := ioutil.TempDir("", "backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	mpath := filepath.Join(dir, "mpath")
+	oldavail, oldconfdir, oldcksum := ctx.mountpaths.Available, ctx.config.Confdir, ctx.config.Cksum
+	defer func() {
+		ctx.mountpaths.Available, ctx.config.Confdir, ctx.config.Cksum = oldavail, oldconfdir, oldcksum
+	}()
+	ctx.mountpaths.Available = map[string]*mountPath{mpath: {Path: mpath}}
+	ctx.config.Confdir = dir
+	ctx.config.Cksum.Checksum = ChecksumXXHash
+
+	target, m := newTestTarget(map[string]BucketProps{bucket: {}}, cloudbucket)
+
+	objects := make(map[string]string)
+	for i := 0; i < 5; i++ {
+		objects[fmt.Sprintf("train/%d.jpg", i)] = fmt.Sprintf("%0100d", i)
+	}
+	write := func(name string) {
+		fqn := target.fqn(bucket, name, true)
+		os.Remove(fqn) // with its extended attributes
+		if err := CreateDir(filepath.Dir(fqn)); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(fqn, []byte(objects[name]), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name := range objects {
+		write(name)
+	}
+	start := func(kind string, incremental bool) *xactBackup {
+		value := map[string]interface{}{"bucket": cloudbucket, "incremental": incremental}
+		bakmsg, err := parseBackupMsg(bucket, &ActionMsg{Action: kind, Value: value})
+		if err != nil {
+			t.Fatal(err)
+		}
+		xbak, errstr := target.xactinp.renewBackup(target, kind, bucket, bakmsg)
+		if errstr != "" {
+			t.Fatal(errstr)
+		}
+		return xbak
+	}
+
+	result := target.runBackup(start(ActBackup, false))
+	if result.Objects != 5 || result.Copied != 5 || result.Bytes != 500 || len(result.Errors) != 0 {
+		t.Fatalf("Unexpected backup result %+v", result)
+	}
+	for name, data := range objects {
+		m.mtx.Lock()
+		obj, cerr := m.lookup(cloudbucket, bucket+"/"+name)
+		m.mtx.Unlock()
+		if cerr != nil || string(obj.data) != data {
+			t.Errorf("Expected %s to be backed up as %s/%s, err: %v", name, bucket, name, cerr)
+		}
+	}
+
+	// incremental: the modified object and the manifest
+	objects["train/0.jpg"] = "modified"
+	write("train/0.jpg")
+	puts := m.numCalls("putobj")
+	result = target.runBackup(start(ActBackup, true))
+	if result.Copied != 1 || result.Skipped != 4 || result.Bytes != 8 || len(result.Errors) != 0 {
+		t.Fatalf("Unexpected incremental backup result %+v", result)
+	}
+	if n := m.numCalls("putobj") - puts; n != 2 {
+		t.Errorf("Expected 2 PUTs, got %d", n)
+	}
+
+	for name := range objects {
+		os.Remove(target.fqn(bucket, name, true))
+	}
+	result = target.runRestore(start(ActRestoreBak, false))
+	if result.Objects != 5 || result.Copied != 5 || result.Bytes != 408 || len(result.Errors) != 0 {
+		t.Fatalf("Unexpected restore result %+v", result)
+	}
+	for name, data := range objects {
+		if b, err := ioutil.ReadFile(target.fqn(bucket, name, true)); err != nil || string(b) != data {
+			t.Errorf("Expected %s to be restored, err: %v", name, err)
+		}
+	}
+
+	// aborted backup keeps the records of the objects it has not visited
+	xbak := start(ActBackup, false)
+	target.xactinp.abortBackup(bucket)
+	if result = target.runBackup(xbak); !result.Aborted || result.Copied != 0 {
+		t.Errorf("Expected the backup to be aborted, got %+v", result)
+	}
+	if result, err = target.backupResult(); err != nil || result == nil || !result.Aborted {
+		t.Errorf("Expected the stored results of the aborted backup, got %+v, err: %v", result, err)
+	}
+	backups, err := target.loadBackupManifests(context.Background(), xbak.msg)
+	if err != nil || len(backups) != 5 {
+		t.Errorf("Expected 5 objects in the manifest, got %d, err: %v", len(backups), err)
+	}
+
+	// incremental restore skips the objects with the checksums of the backup
+	if val, _ := Getxattr(target.fqn(bucket, "train/1.jpg", true), XattrXXHashVal); val == nil {
+		t.Skip("Extended attributes are not supported")
+	}
+	objects["train/1.jpg"] = "local change"
+	write("train/1.jpg")
+	result = target.runRestore(start(ActRestoreBak, true))
+	if result.Copied != 1 || result.Skipped != 4 || len(result.Errors) != 0 {
+		t.Fatalf("Unexpected incremental restore result %+v", result)
+	}
+
+	if _, err = parseBackupMsg(bucket, &ActionMsg{Action: ActBackup}); err == nil {
+		t.Error("Expected backup without the Cloud bucket to be invalid")
+	}
+}
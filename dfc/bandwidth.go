@@ -0,0 +1,231 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// ============================= Bandwidth shaping ===========================
+// A bucket can limit the bandwidth its objects are read (GET, egress) and
+// written (PUT, ingress) with at each target: see BucketProps.EgressLimit and
+// IngressLimit. Each limited bucket and direction gets a token bucket that
+// refills at the limit, in bytes per second, and holds up to one second
+// worth of tokens. Readers and writers of the objects take tokens for every
+// chunk of data they move and sleep when the bucket runs dry. Intra-cluster
+// traffic (rebalance and other target-to-target transfers) is not shaped.
+// ============================= Bandwidth shaping ===========================
+
+const minShapingChunk = 64 * KiB
+
+// BandwidthStats is the bandwidth of a limited bucket at a target, in bytes
+// per second, averaged over the stats interval
+type BandwidthStats struct {
+	IngressLimit int64 `json:"ingress_limit"`
+	Ingress      int64 `json:"ingress"`
+	EgressLimit  int64 `json:"egress_limit"`
+	Egress       int64 `json:"egress"`
+}
+
+type tokenBucket struct {
+	mtx    sync.Mutex
+	rate   int64   // bytes per second
+	tokens float64 // negative when owed by the waiting callers
+	last   time.Time
+	total  int64 // bytes passed, for the stats
+	// stats snapshot
+	prevTotal int64
+	prevTime  time.Time
+}
+
+type bandwidthShapers struct {
+	mtx     sync.Mutex
+	ingress map[string]*tokenBucket // by bucket
+	egress  map[string]*tokenBucket
+}
+
+func newTokenBucket(rate int64) *tokenBucket {
+	now := time.Now()
+	return &tokenBucket{rate: rate, tokens: float64(rate), last: now, prevTime: now}
+}
+
+// chunk is the max amount of data to move between takes
+func (tb *tokenBucket) chunk() int {
+	tb.mtx.Lock()
+	n := tb.rate
+	tb.mtx.Unlock()
+	if n < minShapingChunk {
+		n = minShapingChunk
+	}
+	return int(n)
+}
+
+// take blocks until n bytes can pass
+func (tb *tokenBucket) take(n int) {
+	tb.mtx.Lock()
+	now := time.Now()
+	tb.tokens += now.Sub(tb.last).Seconds() * float64(tb.rate)
+	if tb.tokens > float64(tb.rate) {
+		tb.tokens = float64(tb.rate)
+	}
+	tb.last = now
+	tb.tokens -= float64(n)
+	tb.total += int64(n)
+	var wait time.Duration
+	if tb.tokens < 0 {
+		wait = time.Duration(-tb.tokens / float64(tb.rate) * float64(time.Second))
+	}
+	tb.mtx.Unlock()
+	if wait > 0 {
+		time.Sleep(wait)
+	}
+}
+
+func (tb *tokenBucket) setRate(rate int64) {
+	tb.mtx.Lock()
+	tb.rate = rate
+	tb.mtx.Unlock()
+}
+
+// usage returns the bytes per second passed since the previous call
+func (tb *tokenBucket) usage(now time.Time) (limit, rate int64) {
+	tb.mtx.Lock()
+	defer tb.mtx.Unlock()
+	if elapsed := now.Sub(tb.prevTime).Seconds(); elapsed > 0 {
+		rate = int64(float64(tb.total-tb.prevTotal) / elapsed)
+	}
+	tb.prevTotal, tb.prevTime = tb.total, now
+	return tb.rate, rate
+}
+
+// get returns the token bucket for the bucket's limit, nil if not limited
+func (s *bandwidthShapers) get(bucket string, limit int64, ingress bool) *tokenBucket {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.ingress == nil {
+		s.ingress = make(map[string]*tokenBucket)
+		s.egress = make(map[string]*tokenBucket)
+	}
+	m := s.egress
+	if ingress {
+		m = s.ingress
+	}
+	tb, ok := m[bucket]
+	if limit <= 0 {
+		if ok {
+			delete(m, bucket)
+		}
+		return nil
+	}
+	if !ok {
+		tb = newTokenBucket(limit)
+		m[bucket] = tb
+	} else {
+		tb.setRate(limit)
+	}
+	return tb
+}
+
+// stats returns the current usage of the limited buckets
+func (s *bandwidthShapers) stats() map[string]*BandwidthStats {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if len(s.ingress) == 0 && len(s.egress) == 0 {
+		return nil
+	}
+	var (
+		now   = time.Now()
+		stats = make(map[string]*BandwidthStats, len(s.ingress)+len(s.egress))
+	)
+	for bucket, tb := range s.ingress {
+		st := &BandwidthStats{}
+		st.IngressLimit, st.Ingress = tb.usage(now)
+		stats[bucket] = st
+	}
+	for bucket, tb := range s.egress {
+		st, ok := stats[bucket]
+		if !ok {
+			st = &BandwidthStats{}
+			stats[bucket] = st
+		}
+		st.EgressLimit, st.Egress = tb.usage(now)
+	}
+	return stats
+}
+
+// resetUsage starts counting the usage of the limited buckets anew
+func (s *bandwidthShapers) resetUsage(now time.Time) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	for _, m := range []map[string]*tokenBucket{s.ingress, s.egress} {
+		for _, tb := range m {
+			tb.mtx.Lock()
+			tb.prevTotal, tb.prevTime = tb.total, now
+			tb.mtx.Unlock()
+		}
+	}
+}
+
+type shapedReader struct {
+	r  io.Reader
+	tb *tokenBucket
+}
+
+func (sr *shapedReader) Read(p []byte) (n int, err error) {
+	if chunk := sr.tb.chunk(); len(p) > chunk {
+		p = p[:chunk]
+	}
+	n, err = sr.r.Read(p)
+	if n > 0 {
+		sr.tb.take(n)
+	}
+	return
+}
+
+type shapedWriter struct {
+	w  io.Writer
+	tb *tokenBucket
+}
+
+func (sw *shapedWriter) Write(p []byte) (written int, err error) {
+	chunk := sw.tb.chunk()
+	for len(p) > 0 {
+		l := len(p)
+		if l > chunk {
+			l = chunk
+		}
+		sw.tb.take(l)
+		n, werr := sw.w.Write(p[:l])
+		written += n
+		if werr != nil {
+			return written, werr
+		}
+		p = p[l:]
+	}
+	return
+}
+
+// ingressReader shapes the PUT request body of the bucket's object
+func (t *targetrunner) ingressReader(bucket string, r io.Reader) io.Reader {
+	bucketmd := t.bmdowner.get()
+	_, props := bucketmd.get(bucket, bucketmd.islocal(bucket))
+	if tb := t.bandwidth.get(bucket, props.IngressLimit, true); tb != nil {
+		return &shapedReader{r: r, tb: tb}
+	}
+	return r
+}
+
+// egressWriter shapes the GET response with the bucket's object
+func (t *targetrunner) egressWriter(bucket string, w io.Writer) io.Writer {
+	bucketmd := t.bmdowner.get()
+	_, props := bucketmd.get(bucket, bucketmd.islocal(bucket))
+	if tb := t.bandwidth.get(bucket, props.EgressLimit, false); tb != nil {
+		return &shapedWriter{w: w, tb: tb}
+	}
+	return w
+}
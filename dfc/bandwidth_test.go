@@ -0,0 +1,72 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ */
+package dfc
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestBandwidthShaping(t *testing.T) {
+	const (
+		rate = 512 * KiB
+		size = 1024 * KiB // the first second worth passes right away
+	)
+	var shapers bandwidthShapers
+	data := make([]byte, size)
+
+	tb := shapers.get("bucket1", rate, false)
+	started := time.Now()
+	n, err := io.Copy(&shapedWriter{w: ioutil.Discard, tb: tb}, bytes.NewReader(data))
+	if err != nil || n != size {
+		t.Fatalf("Failed to write: %d, %v", n, err)
+	}
+	if elapsed := time.Since(started); elapsed < 800*time.Millisecond || elapsed > 3*time.Second {
+		t.Errorf("Egress of %d bytes at %d B/s took %v", size, rate, elapsed)
+	}
+
+	tb = shapers.get("bucket1", rate, true)
+	started = time.Now()
+	n, err = io.Copy(ioutil.Discard, &shapedReader{r: bytes.NewReader(data), tb: tb})
+	if err != nil || n != size {
+		t.Fatalf("Failed to read: %d, %v", n, err)
+	}
+	if elapsed := time.Since(started); elapsed < 800*time.Millisecond || elapsed > 3*time.Second {
+		t.Errorf("Ingress of %d bytes at %d B/s took %v", size, rate, elapsed)
+	}
+
+	stats := shapers.stats()
+	bw, ok := stats["bucket1"]
+	if !ok || len(stats) != 1 {
+		t.Fatalf("Unexpected bandwidth stats %+v", stats)
+	}
+	if bw.IngressLimit != rate || bw.EgressLimit != rate || bw.Ingress == 0 || bw.Egress == 0 ||
+		bw.Ingress > 2*rate || bw.Egress > 2*rate {
+		t.Errorf("Unexpected bandwidth stats %+v", bw)
+	}
+
+	// the limit is removed
+	if tb = shapers.get("bucket1", 0, true); tb != nil {
+		t.Error("Token bucket returned for unlimited ingress")
+	}
+	if bw = shapers.stats()["bucket1"]; bw == nil || bw.IngressLimit != 0 || bw.EgressLimit != rate {
+		t.Errorf("Unexpected bandwidth stats %+v", bw)
+	}
+	shapers.get("bucket1", 0, false)
+	if stats = shapers.stats(); stats != nil {
+		t.Errorf("Unexpected bandwidth stats %+v", stats)
+	}
+}
+
+func TestBandwidthLimitsValidation(t *testing.T) {
+	if err := validateBucketProps(&BucketProps{IngressLimit: -1}, true); err == nil {
+		t.Error("Negative ingress limit accepted")
+	}
+	if err := validateBucketProps(&BucketProps{IngressLimit: MiB, EgressLimit: GiB}, true); err != nil {
+		t.Error(err)
+	}
+}
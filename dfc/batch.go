@@ -0,0 +1,229 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/NVIDIA/dfcpub/3rdparty/glog"
+	"github.com/OneOfOne/xxhash"
+)
+
+// Batched sample GET. A training loop reads a dataset of exported shards one
+// batch of samples at a time: POST {"action":"getbatch"} /v1/buckets/bucket-name
+// with the dataset (the shards and, optionally, the indices of their samples
+// in the manifests), the seed, the epoch and the number of the batch returns
+// the batch as one tar archive. The proxy shuffles the dataset with the seed
+// and the epoch, so that all batches of an epoch - possibly requested by
+// different workers - are disjoint, and reads the samples from the shards with
+// range reads using the sample index (see samples.go).
+
+const batchWorkers = 8 // samples read in parallel
+
+func parseBatchMsg(msg *ActionMsg) (*BatchMsg, error) {
+	batchmsg := &BatchMsg{}
+	if msg.Value != nil {
+		b, err := json.Marshal(msg.Value)
+		if err == nil {
+			err = json.Unmarshal(b, batchmsg)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Invalid batch parameters %v, err: %v", msg.Value, err)
+		}
+	}
+	if len(batchmsg.Shards) == 0 {
+		return nil, fmt.Errorf("Batch requires the shards of the dataset")
+	}
+	if batchmsg.BatchSize <= 0 {
+		return nil, fmt.Errorf("Invalid batch size %d", batchmsg.BatchSize)
+	}
+	if batchmsg.Batch < 0 {
+		return nil, fmt.Errorf("Invalid batch number %d", batchmsg.Batch)
+	}
+	return batchmsg, nil
+}
+
+// dataset returns the samples of the dataset in the order of the request
+func (idx *sampleIndex) dataset(batchmsg *BatchMsg) ([]*SampleLocation, error) {
+	var samples []*SampleLocation
+	for _, shard := range batchmsg.Shards {
+		locations, ok := idx.shards[shard.Name]
+		if !ok {
+			return nil, fmt.Errorf("Shard %s/%s is not indexed", idx.info.Bucket, shard.Name)
+		}
+		if len(shard.Members) == 0 {
+			samples = append(samples, locations...)
+			continue
+		}
+		for _, i := range shard.Members {
+			if i < 0 || i >= len(locations) {
+				return nil, fmt.Errorf("Shard %s/%s has no sample #%d", idx.info.Bucket, shard.Name, i)
+			}
+			samples = append(samples, locations[i])
+		}
+	}
+	return samples, nil
+}
+
+// batch shuffles the dataset and returns the samples of the batch and the
+// number of batches in the epoch
+func batch(samples []*SampleLocation, batchmsg *BatchMsg) ([]*SampleLocation, int) {
+	count := (len(samples) + batchmsg.BatchSize - 1) / batchmsg.BatchSize
+	if batchmsg.Batch >= count {
+		return nil, count
+	}
+	// the same permutation for all batches of the epoch
+	perm := epochRand(batchmsg.Seed, batchmsg.Epoch).Perm(len(samples))
+	start := batchmsg.Batch * batchmsg.BatchSize
+	end := start + batchmsg.BatchSize
+	if end > len(perm) {
+		end = len(perm)
+	}
+	selected := make([]*SampleLocation, 0, end-start)
+	for _, i := range perm[start:end] {
+		selected = append(selected, samples[i])
+	}
+	return selected, count
+}
+
+// epochRand returns the source of the shuffle of the epoch
+func epochRand(seed, epoch int64) *rand.Rand {
+	return rand.New(rand.NewSource(seed*1000003 + epoch))
+}
+
+//
+// proxy
+//
+
+// POST {"action":"getbatch"} /v1/buckets/bucket-name
+func (p *proxyrunner) getBatch(w http.ResponseWriter, r *http.Request, bucket string, msg *ActionMsg) {
+	batchmsg, err := parseBatchMsg(msg)
+	if err != nil {
+		p.invalmsghdlr(w, r, err.Error())
+		return
+	}
+	token := r.Header.Get("Authorization")
+	idx, errstr := p.sampleIndex(bucket, token, false)
+	if errstr != "" {
+		p.invalmsghdlr(w, r, errstr)
+		return
+	}
+	samples, err := idx.dataset(batchmsg)
+	if err != nil {
+		p.invalmsghdlr(w, r, err.Error())
+		return
+	}
+	selected, count := batch(samples, batchmsg)
+	if selected == nil {
+		p.invalmsghdlr(w, r, fmt.Sprintf("Invalid batch number %d: %d batches of %d in the epoch",
+			batchmsg.Batch, count, batchmsg.BatchSize))
+		return
+	}
+	// read all samples before responding, to report a failure with the status
+	data, errstr := p.readSamples(bucket, selected, token)
+	if errstr != "" {
+		p.invalmsghdlr(w, r, errstr)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-tar")
+	w.Header().Set(HeaderDfcBatchCount, strconv.Itoa(count))
+	tw := tar.NewWriter(w)
+	for i, sample := range selected {
+		hdr := &tar.Header{Typeflag: tar.TypeReg, Name: sample.Name, Size: sample.Size, Mode: 0644}
+		if err = tw.WriteHeader(hdr); err == nil {
+			_, err = tw.Write(data[i])
+		}
+		if err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = tw.Close()
+	}
+	if err != nil {
+		glog.Errorf("Failed to send batch %d of %s, err: %v", batchmsg.Batch, bucket, err)
+	}
+}
+
+// readSamples reads the samples from the targets that store their shards
+func (p *proxyrunner) readSamples(bucket string, samples []*SampleLocation, token string) ([][]byte, string) {
+	var (
+		data    = make([][]byte, len(samples))
+		errstrs = make([]string, len(samples))
+		smap    = p.smapowner.get()
+		wg      = &sync.WaitGroup{}
+		workch  = make(chan int, len(samples))
+	)
+	for i := range samples {
+		workch <- i
+	}
+	close(workch)
+	for n := 0; n < batchWorkers && n < len(samples); n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range workch {
+				data[i], errstrs[i] = p.readSample(bucket, samples[i], smap, token)
+			}
+		}()
+	}
+	wg.Wait()
+	for _, errstr := range errstrs {
+		if errstr != "" {
+			return nil, errstr
+		}
+	}
+	return data, ""
+}
+
+func (p *proxyrunner) readSample(bucket string, sample *SampleLocation, smap *Smap, token string) ([]byte, string) {
+	if sample.Size == 0 {
+		return []byte{}, ""
+	}
+	si, errstr := HrwTarget(bucket, sample.Shard, smap)
+	if errstr != "" {
+		return nil, errstr
+	}
+	url := si.DirectURL + URLEscapedPath(Rversion, Robjects, bucket, sample.Shard) +
+		fmt.Sprintf("?%s=%d&%s=%d", URLParamOffset, sample.Offset, URLParamLength, sample.Size)
+	request, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err.Error()
+	}
+	if token != "" {
+		request.Header.Set("Authorization", token)
+	}
+	response, err := p.client(si, true).Do(request)
+	if err != nil {
+		return nil, fmt.Sprintf("Failed to read sample %s from %s, err: %v", sample.Name, si.DaemonID, err)
+	}
+	b, err := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	if err != nil || response.StatusCode >= http.StatusBadRequest {
+		return nil, fmt.Sprintf("Failed to read sample %s of shard %s/%s from %s, status %d, err: %v",
+			sample.Name, bucket, sample.Shard, si.DaemonID, response.StatusCode, err)
+	}
+	if int64(len(b)) != sample.Size {
+		return nil, fmt.Sprintf("Sample %s of shard %s/%s: read %d bytes, expected %d - the index is stale?",
+			sample.Name, bucket, sample.Shard, len(b), sample.Size)
+	}
+	if sample.Checksum != "" {
+		if cksum, _ := ComputeXXHash(bytes.NewReader(b), nil, xxhash.New64()); cksum != sample.Checksum {
+			return nil, fmt.Sprintf("Sample %s of shard %s/%s: checksum %s, expected %s",
+				sample.Name, bucket, sample.Shard, cksum, sample.Checksum)
+		}
+	}
+	return b, ""
+}
@@ -0,0 +1,83 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ */
+package dfc
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestBatch(t *testing.T) {
+	manifests := make([]*ExportManifest, 0, 3)
+	for i := 0; i < 3; i++ {
+		manifest := &ExportManifest{Shard: fmt.Sprintf("s-%d.tar", i)}
+		for j := 0; j < 4; j++ {
+			manifest.Objects = append(manifest.Objects, &ExportedObject{Name: fmt.Sprintf("%d-%d.jpg", i, j), Size: 10})
+		}
+		manifests = append(manifests, manifest)
+	}
+	idx := newSampleIndex("bucket", manifests)
+
+	msg := &BatchMsg{Shards: []BatchShard{{Name: "s-0.tar"}, {Name: "s-2.tar", Members: []int{3, 1}}}, Seed: 7, BatchSize: 4}
+	samples, err := idx.dataset(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, sample := range samples {
+		names = append(names, sample.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"0-0.jpg", "0-1.jpg", "0-2.jpg", "0-3.jpg", "2-3.jpg", "2-1.jpg"}) {
+		t.Fatalf("Unexpected dataset %v", names)
+	}
+
+	// the batches of an epoch partition the dataset
+	epoch := func(epoch int64) []string {
+		var names []string
+		for i := 0; ; i++ {
+			msg.Epoch, msg.Batch = epoch, i
+			selected, count := batch(samples, msg)
+			if count != 2 {
+				t.Fatalf("Expected 2 batches, got %d", count)
+			}
+			if selected == nil {
+				return names
+			}
+			if i == 0 && len(selected) != 4 || i == 1 && len(selected) != 2 {
+				t.Errorf("Batch %d: unexpected size %d", i, len(selected))
+			}
+			for _, sample := range selected {
+				names = append(names, sample.Name)
+			}
+		}
+	}
+	first := epoch(0)
+	seen := make(map[string]bool)
+	for _, name := range first {
+		seen[name] = true
+	}
+	if len(first) != len(samples) || len(seen) != len(samples) {
+		t.Errorf("Epoch does not cover the dataset: %v", first)
+	}
+	if again := epoch(0); !reflect.DeepEqual(again, first) {
+		t.Errorf("Expected the same order for the same epoch, got %v and %v", first, again)
+	}
+	differs := false
+	for e := int64(1); e < 5 && !differs; e++ {
+		differs = !reflect.DeepEqual(epoch(e), first)
+	}
+	if !differs {
+		t.Error("Expected different epochs to be shuffled differently")
+	}
+
+	for _, shard := range []BatchShard{{Name: "none.tar"}, {Name: "s-1.tar", Members: []int{4}}} {
+		if _, err = idx.dataset(&BatchMsg{Shards: []BatchShard{shard}}); err == nil {
+			t.Errorf("Expected dataset %+v to be invalid", shard)
+		}
+	}
+	if _, err = parseBatchMsg(&ActionMsg{Action: ActGetBatch, Value: map[string]interface{}{"shards": []interface{}{map[string]interface{}{"name": "s-0.tar"}}}}); err == nil {
+		t.Error("Expected batch without the batch size to be invalid")
+	}
+}
@@ -0,0 +1,250 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/NVIDIA/dfcpub/3rdparty/glog"
+)
+
+// Burn-in and benchmark. The target, preferably drained (no user traffic),
+// measures each mountpath - sequential write and read of a FileSize test file,
+// random 4KiB writes and reads within it - and the throughput of sending
+// NetSize bytes to each of the other targets. The disks are accessed with
+// direct I/O where supported, so the page cache does not skew the numbers.
+// The results are stored in the target's configuration directory and are
+// returned by GET /v1/daemon?what=benchmark.
+
+const (
+	benchmarkname   = "benchmark.json"
+	benchFileSize   = 256 * MiB
+	benchNetSize    = 64 * MiB
+	benchRandOps    = 1024
+	benchRandOpSize = directAlign
+)
+
+// startBenchmark starts the benchmark in the background; the target refuses
+// to run it while rebalance, LRU or resilver are in progress
+func (t *targetrunner) startBenchmark(w http.ResponseWriter, r *http.Request, msg *ActionMsg) {
+	benchmsg := &BenchmarkMsg{}
+	if msg.Value != nil {
+		b, err := json.Marshal(msg.Value)
+		if err == nil {
+			err = json.Unmarshal(b, benchmsg)
+		}
+		if err != nil {
+			t.invalmsghdlr(w, r, fmt.Sprintf("Invalid benchmark parameters %v, err: %v", msg.Value, err))
+			return
+		}
+	}
+	if benchmsg.FileSize < 0 || benchmsg.NetSize < 0 {
+		t.invalmsghdlr(w, r, fmt.Sprintf("Invalid benchmark sizes %d, %d", benchmsg.FileSize, benchmsg.NetSize))
+		return
+	}
+	xbench, errstr := t.xactinp.renewBenchmark(t)
+	if errstr != "" {
+		t.invalmsghdlr(w, r, errstr, http.StatusConflict)
+		return
+	}
+	go t.runBenchmark(xbench, benchmsg)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (t *targetrunner) runBenchmark(xbench *xactBenchmark, benchmsg *BenchmarkMsg) *BenchmarkResult {
+	glog.Infoln(xbench.tostring())
+	filesize, netsize := benchmsg.FileSize, benchmsg.NetSize
+	if filesize == 0 {
+		filesize = benchFileSize
+	}
+	if netsize == 0 {
+		netsize = benchNetSize
+	}
+	// whole aligned buffers, see directWriter
+	filesize = (filesize + directBufSize - 1) &^ (directBufSize - 1)
+
+	result := &BenchmarkResult{
+		Time:       time.Now(),
+		Mountpaths: make(map[string]*MpathBenchmark),
+		Targets:    make(map[string]float64),
+	}
+	if t.si != nil {
+		result.DaemonID = t.si.DaemonID
+	}
+	for mpath := range ctx.mountpaths.Available {
+		mpbench, err := t.benchMpath(xbench, mpath, filesize)
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("mountpath %s: %v", mpath, err))
+			continue
+		}
+		result.Mountpaths[mpath] = mpbench
+	}
+	if smap := t.smapowner.get(); smap != nil {
+		for id, si := range smap.Tmap {
+			if t.si != nil && id == t.si.DaemonID {
+				continue
+			}
+			mbps, err := t.benchTarget(xbench, si, netsize)
+			if err != nil {
+				result.Errors = append(result.Errors, fmt.Sprintf("target %s: %v", id, err))
+				continue
+			}
+			result.Targets[id] = mbps
+		}
+	}
+	if err := LocalSave(filepath.Join(ctx.config.Confdir, benchmarkname), result); err != nil {
+		glog.Errorf("Failed to store the benchmark results, err: %v", err)
+	}
+	xbench.etime = time.Now()
+	glog.Infof("%s: %d mountpaths, %d targets, %d errors", xbench.tostring(),
+		len(result.Mountpaths), len(result.Targets), len(result.Errors))
+	t.xactinp.del(xbench.id)
+	return result
+}
+
+// benchMpath measures the mountpath using a test file in its work directory
+func (t *targetrunner) benchMpath(xbench *xactBenchmark, mpath string, filesize int64) (*MpathBenchmark, error) {
+	workdir := filepath.Join(mpath, mpathWorkDir)
+	if err := CreateDir(workdir); err != nil {
+		return nil, err
+	}
+	fqn := filepath.Join(workdir, ActBenchmark)
+	defer os.Remove(fqn)
+	buf := directbufs.Get().([]byte)
+	defer directbufs.Put(buf)
+	rand.Read(buf)
+	mpbench := &MpathBenchmark{}
+
+	// sequential write
+	file, err := os.OpenFile(fqn, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	benchDirectIO(file)
+	started := time.Now()
+	for off := int64(0); off < filesize; off += int64(len(buf)) {
+		if xbench.aborted() {
+			return nil, fmt.Errorf("%s aborted", xbench.tostring())
+		}
+		if _, err = file.Write(buf); err != nil {
+			return nil, err
+		}
+	}
+	if err = file.Sync(); err != nil {
+		return nil, err
+	}
+	mpbench.SeqWriteMBps = mbps(filesize, time.Since(started))
+
+	// sequential read
+	if _, err = file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	started = time.Now()
+	for off := int64(0); off < filesize; off += int64(len(buf)) {
+		if xbench.aborted() {
+			return nil, fmt.Errorf("%s aborted", xbench.tostring())
+		}
+		if _, err = io.ReadFull(file, buf); err != nil {
+			return nil, err
+		}
+	}
+	mpbench.SeqReadMBps = mbps(filesize, time.Since(started))
+
+	// random 4KiB writes and reads at aligned offsets
+	blocks := filesize / benchRandOpSize
+	block := buf[:benchRandOpSize]
+	started = time.Now()
+	for i := 0; i < benchRandOps; i++ {
+		if _, err = file.WriteAt(block, rand.Int63n(blocks)*benchRandOpSize); err != nil {
+			return nil, err
+		}
+	}
+	if err = file.Sync(); err != nil {
+		return nil, err
+	}
+	mpbench.RandWriteIOPS = float64(benchRandOps) / time.Since(started).Seconds()
+	started = time.Now()
+	for i := 0; i < benchRandOps; i++ {
+		if _, err = file.ReadAt(block, rand.Int63n(blocks)*benchRandOpSize); err != nil {
+			return nil, err
+		}
+	}
+	mpbench.RandReadIOPS = float64(benchRandOps) / time.Since(started).Seconds()
+	return mpbench, nil
+}
+
+// benchDirectIO enables direct I/O, if supported - otherwise the numbers
+// include the page cache
+func benchDirectIO(file *os.File) {
+	if err := setDirectIO(file, true); err != nil {
+		glog.Warningf("Failed to enable direct I/O for %s, err: %v", file.Name(), err)
+	}
+}
+
+// benchTarget sends netsize bytes to the target's benchmark sink
+func (t *targetrunner) benchTarget(xbench *xactBenchmark, si *daemonInfo, netsize int64) (float64, error) {
+	if xbench.aborted() {
+		return 0, fmt.Errorf("%s aborted", xbench.tostring())
+	}
+	url := si.dataURL() + "/" + Rversion + "/" + Rdaemon + "/" + Rbenchmark
+	request, err := http.NewRequest(http.MethodPost, url, io.LimitReader(zeroReader{}, netsize))
+	if err != nil {
+		return 0, err
+	}
+	request.ContentLength = netsize
+	started := time.Now()
+	response, err := t.httpclientLongTimeout.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	_, _ = io.Copy(ioutil.Discard, response.Body)
+	response.Body.Close()
+	if response.StatusCode >= http.StatusBadRequest {
+		return 0, fmt.Errorf("status %d", response.StatusCode)
+	}
+	return mbps(netsize, time.Since(started)), nil
+}
+
+// benchmarkSink receives the data sent by benchTarget of another target
+func (t *targetrunner) benchmarkSink(w http.ResponseWriter, r *http.Request) {
+	if _, err := io.Copy(ioutil.Discard, r.Body); err != nil {
+		t.invalmsghdlr(w, r, fmt.Sprintf("Failed to receive benchmark data, err: %v", err))
+	}
+}
+
+// loadBenchmark returns the results of the last benchmark, nil if none
+func loadBenchmark() (*BenchmarkResult, error) {
+	result := &BenchmarkResult{}
+	if err := LocalLoad(filepath.Join(ctx.config.Confdir, benchmarkname), result); err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return result, nil
+}
+
+func mbps(size int64, d time.Duration) float64 {
+	return float64(size) / float64(MiB) / d.Seconds()
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
@@ -0,0 +1,79 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ */
+package dfc
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBenchmark(t *testing.T) {
+	dir, err := ioutil.TempDir("", "benchmark")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	mpath := filepath.Join(dir, "mp")
+	oldavail, oldconfdir := ctx.mountpaths.Available, ctx.config.Confdir
+	defer func() { ctx.mountpaths.Available, ctx.config.Confdir = oldavail, oldconfdir }()
+	ctx.mountpaths.Available = map[string]*mountPath{mpath: {Path: mpath}}
+	ctx.config.Confdir = dir
+
+	target := &targetrunner{}
+	target.si = &daemonInfo{DaemonID: "self"}
+	target.xactinp = newxactinp()
+	target.httpclientLongTimeout = &http.Client{}
+	var received int64
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/"+Rversion+"/"+Rdaemon+"/"+Rbenchmark {
+			t.Errorf("Unexpected benchmark URL %s", r.URL.Path)
+		}
+		received += r.ContentLength
+		target.benchmarkSink(w, r)
+	}))
+	defer peer.Close()
+	smap := newSmap()
+	smap.addTarget(target.si)
+	smap.addTarget(&daemonInfo{DaemonID: "peer", DirectURL: peer.URL})
+	target.smapowner = &smapowner{}
+	target.smapowner.put(smap)
+
+	if result, err := loadBenchmark(); result != nil || err != nil {
+		t.Fatalf("Expected no benchmark results, got %+v, err: %v", result, err)
+	}
+	xbench, errstr := target.xactinp.renewBenchmark(target)
+	if errstr != "" {
+		t.Fatal(errstr)
+	}
+	if _, errstr = target.xactinp.renewBenchmark(target); errstr == "" {
+		t.Error("Expected the second benchmark to be refused")
+	}
+	target.runBenchmark(xbench, &BenchmarkMsg{FileSize: 100 * KiB, NetSize: MiB})
+
+	result, err := loadBenchmark()
+	if err != nil || result == nil {
+		t.Fatalf("Expected benchmark results, err: %v", err)
+	}
+	if len(result.Errors) != 0 {
+		t.Errorf("Unexpected errors %v", result.Errors)
+	}
+	mpbench := result.Mountpaths[mpath]
+	if mpbench == nil || mpbench.SeqWriteMBps <= 0 || mpbench.SeqReadMBps <= 0 ||
+		mpbench.RandWriteIOPS <= 0 || mpbench.RandReadIOPS <= 0 {
+		t.Errorf("Unexpected mountpath results %+v", mpbench)
+	}
+	if _, err = os.Stat(filepath.Join(mpath, mpathWorkDir, ActBenchmark)); !os.IsNotExist(err) {
+		t.Errorf("Expected the test file to be removed, err: %v", err)
+	}
+	if len(result.Targets) != 1 || result.Targets["peer"] <= 0 || received != MiB {
+		t.Errorf("Unexpected target results %v, %d bytes received", result.Targets, received)
+	}
+	if _, x := target.xactinp.findU(ActBenchmark); x != nil {
+		t.Error("Expected the benchmark xaction to be removed")
+	}
+}
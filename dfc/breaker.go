@@ -0,0 +1,133 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+// Circuit breakers of the endpoints a target depends on: the next tiers
+// (see tierhealth.go) and the Cloud buckets (see cloudbreaker.go). An endpoint
+// that fails the configured number of requests in a row becomes degraded, and
+// the target stops sending it requests. Every probe interval, one request - or
+// a health check, whichever the caller makes of it - is let through to the
+// degraded endpoint, and the first one that succeeds restores it.
+
+import (
+	"sync"
+	"time"
+
+	"github.com/NVIDIA/dfcpub/3rdparty/glog"
+)
+
+const (
+	breakerFailures      = 5                // failed requests in a row to degrade an endpoint
+	breakerProbeInterval = 10 * time.Second // how often a degraded endpoint is probed
+)
+
+// endpoint states
+const (
+	EndpointHealthy  = "healthy"
+	EndpointDegraded = "degraded"
+)
+
+// BreakerStats is the health of an endpoint at a target
+type BreakerStats struct {
+	State    string    `json:"state"`
+	Failures int       `json:"failures"`        // failed requests in a row
+	Trips    int64     `json:"trips"`           // times degraded
+	Skipped  int64     `json:"skipped"`         // requests not sent to the degraded endpoint
+	Since    time.Time `json:"since,omitempty"` // degraded since
+}
+
+type breaker struct {
+	BreakerStats
+	probing bool
+	probed  time.Time
+}
+
+type breakers struct {
+	mtx  sync.Mutex
+	name string       // kind of the endpoints, for the logs
+	conf *breakerconf // thresholds
+	m    map[string]*breaker
+}
+
+// allow tells whether to send a request to the endpoint and, if not, whether
+// to probe it
+func (b *breakers) allow(key string, now time.Time) (ok, probe bool) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	br, exists := b.m[key]
+	if !exists || br.State != EndpointDegraded {
+		return true, false
+	}
+	if !br.probing && now.Sub(br.probed) >= b.conf.ProbeInterval {
+		br.probing, br.probed = true, now
+		return false, true
+	}
+	br.Skipped++
+	return false, false
+}
+
+// degraded tells whether the endpoint is degraded
+func (b *breakers) degraded(key string) bool {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	br, exists := b.m[key]
+	return exists && br.State == EndpointDegraded
+}
+
+// done records the outcome of a request to the endpoint
+func (b *breakers) done(key string, failed bool, now time.Time) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	br, exists := b.m[key]
+	if !exists {
+		if !failed {
+			return
+		}
+		if b.m == nil {
+			b.m = make(map[string]*breaker)
+		}
+		br = &breaker{BreakerStats: BreakerStats{State: EndpointHealthy}}
+		b.m[key] = br
+	}
+	if !failed {
+		if br.State == EndpointDegraded {
+			glog.Infof("%s %s is back after %v", b.name, key, now.Sub(br.Since))
+		}
+		br.State, br.Failures, br.Since = EndpointHealthy, 0, time.Time{}
+		return
+	}
+	br.Failures++
+	if br.State == EndpointHealthy && br.Failures >= b.conf.Failures {
+		glog.Warningf("%s %s is degraded: %d failed requests in a row", b.name, key, br.Failures)
+		br.State, br.Since, br.probed = EndpointDegraded, now, now
+		br.Trips++
+	}
+}
+
+// probed records the outcome of the probe of the degraded endpoint
+func (b *breakers) probed(key string, failed bool, now time.Time) {
+	b.mtx.Lock()
+	if br, exists := b.m[key]; exists {
+		br.probing, br.probed = false, now
+	}
+	b.mtx.Unlock()
+	b.done(key, failed, now)
+}
+
+// stats returns the state of the endpoints that have ever failed
+func (b *breakers) stats() map[string]*BreakerStats {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if len(b.m) == 0 {
+		return nil
+	}
+	stats := make(map[string]*BreakerStats, len(b.m))
+	for key, br := range b.m {
+		st := br.BreakerStats
+		stats[key] = &st
+	}
+	return stats
+}
@@ -0,0 +1,146 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestBreakers(t *testing.T) {
+	const url = "http://nexttier:8080"
+	var (
+		b   = &breakers{name: "Next tier", conf: &breakerconf{Failures: 3, ProbeInterval: 10 * time.Second}}
+		now = time.Unix(1500000000, 0)
+	)
+	if b.stats() != nil {
+		t.Fatal("Expected no stats of healthy endpoints")
+	}
+	// a success resets the failures
+	for _, failed := range []bool{true, false, true, true} {
+		b.done(url, failed, now)
+	}
+	if ok, _ := b.allow(url, now); !ok || b.degraded(url) {
+		t.Fatal("Expected the endpoint to be healthy")
+	}
+	b.done(url, true, now)
+	st := b.stats()[url]
+	if st.State != EndpointDegraded || st.Trips != 1 || st.Failures != 3 || !st.Since.Equal(now) {
+		t.Fatalf("Expected the endpoint to be degraded: %+v", st)
+	}
+
+	// the degraded endpoint is skipped and probed once per interval
+	tests := []struct {
+		after time.Duration
+		probe bool
+	}{
+		{time.Second, false},
+		{10 * time.Second, true},
+		{11 * time.Second, false}, // being probed
+	}
+	for _, test := range tests {
+		if ok, probe := b.allow(url, now.Add(test.after)); ok || probe != test.probe {
+			t.Errorf("After %v: allowed %t, probe %t", test.after, ok, probe)
+		}
+	}
+	b.probed(url, true, now.Add(12*time.Second))
+	if _, probe := b.allow(url, now.Add(21*time.Second)); probe {
+		t.Error("Expected the next probe an interval after the failed one")
+	}
+	if _, probe := b.allow(url, now.Add(22*time.Second)); !probe {
+		t.Error("Expected the endpoint to be probed again")
+	}
+	b.probed(url, false, now.Add(23*time.Second))
+	if ok, probe := b.allow(url, now.Add(24*time.Second)); !ok || probe {
+		t.Error("Expected the endpoint to be restored")
+	}
+	st = b.stats()[url]
+	if st.State != EndpointHealthy || st.Failures != 0 || st.Skipped != 3 || st.Trips != 1 {
+		t.Errorf("Unexpected stats of the restored endpoint: %+v", st)
+	}
+}
+
+func TestCloudBreaker(t *testing.T) {
+	var (
+		m  = newMockCloud(nil, "b1", "b2")
+		b  = &breakers{name: "Cloud bucket", conf: &breakerconf{Failures: 2, ProbeInterval: time.Hour}}
+		c  = &breakercloud{cloudif: m, b: b}
+		ct = context.Background()
+	)
+	// errors of the requests do not degrade the bucket
+	for i := 0; i < 3; i++ {
+		if _, cerr := c.headobject(ct, "b1", "nonexistent"); cerr == nil || cerr.Status != http.StatusNotFound {
+			t.Fatalf("Expected 404, got %v", cerr)
+		}
+	}
+	m.failRate = 1
+	for i := 0; i < 2; i++ {
+		if _, cerr := c.headbucket(ct, "b1"); cerr == nil {
+			t.Fatal("Expected the mock cloud to fail")
+		}
+	}
+	_, cerr := c.headbucket(ct, "b1")
+	if cerr == nil || cerr.Status != http.StatusServiceUnavailable || cerr.RetryAfter != 3600 ||
+		m.numCalls("headbucket") != 2 || !b.degraded("b1") {
+		t.Fatalf("Expected b1 to fail fast: %v, %d calls", cerr, m.numCalls("headbucket"))
+	}
+	c.headbucket(ct, "b2")
+	if m.numCalls("headbucket") != 3 {
+		t.Error("Expected b2 to be called")
+	}
+
+	// the probe goes through and restores the bucket
+	m.failRate = 0
+	b.conf.ProbeInterval = 0
+	if _, cerr = c.headbucket(ct, "b1"); cerr != nil || b.degraded("b1") || m.numCalls("headbucket") != 4 {
+		t.Errorf("Expected b1 to be restored, err: %v", cerr)
+	}
+}
+
+func TestServeStale(t *testing.T) {
+	file, err := ioutil.TempFile("", "stale")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+	defer os.Remove(file.Name())
+	fqn := file.Name()
+
+	target := &targetrunner{}
+	target.bmdowner = &bmdowner{}
+	bucketmd := newBucketMD()
+	bucketmd.add("stale", false, BucketProps{ServeStale: true, MaxStale: "1h"})
+	bucketmd.add("consistent", false, BucketProps{})
+	target.bmdowner.put(bucketmd)
+
+	tests := []struct {
+		bucket string
+		age    time.Duration
+		status int
+		serve  bool
+	}{
+		{"stale", time.Minute, http.StatusServiceUnavailable, true},
+		{"stale", time.Minute, http.StatusRequestTimeout, true},
+		{"stale", time.Minute, http.StatusNotFound, false}, // deleted from the Cloud
+		{"stale", 2 * time.Hour, http.StatusInternalServerError, false},
+		{"consistent", time.Minute, http.StatusServiceUnavailable, false},
+	}
+	for _, test := range tests {
+		mtime := time.Now().Add(-test.age)
+		if err = os.Chtimes(fqn, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+		if serve := target.serveStale(test.bucket, fqn, test.status); serve != test.serve {
+			t.Errorf("%s, %v old, status %d: serve %t", test.bucket, test.age, test.status, serve)
+		}
+	}
+	if target.serveStale("stale", fqn+".nonexistent", http.StatusServiceUnavailable) {
+		t.Error("Expected no stale copy to serve")
+	}
+}
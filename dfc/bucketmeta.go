@@ -17,11 +17,44 @@ const (
 	RWPolicyNextTier = "next_tier"
 )
 
+// Cloud server-side encryption of objects written by DFC (Amazon S3 only)
+const (
+	CloudSSEAES256 = "AES256"  // SSE-S3: keys managed by S3
+	CloudSSEKMS    = "aws:kms" // SSE-KMS: AWS KMS key, default or the one set by cloud_sse_key_id
+)
+
 type BucketProps struct {
 	CloudProvider string `json:"cloud_provider,omitempty"`
 	NextTierURL   string `json:"next_tier_url,omitempty"`
 	ReadPolicy    string `json:"read_policy,omitempty"`
 	WritePolicy   string `json:"write_policy,omitempty"`
+	Encrypt       bool   `json:"encrypt,omitempty"`          // encrypt cached objects at rest
+	CloudSSE      string `json:"cloud_sse,omitempty"`        // one of CloudSSE* enum, empty - cloud bucket default
+	CloudSSEKeyID string `json:"cloud_sse_key_id,omitempty"` // KMS key ID for CloudSSEKMS
+	RequesterPays bool   `json:"requester_pays,omitempty"`   // requester pays for S3 requests
+	StorageClass  string `json:"storage_class,omitempty"`    // S3 storage class of new objects
+	Fsync         string `json:"fsync,omitempty"`            // one of Fsync* enum, empty - cluster default (see commitconf)
+	MpathLabel    string `json:"mpath_label,omitempty"`      // preferred mountpath label (see placement)
+	IngressLimit  int64  `json:"ingress_limit,omitempty"`    // PUT bytes per second per target, 0 - unlimited (see bandwidth.go)
+	EgressLimit   int64  `json:"egress_limit,omitempty"`     // GET bytes per second per target, 0 - unlimited
+	EgressBudget  int64  `json:"egress_budget,omitempty"`    // monthly bytes fetched from the Cloud, 0 - unlimited (see egress.go)
+	Protected     bool   `json:"protected,omitempty"`        // local bucket cannot be destroyed (see destroy.go)
+	DestroyAt     int64  `json:"destroy_at,omitempty"`       // local bucket marked for destruction at this Unix time
+	ServeStale    bool   `json:"serve_stale,omitempty"`      // serve cached objects when the Cloud fails (see cloudbreaker.go)
+	MaxStale      string `json:"max_stale,omitempty"`        // max age of the stale objects, e.g. "1h"; empty - unbounded
+	WORM          bool   `json:"worm,omitempty"`             // local bucket objects are write-once (see worm.go)
+	Retention     string `json:"retention,omitempty"`        // retention of the WORM objects, e.g. "720h"; empty - forever
+	ECData        int    `json:"ec_data,omitempty"`          // erasure coding data slices, 0 - none (see ec.go)
+	ECParity      int    `json:"ec_parity,omitempty"`        // erasure coding parity slices
+	ECMinSize     int64  `json:"ec_min_size,omitempty"`      // smaller objects are replicated ECParity times
+	Copies        int    `json:"copies,omitempty"`           // copies of each object on distinct mountpaths (see mirror.go)
+	PGroups       bool   `json:"pgroups,omitempty"`          // objects were put into placement groups; set by the first such request
+	// objects with these prefixes are not evicted (see pin.go); changed by the pin and unpin actions only
+	PinnedPrefixes []string `json:"pinned_prefixes,omitempty"`
+	// warm-up manifest of a Cloud bucket (see warmup.go); changed by the warmup action only
+	Warmup []string `json:"warmup,omitempty"`
+	// published datasets of a local bucket (see publish.go); changed by the publish action only
+	Datasets []DatasetInfo `json:"datasets,omitempty"`
 }
 
 type bucketMD struct {
@@ -0,0 +1,176 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// ============================= Bucket stats ================================
+// Every target counts the GETs, PUTs, DELETEs, evictions and errors of each
+// bucket since it started. A GET that was not served from the cache - cold
+// GET, object fetched from the next tier or byte range read from the Cloud -
+// is a miss. Bytes cached is the size of the objects stored by PUTs, cold
+// GETs and prefetches; to find out how much of a bucket the cluster stores
+// right now, see the bucket summary (summary.go).
+// The counters are reported with the target's stats (GET /v1/daemon?what=stats)
+// and by themselves (what=bucketstats). GET /v1/cluster?what=bucketstats
+// collects the counters of all targets and sums them up by bucket.
+// An error is counted against the bucket of the failed request only if the
+// target has counters for the bucket already, so that the requests naming
+// non-existing buckets do not add to the stats.
+// ============================= Bucket stats ================================
+
+// BucketStats are the counters of a bucket at a target or, summed up, in the cluster
+type BucketStats struct {
+	Numget       int64   `json:"numget"`
+	Numcoldget   int64   `json:"numcoldget"` // misses
+	HitRatio     float64 `json:"hit_ratio"`  // (numget - numcoldget) / numget
+	Numput       int64   `json:"numput"`
+	Numdelete    int64   `json:"numdelete"`
+	Bytescached  int64   `json:"bytescached"`
+	Filesevicted int64   `json:"filesevicted"`
+	Bytesevicted int64   `json:"bytesevicted"`
+	Numerr       int64   `json:"numerr"`
+}
+
+// BucketStatsReport is returned by GET /v1/cluster?what=bucketstats
+type BucketStatsReport struct {
+	Buckets map[string]*BucketStats            `json:"buckets"` // bucket => the cluster's counters
+	Targets map[string]map[string]*BucketStats `json:"targets"` // target => bucket => its counters
+}
+
+func (s *BucketStats) merge(other *BucketStats) {
+	s.Numget += other.Numget
+	s.Numcoldget += other.Numcoldget
+	s.Numput += other.Numput
+	s.Numdelete += other.Numdelete
+	s.Bytescached += other.Bytescached
+	s.Filesevicted += other.Filesevicted
+	s.Bytesevicted += other.Bytesevicted
+	s.Numerr += other.Numerr
+	s.updateHitRatio()
+}
+
+func (s *BucketStats) updateHitRatio() {
+	s.HitRatio = 0
+	if s.Numget > 0 {
+		s.HitRatio = float64(s.Numget-s.Numcoldget) / float64(s.Numget)
+	}
+}
+
+//
+// target
+//
+
+// addBucket adds to the bucket's counters, the names are the ones of the
+// core stats (see addL)
+func (r *storstatsrunner) addBucket(bucket string, nameval ...interface{}) {
+	r.Lock()
+	defer r.Unlock()
+	s, ok := r.Buckets[bucket]
+	if !ok {
+		if len(nameval) == 2 && nameval[0] == "numerr" {
+			return
+		}
+		if r.Buckets == nil {
+			r.Buckets = make(map[string]*BucketStats)
+		}
+		s = &BucketStats{}
+		r.Buckets[bucket] = s
+	}
+	for i := 0; i < len(nameval); i += 2 {
+		statsname, ok := nameval[i].(string)
+		assert(ok, fmt.Sprintf("Invalid stats name: %v, %T", nameval[i], nameval[i]))
+		statsval, ok := nameval[i+1].(int64)
+		assert(ok, fmt.Sprintf("Invalid stats type: %v, %T", nameval[i+1], nameval[i+1]))
+		var v *int64
+		switch statsname {
+		case "numget":
+			v = &s.Numget
+		case "numcoldget":
+			v = &s.Numcoldget
+		case "numput":
+			v = &s.Numput
+		case "numdelete":
+			v = &s.Numdelete
+		case "bytescached":
+			v = &s.Bytescached
+		case "filesevicted":
+			v = &s.Filesevicted
+		case "bytesevicted":
+			v = &s.Bytesevicted
+		case "numerr":
+			v = &s.Numerr
+		default:
+			assert(false, "Invalid bucket stats name "+statsname)
+		}
+		*v += statsval
+	}
+	s.updateHitRatio()
+}
+
+// bucketStats returns a copy of the counters, only of the bucket unless empty
+func (r *storstatsrunner) bucketStats(bucket string) map[string]*BucketStats {
+	r.Lock()
+	defer r.Unlock()
+	stats := make(map[string]*BucketStats, len(r.Buckets))
+	for name, s := range r.Buckets {
+		if bucket == "" || name == bucket {
+			copied := *s
+			stats[name] = &copied
+		}
+	}
+	return stats
+}
+
+func (t *targetrunner) addBucketStats(bucket string, nameval ...interface{}) {
+	if r, ok := t.statsif.(*storstatsrunner); ok {
+		r.addBucket(bucket, nameval...)
+	}
+}
+
+//
+// proxy
+//
+
+// bucketStats collects the bucket counters of all targets; bucket "" - of all buckets
+func (p *proxyrunner) bucketStats(bucket string) (*BucketStatsReport, string) {
+	q := url.Values{}
+	q.Set(URLParamWhat, GetWhatBckStats)
+	if bucket != "" {
+		q.Set(URLParamBucket, bucket)
+	}
+	results := p.broadcastTargets(URLPath(Rversion, Rdaemon), q, http.MethodGet, nil,
+		p.smapowner.get(), ctx.config.Timeout.Default)
+	report := &BucketStatsReport{
+		Buckets: make(map[string]*BucketStats),
+		Targets: make(map[string]map[string]*BucketStats),
+	}
+	for res := range results {
+		if res.err != nil {
+			return nil, fmt.Sprintf("Failed to get bucket stats from %s: %v (%d: %s)",
+				res.si.DaemonID, res.err, res.status, res.errstr)
+		}
+		stats := make(map[string]*BucketStats)
+		if err := json.Unmarshal(res.outjson, &stats); err != nil {
+			return nil, fmt.Sprintf("Failed to unmarshal bucket stats from %s, err: %v", res.si.DaemonID, err)
+		}
+		report.Targets[res.si.DaemonID] = stats
+		for name, s := range stats {
+			total, ok := report.Buckets[name]
+			if !ok {
+				total = &BucketStats{}
+				report.Buckets[name] = total
+			}
+			total.merge(s)
+		}
+	}
+	return report, ""
+}
@@ -0,0 +1,57 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBucketStats(t *testing.T) {
+	r := &storstatsrunner{}
+	h := &httprunner{statsif: r}
+
+	// no counters for the bucket yet - the error is not counted against it
+	req := httptest.NewRequest(http.MethodGet, "/v1/objects/bucket1/obj", nil)
+	h.invalmsghdlr(httptest.NewRecorder(), req, "not found", http.StatusNotFound)
+	if len(r.bucketStats("")) != 0 {
+		t.Fatalf("Unexpected stats %+v", r.bucketStats(""))
+	}
+
+	r.addBucket("bucket1", "numget", int64(1), "numcoldget", int64(1), "bytescached", int64(100))
+	r.addBucket("bucket1", "numget", int64(1))
+	r.addBucket("bucket1", "numget", int64(1))
+	r.addBucket("bucket1", "numget", int64(1))
+	r.addBucket("bucket2", "numput", int64(1), "bytescached", int64(10))
+	r.addBucket("bucket2", "filesevicted", int64(1), "bytesevicted", int64(10))
+	h.invalmsghdlr(httptest.NewRecorder(), req, "not found", http.StatusNotFound)
+	if r.Core.Numerr != 2 {
+		t.Errorf("Expected 2 errors, got %d", r.Core.Numerr)
+	}
+
+	stats := r.bucketStats("bucket1")
+	if len(stats) != 1 {
+		t.Fatalf("Expected the stats of bucket1 only, got %+v", stats)
+	}
+	expected := BucketStats{Numget: 4, Numcoldget: 1, HitRatio: 0.75, Bytescached: 100, Numerr: 1}
+	if *stats["bucket1"] != expected {
+		t.Errorf("Expected %+v, got %+v", expected, *stats["bucket1"])
+	}
+	// a copy
+	stats["bucket1"].Numget = 0
+	if r.Buckets["bucket1"].Numget != 4 {
+		t.Error("Expected a copy of the stats")
+	}
+
+	total := &BucketStats{}
+	for _, s := range []*BucketStats{{Numget: 4, Numcoldget: 1}, {Numget: 4, Numcoldget: 3, Numerr: 1}} {
+		total.merge(s)
+	}
+	expected = BucketStats{Numget: 8, Numcoldget: 4, HitRatio: 0.5, Numerr: 1}
+	if *total != expected {
+		t.Errorf("Expected %+v, got %+v", expected, *total)
+	}
+}
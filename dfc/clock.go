@@ -0,0 +1,51 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is the source of the current time for the logic that makes decisions
+// based on it: token expiration, access times and LRU eviction. Daemons use
+// SystemClock; unit tests use FakeClock to move time forward instantly
+type Clock interface {
+	Now() time.Time
+}
+
+// SystemClock returns the operating system time
+type SystemClock struct{}
+
+// FakeClock is a Clock for tests: its time changes only with Set and Advance
+type FakeClock struct {
+	mtx sync.Mutex
+	now time.Time
+}
+
+func (SystemClock) Now() time.Time { return time.Now() }
+
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.now
+}
+
+func (c *FakeClock) Set(now time.Time) {
+	c.mtx.Lock()
+	c.now = now
+	c.mtx.Unlock()
+}
+
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mtx.Lock()
+	c.now = c.now.Add(d)
+	c.mtx.Unlock()
+}
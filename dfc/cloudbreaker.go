@@ -0,0 +1,161 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+// Circuit breakers of the Cloud buckets.
+// Every target keeps a circuit breaker (see breaker.go) per Cloud bucket, so
+// that an outage of the Cloud region of the bucket does not leave thousands of
+// requests waiting for the provider's timeouts. A bucket whose Cloud calls fail
+// cloud_breaker.failures times in a row - with a 5xx status or a timeout -
+// becomes degraded, and the target fails its Cloud calls right away with 503
+// Service Unavailable: objects not yet cached cannot be read, while the cached
+// ones are still served. With cloud_breaker.serve_stale, the cached objects are
+// served even if their versions cannot be validated (version_config.validate_warm_get).
+// Every cloud_breaker.probe_interval, one call is let through to the Cloud, and
+// the first one that succeeds restores the bucket. The state of the breakers is
+// reported with the target stats.
+// Regardless of the breakers, a Cloud bucket with the serve_stale property
+// trades consistency for availability: when the Cloud fails to validate the
+// version of a cached object or to refresh the changed object, the target serves
+// the cached copy with the Warning header - unless the copy is older than the
+// bucket's max_stale.
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Warning headers of the stale cached objects (RFC 7234)
+const (
+	warnStale              = `110 - "Response is Stale"`
+	warnRevalidationFailed = `111 - "Revalidation Failed"`
+)
+
+// breakercloud fails the calls to the degraded Cloud buckets
+type breakercloud struct {
+	cloudif
+	b *breakers
+}
+
+// cloudFailed tells whether the Cloud call has failed because of the provider
+func cloudFailed(cerr *Error) bool {
+	return cerr != nil && providerFailure(cerr.Status)
+}
+
+// providerFailure tells whether the status is that of a failure of the
+// provider rather than of the request; 0 - unknown
+func providerFailure(status int) bool {
+	return status == 0 || status >= http.StatusInternalServerError || status == http.StatusRequestTimeout
+}
+
+// serveStale tells whether the cached copy of the Cloud object may be served
+// after the Cloud has failed to validate or refresh it with the status
+func (t *targetrunner) serveStale(bucket, fqn string, status int) bool {
+	if ctx.config.CloudBreaker.ServeStale && t.cloudbreakers.degraded(bucket) {
+		return true
+	}
+	_, props := t.bmdowner.get().get(bucket, false)
+	if !props.ServeStale || !providerFailure(status) {
+		return false
+	}
+	finfo, err := os.Stat(fqn)
+	if err != nil {
+		return false
+	}
+	if props.MaxStale == "" {
+		return true
+	}
+	maxStale, err := time.ParseDuration(props.MaxStale)
+	return err == nil && time.Since(finfo.ModTime()) <= maxStale
+}
+
+func (c *breakercloud) call(key string, f func() *Error) *Error {
+	ok, probe := c.b.allow(key, time.Now())
+	if !ok && !probe {
+		cerr := NewError(http.StatusServiceUnavailable, "Cloud bucket %s is degraded", key)
+		cerr.RetryAfter = int(c.b.conf.ProbeInterval / time.Second)
+		return cerr
+	}
+	cerr := f()
+	if probe {
+		c.b.probed(key, cloudFailed(cerr), time.Now())
+	} else {
+		c.b.done(key, cloudFailed(cerr), time.Now())
+	}
+	return cerr
+}
+
+func (c *breakercloud) listbucket(ct context.Context, bucket string, msg *GetMsg) (jsbytes []byte, cerr *Error) {
+	cerr = c.call(bucket, func() *Error {
+		jsbytes, cerr = c.cloudif.listbucket(ct, bucket, msg)
+		return cerr
+	})
+	return
+}
+
+func (c *breakercloud) headbucket(ct context.Context, bucket string) (bucketprops simplekvs, cerr *Error) {
+	cerr = c.call(bucket, func() *Error {
+		bucketprops, cerr = c.cloudif.headbucket(ct, bucket)
+		return cerr
+	})
+	return
+}
+
+// the bucket names are listed with the breaker of the Cloud provider
+func (c *breakercloud) getbucketnames(ct context.Context) (buckets []string, cerr *Error) {
+	cerr = c.call(ctx.config.CloudProvider, func() *Error {
+		buckets, cerr = c.cloudif.getbucketnames(ct)
+		return cerr
+	})
+	return
+}
+
+func (c *breakercloud) headobject(ct context.Context, bucket string, objname string) (objmeta simplekvs, cerr *Error) {
+	cerr = c.call(bucket, func() *Error {
+		objmeta, cerr = c.cloudif.headobject(ct, bucket, objname)
+		return cerr
+	})
+	return
+}
+
+func (c *breakercloud) getobj(ct context.Context, fqn, bucket, objname string) (props *objectProps, cerr *Error) {
+	cerr = c.call(bucket, func() *Error {
+		props, cerr = c.cloudif.getobj(ct, fqn, bucket, objname)
+		return cerr
+	})
+	return
+}
+
+func (c *breakercloud) getobjrange(ct context.Context, bucket, objname string, rng *httpRange) (rr *rangeReader, cerr *Error) {
+	cerr = c.call(bucket, func() *Error {
+		rr, cerr = c.cloudif.getobjrange(ct, bucket, objname, rng)
+		return cerr
+	})
+	return
+}
+
+func (c *breakercloud) putobj(ct context.Context, file io.Reader, bucket, objname string, ohobj cksumvalue) (version string, cerr *Error) {
+	cerr = c.call(bucket, func() *Error {
+		version, cerr = c.cloudif.putobj(ct, file, bucket, objname, ohobj)
+		return cerr
+	})
+	return
+}
+
+func (c *breakercloud) deleteobj(ct context.Context, bucket, objname string) (cerr *Error) {
+	return c.call(bucket, func() *Error {
+		return c.cloudif.deleteobj(ct, bucket, objname)
+	})
+}
+
+func (c *breakercloud) restoreobj(ct context.Context, bucket, objname string, msg *RestoreMsg) (cerr *Error) {
+	return c.call(bucket, func() *Error {
+		return c.cloudif.restoreobj(ct, bucket, objname, msg)
+	})
+}
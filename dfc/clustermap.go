@@ -32,6 +32,9 @@ type daemonInfo struct {
 	DaemonPort string `json:"daemon_port"`
 	DaemonID   string `json:"daemon_id"`
 	DirectURL  string `json:"direct_url"`
+	// intra-cluster networks, if configured (see intranet.go)
+	IntraControlURL string `json:"intra_control_url,omitempty"`
+	IntraDataURL    string `json:"intra_data_url,omitempty"`
 }
 
 // Cluster Map aka Smap
@@ -40,6 +43,7 @@ type Smap struct {
 	Pmap    map[string]*daemonInfo `json:"pmap"` // proxyID -> proxyInfo
 	ProxySI *daemonInfo            `json:"proxy_si"`
 	Version int64                  `json:"version"`
+	Epoch   int64                  `json:"epoch"` // advances with every change of the primary (see fencing.go)
 }
 
 type smapowner struct {
@@ -23,8 +23,15 @@ const (
 
 // checksums: xattr, http header, and config
 const (
-	XattrXXHashVal  = "user.obj.dfchash"
-	XattrObjVersion = "user.obj.version"
+	XattrXXHashVal       = "user.obj.dfchash"
+	XattrObjVersion      = "user.obj.version"
+	XattrDataKey         = "user.obj.datakey"    // data key of an encrypted object, encrypted with master key
+	XattrCustomerKeyHash = "user.obj.csekhash"   // SHA256 of the customer-supplied key that protects the object
+	XattrPlacementGroup  = "user.obj.pgroup"     // placement group of the object
+	XattrCloudCksum      = "user.obj.cloudcksum" // cloud checksum pending verification (checksum offload)
+	XattrDisplaced       = "user.obj.displaced"  // HRW mountpath of the object stored elsewhere (see placement)
+	XattrObjMeta         = "user.obj.meta"       // properties of the object set by the user (see objmeta.go)
+	XattrECMeta          = "user.obj.ecmeta"     // erasure coding slice and its object (see ec.go)
 
 	ChecksumNone   = "none"
 	ChecksumXXHash = "xxhash"
@@ -36,12 +43,20 @@ const (
 	VersionNone  = "none"
 )
 
+// net.family
+const (
+	netFamilyIPv4 = "ipv4"
+	netFamilyIPv6 = "ipv6"
+)
+
 // $CONFDIR/*
 const (
 	bucketmdbase = "bucket-metadata" // base name of the config file; not to confuse with config.Localbuckets mpath
 	mpname       = "mpaths"          // base name to persist ctx.mountpaths
 	smapname     = "smap.json"
 	rebinpname   = ".rebalancing"
+	daemonidname = "daemonid.json"
+	egressname   = "egress.json" // cloud egress usage of the month (primary proxy)
 )
 
 //==============================
@@ -54,6 +69,7 @@ type dfconfig struct {
 	CloudProvider    string            `json:"cloudprovider"`
 	CloudBuckets     string            `json:"cloud_buckets"`
 	LocalBuckets     string            `json:"local_buckets"`
+	TimeFormat       string            `json:"time_format"` // default GetMsg.GetTimeFormat; "RFC822" for older clients
 	Log              logconfig         `json:"log"`
 	Periodic         periodic          `json:"periodic"`
 	Timeout          timeoutconfig     `json:"timeout"`
@@ -69,6 +85,26 @@ type dfconfig struct {
 	Auth             authconf          `json:"auth"`
 	KeepaliveTracker keepaliveTrackers `json:"keepalivetracker"`
 	CallStats        callStats         `json:"callstats"`
+	Secrets          secretsconf       `json:"secrets"`
+	ColdGet          coldgetconf       `json:"coldget"`
+	Commit           commitconf        `json:"commit"`
+	DirectIO         directioconf      `json:"direct_io"`
+	Placement        placementconf     `json:"placement"`
+	Alerts           alertconf         `json:"alerts"`
+	Probe            probeconf         `json:"probe"`
+	SmapSync         smapsyncconf      `json:"smap_sync"`
+	Egress           egressconf        `json:"cloud_egress"`
+	PrefetchPlan     prefetchplanconf  `json:"prefetch_plan"`
+	ZeroCopy         zerocopyconf      `json:"zerocopy"`
+	MetaCache        metacacheconf     `json:"metacache"`
+	Destroy          destroyconf       `json:"destroy"`
+	NextTier         breakerconf       `json:"next_tier"`
+	CloudBreaker     cloudbreakerconf  `json:"cloud_breaker"`
+	NegCache         negcacheconf      `json:"negcache"`
+	Pin              pinconf           `json:"pin"`
+	Publish          publishconf       `json:"publish"`
+	Objname          objnameconf       `json:"objname"`
+	Summary          summaryconf       `json:"summary"`
 }
 
 type logconfig struct {
@@ -81,6 +117,7 @@ type logconfig struct {
 type periodic struct {
 	StatsTimeStr     string `json:"stats_time"`
 	RetrySyncTimeStr string `json:"retry_sync_time"`
+	StatsHistory     int    `json:"stats_history"` // number of the latest sampling windows a target keeps, see statsreset.go
 	// omitempty
 	StatsTime     time.Duration `json:"-"`
 	RetrySyncTime time.Duration `json:"-"`
@@ -107,6 +144,7 @@ type timeoutconfig struct {
 type proxyconfig struct {
 	Primary  proxycnf `json:"primary"`
 	Original proxycnf `json:"original"`
+	Fencing  bool     `json:"fencing"` // targets reject the changes requested by a stale primary
 }
 
 type proxycnf struct {
@@ -141,23 +179,58 @@ type testfspathconf struct {
 }
 
 type netconfig struct {
-	IPv4 string  `json:"ipv4"`
-	L4   l4cnf   `json:"l4"`
-	HTTP httpcnf `json:"http"`
+	IPv4   string  `json:"ipv4"`   // comma-separated IPv4 addresses to choose from
+	IPv6   string  `json:"ipv6"`   // comma-separated IPv6 addresses to choose from
+	Family string  `json:"family"` // address family of the advertised address: ipv4 (default) | ipv6
+	L4     l4cnf   `json:"l4"`
+	HTTP   httpcnf `json:"http"`
+	// advertised to clients when NAT-ed (see external.go)
+	External externalcnf `json:"external"`
+	// separate intra-cluster networks (see intranet.go)
+	IntraControl intranetcnf `json:"intra_control"` // keepalives, metasync, elections and other intra-cluster calls
+	IntraData    intranetcnf `json:"intra_data"`    // rebalance, replication and other target-to-target transfers
+}
+
+// intra-cluster network; when not configured, the public one gets used
+type intranetcnf struct {
+	Addrs string `json:"addrs"` // comma-separated addresses (of net.family) to choose from; "" - the public one
+	Port  string `json:"port"`  // listening port; "" - not configured
 }
 
 type l4cnf struct {
 	Proto string `json:"proto"` // tcp, udp
-	Port  string `json:"port"`  // listening port
+	Port  string `json:"port"`  // listening port, range of ports ("8080-8089") or "0" (ephemeral)
+}
+
+// externally reachable address, when it differs from the listening one
+type externalcnf struct {
+	Host     string `json:"host"`     // host name or IP; "" - the listening IP
+	Port     string `json:"port"`     // port; "" - the listening port
+	Discover bool   `json:"discover"` // discover from the platform (Nomad, Marathon) unless set
 }
 
 type httpcnf struct {
-	MaxNumTargets int    `json:"max_num_targets"`    // estimated max num targets (to count idle conns)
-	UseHTTP2      bool   `json:"use_http2"`          // use HTTP/2 instead of HTTP/1.1
-	UseHTTPS      bool   `json:"use_https"`          // use HTTPS instead of HTTP
-	UseAsProxy    bool   `json:"use_as_proxy"`       // use DFC as an HTTP proxy
-	Certificate   string `json:"server_certificate"` // HTTPS: openssl certificate
-	Key           string `json:"server_key"`         // HTTPS: openssl key
+	MaxNumTargets int          `json:"max_num_targets"`    // estimated max num targets (to count idle conns)
+	UseHTTP2      bool         `json:"use_http2"`          // use HTTP/2 instead of HTTP/1.1
+	UseHTTPS      bool         `json:"use_https"`          // use HTTPS instead of HTTP
+	UseAsProxy    bool         `json:"use_as_proxy"`       // use DFC as an HTTP proxy
+	Certificate   string       `json:"server_certificate"` // HTTPS: openssl certificate
+	Key           string       `json:"server_key"`         // HTTPS: openssl key
+	Pool          httppoolconf `json:"pool"`               // intra-cluster clients
+}
+
+// intra-cluster HTTP clients (see peerclients.go)
+type httppoolconf struct {
+	PerPeer                  bool          `json:"per_peer"`                // a client and a connection pool per peer
+	MaxIdleConnsPerPeer      int           `json:"max_idle_conns_per_peer"` // 0 - 4 (target), 8 (proxy)
+	DialTimeoutStr           string        `json:"dial_timeout"`            // empty - 30s
+	DialTimeout              time.Duration `json:"-"`
+	TLSHandshakeTimeoutStr   string        `json:"tls_handshake_timeout"` // empty - 10s
+	TLSHandshakeTimeout      time.Duration `json:"-"`
+	ResponseHeaderTimeoutStr string        `json:"response_header_timeout"` // empty - none
+	ResponseHeaderTimeout    time.Duration `json:"-"`
+	IdleConnTimeoutStr       string        `json:"idle_conn_timeout"` // empty - 90s
+	IdleConnTimeout          time.Duration `json:"-"`
 }
 
 type cksumconfig struct {
@@ -165,6 +238,7 @@ type cksumconfig struct {
 	ValidateColdGet         bool   `json:"validate_checksum_cold_get"` // MD5 (ETag) validation upon cold GET
 	ValidateWarmGet         bool   `json:"validate_checksum_warm_get"` // MD5 (ETag) validation upon warm GET
 	EnableReadRangeChecksum bool   `json:"enable_read_range_checksum"` // Return read range checksum otherwise return entire object checksum
+	OffloadColdGet          bool   `json:"offload_checksum_cold_get"`  // Trust cloud checksum upon cold GET, verify in background
 }
 
 type versionconfig struct {
@@ -181,9 +255,153 @@ type fskeeperconf struct {
 }
 
 type authconf struct {
-	Secret  string `json:"secret"`
-	Enabled bool   `json:"enabled"`
-	CredDir string `json:"creddir"`
+	Secret              string        `json:"secret"`
+	Enabled             bool          `json:"enabled"`
+	CredDir             string        `json:"creddir"`
+	MaxTokenLifetimeStr string        `json:"max_token_lifetime"` // user tokens that live longer are rejected, empty - no limit
+	MaxTokenLifetime    time.Duration `json:"-"`
+	AuthnURL            string        `json:"authn_url"` // to pull revoked tokens at startup, empty - wait for AuthN to push them
+}
+
+// sensitive configuration (see Secret* enum) can be fetched from a secrets
+// provider at startup and refreshed periodically
+type secretsconf struct {
+	Provider   string        `json:"provider"`     // empty - secrets are in this config, or one of SecretsProvider* enum
+	URL        string        `json:"url"`          // vault: server address, aws_kms: region, gcp_kms: key name
+	Path       string        `json:"path"`         // file, aws_kms, gcp_kms: path to JSON file, vault: secret path
+	RefreshStr string        `json:"refresh_time"` // how often to re-read secrets, empty or 0 - never
+	Refresh    time.Duration `json:"-"`            // omitempty
+}
+
+// cold GET downloads objects larger than part_size in parts, up to
+// concurrency parts at a time; part_size 0 (zero) or concurrency below 2
+// disable parallel download
+type coldgetconf struct {
+	PartSize    int64 `json:"part_size"`   // bytes
+	Concurrency int   `json:"concurrency"` // max number of parts downloaded concurrently per object
+}
+
+// commit protocol of the write path (see workfile.go)
+type commitconf struct {
+	Fsync string `json:"fsync"` // fsync policy: never (default), file, dir (see Fsync* enum)
+}
+
+// direct I/O for large writes (see directio.go)
+type directioconf struct {
+	Threshold int64 `json:"threshold"` // objects are written bypassing the page cache past this size; 0 - disabled
+}
+
+// mountpath selection within a target (see placement.go)
+type placementconf struct {
+	MaxUsedPct uint32 `json:"max_used_pct"` // new objects avoid mountpaths used above this; 0 - pure HRW
+}
+
+// alerting rules evaluated by the primary proxy (see alerts.go)
+type alertconf struct {
+	IntervalStr string        `json:"interval"` // how often the rules are evaluated; empty - alerting disabled
+	Interval    time.Duration `json:"-"`        // omitempty
+	Rules       []alertrule   `json:"rules"`
+	Webhooks    []string      `json:"webhooks"` // alert events are POST-ed to these URLs
+	SMTP        string        `json:"smtp"`     // host:port of the mail server; empty - no emails
+	From        string        `json:"from"`     // email sender
+	To          []string      `json:"to"`       // email recipients
+}
+
+type alertrule struct {
+	Kind      string  `json:"kind"`      // one of the Alert* enum
+	Threshold float64 `json:"threshold"` // percent, or milliseconds for AlertProbeLatency; not used by AlertMpathDown
+}
+
+// synthetic probing of the targets by the primary proxy (see probe.go)
+type probeconf struct {
+	IntervalStr string        `json:"interval"` // how often the targets are probed; empty - probing disabled
+	Interval    time.Duration `json:"-"`        // omitempty
+	Size        int64         `json:"size"`     // size of the canary objects; 0 - 4KiB
+	Window      int           `json:"window"`   // number of the latest probes the SLIs are computed over; 0 - 10
+}
+
+// cluster map distribution by the metasyncer (see smapdelta.go)
+type smapsyncconf struct {
+	Delta        bool  `json:"delta"`         // send Smap changes since the previously sync-ed version rather than the full Smap
+	CompressSize int64 `json:"compress_size"` // metasync payloads larger than this are gzip-ed; 0 - never
+}
+
+// cloud egress budget (see egress.go)
+type egressconf struct {
+	Budget  int64 `json:"budget"`   // monthly bytes fetched from the Cloud by the cluster; 0 - unlimited
+	SoftPct int   `json:"soft_pct"` // warn when the usage crosses this % of the cluster or a bucket budget; 0 - never
+	Refuse  bool  `json:"refuse"`   // refuse prefetches once the budget is exhausted
+}
+
+// prefetch cost estimation (see prefetchplan.go)
+type prefetchplanconf struct {
+	RequestCost      float64 `json:"request_cost"`      // price of 1000 cloud requests
+	EgressCost       float64 `json:"egress_cost"`       // price of 1GiB fetched from the Cloud
+	ConfirmThreshold float64 `json:"confirm_threshold"` // prefetches estimated to cost more require confirmation; 0 - never
+}
+
+// zero-copy handoff to co-located processes (see zerocopy.go)
+type zerocopyconf struct {
+	Socket string `json:"socket"` // Unix socket of the target; empty - disabled. Requires the "zerocopy" build tag
+}
+
+// proxy cache of metadata responses (see metacache.go)
+type metacacheconf struct {
+	TTLStr     string        `json:"ttl"`         // how long the responses are cached; empty - caching disabled
+	TTL        time.Duration `json:"-"`           // omitempty
+	MaxEntries int           `json:"max_entries"` // max number of cached responses; 0 - 10000
+}
+
+// target cache of missing Cloud objects (see negcache.go)
+type negcacheconf struct {
+	TTLStr     string        `json:"ttl"`         // how long the missing objects are remembered; empty - caching disabled
+	TTL        time.Duration `json:"-"`           // omitempty
+	MaxEntries int           `json:"max_entries"` // max number of remembered objects; 0 - 10000
+}
+
+// pinned objects (see pin.go)
+type pinconf struct {
+	Capacity int64 `json:"capacity"` // max total size of the objects pinned at a target, bytes; 0 - unlimited
+}
+
+// dataset publishing (see publish.go)
+type publishconf struct {
+	Keep int `json:"keep"` // number of versions of a dataset kept, including the current one
+}
+
+// object name validation and normalization (see objname.go)
+type objnameconf struct {
+	MaxLength int    `json:"max_length"` // max length in bytes; 0 - 1024
+	Charset   string `json:"charset"`    // allowed characters: printable (default) | ascii | safe
+	Normalize string `json:"normalize"`  // Unicode normalization form: "" (none) | nfc | nfd | nfkc | nfkd
+	Slashes   string `json:"slashes"`    // leading and trailing slashes: allow (default) | reject | trim
+	// look up the objects of local buckets stored by older versions under HTML-escaped names
+	LegacyEscaped bool `json:"legacy_escaped"`
+}
+
+// bucket summaries (see summary.go)
+type summaryconf struct {
+	Workers      int           `json:"workers"`    // directories walked in parallel by a target; 0 - number of mountpaths
+	CacheTimeStr string        `json:"cache_time"` // how long the proxy keeps the summaries; empty - not cached
+	CacheTime    time.Duration `json:"-"`          // omitempty
+}
+
+// destruction of local buckets (see destroy.go)
+type destroyconf struct {
+	GraceStr string        `json:"grace"` // local buckets are destroyed after the grace period; empty - right away
+	Grace    time.Duration `json:"-"`     // omitempty
+}
+
+// circuit breakers of the next tiers and the Cloud buckets (see breaker.go)
+type breakerconf struct {
+	Failures         int           `json:"failures"`       // failed requests in a row to degrade an endpoint; 0 - 5
+	ProbeIntervalStr string        `json:"probe_interval"` // how often a degraded endpoint is probed; empty - 10s
+	ProbeInterval    time.Duration `json:"-"`              // omitempty
+}
+
+type cloudbreakerconf struct {
+	breakerconf
+	ServeStale bool `json:"serve_stale"` // serve cached objects without validating their versions while the Cloud bucket is degraded
 }
 
 // config for one keepalive tracker
@@ -200,6 +418,20 @@ type keepaliveTrackerConf struct {
 type keepaliveTrackers struct {
 	Proxy  keepaliveTrackerConf `json:"proxy"`  // how proxy tracks target keepalives
 	Target keepaliveTrackerConf `json:"target"` // how target tracks primary proxies keepalives
+	Gossip gossipconf           `json:"gossip"` // targets gossip heartbeats (see gossip.go)
+}
+
+// gossip-based liveness of the targets
+type gossipconf struct {
+	Enabled            bool          `json:"enabled"`
+	IntervalStr        string        `json:"interval"`         // gossip rounds; empty - 2s
+	Interval           time.Duration `json:"-"`                //
+	Fanout             int           `json:"fanout"`           // peers per round; 0 - 3
+	SuspectTimeStr     string        `json:"suspect_time"`     // no heartbeat of a peer for this long - suspected; empty - 30s
+	SuspectTime        time.Duration `json:"-"`                //
+	Confirmations      int           `json:"confirmations"`    // targets to suspect a target before the primary checks it; 0 - 3
+	PrimaryIntervalStr string        `json:"primary_interval"` // targets still register with the primary; empty - 60s
+	PrimaryInterval    time.Duration `json:"-"`                //
 }
 
 type callStats struct {
@@ -286,6 +518,12 @@ func validateconf() (err error) {
 	if ctx.config.Periodic.StatsTime, err = time.ParseDuration(ctx.config.Periodic.StatsTimeStr); err != nil {
 		return fmt.Errorf("Bad stats-time format %s, err: %v", ctx.config.Periodic.StatsTimeStr, err)
 	}
+	if ctx.config.Periodic.StatsTime <= 0 {
+		return fmt.Errorf("Invalid stats-time %v", ctx.config.Periodic.StatsTime)
+	}
+	if ctx.config.Periodic.StatsHistory < 0 {
+		return fmt.Errorf("Invalid stats_history %d", ctx.config.Periodic.StatsHistory)
+	}
 	if ctx.config.Periodic.RetrySyncTime, err = time.ParseDuration(ctx.config.Periodic.RetrySyncTimeStr); err != nil {
 		return fmt.Errorf("Bad retry_sync_time format %s, err: %v", ctx.config.Periodic.RetrySyncTimeStr, err)
 	}
@@ -367,6 +605,147 @@ func validateconf() (err error) {
 	if !IsKeepaliveTypeSupported(ctx.config.KeepaliveTracker.Target.Name) {
 		return fmt.Errorf("bad target keepalive tracker type %s", ctx.config.KeepaliveTracker.Target.Name)
 	}
+	if err = validateGossip(&ctx.config.KeepaliveTracker.Gossip); err != nil {
+		return err
+	}
+
+	switch ctx.config.Secrets.Provider {
+	case "", SecretsProviderFile, SecretsProviderEnv, SecretsProviderVault:
+	case SecretsProviderAWS, SecretsProviderGCP:
+		if ctx.config.Secrets.Path == "" {
+			return fmt.Errorf("Secrets provider %s requires the path of encrypted secrets", ctx.config.Secrets.Provider)
+		}
+	default:
+		return fmt.Errorf("Invalid secrets provider: %s", ctx.config.Secrets.Provider)
+	}
+	if ctx.config.Secrets.RefreshStr != "" {
+		if ctx.config.Secrets.Refresh, err = time.ParseDuration(ctx.config.Secrets.RefreshStr); err != nil {
+			return fmt.Errorf("Bad secrets refresh_time format %s, err %v", ctx.config.Secrets.RefreshStr, err)
+		}
+	}
+	if ctx.config.Auth.MaxTokenLifetimeStr != "" {
+		if ctx.config.Auth.MaxTokenLifetime, err = time.ParseDuration(ctx.config.Auth.MaxTokenLifetimeStr); err != nil {
+			return fmt.Errorf("Bad auth max_token_lifetime format %s, err %v", ctx.config.Auth.MaxTokenLifetimeStr, err)
+		}
+	}
+	if ctx.config.Commit.Fsync != "" && !validFsyncPolicy(ctx.config.Commit.Fsync) {
+		return fmt.Errorf("Invalid commit fsync policy: %s", ctx.config.Commit.Fsync)
+	}
+	if ctx.config.Placement.MaxUsedPct > 100 {
+		return fmt.Errorf("Invalid placement max_used_pct: %d", ctx.config.Placement.MaxUsedPct)
+	}
+	if ctx.config.Alerts.IntervalStr != "" {
+		if ctx.config.Alerts.Interval, err = time.ParseDuration(ctx.config.Alerts.IntervalStr); err != nil {
+			return fmt.Errorf("Bad alerts interval format %s, err %v", ctx.config.Alerts.IntervalStr, err)
+		}
+	}
+	for _, rule := range ctx.config.Alerts.Rules {
+		if err = validateAlertRule(rule); err != nil {
+			return err
+		}
+	}
+	if ctx.config.Alerts.SMTP != "" && (ctx.config.Alerts.From == "" || len(ctx.config.Alerts.To) == 0) {
+		return fmt.Errorf("Invalid alerts email configuration: sender and recipients are required")
+	}
+	if ctx.config.Probe.IntervalStr != "" {
+		if ctx.config.Probe.Interval, err = time.ParseDuration(ctx.config.Probe.IntervalStr); err != nil {
+			return fmt.Errorf("Bad probe interval format %s, err %v", ctx.config.Probe.IntervalStr, err)
+		}
+	}
+	if err = validateHTTPPool(&ctx.config.Net.HTTP.Pool); err != nil {
+		return err
+	}
+	if ctx.config.MetaCache.TTLStr != "" {
+		if ctx.config.MetaCache.TTL, err = time.ParseDuration(ctx.config.MetaCache.TTLStr); err != nil {
+			return fmt.Errorf("Bad metacache TTL format %s, err %v", ctx.config.MetaCache.TTLStr, err)
+		}
+	}
+	if ctx.config.NegCache.TTLStr != "" {
+		if ctx.config.NegCache.TTL, err = time.ParseDuration(ctx.config.NegCache.TTLStr); err != nil || ctx.config.NegCache.TTL < 0 {
+			return fmt.Errorf("Bad negcache TTL format %s, err %v", ctx.config.NegCache.TTLStr, err)
+		}
+	}
+	if ctx.config.Summary.CacheTimeStr != "" {
+		if ctx.config.Summary.CacheTime, err = time.ParseDuration(ctx.config.Summary.CacheTimeStr); err != nil || ctx.config.Summary.CacheTime < 0 {
+			return fmt.Errorf("Bad summary cache_time format %s, err %v", ctx.config.Summary.CacheTimeStr, err)
+		}
+	}
+	if ctx.config.Destroy.GraceStr != "" {
+		if ctx.config.Destroy.Grace, err = time.ParseDuration(ctx.config.Destroy.GraceStr); err != nil || ctx.config.Destroy.Grace < 0 {
+			return fmt.Errorf("Bad destroy grace format %s, err %v", ctx.config.Destroy.GraceStr, err)
+		}
+	}
+	if err = validateBreaker("next tier", &ctx.config.NextTier); err != nil {
+		return err
+	}
+	if err = validateBreaker("cloud breaker", &ctx.config.CloudBreaker.breakerconf); err != nil {
+		return err
+	}
+	if ctx.config.MetaCache.MaxEntries < 0 {
+		return fmt.Errorf("Invalid metacache max_entries: %d", ctx.config.MetaCache.MaxEntries)
+	}
+	if ctx.config.MetaCache.MaxEntries == 0 {
+		ctx.config.MetaCache.MaxEntries = metaCacheMaxEntries
+	}
+	if ctx.config.Pin.Capacity < 0 {
+		return fmt.Errorf("Invalid pin capacity: %d", ctx.config.Pin.Capacity)
+	}
+	switch ctx.config.Net.Family {
+	case "":
+		ctx.config.Net.Family = netFamilyIPv4
+	case netFamilyIPv4, netFamilyIPv6:
+	default:
+		return fmt.Errorf("Invalid net family %q (expecting %s or %s)", ctx.config.Net.Family, netFamilyIPv4, netFamilyIPv6)
+	}
+	if err := validateObjnameConf(&ctx.config.Objname); err != nil {
+		return err
+	}
+	if _, _, err := parsePortRange(ctx.config.Net.L4.Port); err != nil {
+		return err
+	}
+	if ctx.config.Net.External.Port != "" && !validPort(ctx.config.Net.External.Port) {
+		return fmt.Errorf("Invalid external port: %s", ctx.config.Net.External.Port)
+	}
+	if err := validateIntraNets(&ctx.config.Net); err != nil {
+		return err
+	}
+	if ctx.config.Publish.Keep < 0 {
+		return fmt.Errorf("Invalid publish keep: %d", ctx.config.Publish.Keep)
+	}
+	if ctx.config.Publish.Keep == 0 {
+		ctx.config.Publish.Keep = publishKeep
+	}
+	if ctx.config.Summary.Workers < 0 {
+		return fmt.Errorf("Invalid summary workers: %d", ctx.config.Summary.Workers)
+	}
+	if ctx.config.NegCache.MaxEntries < 0 {
+		return fmt.Errorf("Invalid negcache max_entries: %d", ctx.config.NegCache.MaxEntries)
+	}
+	if ctx.config.NegCache.MaxEntries == 0 {
+		ctx.config.NegCache.MaxEntries = negCacheMaxEntries
+	}
+	if ctx.config.Probe.Size < 0 || ctx.config.Probe.Window < 0 {
+		return fmt.Errorf("Invalid probe size %d or window %d", ctx.config.Probe.Size, ctx.config.Probe.Window)
+	}
+	if ctx.config.Egress.Budget < 0 || ctx.config.Egress.SoftPct < 0 || ctx.config.Egress.SoftPct > 100 {
+		return fmt.Errorf("Invalid cloud egress budget %d or soft limit %d%%", ctx.config.Egress.Budget, ctx.config.Egress.SoftPct)
+	}
+	if pp := &ctx.config.PrefetchPlan; pp.RequestCost < 0 || pp.EgressCost < 0 || pp.ConfirmThreshold < 0 {
+		return fmt.Errorf("Invalid prefetch costs %v/%v or confirmation threshold %v",
+			pp.RequestCost, pp.EgressCost, pp.ConfirmThreshold)
+	}
+	if ctx.config.DirectIO.Threshold < 0 {
+		return fmt.Errorf("Invalid direct I/O threshold: %d", ctx.config.DirectIO.Threshold)
+	}
+	if ctx.config.ColdGet.PartSize < 0 || ctx.config.ColdGet.Concurrency < 0 {
+		return fmt.Errorf("Invalid coldget part_size %d or concurrency %d",
+			ctx.config.ColdGet.PartSize, ctx.config.ColdGet.Concurrency)
+	}
+	if ctx.config.TimeFormat != "" {
+		if _, ok := timeFormats[ctx.config.TimeFormat]; !ok {
+			return fmt.Errorf("Invalid time_format %s", ctx.config.TimeFormat)
+		}
+	}
 
 	return nil
 }
@@ -399,3 +778,81 @@ func setGLogVModule(v string) error {
 
 	return err
 }
+
+func validateHTTPPool(pool *httppoolconf) (err error) {
+	if pool.MaxIdleConnsPerPeer < 0 {
+		return fmt.Errorf("Invalid http pool max_idle_conns_per_peer: %d", pool.MaxIdleConnsPerPeer)
+	}
+	timeouts := []struct {
+		name string
+		str  string
+		dur  *time.Duration
+		def  time.Duration
+	}{
+		{"dial_timeout", pool.DialTimeoutStr, &pool.DialTimeout, 30 * time.Second},
+		{"tls_handshake_timeout", pool.TLSHandshakeTimeoutStr, &pool.TLSHandshakeTimeout, 10 * time.Second},
+		{"response_header_timeout", pool.ResponseHeaderTimeoutStr, &pool.ResponseHeaderTimeout, 0},
+		{"idle_conn_timeout", pool.IdleConnTimeoutStr, &pool.IdleConnTimeout, 90 * time.Second},
+	}
+	for _, t := range timeouts {
+		*t.dur = t.def
+		if t.str == "" {
+			continue
+		}
+		if *t.dur, err = time.ParseDuration(t.str); err != nil || *t.dur < 0 {
+			return fmt.Errorf("Bad http pool %s format %s, err %v", t.name, t.str, err)
+		}
+	}
+	return nil
+}
+
+func validateBreaker(name string, conf *breakerconf) (err error) {
+	if conf.Failures < 0 {
+		return fmt.Errorf("Invalid %s failures: %d", name, conf.Failures)
+	}
+	if conf.Failures == 0 {
+		conf.Failures = breakerFailures
+	}
+	conf.ProbeInterval = breakerProbeInterval
+	if conf.ProbeIntervalStr != "" {
+		if conf.ProbeInterval, err = time.ParseDuration(conf.ProbeIntervalStr); err != nil || conf.ProbeInterval <= 0 {
+			return fmt.Errorf("Bad %s probe interval format %s, err %v", name, conf.ProbeIntervalStr, err)
+		}
+	}
+	return nil
+}
+
+func validateGossip(conf *gossipconf) (err error) {
+	if conf.Fanout < 0 || conf.Confirmations < 0 {
+		return fmt.Errorf("Invalid gossip fanout %d or confirmations %d", conf.Fanout, conf.Confirmations)
+	}
+	if conf.Fanout == 0 {
+		conf.Fanout = 3
+	}
+	if conf.Confirmations == 0 {
+		conf.Confirmations = 3
+	}
+	durations := []struct {
+		name string
+		str  string
+		dur  *time.Duration
+		def  time.Duration
+	}{
+		{"interval", conf.IntervalStr, &conf.Interval, 2 * time.Second},
+		{"suspect_time", conf.SuspectTimeStr, &conf.SuspectTime, 30 * time.Second},
+		{"primary_interval", conf.PrimaryIntervalStr, &conf.PrimaryInterval, 60 * time.Second},
+	}
+	for _, d := range durations {
+		*d.dur = d.def
+		if d.str == "" {
+			continue
+		}
+		if *d.dur, err = time.ParseDuration(d.str); err != nil || *d.dur <= 0 {
+			return fmt.Errorf("Bad gossip %s format %s, err %v", d.name, d.str, err)
+		}
+	}
+	if conf.SuspectTime <= conf.Interval {
+		return fmt.Errorf("Invalid gossip suspect_time %v: must exceed the interval %v", conf.SuspectTime, conf.Interval)
+	}
+	return nil
+}
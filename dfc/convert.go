@@ -0,0 +1,733 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"archive/tar"
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NVIDIA/dfcpub/3rdparty/glog"
+)
+
+// Shard conversion. Upon POST {"action": "convert"} /v1/buckets/bucket-name
+// each target converts the shards of the bucket it stores into the given
+// format and writes the results to a local bucket, so that the data does
+// not make a round trip through a client. A shard is a tar (.tar), TFRecord
+// (.tfrecord) or RecordIO (.rec) file; the converted shard keeps the name and
+// gets the extension of its format.
+//
+// The unit of conversion is a sample. In a tar, a sample is a run of
+// consecutive members that share the key - the name up to the first dot of
+// the base name - e.g. n01440764_10026.jpg and n01440764_10026.cls. In
+// TFRecord and RecordIO files, a sample is a record that holds a serialized
+// tf.train.Example: the key is the "__key__" feature, and every member is a
+// bytes feature named by the member's extension (path-escaped in the tar).
+// Numeric features of records become text members, one value per line.
+// RecordIO records are framed as in dmlc-core; MXNet's image records (im2rec)
+// are not decoded.
+
+const (
+	convertname       = "convert.json"
+	sampleKeyFeature  = "__key__"
+	recordioMagic     = 0xced7230a
+	recordioMaxSize   = 1<<29 - 1
+	tfrecordMaskDelta = 0xa282ead8
+	maxRecordSize     = 4 * GiB
+)
+
+var (
+	formatExts = map[string]string{FormatTar: ".tar", FormatTFRecord: ".tfrecord", FormatRecordIO: ".rec"}
+	crc32c     = crc32.MakeTable(crc32.Castagnoli)
+
+	errInvalidExample = errors.New("invalid tf.train.Example")
+)
+
+type (
+	sampleMember struct {
+		name string // the feature name or the member's extension
+		data []byte
+	}
+	sample struct {
+		key     string
+		members []sampleMember
+	}
+	sampleWriter interface {
+		write(s *sample) error
+		close() error
+	}
+	tarSampleWriter struct {
+		tw    *tar.Writer
+		mtime time.Time
+	}
+	recordSampleWriter struct {
+		w      io.Writer
+		format string
+	}
+)
+
+func parseConvertMsg(msg *ActionMsg) (*ConvertMsg, error) {
+	convmsg := &ConvertMsg{}
+	if msg.Value != nil {
+		b, err := json.Marshal(msg.Value)
+		if err == nil {
+			err = json.Unmarshal(b, convmsg)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Invalid conversion parameters %v, err: %v", msg.Value, err)
+		}
+	}
+	if _, ok := formatExts[convmsg.Format]; !ok {
+		return nil, fmt.Errorf("Invalid shard format %q: expecting %s, %s or %s",
+			convmsg.Format, FormatTar, FormatTFRecord, FormatRecordIO)
+	}
+	if convmsg.Bucket == "" {
+		return nil, fmt.Errorf("Conversion requires the destination bucket")
+	}
+	return convmsg, nil
+}
+
+// shardFormat returns the format of the shard and its name without the
+// extension; the format is empty if the object is not a shard
+func shardFormat(name string) (format, base string) {
+	for format, ext := range formatExts {
+		if strings.HasSuffix(name, ext) {
+			return format, strings.TrimSuffix(name, ext)
+		}
+	}
+	return "", name
+}
+
+// convertShard reads the shard of one format and writes it in the other;
+// returns the number of samples
+func convertShard(r io.Reader, from, to, shard string, w io.Writer) (samples int64, err error) {
+	var (
+		sw sampleWriter
+		bw = bufio.NewWriter(w)
+	)
+	if to == FormatTar {
+		sw = &tarSampleWriter{tw: tar.NewWriter(bw), mtime: time.Now()}
+	} else {
+		sw = &recordSampleWriter{w: bw, format: to}
+	}
+	write := func(s *sample) error {
+		samples++
+		return sw.write(s)
+	}
+	if from == FormatTar {
+		err = readTarSamples(r, write)
+	} else {
+		err = readRecordSamples(r, from, shard, write)
+	}
+	if err == nil {
+		err = sw.close()
+	}
+	if err == nil {
+		err = bw.Flush()
+	}
+	return
+}
+
+//
+// tar
+//
+
+func readTarSamples(r io.Reader, fn func(s *sample) error) error {
+	var (
+		tr  = tar.NewReader(r)
+		cur *sample
+	)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA {
+			continue
+		}
+		key, ext := sampleKey(hdr.Name)
+		if name, err := url.PathUnescape(ext); err == nil {
+			ext = name
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return err
+		}
+		if cur != nil && cur.key != key {
+			if err = fn(cur); err != nil {
+				return err
+			}
+			cur = nil
+		}
+		if cur == nil {
+			cur = &sample{key: key}
+		}
+		cur.members = append(cur.members, sampleMember{name: ext, data: data})
+	}
+	if cur != nil {
+		return fn(cur)
+	}
+	return nil
+}
+
+// sampleKey splits the member name at the first dot of its base name
+func sampleKey(name string) (key, ext string) {
+	dir, base := path.Split(name)
+	if i := strings.Index(base, "."); i >= 0 {
+		return dir + base[:i], base[i+1:]
+	}
+	return name, ""
+}
+
+func (sw *tarSampleWriter) write(s *sample) error {
+	for _, m := range s.members {
+		name := s.key
+		if m.name != "" {
+			name += "." + url.PathEscape(m.name)
+		}
+		hdr := &tar.Header{Typeflag: tar.TypeReg, Name: name, Size: int64(len(m.data)), Mode: 0644, ModTime: sw.mtime}
+		if err := sw.tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := sw.tw.Write(m.data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (sw *tarSampleWriter) close() error { return sw.tw.Close() }
+
+//
+// TFRecord and RecordIO
+//
+
+func readRecordSamples(r io.Reader, format, shard string, fn func(s *sample) error) error {
+	br := bufio.NewReader(r)
+	for n := 0; ; n++ {
+		var (
+			record []byte
+			err    error
+		)
+		if format == FormatTFRecord {
+			record, err = readTFRecord(br)
+		} else {
+			record, err = readRecordIO(br)
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("record #%d: %v", n, err)
+		}
+		s, err := decodeExample(record)
+		if err != nil {
+			return fmt.Errorf("record #%d: %v", n, err)
+		}
+		if s.key == "" {
+			s.key = fmt.Sprintf("%s-%06d", path.Base(shard), n)
+		}
+		if err = fn(s); err != nil {
+			return err
+		}
+	}
+}
+
+func (sw *recordSampleWriter) write(s *sample) error {
+	record := encodeExample(s)
+	if sw.format == FormatTFRecord {
+		return writeTFRecord(sw.w, record)
+	}
+	return writeRecordIO(sw.w, record)
+}
+
+func (sw *recordSampleWriter) close() error { return nil }
+
+func maskedCRC(b []byte) uint32 {
+	crc := crc32.Checksum(b, crc32c)
+	return (crc>>15 | crc<<17) + tfrecordMaskDelta
+}
+
+// TFRecord: length (uint64), masked CRC32C of the length, data, masked CRC32C of the data
+func writeTFRecord(w io.Writer, data []byte) error {
+	var hdr [12]byte
+	binary.LittleEndian.PutUint64(hdr[:8], uint64(len(data)))
+	binary.LittleEndian.PutUint32(hdr[8:], maskedCRC(hdr[:8]))
+	var footer [4]byte
+	binary.LittleEndian.PutUint32(footer[:], maskedCRC(data))
+	for _, b := range [][]byte{hdr[:], data, footer[:]} {
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readTFRecord(r io.Reader) ([]byte, error) {
+	var hdr [12]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+	if maskedCRC(hdr[:8]) != binary.LittleEndian.Uint32(hdr[8:]) {
+		return nil, errors.New("corrupt TFRecord length")
+	}
+	size := binary.LittleEndian.Uint64(hdr[:8])
+	if size > maxRecordSize {
+		return nil, fmt.Errorf("TFRecord of %d bytes is too large", size)
+	}
+	data := make([]byte, size+4)
+	if _, err := io.ReadFull(r, data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	if maskedCRC(data[:size]) != binary.LittleEndian.Uint32(data[size:]) {
+		return nil, errors.New("corrupt TFRecord data")
+	}
+	return data[:size], nil
+}
+
+// RecordIO: magic, cflag (3 bits) and length (29 bits), data padded to 4
+// bytes. A record that contains the magic at 4-byte aligned offsets is split
+// there into parts: cflag 1 - first, 2 - middle, 3 - last part; 0 - whole
+func writeRecordIO(w io.Writer, data []byte) error {
+	if len(data) > recordioMaxSize {
+		return fmt.Errorf("record of %d bytes is too large for RecordIO", len(data))
+	}
+	dptr := 0
+	for i := 0; i+4 <= len(data); i += 4 {
+		if binary.LittleEndian.Uint32(data[i:]) == recordioMagic {
+			cflag := uint32(2)
+			if dptr == 0 {
+				cflag = 1
+			}
+			if err := writeRecordIOPart(w, cflag, data[dptr:i]); err != nil {
+				return err
+			}
+			dptr = i + 4
+		}
+	}
+	cflag := uint32(0)
+	if dptr != 0 {
+		cflag = 3
+	}
+	return writeRecordIOPart(w, cflag, data[dptr:])
+}
+
+func writeRecordIOPart(w io.Writer, cflag uint32, part []byte) error {
+	var hdr [8]byte
+	binary.LittleEndian.PutUint32(hdr[:4], recordioMagic)
+	binary.LittleEndian.PutUint32(hdr[4:], cflag<<29|uint32(len(part)))
+	pad := make([]byte, (4-len(part)%4)%4)
+	for _, b := range [][]byte{hdr[:], part, pad} {
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readRecordIO(r io.Reader) ([]byte, error) {
+	var data []byte
+	for first := true; ; first = false {
+		var hdr [8]byte
+		if _, err := io.ReadFull(r, hdr[:]); err != nil {
+			if err == io.EOF && !first {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		if binary.LittleEndian.Uint32(hdr[:4]) != recordioMagic {
+			return nil, errors.New("invalid RecordIO magic")
+		}
+		lrec := binary.LittleEndian.Uint32(hdr[4:])
+		cflag, size := lrec>>29, lrec&recordioMaxSize
+		part := make([]byte, (size+3)&^3)
+		if _, err := io.ReadFull(r, part); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		part = part[:size]
+		switch {
+		case first && cflag == 0:
+			return part, nil
+		case first && cflag == 1:
+			data = part
+		case !first && (cflag == 2 || cflag == 3):
+			data = append(data, hdr[:4]...) // the magic the record was split at
+			data = append(data, part...)
+			if cflag == 3 {
+				return data, nil
+			}
+		default:
+			return nil, fmt.Errorf("invalid RecordIO continuation flag %d", cflag)
+		}
+	}
+}
+
+//
+// tf.train.Example: Features features = 1; Features: map<string, Feature>
+// feature = 1; Feature: oneof {BytesList bytes_list = 1; FloatList
+// float_list = 2; Int64List int64_list = 3}; the lists: repeated value = 1
+//
+
+func encodeExample(s *sample) []byte {
+	features := appendFeature(nil, sampleKeyFeature, []byte(s.key))
+	for _, m := range s.members {
+		features = appendFeature(features, m.name, m.data)
+	}
+	return appendProtoField(nil, 1, features)
+}
+
+func appendFeature(b []byte, name string, value []byte) []byte {
+	feature := appendProtoField(nil, 1, appendProtoField(nil, 1, value)) // bytes_list
+	entry := appendProtoField(nil, 1, []byte(name))
+	entry = appendProtoField(entry, 2, feature)
+	return appendProtoField(b, 1, entry)
+}
+
+// appendProtoField appends the length-delimited field
+func appendProtoField(b []byte, field int, data []byte) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	b = append(b, byte(field<<3|2))
+	n := binary.PutUvarint(buf[:], uint64(len(data)))
+	b = append(b, buf[:n]...)
+	return append(b, data...)
+}
+
+func decodeExample(record []byte) (*sample, error) {
+	s := &sample{}
+	err := protoFields(record, func(field, wiretype int, features []byte) error {
+		if field != 1 || wiretype != 2 {
+			return nil
+		}
+		return protoFields(features, func(field, wiretype int, entry []byte) error {
+			if field != 1 || wiretype != 2 {
+				return nil
+			}
+			var (
+				name  string
+				value []byte
+			)
+			err := protoFields(entry, func(field, wiretype int, data []byte) (err error) {
+				if wiretype != 2 {
+					return nil
+				}
+				switch field {
+				case 1:
+					name = string(data)
+				case 2:
+					value, err = featureValue(name, data)
+				}
+				return
+			})
+			if err != nil {
+				return err
+			}
+			if name == sampleKeyFeature {
+				s.key = string(value)
+			} else {
+				s.members = append(s.members, sampleMember{name: name, data: value})
+			}
+			return nil
+		})
+	})
+	return s, err
+}
+
+// featureValue returns the value of the bytes feature, or the values of the
+// numeric one as text
+func featureValue(name string, feature []byte) ([]byte, error) {
+	var (
+		value  []byte
+		values int
+	)
+	err := protoFields(feature, func(kind, wiretype int, list []byte) error {
+		if wiretype != 2 {
+			return nil
+		}
+		return protoFields(list, func(field, wiretype int, data []byte) error {
+			if field != 1 {
+				return nil
+			}
+			switch kind {
+			case 1: // bytes_list
+				if values++; values > 1 {
+					return fmt.Errorf("feature %q: only single-valued bytes features are supported", name)
+				}
+				value = data
+			case 2: // float_list, packed or not
+				for ; len(data) >= 4; data = data[4:] {
+					f := math.Float32frombits(binary.LittleEndian.Uint32(data))
+					value = strconv.AppendFloat(value, float64(f), 'g', -1, 32)
+					value = append(value, '\n')
+				}
+			case 3: // int64_list, packed or not
+				for len(data) > 0 {
+					v, n := binary.Uvarint(data)
+					if n <= 0 {
+						return errInvalidExample
+					}
+					value = strconv.AppendInt(value, int64(v), 10)
+					value = append(value, '\n')
+					data = data[n:]
+				}
+			}
+			return nil
+		})
+	})
+	return value, err
+}
+
+// protoFields calls fn for each field of the protobuf message; the data of a
+// varint or a fixed-size field is its encoding
+func protoFields(b []byte, fn func(field, wiretype int, data []byte) error) error {
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		if n <= 0 {
+			return errInvalidExample
+		}
+		b = b[n:]
+		field, wiretype, size := int(tag>>3), int(tag&7), 0
+		switch wiretype {
+		case 0:
+			if _, size = binary.Uvarint(b); size <= 0 {
+				return errInvalidExample
+			}
+		case 1:
+			size = 8
+		case 2:
+			l, n := binary.Uvarint(b)
+			if n <= 0 || l > uint64(len(b)-n) {
+				return errInvalidExample
+			}
+			b, size = b[n:], int(l)
+		case 5:
+			size = 4
+		default:
+			return errInvalidExample
+		}
+		if size > len(b) {
+			return errInvalidExample
+		}
+		if err := fn(field, wiretype, b[:size]); err != nil {
+			return err
+		}
+		b = b[size:]
+	}
+	return nil
+}
+
+//
+// target
+//
+
+// startConvert starts the conversion in the background
+func (t *targetrunner) startConvert(w http.ResponseWriter, r *http.Request, msg *ActionMsg) {
+	apitems := t.restAPIItems(r.URL.Path, 5)
+	if apitems = t.checkRestAPI(w, r, apitems, 1, Rversion, Rbuckets); apitems == nil {
+		return
+	}
+	bucket := apitems[0]
+	convmsg, err := parseConvertMsg(msg)
+	if err != nil {
+		t.invalmsghdlr(w, r, err.Error())
+		return
+	}
+	if !t.bmdowner.get().islocal(convmsg.Bucket) {
+		t.invalmsghdlr(w, r, fmt.Sprintf("Cannot convert into %s: not a local bucket", convmsg.Bucket))
+		return
+	}
+	xconv, errstr := t.xactinp.renewConvert(t, bucket, convmsg)
+	if errstr != "" {
+		t.invalmsghdlr(w, r, errstr, http.StatusConflict)
+		return
+	}
+	go t.runConvert(xconv)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func newConvertResult(t *targetrunner, bucket string) *ConvertResult {
+	result := &ConvertResult{Bucket: bucket, Started: time.Now(), Shards: []string{}}
+	if t.si != nil {
+		result.DaemonID = t.si.DaemonID
+	}
+	return result
+}
+
+func (t *targetrunner) runConvert(xconv *xactConvert) *ConvertResult {
+	glog.Infoln(xconv.tostring())
+	objects, err := t.exportObjects(xconv.bucket, xconv.msg.Prefix)
+	if err != nil {
+		xconv.failed(err.Error())
+	}
+	for _, obj := range objects {
+		if xconv.aborted() {
+			xconv.failed(fmt.Sprintf("%s aborted", xconv.tostring()))
+			break
+		}
+		from, base := shardFormat(obj.name)
+		if from == "" || from == xconv.msg.Format {
+			continue
+		}
+		name := base + formatExts[xconv.msg.Format]
+		samples, err := t.convertObject(xconv, obj, from, name)
+		if err != nil {
+			xconv.failed(err.Error())
+			continue
+		}
+		xconv.mu.Lock()
+		xconv.result.Shards = append(xconv.result.Shards, name)
+		xconv.result.Samples += samples
+		xconv.mu.Unlock()
+	}
+
+	xconv.mu.Lock()
+	result := xconv.result
+	result.Finished = time.Now()
+	xconv.mu.Unlock()
+	if err := LocalSave(filepath.Join(ctx.config.Confdir, convertname), result); err != nil {
+		glog.Errorf("Failed to store the conversion results, err: %v", err)
+	}
+	xconv.etime = time.Now()
+	glog.Infof("%s: %d shards (%d samples), %d errors", xconv.tostring(),
+		len(result.Shards), result.Samples, len(result.Errors))
+	t.xactinp.del(xconv.id)
+	return result
+}
+
+func (xact *xactConvert) failed(errstr string) {
+	glog.Errorf("%s: %s", xact.tostring(), errstr)
+	xact.mu.Lock()
+	xact.result.Errors = append(xact.result.Errors, errstr)
+	xact.mu.Unlock()
+}
+
+// convertObject converts the shard into a work file and stores the latter in
+// the destination bucket
+func (t *targetrunner) convertObject(xconv *xactConvert, obj *exportObject, from, name string) (int64, error) {
+	var workfqn string
+	// any mountpath's work directory - orphans are removed at startup
+	for mpath := range ctx.mountpaths.Available {
+		workfqn = filepath.Join(mpath, mpathWorkDir, ActConvert+"-"+strings.Replace(name, "/", "_", -1))
+		break
+	}
+	if workfqn == "" {
+		return 0, fmt.Errorf("No mountpaths to convert %s", obj.name)
+	}
+	samples, err := t.convertToFile(xconv, obj, from, workfqn)
+	if err != nil {
+		os.Remove(workfqn)
+		return 0, err
+	}
+	if errstr := t.exportToBucket(xconv.msg.Bucket, name, workfqn); errstr != "" {
+		return 0, errors.New(errstr)
+	}
+	return samples, nil
+}
+
+func (t *targetrunner) convertToFile(xconv *xactConvert, obj *exportObject, from, workfqn string) (int64, error) {
+	uname := uniquename(xconv.bucket, obj.name)
+	t.rtnamemap.lockname(uname, false, &pendinginfo{Time: time.Now(), fqn: obj.fqn}, time.Second)
+	defer t.rtnamemap.unlockname(uname, false)
+
+	if csekhash, _ := Getxattr(obj.fqn, XattrCustomerKeyHash); csekhash != nil {
+		return 0, fmt.Errorf("Skipping %s: protected with a customer-supplied key", obj.name)
+	}
+	reader, _, err := openObject(obj.fqn)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to read %s, err: %v", obj.fqn, err)
+	}
+	defer reader.Close()
+	file, err := CreateFile(workfqn)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to create %s, err: %v", workfqn, err)
+	}
+	_, base := shardFormat(obj.name)
+	samples, err := convertShard(reader, from, xconv.msg.Format, base, file)
+	if errclose := file.Close(); err == nil {
+		err = errclose
+	}
+	if err != nil {
+		return 0, fmt.Errorf("Failed to convert %s to %s, err: %v", obj.name, xconv.msg.Format, err)
+	}
+	return samples, nil
+}
+
+// convertResult returns the results of the running conversion, if any, or
+// else of the last one; nil if none
+func (t *targetrunner) convertResult() (*ConvertResult, error) {
+	if _, xx := t.xactinp.findL(ActConvert); xx != nil {
+		xconv := xx.(*xactConvert)
+		xconv.mu.Lock()
+		result := *xconv.result
+		result.Shards = append([]string{}, xconv.result.Shards...)
+		result.Errors = append([]string{}, xconv.result.Errors...)
+		xconv.mu.Unlock()
+		return &result, nil
+	}
+	result := &ConvertResult{}
+	if err := LocalLoad(filepath.Join(ctx.config.Confdir, convertname), result); err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return result, nil
+}
+
+//
+// proxy
+//
+
+// convertBucket starts the conversion at all targets
+func (p *proxyrunner) convertBucket(w http.ResponseWriter, r *http.Request, bucket string, msg *ActionMsg) {
+	convmsg, err := parseConvertMsg(msg)
+	if err != nil {
+		p.invalmsghdlr(w, r, err.Error())
+		return
+	}
+	bucketmd := p.bmdowner.get()
+	if !bucketmd.islocal(convmsg.Bucket) {
+		p.invalmsghdlr(w, r, fmt.Sprintf("Cannot convert into %s: not a local bucket", convmsg.Bucket))
+		return
+	}
+	jsbytes, err := json.Marshal(msg)
+	assert(err == nil, err)
+	q := url.Values{}
+	q.Set(URLParamLocal, strconv.FormatBool(bucketmd.islocal(bucket)))
+	results := p.broadcastTargets(URLPath(Rversion, Rbuckets, bucket), q, http.MethodPost, jsbytes,
+		p.smapowner.get(), ctx.config.Timeout.Default)
+	for res := range results {
+		if res.err != nil {
+			p.invalmsghdlr(w, r, fmt.Sprintf("Failed to start conversion at %s: %v (%d: %s)",
+				res.si.DaemonID, res.err, res.status, res.errstr))
+			return
+		}
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,98 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func TestConvertShard(t *testing.T) {
+	magic := make([]byte, 4)
+	binary.LittleEndian.PutUint32(magic, recordioMagic)
+	members := []struct{ name, data string }{
+		{"train/n01440764_10026.jpg", "jpeg"},
+		{"train/n01440764_10026.cls", "0"},
+		{"train/n01443537_2.jpg", "ab" + string(magic) + "cd" + string(magic) + string(magic)},
+		{"train/n01443537_2.cls", "1"},
+		{"train/n01443537_2.meta.json", "{}"},
+		{"train/n01443538_3.jpg", ""},
+	}
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	for _, m := range members {
+		if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: m.name, Size: int64(len(m.data)), Mode: 0644}); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(m.data))
+	}
+	tw.Close()
+
+	for _, format := range []string{FormatTFRecord, FormatRecordIO} {
+		records := &bytes.Buffer{}
+		samples, err := convertShard(bytes.NewReader(buf.Bytes()), FormatTar, format, "train", records)
+		if err != nil || samples != 3 {
+			t.Fatalf("%s: converted %d samples, err: %v", format, samples, err)
+		}
+		shard := &bytes.Buffer{}
+		samples, err = convertShard(bytes.NewReader(records.Bytes()), format, FormatTar, "train", shard)
+		if err != nil || samples != 3 {
+			t.Fatalf("%s: converted %d samples back, err: %v", format, samples, err)
+		}
+		tr := tar.NewReader(shard)
+		for _, m := range members {
+			hdr, err := tr.Next()
+			if err != nil {
+				t.Fatalf("%s: expected %s, err: %v", format, m.name, err)
+			}
+			data, _ := ioutil.ReadAll(tr)
+			if hdr.Name != m.name || string(data) != m.data {
+				t.Errorf("%s: %s (%q), expected %s (%q)", format, hdr.Name, data, m.name, m.data)
+			}
+		}
+		if _, err = tr.Next(); err != io.EOF {
+			t.Errorf("%s: unexpected members past the end, err: %v", format, err)
+		}
+	}
+
+	records := &bytes.Buffer{}
+	if err := writeTFRecord(records, []byte("record")); err != nil {
+		t.Fatal(err)
+	}
+	b := records.Bytes()
+	b[len(b)-5] ^= 1
+	if _, err := readTFRecord(bytes.NewReader(b)); err == nil {
+		t.Error("Expected a corrupt TFRecord to fail")
+	}
+	if _, err := readTFRecord(bytes.NewReader(b[:len(b)-2])); err != io.ErrUnexpectedEOF {
+		t.Errorf("Expected a truncated TFRecord to fail with %v, got %v", io.ErrUnexpectedEOF, err)
+	}
+}
+
+func TestDecodeExample(t *testing.T) {
+	// features {feature {key: "label" value {int64_list {value: [3, 7]}}}
+	//           feature {key: "score" value {float_list {value: 0.5}}}}
+	label := appendProtoField(nil, 1, []byte("label"))
+	label = appendProtoField(label, 2, appendProtoField(nil, 3, []byte{0x0a, 2, 3, 7}))
+	score := appendProtoField(nil, 1, []byte("score"))
+	score = appendProtoField(score, 2, appendProtoField(nil, 2, []byte{0x0d, 0, 0, 0, 0x3f}))
+	features := appendProtoField(appendProtoField(nil, 1, label), 1, score)
+	s, err := decodeExample(appendProtoField(nil, 1, features))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.key != "" || len(s.members) != 2 ||
+		s.members[0].name != "label" || string(s.members[0].data) != "3\n7\n" ||
+		s.members[1].name != "score" || string(s.members[1].data) != "0.5\n" {
+		t.Errorf("Unexpected sample %+v", s)
+	}
+	if _, err = decodeExample([]byte{0x0a, 10, 1}); err == nil {
+		t.Error("Expected a truncated example to fail")
+	}
+}
@@ -0,0 +1,91 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+// Customer-supplied encryption keys (CSEK).
+// A client passes its AES-256 key in HeaderDfcCustomerKey with GET and PUT
+// requests; the target uses the key to read or write the object in GCS and
+// never stores it. The cached copy keeps the SHA256 of the key in xattr, and
+// the target serves the copy only to the requests that present the same key.
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+
+	"github.com/NVIDIA/dfcpub/3rdparty/glog"
+)
+
+const csekKeyLen = 32 // AES-256
+
+// Returns the customer-supplied key of the request or nil if the request
+// does not have one
+func customerKey(r *http.Request) ([]byte, string) {
+	encoded := r.Header.Get(HeaderDfcCustomerKey)
+	if encoded == "" {
+		return nil, ""
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Sprintf("Invalid customer-supplied key, err: %v", err)
+	}
+	if len(key) != csekKeyLen {
+		return nil, fmt.Sprintf("Invalid customer-supplied key length %d (expecting %d bytes)", len(key), csekKeyLen)
+	}
+	return key, ""
+}
+
+// Returns base64-encoded SHA256 of a key (the same format GCS uses)
+func customerKeyHash(key []byte) string {
+	if key == nil {
+		return ""
+	}
+	sum := sha256.Sum256(key)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func customerKeyFromContext(ct context.Context) []byte {
+	if key, ok := ct.Value(ctxCustomerKey).([]byte); ok {
+		return key
+	}
+	return nil
+}
+
+// Checks that a request provides a valid customer-supplied key for a bucket
+// that supports it
+func (t *targetrunner) validateCustomerKey(w http.ResponseWriter, r *http.Request, islocal bool) bool {
+	if r.Header.Get(HeaderDfcCustomerKey) == "" {
+		return true
+	}
+	if islocal || ctx.config.CloudProvider != ProviderGoogle {
+		s := fmt.Sprintf("Customer-supplied encryption keys are supported only for %s buckets", ProviderGoogle)
+		t.invalmsghdlr(w, r, s)
+		return false
+	}
+	if _, errstr := customerKey(r); errstr != "" {
+		t.invalmsghdlr(w, r, errstr)
+		return false
+	}
+	return true
+}
+
+// Checks that the key matches the one that protects the cached object
+func checkCustomerKey(fqn string, key []byte) (errstr string, errcode int) {
+	hash, errx := Getxattr(fqn, XattrCustomerKeyHash)
+	if errx != "" {
+		glog.Errorf("Failed to read %q xattr %s, err %s", fqn, XattrCustomerKeyHash, errx)
+	}
+	if hash == nil {
+		return
+	}
+	if string(hash) != customerKeyHash(key) {
+		return "The object is protected with a customer-supplied key: the request must provide the key",
+			http.StatusForbidden
+	}
+	return
+}
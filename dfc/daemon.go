@@ -28,16 +28,24 @@ const (
 	xfskeeper     = "fskeeper"
 	xatime        = "atime"
 	xmetasyncer   = "metasyncer"
+	xsecrets      = "secretskeeper"
+	xscrubber     = "scrubber"
+	xalerts       = "alerts"
+	xprober       = "prober"
+	xdestroyer    = "destroyer"
+	xfakes3       = "fakes3"
 )
 
 type (
 	cliVars struct {
-		role      string
-		conffile  string
-		loglevel  string
-		statstime time.Duration
-		ntargets  int
-		proxyurl  string
+		role       string
+		conffile   string
+		loglevel   string
+		statstime  time.Duration
+		ntargets   int
+		proxyurl   string
+		fakes3     string
+		fakes3addr string
 	}
 
 	mountedFS struct {
@@ -144,6 +152,8 @@ func init() {
 	flag.DurationVar(&clivars.statstime, "statstime", 0, "http and capacity utilization statistics log interval")
 	flag.IntVar(&clivars.ntargets, "ntargets", 0, "number of storage targets to expect at startup (hint, proxy-only)")
 	flag.StringVar(&clivars.proxyurl, "proxyurl", "", "Override config Proxy settings")
+	flag.StringVar(&clivars.fakes3, "fakes3", "", "directory to serve as fake S3 instead of the configured cloud (target-only)")
+	flag.StringVar(&clivars.fakes3addr, "fakes3addr", "127.0.0.1:0", "listening address of the fake S3")
 }
 
 //==================
@@ -168,6 +178,14 @@ func dfcinit() {
 		runarr: make([]runner, 0, 4),
 		runmap: make(map[string]runner),
 	}
+	// secrets must be loaded before any server starts
+	if ctx.config.Secrets.Provider != "" {
+		k := newSecretsKeeper(&ctx.config.Secrets)
+		if err := k.load(); err != nil {
+			glog.Fatalf("Failed to load secrets from %s: %v", ctx.config.Secrets.Provider, err)
+		}
+		ctx.rg.add(k, xsecrets)
+	}
 	assert(clivars.role == xproxy || clivars.role == xtarget, "Invalid flag: role="+clivars.role)
 	if clivars.role == xproxy {
 		p := &proxyrunner{}
@@ -176,8 +194,26 @@ func dfcinit() {
 		ctx.rg.add(&proxystatsrunner{}, xproxystats)
 		ctx.rg.add(newproxykalive(p), xproxykalive)
 		ctx.rg.add(newmetasyncer(p), xmetasyncer)
+		if ctx.config.Alerts.Interval > 0 {
+			ctx.rg.add(newalertrunner(p, &ctx.config.Alerts), xalerts)
+		}
+		if ctx.config.Probe.Interval > 0 {
+			ctx.rg.add(newproberunner(p, &ctx.config.Probe), xprober)
+		}
+		if ctx.config.Destroy.Grace > 0 {
+			ctx.rg.add(newdestroyrunner(p), xdestroyer)
+		}
 	} else {
-		t := &targetrunner{}
+		if clivars.fakes3 != "" {
+			r, err := newfakes3runner(clivars.fakes3, clivars.fakes3addr)
+			if err != nil {
+				glog.Fatalf("Failed to start fake S3: %v", err)
+			}
+			awsEndpoint = r.endpoint()
+			ctx.config.CloudProvider = ProviderAmazon
+			ctx.rg.add(r, xfakes3)
+		}
+		t := &targetrunner{clock: SystemClock{}}
 		t.initSI()
 		ctx.rg.add(t, xtarget)
 		ctx.rg.add(&storstatsrunner{}, xstorstats)
@@ -195,7 +231,9 @@ func dfcinit() {
 			chstop:   make(chan struct{}, 4),
 			chfqn:    make(chan string, chfqnSize),
 			atimemap: &atimemap{m: make(map[string]time.Time, atimeCacheIni)},
+			clock:    t.clock,
 		}, xatime)
+		ctx.rg.add(newscrubrunner(t), xscrubber)
 
 		// Note:
 		// Move this code from run() to here to fix a race between target run() and storage stats
@@ -300,6 +338,13 @@ func getiostatrunner() *iostatrunner {
 	return rr
 }
 
+func getproberunner() *proberunner {
+	r := ctx.rg.runmap[xprober]
+	rr, _ := r.(*proberunner)
+	// not asserting: probing is optional
+	return rr
+}
+
 func getatimerunner() *atimerunner {
 	r := ctx.rg.runmap[xatime]
 	rr, ok := r.(*atimerunner)
@@ -307,6 +352,13 @@ func getatimerunner() *atimerunner {
 	return rr
 }
 
+func getscrubber() *scrubrunner {
+	r := ctx.rg.runmap[xscrubber]
+	rr, ok := r.(*scrubrunner)
+	assert(ok)
+	return rr
+}
+
 func getcloudif() cloudif {
 	r := ctx.rg.runmap[xtarget]
 	rr, ok := r.(*targetrunner)
@@ -324,6 +376,16 @@ func getFSKeeper() *fsKeeper {
 	return rr
 }
 
+func getsecretskeeper() *secretsKeeper {
+	if ctx.rg == nil || ctx.config.Secrets.Provider == "" {
+		return nil
+	}
+	r := ctx.rg.runmap[xsecrets]
+	rr, ok := r.(*secretsKeeper)
+	assert(ok)
+	return rr
+}
+
 func getmetasyncer() *metasyncer {
 	r := ctx.rg.runmap[xmetasyncer]
 	rr, ok := r.(*metasyncer)
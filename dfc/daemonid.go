@@ -0,0 +1,150 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/NVIDIA/dfcpub/3rdparty/glog"
+	"github.com/OneOfOne/xxhash"
+)
+
+// ============================= Daemon ID ===================================
+// HRW placement is computed over daemon IDs, so a target must keep its ID
+// when it restarts at a different address. The ID is, therefore, generated
+// once and persisted in $CONFDIR; an IP or port change re-registers the
+// daemon under the same ID, and the targets do not rebalance (see
+// receiveSmap) - only adding a new ID is a membership change.
+//
+// The ID can be rotated via PUT /v1/daemon {"action": "rotateid"}: the new
+// ID is persisted as pending and replaces the current one upon restart.
+// The environment variable DFCDAEMONID, if set, overrides the persisted ID.
+// ============================= Daemon ID ===================================
+
+// persisted in $CONFDIR/daemonidname
+type daemonIDConf struct {
+	DaemonID string `json:"daemon_id"`
+	NextID   string `json:"next_id,omitempty"` // pending rotation
+}
+
+// DaemonIDInfo is returned by GET /v1/daemon?what=daemonid and by the ID rotation
+type DaemonIDInfo struct {
+	DaemonID   string `json:"daemon_id"`
+	NextID     string `json:"next_id,omitempty"` // replaces DaemonID upon restart
+	FromEnv    bool   `json:"from_env"`          // DaemonID is set via DFCDAEMONID
+	NodeIPAddr string `json:"node_ip_addr"`
+	DaemonPort string `json:"daemon_port"`
+}
+
+// loadDaemonID returns the persisted ID, applying the pending rotation if
+// any; the very first time the ID is derived from the address (as all DFC
+// versions before did) and persisted
+func loadDaemonID(ipaddr, port string) (id string, err error) {
+	var (
+		conf     = &daemonIDConf{}
+		pathname = filepath.Join(ctx.config.Confdir, daemonidname)
+	)
+	if err = LocalLoad(pathname, conf); err != nil && !os.IsNotExist(err) {
+		return "", fmt.Errorf("Failed to load daemon ID from %s, err: %v", pathname, err)
+	}
+	switch {
+	case conf.NextID != "":
+		glog.Warningf("Rotating daemon ID %s => %s", conf.DaemonID, conf.NextID)
+		conf.DaemonID, conf.NextID = conf.NextID, ""
+	case conf.DaemonID != "":
+		return conf.DaemonID, nil
+	default:
+		// the last byte of IPv4, the last group of IPv6
+		split := strings.FieldsFunc(ipaddr, func(r rune) bool { return r == '.' || r == ':' })
+		cs := xxhash.ChecksumString32S(split[len(split)-1], mLCG32)
+		conf.DaemonID = strconv.Itoa(int(cs&0xffff)) + ":" + port
+	}
+	if err = LocalSave(pathname, conf); err != nil {
+		return "", fmt.Errorf("Failed to persist daemon ID %s in %s, err: %v", conf.DaemonID, pathname, err)
+	}
+	return conf.DaemonID, nil
+}
+
+func newDaemonID() string {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+func validateDaemonID(id string) error {
+	if id == "" || strings.ContainsAny(id, "/?#% \t\n") {
+		return fmt.Errorf("Invalid daemon ID %q", id)
+	}
+	return nil
+}
+
+func (h *httprunner) daemonIDInfo() *DaemonIDInfo {
+	info := &DaemonIDInfo{
+		DaemonID:   h.si.DaemonID,
+		FromEnv:    os.Getenv("DFCDAEMONID") != "",
+		NodeIPAddr: h.si.NodeIPAddr,
+		DaemonPort: h.si.DaemonPort,
+	}
+	conf := &daemonIDConf{}
+	if LocalLoad(filepath.Join(ctx.config.Confdir, daemonidname), conf) == nil {
+		info.NextID = conf.NextID
+	}
+	return info
+}
+
+// rotateDaemonID persists the new ID - given in the message value or
+// generated - that takes effect upon restart
+func (h *httprunner) rotateDaemonID(w http.ResponseWriter, r *http.Request, msg *ActionMsg) {
+	var nextID string
+	if os.Getenv("DFCDAEMONID") != "" {
+		h.invalmsghdlr(w, r, "Daemon ID is set via DFCDAEMONID and cannot be rotated")
+		return
+	}
+	if msg.Value != nil {
+		s, ok := msg.Value.(string)
+		if !ok {
+			h.invalmsghdlr(w, r, "Failed to parse ActionMsg value: not a string")
+			return
+		}
+		nextID = s
+	} else if nextID = newDaemonID(); nextID == "" {
+		h.invalmsghdlr(w, r, "Failed to generate daemon ID", http.StatusInternalServerError)
+		return
+	}
+	if err := validateDaemonID(nextID); err != nil {
+		h.invalmsghdlr(w, r, err.Error())
+		return
+	}
+	if nextID == h.si.DaemonID {
+		h.invalmsghdlr(w, r, fmt.Sprintf("Daemon ID is already %s", nextID))
+		return
+	}
+	if smap := h.smapowner.get(); smap != nil && smap.containsID(nextID) {
+		h.invalmsghdlr(w, r, fmt.Sprintf("Daemon ID %s is in use", nextID), http.StatusConflict)
+		return
+	}
+	pathname := filepath.Join(ctx.config.Confdir, daemonidname)
+	conf := &daemonIDConf{DaemonID: h.si.DaemonID, NextID: nextID}
+	if err := LocalSave(pathname, conf); err != nil {
+		h.invalmsghdlr(w, r, fmt.Sprintf("Failed to persist daemon ID in %s, err: %v", pathname, err),
+			http.StatusInternalServerError)
+		return
+	}
+	glog.Infof("Daemon ID %s will be rotated to %s upon restart", h.si.DaemonID, nextID)
+	jsbytes, err := json.Marshal(h.daemonIDInfo())
+	assert(err == nil, err)
+	h.writeJSON(w, r, jsbytes, "rotateid")
+}
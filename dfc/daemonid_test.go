@@ -0,0 +1,84 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ */
+package dfc
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestDaemonIDStability(t *testing.T) {
+	dir, err := ioutil.TempDir("", "daemonid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	oldconfdir := ctx.config.Confdir
+	defer func() { ctx.config.Confdir = oldconfdir }()
+	ctx.config.Confdir = dir
+
+	id, err := loadDaemonID("10.0.0.1", "8081")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// restart at another address
+	id2, err := loadDaemonID("10.0.7.42", "8082")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != id2 {
+		t.Fatalf("Daemon ID changed with the address: %s => %s", id, id2)
+	}
+
+	target := &targetrunner{}
+	target.si = &daemonInfo{DaemonID: id, NodeIPAddr: "10.0.7.42", DaemonPort: "8082"}
+	target.statsif = &storstatsrunner{}
+	target.smapowner = &smapowner{}
+	smap := newSmap()
+	smap.addTarget(target.si)
+	smap.addTarget(&daemonInfo{DaemonID: "other"})
+	target.smapowner.put(smap)
+
+	rotate := func(value interface{}) *httptest.ResponseRecorder {
+		b, _ := json.Marshal(&ActionMsg{Action: ActRotateID, Value: value})
+		w := httptest.NewRecorder()
+		target.rotateDaemonID(w, httptest.NewRequest(http.MethodPut, "/v1/daemon", bytes.NewReader(b)),
+			&ActionMsg{Action: ActRotateID, Value: value})
+		return w
+	}
+	for _, value := range []interface{}{"other", id, "a/b", 42} {
+		if w := rotate(value); w.Code < http.StatusBadRequest {
+			t.Errorf("Rotation to %v succeeded", value)
+		}
+	}
+	if w := rotate(nil); w.Code != http.StatusOK {
+		t.Fatalf("Rotation failed: %d %s", w.Code, w.Body.String())
+	}
+	w := rotate("newid")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Rotation failed: %d %s", w.Code, w.Body.String())
+	}
+	info := &DaemonIDInfo{}
+	if err = json.Unmarshal(w.Body.Bytes(), info); err != nil {
+		t.Fatal(err)
+	}
+	if info.DaemonID != id || info.NextID != "newid" {
+		t.Fatalf("Unexpected ID info %+v", info)
+	}
+
+	// the new ID takes effect upon restart, once
+	for i := 0; i < 2; i++ {
+		if id2, err = loadDaemonID("10.0.7.43", "8082"); err != nil {
+			t.Fatal(err)
+		}
+		if id2 != "newid" {
+			t.Fatalf("Expected rotated ID, got %s", id2)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+// Safe destruction of local buckets.
+// A local bucket with the "protected" property cannot be destroyed - the
+// property must be cleared (setprops) first. With destroy.grace configured,
+// DELETE {"action": "destroylb"} only marks the bucket for destruction
+// (BucketProps.DestroyAt) and responds with 202 Accepted: the bucket rejects new
+// objects but is otherwise intact, and POST {"action": "undestroylb"} unmarks it
+// within the grace period. Once the grace period is over, the primary proxy
+// removes the bucket from the bucket-metadata (destroyrunner) - as it does right
+// away without the grace period. Either way, the targets then move the bucket's
+// directories to the trash of each mountpath, so that the bucket name can be
+// reused immediately, and purge the trash in the background: the xaction
+// "destroylb" reports the purged files and bytes
+// (GET /v1/cluster?what=xaction&props=destroylb). Trash left over by a previous
+// target process is purged on startup.
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/NVIDIA/dfcpub/3rdparty/glog"
+)
+
+const (
+	trashdir             = ".trash"         // per mountpath
+	destroyCheckInterval = 10 * time.Second // how often the primary looks for buckets past their grace period
+	purgeStatsBatch      = 1000             // purged files to count at once
+)
+
+type destroyrunner struct {
+	namedrunner
+	p      *proxyrunner
+	chstop chan struct{}
+}
+
+//
+// proxy
+//
+
+func newdestroyrunner(p *proxyrunner) *destroyrunner {
+	return &destroyrunner{p: p, chstop: make(chan struct{}, 4)}
+}
+
+func (r *destroyrunner) run() error {
+	glog.Infof("Starting %s", r.name)
+	ticker := time.NewTicker(destroyCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if r.p.smapowner.get().isPrimary(r.p.si) {
+				r.p.destroyExpired(time.Now())
+			}
+		case <-r.chstop:
+			return nil
+		}
+	}
+}
+
+func (r *destroyrunner) stop(err error) {
+	glog.Infof("Stopping %s, err: %v", r.name, err)
+	var v struct{}
+	r.chstop <- v
+	close(r.chstop)
+}
+
+// requestDestroy destroys the local bucket or, with the grace period
+// configured, marks it for destruction
+func (p *proxyrunner) requestDestroy(bucket string, msg *ActionMsg) (marked bool, errstr string, status int) {
+	status = http.StatusBadRequest
+	exists, props := p.bmdowner.get().get(bucket, true)
+	if !exists {
+		errstr = fmt.Sprintf("Bucket %s does not appear to be local", bucket)
+		return
+	}
+	if props.Protected {
+		errstr, status = fmt.Sprintf("Local bucket %s is protected", bucket), http.StatusForbidden
+		return
+	}
+	if props.WORM {
+		errstr, status = fmt.Sprintf("Local bucket %s is write-once (WORM)", bucket), http.StatusForbidden
+		glog.Warningf("WORM: refused to destroy local bucket %s", bucket)
+		return
+	}
+	if ctx.config.Destroy.Grace == 0 {
+		errstr = p.destroyLocalBucket(bucket, msg)
+		return
+	}
+	marked = true
+	if props.DestroyAt != 0 {
+		return
+	}
+	destroyAt := time.Now().Add(ctx.config.Destroy.Grace)
+	glog.Infof("Local bucket %s is to be destroyed at %s", bucket, destroyAt.Format(time.RFC3339))
+	errstr = p.setDestroyAt(bucket, destroyAt.Unix(), msg)
+	return
+}
+
+// undestroy unmarks the local bucket marked for destruction
+func (p *proxyrunner) undestroy(bucket string, msg *ActionMsg) (errstr string) {
+	if exists, props := p.bmdowner.get().get(bucket, true); !exists || props.DestroyAt == 0 {
+		return fmt.Sprintf("Local bucket %s is not marked for destruction", bucket)
+	}
+	glog.Infof("Local bucket %s is no longer to be destroyed", bucket)
+	return p.setDestroyAt(bucket, 0, msg)
+}
+
+func (p *proxyrunner) setDestroyAt(bucket string, destroyAt int64, msg *ActionMsg) (errstr string) {
+	p.bmdowner.Lock()
+	clone := p.bmdowner.get().clone()
+	exists, props := clone.get(bucket, true)
+	if !exists {
+		p.bmdowner.Unlock()
+		return fmt.Sprintf("Local bucket %s "+doesnotexist, bucket)
+	}
+	props.DestroyAt = destroyAt
+	clone.set(bucket, true, props)
+	if errstr = p.savebmdconf(clone); errstr != "" {
+		p.bmdowner.Unlock()
+		return
+	}
+	p.bmdowner.put(clone)
+	p.bmdowner.Unlock()
+	pair := &revspair{clone, msg}
+	p.metasyncer.sync(true, pair)
+	return
+}
+
+// destroyExpired destroys the local buckets whose grace period is over
+func (p *proxyrunner) destroyExpired(now time.Time) {
+	for bucket, props := range p.bmdowner.get().LBmap {
+		if props.DestroyAt == 0 || now.Unix() < props.DestroyAt || props.Protected || props.WORM {
+			continue
+		}
+		glog.Infof("Grace period of local bucket %s is over: destroying", bucket)
+		p.metacache.invalidateBucket(bucket)
+		if errstr := p.destroyLocalBucket(bucket, &ActionMsg{Action: ActDestroyLB}); errstr != "" {
+			glog.Errorln(errstr)
+		}
+	}
+}
+
+// pendingDestroy returns the reason to reject new objects of the bucket, "" if none
+func (p *proxyrunner) pendingDestroy(bucket string) string {
+	if _, props := p.bmdowner.get().get(bucket, true); props.DestroyAt != 0 {
+		return fmt.Sprintf("Local bucket %s is to be destroyed at %s", bucket,
+			time.Unix(props.DestroyAt, 0).Format(time.RFC3339))
+	}
+	return ""
+}
+
+//
+// target
+//
+
+// trashLocalBucket moves the directories of the destroyed local bucket to the trash
+func (t *targetrunner) trashLocalBucket(bucket string) {
+	suffix := fmt.Sprintf(".%d", time.Now().UnixNano())
+	for mpath := range ctx.mountpaths.Available {
+		// the objects, their copies (see mirror.go) and erasure coding slices (see ec.go)
+		for _, d := range []struct{ dir, trashname string }{
+			{filepath.Join(makePathLocal(mpath), bucket), bucket + suffix},
+			{filepath.Join(makePathLocal(makePathMirror(mpath)), bucket), bucket + mirrorDir + suffix},
+			{filepath.Join(makePathEC(mpath), bucket), bucket + ecSliceDir + suffix},
+		} {
+			dir, trashname := d.dir, d.trashname
+			trash := filepath.Join(mpath, trashdir)
+			err := CreateDir(trash)
+			if err == nil {
+				if err = os.Rename(dir, filepath.Join(trash, trashname)); err == nil || os.IsNotExist(err) {
+					continue
+				}
+			}
+			glog.Errorf("Failed to move local bucket dir %q to the trash, err: %v", dir, err)
+			if err = os.RemoveAll(dir); err != nil {
+				glog.Errorf("Failed to destroy local bucket dir %q, err: %v", dir, err)
+			}
+		}
+	}
+}
+
+// runPurge empties the trash of all mountpaths
+func (t *targetrunner) runPurge() {
+	xpurge := t.xactinp.renewPurge(t)
+	if xpurge == nil {
+		return
+	}
+	glog.Infoln(xpurge.tostring())
+	for done := false; !done; done = t.xactinp.purgeDone(xpurge) {
+		for mpath := range ctx.mountpaths.Available {
+			trash := filepath.Join(mpath, trashdir)
+			dirs, err := ioutil.ReadDir(trash)
+			if err != nil && !os.IsNotExist(err) {
+				glog.Errorf("Failed to read %s, err: %v", trash, err)
+			}
+			for _, dir := range dirs {
+				if xpurge.aborted() {
+					break
+				}
+				if err := t.purge(xpurge, filepath.Join(trash, dir.Name())); err != nil {
+					glog.Errorf("Failed to purge %s, err: %v", dir.Name(), err)
+				}
+			}
+		}
+	}
+	glog.Infof("%s: purged %d files, %d bytes", xpurge.tostring(), xpurge.files, xpurge.bytes)
+	t.xactinp.del(xpurge.id)
+}
+
+// purge removes the files one by one, counting them, and then the directory
+func (t *targetrunner) purge(xpurge *xactPurge, dir string) error {
+	var files, nbytes int64
+	walkf := func(fqn string, osfi os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if xpurge.aborted() {
+			return fmt.Errorf("%s aborted, exiting walk", xpurge.tostring())
+		}
+		if osfi.IsDir() {
+			return nil
+		}
+		if err := os.Remove(fqn); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		files++
+		nbytes += osfi.Size()
+		if files == purgeStatsBatch {
+			xpurge.files, xpurge.bytes = xpurge.files+files, xpurge.bytes+nbytes
+			t.statsif.addMany("numpurged", files, "bytespurged", nbytes)
+			files, nbytes = 0, 0
+		}
+		return nil
+	}
+	err := filepath.Walk(dir, walkf)
+	if files > 0 {
+		xpurge.files, xpurge.bytes = xpurge.files+files, xpurge.bytes+nbytes
+		t.statsif.addMany("numpurged", files, "bytespurged", nbytes)
+	}
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
@@ -0,0 +1,70 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDestroyPurge(t *testing.T) {
+	mpath, err := ioutil.TempDir("", "destroy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(mpath)
+	oldavail := ctx.mountpaths.Available
+	defer func() { ctx.mountpaths.Available = oldavail }()
+	ctx.mountpaths.Available = map[string]*mountPath{mpath: {Path: mpath}}
+
+	stats := &storstatsrunner{}
+	target := &targetrunner{}
+	target.statsif = stats
+	target.xactinp = newxactinp()
+
+	bucketdir := filepath.Join(makePathLocal(mpath), "bucket")
+	for i := 0; i < 10; i++ {
+		fqn := filepath.Join(bucketdir, fmt.Sprintf("dir%d", i%3), fmt.Sprintf("obj%d", i))
+		if err = CreateDir(filepath.Dir(fqn)); err != nil {
+			t.Fatal(err)
+		}
+		if err = ioutil.WriteFile(fqn, make([]byte, 100), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	target.trashLocalBucket("bucket")
+	if _, err = os.Stat(bucketdir); !os.IsNotExist(err) {
+		t.Fatalf("Expected %s to be moved to the trash, err: %v", bucketdir, err)
+	}
+	// the bucket name can be reused right away
+	if err = CreateDir(bucketdir); err != nil {
+		t.Fatal(err)
+	}
+
+	// a purge requested while another one is running is done by the latter
+	xpurge := target.xactinp.renewPurge(target)
+	if xpurge == nil || target.xactinp.renewPurge(target) != nil {
+		t.Fatal("Expected a single purge at a time")
+	}
+	if target.xactinp.purgeDone(xpurge) || !target.xactinp.purgeDone(xpurge) {
+		t.Error("Expected the running purge to go again once")
+	}
+	target.xactinp.del(xpurge.id)
+
+	target.runPurge()
+	dirs, err := ioutil.ReadDir(filepath.Join(mpath, trashdir))
+	if err != nil || len(dirs) != 0 {
+		t.Errorf("Expected the trash to be empty: %d entries, err: %v", len(dirs), err)
+	}
+	if stats.Core.Numpurged != 10 || stats.Core.Bytespurged != 1000 {
+		t.Errorf("Purged %d files, %d bytes", stats.Core.Numpurged, stats.Core.Bytespurged)
+	}
+	if _, err = os.Stat(bucketdir); err != nil {
+		t.Errorf("Expected the new %s to survive the purge, err: %v", bucketdir, err)
+	}
+}
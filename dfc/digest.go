@@ -0,0 +1,200 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+// Bucket digest - to verify that a migrated or replicated bucket is identical
+// to the original. Upon GET /v1/buckets/bucket-name?what=digest the proxy
+// collects the names and xxhash checksums of the objects stored by each target -
+// for a Cloud bucket, the cached ones - optionally only those with the given
+// prefix. The objects sorted by name are divided into pages of digestPageSize
+// objects; the digest of a page is the SHA-256 of the names and checksums of its
+// objects, and the digest of the bucket is the SHA-256 of the digests of its
+// pages. The bucket digest thus does not depend on how the objects are placed
+// across the targets, and two buckets can be compared page by page to find the
+// objects that differ. The targets' own digests are computed in the same way.
+// Objects that have no stored checksum are checksummed on the fly.
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/OneOfOne/xxhash"
+)
+
+const digestPageSize = 1024 // objects per page of the bucket digest
+
+// digestEntries returns the digest of the entries sorted by name and the digests of their pages
+func digestEntries(entries []*DigestEntry) (string, []*DigestPage) {
+	var (
+		pages = make([]*DigestPage, 0, (len(entries)+digestPageSize-1)/digestPageSize)
+		root  = sha256.New()
+	)
+	for i := 0; i < len(entries); i += digestPageSize {
+		end := i + digestPageSize
+		if end > len(entries) {
+			end = len(entries)
+		}
+		h := sha256.New()
+		for _, entry := range entries[i:end] {
+			h.Write([]byte(entry.Name))
+			h.Write([]byte{0})
+			h.Write([]byte(entry.Checksum))
+			h.Write([]byte{'\n'})
+		}
+		sum := h.Sum(nil)
+		root.Write(sum)
+		pages = append(pages, &DigestPage{
+			First:   entries[i].Name,
+			Last:    entries[end-1].Name,
+			Objects: end - i,
+			Digest:  hex.EncodeToString(sum),
+		})
+	}
+	return hex.EncodeToString(root.Sum(nil)), pages
+}
+
+// sortEntries sorts the entries by name and checksum, dropping duplicates
+func sortEntries(entries []*DigestEntry) []*DigestEntry {
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Name != entries[j].Name {
+			return entries[i].Name < entries[j].Name
+		}
+		return entries[i].Checksum < entries[j].Checksum
+	})
+	sorted := entries[:0]
+	for i, entry := range entries {
+		if i > 0 && *entry == *entries[i-1] {
+			continue
+		}
+		sorted = append(sorted, entry)
+	}
+	return sorted
+}
+
+//
+// target
+//
+
+// GET /v1/buckets/bucket-name?what=digest
+func (t *targetrunner) httpdigest(w http.ResponseWriter, r *http.Request, bucket string) {
+	digest, err := t.bucketDigest(bucket, r.URL.Query().Get(URLParamPrefix))
+	if err != nil {
+		t.invalmsghdlr(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	jsbytes, err := json.Marshal(digest)
+	assert(err == nil, err)
+	t.writeJSON(w, r, jsbytes, "digest")
+}
+
+// bucketDigest returns the digest of the objects of the bucket stored by the
+// target along with their checksums
+func (t *targetrunner) bucketDigest(bucket, prefix string) (*TargetDigest, error) {
+	objects, err := t.exportObjects(bucket, prefix)
+	if err != nil {
+		return nil, err
+	}
+	digest := &TargetDigest{Entries: make([]*DigestEntry, 0, len(objects))}
+	for _, obj := range objects {
+		cksum, errstr := t.objectChecksum(bucket, obj)
+		if errstr != "" {
+			digest.Errors = append(digest.Errors, errstr)
+			continue
+		}
+		if cksum != "" {
+			digest.Entries = append(digest.Entries, &DigestEntry{Name: obj.name, Checksum: cksum})
+		}
+	}
+	digest.Objects = len(digest.Entries)
+	digest.Digest, _ = digestEntries(digest.Entries)
+	return digest, nil
+}
+
+// objectChecksum returns the stored checksum of the object or computes it;
+// "" if the object has been evicted or deleted in the meantime
+func (t *targetrunner) objectChecksum(bucket string, obj *exportObject) (cksum, errstr string) {
+	uname := uniquename(bucket, obj.name)
+	t.rtnamemap.lockname(uname, false, &pendinginfo{Time: time.Now(), fqn: obj.fqn}, time.Second)
+	defer t.rtnamemap.unlockname(uname, false)
+
+	if val, _ := Getxattr(obj.fqn, XattrXXHashVal); val != nil {
+		return string(val), ""
+	}
+	if csekhash, _ := Getxattr(obj.fqn, XattrCustomerKeyHash); csekhash != nil {
+		return "", fmt.Sprintf("%s: protected with a customer-supplied key and has no checksum", obj.name)
+	}
+	reader, size, err := openObject(obj.fqn)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", ""
+		}
+		return "", fmt.Sprintf("Failed to read %s, err: %v", obj.fqn, err)
+	}
+	defer reader.Close()
+	slab := selectslab(size)
+	buf := slab.alloc()
+	defer slab.free(buf)
+	if cksum, errstr = ComputeXXHash(reader, buf, xxhash.New64()); errstr != "" {
+		errstr = fmt.Sprintf("Failed to checksum %s, err: %s", obj.fqn, errstr)
+	}
+	return
+}
+
+//
+// proxy
+//
+
+// GET /v1/buckets/bucket-name?what=digest
+func (p *proxyrunner) httpdigest(w http.ResponseWriter, r *http.Request, bucket string) {
+	prefix := r.URL.Query().Get(URLParamPrefix)
+	q := url.Values{}
+	q.Set(URLParamWhat, GetWhatDigest)
+	q.Set(URLParamPrefix, prefix)
+	results := p.broadcastTargets(URLPath(Rversion, Rbuckets, bucket), q, http.MethodGet, nil,
+		p.smapowner.get(), ctx.config.Timeout.DefaultLong)
+	targets := make(map[string]*TargetDigest)
+	for res := range results {
+		if res.err != nil {
+			p.invalmsghdlr(w, r, fmt.Sprintf("Failed to get the digest of %s from %s: %v (%d: %s)",
+				bucket, res.si.DaemonID, res.err, res.status, res.errstr))
+			return
+		}
+		digest := &TargetDigest{}
+		if err := json.Unmarshal(res.outjson, digest); err != nil {
+			p.invalmsghdlr(w, r, fmt.Sprintf("Invalid digest of %s from %s, err: %v", bucket, res.si.DaemonID, err))
+			return
+		}
+		targets[res.si.DaemonID] = digest
+	}
+	jsbytes, err := json.Marshal(newBucketDigest(bucket, prefix, targets))
+	assert(err == nil, err)
+	p.writeJSON(w, r, jsbytes, "digest")
+}
+
+// newBucketDigest aggregates the digests of the targets; the objects' checksums are not returned
+func newBucketDigest(bucket, prefix string, targets map[string]*TargetDigest) *BucketDigest {
+	var entries []*DigestEntry
+	digest := &BucketDigest{Bucket: bucket, Prefix: prefix, Targets: targets}
+	for sid, tdigest := range targets {
+		entries = append(entries, tdigest.Entries...)
+		for _, errstr := range tdigest.Errors {
+			digest.Errors = append(digest.Errors, sid+": "+errstr)
+		}
+		tdigest.Entries = nil
+	}
+	sort.Strings(digest.Errors)
+	entries = sortEntries(entries)
+	digest.Objects = len(entries)
+	digest.Digest, digest.Pages = digestEntries(entries)
+	return digest
+}
@@ -0,0 +1,83 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBucketDigest(t *testing.T) {
+	const bucket = "digestbucket"
+	mpath, err := ioutil.TempDir("", "digest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(mpath)
+	oldavail := ctx.mountpaths.Available
+	defer func() { ctx.mountpaths.Available = oldavail }()
+	ctx.mountpaths.Available = map[string]*mountPath{mpath: {Path: mpath}}
+
+	target, _ := newTestTarget(map[string]BucketProps{bucket: {}})
+
+	// the objects of a bucket stored by one target...
+	const numobjs = digestPageSize + 10
+	for i := 0; i < numobjs; i++ {
+		fqn := target.fqn(bucket, fmt.Sprintf("dir%d/obj%04d", i%2, i), true)
+		if err = CreateDir(filepath.Dir(fqn)); err != nil {
+			t.Fatal(err)
+		}
+		if err = ioutil.WriteFile(fqn, []byte(fmt.Sprintf("data%d", i)), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	single, err := target.bucketDigest(bucket, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if single.Objects != numobjs || len(single.Errors) != 0 {
+		t.Fatalf("Digest of %d objects, errors %v", single.Objects, single.Errors)
+	}
+	prefixed, err := target.bucketDigest(bucket, "dir1/")
+	if err != nil || prefixed.Objects != numobjs/2 {
+		t.Fatalf("Digest of %d objects with the prefix, err: %v", prefixed.Objects, err)
+	}
+
+	// ...and by three, with a duplicate, give the same digest
+	entries := single.Entries
+	three := map[string]*TargetDigest{"t1": {}, "t2": {}, "t3": {}}
+	for i, entry := range entries {
+		tdigest := three[fmt.Sprintf("t%d", i%3+1)]
+		tdigest.Entries = append(tdigest.Entries, entry)
+	}
+	three["t1"].Entries = append(three["t1"].Entries, entries[5])
+	one := newBucketDigest(bucket, "", map[string]*TargetDigest{"t": single})
+	digest := newBucketDigest(bucket, "", three)
+	if digest.Digest != one.Digest || digest.Objects != numobjs || len(digest.Pages) != 2 {
+		t.Fatalf("Expected the same digest of %d objects in 2 pages: %d objects in %d pages", numobjs, digest.Objects, len(digest.Pages))
+	}
+	if one.Digest != single.Digest || single.Entries != nil {
+		t.Error("Expected the target's digest to be the bucket's and the entries to be dropped")
+	}
+	if page := digest.Pages[1]; page.Objects != 10 || page.First != entries[digestPageSize].Name || page.Last != entries[numobjs-1].Name {
+		t.Errorf("Unexpected last page %+v", page)
+	}
+
+	// a changed object changes the digest of the bucket and of its page only
+	changed := make([]*DigestEntry, len(entries))
+	copy(changed, entries)
+	changed[3] = &DigestEntry{Name: entries[3].Name, Checksum: "0"}
+	other := newBucketDigest(bucket, "", map[string]*TargetDigest{"t": {Entries: changed}})
+	if other.Digest == digest.Digest || other.Pages[0].Digest == digest.Pages[0].Digest ||
+		other.Pages[1].Digest != digest.Pages[1].Digest {
+		t.Error("Expected the first page and the bucket digests only to change")
+	}
+	if empty := newBucketDigest(bucket, "", nil); empty.Objects != 0 || empty.Digest == digest.Digest || len(empty.Pages) != 0 {
+		t.Errorf("Unexpected digest of an empty bucket %+v", empty)
+	}
+}
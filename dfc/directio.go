@@ -0,0 +1,138 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"os"
+	"sync"
+	"unsafe"
+
+	"github.com/NVIDIA/dfcpub/3rdparty/glog"
+)
+
+// Direct I/O: a large object streamed to disk (PUT, cold GET) would otherwise
+// go through the page cache and evict hot small objects from memory. With
+// directioconf.Threshold set, the first Threshold bytes of an object are
+// written as usual; the rest bypasses the page cache (O_DIRECT on Linux,
+// F_NOCACHE on macOS). O_DIRECT requires the buffer, the file offset and the
+// size of each write to be aligned, hence directWriter buffers the data in an
+// aligned buffer and writes the unaligned tail, if any, in the regular mode.
+
+const (
+	directAlign   = 4 * KiB
+	directBufSize = MiB
+)
+
+var directbufs = &sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, directBufSize+directAlign)
+		off := int(uintptr(unsafe.Pointer(&b[0])) & (directAlign - 1))
+		if off != 0 {
+			off = directAlign - off
+		}
+		return b[off : off+directBufSize]
+	},
+}
+
+// directWriter writes to the file bypassing the page cache once the threshold
+// is crossed; must be flushed before the file is closed
+type directWriter struct {
+	file      *os.File
+	threshold int64
+	written   int64  // bytes written to the file
+	buf       []byte // aligned, nil until direct I/O is enabled
+	n         int    // bytes buffered in buf
+}
+
+// newDirectWriter returns nil if direct I/O is disabled
+func newDirectWriter(file *os.File) *directWriter {
+	threshold := ctx.config.DirectIO.Threshold
+	if threshold <= 0 {
+		return nil
+	}
+	// round up to keep the file offset aligned
+	threshold = (threshold + directAlign - 1) &^ (directAlign - 1)
+	return &directWriter{file: file, threshold: threshold}
+}
+
+func (w *directWriter) Write(p []byte) (n int, err error) {
+	if w.buf == nil {
+		if w.threshold < 0 || w.written+int64(len(p)) <= w.threshold {
+			n, err = w.file.Write(p)
+			w.written += int64(n)
+			return
+		}
+		// write up to the (aligned) threshold and switch to direct I/O
+		k := int(w.threshold - w.written)
+		if k > 0 {
+			n, err = w.file.Write(p[:k])
+			w.written += int64(n)
+			if err != nil {
+				return
+			}
+		}
+		if err = setDirectIO(w.file, true); err != nil {
+			// e.g., not supported by the filesystem: keep writing as usual
+			glog.Warningf("Failed to enable direct I/O for %s, err: %v", w.file.Name(), err)
+			w.threshold = -1
+			var m int
+			m, err = w.file.Write(p[k:])
+			w.written += int64(m)
+			return n + m, err
+		}
+		w.buf = directbufs.Get().([]byte)
+		p = p[k:]
+	}
+	for len(p) > 0 {
+		m := copy(w.buf[w.n:], p)
+		w.n += m
+		n += m
+		p = p[m:]
+		if w.n == len(w.buf) {
+			if err = w.writebuf(); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+func (w *directWriter) writebuf() error {
+	m, err := w.file.Write(w.buf[:w.n])
+	w.written += int64(m)
+	w.n = 0
+	return err
+}
+
+// flush writes the buffered data and releases the buffer
+func (w *directWriter) flush() (err error) {
+	if w.buf == nil {
+		return
+	}
+	if w.n > 0 {
+		aligned := w.n &^ (directAlign - 1)
+		tail := w.n - aligned
+		if aligned > 0 {
+			w.n = aligned
+			if err = w.writebuf(); err != nil {
+				return
+			}
+			copy(w.buf, w.buf[aligned:aligned+tail])
+			w.n = tail
+		}
+		if tail > 0 {
+			if err = setDirectIO(w.file, false); err != nil {
+				return
+			}
+			if err = w.writebuf(); err != nil {
+				return
+			}
+		}
+	}
+	directbufs.Put(w.buf)
+	w.buf = nil
+	return
+}
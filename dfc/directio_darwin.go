@@ -0,0 +1,23 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"os"
+	"syscall"
+)
+
+// setDirectIO turns the page cache off (F_NOCACHE) or on for the open file
+func setDirectIO(file *os.File, on bool) error {
+	var nocache uintptr
+	if on {
+		nocache = 1
+	}
+	if _, _, errno := syscall.Syscall(syscall.SYS_FCNTL, file.Fd(), syscall.F_NOCACHE, nocache); errno != 0 {
+		return errno
+	}
+	return nil
+}
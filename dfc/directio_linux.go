@@ -0,0 +1,29 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"os"
+	"syscall"
+)
+
+// setDirectIO sets or clears O_DIRECT of the open file
+func setDirectIO(file *os.File, on bool) error {
+	fd := file.Fd()
+	flags, _, errno := syscall.Syscall(syscall.SYS_FCNTL, fd, syscall.F_GETFL, 0)
+	if errno != 0 {
+		return errno
+	}
+	if on {
+		flags |= syscall.O_DIRECT
+	} else {
+		flags &^= syscall.O_DIRECT
+	}
+	if _, _, errno = syscall.Syscall(syscall.SYS_FCNTL, fd, syscall.F_SETFL, flags); errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ */
+package dfc
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"testing"
+)
+
+func TestDirectWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "directio")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	oldcfg := ctx.config.DirectIO
+	defer func() { ctx.config.DirectIO = oldcfg }()
+
+	ctx.config.DirectIO.Threshold = 0
+	if newDirectWriter(nil) != nil {
+		t.Error("Expected direct I/O to be disabled")
+	}
+
+	ctx.config.DirectIO.Threshold = 5000 // rounded up to 8KiB
+	rnd := rand.New(rand.NewSource(1))
+	for _, size := range []int{100, 8 * KiB, 8*KiB + 1, 3*MiB + 12345, 4 * MiB} {
+		data := make([]byte, size)
+		rnd.Read(data)
+		file, err := ioutil.TempFile(dir, "obj")
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := newDirectWriter(file)
+		// odd-sized writes
+		for p := data; len(p) > 0; {
+			n := rnd.Intn(100*KiB) + 1
+			if n > len(p) {
+				n = len(p)
+			}
+			if _, err = w.Write(p[:n]); err != nil {
+				t.Fatalf("Size %d: write failed, err: %v", size, err)
+			}
+			p = p[n:]
+		}
+		if err = w.flush(); err != nil {
+			t.Fatalf("Size %d: flush failed, err: %v", size, err)
+		}
+		file.Close()
+		if written, err := ioutil.ReadFile(file.Name()); err != nil || !bytes.Equal(written, data) {
+			t.Errorf("Size %d: written file differs (%d bytes), err: %v", size, len(written), err)
+		}
+		if w.written != int64(size) {
+			t.Errorf("Size %d: written %d", size, w.written)
+		}
+	}
+}
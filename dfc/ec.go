@@ -0,0 +1,464 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/NVIDIA/dfcpub/3rdparty/glog"
+	"github.com/OneOfOne/xxhash"
+	"github.com/klauspost/reedsolomon"
+)
+
+// ============================= Erasure coding ==============================
+// The objects of a local bucket with BucketProps.ECData > 0 survive the loss
+// of up to ECParity targets or mountpaths. Once a PUT is committed, the target
+// that stores the object splits it into ECData data slices, computes ECParity
+// Reed-Solomon parity slices and sends each slice to another target, in the
+// order of the object's preference (hrwTargetList) - so the bucket needs at
+// least ECData + ECParity + 1 targets. An object smaller than ECMinSize is not
+// worth slicing: ECParity full replicas of it are sent instead. The PUT fails
+// if some of the slices could not be stored.
+// A target keeps the slices it received in the ".ec" directory of a mountpath,
+// along with the xattrs of the object. When a GET does not find the object,
+// the target collects the slices from all targets, restores the object from
+// any ECData of them (any one replica) and serves it. The slices of the most
+// recent PUT win, the ones of the overwritten objects are ignored. A DELETE of
+// the object deletes its slices as well; so does destroying the bucket.
+// The object is encoded and restored in memory.
+// ============================= Erasure coding ==============================
+
+const (
+	ecSliceDir  = ".ec" // per mountpath
+	ecMaxSlices = 32    // data + parity
+)
+
+type (
+	// ecSliceMeta describes the slice and the object it belongs to; kept in
+	// XattrECMeta of the slice
+	ecSliceMeta struct {
+		Size   int64  `json:"size"`   // of the object
+		Data   int    `json:"data"`   // number of data slices, 1 - the slices are replicas
+		Parity int    `json:"parity"` // number of parity slices
+		Idx    int    `json:"idx"`    // data slices first, then parity
+		Cksum  string `json:"cksum"`  // xxhash of the object
+		Time   int64  `json:"time"`   // of the PUT, Unix nanoseconds
+	}
+	// ecSlice is sent between targets
+	ecSlice struct {
+		Meta   ecSliceMeta       `json:"meta"`
+		Xattrs map[string][]byte `json:"xattrs,omitempty"` // of the object, see objectXattrs
+		Data   []byte            `json:"data"`
+	}
+)
+
+func validateECProps(props *BucketProps, isLocal bool) error {
+	if props.ECData == 0 && props.ECParity == 0 && props.ECMinSize == 0 {
+		return nil
+	}
+	if !isLocal {
+		return fmt.Errorf("erasure coding is supported only for local buckets")
+	}
+	if props.ECData < 1 || props.ECParity < 1 || props.ECData+props.ECParity > ecMaxSlices {
+		return fmt.Errorf("invalid erasure coding: %d data and %d parity slices (expecting at least one of each, %d in total at most)",
+			props.ECData, props.ECParity, ecMaxSlices)
+	}
+	if props.ECMinSize < 0 {
+		return fmt.Errorf("invalid erasure coding min object size: %d", props.ECMinSize)
+	}
+	if props.Encrypt {
+		return fmt.Errorf("erasure coding of encrypted buckets is not supported")
+	}
+	return nil
+}
+
+func makePathEC(mpath string) string {
+	return filepath.Join(mpath, ecSliceDir)
+}
+
+// ecFindSlice returns the fqn of the object's slice stored by the target, "" if none
+func ecFindSlice(bucket, objname string) string {
+	for mpath := range ctx.mountpaths.Available {
+		fqn := filepath.Join(makePathEC(mpath), bucket, objname)
+		if _, err := os.Stat(fqn); err == nil {
+			return fqn
+		}
+	}
+	return ""
+}
+
+// ecSplit returns the data and parity slices of the object; a small object
+// is not split - it is replicated
+func ecSplit(data []byte, ndata, nparity int) ([][]byte, error) {
+	if ndata == 1 {
+		slices := make([][]byte, nparity)
+		for i := range slices {
+			slices[i] = data
+		}
+		return slices, nil
+	}
+	enc, err := reedsolomon.New(ndata, nparity)
+	if err != nil {
+		return nil, err
+	}
+	slices, err := enc.Split(data)
+	if err != nil {
+		return nil, err
+	}
+	if err = enc.Encode(slices); err != nil {
+		return nil, err
+	}
+	return slices, nil
+}
+
+// ecJoin restores the object from its slices, the missing ones are nil
+func ecJoin(slices [][]byte, meta *ecSliceMeta) ([]byte, error) {
+	if meta.Data == 1 {
+		for _, slice := range slices {
+			if slice != nil {
+				return slice, nil
+			}
+		}
+		return nil, fmt.Errorf("no replicas")
+	}
+	enc, err := reedsolomon.New(meta.Data, meta.Parity)
+	if err != nil {
+		return nil, err
+	}
+	if err = enc.ReconstructData(slices); err != nil {
+		return nil, err
+	}
+	data := make([]byte, 0, meta.Size)
+	for _, slice := range slices[:meta.Data] {
+		data = append(data, slice...)
+	}
+	if int64(len(data)) < meta.Size {
+		return nil, fmt.Errorf("short data slices: %d bytes, object size %d", len(data), meta.Size)
+	}
+	return data[:meta.Size], nil
+}
+
+func ecChecksum(data []byte) string {
+	slab := selectslab(int64(len(data)))
+	buf := slab.alloc()
+	defer slab.free(buf)
+	cksum, _ := ComputeXXHash(bytes.NewReader(data), buf, xxhash.New64())
+	return cksum
+}
+
+//
+// target: PUT and DELETE
+//
+
+// ecEncode sends the slices of the just PUT object to other targets
+func (t *targetrunner) ecEncode(bucket, objname string) (errstr string) {
+	_, props := t.bmdowner.get().get(bucket, true)
+	if props.ECData == 0 {
+		return
+	}
+	uname := uniquename(bucket, objname)
+	fqn := t.lookupfqn(bucket, objname, true)
+	t.rtnamemap.lockname(uname, false, &pendinginfo{Time: time.Now(), fqn: fqn}, time.Second)
+	data, err := ioutil.ReadFile(fqn)
+	xattrs := make(map[string][]byte)
+	for _, name := range objectXattrs {
+		if b, errstr := Getxattr(fqn, name); errstr == "" && b != nil {
+			xattrs[name] = b
+		}
+	}
+	t.rtnamemap.unlockname(uname, false)
+	if err != nil {
+		return fmt.Sprintf("Failed to read %s/%s to erasure code it, err: %v", bucket, objname, err)
+	}
+
+	meta := ecSliceMeta{Size: int64(len(data)), Data: props.ECData, Parity: props.ECParity,
+		Cksum: ecChecksum(data), Time: time.Now().UnixNano()}
+	nslices := props.ECData + props.ECParity
+	if meta.Size == 0 || meta.Size < props.ECMinSize {
+		meta.Data, nslices = 1, props.ECParity
+	}
+	targets := make([]*daemonInfo, 0, nslices)
+	for _, si := range hrwTargetList(bucket, objname, t.smapowner.get()) {
+		if si.DaemonID != t.si.DaemonID && len(targets) < nslices {
+			targets = append(targets, si)
+		}
+	}
+	if len(targets) < nslices {
+		return fmt.Sprintf("Not enough targets to erasure code %s/%s: %d slices, %d other targets",
+			bucket, objname, nslices, len(targets))
+	}
+	slices, err := ecSplit(data, meta.Data, meta.Parity)
+	if err != nil {
+		return fmt.Sprintf("Failed to erasure code %s/%s, err: %v", bucket, objname, err)
+	}
+
+	var (
+		wg     = &sync.WaitGroup{}
+		errch  = make(chan string, nslices)
+		urlstr = URLEscapedPath(Rversion, Rslices, bucket, objname)
+	)
+	for i, si := range targets {
+		slice := &ecSlice{Meta: meta, Xattrs: xattrs, Data: slices[i]}
+		slice.Meta.Idx = i
+		injson, err := json.Marshal(slice)
+		assert(err == nil, err)
+		wg.Add(1)
+		go func(si *daemonInfo, injson []byte) {
+			res := t.call(nil, si, si.dataURL()+urlstr, http.MethodPut, injson, ctx.config.Timeout.SendFile)
+			if res.err != nil {
+				errch <- fmt.Sprintf("%s: %v (%d: %s)", si.DaemonID, res.err, res.status, res.errstr)
+			}
+			wg.Done()
+		}(si, injson)
+	}
+	wg.Wait()
+	close(errch)
+	for e := range errch {
+		if errstr == "" {
+			errstr = fmt.Sprintf("Failed to store the slices of %s/%s at", bucket, objname)
+		}
+		errstr += " " + e
+	}
+	return
+}
+
+// ecDelete deletes the slices of the object at all targets, returns true if there were any
+func (t *targetrunner) ecDelete(bucket, objname string) (found bool) {
+	if fqn := ecFindSlice(bucket, objname); fqn != "" {
+		found = os.Remove(fqn) == nil
+	}
+	results := t.broadcastNeighbors(URLPath(Rversion, Rslices, bucket, objname), nil, http.MethodDelete, nil,
+		t.smapowner.get(), ctx.config.Timeout.Default)
+	for res := range results {
+		if res.err == nil {
+			found = true
+		} else if res.status != http.StatusNotFound {
+			glog.Errorf("Failed to delete the slice of %s/%s at %s: %v (%d: %s)",
+				bucket, objname, res.si.DaemonID, res.err, res.status, res.errstr)
+		}
+	}
+	return
+}
+
+//
+// target: GET
+//
+
+// ecRestore restores the missing object from its slices
+func (t *targetrunner) ecRestore(bucket, objname string) (props *objectProps, errstr string, errcode int) {
+	slices := make([]*ecSlice, 0)
+	if fqn := ecFindSlice(bucket, objname); fqn != "" {
+		if slice, errstr := readSlice(fqn); errstr == "" {
+			slices = append(slices, slice)
+		} else {
+			glog.Errorln(errstr)
+		}
+	}
+	results := t.broadcastNeighbors(URLPath(Rversion, Rslices, bucket, objname), nil, http.MethodGet, nil,
+		t.smapowner.get(), ctx.config.Timeout.SendFile)
+	for res := range results {
+		if res.err != nil {
+			if res.status != http.StatusNotFound {
+				glog.Errorf("Failed to get the slice of %s/%s from %s: %v (%d: %s)",
+					bucket, objname, res.si.DaemonID, res.err, res.status, res.errstr)
+			}
+			continue
+		}
+		slice := &ecSlice{}
+		if err := json.Unmarshal(res.outjson, slice); err != nil {
+			glog.Errorf("Failed to unmarshal the slice of %s/%s from %s, err: %v", bucket, objname, res.si.DaemonID, err)
+			continue
+		}
+		slices = append(slices, slice)
+	}
+	if len(slices) == 0 {
+		return nil, fmt.Sprintf("%s/%s %s", bucket, objname, doesnotexist), http.StatusNotFound
+	}
+
+	// the slices of the most recent PUT
+	latest := &slices[0].Meta
+	for _, slice := range slices {
+		if slice.Meta.Time > latest.Time {
+			latest = &slice.Meta
+		}
+	}
+	var (
+		ordered = make([][]byte, latest.Data+latest.Parity)
+		xattrs  map[string][]byte
+		found   int
+	)
+	for _, slice := range slices {
+		m := &slice.Meta
+		if m.Time != latest.Time || m.Cksum != latest.Cksum || m.Idx < 0 || m.Idx >= len(ordered) || ordered[m.Idx] != nil {
+			continue
+		}
+		ordered[m.Idx], xattrs = slice.Data, slice.Xattrs
+		found++
+	}
+	if found < latest.Data {
+		return nil, fmt.Sprintf("Cannot restore %s/%s: %d of %d slices found", bucket, objname, found, latest.Data),
+			http.StatusInternalServerError
+	}
+	data, err := ecJoin(ordered, latest)
+	if err == nil && ecChecksum(data) != latest.Cksum {
+		err = fmt.Errorf("bad checksum")
+	}
+	if err != nil {
+		return nil, fmt.Sprintf("Failed to restore %s/%s from %d slices, err: %v", bucket, objname, found, err),
+			http.StatusInternalServerError
+	}
+
+	// commit
+	fqn, hrwmpath := t.placefqn(bucket, objname, true)
+	workfqn := t.fqn2workfile(fqn)
+	if err = CreateDir(filepath.Dir(workfqn)); err == nil {
+		err = ioutil.WriteFile(workfqn, data, 0644)
+	}
+	if err == nil {
+		err = t.commitWorkfile(workfqn, fqn, bucket)
+	}
+	if err != nil {
+		os.Remove(workfqn)
+		return nil, fmt.Sprintf("Failed to store restored %s/%s, err: %v", bucket, objname, err),
+			http.StatusInternalServerError
+	}
+	for name, value := range xattrs {
+		if errstr = Setxattr(fqn, name, value); errstr != "" {
+			return nil, errstr, http.StatusInternalServerError
+		}
+	}
+	if hrwmpath != "" {
+		if errstr = Setxattr(fqn, XattrDisplaced, []byte(hrwmpath)); errstr != "" {
+			return nil, errstr, http.StatusInternalServerError
+		}
+	}
+	glog.Infof("Restored %s/%s (%d bytes) from %d slices", bucket, objname, latest.Size, found)
+	props = &objectProps{size: latest.Size, version: string(xattrs[XattrObjVersion])}
+	return
+}
+
+//
+// target: slices
+//
+
+// readSlice reads the slice and the xattrs of its object
+func readSlice(fqn string) (*ecSlice, string) {
+	slice := &ecSlice{}
+	b, errstr := Getxattr(fqn, XattrECMeta)
+	if errstr != "" {
+		return nil, errstr
+	}
+	if err := json.Unmarshal(b, &slice.Meta); err != nil {
+		return nil, fmt.Sprintf("Invalid slice %s, err: %v", fqn, err)
+	}
+	var err error
+	if slice.Data, err = ioutil.ReadFile(fqn); err != nil {
+		return nil, fmt.Sprintf("Failed to read slice %s, err: %v", fqn, err)
+	}
+	slice.Xattrs = make(map[string][]byte)
+	for _, name := range objectXattrs {
+		if b, errstr := Getxattr(fqn, name); errstr == "" && b != nil {
+			slice.Xattrs[name] = b
+		}
+	}
+	return slice, ""
+}
+
+// GET, PUT and DELETE /v1/slices/bucket-name/object-name (intra-cluster)
+func (t *targetrunner) sliceHandler(w http.ResponseWriter, r *http.Request) {
+	apitems := t.restAPIItems(r.URL.Path, 5)
+	if apitems = t.checkRestAPI(w, r, apitems, 2, Rversion, Rslices); apitems == nil {
+		return
+	}
+	bucket, objname := apitems[0], apitems[1]
+	if !t.validatebckname(w, r, bucket) {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		fqn := ecFindSlice(bucket, objname)
+		if fqn == "" {
+			t.invalmsghdlr(w, r, fmt.Sprintf("No slice of %s/%s", bucket, objname), http.StatusNotFound)
+			return
+		}
+		slice, errstr := readSlice(fqn)
+		if errstr != "" {
+			t.invalmsghdlr(w, r, errstr, http.StatusInternalServerError)
+			return
+		}
+		jsbytes, err := json.Marshal(slice)
+		assert(err == nil, err)
+		t.writeJSON(w, r, jsbytes, "getslice")
+	case http.MethodPut:
+		slice := &ecSlice{}
+		if t.readJSON(w, r, slice) != nil {
+			return
+		}
+		if errstr := t.storeSlice(bucket, objname, slice); errstr != "" {
+			t.invalmsghdlr(w, r, errstr, http.StatusInternalServerError)
+		}
+	case http.MethodDelete:
+		fqn := ecFindSlice(bucket, objname)
+		if fqn == "" {
+			t.invalmsghdlr(w, r, fmt.Sprintf("No slice of %s/%s", bucket, objname), http.StatusNotFound)
+			return
+		}
+		if err := os.Remove(fqn); err != nil {
+			t.invalmsghdlr(w, r, fmt.Sprintf("Failed to delete slice %s, err: %v", fqn, err), http.StatusInternalServerError)
+		}
+	default:
+		invalhdlr(w, r)
+	}
+}
+
+func (t *targetrunner) storeSlice(bucket, objname string, slice *ecSlice) string {
+	mpath := hrwMpath(bucket, objname)
+	if mpath == "" {
+		return "No mountpaths available"
+	}
+	prev := ecFindSlice(bucket, objname)
+	fqn := filepath.Join(makePathEC(mpath), bucket, objname)
+	workfqn := t.fqn2workfile(fqn)
+	err := CreateDir(filepath.Dir(workfqn))
+	if err == nil {
+		err = ioutil.WriteFile(workfqn, slice.Data, 0644)
+	}
+	if err != nil {
+		os.Remove(workfqn)
+		return fmt.Sprintf("Failed to write the slice of %s/%s, err: %v", bucket, objname, err)
+	}
+	b, err := json.Marshal(&slice.Meta)
+	assert(err == nil, err)
+	if errstr := Setxattr(workfqn, XattrECMeta, b); errstr != "" {
+		os.Remove(workfqn)
+		return errstr
+	}
+	for name, value := range slice.Xattrs {
+		if errstr := Setxattr(workfqn, name, value); errstr != "" {
+			os.Remove(workfqn)
+			return errstr
+		}
+	}
+	if err = t.commitWorkfile(workfqn, fqn, bucket); err != nil {
+		os.Remove(workfqn)
+		return fmt.Sprintf("Failed to commit the slice of %s/%s, err: %v", bucket, objname, err)
+	}
+	// the previous slice of the object may be on another mountpath
+	if prev != "" && prev != fqn {
+		if err := os.Remove(prev); err != nil {
+			glog.Errorf("Failed to remove the previous slice %s, err: %v", prev, err)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,139 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestECSplitJoin(t *testing.T) {
+	for _, test := range []struct{ ndata, nparity, size int }{
+		{1, 2, 100},
+		{2, 1, 1},
+		{4, 2, 1000},
+		{3, 3, 4097},
+	} {
+		data := make([]byte, test.size)
+		rand.Read(data)
+		slices, err := ecSplit(data, test.ndata, test.nparity)
+		if err != nil {
+			t.Fatal(err)
+		}
+		meta := &ecSliceMeta{Size: int64(test.size), Data: test.ndata, Parity: test.nparity}
+		// lose as many slices as there are parity ones; the object itself
+		// is one of the replicas of a small object
+		lose := test.nparity
+		if test.ndata == 1 {
+			lose--
+		}
+		for lost := 0; lost < len(slices); lost++ {
+			ordered := make([][]byte, test.ndata+test.nparity)
+			copy(ordered, slices)
+			for i := 0; i < lose; i++ {
+				ordered[(lost+i)%len(slices)] = nil
+			}
+			joined, err := ecJoin(ordered, meta)
+			if err != nil {
+				t.Fatalf("%+v, lost %d: %v", test, lost, err)
+			}
+			if !bytes.Equal(joined, data) {
+				t.Errorf("%+v, lost %d: restored object differs", test, lost)
+			}
+		}
+	}
+}
+
+func TestHrwTargetList(t *testing.T) {
+	smap := newSmap()
+	for i := 0; i < 5; i++ {
+		id := fmt.Sprintf("target%d", i)
+		smap.Tmap[id] = &daemonInfo{DaemonID: id}
+	}
+	for _, objname := range []string{"a", "b/c", "d"} {
+		list := hrwTargetList("bucket", objname, smap)
+		si, _ := HrwTarget("bucket", objname, smap)
+		if len(list) != 5 || list[0] != si {
+			t.Errorf("%s: unexpected order %v (HRW %s)", objname, list, si.DaemonID)
+		}
+		seen := make(map[string]bool)
+		for _, si := range list {
+			seen[si.DaemonID] = true
+		}
+		if len(seen) != 5 {
+			t.Errorf("%s: duplicate targets %v", objname, list)
+		}
+	}
+}
+
+func TestECSlices(t *testing.T) {
+	const bucket = "ecbucket"
+	for _, test := range []struct {
+		props BucketProps
+		local bool
+		ok    bool
+	}{
+		{BucketProps{}, false, true},
+		{BucketProps{ECData: 4, ECParity: 2, ECMinSize: 1024}, true, true},
+		{BucketProps{ECData: 4, ECParity: 2}, false, false},
+		{BucketProps{ECData: 4}, true, false},
+		{BucketProps{ECParity: 2}, true, false},
+		{BucketProps{ECData: 30, ECParity: 3}, true, false},
+		{BucketProps{ECData: 2, ECParity: 2, ECMinSize: -1}, true, false},
+		{BucketProps{ECData: 2, ECParity: 2, Encrypt: true}, true, false},
+	} {
+		if err := validateECProps(&test.props, test.local); (err == nil) != test.ok {
+			t.Errorf("%+v (local %t): expected ok %t, got %v", test.props, test.local, test.ok, err)
+		}
+	}
+
+	dir, err := ioutil.TempDir("", "ec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	oldavail := ctx.mountpaths.Available
+	defer func() { ctx.mountpaths.Available = oldavail }()
+	ctx.mountpaths.Available = make(map[string]*mountPath)
+	for _, mp := range []string{"mp1", "mp2"} {
+		mpath := filepath.Join(dir, mp)
+		ctx.mountpaths.Available[mpath] = &mountPath{Path: mpath}
+	}
+	target, _ := newTestTarget(map[string]BucketProps{bucket: {ECData: 2, ECParity: 1}})
+
+	if fqn := ecFindSlice(bucket, "a/obj"); fqn != "" {
+		t.Fatalf("Unexpected slice %s", fqn)
+	}
+	slice := &ecSlice{
+		Meta:   ecSliceMeta{Size: 5, Data: 2, Parity: 1, Idx: 2, Cksum: ecChecksum([]byte("hello")), Time: 1},
+		Xattrs: map[string][]byte{XattrObjVersion: []byte("3")},
+		Data:   []byte("parity"),
+	}
+	if errstr := target.storeSlice(bucket, "a/obj", slice); errstr != "" {
+		t.Fatal(errstr)
+	}
+	fqn := ecFindSlice(bucket, "a/obj")
+	if fqn != filepath.Join(makePathEC(hrwMpath(bucket, "a/obj")), bucket, "a/obj") {
+		t.Fatalf("Unexpected slice %q", fqn)
+	}
+	stored, errstr := readSlice(fqn)
+	if errstr != "" {
+		t.Fatal(errstr)
+	}
+	if stored.Meta != slice.Meta || !bytes.Equal(stored.Data, slice.Data) || string(stored.Xattrs[XattrObjVersion]) != "3" {
+		t.Errorf("Expected %+v, got %+v", slice, stored)
+	}
+
+	// the bucket's slices go to the trash with the bucket
+	target.trashLocalBucket(bucket)
+	if fqn := ecFindSlice(bucket, "a/obj"); fqn != "" {
+		t.Errorf("Expected the slices to be moved to the trash, found %s", fqn)
+	}
+}
@@ -0,0 +1,251 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/NVIDIA/dfcpub/3rdparty/glog"
+)
+
+// ============================= Cloud egress budget =========================
+// Every byte a target fetches from the Cloud (cold GETs, including the ones
+// caused by failed warm GET validations, and prefetches) is counted per
+// bucket and reported with the target's keepalive load. The primary proxy
+// accumulates the reports into the usage of the current month (UTC) and
+// checks it against the cluster budget (see egressconf) and the buckets'
+// budgets (BucketProps.EgressBudget): a warning is logged once the usage
+// crosses soft_pct of a budget and once again when the budget is exhausted.
+// With refuse set, the primary then refuses to prefetch the objects of the
+// over-budget bucket (or of any bucket, when the cluster budget is gone).
+// The usage is persisted in $CONFDIR of the primary proxy.
+// ============================= Cloud egress budget =========================
+
+const (
+	egressSaveInterval = time.Minute
+	egressMonthFormat  = "2006-01"
+)
+
+// egressCounters counts the bytes a target fetched from the Cloud since it
+// started, by bucket
+type egressCounters struct {
+	sync.Mutex
+	bytes map[string]int64
+}
+
+// EgressUsage is the cloud egress of the cluster in the current month
+type EgressUsage struct {
+	Month   string           `json:"month"`   // UTC, YYYY-MM
+	Total   int64            `json:"total"`   // bytes
+	Buckets map[string]int64 `json:"buckets"` // bucket => bytes
+}
+
+// EgressReport is returned by GET /v1/cluster?what=egress
+type EgressReport struct {
+	EgressUsage
+	Budget        int64            `json:"budget"`                   // cluster budget, 0 - unlimited
+	BucketBudgets map[string]int64 `json:"bucket_budgets,omitempty"` // bucket => budget
+}
+
+// egressTracker accumulates the targets' counters (primary proxy only)
+type egressTracker struct {
+	sync.Mutex
+	usage  EgressUsage
+	last   map[string]map[string]int64 // target => its counters as of the previous keepalive
+	warned map[string]int              // bucket ("" - cluster) => 1: soft limit, 2: budget exhausted
+	saved  time.Time
+}
+
+func (c *egressCounters) add(bucket string, n int64) {
+	c.Lock()
+	if c.bytes == nil {
+		c.bytes = make(map[string]int64)
+	}
+	c.bytes[bucket] += n
+	c.Unlock()
+}
+
+// get returns a copy of the counters, nil if nothing was fetched
+func (c *egressCounters) get() map[string]int64 {
+	c.Lock()
+	defer c.Unlock()
+	if len(c.bytes) == 0 {
+		return nil
+	}
+	counters := make(map[string]int64, len(c.bytes))
+	for bucket, n := range c.bytes {
+		counters[bucket] = n
+	}
+	return counters
+}
+
+func egressMonth(now time.Time) string {
+	return now.UTC().Format(egressMonthFormat)
+}
+
+// update adds what the target fetched since its previous report and returns
+// true if the usage changed. The first report of a target serves as the
+// baseline: the primary does not know which part of it was already counted
+// (by itself before a restart, or by the former primary)
+func (e *egressTracker) update(sid string, counters map[string]int64, now time.Time) (changed bool) {
+	e.Lock()
+	defer e.Unlock()
+	if month := egressMonth(now); month != e.usage.Month {
+		e.usage = EgressUsage{Month: month}
+		e.warned = nil
+		changed = true
+	}
+	if e.last == nil {
+		e.last = make(map[string]map[string]int64)
+	}
+	prev, ok := e.last[sid]
+	e.last[sid] = counters
+	if !ok {
+		return
+	}
+	for bucket, n := range counters {
+		delta := n - prev[bucket]
+		if delta < 0 { // the target has restarted
+			delta = n
+		}
+		if delta == 0 {
+			continue
+		}
+		if e.usage.Buckets == nil {
+			e.usage.Buckets = make(map[string]int64)
+		}
+		e.usage.Buckets[bucket] += delta
+		e.usage.Total += delta
+		changed = true
+	}
+	return
+}
+
+func (e *egressTracker) get() EgressUsage {
+	e.Lock()
+	defer e.Unlock()
+	usage := e.usage
+	usage.Buckets = make(map[string]int64, len(e.usage.Buckets))
+	for bucket, n := range e.usage.Buckets {
+		usage.Buckets[bucket] = n
+	}
+	return usage
+}
+
+// checkBudget warns, once per month and level, about the usage approaching
+// and exceeding the budget
+func (e *egressTracker) checkBudget(bucket string, used, budget int64) {
+	if budget <= 0 {
+		return
+	}
+	level, softpct := 0, int64(ctx.config.Egress.SoftPct)
+	if used >= budget {
+		level = 2
+	} else if softpct > 0 && used*100 >= budget*softpct {
+		level = 1
+	}
+	name := "cluster"
+	if bucket != "" {
+		name = "bucket " + bucket
+	}
+	e.Lock()
+	defer e.Unlock()
+	if level <= e.warned[bucket] {
+		return
+	}
+	if e.warned == nil {
+		e.warned = make(map[string]int)
+	}
+	e.warned[bucket] = level
+	if level == 2 {
+		glog.Warningf("Cloud egress budget of the %s exhausted: %d of %d bytes in %s", name, used, budget, e.usage.Month)
+	} else {
+		glog.Warningf("Cloud egress of the %s at %d%% of the budget: %d of %d bytes in %s",
+			name, used*100/budget, used, budget, e.usage.Month)
+	}
+}
+
+func (e *egressTracker) load() {
+	pathname := filepath.Join(ctx.config.Confdir, egressname)
+	usage := EgressUsage{}
+	if err := LocalLoad(pathname, &usage); err != nil {
+		return
+	}
+	e.Lock()
+	e.usage = usage
+	e.Unlock()
+}
+
+// save persists the usage at most once per egressSaveInterval unless forced
+func (e *egressTracker) save(force bool) {
+	now := time.Now()
+	e.Lock()
+	if !force && now.Sub(e.saved) < egressSaveInterval {
+		e.Unlock()
+		return
+	}
+	e.saved = now
+	e.Unlock()
+	usage := e.get()
+	pathname := filepath.Join(ctx.config.Confdir, egressname)
+	if err := LocalSave(pathname, &usage); err != nil {
+		glog.Errorf("Failed to persist cloud egress usage in %s, err: %v", pathname, err)
+	}
+}
+
+// updateEgress accounts for the target's cloud egress counters
+func (p *proxyrunner) updateEgress(sid string, counters map[string]int64) {
+	if !p.egress.update(sid, counters, time.Now()) {
+		return
+	}
+	var (
+		usage    = p.egress.get()
+		bucketmd = p.bmdowner.get()
+	)
+	p.egress.checkBudget("", usage.Total, ctx.config.Egress.Budget)
+	for bucket, used := range usage.Buckets {
+		_, props := bucketmd.get(bucket, false)
+		p.egress.checkBudget(bucket, used, props.EgressBudget)
+	}
+	p.egress.save(false)
+}
+
+// egressExhausted returns the reason to refuse fetching the bucket's objects
+// from the Cloud, empty if the budgets allow
+func (p *proxyrunner) egressExhausted(bucket string) string {
+	usage := p.egress.get()
+	if usage.Month != egressMonth(time.Now()) {
+		return ""
+	}
+	if budget := ctx.config.Egress.Budget; budget > 0 && usage.Total >= budget {
+		return fmt.Sprintf("Cloud egress budget of the cluster exhausted: %d of %d bytes in %s",
+			usage.Total, budget, usage.Month)
+	}
+	bucketmd := p.bmdowner.get()
+	_, props := bucketmd.get(bucket, false)
+	if budget := props.EgressBudget; budget > 0 && usage.Buckets[bucket] >= budget {
+		return fmt.Sprintf("Cloud egress budget of bucket %s exhausted: %d of %d bytes in %s",
+			bucket, usage.Buckets[bucket], budget, usage.Month)
+	}
+	return ""
+}
+
+func (p *proxyrunner) egressReport() *EgressReport {
+	report := &EgressReport{EgressUsage: p.egress.get(), Budget: ctx.config.Egress.Budget}
+	bucketmd := p.bmdowner.get()
+	for bucket, props := range bucketmd.CBmap {
+		if props.EgressBudget > 0 {
+			if report.BucketBudgets == nil {
+				report.BucketBudgets = make(map[string]int64)
+			}
+			report.BucketBudgets[bucket] = props.EgressBudget
+		}
+	}
+	return report
+}
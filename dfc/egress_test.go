@@ -0,0 +1,98 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ */
+package dfc
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestEgressTracker(t *testing.T) {
+	var (
+		e     egressTracker
+		now   = time.Date(2018, 7, 20, 10, 0, 0, 0, time.UTC)
+		check = func(total, b1, b2 int64) {
+			usage := e.get()
+			if usage.Total != total || usage.Buckets["b1"] != b1 || usage.Buckets["b2"] != b2 {
+				t.Fatalf("Expected %d (b1: %d, b2: %d), got %+v", total, b1, b2, usage)
+			}
+		}
+	)
+	// the first report is the baseline
+	e.update("t1", map[string]int64{"b1": 100}, now)
+	check(0, 0, 0)
+	e.update("t1", map[string]int64{"b1": 150, "b2": 10}, now)
+	e.update("t2", nil, now)
+	e.update("t2", map[string]int64{"b2": 30}, now)
+	check(90, 50, 40)
+	// t1 restarted
+	if !e.update("t1", map[string]int64{"b1": 20}, now) {
+		t.Fatal("Usage did not change")
+	}
+	check(110, 70, 40)
+	if e.update("t1", map[string]int64{"b1": 20}, now) {
+		t.Fatal("Usage changed with the same counters")
+	}
+	// next month
+	e.update("t2", map[string]int64{"b2": 35}, now.AddDate(0, 1, 0))
+	check(5, 0, 5)
+	if month := e.get().Month; month != "2018-08" {
+		t.Fatalf("Unexpected month %s", month)
+	}
+}
+
+func TestEgressBudget(t *testing.T) {
+	dir, err := ioutil.TempDir("", "egress")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	oldconfdir, oldconf := ctx.config.Confdir, ctx.config.Egress
+	defer func() { ctx.config.Confdir, ctx.config.Egress = oldconfdir, oldconf }()
+	ctx.config.Confdir = dir
+	ctx.config.Egress = egressconf{Budget: 1000, SoftPct: 80, Refuse: true}
+
+	p := &proxyrunner{}
+	p.bmdowner = &bmdowner{}
+	bucketmd := newBucketMD()
+	bucketmd.add("b1", false, BucketProps{EgressBudget: 100})
+	bucketmd.add("b2", false, BucketProps{})
+	p.bmdowner.put(bucketmd)
+
+	p.updateEgress("t1", map[string]int64{})
+	p.updateEgress("t1", map[string]int64{"b1": 90, "b2": 500})
+	if p.egress.warned["b1"] != 1 || p.egress.warned[""] != 0 {
+		t.Fatalf("Unexpected warnings %v", p.egress.warned)
+	}
+	for _, bucket := range []string{"b1", "b2"} {
+		if errstr := p.egressExhausted(bucket); errstr != "" {
+			t.Fatal(errstr)
+		}
+	}
+	p.updateEgress("t1", map[string]int64{"b1": 100, "b2": 850})
+	if p.egressExhausted("b1") == "" || p.egressExhausted("b2") != "" {
+		t.Fatal("Bucket budget not enforced")
+	}
+	if p.egress.warned["b1"] != 2 || p.egress.warned[""] != 1 {
+		t.Fatalf("Unexpected warnings %v", p.egress.warned)
+	}
+	p.updateEgress("t1", map[string]int64{"b1": 100, "b2": 900})
+	if p.egressExhausted("b2") == "" {
+		t.Fatal("Cluster budget not enforced")
+	}
+
+	report := p.egressReport()
+	if report.Total != 1000 || report.Budget != 1000 || len(report.BucketBudgets) != 1 || report.BucketBudgets["b1"] != 100 {
+		t.Fatalf("Unexpected report %+v", report)
+	}
+	// persisted
+	var e egressTracker
+	p.egress.save(true)
+	e.load()
+	if usage := e.get(); usage.Total != 1000 || usage.Buckets["b1"] != 100 {
+		t.Fatalf("Unexpected persisted usage %+v", usage)
+	}
+}
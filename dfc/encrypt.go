@@ -0,0 +1,372 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+// Server-side encryption of cached objects.
+// Objects of a bucket with "encrypt" property are stored encrypted with
+// AES-GCM. Every object gets a random data key; the data key is encrypted
+// with the cluster master key (secret "object_master_key", see secrets.go)
+// and stored in the object's xattr. An object is split into segments, each
+// segment is sealed separately, so range reads decrypt only the segments
+// they touch. The segment number is used as a nonce, and the last segment
+// is marked to detect truncation.
+// Checksums (xattr, HTTP headers) are computed over plaintext: encryption is
+// transparent for clients and for integrity verification. Whether an object
+// is encrypted is defined by its xattr, not by the bucket property: turning
+// encryption on or off affects only new objects.
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/NVIDIA/dfcpub/3rdparty/glog"
+)
+
+const (
+	encDataKeyLen  = 32 // AES-256
+	encSegmentSize = 64 * KiB
+	encTagSize     = 16 // AES-GCM authentication tag
+	encNonceSize   = 12
+)
+
+type (
+	// objectReader reads object data: *os.File for regular objects and
+	// decryptReader for encrypted ones
+	objectReader interface {
+		io.ReadSeeker
+		io.ReaderAt
+		io.Closer
+	}
+
+	// encryptWriter encrypts data segment by segment. A segment is sealed
+	// only when the next write comes or at Close: it makes possible to mark
+	// the last segment
+	encryptWriter struct {
+		w     io.Writer
+		aead  cipher.AEAD
+		plain []byte
+		out   []byte
+		seg   uint64
+	}
+
+	// decryptReader is a random access reader of an encrypted object.
+	// It caches the last decrypted segment, so sequential reads decrypt
+	// every segment once. ReadAt is safe for concurrent use
+	decryptReader struct {
+		sync.Mutex
+		file    *os.File
+		aead    cipher.AEAD
+		size    int64 // plaintext size
+		csize   int64 // encrypted size
+		nseg    int64
+		off     int64 // offset for Read and Seek
+		sealed  []byte
+		plain   []byte
+		current int64 // index of the segment in plain, -1 - none
+	}
+)
+
+// Returns the cluster master key for object encryption or error if
+// the key is not configured
+func objectMasterKey() ([]byte, error) {
+	k := getsecretskeeper()
+	if k == nil {
+		return nil, fmt.Errorf("%s is not set: secrets provider is not configured", SecretObjectKey)
+	}
+	encoded := k.get(SecretObjectKey)
+	if encoded == "" {
+		return nil, fmt.Errorf("%s is not defined by secrets provider", SecretObjectKey)
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid %s: %v", SecretObjectKey, err)
+	}
+	if len(key) != encDataKeyLen {
+		return nil, fmt.Errorf("Invalid %s length %d (expecting %d bytes)", SecretObjectKey, len(key), encDataKeyLen)
+	}
+	return key, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Generates a new data key and returns it along with its copy encrypted
+// with the master key
+func newDataKey() (key, wrapped []byte, err error) {
+	var (
+		master []byte
+		aead   cipher.AEAD
+	)
+	if master, err = objectMasterKey(); err != nil {
+		return
+	}
+	if aead, err = newAEAD(master); err != nil {
+		return
+	}
+	key = make([]byte, encDataKeyLen)
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, key); err != nil {
+		return
+	}
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return
+	}
+	sealed := aead.Seal(nonce, nonce, key, nil)
+	wrapped = make([]byte, base64.StdEncoding.EncodedLen(len(sealed)))
+	base64.StdEncoding.Encode(wrapped, sealed)
+	return
+}
+
+func unwrapDataKey(wrapped []byte) ([]byte, error) {
+	master, err := objectMasterKey()
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(master)
+	if err != nil {
+		return nil, err
+	}
+	sealed := make([]byte, base64.StdEncoding.DecodedLen(len(wrapped)))
+	n, err := base64.StdEncoding.Decode(sealed, wrapped)
+	if err != nil {
+		return nil, err
+	}
+	sealed = sealed[:n]
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("Encrypted data key is too short")
+	}
+	return aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+}
+
+func segmentNonce(seg uint64) []byte {
+	nonce := make([]byte, encNonceSize)
+	binary.BigEndian.PutUint64(nonce[encNonceSize-8:], seg)
+	return nonce
+}
+
+// additional authenticated data of a segment: marks the last one
+func segmentAAD(last bool) []byte {
+	if last {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+// Returns the plaintext size of an encrypted object of the given size
+func plainSize(csize int64) int64 {
+	nseg := (csize + encSegmentSize + encTagSize - 1) / (encSegmentSize + encTagSize)
+	return csize - nseg*encTagSize
+}
+
+// Generates a new data key, saves its encrypted copy to the file's xattr
+// and returns a writer that encrypts data with the key
+func encryptObject(fqn string, w io.Writer) (*encryptWriter, string) {
+	key, wrapped, err := newDataKey()
+	if err != nil {
+		return nil, fmt.Sprintf("Failed to generate data key for %s, err: %v", fqn, err)
+	}
+	e, err := newEncryptWriter(w, key)
+	if err != nil {
+		return nil, fmt.Sprintf("Failed to initialize encryption of %s, err: %v", fqn, err)
+	}
+	if errstr := Setxattr(fqn, XattrDataKey, wrapped); errstr != "" {
+		return nil, errstr
+	}
+	return e, ""
+}
+
+func newEncryptWriter(w io.Writer, key []byte) (*encryptWriter, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return &encryptWriter{
+		w:     w,
+		aead:  aead,
+		plain: make([]byte, 0, encSegmentSize),
+		out:   make([]byte, 0, encSegmentSize+encTagSize),
+	}, nil
+}
+
+func (e *encryptWriter) flush(last bool) error {
+	e.out = e.aead.Seal(e.out[:0], segmentNonce(e.seg), e.plain, segmentAAD(last))
+	e.plain = e.plain[:0]
+	e.seg++
+	_, err := e.w.Write(e.out)
+	return err
+}
+
+func (e *encryptWriter) Write(p []byte) (written int, err error) {
+	for len(p) > 0 {
+		if len(e.plain) == encSegmentSize {
+			if err = e.flush(false); err != nil {
+				return
+			}
+		}
+		n := copy(e.plain[len(e.plain):encSegmentSize], p)
+		e.plain = e.plain[:len(e.plain)+n]
+		p = p[n:]
+		written += n
+	}
+	return
+}
+
+// Close seals the last segment. It does not close the underlying writer
+func (e *encryptWriter) Close() error {
+	return e.flush(true)
+}
+
+// Opens an object for reading. Encrypted objects are decrypted transparently.
+// Returns the reader and the object size (plaintext size for encrypted objects)
+func openObject(fqn string) (objectReader, int64, error) {
+	file, err := os.Open(fqn)
+	if err != nil {
+		return nil, 0, err
+	}
+	finfo, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, 0, err
+	}
+	// filesystems without xattrs support cannot keep encrypted objects
+	wrapped, errstr := Getxattr(fqn, XattrDataKey)
+	if errstr != "" && glog.V(4) {
+		glog.Infoln(errstr)
+	}
+	if wrapped == nil {
+		return file, finfo.Size(), nil
+	}
+
+	key, err := unwrapDataKey(wrapped)
+	if err != nil {
+		file.Close()
+		return nil, 0, fmt.Errorf("Failed to decrypt data key of %s, err: %v", fqn, err)
+	}
+	r, err := newDecryptReader(file, key, finfo.Size())
+	if err != nil {
+		file.Close()
+		return nil, 0, fmt.Errorf("Failed to decrypt %s, err: %v", fqn, err)
+	}
+	return r, r.size, nil
+}
+
+// Returns the object size: plaintext size for encrypted objects
+func objectSize(fqn string, osfi os.FileInfo) int64 {
+	if wrapped, errstr := Getxattr(fqn, XattrDataKey); errstr == "" && wrapped != nil {
+		return plainSize(osfi.Size())
+	}
+	return osfi.Size()
+}
+
+func newDecryptReader(file *os.File, key []byte, csize int64) (*decryptReader, error) {
+	if csize < encTagSize {
+		return nil, fmt.Errorf("encrypted object is too short: %d", csize)
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	nseg := (csize + encSegmentSize + encTagSize - 1) / (encSegmentSize + encTagSize)
+	if csize-(nseg-1)*(encSegmentSize+encTagSize) < encTagSize {
+		return nil, fmt.Errorf("encrypted object is truncated: %d", csize)
+	}
+	return &decryptReader{
+		file:    file,
+		aead:    aead,
+		size:    plainSize(csize),
+		csize:   csize,
+		nseg:    nseg,
+		sealed:  make([]byte, encSegmentSize+encTagSize),
+		plain:   make([]byte, 0, encSegmentSize),
+		current: -1,
+	}, nil
+}
+
+// Reads and decrypts a segment. Must be called under lock
+func (d *decryptReader) loadSegment(seg int64) error {
+	if seg == d.current {
+		return nil
+	}
+	off := seg * (encSegmentSize + encTagSize)
+	n := int64(encSegmentSize + encTagSize)
+	if off+n > d.csize {
+		n = d.csize - off
+	}
+	if _, err := d.file.ReadAt(d.sealed[:n], off); err != nil {
+		return err
+	}
+	plain, err := d.aead.Open(d.plain[:0], segmentNonce(uint64(seg)), d.sealed[:n], segmentAAD(seg == d.nseg-1))
+	if err != nil {
+		d.current = -1
+		return fmt.Errorf("segment %d authentication failed: %v", seg, err)
+	}
+	d.plain, d.current = plain, seg
+	return nil
+}
+
+func (d *decryptReader) ReadAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, fmt.Errorf("negative offset %d", off)
+	}
+	d.Lock()
+	defer d.Unlock()
+	for len(p) > 0 {
+		if off >= d.size {
+			return n, io.EOF
+		}
+		seg := off / encSegmentSize
+		if err = d.loadSegment(seg); err != nil {
+			return
+		}
+		copied := copy(p, d.plain[off-seg*encSegmentSize:])
+		n += copied
+		off += int64(copied)
+		p = p[copied:]
+	}
+	return
+}
+
+func (d *decryptReader) Read(p []byte) (n int, err error) {
+	n, err = d.ReadAt(p, d.off)
+	d.off += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return
+}
+
+func (d *decryptReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += d.off
+	case io.SeekEnd:
+		offset += d.size
+	default:
+		return 0, fmt.Errorf("invalid whence %d", whence)
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("negative position %d", offset)
+	}
+	d.off = offset
+	return offset, nil
+}
+
+func (d *decryptReader) Close() error {
+	return d.file.Close()
+}
@@ -0,0 +1,126 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ */
+package dfc
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeEncrypted(t *testing.T, fqn string, key, data []byte) {
+	file, err := os.Create(fqn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	e, err := newEncryptWriter(file, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// write in pieces that do not match segment boundaries
+	for chunk := data; len(chunk) > 0; {
+		n := 1000
+		if n > len(chunk) {
+			n = len(chunk)
+		}
+		if _, err = e.Write(chunk[:n]); err != nil {
+			t.Fatal(err)
+		}
+		chunk = chunk[n:]
+	}
+	if err = e.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func openEncrypted(t *testing.T, fqn string, key []byte) (*decryptReader, error) {
+	file, err := os.Open(fqn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	finfo, err := file.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := newDecryptReader(file, key, finfo.Size())
+	if err != nil {
+		file.Close()
+	}
+	return r, err
+}
+
+func TestEncryptObject(t *testing.T) {
+	dir, err := ioutil.TempDir("", "encrypt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	key := make([]byte, encDataKeyLen)
+	if _, err = rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+
+	fqn := filepath.Join(dir, "obj")
+	sizes := []int{0, 1, encSegmentSize - 1, encSegmentSize, encSegmentSize + 1, 3*encSegmentSize + 5}
+	for _, size := range sizes {
+		data := make([]byte, size)
+		rand.Read(data)
+		writeEncrypted(t, fqn, key, data)
+
+		r, err := openEncrypted(t, fqn, key)
+		if err != nil {
+			t.Fatalf("Size %d: failed to open encrypted object: %v", size, err)
+		}
+		if r.size != int64(size) || plainSize(r.csize) != int64(size) {
+			t.Errorf("Size %d: invalid plaintext size %d", size, r.size)
+		}
+		read, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Errorf("Size %d: failed to read: %v", size, err)
+		} else if !bytes.Equal(read, data) {
+			t.Errorf("Size %d: decrypted data differs", size)
+		}
+		if size > 10 {
+			offset, length := int64(size/2), int64(size/3)
+			section := make([]byte, length)
+			if _, err = io.ReadFull(io.NewSectionReader(r, offset, length), section); err != nil {
+				t.Errorf("Size %d: failed to read range: %v", size, err)
+			} else if !bytes.Equal(section, data[offset:offset+length]) {
+				t.Errorf("Size %d: decrypted range differs", size)
+			}
+		}
+		r.Close()
+	}
+
+	// truncation at a segment boundary must be detected
+	data := make([]byte, 2*encSegmentSize+100)
+	writeEncrypted(t, fqn, key, data)
+	if err = os.Truncate(fqn, encSegmentSize+encTagSize); err != nil {
+		t.Fatal(err)
+	}
+	r, err := openEncrypted(t, fqn, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ioutil.ReadAll(r); err == nil {
+		t.Error("Reading truncated object must fail")
+	}
+	r.Close()
+
+	// wrong key
+	writeEncrypted(t, fqn, key, data)
+	wrongKey := make([]byte, encDataKeyLen)
+	if r, err = openEncrypted(t, fqn, wrongKey); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ioutil.ReadAll(r); err == nil {
+		t.Error("Reading object with wrong key must fail")
+	}
+	r.Close()
+}
@@ -0,0 +1,233 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/NVIDIA/dfcpub/3rdparty/glog"
+)
+
+// Error codes: a machine-readable counterpart of HTTP status
+const (
+	ErrCodeBadRequest     = "BadRequest"
+	ErrCodeUnauthorized   = "Unauthorized"
+	ErrCodeForbidden      = "Forbidden"
+	ErrCodeNotFound       = "NotFound"
+	ErrCodeTimeout        = "Timeout"
+	ErrCodeConflict       = "Conflict"
+	ErrCodePrecondition   = "PreconditionFailed"
+	ErrCodeInvalidRange   = "InvalidRange"
+	ErrCodeSlowDown       = "SlowDown"
+	ErrCodeInternal       = "InternalError"
+	ErrCodeNotImplemented = "NotImplemented"
+	ErrCodeBadGateway     = "BadGateway"
+	ErrCodeUnavailable    = "ServiceUnavailable"
+	ErrCodeGatewayTimeout = "GatewayTimeout"
+)
+
+const errRetryAfter = 1 // seconds, suggested to clients for retryable errors
+
+// Error is a typed DFC error. Besides the message, it carries the HTTP status
+// the error maps to, the error code, and - for errors returned by a cloud
+// provider - the provider and the provider's own error code. Retryable errors
+// are transient: the same request may succeed if repeated later.
+// Proxies, targets and AuthN respond to failed requests with Error in JSON -
+// the error envelope - that also includes the bucket and object of the request,
+// the request ID, and, for retryable errors, the number of seconds to wait
+// before retrying
+type Error struct {
+	Code       string `json:"code"`
+	Message    string `json:"message"`
+	Status     int    `json:"status"`
+	Provider   string `json:"provider,omitempty"`
+	Detail     string `json:"detail,omitempty"`
+	Retryable  bool   `json:"retryable"`
+	Bucket     string `json:"bucket,omitempty"`
+	Object     string `json:"object,omitempty"`
+	RequestID  string `json:"request_id,omitempty"`
+	RetryAfter int    `json:"retry_after,omitempty"`
+}
+
+var errcodes = map[int]string{
+	http.StatusBadRequest:                   ErrCodeBadRequest,
+	http.StatusUnauthorized:                 ErrCodeUnauthorized,
+	http.StatusForbidden:                    ErrCodeForbidden,
+	http.StatusNotFound:                     ErrCodeNotFound,
+	http.StatusRequestTimeout:               ErrCodeTimeout,
+	http.StatusConflict:                     ErrCodeConflict,
+	http.StatusPreconditionFailed:           ErrCodePrecondition,
+	http.StatusRequestedRangeNotSatisfiable: ErrCodeInvalidRange,
+	http.StatusTooManyRequests:              ErrCodeSlowDown,
+	http.StatusInternalServerError:          ErrCodeInternal,
+	http.StatusNotImplemented:               ErrCodeNotImplemented,
+	http.StatusBadGateway:                   ErrCodeBadGateway,
+	http.StatusServiceUnavailable:           ErrCodeUnavailable,
+	http.StatusGatewayTimeout:               ErrCodeGatewayTimeout,
+}
+
+// NewError creates an error with the code and retryability derived from status
+func NewError(status int, format string, a ...interface{}) *Error {
+	if status == 0 {
+		status = http.StatusInternalServerError
+	}
+	code, ok := errcodes[status]
+	if !ok {
+		if status < http.StatusInternalServerError {
+			code = ErrCodeBadRequest
+		} else {
+			code = ErrCodeInternal
+		}
+	}
+	return &Error{
+		Code:      code,
+		Message:   fmt.Sprintf(format, a...),
+		Status:    status,
+		Retryable: retryableStatus(status),
+	}
+}
+
+// cloudError creates an error returned by a cloud provider; detail is the
+// provider's error code, if any
+func cloudError(provider string, status int, detail string, format string, a ...interface{}) *Error {
+	err := NewError(status, format, a...)
+	err.Provider, err.Detail = provider, detail
+	return err
+}
+
+// errorFromStr wraps the (errstr, errcode) pair of the code that is not yet
+// migrated to Error; returns nil if errstr is empty
+func errorFromStr(errstr string, errcode int) *Error {
+	if errstr == "" {
+		return nil
+	}
+	return NewError(errcode, "%s", errstr)
+}
+
+func retryableStatus(status int) bool {
+	switch status {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// errstrcode converts the error into the (errstr, errcode) pair expected by
+// the code that is not yet migrated to Error; nil converts to ("", 0)
+func (e *Error) errstrcode() (errstr string, errcode int) {
+	if e == nil {
+		return
+	}
+	return e.Message, e.Status
+}
+
+// errorhdlr is the typed counterpart of invalmsghdlr: it logs the error and
+// responds with the error envelope
+func (h *httprunner) errorhdlr(w http.ResponseWriter, r *http.Request, err *Error) {
+	s := h.errHTTP(r, err.Message, err.Status)
+	if _, file, line, ok := runtime.Caller(1); ok {
+		s += fmt.Sprintf("(%s, #%d)", filepath.Base(file), line)
+	}
+	h.senderror(w, r, err, s)
+}
+
+// senderror logs and sends the error with the message replaced by the
+// formatted one (see errHTTP)
+func (h *httprunner) senderror(w http.ResponseWriter, r *http.Request, err *Error, s string) {
+	glog.Errorln(s)
+	resp := *err
+	resp.Message = s
+	WriteError(w, r, &resp)
+	h.statsif.add("numerr", 1)
+	if storstats, ok := h.statsif.(*storstatsrunner); ok {
+		bucket := err.Bucket
+		if bucket == "" {
+			bucket, _ = pathBucketObject(r.URL.Path)
+		}
+		if bucket != "" {
+			storstats.addBucket(bucket, "numerr", int64(1))
+		}
+	}
+}
+
+// WriteError responds with the error envelope or, for API v1 requests, with the
+// plain-text message. Unless set, the bucket and the object are taken from the
+// request path; the request ID is the client's one (HeaderRequestID), if any,
+// or a new one
+func WriteError(w http.ResponseWriter, r *http.Request, err *Error) {
+	resp := *err
+	if resp.Bucket == "" {
+		resp.Bucket, resp.Object = pathBucketObject(r.URL.Path)
+	}
+	if resp.RequestID = r.Header.Get(HeaderRequestID); resp.RequestID == "" {
+		resp.RequestID = newRequestID()
+	}
+	if resp.Retryable && resp.RetryAfter == 0 {
+		resp.RetryAfter = errRetryAfter
+	}
+	hdr := w.Header()
+	hdr.Set(HeaderRequestID, resp.RequestID)
+	if resp.RetryAfter > 0 {
+		hdr.Set("Retry-After", strconv.Itoa(resp.RetryAfter))
+	}
+	if APIVersion(r) == Rversion {
+		http.Error(w, resp.Message, resp.Status)
+		return
+	}
+	jsbytes, e := json.Marshal(&resp)
+	assert(e == nil, e)
+
+	hdr.Set("Content-Type", "application/json")
+	hdr.Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(resp.Status)
+	w.Write(jsbytes)
+}
+
+// ErrorFromJSON decodes the error envelope; returns nil if jsbytes is not one
+func ErrorFromJSON(jsbytes []byte) *Error {
+	err := &Error{}
+	if json.Unmarshal(jsbytes, err) != nil || err.Code == "" || err.Status == 0 {
+		return nil
+	}
+	return err
+}
+
+func pathBucketObject(path string) (bucket, objname string) {
+	path = stripAPIVersion(path)
+	for _, prefix := range []string{"/" + Robjects + "/", "/" + Rbuckets + "/"} {
+		if !strings.HasPrefix(path, prefix) {
+			continue
+		}
+		items := strings.SplitN(path[len(prefix):], "/", 2)
+		bucket = items[0]
+		if len(items) > 1 && strings.HasSuffix(prefix, Robjects+"/") {
+			objname = items[1]
+		}
+		return
+	}
+	return
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
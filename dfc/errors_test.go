@@ -0,0 +1,52 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ */
+package dfc
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestError(t *testing.T) {
+	tcs := []struct {
+		status    int
+		code      string
+		retryable bool
+	}{
+		{http.StatusBadRequest, ErrCodeBadRequest, false},
+		{http.StatusNotFound, ErrCodeNotFound, false},
+		{http.StatusTooManyRequests, ErrCodeSlowDown, true},
+		{http.StatusServiceUnavailable, ErrCodeUnavailable, true},
+		{http.StatusTeapot, ErrCodeBadRequest, false},
+		{http.StatusInsufficientStorage, ErrCodeInternal, false},
+		{0, ErrCodeInternal, false},
+	}
+	for _, tc := range tcs {
+		err := NewError(tc.status, "object %s", "o1")
+		if err.Code != tc.code || err.Retryable != tc.retryable || err.Message != "object o1" {
+			t.Errorf("Status %d: unexpected error %+v", tc.status, err)
+		}
+		if tc.status == 0 && err.Status != http.StatusInternalServerError {
+			t.Errorf("Expected status %d, got %d", http.StatusInternalServerError, err.Status)
+		}
+	}
+
+	// wrappers for the code that is not migrated yet
+	if errorFromStr("", http.StatusNotFound) != nil {
+		t.Error("Empty errstr must convert to nil")
+	}
+	var nilerr *Error
+	if errstr, errcode := nilerr.errstrcode(); errstr != "" || errcode != 0 {
+		t.Errorf("nil converted to (%q, %d)", errstr, errcode)
+	}
+	err := errorFromStr("not found", http.StatusNotFound)
+	if errstr, errcode := err.errstrcode(); errstr != "not found" || errcode != http.StatusNotFound {
+		t.Errorf("Expected (%q, %d), got (%q, %d)", "not found", http.StatusNotFound, errstr, errcode)
+	}
+
+	err = cloudError(ProviderGoogle, http.StatusForbidden, "accessDenied", "denied")
+	if err.Provider != ProviderGoogle || err.Detail != "accessDenied" || err.Code != ErrCodeForbidden {
+		t.Errorf("Unexpected cloud error %+v", err)
+	}
+}
@@ -0,0 +1,432 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NVIDIA/dfcpub/3rdparty/glog"
+)
+
+// Bucket export. Upon POST {"action": "export"} /v1/buckets/bucket-name each
+// target packs the objects of the bucket it stores - for a Cloud bucket, the
+// cached ones - into tar shards of about ExportMsg.ShardSize bytes, in the
+// order of the object names. The shards are named
+// <shard-prefix><target-ID>-<NNNNNN>.tar, and each is accompanied by its
+// manifest <shard-name>.json that keeps the objects' sizes, checksums,
+// versions and placement groups (see ExportManifest). The shards and the
+// manifests are written either to a directory at each target or, as objects,
+// to a local bucket. Objects protected with customer-supplied keys are not
+// exported. The export runs in the background; its results are returned by
+// GET /v1/daemon?what=export and, for all targets, by GET /v1/cluster?what=export.
+
+const (
+	exportname      = "export.json"
+	exportShardSize = GiB
+	manifestExt     = ".json" // <shard-name>.json
+)
+
+type (
+	exportObject struct {
+		fqn   string
+		name  string
+		finfo os.FileInfo
+	}
+	// exportShard is the shard being written
+	exportShard struct {
+		name     string // file or object name
+		workfqn  string // the tar file being written
+		file     *os.File
+		cw       *countingWriter // the offset in the shard
+		tw       *tar.Writer
+		size     int64 // bytes of objects
+		manifest *ExportManifest
+	}
+)
+
+func parseExportMsg(bucket string, msg *ActionMsg) (*ExportMsg, error) {
+	expmsg := &ExportMsg{}
+	if msg.Value != nil {
+		b, err := json.Marshal(msg.Value)
+		if err == nil {
+			err = json.Unmarshal(b, expmsg)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Invalid export parameters %v, err: %v", msg.Value, err)
+		}
+	}
+	if (expmsg.Dir == "") == (expmsg.Bucket == "") {
+		return nil, fmt.Errorf("Export requires either the directory or the bucket")
+	}
+	if expmsg.Dir != "" && !filepath.IsAbs(expmsg.Dir) {
+		return nil, fmt.Errorf("Invalid export directory %q: not an absolute path", expmsg.Dir)
+	}
+	if expmsg.Bucket == bucket {
+		return nil, fmt.Errorf("Cannot export bucket %s into itself", bucket)
+	}
+	if expmsg.ShardSize < 0 {
+		return nil, fmt.Errorf("Invalid export shard size %d", expmsg.ShardSize)
+	}
+	if expmsg.ShardSize == 0 {
+		expmsg.ShardSize = exportShardSize
+	}
+	if expmsg.ShardPrefix == "" {
+		expmsg.ShardPrefix = bucket + "-"
+	}
+	return expmsg, nil
+}
+
+//
+// target
+//
+
+// startExport starts the export in the background
+func (t *targetrunner) startExport(w http.ResponseWriter, r *http.Request, msg *ActionMsg) {
+	apitems := t.restAPIItems(r.URL.Path, 5)
+	if apitems = t.checkRestAPI(w, r, apitems, 1, Rversion, Rbuckets); apitems == nil {
+		return
+	}
+	bucket := apitems[0]
+	expmsg, err := parseExportMsg(bucket, msg)
+	if err != nil {
+		t.invalmsghdlr(w, r, err.Error())
+		return
+	}
+	if expmsg.Bucket != "" && !t.bmdowner.get().islocal(expmsg.Bucket) {
+		t.invalmsghdlr(w, r, fmt.Sprintf("Cannot export into %s: not a local bucket", expmsg.Bucket))
+		return
+	}
+	if expmsg.Dir != "" {
+		if err = CreateDir(expmsg.Dir); err != nil {
+			t.invalmsghdlr(w, r, fmt.Sprintf("Cannot export into %s, err: %v", expmsg.Dir, err))
+			return
+		}
+	}
+	xexp, errstr := t.xactinp.renewExport(t, bucket, expmsg)
+	if errstr != "" {
+		t.invalmsghdlr(w, r, errstr, http.StatusConflict)
+		return
+	}
+	go t.runExport(xexp)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func newExportResult(t *targetrunner, bucket string) *ExportResult {
+	result := &ExportResult{Bucket: bucket, Started: time.Now(), Shards: []string{}}
+	if t.si != nil {
+		result.DaemonID = t.si.DaemonID
+	}
+	return result
+}
+
+// exportObjects returns the objects of the bucket stored by the target, sorted by name
+func (t *targetrunner) exportObjects(bucket, prefix string) ([]*exportObject, error) {
+	var (
+		objects []*exportObject
+		islocal = t.bmdowner.get().islocal(bucket)
+	)
+	for mpath := range ctx.mountpaths.Available {
+		dir := filepath.Join(makePathCloud(mpath), bucket)
+		if islocal {
+			dir = filepath.Join(makePathLocal(mpath), bucket)
+		}
+		err := filepath.Walk(dir, func(fqn string, finfo os.FileInfo, err error) error {
+			if err != nil {
+				if fqn == dir && os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			if finfo.IsDir() {
+				return nil
+			}
+			relname, _ := filepath.Rel(dir, fqn)
+			name := filepath.ToSlash(relname)
+			if strings.HasPrefix(name, prefix) {
+				objects = append(objects, &exportObject{fqn: fqn, name: name, finfo: finfo})
+			}
+			return nil
+		})
+		if err != nil {
+			t.runFSKeeper(dir)
+			return nil, fmt.Errorf("Failed to traverse %s, err: %v", dir, err)
+		}
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].name < objects[j].name })
+	return objects, nil
+}
+
+func (t *targetrunner) runExport(xexp *xactExport) *ExportResult {
+	glog.Infoln(xexp.tostring())
+	var (
+		shard  *exportShard
+		nshard int
+		expmsg = xexp.msg
+	)
+	objects, err := t.exportObjects(xexp.bucket, expmsg.Prefix)
+	if err != nil {
+		xexp.failed(err.Error())
+	}
+	for _, obj := range objects {
+		if xexp.aborted() {
+			xexp.failed(fmt.Sprintf("%s aborted", xexp.tostring()))
+			break
+		}
+		if shard != nil && shard.size > 0 && shard.size+obj.finfo.Size() > expmsg.ShardSize {
+			t.closeShard(xexp, shard)
+			shard = nil
+		}
+		if shard == nil {
+			if shard, err = t.newShard(xexp, nshard); err != nil {
+				xexp.failed(err.Error())
+				break
+			}
+			nshard++
+		}
+		if err = t.addToShard(xexp, shard, obj); err != nil {
+			xexp.failed(err.Error())
+			if shard.tw == nil { // the shard is broken
+				shard = nil
+			}
+		}
+	}
+	if shard != nil {
+		t.closeShard(xexp, shard)
+	}
+
+	xexp.mu.Lock()
+	result := xexp.result
+	result.Finished = time.Now()
+	xexp.mu.Unlock()
+	if err := LocalSave(filepath.Join(ctx.config.Confdir, exportname), result); err != nil {
+		glog.Errorf("Failed to store the export results, err: %v", err)
+	}
+	xexp.etime = time.Now()
+	glog.Infof("%s: %d objects (%d bytes) in %d shards, %d errors", xexp.tostring(),
+		result.Objects, result.Bytes, len(result.Shards), len(result.Errors))
+	t.xactinp.del(xexp.id)
+	return result
+}
+
+func (xact *xactExport) failed(errstr string) {
+	glog.Errorf("%s: %s", xact.tostring(), errstr)
+	xact.mu.Lock()
+	xact.result.Errors = append(xact.result.Errors, errstr)
+	xact.mu.Unlock()
+}
+
+func (t *targetrunner) newShard(xexp *xactExport, n int) (*exportShard, error) {
+	shard := &exportShard{name: fmt.Sprintf("%s%s-%06d.tar", xexp.msg.ShardPrefix, t.si.DaemonID, n)}
+	shard.manifest = &ExportManifest{Shard: shard.name, Bucket: xexp.bucket, Objects: []*ExportedObject{}}
+	if xexp.msg.Dir != "" {
+		shard.workfqn = filepath.Join(xexp.msg.Dir, shard.name) + ".tmp"
+	} else {
+		// any mountpath's work directory - orphans are removed at startup
+		for mpath := range ctx.mountpaths.Available {
+			shard.workfqn = filepath.Join(mpath, mpathWorkDir, ActExport+"-"+strings.Replace(shard.name, "/", "_", -1))
+			break
+		}
+		if shard.workfqn == "" {
+			return nil, fmt.Errorf("No mountpaths to write shard %s", shard.name)
+		}
+	}
+	file, err := CreateFile(shard.workfqn)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create shard %s, err: %v", shard.workfqn, err)
+	}
+	shard.file, shard.cw = file, &countingWriter{w: file}
+	shard.tw = tar.NewWriter(shard.cw)
+	return shard, nil
+}
+
+// addToShard appends the object to the shard; upon failure to write the
+// shard the latter is removed and its tar writer is set to nil
+func (t *targetrunner) addToShard(xexp *xactExport, shard *exportShard, obj *exportObject) error {
+	uname := uniquename(xexp.bucket, obj.name)
+	t.rtnamemap.lockname(uname, false, &pendinginfo{Time: time.Now(), fqn: obj.fqn}, time.Second)
+	defer t.rtnamemap.unlockname(uname, false)
+
+	if csekhash, _ := Getxattr(obj.fqn, XattrCustomerKeyHash); csekhash != nil {
+		return fmt.Errorf("Skipping %s: protected with a customer-supplied key", obj.name)
+	}
+	reader, size, err := openObject(obj.fqn)
+	if err != nil {
+		if os.IsNotExist(err) { // evicted or deleted in the meantime
+			return nil
+		}
+		return fmt.Errorf("Failed to read %s, err: %v", obj.fqn, err)
+	}
+	defer reader.Close()
+	exported := &ExportedObject{Name: obj.name, Size: size, ModifiedAt: obj.finfo.ModTime()}
+	if val, _ := Getxattr(obj.fqn, XattrXXHashVal); val != nil {
+		exported.Checksum = string(val)
+	}
+	if val, _ := Getxattr(obj.fqn, XattrObjVersion); val != nil {
+		exported.Version = string(val)
+	}
+	if val, _ := Getxattr(obj.fqn, XattrPlacementGroup); val != nil {
+		exported.Placement = string(val)
+	}
+	hdr := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     obj.name,
+		Size:     size,
+		Mode:     0644,
+		ModTime:  obj.finfo.ModTime(),
+	}
+	slab := selectslab(size)
+	buf := slab.alloc()
+	defer slab.free(buf)
+	if err = shard.tw.WriteHeader(hdr); err == nil {
+		exported.Offset = shard.cw.n // tar.Writer writes the header through
+		_, err = io.CopyBuffer(shard.tw, reader, buf)
+	}
+	if err != nil {
+		t.runFSKeeper(shard.workfqn)
+		shard.file.Close()
+		os.Remove(shard.workfqn)
+		shard.tw = nil
+		return fmt.Errorf("Failed to write %s to shard %s, err: %v", obj.name, shard.name, err)
+	}
+	shard.size += size
+	shard.manifest.Objects = append(shard.manifest.Objects, exported)
+	return nil
+}
+
+// closeShard stores the shard and its manifest in the directory or the bucket
+func (t *targetrunner) closeShard(xexp *xactExport, shard *exportShard) {
+	err := shard.tw.Close()
+	if errclose := shard.file.Close(); err == nil {
+		err = errclose
+	}
+	if err != nil {
+		os.Remove(shard.workfqn)
+		xexp.failed(fmt.Sprintf("Failed to write shard %s, err: %v", shard.workfqn, err))
+		return
+	}
+	mname := shard.name + manifestExt
+	if xexp.msg.Dir != "" {
+		if err = os.Rename(shard.workfqn, filepath.Join(xexp.msg.Dir, shard.name)); err == nil {
+			err = LocalSave(filepath.Join(xexp.msg.Dir, mname), shard.manifest)
+		}
+		if err != nil {
+			os.Remove(shard.workfqn)
+			xexp.failed(fmt.Sprintf("Failed to store shard %s, err: %v", shard.name, err))
+			return
+		}
+	} else {
+		mworkfqn := shard.workfqn + manifestExt
+		if err = LocalSave(mworkfqn, shard.manifest); err != nil {
+			os.Remove(shard.workfqn)
+			xexp.failed(fmt.Sprintf("Failed to write manifest %s, err: %v", mworkfqn, err))
+			return
+		}
+		for name, workfqn := range map[string]string{shard.name: shard.workfqn, mname: mworkfqn} {
+			if errstr := t.exportToBucket(xexp.msg.Bucket, name, workfqn); errstr != "" {
+				xexp.failed(errstr)
+			}
+		}
+	}
+	xexp.mu.Lock()
+	result := xexp.result
+	result.Shards = append(result.Shards, shard.name)
+	result.Objects += int64(len(shard.manifest.Objects))
+	result.Bytes += shard.size
+	xexp.mu.Unlock()
+}
+
+// exportToBucket stores the file as an object of the local bucket, the way
+// import does, and removes it
+func (t *targetrunner) exportToBucket(bucket, objname, workfqn string) (errstr string) {
+	defer os.Remove(workfqn)
+	finfo, err := os.Stat(workfqn)
+	if err != nil {
+		return fmt.Sprintf("Failed to stat %s, err: %v", workfqn, err)
+	}
+	si, errstr := HrwTarget(bucket, objname, t.smapowner.get())
+	if errstr != "" {
+		return
+	}
+	file := &ImportedFile{Path: workfqn, Name: objname, Size: finfo.Size(), Target: si.DaemonID}
+	t.importFile(bucket, file, false)
+	return file.Error
+}
+
+// exportResult returns the results of the running export, if any, or else
+// of the last one; nil if none
+func (t *targetrunner) exportResult() (*ExportResult, error) {
+	if _, xx := t.xactinp.findL(ActExport); xx != nil {
+		xexp := xx.(*xactExport)
+		xexp.mu.Lock()
+		result := *xexp.result
+		result.Shards = append([]string{}, xexp.result.Shards...)
+		result.Errors = append([]string{}, xexp.result.Errors...)
+		xexp.mu.Unlock()
+		return &result, nil
+	}
+	result := &ExportResult{}
+	if err := LocalLoad(filepath.Join(ctx.config.Confdir, exportname), result); err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return result, nil
+}
+
+//
+// proxy
+//
+
+// exportBucket starts the export at all targets
+func (p *proxyrunner) exportBucket(w http.ResponseWriter, r *http.Request, bucket string, msg *ActionMsg) {
+	expmsg, err := parseExportMsg(bucket, msg)
+	if err != nil {
+		p.invalmsghdlr(w, r, err.Error())
+		return
+	}
+	bucketmd := p.bmdowner.get()
+	if expmsg.Bucket != "" && !bucketmd.islocal(expmsg.Bucket) {
+		p.invalmsghdlr(w, r, fmt.Sprintf("Cannot export into %s: not a local bucket", expmsg.Bucket))
+		return
+	}
+	jsbytes, err := json.Marshal(msg)
+	assert(err == nil, err)
+	q := url.Values{}
+	q.Set(URLParamLocal, strconv.FormatBool(bucketmd.islocal(bucket)))
+	results := p.broadcastTargets(URLPath(Rversion, Rbuckets, bucket), q, http.MethodPost, jsbytes,
+		p.smapowner.get(), ctx.config.Timeout.Default)
+	for res := range results {
+		if res.err != nil {
+			p.invalmsghdlr(w, r, fmt.Sprintf("Failed to start export at %s: %v (%d: %s)",
+				res.si.DaemonID, res.err, res.status, res.errstr))
+			return
+		}
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (n int, err error) {
+	n, err = cw.w.Write(p)
+	cw.n += int64(n)
+	return
+}
@@ -0,0 +1,131 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ */
+package dfc
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestExport(t *testing.T) {
+	const bucket, shardbucket = "exportbucket", "shards"
+	dir, err := ioutil.TempDir("", "export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	mpath, out := filepath.Join(dir, "mpath"), filepath.Join(dir, "out")
+	oldavail, oldconfdir, oldcksum := ctx.mountpaths.Available, ctx.config.Confdir, ctx.config.Cksum
+	defer func() {
+		ctx.mountpaths.Available, ctx.config.Confdir, ctx.config.Cksum = oldavail, oldconfdir, oldcksum
+	}()
+	ctx.mountpaths.Available = map[string]*mountPath{mpath: {Path: mpath}}
+	ctx.config.Confdir = dir
+	ctx.config.Cksum.Checksum = ChecksumXXHash
+
+	target, _ := newTestTarget(map[string]BucketProps{bucket: {}, shardbucket: {}})
+
+	// 5 objects of 100 bytes, and one without the prefix
+	objects := make(map[string][]byte)
+	for i := 0; i < 5; i++ {
+		objects[fmt.Sprintf("train/%d.jpg", i)] = []byte(fmt.Sprintf("%0100d", i))
+	}
+	for name, data := range objects {
+		fqn := target.fqn(bucket, name, true)
+		if err = CreateDir(filepath.Dir(fqn)); err != nil {
+			t.Fatal(err)
+		}
+		if err = ioutil.WriteFile(fqn, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = ioutil.WriteFile(target.fqn(bucket, "other", true), []byte("other"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	value := map[string]interface{}{"prefix": "train/", "shard_size": 250, "dir": out}
+	expmsg, err := parseExportMsg(bucket, &ActionMsg{Action: ActExport, Value: value})
+	if err != nil {
+		t.Fatal(err)
+	}
+	xexp, errstr := target.xactinp.renewExport(target, bucket, expmsg)
+	if errstr != "" {
+		t.Fatal(errstr)
+	}
+	result := target.runExport(xexp)
+	// 2+2+1 objects
+	shards := []string{"exportbucket-target-000000.tar", "exportbucket-target-000001.tar", "exportbucket-target-000002.tar"}
+	if !reflect.DeepEqual(result.Shards, shards) || result.Objects != 5 || result.Bytes != 500 || len(result.Errors) != 0 {
+		t.Fatalf("Unexpected export result %+v", result)
+	}
+	var names []string
+	for _, shard := range shards {
+		manifest := &ExportManifest{}
+		if err = LocalLoad(filepath.Join(out, shard+".json"), manifest); err != nil {
+			t.Fatal(err)
+		}
+		file, err := os.Open(filepath.Join(out, shard))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, obj := range manifest.Objects {
+			data := make([]byte, obj.Size)
+			if _, err = file.ReadAt(data, obj.Offset); err != nil || string(data) != string(objects[obj.Name]) {
+				t.Errorf("Shard %s: unexpected %s at offset %d, err: %v", shard, obj.Name, obj.Offset, err)
+			}
+		}
+		tr := tar.NewReader(file)
+		for i := 0; ; i++ {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				if i != len(manifest.Objects) {
+					t.Errorf("Shard %s: %d records, %d in the manifest", shard, i, len(manifest.Objects))
+				}
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, _ := ioutil.ReadAll(tr)
+			if string(data) != string(objects[hdr.Name]) {
+				t.Errorf("Shard %s: unexpected %s", shard, hdr.Name)
+			}
+			if i >= len(manifest.Objects) || manifest.Objects[i].Name != hdr.Name || manifest.Objects[i].Size != 100 {
+				t.Errorf("Shard %s: %s does not match the manifest %+v", shard, hdr.Name, manifest.Objects)
+			}
+			names = append(names, hdr.Name)
+		}
+		file.Close()
+	}
+	if !reflect.DeepEqual(names, []string{"train/0.jpg", "train/1.jpg", "train/2.jpg", "train/3.jpg", "train/4.jpg"}) {
+		t.Errorf("Unexpected exported objects %v", names)
+	}
+
+	// into the bucket
+	value = map[string]interface{}{"bucket": shardbucket, "shard_prefix": "all/"}
+	expmsg, _ = parseExportMsg(bucket, &ActionMsg{Action: ActExport, Value: value})
+	xexp, _ = target.xactinp.renewExport(target, bucket, expmsg)
+	result = target.runExport(xexp)
+	if len(result.Shards) != 1 || result.Objects != 6 || len(result.Errors) != 0 {
+		t.Fatalf("Unexpected export result %+v", result)
+	}
+	for _, name := range []string{"all/target-000000.tar", "all/target-000000.tar.json"} {
+		if _, err = os.Stat(target.fqn(shardbucket, name, true)); err != nil {
+			t.Errorf("Expected object %s/%s, err: %v", shardbucket, name, err)
+		}
+	}
+
+	if _, err = parseExportMsg(bucket, &ActionMsg{Action: ActExport, Value: map[string]interface{}{"bucket": bucket}}); err == nil {
+		t.Error("Expected export into the same bucket to be invalid")
+	}
+	if _, err = parseExportMsg(bucket, &ActionMsg{Action: ActExport}); err == nil {
+		t.Error("Expected export without destination to be invalid")
+	}
+}
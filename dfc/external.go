@@ -0,0 +1,117 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ============================= Background ==================================
+// In a container, the address a daemon listens on is not necessarily the one
+// clients reach it at: the host NATs an external host:port (e.g., hostPort)
+// to the container's. The external address, if any, is taken from:
+//   1. the environment: DFCEXTERNALHOST and DFCEXTERNALPORT
+//   2. the configuration: net.external.host and net.external.port
+//   3. the platform, if net.external.discover: the port mapping that
+//      Nomad (port label "dfc") or Marathon (the first port) exports
+// and becomes the DirectURL that clients get redirected to. Intra-cluster
+// traffic, unless it has its own networks (see intranet.go), stays on the
+// container network at the listening address.
+//
+// The listening port (net.l4.port) may be a range, e.g. "8080-8089", for
+// several containerized targets on a host network - a daemon takes the
+// first free port of the range - or "0" for an ephemeral one.
+// ============================= Background ==================================
+
+const (
+	envExternalHost = "DFCEXTERNALHOST"
+	envExternalPort = "DFCEXTERNALPORT"
+)
+
+// parsePortRange parses the listening port: a port, a range or "0" (ephemeral)
+func parsePortRange(s string) (lo, hi int, err error) {
+	bounds := strings.SplitN(s, "-", 2)
+	if lo, err = strconv.Atoi(strings.TrimSpace(bounds[0])); err != nil {
+		return 0, 0, fmt.Errorf("Invalid port %q", s)
+	}
+	hi = lo
+	if len(bounds) == 2 {
+		if hi, err = strconv.Atoi(strings.TrimSpace(bounds[1])); err != nil {
+			return 0, 0, fmt.Errorf("Invalid port range %q", s)
+		}
+		if lo == 0 || hi < lo {
+			return 0, 0, fmt.Errorf("Invalid port range %q", s)
+		}
+	}
+	if lo < 0 || hi > 65535 {
+		return 0, 0, fmt.Errorf("Invalid port %q", s)
+	}
+	return
+}
+
+func validPort(port string) bool {
+	p, err := strconv.Atoi(port)
+	return err == nil && p > 0 && p <= 65535
+}
+
+// inPortRange returns true if the port belongs to the (non-ephemeral) range
+func inPortRange(port, portrange string) bool {
+	p, err := strconv.Atoi(port)
+	if err != nil {
+		return false
+	}
+	lo, hi, err := parsePortRange(portrange)
+	return err == nil && lo > 0 && p >= lo && p <= hi
+}
+
+// listenPublic binds the first free port of the range on all local IPs
+func listenPublic(portrange string) (ln net.Listener, port string, err error) {
+	lo, hi, err := parsePortRange(portrange)
+	if err != nil {
+		return
+	}
+	for p := lo; p <= hi; p++ {
+		if ln, err = net.Listen("tcp", net.JoinHostPort("", strconv.Itoa(p))); err == nil {
+			_, port, err = net.SplitHostPort(ln.Addr().String())
+			return
+		}
+	}
+	return nil, "", fmt.Errorf("Failed to listen on port(s) %s: %v", portrange, err)
+}
+
+// externalAddr returns the host and port for clients to reach the daemon at;
+// the listening ones, if there is no NAT in between
+func externalAddr(cnf *externalcnf, ipaddr, port string) (host, extport string) {
+	host, extport = os.Getenv(envExternalHost), os.Getenv(envExternalPort)
+	if host == "" && extport == "" {
+		host, extport = cnf.Host, cnf.Port
+	}
+	if host == "" && extport == "" && cnf.Discover {
+		host, extport = platformAddr()
+	}
+	if host == "" {
+		host = ipaddr
+	}
+	if extport == "" {
+		extport = port
+	}
+	return
+}
+
+// platformAddr returns the external host and port exported by the container orchestrator
+func platformAddr() (host, port string) {
+	if port = os.Getenv("NOMAD_HOST_PORT_dfc"); port != "" {
+		return os.Getenv("NOMAD_HOST_IP_dfc"), port
+	}
+	if os.Getenv("MARATHON_APP_ID") != "" {
+		return os.Getenv("HOST"), os.Getenv("PORT0")
+	}
+	return "", ""
+}
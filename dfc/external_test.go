@@ -0,0 +1,86 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"testing"
+)
+
+func TestParsePortRange(t *testing.T) {
+	for _, test := range []struct {
+		port   string
+		lo, hi int
+		ok     bool
+	}{
+		{"8080", 8080, 8080, true},
+		{"8080-8089", 8080, 8089, true},
+		{"0", 0, 0, true},
+		{"", 0, 0, false},
+		{"port", 0, 0, false},
+		{"8089-8080", 0, 0, false},
+		{"0-10", 0, 0, false},
+		{"8080-70000", 0, 0, false},
+	} {
+		lo, hi, err := parsePortRange(test.port)
+		if (err == nil) != test.ok || lo != test.lo || hi != test.hi {
+			t.Errorf("%q: expected %d-%d (ok=%t), got %d-%d, err: %v", test.port, test.lo, test.hi, test.ok, lo, hi, err)
+		}
+	}
+	if !inPortRange("8085", "8080-8089") || inPortRange("8090", "8080-8089") || inPortRange("8080", "0") {
+		t.Error("Unexpected port range membership")
+	}
+}
+
+func TestListenPublic(t *testing.T) {
+	ln, port, err := listenPublic("0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	if !validPort(port) {
+		t.Fatalf("Unexpected ephemeral port %s", port)
+	}
+	// the port is taken: the range moves on to the next free one
+	p, _ := strconv.Atoi(port)
+	ln2, port2, err := listenPublic(port + "-" + strconv.Itoa(p+10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln2.Close()
+	if port2 == port || !inPortRange(port2, port+"-"+strconv.Itoa(p+10)) {
+		t.Errorf("Expected another port of the range, got %s", port2)
+	}
+	if _, _, err = listenPublic(port); err == nil {
+		t.Errorf("Expected the taken port %s to fail", port)
+	}
+}
+
+func TestExternalAddr(t *testing.T) {
+	for _, env := range []string{envExternalHost, envExternalPort, "NOMAD_HOST_IP_dfc", "NOMAD_HOST_PORT_dfc"} {
+		defer os.Setenv(env, os.Getenv(env))
+		os.Unsetenv(env)
+	}
+	cnf := &externalcnf{}
+	if host, port := externalAddr(cnf, "172.17.0.2", "8080"); host != "172.17.0.2" || port != "8080" {
+		t.Errorf("Expected the listening address, got %s", net.JoinHostPort(host, port))
+	}
+	cnf.Discover = true
+	os.Setenv("NOMAD_HOST_IP_dfc", "10.0.0.1")
+	os.Setenv("NOMAD_HOST_PORT_dfc", "31000")
+	if host, port := externalAddr(cnf, "172.17.0.2", "8080"); host != "10.0.0.1" || port != "31000" {
+		t.Errorf("Expected the platform address, got %s", net.JoinHostPort(host, port))
+	}
+	cnf.Port = "30080"
+	if host, port := externalAddr(cnf, "172.17.0.2", "8080"); host != "172.17.0.2" || port != "30080" {
+		t.Errorf("Expected the configured port, got %s", net.JoinHostPort(host, port))
+	}
+	os.Setenv(envExternalHost, "dfc.example.com")
+	if host, port := externalAddr(cnf, "172.17.0.2", "8080"); host != "dfc.example.com" || port != "8080" {
+		t.Errorf("Expected the environment host, got %s", net.JoinHostPort(host, port))
+	}
+}
@@ -0,0 +1,598 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/NVIDIA/dfcpub/3rdparty/glog"
+)
+
+// ============================= Fake S3 =====================================
+// With -fakes3=<dir> a target runs a minimal S3-compatible server backed by
+// the directory and talks to it instead of AWS, so that the cold GET,
+// write-through and list code paths run without a cloud account (CI, demos).
+// The directory's subdirectories are the buckets and the files in them - the
+// objects, named by their relative paths; targets on the same host can share
+// the directory. The server listens on -fakes3addr (an ephemeral loopback
+// port by default), supports path-style requests only, ignores signatures,
+// and implements the subset of the S3 API that DFC uses: list buckets, HEAD
+// and create bucket, list objects (v1 and v2), HEAD, GET (including ranges), PUT
+// (including multipart uploads) and DELETE object. Buckets are unversioned
+// and unencrypted. User metadata and ETags of the objects PUT via the server
+// are kept under fakes3Meta; ETags of the files copied to the directory
+// directly are computed upon request.
+// ============================= Fake S3 =====================================
+
+const (
+	fakes3Meta    = ".fakes3"   // metadata and multipart uploads, under the root directory
+	fakes3Region  = "us-east-1" // region the AWS client is configured with
+	fakes3XMLNS   = "http://s3.amazonaws.com/doc/2006-03-01/"
+	fakes3MaxKeys = 1000
+	fakes3TimeFmt = "2006-01-02T15:04:05.000Z"
+)
+
+// awsEndpoint, if set, overrides AWS endpoint (see createSession)
+var awsEndpoint string
+
+type (
+	fakes3runner struct {
+		namedrunner
+		root     string
+		listener net.Listener
+		server   *http.Server
+	}
+	fakes3ObjMeta struct {
+		ETag     string            `json:"etag"`
+		Metadata map[string]string `json:"metadata,omitempty"` // x-amz-meta-* headers
+	}
+	fakes3Error struct {
+		XMLName  xml.Name `xml:"Error"`
+		Code     string   `xml:"Code"`
+		Message  string   `xml:"Message"`
+		Resource string   `xml:"Resource"`
+	}
+	fakes3Bucket struct {
+		Name         string `xml:"Name"`
+		CreationDate string `xml:"CreationDate"`
+	}
+	fakes3ListBuckets struct {
+		XMLName xml.Name       `xml:"ListAllMyBucketsResult"`
+		Xmlns   string         `xml:"xmlns,attr"`
+		Buckets []fakes3Bucket `xml:"Buckets>Bucket"`
+	}
+	fakes3Object struct {
+		Key          string `xml:"Key"`
+		LastModified string `xml:"LastModified"`
+		ETag         string `xml:"ETag"`
+		Size         int64  `xml:"Size"`
+		StorageClass string `xml:"StorageClass"`
+	}
+	fakes3Prefix struct {
+		Prefix string `xml:"Prefix"`
+	}
+	// v1 and v2 results differ in how the next page is requested only
+	fakes3ListObjects struct {
+		XMLName               xml.Name       `xml:"ListBucketResult"`
+		Xmlns                 string         `xml:"xmlns,attr"`
+		Name                  string         `xml:"Name"`
+		Prefix                string         `xml:"Prefix"`
+		Marker                string         `xml:"Marker,omitempty"`
+		NextMarker            string         `xml:"NextMarker,omitempty"`
+		StartAfter            string         `xml:"StartAfter,omitempty"`
+		ContinuationToken     string         `xml:"ContinuationToken,omitempty"`
+		NextContinuationToken string         `xml:"NextContinuationToken,omitempty"`
+		KeyCount              int            `xml:"KeyCount,omitempty"`
+		MaxKeys               int            `xml:"MaxKeys"`
+		Delimiter             string         `xml:"Delimiter,omitempty"`
+		IsTruncated           bool           `xml:"IsTruncated"`
+		Contents              []fakes3Object `xml:"Contents"`
+		CommonPrefixes        []fakes3Prefix `xml:"CommonPrefixes"`
+	}
+	fakes3Versioning struct {
+		XMLName xml.Name `xml:"VersioningConfiguration"`
+		Xmlns   string   `xml:"xmlns,attr"`
+	}
+	fakes3InitUpload struct {
+		XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+		Xmlns    string   `xml:"xmlns,attr"`
+		Bucket   string   `xml:"Bucket"`
+		Key      string   `xml:"Key"`
+		UploadID string   `xml:"UploadId"`
+	}
+	fakes3CompleteUpload struct {
+		Parts []struct {
+			PartNumber int    `xml:"PartNumber"`
+			ETag       string `xml:"ETag"`
+		} `xml:"Part"`
+	}
+	fakes3CompleteResult struct {
+		XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+		Xmlns   string   `xml:"xmlns,attr"`
+		Bucket  string   `xml:"Bucket"`
+		Key     string   `xml:"Key"`
+		ETag    string   `xml:"ETag"`
+	}
+)
+
+// newfakes3runner listens right away so that the endpoint is known before
+// the target starts
+func newfakes3runner(root, addr string) (*fakes3runner, error) {
+	if err := CreateDir(filepath.Join(root, fakes3Meta)); err != nil {
+		return nil, fmt.Errorf("Failed to create fake S3 directory %s, err: %v", root, err)
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to listen on %s, err: %v", addr, err)
+	}
+	r := &fakes3runner{root: root, listener: listener}
+	r.server = &http.Server{Handler: r}
+	return r, nil
+}
+
+func (r *fakes3runner) endpoint() string { return "http://" + r.listener.Addr().String() }
+
+func (r *fakes3runner) run() error {
+	glog.Infof("Fake S3 at %s, directory %s", r.endpoint(), r.root)
+	if err := r.server.Serve(r.listener); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+func (r *fakes3runner) stop(err error) {
+	glog.Infof("Stopping %s, err: %v", r.name, err)
+	r.server.Close()
+}
+
+//
+// request handling
+//
+
+func (r *fakes3runner) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	path := strings.TrimPrefix(req.URL.Path, "/")
+	if path == "" {
+		if req.Method != http.MethodGet {
+			r.error(w, req, http.StatusMethodNotAllowed, "MethodNotAllowed", req.Method)
+			return
+		}
+		r.listBuckets(w, req)
+		return
+	}
+	parts := strings.SplitN(path, "/", 2)
+	bucket := parts[0]
+	if bucket == fakes3Meta || strings.HasPrefix(bucket, ".") {
+		r.error(w, req, http.StatusBadRequest, "InvalidBucketName", bucket)
+		return
+	}
+	if len(parts) == 1 || parts[1] == "" {
+		r.bucketHandler(w, req, bucket)
+		return
+	}
+	key := parts[1]
+	if strings.Contains("/"+key+"/", "/../") || strings.HasPrefix(key, "/") {
+		r.error(w, req, http.StatusBadRequest, "InvalidArgument", key)
+		return
+	}
+	if _, err := os.Stat(filepath.Join(r.root, bucket)); err != nil {
+		r.error(w, req, http.StatusNotFound, "NoSuchBucket", bucket)
+		return
+	}
+	r.objectHandler(w, req, bucket, key)
+}
+
+func (r *fakes3runner) bucketHandler(w http.ResponseWriter, req *http.Request, bucket string) {
+	dir := filepath.Join(r.root, bucket)
+	if req.Method == http.MethodPut {
+		if err := CreateDir(dir); err != nil {
+			r.error(w, req, http.StatusInternalServerError, "InternalError", err.Error())
+		}
+		return
+	}
+	if finfo, err := os.Stat(dir); err != nil || !finfo.IsDir() {
+		r.error(w, req, http.StatusNotFound, "NoSuchBucket", bucket)
+		return
+	}
+	q := req.URL.Query()
+	switch {
+	case req.Method == http.MethodHead:
+	case req.Method != http.MethodGet:
+		r.error(w, req, http.StatusMethodNotAllowed, "MethodNotAllowed", req.Method)
+	case hasQuery(q, "versioning"):
+		r.writeXML(w, &fakes3Versioning{Xmlns: fakes3XMLNS})
+	case hasQuery(q, "encryption"):
+		r.error(w, req, http.StatusNotFound, awsNoEncryptionConfig, bucket)
+	default:
+		r.listObjects(w, req, bucket)
+	}
+}
+
+func (r *fakes3runner) objectHandler(w http.ResponseWriter, req *http.Request, bucket, key string) {
+	q := req.URL.Query()
+	// upload IDs name directories under the root: accept only the ones initUpload generates
+	if uploadID := q.Get("uploadId"); uploadID != "" && !validUploadID(uploadID) {
+		r.error(w, req, http.StatusNotFound, "NoSuchUpload", uploadID)
+		return
+	}
+	switch req.Method {
+	case http.MethodHead, http.MethodGet:
+		r.getObject(w, req, bucket, key)
+	case http.MethodPut:
+		if uploadID := q.Get("uploadId"); uploadID != "" {
+			r.putPart(w, req, uploadID, q.Get("partNumber"))
+		} else {
+			r.putObject(w, req, bucket, key)
+		}
+	case http.MethodPost:
+		switch {
+		case hasQuery(q, "uploads"):
+			r.initUpload(w, req, bucket, key)
+		case q.Get("uploadId") != "":
+			r.completeUpload(w, req, bucket, key, q.Get("uploadId"))
+		case hasQuery(q, "restore"):
+			// not archived: nothing to restore
+		default:
+			r.error(w, req, http.StatusBadRequest, "InvalidRequest", req.URL.RawQuery)
+		}
+	case http.MethodDelete:
+		if uploadID := q.Get("uploadId"); uploadID != "" {
+			os.RemoveAll(r.uploadDir(uploadID))
+		} else {
+			os.Remove(filepath.Join(r.root, bucket, key))
+			os.Remove(r.metaPath(bucket, key))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		r.error(w, req, http.StatusMethodNotAllowed, "MethodNotAllowed", req.Method)
+	}
+}
+
+func (r *fakes3runner) listBuckets(w http.ResponseWriter, req *http.Request) {
+	infos, err := ioutil.ReadDir(r.root)
+	if err != nil {
+		r.error(w, req, http.StatusInternalServerError, "InternalError", err.Error())
+		return
+	}
+	result := &fakes3ListBuckets{Xmlns: fakes3XMLNS}
+	for _, finfo := range infos {
+		if finfo.IsDir() && !strings.HasPrefix(finfo.Name(), ".") {
+			result.Buckets = append(result.Buckets,
+				fakes3Bucket{Name: finfo.Name(), CreationDate: finfo.ModTime().UTC().Format(fakes3TimeFmt)})
+		}
+	}
+	r.writeXML(w, result)
+}
+
+func (r *fakes3runner) listObjects(w http.ResponseWriter, req *http.Request, bucket string) {
+	var (
+		q         = req.URL.Query()
+		v2        = q.Get("list-type") == "2"
+		prefix    = q.Get("prefix")
+		marker    = q.Get("marker")
+		token     = q.Get("continuation-token")
+		delimiter = q.Get("delimiter")
+		maxkeys   = fakes3MaxKeys
+		dir       = filepath.Join(r.root, bucket)
+		keys      = make([]string, 0, 64)
+		infos     = make(map[string]os.FileInfo)
+	)
+	if v2 {
+		// the continuation token is the encoded name the previous page ends with
+		marker = q.Get("start-after")
+		if token != "" {
+			b, err := base64.RawURLEncoding.DecodeString(token)
+			if err != nil {
+				r.error(w, req, http.StatusBadRequest, "InvalidArgument", "Invalid continuation token "+token)
+				return
+			}
+			marker = string(b)
+		}
+	}
+	if s := q.Get("max-keys"); s != "" {
+		if n, err := strconv.Atoi(s); err == nil && n > 0 && n < maxkeys {
+			maxkeys = n
+		}
+	}
+	err := filepath.Walk(dir, func(fqn string, finfo os.FileInfo, err error) error {
+		if err != nil || finfo.IsDir() || strings.HasPrefix(finfo.Name(), ".fakes3-") { // skip PUTs in progress
+			return err
+		}
+		key, err := filepath.Rel(dir, fqn)
+		if err != nil {
+			return err
+		}
+		key = filepath.ToSlash(key)
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+			infos[key] = finfo
+		}
+		return nil
+	})
+	if err != nil {
+		r.error(w, req, http.StatusInternalServerError, "InternalError", err.Error())
+		return
+	}
+	sort.Strings(keys)
+
+	result := &fakes3ListObjects{Xmlns: fakes3XMLNS, Name: bucket, Prefix: prefix, MaxKeys: maxkeys, Delimiter: delimiter}
+	if v2 {
+		result.StartAfter, result.ContinuationToken = q.Get("start-after"), token
+	} else {
+		result.Marker = marker
+	}
+	var last string
+	for _, key := range keys {
+		if key <= marker {
+			continue
+		}
+		name := key
+		if delimiter != "" {
+			if i := strings.Index(key[len(prefix):], delimiter); i >= 0 {
+				name = key[:len(prefix)+i+len(delimiter)]
+			}
+		}
+		if name != key && (name == last || name == marker) { // common prefix already listed
+			continue
+		}
+		if len(result.Contents)+len(result.CommonPrefixes) == maxkeys {
+			result.IsTruncated = true
+			if v2 {
+				result.NextContinuationToken = base64.RawURLEncoding.EncodeToString([]byte(last))
+			} else if delimiter != "" {
+				result.NextMarker = last
+			}
+			break
+		}
+		last = name
+		if name != key {
+			result.CommonPrefixes = append(result.CommonPrefixes, fakes3Prefix{Prefix: name})
+			continue
+		}
+		finfo := infos[key]
+		meta := r.objMeta(bucket, key)
+		result.Contents = append(result.Contents, fakes3Object{
+			Key:          key,
+			LastModified: finfo.ModTime().UTC().Format(fakes3TimeFmt),
+			ETag:         meta.ETag,
+			Size:         finfo.Size(),
+			StorageClass: "STANDARD",
+		})
+	}
+	if v2 {
+		result.KeyCount = len(result.Contents) + len(result.CommonPrefixes)
+	}
+	r.writeXML(w, result)
+}
+
+func (r *fakes3runner) getObject(w http.ResponseWriter, req *http.Request, bucket, key string) {
+	fqn := filepath.Join(r.root, bucket, key)
+	file, err := os.Open(fqn)
+	if err != nil {
+		r.error(w, req, http.StatusNotFound, "NoSuchKey", key)
+		return
+	}
+	defer file.Close()
+	finfo, err := file.Stat()
+	if err != nil || finfo.IsDir() {
+		r.error(w, req, http.StatusNotFound, "NoSuchKey", key)
+		return
+	}
+	meta := r.objMeta(bucket, key)
+	for k, v := range meta.Metadata {
+		w.Header().Set(k, v)
+	}
+	w.Header().Set("ETag", meta.ETag)
+	w.Header().Set("Content-Type", "application/octet-stream")
+	// handles HEAD, Range and If-Match
+	http.ServeContent(w, req, "", finfo.ModTime(), file)
+}
+
+func (r *fakes3runner) putObject(w http.ResponseWriter, req *http.Request, bucket, key string) {
+	etag, errstr := r.receive(filepath.Join(r.root, bucket, key), req.Body)
+	if errstr != "" {
+		r.error(w, req, http.StatusInternalServerError, "InternalError", errstr)
+		return
+	}
+	r.saveMeta(bucket, key, &fakes3ObjMeta{ETag: etag, Metadata: userMetadata(req.Header)})
+	w.Header().Set("ETag", etag)
+}
+
+func (r *fakes3runner) initUpload(w http.ResponseWriter, req *http.Request, bucket, key string) {
+	uploadID := newRequestID()
+	if err := CreateDir(r.uploadDir(uploadID)); err != nil {
+		r.error(w, req, http.StatusInternalServerError, "InternalError", err.Error())
+		return
+	}
+	// the user metadata comes with the initiating request
+	r.saveMeta(fakes3Meta, uploadID, &fakes3ObjMeta{Metadata: userMetadata(req.Header)})
+	r.writeXML(w, &fakes3InitUpload{Xmlns: fakes3XMLNS, Bucket: bucket, Key: key, UploadID: uploadID})
+}
+
+func (r *fakes3runner) putPart(w http.ResponseWriter, req *http.Request, uploadID, partnum string) {
+	n, err := strconv.Atoi(partnum)
+	if err != nil || n < 1 {
+		r.error(w, req, http.StatusBadRequest, "InvalidArgument", "partNumber "+partnum)
+		return
+	}
+	if _, err := os.Stat(r.uploadDir(uploadID)); err != nil {
+		r.error(w, req, http.StatusNotFound, "NoSuchUpload", uploadID)
+		return
+	}
+	etag, errstr := r.receive(filepath.Join(r.uploadDir(uploadID), strconv.Itoa(n)), req.Body)
+	if errstr != "" {
+		r.error(w, req, http.StatusInternalServerError, "InternalError", errstr)
+		return
+	}
+	w.Header().Set("ETag", etag)
+}
+
+func (r *fakes3runner) completeUpload(w http.ResponseWriter, req *http.Request, bucket, key, uploadID string) {
+	dir := r.uploadDir(uploadID)
+	defer func() {
+		os.RemoveAll(dir)
+		os.Remove(r.metaPath(fakes3Meta, uploadID))
+	}()
+	complete := &fakes3CompleteUpload{}
+	if err := xml.NewDecoder(req.Body).Decode(complete); err != nil {
+		r.error(w, req, http.StatusBadRequest, "MalformedXML", err.Error())
+		return
+	}
+	readers := make([]io.Reader, 0, len(complete.Parts))
+	for _, part := range complete.Parts {
+		file, err := os.Open(filepath.Join(dir, strconv.Itoa(part.PartNumber)))
+		if err != nil {
+			r.error(w, req, http.StatusBadRequest, "InvalidPart", strconv.Itoa(part.PartNumber))
+			return
+		}
+		defer file.Close()
+		readers = append(readers, file)
+	}
+	md5etag, errstr := r.receive(filepath.Join(r.root, bucket, key), io.MultiReader(readers...))
+	if errstr != "" {
+		r.error(w, req, http.StatusInternalServerError, "InternalError", errstr)
+		return
+	}
+	// as S3 does, multipart ETags are not MD5 of the content
+	etag := fmt.Sprintf("%s-%d\"", strings.TrimSuffix(md5etag, "\""), len(complete.Parts))
+	r.saveMeta(bucket, key, &fakes3ObjMeta{ETag: etag, Metadata: r.objMeta(fakes3Meta, uploadID).Metadata})
+	r.writeXML(w, &fakes3CompleteResult{Xmlns: fakes3XMLNS, Bucket: bucket, Key: key, ETag: etag})
+}
+
+//
+// storage
+//
+
+// receive writes the data to the file via a temporary one and returns its quoted MD5
+func (r *fakes3runner) receive(fqn string, reader io.Reader) (etag, errstr string) {
+	if err := CreateDir(filepath.Dir(fqn)); err != nil {
+		return "", err.Error()
+	}
+	file, err := ioutil.TempFile(filepath.Dir(fqn), ".fakes3-")
+	if err != nil {
+		return "", err.Error()
+	}
+	md5hash := md5.New()
+	_, err = io.Copy(io.MultiWriter(file, md5hash), reader)
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), fqn)
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return "", err.Error()
+	}
+	return strconv.Quote(hex.EncodeToString(md5hash.Sum(nil))), ""
+}
+
+// validUploadID returns true if the ID is hex, as the ones of newRequestID
+func validUploadID(uploadID string) bool {
+	_, err := hex.DecodeString(uploadID)
+	return err == nil
+}
+
+func (r *fakes3runner) uploadDir(uploadID string) string {
+	return filepath.Join(r.root, fakes3Meta, "uploads", uploadID)
+}
+
+func (r *fakes3runner) metaPath(bucket, key string) string {
+	return filepath.Join(r.root, fakes3Meta, "meta", bucket, key+".json")
+}
+
+func (r *fakes3runner) saveMeta(bucket, key string, meta *fakes3ObjMeta) {
+	pathname := r.metaPath(bucket, key)
+	err := CreateDir(filepath.Dir(pathname))
+	if err == nil {
+		err = LocalSave(pathname, meta)
+	}
+	if err != nil {
+		glog.Errorf("Failed to save fake S3 metadata %s, err: %v", pathname, err)
+	}
+}
+
+// userMetadata returns x-amz-meta-* headers of the request
+func userMetadata(header http.Header) (metadata map[string]string) {
+	for k := range header {
+		if strings.HasPrefix(strings.ToLower(k), "x-amz-meta-") {
+			if metadata == nil {
+				metadata = make(map[string]string)
+			}
+			metadata[k] = header.Get(k)
+		}
+	}
+	return
+}
+
+// objMeta returns the saved metadata of the object, if up to date; otherwise
+// computes the ETag of the file
+func (r *fakes3runner) objMeta(bucket, key string) *fakes3ObjMeta {
+	meta := &fakes3ObjMeta{}
+	fqn := filepath.Join(r.root, bucket, key)
+	if bucket != fakes3Meta {
+		finfo, err := os.Stat(fqn)
+		minfo, merr := os.Stat(r.metaPath(bucket, key))
+		if err == nil && merr == nil && !minfo.ModTime().Before(finfo.ModTime()) &&
+			LocalLoad(r.metaPath(bucket, key), meta) == nil && meta.ETag != "" {
+			return meta
+		}
+	} else if LocalLoad(r.metaPath(bucket, key), meta) == nil {
+		return meta
+	}
+	meta = &fakes3ObjMeta{}
+	if file, err := os.Open(fqn); err == nil {
+		md5hash := md5.New()
+		if _, err = io.Copy(md5hash, file); err == nil {
+			meta.ETag = strconv.Quote(hex.EncodeToString(md5hash.Sum(nil)))
+		}
+		file.Close()
+	}
+	return meta
+}
+
+//
+// helpers
+//
+
+func hasQuery(q map[string][]string, name string) bool {
+	_, ok := q[name]
+	return ok
+}
+
+func (r *fakes3runner) writeXML(w http.ResponseWriter, v interface{}) {
+	b, err := xml.Marshal(v)
+	assert(err == nil, err)
+	w.Header().Set("Content-Type", "application/xml")
+	w.Write([]byte(xml.Header))
+	w.Write(b)
+}
+
+func (r *fakes3runner) error(w http.ResponseWriter, req *http.Request, status int, code, message string) {
+	if glog.V(4) {
+		glog.Infof("fake S3: %s %s: %d %s %s", req.Method, req.URL, status, code, message)
+	}
+	b, err := xml.Marshal(&fakes3Error{Code: code, Message: message, Resource: req.URL.Path})
+	assert(err == nil, err)
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	if req.Method != http.MethodHead {
+		w.Write([]byte(xml.Header))
+		w.Write(b)
+	}
+}
@@ -0,0 +1,192 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ */
+package dfc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestFakeS3(t *testing.T) {
+	const bucket = "fakebucket"
+	dir, err := ioutil.TempDir("", "fakes3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	root := filepath.Join(dir, "s3")
+	r, err := newfakes3runner(root, "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go r.run()
+	defer r.stop(nil)
+	oldendpoint, oldcksum, oldcoldget := awsEndpoint, ctx.config.Cksum, ctx.config.ColdGet
+	defer func() { awsEndpoint, ctx.config.Cksum, ctx.config.ColdGet = oldendpoint, oldcksum, oldcoldget }()
+	awsEndpoint = r.endpoint()
+	ctx.config.Cksum = cksumconfig{Checksum: ChecksumXXHash, ValidateColdGet: true}
+	ctx.config.ColdGet = coldgetconf{}
+
+	// the object copied to the directory directly
+	if err = CreateDir(filepath.Join(root, bucket, "dir")); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(root, bucket, "dir", "copied"), []byte("copied"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	target := &targetrunner{}
+	target.bmdowner = &bmdowner{}
+	target.bmdowner.put(newBucketMD())
+	s3 := &awsimpl{t: target}
+	ct := context.Background()
+
+	buckets, cerr := s3.getbucketnames(ct)
+	if cerr != nil {
+		t.Fatal(cerr)
+	}
+	if !reflect.DeepEqual(buckets, []string{bucket}) {
+		t.Fatalf("Unexpected buckets %v", buckets)
+	}
+	bprops, cerr := s3.headbucket(ct, bucket)
+	if cerr != nil {
+		t.Fatal(cerr)
+	}
+	if bprops[Versioning] != VersionNone || bprops[CloudSSE] != "none" {
+		t.Errorf("Unexpected bucket props %v", bprops)
+	}
+
+	small := []byte("The quick brown fox jumps over the lazy dog")
+	large := make([]byte, 6*MiB) // multipart upload
+	rand.New(rand.NewSource(1)).Read(large)
+	for name, data := range map[string][]byte{"dir/small": small, "dir/large": large} {
+		if _, cerr = s3.putobj(ct, bytes.NewReader(data), bucket, name, nil); cerr != nil {
+			t.Fatalf("Failed to PUT %s: %v", name, cerr)
+		}
+	}
+	objmeta, cerr := s3.headobject(ct, bucket, "dir/large")
+	if cerr != nil {
+		t.Fatal(cerr)
+	}
+	if objmeta[Size] != strconv.Itoa(len(large)) {
+		t.Errorf("Unexpected size %s", objmeta[Size])
+	}
+
+	// two pages
+	msg := &GetMsg{GetPrefix: "dir/", GetProps: GetPropsSize, GetPageSize: 2}
+	var names []string
+	for i := 0; i < 2; i++ {
+		jsbytes, cerr := s3.listbucket(ct, bucket, msg)
+		if cerr != nil {
+			t.Fatal(cerr)
+		}
+		list := &BucketList{}
+		if err = json.Unmarshal(jsbytes, list); err != nil {
+			t.Fatal(err)
+		}
+		for _, entry := range list.Entries {
+			names = append(names, entry.Name)
+		}
+		if (i == 0) != (list.PageMarker != "") {
+			t.Fatalf("Unexpected page marker %q on page %d", list.PageMarker, i)
+		}
+		msg.GetPageMarker = list.PageMarker
+	}
+	if !reflect.DeepEqual(names, []string{"dir/copied", "dir/large", "dir/small"}) {
+		t.Fatalf("Unexpected list %v", names)
+	}
+
+	// after the given name, with the versions of the listed objects
+	msg = &GetMsg{GetStartAfter: "dir/copied", GetProps: GetPropsVersion, GetDelimiter: "/"}
+	jsbytes, cerr := s3.listbucket(ct, bucket, msg)
+	if cerr != nil {
+		t.Fatal(cerr)
+	}
+	list := &BucketList{}
+	if err = json.Unmarshal(jsbytes, list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Entries) != 0 || !reflect.DeepEqual(list.CommonPrefixes, []string{"dir/"}) {
+		t.Fatalf("Unexpected list %+v", list)
+	}
+	msg.GetPrefix, msg.GetDelimiter = "dir/", ""
+	if jsbytes, cerr = s3.listbucket(ct, bucket, msg); cerr != nil {
+		t.Fatal(cerr)
+	}
+	list = &BucketList{}
+	if err = json.Unmarshal(jsbytes, list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Entries) != 2 || list.Entries[0].Name != "dir/large" || list.Entries[1].Name != "dir/small" || list.PageMarker != "" {
+		t.Fatalf("Unexpected list %+v", list)
+	}
+
+	// cold GETs, validated against the MD5 ETag
+	for _, name := range []string{"dir/copied", "dir/small"} {
+		fqn := filepath.Join(dir, "cached")
+		if _, cerr = s3.getobj(ct, fqn, bucket, name); cerr != nil {
+			t.Fatalf("Failed to GET %s: %v", name, cerr)
+		}
+		local, _ := ioutil.ReadFile(fqn)
+		original, _ := ioutil.ReadFile(filepath.Join(root, bucket, name))
+		if !bytes.Equal(local, original) {
+			t.Errorf("Local copy of %s differs", name)
+		}
+	}
+	// in parts, with range requests
+	ctx.config.ColdGet = coldgetconf{PartSize: MiB, Concurrency: 4}
+	fqn := filepath.Join(dir, "large")
+	props, cerr := s3.getobj(ct, fqn, bucket, "dir/large")
+	if cerr != nil {
+		t.Fatal(cerr)
+	}
+	if local, _ := ioutil.ReadFile(fqn); props.size != int64(len(large)) || !bytes.Equal(local, large) {
+		t.Error("Local copy of the large object differs")
+	}
+
+	// conditional DELETE, checked by HEAD
+	for _, pc := range []*precondition{{match: []string{"0123"}}, {unmodified: time.Now().Add(-time.Hour)}} {
+		if cerr = s3.deleteobj(context.WithValue(ct, ctxPrecond, pc), bucket, "dir/small"); cerr == nil ||
+			cerr.Status != http.StatusPreconditionFailed {
+			t.Fatalf("Expected %d, got %v", http.StatusPreconditionFailed, cerr)
+		}
+	}
+	if _, cerr = s3.headobject(ct, bucket, "dir/small"); cerr != nil {
+		t.Fatal(cerr)
+	}
+	pc := &precondition{match: []string{"*"}, unmodified: time.Now().Add(time.Hour)}
+	if cerr = s3.deleteobj(context.WithValue(ct, ctxPrecond, pc), bucket, "dir/small"); cerr != nil {
+		t.Fatal(cerr)
+	}
+	if _, cerr = s3.headobject(ct, bucket, "dir/small"); cerr == nil || cerr.Status != http.StatusNotFound {
+		t.Fatalf("Expected not found, got %v", cerr)
+	}
+
+	// upload IDs cannot point outside the root
+	req, err := http.NewRequest(http.MethodDelete, r.endpoint()+"/"+bucket+"/dir/large?uploadId=..%2F..%2F..", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected %d for invalid upload ID, got %d", http.StatusNotFound, resp.StatusCode)
+	}
+	if _, err = os.Stat(root); err != nil {
+		t.Errorf("Invalid upload ID removed the root: %v", err)
+	}
+}
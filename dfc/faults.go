@@ -0,0 +1,230 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+// Failure injection.
+// A daemon built with the "debug" tag (go build -tags debug) accepts
+// ActInjectFault and ActClearFaults via PUT /v1/daemon and then, with a given
+// probability, delays or drops its HTTP responses and fails disk writes or
+// cloud calls - so that HA and retry logic can be tested by integration tests.
+// In a regular build faultsEnabled is false: the hooks are compiled out and
+// the daemon rejects the actions.
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/NVIDIA/dfcpub/3rdparty/glog"
+)
+
+type (
+	faultinjector struct {
+		mtx    sync.Mutex
+		rnd    *rand.Rand
+		faults map[string]*fault // fault kind => fault
+	}
+	fault struct {
+		FaultMsg
+		delay time.Duration
+	}
+	// discards the response of a request processed under FaultDrop
+	droppedResponse struct {
+		header http.Header
+	}
+	// injects FaultCloud into calls to the cloud provider
+	faultycloud struct {
+		cloudif
+		fi *faultinjector
+	}
+)
+
+func newfaultinjector() *faultinjector {
+	return &faultinjector{
+		rnd:    rand.New(rand.NewSource(time.Now().UnixNano())),
+		faults: make(map[string]*fault),
+	}
+}
+
+func (fi *faultinjector) inject(msg *FaultMsg) (errstr string) {
+	f := &fault{FaultMsg: *msg}
+	switch msg.Kind {
+	case FaultDelay:
+		var err error
+		if f.delay, err = time.ParseDuration(msg.Delay); err != nil || f.delay <= 0 {
+			return fmt.Sprintf("Invalid fault delay %q", msg.Delay)
+		}
+	case FaultDrop, FaultDiskWrite, FaultCloud:
+	default:
+		return fmt.Sprintf("Invalid fault kind %q", msg.Kind)
+	}
+	if msg.Prob <= 0 || msg.Prob > 1 {
+		return fmt.Sprintf("Invalid fault probability %v: expecting (0, 1]", msg.Prob)
+	}
+
+	fi.mtx.Lock()
+	if msg.Seed != 0 {
+		fi.rnd = rand.New(rand.NewSource(msg.Seed))
+	}
+	fi.faults[msg.Kind] = f
+	fi.mtx.Unlock()
+	glog.Warningf("Injected fault: %s, probability %v", msg.Kind, msg.Prob)
+	return
+}
+
+func (fi *faultinjector) clear() {
+	fi.mtx.Lock()
+	fi.faults = make(map[string]*fault)
+	fi.mtx.Unlock()
+	glog.Warningln("Cleared injected faults")
+}
+
+// Returns the fault of a given kind if it occurs this time, nil otherwise
+func (fi *faultinjector) fire(kind string) *fault {
+	if !faultsEnabled || fi == nil {
+		return nil
+	}
+	fi.mtx.Lock()
+	defer fi.mtx.Unlock()
+	f, ok := fi.faults[kind]
+	if !ok || fi.rnd.Float64() >= f.Prob {
+		return nil
+	}
+	return f
+}
+
+func (fi *faultinjector) diskWriteError(fqn string) (errstr string) {
+	if fi.fire(FaultDiskWrite) != nil {
+		errstr = fmt.Sprintf("Failed to write %s: injected disk write error", fqn)
+	}
+	return
+}
+
+//
+// PUT /v1/daemon {"action": ActInjectFault | ActClearFaults}
+//
+func (h *httprunner) httpfaults(w http.ResponseWriter, r *http.Request, msg *ActionMsg) {
+	if !faultsEnabled {
+		h.invalmsghdlr(w, r, "Failure injection is supported only by debug build (-tags debug)")
+		return
+	}
+	if msg.Action == ActClearFaults {
+		h.faults.clear()
+		return
+	}
+	faultmsg := &FaultMsg{}
+	b, err := json.Marshal(msg.Value)
+	if err == nil {
+		err = json.Unmarshal(b, faultmsg)
+	}
+	if err != nil {
+		h.invalmsghdlr(w, r, fmt.Sprintf("Invalid fault %v, err: %v", msg.Value, err))
+		return
+	}
+	if errstr := h.faults.inject(faultmsg); errstr != "" {
+		h.invalmsghdlr(w, r, errstr)
+	}
+}
+
+// Wraps an HTTP handler to delay or drop its responses. Control plane requests
+// (/v1/daemon) are never affected, so the faults can be cleared
+func (h *httprunner) faultyhdlr(handler http.HandlerFunc) http.HandlerFunc {
+	daemonpath := "/" + Rdaemon
+	return func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(stripAPIVersion(r.URL.Path), daemonpath) {
+			handler(w, r)
+			return
+		}
+		if f := h.faults.fire(FaultDelay); f != nil {
+			time.Sleep(f.delay)
+		}
+		if h.faults.fire(FaultDrop) == nil {
+			handler(w, r)
+			return
+		}
+		handler(&droppedResponse{header: make(http.Header)}, r)
+		// the server closes the connection without a response
+		panic(http.ErrAbortHandler)
+	}
+}
+
+func (d *droppedResponse) Header() http.Header         { return d.header }
+func (d *droppedResponse) Write(b []byte) (int, error) { return len(b), nil }
+func (d *droppedResponse) WriteHeader(int)             {}
+
+//
+// faultycloud
+//
+const injectedCloudErr = "Injected cloud provider failure"
+
+func (c *faultycloud) listbucket(ct context.Context, bucket string, msg *GetMsg) (jsbytes []byte, cerr *Error) {
+	if c.fi.fire(FaultCloud) != nil {
+		return nil, NewError(http.StatusServiceUnavailable, injectedCloudErr)
+	}
+	return c.cloudif.listbucket(ct, bucket, msg)
+}
+
+func (c *faultycloud) headbucket(ct context.Context, bucket string) (bucketprops simplekvs, cerr *Error) {
+	if c.fi.fire(FaultCloud) != nil {
+		return nil, NewError(http.StatusServiceUnavailable, injectedCloudErr)
+	}
+	return c.cloudif.headbucket(ct, bucket)
+}
+
+func (c *faultycloud) getbucketnames(ct context.Context) (buckets []string, cerr *Error) {
+	if c.fi.fire(FaultCloud) != nil {
+		return nil, NewError(http.StatusServiceUnavailable, injectedCloudErr)
+	}
+	return c.cloudif.getbucketnames(ct)
+}
+
+func (c *faultycloud) headobject(ct context.Context, bucket string, objname string) (objmeta simplekvs, cerr *Error) {
+	if c.fi.fire(FaultCloud) != nil {
+		return nil, NewError(http.StatusServiceUnavailable, injectedCloudErr)
+	}
+	return c.cloudif.headobject(ct, bucket, objname)
+}
+
+func (c *faultycloud) getobj(ct context.Context, fqn, bucket, objname string) (props *objectProps, cerr *Error) {
+	if c.fi.fire(FaultCloud) != nil {
+		return nil, NewError(http.StatusServiceUnavailable, injectedCloudErr)
+	}
+	return c.cloudif.getobj(ct, fqn, bucket, objname)
+}
+
+func (c *faultycloud) getobjrange(ct context.Context, bucket, objname string, rng *httpRange) (rr *rangeReader, cerr *Error) {
+	if c.fi.fire(FaultCloud) != nil {
+		return nil, NewError(http.StatusServiceUnavailable, injectedCloudErr)
+	}
+	return c.cloudif.getobjrange(ct, bucket, objname, rng)
+}
+
+func (c *faultycloud) putobj(ct context.Context, file io.Reader, bucket, objname string, ohobj cksumvalue) (version string, cerr *Error) {
+	if c.fi.fire(FaultCloud) != nil {
+		return "", NewError(http.StatusServiceUnavailable, injectedCloudErr)
+	}
+	return c.cloudif.putobj(ct, file, bucket, objname, ohobj)
+}
+
+func (c *faultycloud) deleteobj(ct context.Context, bucket, objname string) (cerr *Error) {
+	if c.fi.fire(FaultCloud) != nil {
+		return NewError(http.StatusServiceUnavailable, injectedCloudErr)
+	}
+	return c.cloudif.deleteobj(ct, bucket, objname)
+}
+
+func (c *faultycloud) restoreobj(ct context.Context, bucket, objname string, msg *RestoreMsg) (cerr *Error) {
+	if c.fi.fire(FaultCloud) != nil {
+		return NewError(http.StatusServiceUnavailable, injectedCloudErr)
+	}
+	return c.cloudif.restoreobj(ct, bucket, objname, msg)
+}
@@ -0,0 +1,11 @@
+// +build debug
+
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+// see faults.go
+const faultsEnabled = true
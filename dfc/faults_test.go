@@ -0,0 +1,64 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ */
+package dfc
+
+import (
+	"testing"
+)
+
+func TestFaultInjector(t *testing.T) {
+	fi := newfaultinjector()
+	invalid := []FaultMsg{
+		{Kind: "crash", Prob: 1},
+		{Kind: FaultDrop, Prob: 0},
+		{Kind: FaultDrop, Prob: 1.5},
+		{Kind: FaultDelay, Prob: 1},
+		{Kind: FaultDelay, Prob: 1, Delay: "-1s"},
+	}
+	for _, msg := range invalid {
+		if errstr := fi.inject(&msg); errstr == "" {
+			t.Errorf("Expected error for fault %+v", msg)
+		}
+	}
+
+	if errstr := fi.inject(&FaultMsg{Kind: FaultDiskWrite, Prob: 1}); errstr != "" {
+		t.Fatal(errstr)
+	}
+	if !faultsEnabled {
+		// faults never occur in a regular build
+		if fi.fire(FaultDiskWrite) != nil {
+			t.Error("Fault occurred in a build without failure injection")
+		}
+		return
+	}
+
+	if fi.diskWriteError("/tmp/obj") == "" {
+		t.Error("Expected disk write error with probability 1")
+	}
+	if fi.fire(FaultCloud) != nil {
+		t.Error("Fault occurred without being injected")
+	}
+
+	// the same seed produces the same sequence of faults
+	sequence := func() (seq []bool) {
+		if errstr := fi.inject(&FaultMsg{Kind: FaultCloud, Prob: 0.5, Seed: 42}); errstr != "" {
+			t.Fatal(errstr)
+		}
+		for i := 0; i < 100; i++ {
+			seq = append(seq, fi.fire(FaultCloud) != nil)
+		}
+		return
+	}
+	first, second := sequence(), sequence()
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("Sequences of faults differ at %d", i)
+		}
+	}
+
+	fi.clear()
+	if fi.fire(FaultDiskWrite) != nil || fi.fire(FaultCloud) != nil {
+		t.Error("Fault occurred after clearing faults")
+	}
+}
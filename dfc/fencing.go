@@ -0,0 +1,160 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+// Epoch fencing (split-brain prevention).
+// A primary proxy cut off from the rest of the cluster may keep acting as the
+// primary while the others elect a new one; the two would then accept - and
+// sync to the targets - conflicting changes, e.g. of local buckets. With
+// proxyconfig.fencing, every change of the primary advances the cluster epoch
+// (Smap.Epoch): before taking over, the new primary claims the next epoch at the
+// targets, and becomes the primary only if a majority of them - the witnesses -
+// accept the claim. A target accepts an epoch greater than the one it has, or
+// the same epoch claimed by the same proxy, and persists it in its configuration
+// directory. The primary includes its epoch and ID with every request to other
+// daemons, and targets reject the requests that change anything (all but GET and
+// HEAD) from a primary of an older epoch - or of the same epoch but another
+// proxy - with 409 Conflict. Epoch 0, before the first change of the primary,
+// is not fenced.
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/NVIDIA/dfcpub/3rdparty/glog"
+)
+
+const epochname = "epoch.json"
+
+// epochFence is the highest epoch a target has accepted
+type epochFence struct {
+	mtx     sync.Mutex
+	Epoch   int64  `json:"epoch"`
+	Primary string `json:"primary"` // ID of the proxy that has claimed the epoch
+}
+
+func (f *epochFence) load() {
+	pathname := filepath.Join(ctx.config.Confdir, epochname)
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	if err := LocalLoad(pathname, f); err != nil && !os.IsNotExist(err) {
+		glog.Errorf("Failed to load epoch %s, err: %v", pathname, err)
+	}
+}
+
+// stale returns the reason to reject the changes requested by the primary, "" if none
+func (f *epochFence) stale(epoch int64, primary string) string {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	return f.staleL(epoch, primary)
+}
+
+func (f *epochFence) staleL(epoch int64, primary string) string {
+	if epoch < f.Epoch || (epoch == f.Epoch && epoch > 0 && primary != f.Primary) {
+		return fmt.Sprintf("Stale primary %s at epoch %d: epoch %d belongs to %s", primary, epoch, f.Epoch, f.Primary)
+	}
+	return ""
+}
+
+// claim accepts and persists the epoch unless it is stale
+func (f *epochFence) claim(epoch int64, primary string) (errstr string) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	if errstr = f.staleL(epoch, primary); errstr != "" {
+		return
+	}
+	if epoch == f.Epoch && primary == f.Primary {
+		return
+	}
+	origEpoch, origPrimary := f.Epoch, f.Primary
+	f.Epoch, f.Primary = epoch, primary
+	pathname := filepath.Join(ctx.config.Confdir, epochname)
+	if err := LocalSave(pathname, f); err != nil {
+		f.Epoch, f.Primary = origEpoch, origPrimary
+		errstr = fmt.Sprintf("Failed to save epoch %s, err: %v", pathname, err)
+	}
+	return
+}
+
+// setEpoch adds the epoch and ID of the primary to its requests
+func (h *httprunner) setEpoch(request *http.Request) {
+	if !ctx.config.Proxy.Fencing || h.smapowner == nil {
+		return
+	}
+	if smap := h.smapowner.get(); smap != nil && smap.isPrimary(h.si) {
+		request.Header.Set(HeaderDfcEpoch, strconv.FormatInt(smap.Epoch, 10))
+		request.Header.Set(HeaderPrimaryProxyID, h.si.DaemonID)
+	}
+}
+
+//
+// target
+//
+
+// fenced rejects the changes requested by a stale primary
+func (t *targetrunner) fenced(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		epochstr := r.Header.Get(HeaderDfcEpoch)
+		if epochstr == "" || r.Method == http.MethodGet || r.Method == http.MethodHead {
+			h(w, r)
+			return
+		}
+		epoch, err := strconv.ParseInt(epochstr, 10, 64)
+		if err != nil {
+			t.invalmsghdlr(w, r, fmt.Sprintf("Invalid %s header %q", HeaderDfcEpoch, epochstr))
+			return
+		}
+		if errstr := t.fence.stale(epoch, r.Header.Get(HeaderPrimaryProxyID)); errstr != "" {
+			glog.Errorln(errstr)
+			t.invalmsghdlr(w, r, errstr, http.StatusConflict)
+			return
+		}
+		h(w, r)
+	}
+}
+
+func (t *targetrunner) claimEpoch(w http.ResponseWriter, r *http.Request, msg *ActionMsg) {
+	epoch, ok := msg.Value.(float64)
+	if !ok || epoch <= 0 || msg.Name == "" {
+		t.invalmsghdlr(w, r, fmt.Sprintf("Invalid epoch claim %v", msg))
+		return
+	}
+	if errstr := t.fence.claim(int64(epoch), msg.Name); errstr != "" {
+		t.invalmsghdlr(w, r, errstr, http.StatusConflict)
+		return
+	}
+	glog.Infof("Epoch %d claimed by %s", int64(epoch), msg.Name)
+}
+
+//
+// proxy
+//
+
+// claimEpoch claims the epoch at the targets; a majority of them must accept it
+func (p *proxyrunner) claimEpoch(smap *Smap, epoch int64) (errstr string) {
+	msg := &ActionMsg{Action: ActClaimEpoch, Name: p.si.DaemonID, Value: epoch}
+	jsbytes, err := json.Marshal(msg)
+	assert(err == nil, err)
+	results := p.broadcastTargets(URLPath(Rversion, Rdaemon), nil, http.MethodPut, jsbytes,
+		smap, ctx.config.Timeout.CplaneOperation)
+	accepted := 0
+	for res := range results {
+		if res.err != nil {
+			glog.Warningf("Target %s did not accept epoch %d, err: %v", res.si.DaemonID, epoch, res.err)
+			continue
+		}
+		accepted++
+	}
+	if numtargets := smap.countTargets(); numtargets > 0 && accepted*2 <= numtargets {
+		errstr = fmt.Sprintf("Failed to claim epoch %d: accepted by %d of %d targets", epoch, accepted, numtargets)
+	}
+	return
+}
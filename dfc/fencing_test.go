@@ -0,0 +1,75 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestEpochFence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fence")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	oldconfdir := ctx.config.Confdir
+	defer func() { ctx.config.Confdir = oldconfdir }()
+	ctx.config.Confdir = dir
+
+	target := &targetrunner{}
+	target.statsif = &storstatsrunner{}
+	target.fence.load()
+	if errstr := target.fence.stale(0, "p1"); errstr != "" {
+		t.Errorf("Epoch 0 is not fenced: %s", errstr)
+	}
+	if errstr := target.fence.claim(1, "p2"); errstr != "" {
+		t.Fatal(errstr)
+	}
+	if target.fence.claim(1, "p3") == "" || target.fence.claim(1, "p2") != "" {
+		t.Error("Expected epoch 1 to belong to p2 only")
+	}
+
+	// the epoch survives restarts
+	target = &targetrunner{}
+	target.statsif = &storstatsrunner{}
+	target.fence.load()
+	if target.fence.Epoch != 1 || target.fence.Primary != "p2" {
+		t.Fatalf("Loaded epoch %d of %s", target.fence.Epoch, target.fence.Primary)
+	}
+
+	handled := 0
+	handler := target.fenced(func(w http.ResponseWriter, r *http.Request) { handled++ })
+	tests := []struct {
+		method  string
+		epoch   string
+		primary string
+		status  int
+	}{
+		{http.MethodPut, "", "", http.StatusOK},    // not from a primary
+		{http.MethodGet, "0", "p1", http.StatusOK}, // reads are not fenced
+		{http.MethodPut, "0", "p1", http.StatusConflict},
+		{http.MethodPut, "1", "p3", http.StatusConflict},
+		{http.MethodDelete, "1", "p2", http.StatusOK},
+		{http.MethodPost, "2", "p3", http.StatusOK}, // not yet claimed
+		{http.MethodPut, "x", "p2", http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		handled = 0
+		r := httptest.NewRequest(test.method, "/v1/daemon/metasync", nil)
+		if test.epoch != "" {
+			r.Header.Set(HeaderDfcEpoch, test.epoch)
+			r.Header.Set(HeaderPrimaryProxyID, test.primary)
+		}
+		w := httptest.NewRecorder()
+		handler(w, r)
+		if w.Code != test.status || (handled == 1) != (test.status == http.StatusOK) {
+			t.Errorf("%s at epoch %q of %q: status %d, handled %d", test.method, test.epoch, test.primary, w.Code, handled)
+		}
+	}
+}
@@ -6,6 +6,7 @@ package dfc
 
 import (
 	"context"
+	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
@@ -15,7 +16,6 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
-	"time"
 
 	"cloud.google.com/go/storage"
 	"github.com/NVIDIA/dfcpub/3rdparty/glog"
@@ -29,10 +29,27 @@ const (
 
 	gcpDfcHashType = "x-goog-meta-dfc-hash-type"
 	gcpDfcHashVal  = "x-goog-meta-dfc-hash-val"
+	gcpMetaPrefix  = "x-goog-meta-"
 
 	gcpPageSize = 1000
+
+	// GCS storage classes
+	gcpStorageClassStandard      = "STANDARD"
+	gcpStorageClassMultiRegional = "MULTI_REGIONAL"
+	gcpStorageClassRegional      = "REGIONAL"
+	gcpStorageClassNearline      = "NEARLINE"
+	gcpStorageClassColdline      = "COLDLINE"
 )
 
+// GCS storage classes DFC can write objects with
+var gcpStorageClasses = map[string]bool{
+	gcpStorageClassStandard:      true,
+	gcpStorageClassMultiRegional: true,
+	gcpStorageClassRegional:      true,
+	gcpStorageClassNearline:      true,
+	gcpStorageClassColdline:      true,
+}
+
 // To get projectID from gcp auth json file, to get rid of reading projectID
 // from environment variable
 type gcpAuthRec struct {
@@ -64,12 +81,17 @@ func getProjID() string {
 	return os.Getenv("GOOGLE_CLOUD_PROJECT")
 }
 
-func gcpErrorToHTTP(gcpError error) int {
-	if gcperror, ok := gcpError.(*googleapi.Error); ok {
-		return gcperror.Code
+// gcpError converts an error returned by GCP API into Error, keeping the
+// reason of the first error item as the detail
+func gcpError(err error, format string, a ...interface{}) *Error {
+	status, detail := http.StatusInternalServerError, ""
+	if gcperror, ok := err.(*googleapi.Error); ok {
+		status = gcperror.Code
+		if len(gcperror.Errors) > 0 {
+			detail = gcperror.Errors[0].Reason
+		}
 	}
-
-	return http.StatusInternalServerError
+	return cloudError(ProviderGoogle, status, detail, format, a...)
 }
 
 // If extractGCPCreds returns no error and gcpCreds is nil then the default
@@ -105,25 +127,30 @@ func defaultClient(gctx context.Context) (*storage.Client, context.Context, stri
 	return client, gctx, getProjID(), ""
 }
 
+// GCP API cannot load credentials from memory, so credentials are saved to
+// a temporary file readable only by the owner. The caller removes the file
+// right after creating a client, so credentials do not stay on disk
 func saveCredentialsToFile(baseDir, userID, userCreds string) (string, error) {
 	dir := filepath.Join(baseDir, ProviderGoogle)
-	filePath := filepath.Join(dir, userID+".json")
-
-	if _, err := os.Stat(filePath); err == nil {
-		// credentials already saved, no need to do anything
-		// TODO: keep the list of stored creds in-memory instead of calling os functions
-		return "", nil
-	}
-
 	if err := CreateDir(dir); err != nil {
 		return "", fmt.Errorf("Failed to create directory %s: %v", dir, err)
 	}
 
-	if err := ioutil.WriteFile(filePath, []byte(userCreds), 0755); err != nil {
+	file, err := ioutil.TempFile(dir, userID+"-")
+	if err != nil {
+		return "", fmt.Errorf("Failed to create file: %v", err)
+	}
+	if _, err = file.WriteString(userCreds); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return "", fmt.Errorf("Failed to save to file: %v", err)
+	}
+	if err = file.Close(); err != nil {
+		os.Remove(file.Name())
 		return "", fmt.Errorf("Failed to save to file: %v", err)
 	}
 
-	return filePath, nil
+	return file.Name(), nil
 }
 
 // createClient support two ways of creating a connection to cloud:
@@ -131,10 +158,9 @@ func saveCredentialsToFile(baseDir, userID, userCreds string) (string, error) {
 //    In this case all are read from environment variables and a user
 //    should be logged in to the cloud
 // 2. If Authn is enabled and directory with user credentials is set:
-//    The directory contains credentials for every user who want to connect
-//    storage. A file per a user.  A userID is retrieved from a token - it the
-//    file name with the user's credentials. Full path to user credentials is
-//    CredDir + userID + ".json"
+//    User's credentials are retrieved from a token and saved to a temporary
+//    file in CredDir right before opening a connection. The file is removed
+//    right after the connection is opened
 //    The file is standard GCP credentials file (e.g, check ~/gcp_creds.json
 //    for details). If the file does not include project_id, the function reads
 //    it from environment variable GOOGLE_CLOUD_PROJECT
@@ -164,6 +190,9 @@ func createClient(ct context.Context) (*storage.Client, context.Context, string,
 	}
 
 	client, err := storage.NewClient(gctx, option.WithCredentialsFile(filePath))
+	if errRm := os.Remove(filePath); errRm != nil {
+		glog.Errorf("Failed to remove credentials file %s: %v", filePath, errRm)
+	}
 	if err != nil {
 		glog.Errorf("Failed to create storage client for %s: %v", userID, err)
 		return defaultClient(gctx)
@@ -172,30 +201,51 @@ func createClient(ct context.Context) (*storage.Client, context.Context, string,
 	return client, gctx, creds.projectID, ""
 }
 
+// Returns a handle of the bucket. Requests to a requester-pays bucket are
+// billed to the project of the client
+func (gcpimpl *gcpimpl) bucket(client *storage.Client, projectID, bucket string) *storage.BucketHandle {
+	b := client.Bucket(bucket)
+	if _, props := gcpimpl.t.bmdowner.get().get(bucket, false); props.RequesterPays {
+		b = b.UserProject(projectID)
+	}
+	return b
+}
+
+// Returns a handle of the object that uses customer-supplied encryption key
+// of the request, if any
+func gcpObject(ct context.Context, b *storage.BucketHandle, objname string) *storage.ObjectHandle {
+	o := b.Object(objname)
+	if key := customerKeyFromContext(ct); key != nil {
+		o = o.Key(key)
+	}
+	return o
+}
+
 //==================
 //
 // bucket operations
 //
 //==================
-func (gcpimpl *gcpimpl) listbucket(ct context.Context, bucket string, msg *GetMsg) (jsbytes []byte, errstr string, errcode int) {
+func (gcpimpl *gcpimpl) listbucket(ct context.Context, bucket string, msg *GetMsg) (jsbytes []byte, cerr *Error) {
 	if glog.V(4) {
 		glog.Infof("listbucket %s", bucket)
 	}
-	client, gctx, _, errstr := createClient(ct)
+	client, gctx, projectID, errstr := createClient(ct)
 	if errstr != "" {
+		cerr = errorFromStr(errstr, http.StatusInternalServerError)
 		return
 	}
 	var query *storage.Query
 	var pageToken string
 
-	if msg.GetPrefix != "" {
-		query = &storage.Query{Prefix: msg.GetPrefix}
+	if msg.GetPrefix != "" || msg.GetDelimiter != "" {
+		query = &storage.Query{Prefix: msg.GetPrefix, Delimiter: msg.GetDelimiter}
 	}
 	if msg.GetPageMarker != "" {
 		pageToken = msg.GetPageMarker
 	}
 
-	it := client.Bucket(bucket).Objects(gctx, query)
+	it := gcpimpl.bucket(client, projectID, bucket).Objects(gctx, query)
 	pageSize := gcpPageSize
 	if msg.GetPageSize != 0 {
 		pageSize = msg.GetPageSize
@@ -204,13 +254,18 @@ func (gcpimpl *gcpimpl) listbucket(ct context.Context, bucket string, msg *GetMs
 	objs := make([]*storage.ObjectAttrs, 0)
 	nextPageToken, err := pager.NextPage(&objs)
 	if err != nil {
-		errcode = gcpErrorToHTTP(err)
-		errstr = fmt.Sprintf("Failed to list objects of bucket %s, err: %v", bucket, err)
+		cerr = gcpError(err, "Failed to list objects of bucket %s, err: %v", bucket, err)
+		return
 	}
 
 	var reslist = BucketList{Entries: make([]*BucketEntry, 0, initialBucketListSize)}
 	reslist.PageMarker = nextPageToken
 	for _, attrs := range objs {
+		// with delimiter, "directories" are returned as synthetic objects with Prefix only
+		if attrs.Prefix != "" {
+			reslist.CommonPrefixes = append(reslist.CommonPrefixes, attrs.Prefix)
+			continue
+		}
 		entry := &BucketEntry{}
 		entry.Name = attrs.Name
 		if strings.Contains(msg.GetProps, GetPropsSize) {
@@ -224,14 +279,7 @@ func (gcpimpl *gcpimpl) listbucket(ct context.Context, bucket string, msg *GetMs
 			if !attrs.Updated.IsZero() {
 				t = attrs.Updated
 			}
-			switch msg.GetTimeFormat {
-			case "":
-				fallthrough
-			case RFC822:
-				entry.Ctime = t.Format(time.RFC822)
-			default:
-				entry.Ctime = t.Format(msg.GetTimeFormat)
-			}
+			entry.Ctime = formatTime(t, msg.GetTimeFormat)
 		}
 		if strings.Contains(msg.GetProps, GetPropsChecksum) {
 			entry.Checksum = hex.EncodeToString(attrs.MD5)
@@ -239,6 +287,9 @@ func (gcpimpl *gcpimpl) listbucket(ct context.Context, bucket string, msg *GetMs
 		if strings.Contains(msg.GetProps, GetPropsVersion) {
 			entry.Version = fmt.Sprintf("%d", attrs.Generation)
 		}
+		if strings.Contains(msg.GetProps, GetPropsStorageClass) {
+			entry.StorageClass = attrs.StorageClass
+		}
 		// TODO: other GetMsg props TBD
 
 		reslist.Entries = append(reslist.Entries, entry)
@@ -253,32 +304,37 @@ func (gcpimpl *gcpimpl) listbucket(ct context.Context, bucket string, msg *GetMs
 	return
 }
 
-func (gcpimpl *gcpimpl) headbucket(ct context.Context, bucket string) (bucketprops simplekvs, errstr string, errcode int) {
+func (gcpimpl *gcpimpl) headbucket(ct context.Context, bucket string) (bucketprops simplekvs, cerr *Error) {
 	if glog.V(4) {
 		glog.Infof("headbucket %s", bucket)
 	}
 	bucketprops = make(simplekvs)
 
-	client, gctx, _, errstr := createClient(ct)
+	client, gctx, projectID, errstr := createClient(ct)
 	if errstr != "" {
+		cerr = errorFromStr(errstr, http.StatusInternalServerError)
 		return
 	}
-	_, err := client.Bucket(bucket).Attrs(gctx)
+	battrs, err := gcpimpl.bucket(client, projectID, bucket).Attrs(gctx)
 	if err != nil {
-		errcode = gcpErrorToHTTP(err)
-		errstr = fmt.Sprintf("Failed to get attributes (bucket %s), err: %v", bucket, err)
+		cerr = gcpError(err, "Failed to get attributes (bucket %s), err: %v", bucket, err)
 		return
 	}
 	bucketprops[CloudProvider] = ProviderGoogle
+	bucketprops[StorageClass] = battrs.StorageClass
+	if battrs.RequesterPays {
+		bucketprops[RequesterPays] = "enabled"
+	}
 	// GCP always generates a versionid for an object even if versioning is disabled.
 	// So, return that we can detect versionid change on getobj etc
 	bucketprops[Versioning] = VersionCloud
 	return
 }
 
-func (gcpimpl *gcpimpl) getbucketnames(ct context.Context) (buckets []string, errstr string, errcode int) {
+func (gcpimpl *gcpimpl) getbucketnames(ct context.Context) (buckets []string, cerr *Error) {
 	client, gctx, projectID, errstr := createClient(ct)
 	if errstr != "" {
+		cerr = errorFromStr(errstr, http.StatusInternalServerError)
 		return
 	}
 	buckets = make([]string, 0, 16)
@@ -289,8 +345,7 @@ func (gcpimpl *gcpimpl) getbucketnames(ct context.Context) (buckets []string, er
 			break
 		}
 		if err != nil {
-			errcode = gcpErrorToHTTP(err)
-			errstr = fmt.Sprintf("Failed to list all buckets, err: %v", err)
+			cerr = gcpError(err, "Failed to list all buckets, err: %v", err)
 			return
 		}
 		buckets = append(buckets, battrs.Name)
@@ -306,24 +361,34 @@ func (gcpimpl *gcpimpl) getbucketnames(ct context.Context) (buckets []string, er
 // object meta
 //
 //============
-func (gcpimpl *gcpimpl) headobject(ct context.Context, bucket string, objname string) (objmeta simplekvs, errstr string, errcode int) {
+func (gcpimpl *gcpimpl) headobject(ct context.Context, bucket string, objname string) (objmeta simplekvs, cerr *Error) {
 	if glog.V(4) {
 		glog.Infof("headobject %s/%s", bucket, objname)
 	}
 	objmeta = make(simplekvs)
 
-	client, gctx, _, errstr := createClient(ct)
+	client, gctx, projectID, errstr := createClient(ct)
 	if errstr != "" {
+		cerr = errorFromStr(errstr, http.StatusInternalServerError)
 		return
 	}
-	attrs, err := client.Bucket(bucket).Object(objname).Attrs(gctx)
+	attrs, err := gcpObject(ct, gcpimpl.bucket(client, projectID, bucket), objname).Attrs(gctx)
 	if err != nil {
-		errcode = gcpErrorToHTTP(err)
-		errstr = fmt.Sprintf("Failed to retrieve %s/%s metadata, err: %v", bucket, objname, err)
+		cerr = gcpError(err, "Failed to retrieve %s/%s metadata, err: %v", bucket, objname, err)
 		return
 	}
 	objmeta[CloudProvider] = ProviderGoogle
 	objmeta["version"] = fmt.Sprintf("%d", attrs.Generation)
+	objmeta[Size] = fmt.Sprintf("%d", attrs.Size)
+	objmeta[StorageClass] = attrs.StorageClass
+	if v := newcksumvalue(attrs.Metadata[gcpDfcHashType], attrs.Metadata[gcpDfcHashVal]); v != nil {
+		objmeta[HeaderDfcChecksumType], objmeta[HeaderDfcChecksumVal] = v.get()
+	}
+	for k, v := range attrs.Metadata {
+		if k != gcpDfcHashType && k != gcpDfcHashVal {
+			objmeta[HeaderDfcMetaPrefix+strings.TrimPrefix(k, gcpMetaPrefix)] = v
+		}
+	}
 	return
 }
 
@@ -332,30 +397,65 @@ func (gcpimpl *gcpimpl) headobject(ct context.Context, bucket string, objname st
 // object data operations
 //
 //=======================
-func (gcpimpl *gcpimpl) getobj(ct context.Context, fqn string, bucket string, objname string) (props *objectProps, errstr string, errcode int) {
+func (gcpimpl *gcpimpl) getobj(ct context.Context, fqn string, bucket string, objname string) (props *objectProps, cerr *Error) {
 	var v cksumvalue
-	client, gctx, _, errstr := createClient(ct)
+	client, gctx, projectID, errstr := createClient(ct)
 	if errstr != "" {
+		cerr = errorFromStr(errstr, http.StatusInternalServerError)
 		return
 	}
-	o := client.Bucket(bucket).Object(objname)
+	o := gcpObject(ct, gcpimpl.bucket(client, projectID, bucket), objname)
 	attrs, err := o.Attrs(gctx)
 	if err != nil {
-		errcode = gcpErrorToHTTP(err)
-		errstr = fmt.Sprintf("Failed to retrieve %s/%s metadata, err: %v", bucket, objname, err)
+		cerr = gcpError(err, "Failed to retrieve %s/%s metadata, err: %v", bucket, objname, err)
 		return
 	}
+	// Nearline and Coldline objects are read directly, but with a higher
+	// time to the first byte and retrieval fees
+	if attrs.StorageClass == gcpStorageClassNearline || attrs.StorageClass == gcpStorageClassColdline {
+		glog.Infof("GET %s/%s: %s object, expect higher latency", bucket, objname, attrs.StorageClass)
+	}
 	v = newcksumvalue(attrs.Metadata[gcpDfcHashType], attrs.Metadata[gcpDfcHashVal])
-	md5 := hex.EncodeToString(attrs.MD5)
+	// composite objects have no MD5
+	cksum := cloudCksum{kind: CloudCksumMD5, val: hex.EncodeToString(attrs.MD5)}
+	if cksum.val == "" {
+		crc := make([]byte, 4)
+		binary.BigEndian.PutUint32(crc, attrs.CRC32C)
+		cksum = cloudCksum{kind: CloudCksumCRC32C, val: hex.EncodeToString(crc)}
+	}
+	if gcpimpl.t.parallelColdGet(bucket) && attrs.Size > ctx.config.ColdGet.PartSize {
+		props = &objectProps{
+			version:  fmt.Sprintf("%d", attrs.Generation),
+			csekhash: customerKeyHash(customerKeyFromContext(ct)),
+		}
+		// all parts must come from the same generation of the object
+		og := o.Generation(attrs.Generation)
+		getpart := func(ct context.Context, offset, length int64) (io.ReadCloser, *Error) {
+			rc, err := og.NewRangeReader(ct, offset, length)
+			if err != nil {
+				return nil, gcpError(err, "Failed to GET %s/%s, err: %v", bucket, objname, err)
+			}
+			return rc, nil
+		}
+		cerr = gcpimpl.t.receiveParts(gctx, fqn, bucket, objname, attrs.Size, cksum, v, props, getpart)
+		if cerr == nil && glog.V(4) {
+			glog.Infof("GET %s/%s in parts, size %d", bucket, objname, attrs.Size)
+		}
+		return
+	}
 	rc, err := o.NewReader(gctx)
 	if err != nil {
-		errstr = fmt.Sprintf("The object %s/%s either does not exist or is not accessible, err: %v", bucket, objname, err)
+		cerr = gcpError(err, "The object %s/%s either does not exist or is not accessible, err: %v", bucket, objname, err)
 		return
 	}
 	// hashtype and hash could be empty for legacy objects.
-	props = &objectProps{version: fmt.Sprintf("%d", attrs.Generation)}
-	if _, props.nhobj, props.size, errstr = gcpimpl.t.receive(fqn, objname, md5, v, rc); errstr != "" {
+	props = &objectProps{
+		version:  fmt.Sprintf("%d", attrs.Generation),
+		csekhash: customerKeyHash(customerKeyFromContext(ct)),
+	}
+	if errstr = gcpimpl.t.receiveCloud(fqn, bucket, objname, cksum, v, rc, props); errstr != "" {
 		rc.Close()
+		cerr = errorFromStr(errstr, http.StatusInternalServerError)
 		return
 	}
 	if glog.V(4) {
@@ -365,13 +465,37 @@ func (gcpimpl *gcpimpl) getobj(ct context.Context, fqn string, bucket string, ob
 	return
 }
 
-func (gcpimpl *gcpimpl) putobj(ct context.Context, file *os.File, bucket, objname string, ohash cksumvalue) (version string, errstr string, errcode int) {
+// getobjrange reads the range of the object's generation the size is taken from
+func (gcpimpl *gcpimpl) getobjrange(ct context.Context, bucket, objname string, rng *httpRange) (rr *rangeReader, cerr *Error) {
+	client, gctx, projectID, errstr := createClient(ct)
+	if errstr != "" {
+		return nil, errorFromStr(errstr, http.StatusInternalServerError)
+	}
+	o := gcpObject(ct, gcpimpl.bucket(client, projectID, bucket), objname)
+	attrs, err := o.Attrs(gctx)
+	if err != nil {
+		return nil, gcpError(err, "Failed to retrieve %s/%s metadata, err: %v", bucket, objname, err)
+	}
+	offset, length, ok := rng.resolve(attrs.Size)
+	if !ok {
+		return nil, errRangeNotSatisfiable(bucket, objname, rng, attrs.Size)
+	}
+	rc, err := o.Generation(attrs.Generation).NewRangeReader(gctx, offset, length)
+	if err != nil {
+		return nil, gcpError(err, "Failed to GET %s/%s, err: %v", bucket, objname, err)
+	}
+	return &rangeReader{ReadCloser: rc, offset: offset, length: length, size: attrs.Size,
+		version: fmt.Sprintf("%d", attrs.Generation)}, nil
+}
+
+func (gcpimpl *gcpimpl) putobj(ct context.Context, file io.Reader, bucket, objname string, ohash cksumvalue) (version string, cerr *Error) {
 	var (
 		htype, hval string
 		md          simplekvs
 	)
-	client, gctx, _, errstr := createClient(ct)
+	client, gctx, projectID, errstr := createClient(ct)
 	if errstr != "" {
+		cerr = errorFromStr(errstr, http.StatusInternalServerError)
 		return
 	}
 	if ohash != nil {
@@ -380,24 +504,27 @@ func (gcpimpl *gcpimpl) putobj(ct context.Context, file *os.File, bucket, objnam
 		md[gcpDfcHashType] = htype
 		md[gcpDfcHashVal] = hval
 	}
-	gcpObj := client.Bucket(bucket).Object(objname)
+	gcpObj := gcpObject(ct, gcpimpl.bucket(client, projectID, bucket), objname)
 	wc := gcpObj.NewWriter(gctx)
 	wc.Metadata = md
+	if _, props := gcpimpl.t.bmdowner.get().get(bucket, false); props.StorageClass != "" {
+		wc.StorageClass = props.StorageClass
+	}
 	slab := selectslab(0)
 	buf := slab.alloc()
 	written, err := io.CopyBuffer(wc, file, buf)
 	slab.free(buf)
 	if err != nil {
-		errstr = fmt.Sprintf("PUT %s/%s: failed to copy, err: %v", bucket, objname, err)
+		cerr = gcpError(err, "PUT %s/%s: failed to copy, err: %v", bucket, objname, err)
 		return
 	}
 	if err := wc.Close(); err != nil {
-		errstr = fmt.Sprintf("PUT %s/%s: failed to close wc, err: %v", bucket, objname, err)
+		cerr = gcpError(err, "PUT %s/%s: failed to close wc, err: %v", bucket, objname, err)
 		return
 	}
 	attr, err := gcpObj.Attrs(gctx)
 	if err != nil {
-		errstr = fmt.Sprintf("PUT %s/%s: failed to read updated object attributes, err: %v", bucket, objname, err)
+		cerr = gcpError(err, "PUT %s/%s: failed to read updated object attributes, err: %v", bucket, objname, err)
 		return
 	}
 	version = fmt.Sprintf("%d", attr.Generation)
@@ -407,16 +534,40 @@ func (gcpimpl *gcpimpl) putobj(ct context.Context, file *os.File, bucket, objnam
 	return
 }
 
-func (gcpimpl *gcpimpl) deleteobj(ct context.Context, bucket, objname string) (errstr string, errcode int) {
-	client, gctx, _, errstr := createClient(ct)
+// Objects of all GCS storage classes, including archive ones, are readable
+// without restoring
+func (gcpimpl *gcpimpl) restoreobj(ct context.Context, bucket, objname string, msg *RestoreMsg) (cerr *Error) {
+	return NewError(http.StatusBadRequest, "Restore %s/%s: not supported by %s", bucket, objname, ProviderGoogle)
+}
+
+func (gcpimpl *gcpimpl) deleteobj(ct context.Context, bucket, objname string) (cerr *Error) {
+	client, gctx, projectID, errstr := createClient(ct)
 	if errstr != "" {
+		cerr = errorFromStr(errstr, http.StatusInternalServerError)
 		return
 	}
-	o := client.Bucket(bucket).Object(objname)
+	o := gcpimpl.bucket(client, projectID, bucket).Object(objname)
+	if pc := preconditionFromContext(ct); pc != nil {
+		attrs, err := o.Attrs(gctx)
+		if err != nil {
+			cerr = gcpError(err, "Failed to retrieve %s/%s metadata, err: %v", bucket, objname, err)
+			return
+		}
+		st := &objstate{version: fmt.Sprintf("%d", attrs.Generation), modified: attrs.Updated}
+		if v := newcksumvalue(attrs.Metadata[gcpDfcHashType], attrs.Metadata[gcpDfcHashVal]); v != nil {
+			_, hval := v.get()
+			st.cksums = append(st.cksums, hval)
+		}
+		st.cksums = append(st.cksums, hex.EncodeToString(attrs.MD5))
+		if cerr = pc.check(bucket, objname, st); cerr != nil {
+			return
+		}
+		// deleted only if not overwritten since checked
+		o = o.If(storage.Conditions{GenerationMatch: attrs.Generation})
+	}
 	err := o.Delete(gctx)
 	if err != nil {
-		errcode = gcpErrorToHTTP(err)
-		errstr = fmt.Sprintf("Failed to DELETE %s/%s, err: %v", bucket, objname, err)
+		cerr = gcpError(err, "Failed to DELETE %s/%s, err: %v", bucket, objname, err)
 		return
 	}
 	if glog.V(4) {
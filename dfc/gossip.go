@@ -0,0 +1,311 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+// Gossip-based liveness of the targets.
+// By default, every target registers with the primary proxy every keepalive
+// interval, and the primary checks the health of the targets it has not heard
+// from - in a cluster of thousands of targets the primary handles thousands of
+// keepalives per interval. With keepalivetracker.gossip.enabled, every target
+// keeps a heartbeat counter that it increments every gossip interval, and a
+// table of the counters of the other targets. Every round, it sends the table to
+// a few (fanout) random targets, which merge it with theirs and reply with their
+// own, so that the heartbeats spread through the cluster in a number of rounds
+// logarithmic in its size. A target whose counter has not advanced for the
+// suspect time is suspected, and the suspecting targets report it to the primary.
+// The primary checks the health of - and removes from the cluster map, as before -
+// only the targets suspected by enough (confirmations) distinct targets within
+// the suspect time. Targets still register with the primary, but only every
+// primary interval. Proxies keep the keepalives of their own.
+
+import (
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/NVIDIA/dfcpub/3rdparty/glog"
+)
+
+type (
+	// gossiper is the heartbeat table of a target
+	gossiper struct {
+		mtx     sync.Mutex
+		self    string
+		counter int64
+		peers   map[string]*gossipPeer
+		rnd     *rand.Rand
+	}
+	gossipPeer struct {
+		counter int64
+		seen    time.Time // when the counter last advanced
+	}
+	// suspicions are the reports the primary has received
+	suspicions struct {
+		mtx sync.Mutex
+		m   map[string]map[string]time.Time // suspect => reporter => reported at
+	}
+)
+
+func newGossiper(self string, now time.Time) *gossiper {
+	// counters start with the time so that a restarted target's heartbeats
+	// are newer than the ones it had before
+	return &gossiper{
+		self:    self,
+		counter: now.UnixNano(),
+		peers:   make(map[string]*gossipPeer),
+		rnd:     rand.New(rand.NewSource(now.UnixNano())),
+	}
+}
+
+// sync makes the peers the given targets: the new ones are given the suspect
+// time from now to gossip
+func (g *gossiper) sync(ids []string, now time.Time) {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	current := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if id == g.self {
+			continue
+		}
+		current[id] = true
+		if _, ok := g.peers[id]; !ok {
+			g.peers[id] = &gossipPeer{seen: now}
+		}
+	}
+	for id := range g.peers {
+		if !current[id] {
+			delete(g.peers, id)
+		}
+	}
+}
+
+// beat advances the own heartbeat and returns the table to gossip
+func (g *gossiper) beat() *GossipMsg {
+	g.mtx.Lock()
+	g.counter++
+	g.mtx.Unlock()
+	return g.msg()
+}
+
+func (g *gossiper) msg() *GossipMsg {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	msg := &GossipMsg{From: g.self, Heartbeats: make(map[string]int64, len(g.peers)+1)}
+	msg.Heartbeats[g.self] = g.counter
+	for id, peer := range g.peers {
+		if peer.counter != 0 {
+			msg.Heartbeats[id] = peer.counter
+		}
+	}
+	return msg
+}
+
+// merge takes the newer heartbeats of the peers; the targets that are not
+// (yet) peers are ignored
+func (g *gossiper) merge(msg *GossipMsg, now time.Time) {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	for id, counter := range msg.Heartbeats {
+		if peer, ok := g.peers[id]; ok && counter > peer.counter {
+			peer.counter, peer.seen = counter, now
+		}
+	}
+}
+
+// pick returns up to fanout random peers
+func (g *gossiper) pick(fanout int) []string {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	ids := make([]string, 0, len(g.peers))
+	for id := range g.peers {
+		ids = append(ids, id)
+	}
+	if len(ids) <= fanout {
+		return ids
+	}
+	picked := make([]string, fanout)
+	for i, j := range g.rnd.Perm(len(ids))[:fanout] {
+		picked[i] = ids[j]
+	}
+	return picked
+}
+
+// suspects returns the peers whose heartbeats have not advanced for the suspect time
+func (g *gossiper) suspects(now time.Time, suspectTime time.Duration) (ids []string) {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	for id, peer := range g.peers {
+		if now.Sub(peer.seen) > suspectTime {
+			ids = append(ids, id)
+		}
+	}
+	return
+}
+
+func (s *suspicions) report(report *GossipReport, now time.Time) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.m == nil {
+		s.m = make(map[string]map[string]time.Time)
+	}
+	for _, sid := range report.Suspects {
+		if sid == report.From {
+			continue
+		}
+		reporters, ok := s.m[sid]
+		if !ok {
+			reporters = make(map[string]time.Time)
+			s.m[sid] = reporters
+		}
+		reporters[report.From] = now
+	}
+}
+
+// confirmed tells whether at least quorum targets have reported the suspect
+// within the window; older reports are dropped
+func (s *suspicions) confirmed(sid string, now time.Time, window time.Duration, quorum int) bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	reporters := s.m[sid]
+	for reporter, at := range reporters {
+		if now.Sub(at) > window {
+			delete(reporters, reporter)
+		}
+	}
+	if len(reporters) == 0 {
+		delete(s.m, sid)
+	}
+	return quorum > 0 && len(reporters) >= quorum
+}
+
+func (s *suspicions) clear(sid string) {
+	s.mtx.Lock()
+	delete(s.m, sid)
+	s.mtx.Unlock()
+}
+
+//
+// target
+//
+
+// gossiper returns the heartbeat table, nil if gossip is not enabled
+func (r *targetkalive) gossiper() *gossiper {
+	r.gossipMtx.Lock()
+	defer r.gossipMtx.Unlock()
+	if r.gossip == nil && ctx.config.KeepaliveTracker.Gossip.Enabled {
+		r.gossip = newGossiper(r.t.si.DaemonID, time.Now())
+	}
+	return r.gossip
+}
+
+// gossipRound gossips the heartbeats to fanout random targets and reports
+// the suspects to the primary
+func (r *targetkalive) gossipRound() {
+	var (
+		t    = r.t
+		g    = r.gossiper()
+		conf = &ctx.config.KeepaliveTracker.Gossip
+		smap = t.smapowner.get()
+		ids  = make([]string, 0, len(smap.Tmap))
+		url  = URLPath(Rversion, Rgossip)
+		wg   = &sync.WaitGroup{}
+	)
+	for id := range smap.Tmap {
+		ids = append(ids, id)
+	}
+	g.sync(ids, time.Now())
+	jsbytes, err := json.Marshal(g.beat())
+	assert(err == nil, err)
+	for _, sid := range g.pick(conf.Fanout) {
+		si := smap.getTarget(sid)
+		wg.Add(1)
+		go func(si *daemonInfo) {
+			defer wg.Done()
+			res := t.call(nil, si, si.controlURL()+url, http.MethodPost, jsbytes, kalivetimeout)
+			if res.err != nil {
+				if glog.V(4) {
+					glog.Infof("gossip to %s: %v", si.DaemonID, res.err)
+				}
+				return
+			}
+			reply := &GossipMsg{}
+			if err := json.Unmarshal(res.outjson, reply); err == nil {
+				g.merge(reply, time.Now())
+			}
+		}(si)
+	}
+	wg.Wait()
+
+	suspects := g.suspects(time.Now(), conf.SuspectTime)
+	if len(suspects) == 0 || smap.ProxySI == nil {
+		return
+	}
+	glog.Warningf("gossip: suspecting target(s) %v", suspects)
+	jsbytes, err = json.Marshal(&GossipReport{From: t.si.DaemonID, Suspects: suspects})
+	assert(err == nil, err)
+	res := t.call(nil, smap.ProxySI, smap.ProxySI.controlURL()+url, http.MethodPost, jsbytes, kalivetimeout)
+	if res.err != nil {
+		glog.Errorf("Failed to report suspects to the primary %s, err: %v", smap.ProxySI.DaemonID, res.err)
+	}
+}
+
+// POST /v1/gossip: merge the heartbeats, reply with the own
+func (t *targetrunner) gossipHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		invalhdlr(w, r)
+		return
+	}
+	msg := &GossipMsg{}
+	if t.readJSON(w, r, msg) != nil {
+		return
+	}
+	g := gettargetkalive().gossiper()
+	if g == nil {
+		t.invalmsghdlr(w, r, "Gossip is not enabled", http.StatusServiceUnavailable)
+		return
+	}
+	g.merge(msg, time.Now())
+	jsbytes, err := json.Marshal(g.msg())
+	assert(err == nil, err)
+	t.writeJSON(w, r, jsbytes, "gossip")
+}
+
+//
+// proxy
+//
+
+// POST /v1/gossip: record the suspects reported by a target
+func (p *proxyrunner) gossipHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		invalhdlr(w, r)
+		return
+	}
+	if !p.smapowner.get().isPrimary(p.si) {
+		p.invalmsghdlr(w, r, "Cannot accept gossip reports: not the primary proxy")
+		return
+	}
+	report := &GossipReport{}
+	if p.readJSON(w, r, report) != nil {
+		return
+	}
+	getproxykalive().suspicions.report(report, time.Now())
+}
+
+// failing tells whether the daemon may be down: with gossip, a target must be
+// suspected by enough targets; otherwise, the keepalive tracker decides
+func (r *proxykalive) failing(sid string, proxy bool) bool {
+	conf := &ctx.config.KeepaliveTracker.Gossip
+	if proxy || !conf.Enabled {
+		return r.timedOut(sid)
+	}
+	quorum := conf.Confirmations
+	if others := r.p.smapowner.get().countTargets() - 1; others < quorum {
+		quorum = others
+	}
+	return r.suspicions.confirmed(sid, time.Now(), conf.SuspectTime, quorum)
+}
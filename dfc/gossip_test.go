@@ -0,0 +1,137 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+)
+
+// TestGossipChurn simulates gossip rounds while targets fail and join: live
+// targets must never be suspected, failed ones must be suspected by all the
+// live ones - and confirmed by the primary - within the suspect time and a few rounds
+func TestGossipChurn(t *testing.T) {
+	const (
+		fanout      = 3
+		interval    = time.Second
+		suspectTime = 10 * time.Second
+		quorum      = 3
+	)
+	var (
+		now     = time.Unix(1500000000, 0)
+		nodes   = make(map[string]*gossiper)
+		joined  = make(map[string]time.Time)
+		dead    = make(map[string]time.Time) // failed target => when
+		primary = &suspicions{}
+		members = func() (ids []string) {
+			for id := range nodes {
+				ids = append(ids, id)
+			}
+			sort.Strings(ids)
+			return
+		}
+	)
+	join := func(id string) {
+		nodes[id], joined[id] = newGossiper(id, now), now
+		for _, g := range nodes {
+			g.sync(members(), now)
+		}
+	}
+	for i := 0; i < 20; i++ {
+		join(fmt.Sprintf("t%d", i))
+	}
+	for round := 1; round <= 60; round++ {
+		now = now.Add(interval)
+		switch round {
+		case 15:
+			dead["t3"], dead["t7"], dead["t11"] = now, now, now
+		case 20:
+			join("t20")
+			join("t21")
+		case 45: // the failed targets have been removed from the cluster map
+			for id := range dead {
+				delete(nodes, id)
+			}
+			dead = map[string]time.Time{}
+			for _, g := range nodes {
+				g.sync(members(), now)
+			}
+		}
+		for _, id := range members() {
+			if _, ok := dead[id]; ok {
+				continue
+			}
+			g := nodes[id]
+			msg := g.beat()
+			for _, peer := range g.pick(fanout) {
+				if _, ok := dead[peer]; ok {
+					continue
+				}
+				nodes[peer].merge(msg, now)
+				g.merge(nodes[peer].msg(), now)
+			}
+		}
+		for _, id := range members() {
+			if _, ok := dead[id]; ok {
+				continue
+			}
+			suspects := nodes[id].suspects(now, suspectTime)
+			for _, sid := range suspects {
+				if _, ok := dead[sid]; !ok {
+					t.Fatalf("Round %d: %s suspects live target %s", round, id, sid)
+				}
+			}
+			primary.report(&GossipReport{From: id, Suspects: suspects}, now)
+			for sid, at := range dead {
+				if joined[id].After(at) { // new targets give all peers the suspect time
+					at = joined[id]
+				}
+				if now.Sub(at) > suspectTime+3*interval && !contains(suspects, sid) {
+					t.Fatalf("Round %d: %s does not suspect failed target %s", round, id, sid)
+				}
+			}
+		}
+		for _, sid := range members() {
+			at, isdead := dead[sid]
+			confirmed := primary.confirmed(sid, now, suspectTime, quorum)
+			if confirmed && !isdead {
+				t.Fatalf("Round %d: confirmed live target %s", round, sid)
+			}
+			if isdead && now.Sub(at) > suspectTime+3*interval && !confirmed {
+				t.Fatalf("Round %d: failed target %s not confirmed", round, sid)
+			}
+		}
+	}
+	for _, sid := range []string{"t3", "t7", "t11"} {
+		if primary.confirmed(sid, now, suspectTime, quorum) {
+			t.Errorf("Expected the reports of removed target %s to expire", sid)
+		}
+	}
+
+	// a single reporter never makes a quorum; a cleared suspect needs new reports
+	primary.report(&GossipReport{From: "t1", Suspects: []string{"t2", "t1"}}, now)
+	if primary.confirmed("t2", now, suspectTime, 2) || primary.confirmed("t1", now, suspectTime, 1) {
+		t.Error("Confirmed without a quorum or by the suspect itself")
+	}
+	primary.report(&GossipReport{From: "t4", Suspects: []string{"t2"}}, now)
+	if !primary.confirmed("t2", now, suspectTime, 2) {
+		t.Error("Expected t2 to be confirmed")
+	}
+	primary.clear("t2")
+	if primary.confirmed("t2", now, suspectTime, 1) || primary.confirmed("t2", now, suspectTime, 0) {
+		t.Error("Expected no reports of t2 after clear")
+	}
+}
+
+func contains(ids []string, id string) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
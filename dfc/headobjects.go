@@ -0,0 +1,223 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ============================= Batch HEAD ==================================
+// The "headobjects" action returns the status of each object in the list -
+// whether it exists and is cached, its size and version - in one round trip.
+// The proxy groups the objects by their owning targets and asks each target
+// about its objects only. A target reports a cached object from its local
+// copy. For a Cloud bucket, the target HEADs the Cloud for the objects it
+// does not have, headObjectsWorkers at a time, unless cachedonly=true; the
+// objects known to be missing (see negcache.go) are not HEAD-ed again.
+// ============================= Batch HEAD ==================================
+
+const headObjectsWorkers = 16 // concurrent Cloud HEADs per target
+
+//
+// target
+//
+
+// headObjects writes the statuses of the listed objects owned by the target
+func (t *targetrunner) headObjects(w http.ResponseWriter, r *http.Request, msg *ActionMsg) {
+	apitems := t.restAPIItems(r.URL.Path, 5)
+	if apitems = t.checkRestAPI(w, r, apitems, 1, Rversion, Rbuckets); apitems == nil {
+		return
+	}
+	bucket := apitems[0]
+	if !t.validatebckname(w, r, bucket) {
+		return
+	}
+	jsmap, ok := msg.Value.(map[string]interface{})
+	if !ok {
+		t.invalmsghdlr(w, r, fmt.Sprintf("Unexpected Value format %+v, %T", msg.Value, msg.Value))
+		return
+	}
+	listMsg, errstr := parseListMsg(jsmap)
+	if errstr != "" {
+		t.invalmsghdlr(w, r, errstr)
+		return
+	}
+	islocal := t.bmdowner.get().islocal(bucket)
+	if errstr, errcode := t.checkLocalQueryParameter(bucket, r, islocal); errstr != "" {
+		t.invalmsghdlr(w, r, errstr, errcode)
+		return
+	}
+	cachedonly, _ := parsebool(r.URL.Query().Get(URLParamCached))
+
+	var (
+		result = &HeadObjectsResult{Objects: make([]*ObjectStatus, 0, len(listMsg.Objnames))}
+		cloud  = make([]*ObjectStatus, 0)
+	)
+	for _, objname := range listMsg.Objnames {
+		status := &ObjectStatus{Name: objname}
+		result.Objects = append(result.Objects, status)
+		fqn := t.lookupfqn(bucket, objname, islocal)
+		coldget, size, version, errstr := t.lookupLocally(bucket, objname, fqn)
+		switch {
+		case errstr == "":
+			status.Exists, status.Cached, status.Size, status.Version = true, true, size, version
+		case !coldget:
+			status.Error = errstr
+		case !islocal && !cachedonly:
+			cloud = append(cloud, status)
+		}
+	}
+	t.headCloudObjects(t.contextWithAuth(r), bucket, cloud)
+
+	jsbytes, err := json.Marshal(result)
+	assert(err == nil, err)
+	t.writeJSON(w, r, jsbytes, "headobjects")
+}
+
+// headCloudObjects fills in the statuses of the objects from the Cloud
+func (t *targetrunner) headCloudObjects(ct context.Context, bucket string, statuses []*ObjectStatus) {
+	var (
+		wg      = &sync.WaitGroup{}
+		workch  = make(chan *ObjectStatus, len(statuses))
+		workers = headObjectsWorkers
+	)
+	if len(statuses) < workers {
+		workers = len(statuses)
+	}
+	for _, status := range statuses {
+		workch <- status
+	}
+	close(workch)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			for status := range workch {
+				t.headCloudObject(ct, bucket, status)
+			}
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+}
+
+func (t *targetrunner) headCloudObject(ct context.Context, bucket string, status *ObjectStatus) {
+	uname := uniquename(bucket, status.Name)
+	if t.negcache.missing(uname, time.Now()) {
+		return
+	}
+	objmeta, cerr := t.cloudif.headobject(ct, bucket, status.Name)
+	if cerr != nil {
+		if cerr.Status == http.StatusNotFound {
+			t.negcache.add(uname, time.Now())
+		} else {
+			status.Error = cerr.Message
+		}
+		return
+	}
+	status.Exists = true
+	status.Size, _ = strconv.ParseInt(objmeta[Size], 10, 64)
+	status.Version = objmeta["version"]
+}
+
+//
+// proxy
+//
+
+// headObjects returns the statuses of the listed objects in the same order;
+// each target is asked only about the objects it owns
+func (p *proxyrunner) headObjects(w http.ResponseWriter, r *http.Request, bucket string, actionMsg *ActionMsg) {
+	jsmap, ok := actionMsg.Value.(map[string]interface{})
+	if !ok {
+		p.invalmsghdlr(w, r, fmt.Sprintf("Unexpected Value format %+v, %T", actionMsg.Value, actionMsg.Value))
+		return
+	}
+	listMsg, errstr := parseListMsg(jsmap)
+	if errstr != "" {
+		p.invalmsghdlr(w, r, errstr)
+		return
+	}
+	if err := normalizeObjnames(listMsg.Objnames); err != nil {
+		p.invalmsghdlr(w, r, err.Error())
+		return
+	}
+
+	var (
+		smap      = p.smapowner.get()
+		query     = r.URL.Query()
+		pgroup    = query.Get(URLParamPlacementGroup)
+		pertarget = make(map[string][]string)
+		statuses  = make(map[string]*ObjectStatus, len(listMsg.Objnames))
+	)
+	for _, objname := range listMsg.Objnames {
+		if _, ok := statuses[objname]; ok {
+			continue
+		}
+		si, errstr := HrwTarget(bucket, hrwName(objname, pgroup), smap)
+		if errstr != "" {
+			p.invalmsghdlr(w, r, errstr)
+			return
+		}
+		statuses[objname] = &ObjectStatus{Name: objname, Error: "no status from target " + si.DaemonID}
+		pertarget[si.DaemonID] = append(pertarget[si.DaemonID], objname)
+	}
+
+	var (
+		q       = url.Values{}
+		wg      = &sync.WaitGroup{}
+		results = make(chan callResult, len(pertarget))
+	)
+	q.Set(URLParamLocal, strconv.FormatBool(p.bmdowner.get().islocal(bucket)))
+	if cachedonly := query.Get(URLParamCached); cachedonly != "" {
+		q.Set(URLParamCached, cachedonly)
+	}
+	for tid, objnames := range pertarget {
+		msg := ActionMsg{Action: ActHeadObjects, Value: ListMsg{Objnames: objnames}}
+		injson, err := json.Marshal(msg)
+		assert(err == nil, err)
+		wg.Add(1)
+		go func(si *daemonInfo, injson []byte) {
+			reqURL := si.controlURL() + URLPath(Rversion, Rbuckets, bucket) + "?" + q.Encode()
+			results <- p.call(r, si, reqURL, http.MethodPost, injson, ctx.config.Timeout.Default)
+			wg.Done()
+		}(smap.Tmap[tid], injson)
+	}
+	wg.Wait()
+	close(results)
+
+	for res := range results {
+		if res.err != nil {
+			p.invalmsghdlr(w, r, fmt.Sprintf("Failed to HEAD objects at %s: %v (%d: %s)",
+				res.si.DaemonID, res.err, res.status, res.errstr))
+			return
+		}
+		targetResult := &HeadObjectsResult{}
+		if err := json.Unmarshal(res.outjson, targetResult); err != nil {
+			p.invalmsghdlr(w, r, fmt.Sprintf("Failed to unmarshal headobjects response from %s, err: %v",
+				res.si.DaemonID, err))
+			return
+		}
+		for _, status := range targetResult.Objects {
+			if _, ok := statuses[status.Name]; ok {
+				statuses[status.Name] = status
+			}
+		}
+	}
+
+	result := &HeadObjectsResult{Objects: make([]*ObjectStatus, 0, len(listMsg.Objnames))}
+	for _, objname := range listMsg.Objnames {
+		result.Objects = append(result.Objects, statuses[objname])
+	}
+	jsbytes, err := json.Marshal(result)
+	assert(err == nil, err)
+	p.writeJSON(w, r, jsbytes, "headobjects")
+}
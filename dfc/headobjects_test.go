@@ -0,0 +1,62 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ */
+package dfc
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestHeadCloudObjects(t *testing.T) {
+	const bucket = "headbucket"
+	oldconf := ctx.config.NegCache
+	defer func() { ctx.config.NegCache = oldconf }()
+	ctx.config.NegCache = negcacheconf{TTL: time.Minute, MaxEntries: 100}
+
+	target := &targetrunner{}
+	m := newMockCloud(target, bucket)
+	m.versioning = true
+	target.cloudif = m
+	ct := context.Background()
+	if _, cerr := m.putobj(ct, bytes.NewReader([]byte("12345")), bucket, "obj", nil); cerr != nil {
+		t.Fatal(cerr)
+	}
+
+	statuses := make([]*ObjectStatus, 0, 2*headObjectsWorkers)
+	for i := 0; i < 2*headObjectsWorkers; i++ {
+		name := "missing"
+		if i%2 == 0 {
+			name = "obj"
+		}
+		statuses = append(statuses, &ObjectStatus{Name: name})
+	}
+	target.headCloudObjects(ct, bucket, statuses)
+	for _, status := range statuses {
+		if status.Error != "" {
+			t.Errorf("%s: unexpected error %s", status.Name, status.Error)
+		}
+		if status.Name == "obj" && (!status.Exists || status.Cached || status.Size != 5 || status.Version != "1") {
+			t.Errorf("Unexpected status %+v", status)
+		} else if status.Name == "missing" && status.Exists {
+			t.Errorf("Missing object exists: %+v", status)
+		}
+	}
+
+	// the missing object is known to be missing now
+	calls := m.numCalls("headobject")
+	target.headCloudObjects(ct, bucket, []*ObjectStatus{{Name: "missing"}})
+	if n := m.numCalls("headobject"); n != calls {
+		t.Errorf("Expected no more HEADs of the missing object, got %d", n-calls)
+	}
+
+	m.failRate, m.errcode = 1, http.StatusServiceUnavailable
+	failed := &ObjectStatus{Name: "obj"}
+	target.headCloudObjects(ct, bucket, []*ObjectStatus{failed})
+	if failed.Exists || failed.Error == "" {
+		t.Errorf("Expected an error, got %+v", failed)
+	}
+}
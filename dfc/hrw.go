@@ -6,6 +6,10 @@
 package dfc
 
 import (
+	"fmt"
+	"net/http"
+	"sort"
+
 	"github.com/OneOfOne/xxhash"
 )
 
@@ -34,6 +38,43 @@ func HrwTarget(bucket, objname string, smap *Smap) (si *daemonInfo, errstr strin
 	return
 }
 
+// hrwTargetList returns all targets in the order of the object's preference:
+// the first one is HrwTarget
+func hrwTargetList(bucket, objname string, smap *Smap) []*daemonInfo {
+	var (
+		name    = uniquename(bucket, objname)
+		targets = make([]*daemonInfo, 0, len(smap.Tmap))
+		weights = make(map[string]uint64, len(smap.Tmap))
+	)
+	for id, sinfo := range smap.Tmap {
+		targets = append(targets, sinfo)
+		weights[id] = xxhash.ChecksumString64S(id+":"+name, mLCG32)
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		return weights[targets[i].DaemonID] > weights[targets[j].DaemonID]
+	})
+	return targets
+}
+
+// Returns the name that defines which target stores an object: the object
+// name or, if the object belongs to a placement group, the name of the group.
+// Objects of the same group (e.g., all shards of one dataset sample) are
+// stored by the same target
+func hrwName(objname, pgroup string) string {
+	if pgroup != "" {
+		return pgroup
+	}
+	return objname
+}
+
+// The placement group of an object is kept in xattr and must fit it
+func validatePlacementGroup(r *http.Request) (errstr string) {
+	if pgroup := r.URL.Query().Get(URLParamPlacementGroup); len(pgroup) >= maxAttrSize {
+		errstr = fmt.Sprintf("Placement group name is too long: %d (expecting less than %d)", len(pgroup), maxAttrSize)
+	}
+	return
+}
+
 func HrwProxy(smap *Smap, idToSkip string) (pi *daemonInfo, errstr string) {
 	if smap.countProxies() == 0 {
 		errstr = "DFC cluster map is empty: no proxies"
@@ -54,9 +95,18 @@ func HrwProxy(smap *Smap, idToSkip string) (pi *daemonInfo, errstr string) {
 }
 
 func hrwMpath(bucket, objname string) (mpath string) {
+	return hrwMpathLabel(bucket, objname, "")
+}
+
+// hrwMpathLabel selects among the mountpaths with the label, all if the label
+// is empty; returns "" if there are no such mountpaths
+func hrwMpathLabel(bucket, objname, label string) (mpath string) {
 	var max uint64
 	name := uniquename(bucket, objname)
-	for path := range ctx.mountpaths.Available {
+	for path, mp := range ctx.mountpaths.Available {
+		if label != "" && mp.Label != label {
+			continue
+		}
 		cs := xxhash.ChecksumString64S(path+":"+name, mLCG32)
 		if cs > max {
 			max = cs
@@ -7,11 +7,11 @@ package dfc
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
-	"html"
 	"io"
 	"io/ioutil"
 	"log"
@@ -30,7 +30,6 @@ import (
 	"time"
 
 	"github.com/NVIDIA/dfcpub/3rdparty/glog"
-	"github.com/OneOfOne/xxhash"
 	"github.com/hkwi/h2c"
 )
 
@@ -41,9 +40,13 @@ const ( // => Transport.MaxIdleConnsPerHost
 )
 
 type objectProps struct {
-	version string
-	size    int64
-	nhobj   cksumvalue
+	version    string
+	size       int64
+	nhobj      cksumvalue
+	csekhash   string // SHA256 of customer-supplied encryption key, if any
+	pgroup     string // placement group, if any
+	cloudcksum string // checksum offload: the cloud checksum to verify (see scrubber)
+	displaced  string // HRW mountpath of the object stored on another one (see placement)
 }
 
 //===========
@@ -52,15 +55,17 @@ type objectProps struct {
 //
 //===========
 type cloudif interface {
-	listbucket(ctx context.Context, bucket string, msg *GetMsg) (jsbytes []byte, errstr string, errcode int)
-	headbucket(ctx context.Context, bucket string) (bucketprops simplekvs, errstr string, errcode int)
-	getbucketnames(ctx context.Context) (buckets []string, errstr string, errcode int)
+	listbucket(ctx context.Context, bucket string, msg *GetMsg) (jsbytes []byte, cerr *Error)
+	headbucket(ctx context.Context, bucket string) (bucketprops simplekvs, cerr *Error)
+	getbucketnames(ctx context.Context) (buckets []string, cerr *Error)
 	//
-	headobject(ctx context.Context, bucket string, objname string) (objmeta simplekvs, errstr string, errcode int)
+	headobject(ctx context.Context, bucket string, objname string) (objmeta simplekvs, cerr *Error)
 	//
-	getobj(ctx context.Context, fqn, bucket, objname string) (props *objectProps, errstr string, errcode int)
-	putobj(ctx context.Context, file *os.File, bucket, objname string, ohobj cksumvalue) (version string, errstr string, errcode int)
-	deleteobj(ctx context.Context, bucket, objname string) (errstr string, errcode int)
+	getobj(ctx context.Context, fqn, bucket, objname string) (props *objectProps, cerr *Error)
+	getobjrange(ctx context.Context, bucket, objname string, rng *httpRange) (rr *rangeReader, cerr *Error)
+	putobj(ctx context.Context, file io.Reader, bucket, objname string, ohobj cksumvalue) (version string, cerr *Error)
+	deleteobj(ctx context.Context, bucket, objname string) (cerr *Error)
+	restoreobj(ctx context.Context, bucket, objname string, msg *RestoreMsg) (cerr *Error)
 }
 
 //===========
@@ -72,7 +77,7 @@ func invalhdlr(w http.ResponseWriter, r *http.Request) {
 	s := http.StatusText(http.StatusBadRequest)
 	s += ": " + r.Method + " " + r.URL.Path + " from " + r.RemoteAddr
 	glog.Errorln(s)
-	http.Error(w, s, http.StatusBadRequest)
+	WriteError(w, r, NewError(http.StatusBadRequest, "%s", s))
 }
 
 // Copies headers from original request(from client) to
@@ -111,25 +116,37 @@ type httprunner struct {
 	namedrunner
 	mux                   *http.ServeMux
 	h                     *http.Server
+	ln                    net.Listener   // public listener, see external.go
+	intra                 []*http.Server // intra-cluster networks, see intranet.go
 	glogger               *log.Logger
 	si                    *daemonInfo
 	httpclient            *http.Client // http client for intra-cluster comm
 	httpclientLongTimeout *http.Client // http client for long-wait intra-cluster comm
+	sharedClient          *peerClient  // the above two
+	peers                 peerClients  // per-peer clients, see peerclients.go
+	perhost               int          // default MaxIdleConnsPerHost
 	statsif               statsif
 	kalive                kaliveif
 	smapowner             *smapowner
 	bmdowner              *bmdowner
 	callStatsServer       *CallStatsServer
 	revProxy              *httputil.ReverseProxy
+	faults                *faultinjector
 }
 
 func (h *httprunner) registerhdlr(path string, handler func(http.ResponseWriter, *http.Request)) {
 	if h.mux == nil {
 		h.mux = http.NewServeMux()
 	}
-	h.mux.HandleFunc(path, handler)
-	if !strings.HasSuffix(path, "/") {
-		h.mux.HandleFunc(path+"/", handler)
+	if faultsEnabled {
+		handler = h.faultyhdlr(handler)
+	}
+	handler = APIVersionHandler(handler)
+	for _, p := range versionedPaths(path) {
+		h.mux.HandleFunc(p, handler)
+		if !strings.HasSuffix(p, "/") {
+			h.mux.HandleFunc(p+"/", handler)
+		}
 	}
 }
 
@@ -152,10 +169,12 @@ func (h *httprunner) init(s statsif, isproxy bool) {
 		numDaemons = 4
 	}
 
-	h.httpclient =
-		&http.Client{Transport: h.createTransport(perhost, numDaemons), Timeout: ctx.config.Timeout.Default}
-	h.httpclientLongTimeout =
-		&http.Client{Transport: h.createTransport(perhost, numDaemons), Timeout: ctx.config.Timeout.DefaultLong}
+	if ctx.config.Net.HTTP.UseHTTPS {
+		glog.Warningln("HTTPS for inter-cluster communications is not yet supported and should be avoided")
+	}
+	h.perhost = perhost
+	h.sharedClient = h.newPeerClient(perhost, numDaemons)
+	h.httpclient, h.httpclientLongTimeout = h.sharedClient.short, h.sharedClient.long
 
 	if isproxy && ctx.config.Net.HTTP.UseAsProxy {
 		h.revProxy = &httputil.ReverseProxy{
@@ -166,27 +185,36 @@ func (h *httprunner) init(s statsif, isproxy bool) {
 
 	h.smapowner = &smapowner{}
 	h.bmdowner = &bmdowner{}
+	h.faults = newfaultinjector()
 }
 
 // initSI initialize a daemon's identification (never changes once it is set)
 // Note: Sadly httprunner has become the sharing point where common code for
 //       proxyrunner and targetrunner exist.
 func (h *httprunner) initSI() {
-	ipaddr, errstr := getipv4addr()
+	ipaddr, errstr := getipaddr()
 	if errstr != "" {
 		glog.Fatalf("FATAL: %s", errstr)
 	}
 
+	ln, port, err := listenPublic(ctx.config.Net.L4.Port)
+	if err != nil {
+		glog.Fatalf("FATAL: %v", err)
+	}
+	h.ln = ln
+
 	h.si = &daemonInfo{}
 	h.si.NodeIPAddr = ipaddr
-	h.si.DaemonPort = ctx.config.Net.L4.Port
+	h.si.DaemonPort = port
 	id := os.Getenv("DFCDAEMONID")
 	if id != "" {
 		h.si.DaemonID = id
 	} else {
-		split := strings.Split(ipaddr, ".")
-		cs := xxhash.ChecksumString32S(split[len(split)-1], mLCG32)
-		h.si.DaemonID = strconv.Itoa(int(cs&0xffff)) + ":" + ctx.config.Net.L4.Port
+		id, err := loadDaemonID(ipaddr, port)
+		if err != nil {
+			glog.Fatalf("FATAL: %v", err)
+		}
+		h.si.DaemonID = id
 	}
 
 	proto := "http"
@@ -194,31 +222,28 @@ func (h *httprunner) initSI() {
 		proto = "https"
 	}
 
-	h.si.DirectURL = proto + "://" + h.si.NodeIPAddr + ":" + h.si.DaemonPort
-}
-
-func (h *httprunner) createTransport(perhost, numDaemons int) *http.Transport {
-	defaultTransport := http.DefaultTransport.(*http.Transport)
-	transport := &http.Transport{
-		// defaults
-		Proxy: defaultTransport.Proxy,
-		DialContext: (&net.Dialer{ // defaultTransport.DialContext,
-			Timeout:   30 * time.Second, // must be reduced & configurable
-			KeepAlive: 30 * time.Second,
-			DualStack: true,
-		}).DialContext,
-		IdleConnTimeout:       defaultTransport.IdleConnTimeout,
-		ExpectContinueTimeout: defaultTransport.ExpectContinueTimeout,
-		TLSHandshakeTimeout:   defaultTransport.TLSHandshakeTimeout,
-		// custom
-		MaxIdleConnsPerHost: perhost,
-		MaxIdleConns:        perhost * numDaemons,
+	listenURL := daemonURL(proto, ipaddr, port)
+	host, extport := externalAddr(&ctx.config.Net.External, ipaddr, port)
+	if !validPort(extport) {
+		glog.Fatalf("FATAL: invalid external port %s", extport)
 	}
-	if ctx.config.Net.HTTP.UseHTTPS {
-		glog.Warningln("HTTPS for inter-cluster communications is not yet supported and should be avoided")
-		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	h.si.DirectURL = daemonURL(proto, host, extport)
+	if h.si.IntraControlURL, errstr = intraURL(proto, &ctx.config.Net.IntraControl, ipaddr); errstr != "" {
+		glog.Fatalf("FATAL: intra-cluster control network: %s", errstr)
+	}
+	if h.si.IntraDataURL, errstr = intraURL(proto, &ctx.config.Net.IntraData, ipaddr); errstr != "" {
+		glog.Fatalf("FATAL: intra-cluster data network: %s", errstr)
+	}
+	if h.si.DirectURL != listenURL {
+		// behind NAT: intra-cluster traffic stays on the container network
+		glog.Infof("Listening at %s, external %s", listenURL, h.si.DirectURL)
+		if h.si.IntraControlURL == "" {
+			h.si.IntraControlURL = listenURL
+		}
+		if h.si.IntraDataURL == "" {
+			h.si.IntraDataURL = listenURL
+		}
 	}
-	return transport
 }
 
 func (h *httprunner) run() error {
@@ -226,33 +251,62 @@ func (h *httprunner) run() error {
 	// os.Stderr would be used, as per golang.org/pkg/net/http/#Server
 	h.glogger = log.New(&glogwriter{}, "net/http err: ", 0)
 	var handler http.Handler = h.mux
-	addr := ":" + ctx.config.Net.L4.Port
 
 	if ctx.config.Net.HTTP.UseHTTP2 && !ctx.config.Net.HTTP.UseHTTPS {
 		handler = h2c.Server{Handler: handler}
 	}
-	if ctx.config.Net.HTTP.UseHTTPS {
-		h.h = &http.Server{Addr: addr, Handler: handler, ErrorLog: h.glogger}
+	// public network on all local IPs, IPv4 and IPv6 (bound by initSI), and
+	// separate intra-cluster networks, if configured (see intranet.go)
+	addrs := append([]string{h.ln.Addr().String()}, h.si.intraAddrs()...)
+	listeners := []net.Listener{h.ln}
+	for _, addr := range addrs[1:] {
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			for _, ln = range listeners {
+				ln.Close()
+			}
+			glog.Errorf("Terminated %s with err: %v", h.name, err)
+			return err
+		}
+		listeners = append(listeners, ln)
+	}
+	for i, ln := range listeners[1:] {
+		s := h.newServer(addrs[i+1], handler)
+		h.intra = append(h.intra, s)
+		go h.serve(s, ln)
+	}
+	h.h = h.newServer(addrs[0], handler)
+	return h.serve(h.h, listeners[0])
+}
 
+func (h *httprunner) newServer(addr string, handler http.Handler) *http.Server {
+	s := &http.Server{Addr: addr, Handler: handler, ErrorLog: h.glogger}
+	if ctx.config.Net.HTTP.UseHTTPS {
 		if !ctx.config.Net.HTTP.UseHTTP2 {
-			h.h.TLSNextProto = make(map[string]func(*http.Server, *tls.Conn, http.Handler))
+			s.TLSNextProto = make(map[string]func(*http.Server, *tls.Conn, http.Handler))
 		}
-		if err := h.h.ListenAndServeTLS(ctx.config.Net.HTTP.Certificate, ctx.config.Net.HTTP.Key); err != nil {
-			if err != http.ErrServerClosed {
-				glog.Errorf("Terminated %s with err: %v", h.name, err)
-				return err
-			}
-		}
-	} else {
-		h.h = &http.Server{Addr: addr, Handler: handler, ErrorLog: h.glogger}
-		if err := h.h.ListenAndServe(); err != nil {
-			if err != http.ErrServerClosed {
-				glog.Errorf("Terminated %s with err: %v", h.name, err)
-				return err
-			}
+		if k := getsecretskeeper(); k != nil && k.hasCertificate() {
+			// the certificate comes from secrets provider and can be refreshed
+			s.TLSConfig = &tls.Config{GetCertificate: k.getCertificate}
 		}
 	}
+	return s
+}
 
+func (h *httprunner) serve(s *http.Server, ln net.Listener) (err error) {
+	if ctx.config.Net.HTTP.UseHTTPS {
+		certFile, keyFile := ctx.config.Net.HTTP.Certificate, ctx.config.Net.HTTP.Key
+		if s.TLSConfig != nil {
+			certFile, keyFile = "", ""
+		}
+		err = s.ServeTLS(ln, certFile, keyFile)
+	} else {
+		err = s.Serve(ln)
+	}
+	if err != nil && err != http.ErrServerClosed {
+		glog.Errorf("Terminated %s (%s) with err: %v", h.name, s.Addr, err)
+		return err
+	}
 	return nil
 }
 
@@ -265,6 +319,11 @@ func (h *httprunner) stop(err error) {
 	}
 	contextwith, cancel := context.WithTimeout(context.Background(), ctx.config.Timeout.Default)
 
+	for _, s := range h.intra {
+		if err := s.Shutdown(contextwith); err != nil {
+			glog.Infof("Stopped %s (%s), err: %v", h.name, s.Addr, err)
+		}
+	}
 	err = h.h.Shutdown(contextwith)
 	if err != nil {
 		glog.Infof("Stopped %s, err: %v", h.name, err)
@@ -303,6 +362,9 @@ func (h *httprunner) call(rOrig *http.Request, si *daemonInfo, url, method strin
 		request, err = http.NewRequest(method, url, bytes.NewBuffer(injson))
 		if err == nil {
 			request.Header.Set("Content-Type", "application/json")
+			if isGzipped(injson) {
+				request.Header.Set("Content-Encoding", "gzip")
+			}
 		}
 		if glog.V(4) { // super-verbose
 			l := len(injson)
@@ -319,18 +381,19 @@ func (h *httprunner) call(rOrig *http.Request, si *daemonInfo, url, method strin
 	}
 
 	copyHeaders(rOrig, request)
+	h.setEpoch(request)
 	if len(timeout) > 0 {
 		if timeout[0] != 0 {
 			contextwith, cancel := context.WithTimeout(context.Background(), timeout[0])
 			defer cancel()
 			newrequest := request.WithContext(contextwith)
 			copyHeaders(rOrig, newrequest)
-			response, err = h.httpclient.Do(newrequest) // timeout => context.deadlineExceededError
+			response, err = h.client(si, false).Do(newrequest) // timeout => context.deadlineExceededError
 		} else { // zero timeout means the client wants no timeout
-			response, err = h.httpclientLongTimeout.Do(request)
+			response, err = h.client(si, true).Do(request)
 		}
 	} else {
-		response, err = h.httpclient.Do(request)
+		response, err = h.client(si, false).Do(request)
 	}
 	if err != nil {
 		if response != nil && response.StatusCode > 0 {
@@ -360,7 +423,11 @@ func (h *httprunner) call(rOrig *http.Request, si *daemonInfo, url, method strin
 
 	// err == nil && bad status: response.Body contains the error message
 	if response.StatusCode >= http.StatusBadRequest {
-		err = fmt.Errorf("%s, status code: %d", outjson, response.StatusCode)
+		msg := string(outjson)
+		if e := ErrorFromJSON(outjson); e != nil {
+			msg = e.Message
+		}
+		err = fmt.Errorf("%s, status code: %d", msg, response.StatusCode)
 		errstr = err.Error()
 		status = response.StatusCode
 		return callResult{si, outjson, err, errstr, newPrimaryURL, status}
@@ -379,8 +446,7 @@ func (h *httprunner) call(rOrig *http.Request, si *daemonInfo, url, method strin
 //
 //=============================
 func (h *httprunner) restAPIItems(unescapedpath string, maxsplit int) []string {
-	escaped := html.EscapeString(unescapedpath)
-	split := strings.SplitN(escaped, "/", maxsplit)
+	split := strings.SplitN(unescapedpath, "/", maxsplit)
 	apitems := make([]string, 0, len(split))
 	for i := 0; i < len(split); i++ {
 		if split[i] != "" { // omit empty
@@ -393,7 +459,8 @@ func (h *httprunner) restAPIItems(unescapedpath string, maxsplit int) []string {
 // remove validated fields and return the resulting slice
 func (h *httprunner) checkRestAPI(w http.ResponseWriter, r *http.Request, apitems []string, n int, ver, res string) []string {
 	if len(apitems) > 0 && ver != "" {
-		if apitems[0] != ver {
+		// all supported versions share the handlers of Rversion
+		if apitems[0] != ver && !(ver == Rversion && isAPIVersion(apitems[0])) {
 			s := fmt.Sprintf("Invalid API version: %s (expecting %s)", apitems[0], ver)
 			if _, file, line, ok := runtime.Caller(1); ok {
 				f := filepath.Base(file)
@@ -429,7 +496,17 @@ func (h *httprunner) checkRestAPI(w http.ResponseWriter, r *http.Request, apitem
 }
 
 func (h *httprunner) readJSON(w http.ResponseWriter, r *http.Request, out interface{}) error {
-	b, err := ioutil.ReadAll(r.Body)
+	var reader io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			h.invalmsghdlr(w, r, fmt.Sprintf("Failed to read gzip-ed %s request, err: %v", r.Method, err))
+			return err
+		}
+		defer zr.Close()
+		reader = zr
+	}
+	b, err := ioutil.ReadAll(reader)
 	if err != nil {
 		s := fmt.Sprintf("Failed to read %s request, err: %v", r.Method, err)
 		if err == io.EOF {
@@ -527,8 +604,17 @@ func (h *httprunner) setconfig(name, value string) (errstr string) {
 	case "stats_time":
 		if v, err := time.ParseDuration(value); err != nil {
 			errstr = fmt.Sprintf("Failed to parse stats_time, err: %v", err)
+		} else if v <= 0 {
+			errstr = fmt.Sprintf("Invalid stats_time %v", v)
 		} else {
 			ctx.config.Periodic.StatsTime, ctx.config.Periodic.StatsTimeStr = v, value
+			h.statsif.restartWindow()
+		}
+	case "stats_history":
+		if v, err := strconv.Atoi(value); err != nil || v < 0 {
+			errstr = fmt.Sprintf("Invalid stats_history %q, err: %v", value, err)
+		} else {
+			ctx.config.Periodic.StatsHistory = v
 		}
 	case "dont_evict_time":
 		if v, err := time.ParseDuration(value); err != nil {
@@ -620,6 +706,30 @@ func (h *httprunner) setconfig(name, value string) (errstr string) {
 		} else {
 			ctx.config.Cksum.EnableReadRangeChecksum = v
 		}
+	case "fsync":
+		if !validFsyncPolicy(value) {
+			errstr = fmt.Sprintf("Invalid fsync policy: %s", value)
+		} else {
+			ctx.config.Commit.Fsync = value
+		}
+	case "max_used_pct":
+		if v, err := atoi(value); err != nil || v > 100 {
+			errstr = fmt.Sprintf("Invalid max_used_pct %q, err: %v", value, err)
+		} else {
+			ctx.config.Placement.MaxUsedPct = v
+		}
+	case "direct_io_threshold":
+		if v, err := strconv.ParseInt(value, 10, 64); err != nil || v < 0 {
+			errstr = fmt.Sprintf("Invalid direct_io_threshold %q, err: %v", value, err)
+		} else {
+			ctx.config.DirectIO.Threshold = v
+		}
+	case "offload_checksum_cold_get":
+		if v, err := strconv.ParseBool(value); err != nil {
+			errstr = fmt.Sprintf("Failed to parse offload_checksum_cold_get, err: %v", err)
+		} else {
+			ctx.config.Cksum.OffloadColdGet = v
+		}
 	case "validate_version_warm_get":
 		if v, err := strconv.ParseBool(value); err != nil {
 			errstr = fmt.Sprintf("Failed to parse validate_version_warm_get, err: %v", err)
@@ -674,9 +784,7 @@ func (h *httprunner) invalmsghdlr(w http.ResponseWriter, r *http.Request, msg st
 			s += fmt.Sprintf("(%s, #%d)", f, line)
 		}
 	}
-	glog.Errorln(s)
-	http.Error(w, s, status)
-	h.statsif.add("numerr", 1)
+	h.senderror(w, r, NewError(status, "%s", msg), s)
 }
 
 func (h *httprunner) extractSmap(payload simplekvs) (newsmap, oldsmap *Smap, msg *ActionMsg, errstr string) {
@@ -789,8 +897,17 @@ func URLPath(segments ...string) string {
 	return path.Join("/", path.Join(segments...))
 }
 
+// URLEscapedPath returns the escaped path of a HTTP URL, to be appended to
+// the URL's scheme and host: object names may contain '?', '#', '%', spaces
+// and other characters that are special in URLs. Unlike URLPath, the object
+// name's slashes are kept as they are
+func URLEscapedPath(segments ...string) string {
+	u := url.URL{Path: "/" + strings.Join(segments, "/")}
+	return u.EscapedPath()
+}
+
 // broadcast sends a http call to all servers in parallel, wait until all calls are returned
-// note: 'u' has only the path and query part, host portion will be set by this function.
+// note: 'path' (unescaped) and 'query' get appended to the callee's control-plane URL (see intranet.go)
 func (h *httprunner) broadcast(path string, query url.Values, method string, body []byte,
 	servers []*daemonInfo, timeout ...time.Duration) chan callResult {
 	var (
@@ -803,16 +920,11 @@ func (h *httprunner) broadcast(path string, query url.Values, method string, bod
 		go func(di *daemonInfo, wg *sync.WaitGroup) {
 			defer wg.Done()
 
-			var u url.URL
-			if ctx.config.Net.HTTP.UseHTTPS {
-				u.Scheme = "https"
-			} else {
-				u.Scheme = "http"
+			u := di.controlURL() + (&url.URL{Path: path}).EscapedPath()
+			if len(query) > 0 {
+				u += "?" + query.Encode()
 			}
-			u.Host = di.NodeIPAddr + ":" + di.DaemonPort
-			u.Path = path
-			u.RawQuery = query.Encode() // golang handles query == nil
-			res := h.call(nil, di, u.String(), method, body, timeout...)
+			res := h.call(nil, di, u, method, body, timeout...)
 			ch <- res
 		}(s, wg)
 	}
@@ -825,7 +937,7 @@ func (h *httprunner) broadcast(path string, query url.Values, method string, bod
 func (h *httprunner) getXactionKindFromProperties(props string) (
 	string, error) {
 	switch props {
-	case XactionRebalance, XactionPrefetch:
+	case XactionRebalance, XactionPrefetch, XactionDestroy:
 		return props, nil
 	}
 
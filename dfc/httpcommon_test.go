@@ -0,0 +1,38 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestURLEscapedPath(t *testing.T) {
+	h := &httprunner{}
+	for _, objname := range []string{
+		"plain", "with space", "question?mark", "hash#tag", "plus+sign", "percent%20encoded", "percent%",
+		"ampersand&equals=", "quote'double\"", "unicode-ü-日本", "dir/sub dir/a?b#c", "trailing/",
+	} {
+		rawurl := "http://10.0.0.1:8080" + URLEscapedPath(Rversion, Robjects, "bucket", objname)
+		u, err := url.Parse(rawurl)
+		if err != nil {
+			t.Errorf("%q: failed to parse %s, err: %v", objname, rawurl, err)
+			continue
+		}
+		if u.RawQuery != "" || u.Fragment != "" {
+			t.Errorf("%q: unexpected query %q or fragment %q in %s", objname, u.RawQuery, u.Fragment, rawurl)
+		}
+		apitems := h.restAPIItems(u.Path, 5)
+		if expected := []string{Rversion, Robjects, "bucket", objname}; !reflect.DeepEqual(apitems, expected) {
+			t.Errorf("%q: expected %q, got %q", objname, expected, apitems)
+		}
+		// redirect
+		redirected, err := url.Parse("http://10.0.0.2:8081" + u.EscapedPath() + "?local=true")
+		if err != nil || redirected.Path != u.Path || redirected.Query().Get("local") != "true" {
+			t.Errorf("%q: redirect to %v, err: %v", objname, redirected, err)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NVIDIA/dfcpub/3rdparty/glog"
+)
+
+// HTTP Range GET (RFC 7233): "Range: bytes=first-last", "bytes=first-" or
+// "bytes=-suffix" returns the part of the object with 206 Partial Content
+// and Content-Range. Only a single range is supported. The range of a cached
+// object is read from its local file. The range of a Cloud object that is not
+// cached (or is to be cold-GET again) is read from the Cloud and passed through
+// to the client without caching the object: reading a few megabytes of a
+// very large object does not download all of it.
+
+type (
+	httpRange struct {
+		first, last int64 // bytes=first-last; last < 0: through the end of the object
+		suffix      int64 // bytes=-suffix, if first < 0: the last suffix bytes
+	}
+	// rangeReader reads the range [offset, offset+length) of a Cloud object
+	rangeReader struct {
+		io.ReadCloser
+		offset, length int64
+		size           int64 // the size of the whole object
+		version        string
+	}
+)
+
+// parseRangeHeader parses the value of the Range header; returns nil if there is none
+func parseRangeHeader(s string) (rng *httpRange, errstr string) {
+	if s == "" {
+		return
+	}
+	errstr = fmt.Sprintf("Invalid %s: %q", HeaderRange, s)
+	if !strings.HasPrefix(s, "bytes=") {
+		return
+	}
+	spec := strings.TrimSpace(strings.TrimPrefix(s, "bytes="))
+	if strings.Contains(spec, ",") {
+		return nil, fmt.Sprintf("Invalid %s: %q - multiple ranges are not supported", HeaderRange, s)
+	}
+	i := strings.Index(spec, "-")
+	if i < 0 {
+		return
+	}
+	first, last := strings.TrimSpace(spec[:i]), strings.TrimSpace(spec[i+1:])
+	if first == "" {
+		suffix, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || suffix < 0 {
+			return
+		}
+		return &httpRange{first: -1, suffix: suffix}, ""
+	}
+	rng = &httpRange{last: -1}
+	var err error
+	if rng.first, err = strconv.ParseInt(first, 10, 64); err != nil || rng.first < 0 {
+		return nil, errstr
+	}
+	if last != "" {
+		if rng.last, err = strconv.ParseInt(last, 10, 64); err != nil || rng.last < rng.first {
+			return nil, errstr
+		}
+	}
+	return rng, ""
+}
+
+// resolve returns the offset and the length of the range of the object of the
+// size; ok = false if the range is not satisfiable
+func (rng *httpRange) resolve(size int64) (offset, length int64, ok bool) {
+	if rng.first < 0 {
+		if rng.suffix == 0 || size == 0 {
+			return
+		}
+		length = rng.suffix
+		if length > size {
+			length = size
+		}
+		return size - length, length, true
+	}
+	if rng.first >= size {
+		return
+	}
+	last := rng.last
+	if last < 0 || last >= size {
+		last = size - 1
+	}
+	return rng.first, last - rng.first + 1, true
+}
+
+// String returns the value of the Range header
+func (rng *httpRange) String() string {
+	switch {
+	case rng.first < 0:
+		return fmt.Sprintf("bytes=-%d", rng.suffix)
+	case rng.last < 0:
+		return fmt.Sprintf("bytes=%d-", rng.first)
+	default:
+		return fmt.Sprintf("bytes=%d-%d", rng.first, rng.last)
+	}
+}
+
+// contentRange returns the value of the Content-Range header
+func contentRange(offset, length, size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", offset, offset+length-1, size)
+}
+
+// parseContentRange parses the Content-Range of a 206 response
+func parseContentRange(s string) (offset, length, size int64, err error) {
+	var last int64
+	if _, err = fmt.Sscanf(s, "bytes %d-%d/%d", &offset, &last, &size); err != nil {
+		return 0, 0, 0, fmt.Errorf("invalid %s %q: %v", HeaderContentRange, s, err)
+	}
+	if offset < 0 || last < offset || last >= size {
+		return 0, 0, 0, fmt.Errorf("invalid %s %q", HeaderContentRange, s)
+	}
+	return offset, last - offset + 1, size, nil
+}
+
+// errRangeNotSatisfiable is returned by the Cloud providers that resolve the range themselves
+func errRangeNotSatisfiable(bucket, objname string, rng *httpRange, size int64) *Error {
+	return NewError(http.StatusRequestedRangeNotSatisfiable, "%s %s/%s: not satisfiable, the size is %d",
+		rng, bucket, objname, size)
+}
+
+// getCloudRange passes the range of the Cloud object through to the client
+func (t *targetrunner) getCloudRange(ct context.Context, w http.ResponseWriter, r *http.Request,
+	bucket, objname string, rng *httpRange) bool {
+	started := time.Now()
+	if errstr, errcode := t.coldMissing(bucket, objname); errstr != "" {
+		t.invalmsghdlr(w, r, errstr, errcode)
+		return false
+	}
+	rr, cerr := t.cloudif.getobjrange(ct, bucket, objname, rng)
+	if cerr != nil {
+		if cerr.Status == http.StatusNotFound {
+			t.negcache.add(uniquename(bucket, objname), time.Now())
+		}
+		errstr, errcode := cerr.errstrcode()
+		t.invalmsghdlr(w, r, errstr, errcode)
+		return false
+	}
+	defer rr.Close()
+	if rr.version != "" {
+		w.Header().Set(HeaderDfcObjVersion, rr.version)
+	}
+	w.Header().Set(HeaderAcceptRanges, "bytes")
+	w.Header().Set(HeaderContentRange, contentRange(rr.offset, rr.length, rr.size))
+	w.Header().Set("Content-Length", strconv.FormatInt(rr.length, 10))
+	w.WriteHeader(http.StatusPartialContent)
+
+	slab := selectslab(rr.length)
+	buf := slab.alloc()
+	defer slab.free(buf)
+	written, err := io.CopyBuffer(t.egressWriter(bucket, w), rr, buf)
+	t.cloudEgress.add(bucket, written)
+	if err != nil {
+		errstr := fmt.Sprintf("Failed to send %s/%s %s, err: %v", bucket, objname, rng, err)
+		glog.Errorln(t.errHTTP(r, errstr, http.StatusInternalServerError))
+		t.statsif.add("numerr", 1)
+		return false
+	}
+	if glog.V(4) {
+		glog.Infof("GET: %s/%s %s, %.2f MB, %d µs (from the Cloud)",
+			bucket, objname, contentRange(rr.offset, rr.length, rr.size), float64(written)/MiB, time.Since(started)/1000)
+	}
+	return true
+}
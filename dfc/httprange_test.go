@@ -0,0 +1,113 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ */
+package dfc
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseRangeHeader(t *testing.T) {
+	const size = 1000
+	for _, test := range []struct {
+		header         string
+		invalid        bool
+		offset, length int64
+		unsatisfiable  bool
+	}{
+		{header: "bytes=0-99", offset: 0, length: 100},
+		{header: "bytes=100-", offset: 100, length: 900},
+		{header: "bytes=900-2000", offset: 900, length: 100},
+		{header: "bytes=-10", offset: 990, length: 10},
+		{header: "bytes=-5000", offset: 0, length: size},
+		{header: "bytes= 5 - 5", offset: 5, length: 1},
+		{header: "bytes=1000-", unsatisfiable: true},
+		{header: "bytes=-0", unsatisfiable: true},
+		{header: "items=0-99", invalid: true},
+		{header: "bytes=0-9,20-29", invalid: true},
+		{header: "bytes=10-9", invalid: true},
+		{header: "bytes=-", invalid: true},
+		{header: "bytes=a-b", invalid: true},
+		{header: "bytes=5", invalid: true},
+	} {
+		rng, errstr := parseRangeHeader(test.header)
+		if test.invalid {
+			if errstr == "" {
+				t.Errorf("%q: expected to be invalid", test.header)
+			}
+			continue
+		}
+		if errstr != "" {
+			t.Errorf("%q: %s", test.header, errstr)
+			continue
+		}
+		offset, length, ok := rng.resolve(size)
+		if ok == test.unsatisfiable || offset != test.offset || length != test.length {
+			t.Errorf("%q: expected %d, %d, satisfiable: %t - got %d, %d, %t",
+				test.header, test.offset, test.length, !test.unsatisfiable, offset, length, ok)
+		}
+		if again, _ := parseRangeHeader(rng.String()); *again != *rng {
+			t.Errorf("%q: %s parsed as %+v", test.header, rng, again)
+		}
+	}
+	if rng, errstr := parseRangeHeader(""); rng != nil || errstr != "" {
+		t.Errorf("Expected no range, got %+v, %s", rng, errstr)
+	}
+
+	offset, length, objsize, err := parseContentRange(contentRange(10, 20, 100))
+	if err != nil || offset != 10 || length != 20 || objsize != 100 {
+		t.Errorf("Unexpected content range: %d, %d, %d, err: %v", offset, length, objsize, err)
+	}
+	if _, _, _, err = parseContentRange("bytes */100"); err == nil {
+		t.Error("Expected an unsatisfied range to be invalid")
+	}
+}
+
+func TestGetCloudRange(t *testing.T) {
+	const bucket = "rangebucket"
+	target, m := newTestTarget(nil, bucket)
+	data := make([]byte, 1000)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	if _, cerr := m.putobj(context.Background(), bytes.NewReader(data), bucket, "large", nil); cerr != nil {
+		t.Fatal(cerr)
+	}
+
+	get := func(objname, header string) *httptest.ResponseRecorder {
+		rng, errstr := parseRangeHeader(header)
+		if errstr != "" {
+			t.Fatal(errstr)
+		}
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/v1/objects/"+bucket+"/"+objname, nil)
+		target.getCloudRange(context.Background(), w, r, bucket, objname, rng)
+		return w
+	}
+	w := get("large", "bytes=100-199")
+	if w.Code != http.StatusPartialContent || w.Header().Get(HeaderContentRange) != "bytes 100-199/1000" {
+		t.Fatalf("Unexpected response %d, %s: %s", w.Code, w.Header().Get(HeaderContentRange), w.Body.String())
+	}
+	if body := w.Body.Bytes(); len(body) != 100 || body[0] != 100 || body[99] != 199 {
+		t.Errorf("Unexpected range of %d bytes", len(body))
+	}
+	if w = get("large", "bytes=-1"); w.Body.Len() != 1 || w.Header().Get(HeaderContentRange) != "bytes 999-999/1000" {
+		t.Errorf("Unexpected suffix range %s", w.Header().Get(HeaderContentRange))
+	}
+	if w = get("large", "bytes=1000-"); w.Code != http.StatusRequestedRangeNotSatisfiable {
+		t.Errorf("Expected %d, got %d", http.StatusRequestedRangeNotSatisfiable, w.Code)
+	}
+	if w = get("missing", "bytes=0-"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected %d, got %d", http.StatusNotFound, w.Code)
+	}
+	if n := m.numCalls("getobj"); n != 0 {
+		t.Errorf("Expected no cold GETs, got %d", n)
+	}
+	if egress := target.cloudEgress.get(); egress[bucket] != 101 {
+		t.Errorf("Expected 101 bytes of egress, got %d", egress[bucket])
+	}
+}
@@ -0,0 +1,366 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/NVIDIA/dfcpub/3rdparty/glog"
+	"github.com/OneOfOne/xxhash"
+)
+
+// Bulk import. Upon POST {"action": "import"} /v1/buckets/local-bucket-name
+// each target walks the directory given in ImportMsg - or, if none, its
+// staging area: the <mountpath>/.staging/<bucket> directories - and stores
+// each regular file as an object named by the file's path relative to the
+// directory. The files are checksummed and stored by a pool of workers; a
+// file owned (HRW) by another target is sent to that target along with its
+// checksum. With ImportMsg.Shared the directory is expected to be visible to
+// all targets (e.g., an NFS mount), and each target imports only the files
+// it owns. Imported files are removed from the staging area; the files of
+// the directory are never modified. The import runs in the background, and
+// its per-file results are returned by GET /v1/daemon?what=import and, for
+// all targets, by GET /v1/cluster?what=import.
+
+const (
+	importname      = "import.json"
+	mpathStagingDir = ".staging" // the mountpath's subdirectory for the files to import
+	importWorkers   = 8
+)
+
+var errImportAborted = errors.New("import aborted")
+
+func parseImportMsg(msg *ActionMsg) (*ImportMsg, error) {
+	impmsg := &ImportMsg{}
+	if msg.Value != nil {
+		b, err := json.Marshal(msg.Value)
+		if err == nil {
+			err = json.Unmarshal(b, impmsg)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Invalid import parameters %v, err: %v", msg.Value, err)
+		}
+	}
+	if impmsg.Dir != "" && !filepath.IsAbs(impmsg.Dir) {
+		return nil, fmt.Errorf("Invalid import directory %q: not an absolute path", impmsg.Dir)
+	}
+	if impmsg.Shared && impmsg.Dir == "" {
+		return nil, fmt.Errorf("Shared import requires the directory")
+	}
+	if impmsg.Workers < 0 {
+		return nil, fmt.Errorf("Invalid number of import workers %d", impmsg.Workers)
+	}
+	if impmsg.Workers == 0 {
+		impmsg.Workers = importWorkers
+	}
+	return impmsg, nil
+}
+
+//
+// target
+//
+
+// startImport starts the import in the background
+func (t *targetrunner) startImport(w http.ResponseWriter, r *http.Request, msg *ActionMsg) {
+	apitems := t.restAPIItems(r.URL.Path, 5)
+	if apitems = t.checkRestAPI(w, r, apitems, 1, Rversion, Rbuckets); apitems == nil {
+		return
+	}
+	bucket := apitems[0]
+	if !t.bmdowner.get().islocal(bucket) {
+		t.invalmsghdlr(w, r, fmt.Sprintf("Cannot import into %s: not a local bucket", bucket))
+		return
+	}
+	impmsg, err := parseImportMsg(msg)
+	if err != nil {
+		t.invalmsghdlr(w, r, err.Error())
+		return
+	}
+	if impmsg.Dir != "" {
+		if finfo, err := os.Stat(impmsg.Dir); err != nil || !finfo.IsDir() {
+			t.invalmsghdlr(w, r, fmt.Sprintf("Cannot import %s: not a directory (err: %v)", impmsg.Dir, err))
+			return
+		}
+	}
+	ximp, errstr := t.xactinp.renewImport(t, bucket, impmsg)
+	if errstr != "" {
+		t.invalmsghdlr(w, r, errstr, http.StatusConflict)
+		return
+	}
+	go t.runImport(ximp)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func newImportResult(t *targetrunner, bucket string, impmsg *ImportMsg) *ImportResult {
+	result := &ImportResult{Bucket: bucket, Dir: impmsg.Dir, Started: time.Now(), Files: []*ImportedFile{}}
+	if t.si != nil {
+		result.DaemonID = t.si.DaemonID
+	}
+	return result
+}
+
+// importRoots returns the directories to import and whether the imported
+// files are to be removed
+func importRoots(bucket string, impmsg *ImportMsg) (roots []string, promote bool) {
+	if impmsg.Dir != "" {
+		return []string{impmsg.Dir}, false
+	}
+	for mpath := range ctx.mountpaths.Available {
+		roots = append(roots, filepath.Join(mpath, mpathStagingDir, bucket))
+	}
+	return roots, true
+}
+
+func (t *targetrunner) runImport(ximp *xactImport) *ImportResult {
+	glog.Infoln(ximp.tostring())
+	var (
+		bucket, impmsg = ximp.bucket, ximp.msg
+		roots, promote = importRoots(bucket, impmsg)
+		smap           = t.smapowner.get()
+		files          = make(chan *ImportedFile, impmsg.Workers)
+		wg             = &sync.WaitGroup{}
+	)
+	for i := 0; i < impmsg.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			for file := range files {
+				if ximp.aborted() {
+					file.Error = errImportAborted.Error()
+				} else {
+					t.importFile(bucket, file, promote)
+				}
+				ximp.done(file)
+			}
+			wg.Done()
+		}()
+	}
+	for _, root := range roots {
+		err := filepath.Walk(root, func(path string, finfo os.FileInfo, err error) error {
+			if err != nil {
+				if path == root && promote && os.IsNotExist(err) {
+					return nil // nothing staged
+				}
+				ximp.done(&ImportedFile{Path: path, Error: err.Error()})
+				if finfo != nil && finfo.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if ximp.aborted() {
+				return errImportAborted
+			}
+			if finfo.IsDir() {
+				return nil
+			}
+			relname, _ := filepath.Rel(root, path)
+			file := &ImportedFile{Path: path, Name: impmsg.Prefix + filepath.ToSlash(relname), Size: finfo.Size()}
+			if !finfo.Mode().IsRegular() {
+				file.Error = "Not a regular file"
+				ximp.done(file)
+				return nil
+			}
+			si, errstr := HrwTarget(bucket, file.Name, smap)
+			if errstr != "" {
+				file.Error = errstr
+				ximp.done(file)
+				return nil
+			}
+			if impmsg.Shared && si.DaemonID != t.si.DaemonID {
+				return nil // imported by the owner
+			}
+			file.Target = si.DaemonID
+			files <- file
+			return nil
+		})
+		if err != nil {
+			glog.Errorf("%s: failed to walk %s, err: %v", ximp.tostring(), root, err)
+		}
+	}
+	close(files)
+	wg.Wait()
+
+	ximp.mu.Lock()
+	result := ximp.result
+	result.Finished = time.Now()
+	ximp.mu.Unlock()
+	if err := LocalSave(filepath.Join(ctx.config.Confdir, importname), result); err != nil {
+		glog.Errorf("Failed to store the import results, err: %v", err)
+	}
+	ximp.etime = time.Now()
+	glog.Infof("%s: %d imported (%d bytes), %d failed", ximp.tostring(), result.Imported, result.Bytes, result.Failed)
+	t.xactinp.del(ximp.id)
+	return result
+}
+
+func (xact *xactImport) done(file *ImportedFile) {
+	xact.mu.Lock()
+	result := xact.result
+	result.Files = append(result.Files, file)
+	if file.Error != "" {
+		result.Failed++
+	} else {
+		result.Imported++
+		result.Bytes += file.Size
+	}
+	xact.mu.Unlock()
+}
+
+// importFile stores the file locally or sends it to the owning target and,
+// if promoted from the staging area, removes it
+func (t *targetrunner) importFile(bucket string, file *ImportedFile, promote bool) {
+	var errstr string
+	if file.Target == t.si.DaemonID {
+		errstr = t.importLocal(bucket, file)
+	} else {
+		errstr = t.importRemote(bucket, file)
+	}
+	if errstr != "" {
+		file.Error = errstr
+		return
+	}
+	if promote {
+		if err := os.Remove(file.Path); err != nil {
+			glog.Errorf("Failed to remove imported %s, err: %v", file.Path, err)
+		}
+	}
+}
+
+func (t *targetrunner) importLocal(bucket string, file *ImportedFile) (errstr string) {
+	reader, err := os.Open(file.Path)
+	if err != nil {
+		return fmt.Sprintf("Failed to open %s, err: %v", file.Path, err)
+	}
+	defer reader.Close()
+	fqn, hrwmpath := t.placefqn(bucket, file.Name, true)
+	putfqn := t.fqn2workfile(fqn)
+	props := &objectProps{displaced: hrwmpath}
+	if _, props.nhobj, file.Size, errstr = t.receive(putfqn, bucket, file.Name, "", nil,
+		t.ingressReader(bucket, reader)); errstr != "" {
+		return
+	}
+	if props.nhobj != nil {
+		_, file.Cksum = props.nhobj.get()
+	}
+	errstr, _ = t.putCommit(context.Background(), bucket, file.Name, putfqn, fqn, props, false /*rebalance*/)
+	return
+}
+
+// importRemote sends the file to the owning target the way rebalance does
+func (t *targetrunner) importRemote(bucket string, file *ImportedFile) (errstr string) {
+	si := t.smapowner.get().getTarget(file.Target)
+	if si == nil {
+		return fmt.Sprintf("Unknown target %s (Smap not in-sync?)", file.Target)
+	}
+	reader, err := os.Open(file.Path)
+	if err != nil {
+		return fmt.Sprintf("Failed to open %s, err: %v", file.Path, err)
+	}
+	defer reader.Close()
+	if ctx.config.Cksum.Checksum != ChecksumNone {
+		slab := selectslab(file.Size)
+		buf := slab.alloc()
+		file.Cksum, errstr = ComputeXXHash(reader, buf, xxhash.New64())
+		slab.free(buf)
+		if errstr != "" {
+			return
+		}
+		if _, err = reader.Seek(0, io.SeekStart); err != nil {
+			return fmt.Sprintf("Unexpected fseek failure when sending %s, err: %v", file.Path, err)
+		}
+	}
+	q := url.Values{}
+	q.Set(URLParamFromID, t.si.DaemonID)
+	q.Set(URLParamToID, si.DaemonID)
+	reqURL := si.dataURL() + URLEscapedPath(Rversion, Robjects, bucket, file.Name) + "?" + q.Encode()
+	request, err := http.NewRequest(http.MethodPut, reqURL, reader)
+	if err != nil {
+		return fmt.Sprintf("Unexpected failure to create request %s, err: %v", reqURL, err)
+	}
+	request.ContentLength = file.Size
+	if file.Cksum != "" {
+		request.Header.Set(HeaderDfcChecksumType, ChecksumXXHash)
+		request.Header.Set(HeaderDfcChecksumVal, file.Cksum)
+	}
+	contextwith, cancel := context.WithTimeout(context.Background(), ctx.config.Timeout.SendFile)
+	defer cancel()
+	response, err := t.httpclientLongTimeout.Do(request.WithContext(contextwith))
+	if err != nil {
+		return fmt.Sprintf("Failed to send %s to %s, err: %v", file.Path, si.DaemonID, err)
+	}
+	b, err := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	if response.StatusCode >= http.StatusBadRequest {
+		return fmt.Sprintf("Failed to send %s to %s, status %d: %s",
+			file.Path, si.DaemonID, response.StatusCode, strings.TrimSpace(string(b)))
+	}
+	if err != nil {
+		return fmt.Sprintf("Failed to read the response of %s to %s, err: %v", file.Path, si.DaemonID, err)
+	}
+	return
+}
+
+// importResult returns the results of the running import, if any, or else
+// of the last one; nil if none
+func (t *targetrunner) importResult() (*ImportResult, error) {
+	if _, xx := t.xactinp.findL(ActImport); xx != nil {
+		ximp := xx.(*xactImport)
+		ximp.mu.Lock()
+		result := *ximp.result
+		result.Files = append([]*ImportedFile{}, ximp.result.Files...)
+		ximp.mu.Unlock()
+		return &result, nil
+	}
+	result := &ImportResult{}
+	if err := LocalLoad(filepath.Join(ctx.config.Confdir, importname), result); err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return result, nil
+}
+
+//
+// proxy
+//
+
+// importBucket starts the import at all targets
+func (p *proxyrunner) importBucket(w http.ResponseWriter, r *http.Request, bucket string, msg *ActionMsg) {
+	if !p.bmdowner.get().islocal(bucket) {
+		p.invalmsghdlr(w, r, fmt.Sprintf("Cannot import into %s: not a local bucket", bucket))
+		return
+	}
+	if _, err := parseImportMsg(msg); err != nil {
+		p.invalmsghdlr(w, r, err.Error())
+		return
+	}
+	jsbytes, err := json.Marshal(msg)
+	assert(err == nil, err)
+	q := url.Values{}
+	q.Set(URLParamLocal, "true")
+	results := p.broadcastTargets(URLPath(Rversion, Rbuckets, bucket), q, http.MethodPost, jsbytes,
+		p.smapowner.get(), ctx.config.Timeout.Default)
+	for res := range results {
+		if res.err != nil {
+			p.invalmsghdlr(w, r, fmt.Sprintf("Failed to start import at %s: %v (%d: %s)",
+				res.si.DaemonID, res.err, res.status, res.errstr))
+			return
+		}
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
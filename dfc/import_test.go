@@ -0,0 +1,107 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ */
+package dfc
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestImport(t *testing.T) {
+	const bucket = "importbucket"
+	dir, err := ioutil.TempDir("", "import")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	mpath, src := filepath.Join(dir, "mpath"), filepath.Join(dir, "src")
+	oldavail, oldconfdir, oldcksum := ctx.mountpaths.Available, ctx.config.Confdir, ctx.config.Cksum
+	defer func() {
+		ctx.mountpaths.Available, ctx.config.Confdir, ctx.config.Cksum = oldavail, oldconfdir, oldcksum
+	}()
+	ctx.mountpaths.Available = map[string]*mountPath{mpath: {Path: mpath}}
+	ctx.config.Confdir = dir
+	ctx.config.Cksum = cksumconfig{Checksum: ChecksumXXHash}
+
+	target, _ := newTestTarget(map[string]BucketProps{bucket: {}})
+
+	files := map[string]string{"a.jpg": "a", "sub/b.jpg": "bb", "sub/deeper/c.jpg": "ccc"}
+	for name, data := range files {
+		path := filepath.Join(src, filepath.FromSlash(name))
+		if err = CreateDir(filepath.Dir(path)); err != nil {
+			t.Fatal(err)
+		}
+		if err = ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	impmsg, err := parseImportMsg(&ActionMsg{Action: ActImport, Value: map[string]interface{}{"dir": src, "prefix": "train/"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if impmsg.Workers != importWorkers {
+		t.Errorf("Expected %d workers by default, got %d", importWorkers, impmsg.Workers)
+	}
+	ximp, errstr := target.xactinp.renewImport(target, bucket, impmsg)
+	if errstr != "" {
+		t.Fatal(errstr)
+	}
+	if _, errstr = target.xactinp.renewImport(target, bucket, impmsg); errstr == "" {
+		t.Error("Expected the second import to be refused while the first is running")
+	}
+	result := target.runImport(ximp)
+	if result.Imported != 3 || result.Failed != 0 || result.Bytes != 6 {
+		t.Fatalf("Unexpected import result %+v", result)
+	}
+	var names []string
+	for _, file := range result.Files {
+		names = append(names, file.Name)
+		if file.Cksum == "" || file.Target != "target" {
+			t.Errorf("Unexpected result of importing %s: %+v", file.Path, file)
+		}
+		data, err := ioutil.ReadFile(target.fqn(bucket, file.Name, true))
+		if err != nil || string(data) != files[file.Name[len("train/"):]] {
+			t.Errorf("Unexpected object %s: %q, err: %v", file.Name, data, err)
+		}
+		if _, err = os.Stat(file.Path); err != nil {
+			t.Errorf("Expected %s to be kept, err: %v", file.Path, err)
+		}
+	}
+	sort.Strings(names)
+	if len(names) != 3 || names[0] != "train/a.jpg" || names[2] != "train/sub/deeper/c.jpg" {
+		t.Errorf("Unexpected object names %v", names)
+	}
+	if saved, err := target.importResult(); err != nil || saved == nil || saved.Imported != 3 {
+		t.Errorf("Expected the stored import result, got %+v, err: %v", saved, err)
+	}
+
+	// promoted from the staging area
+	staged := filepath.Join(mpath, mpathStagingDir, bucket, "staged.jpg")
+	if err = CreateDir(filepath.Dir(staged)); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(staged, []byte("staged"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	impmsg, _ = parseImportMsg(&ActionMsg{Action: ActImport})
+	ximp, _ = target.xactinp.renewImport(target, bucket, impmsg)
+	result = target.runImport(ximp)
+	if result.Imported != 1 || result.Files[0].Name != "staged.jpg" {
+		t.Fatalf("Unexpected staging import result %+v", result)
+	}
+	if _, err = os.Stat(staged); !os.IsNotExist(err) {
+		t.Errorf("Expected %s to be removed, err: %v", staged, err)
+	}
+	if data, _ := ioutil.ReadFile(target.fqn(bucket, "staged.jpg", true)); string(data) != "staged" {
+		t.Errorf("Unexpected staged object %q", data)
+	}
+
+	if _, err = parseImportMsg(&ActionMsg{Action: ActImport, Value: map[string]interface{}{"dir": "relative"}}); err == nil {
+		t.Error("Expected relative import directory to be invalid")
+	}
+}
@@ -0,0 +1,114 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// ============================= Background ==================================
+// A daemon serves clients on its public network (DirectURL). Optionally,
+// intra-cluster traffic goes over separate networks, each with its own
+// listener and URL in the cluster map:
+//   * control plane (IntraControlURL): keepalives, metasync, elections,
+//     registration and proxy => target calls on behalf of the clients
+//   * data plane (IntraDataURL): rebalance, replication, import and other
+//     target => target transfers
+// A network that is not configured falls back to the public one, and so do
+// the callers when the callee does not advertise the network.
+// ============================= Background ==================================
+
+// controlURL returns the URL for intra-cluster control-plane calls
+func (si *daemonInfo) controlURL() string {
+	if si.IntraControlURL != "" {
+		return si.IntraControlURL
+	}
+	return si.DirectURL
+}
+
+// dataURL returns the URL for intra-cluster data transfers
+func (si *daemonInfo) dataURL() string {
+	if si.IntraDataURL != "" {
+		return si.IntraDataURL
+	}
+	return si.DirectURL
+}
+
+// intraAddrs returns the listening addresses of the daemon's intra-cluster
+// networks, control and data planes sharing one when configured the same;
+// the public listener serves the listening address behind NAT (see external.go)
+func (si *daemonInfo) intraAddrs() (addrs []string) {
+	for _, rawurl := range []string{si.IntraControlURL, si.IntraDataURL} {
+		if rawurl == "" {
+			continue
+		}
+		u, err := url.Parse(rawurl)
+		if err != nil || u.Port() == si.DaemonPort || (len(addrs) > 0 && addrs[0] == u.Host) {
+			continue
+		}
+		addrs = append(addrs, u.Host)
+	}
+	return
+}
+
+// sameNetworks returns true if the two describe the same daemon's addresses
+func (si *daemonInfo) sameNetworks(other *daemonInfo) bool {
+	return si.NodeIPAddr == other.NodeIPAddr && si.DaemonPort == other.DaemonPort && si.DirectURL == other.DirectURL &&
+		si.IntraControlURL == other.IntraControlURL && si.IntraDataURL == other.IntraDataURL
+}
+
+// intraURL returns the URL of the daemon on the intra-cluster network,
+// "" if the network is not configured
+func intraURL(proto string, cnf *intranetcnf, publicIP string) (intraurl string, errstr string) {
+	if cnf.Port == "" {
+		return "", ""
+	}
+	if cnf.Addrs == "" {
+		return daemonURL(proto, publicIP, cnf.Port), ""
+	}
+	addrlist, err := getLocalIPList(ctx.config.Net.Family)
+	if err != nil {
+		return "", err.Error()
+	}
+	ipaddr, errstr := selectConfiguredIP(addrlist, cnf.Addrs)
+	if errstr != "" {
+		return
+	}
+	return daemonURL(proto, ipaddr, cnf.Port), ""
+}
+
+func validateIntraNets(netcnf *netconfig) error {
+	for _, intra := range []struct {
+		name string
+		cnf  *intranetcnf
+	}{{"intra_control", &netcnf.IntraControl}, {"intra_data", &netcnf.IntraData}} {
+		if intra.cnf.Port == "" {
+			if intra.cnf.Addrs != "" {
+				return fmt.Errorf("Invalid %s network: addresses %s without a port", intra.name, intra.cnf.Addrs)
+			}
+			continue
+		}
+		if !validPort(intra.cnf.Port) {
+			return fmt.Errorf("Invalid %s port: %s", intra.name, intra.cnf.Port)
+		}
+		if intra.cnf.Port == netcnf.L4.Port || inPortRange(intra.cnf.Port, netcnf.L4.Port) {
+			return fmt.Errorf("Invalid %s port: %s is a public port", intra.name, intra.cnf.Port)
+		}
+		for _, ip := range strings.Split(intra.cnf.Addrs, ",") {
+			if intra.cnf.Addrs != "" && net.ParseIP(strings.TrimSpace(ip)) == nil {
+				return fmt.Errorf("Invalid %s address: %s", intra.name, ip)
+			}
+		}
+	}
+	control, data := &netcnf.IntraControl, &netcnf.IntraData
+	if control.Port != "" && control.Port == data.Port && control.Addrs != data.Addrs {
+		return fmt.Errorf("Invalid intra_control and intra_data networks: same port %s, different addresses", control.Port)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIntraURLs(t *testing.T) {
+	si := &daemonInfo{DirectURL: "http://10.0.0.1:8080"}
+	if si.controlURL() != si.DirectURL || si.dataURL() != si.DirectURL || si.intraAddrs() != nil {
+		t.Errorf("Expected the public network only, got %q, %q, %v", si.controlURL(), si.dataURL(), si.intraAddrs())
+	}
+	si.IntraControlURL = "http://10.1.0.1:9080"
+	si.IntraDataURL = "http://10.2.0.1:10080"
+	if si.controlURL() != si.IntraControlURL || si.dataURL() != si.IntraDataURL {
+		t.Errorf("Expected the intra-cluster networks, got %q, %q", si.controlURL(), si.dataURL())
+	}
+	if addrs := si.intraAddrs(); !reflect.DeepEqual(addrs, []string{"10.1.0.1:9080", "10.2.0.1:10080"}) {
+		t.Errorf("Unexpected listening addresses %v", addrs)
+	}
+	si.IntraDataURL = "http://[fd00::1]:9080"
+	si.IntraControlURL = si.IntraDataURL
+	if addrs := si.intraAddrs(); !reflect.DeepEqual(addrs, []string{"[fd00::1]:9080"}) {
+		t.Errorf("Expected a shared listening address, got %v", addrs)
+	}
+	// behind NAT, the listening address is served by the public listener
+	si.DaemonPort = "8080"
+	si.IntraControlURL, si.IntraDataURL = "http://172.17.0.2:8080", "http://172.17.0.2:8080"
+	if addrs := si.intraAddrs(); addrs != nil {
+		t.Errorf("Expected no intra-cluster listeners, got %v", addrs)
+	}
+}
+
+func TestSameNetworks(t *testing.T) {
+	si := &daemonInfo{NodeIPAddr: "10.0.0.1", DaemonPort: "8080", IntraDataURL: "http://10.2.0.1:10080"}
+	other := *si
+	if !si.sameNetworks(&other) {
+		t.Error("Expected the same networks")
+	}
+	other.IntraDataURL = ""
+	if si.sameNetworks(&other) {
+		t.Error("Expected the data network to differ")
+	}
+}
+
+func TestValidateIntraNets(t *testing.T) {
+	for _, test := range []struct {
+		control, data intranetcnf
+		ok            bool
+	}{
+		{intranetcnf{}, intranetcnf{}, true},
+		{intranetcnf{Port: "9080"}, intranetcnf{Addrs: "10.2.0.1, 10.2.0.2", Port: "10080"}, true},
+		{intranetcnf{Addrs: "fd00::1", Port: "9080"}, intranetcnf{Addrs: "fd00::1", Port: "9080"}, true},
+		{intranetcnf{Addrs: "10.1.0.1"}, intranetcnf{}, false},
+		{intranetcnf{Port: "8080"}, intranetcnf{}, false},
+		{intranetcnf{}, intranetcnf{Port: "port"}, false},
+		{intranetcnf{}, intranetcnf{Port: "70000"}, false},
+		{intranetcnf{Addrs: "10.1.0", Port: "9080"}, intranetcnf{}, false},
+		{intranetcnf{Addrs: "10.1.0.1", Port: "9080"}, intranetcnf{Addrs: "10.2.0.1", Port: "9080"}, false},
+	} {
+		netcnf := &netconfig{L4: l4cnf{Port: "8080"}, IntraControl: test.control, IntraData: test.data}
+		if err := validateIntraNets(netcnf); (err == nil) != test.ok {
+			t.Errorf("%+v, %+v: expected ok=%t, got err: %v", test.control, test.data, test.ok, err)
+		}
+	}
+}
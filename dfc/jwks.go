@@ -0,0 +1,208 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/NVIDIA/dfcpub/3rdparty/glog"
+)
+
+// Asymmetric token signing. AuthN can sign tokens with a private key (RS256
+// or ES256) and publish the public keys as a JSON Web Key Set; proxies and
+// targets fetch the set from AuthN (auth.authn_url) and verify tokens with
+// the key the token header "kid" refers to, so the HMAC secret does not
+// have to be distributed. The set is re-fetched when a token refers to an
+// unknown key, e.g, after the key rotation, but not more often than
+// jwksRefetchInterval.
+
+const (
+	jwksPath            = "/" + Rversion + "/jwks"
+	jwksRequestTimeout  = 10 * time.Second
+	jwksRefetchInterval = time.Minute
+)
+
+type (
+	// JWK is a public key in JSON Web Key format (RFC 7517)
+	JWK struct {
+		Kty string `json:"kty"`
+		Kid string `json:"kid"`
+		Alg string `json:"alg,omitempty"`
+		Use string `json:"use,omitempty"`
+		// RSA
+		N string `json:"n,omitempty"`
+		E string `json:"e,omitempty"`
+		// EC
+		Crv string `json:"crv,omitempty"`
+		X   string `json:"x,omitempty"`
+		Y   string `json:"y,omitempty"`
+	}
+
+	// JWKSet is a set of public keys that verify tokens
+	JWKSet struct {
+		Keys []*JWK `json:"keys"`
+	}
+
+	jwksCache struct {
+		sync.Mutex
+		keys    map[string]crypto.PublicKey // kid -> key
+		fetched time.Time
+	}
+)
+
+var authnKeys = &jwksCache{keys: make(map[string]crypto.PublicKey)}
+
+// NewJWK returns the public key in JWK format. Supported keys: RSA, and
+// ECDSA with P-256 curve
+func NewJWK(kid, alg string, pub crypto.PublicKey) (*JWK, error) {
+	enc := base64.RawURLEncoding
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		return &JWK{
+			Kty: "RSA",
+			Kid: kid,
+			Alg: alg,
+			Use: "sig",
+			N:   enc.EncodeToString(key.N.Bytes()),
+			E:   enc.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}, nil
+	case *ecdsa.PublicKey:
+		if key.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("Unsupported curve %s", key.Curve.Params().Name)
+		}
+		// coordinates are padded to the curve size
+		size := (key.Curve.Params().BitSize + 7) / 8
+		x, y := make([]byte, size), make([]byte, size)
+		xb, yb := key.X.Bytes(), key.Y.Bytes()
+		copy(x[size-len(xb):], xb)
+		copy(y[size-len(yb):], yb)
+		return &JWK{
+			Kty: "EC",
+			Kid: kid,
+			Alg: alg,
+			Use: "sig",
+			Crv: "P-256",
+			X:   enc.EncodeToString(x),
+			Y:   enc.EncodeToString(y),
+		}, nil
+	default:
+		return nil, fmt.Errorf("Unsupported public key type %T", pub)
+	}
+}
+
+// PublicKey decodes the public key
+func (k *JWK) PublicKey() (crypto.PublicKey, error) {
+	dec := func(s string) (*big.Int, error) {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil || len(b) == 0 {
+			return nil, fmt.Errorf("Invalid key %s: bad encoding", k.Kid)
+		}
+		return new(big.Int).SetBytes(b), nil
+	}
+	switch k.Kty {
+	case "RSA":
+		n, err := dec(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := dec(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > int64(^uint32(0)>>1) {
+			return nil, fmt.Errorf("Invalid key %s: bad exponent", k.Kid)
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("Invalid key %s: unsupported curve %s", k.Kid, k.Crv)
+		}
+		x, err := dec(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := dec(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !elliptic.P256().IsOnCurve(x, y) {
+			return nil, fmt.Errorf("Invalid key %s: the point is not on the curve", k.Kid)
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("Invalid key %s: unsupported key type %s", k.Kid, k.Kty)
+	}
+}
+
+// get returns the public key with the ID, fetching the key set from AuthN
+// if the key is unknown
+func (c *jwksCache) get(kid string) (crypto.PublicKey, error) {
+	c.Lock()
+	defer c.Unlock()
+	if key, ok := c.keys[kid]; ok {
+		return key, nil
+	}
+	if ctx.config.Auth.AuthnURL == "" {
+		return nil, fmt.Errorf("Unknown key %q: AuthN URL is not defined", kid)
+	}
+	if time.Since(c.fetched) < jwksRefetchInterval {
+		return nil, fmt.Errorf("Unknown key %q", kid)
+	}
+	c.fetched = time.Now()
+	keys, err := fetchJWKS(ctx.config.Auth.AuthnURL)
+	if err != nil {
+		return nil, fmt.Errorf("Unknown key %q: %v", kid, err)
+	}
+	c.keys = keys
+	if key, ok := c.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("Unknown key %q", kid)
+}
+
+func fetchJWKS(authnURL string) (map[string]crypto.PublicKey, error) {
+	reqURL := strings.TrimSuffix(authnURL, "/") + jwksPath
+	client := &http.Client{Timeout: jwksRequestTimeout}
+	r, err := client.Get(reqURL)
+	if err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read %s: %v", reqURL, err)
+	}
+	if r.StatusCode >= http.StatusBadRequest {
+		return nil, fmt.Errorf("Failed to read %s: status %d", reqURL, r.StatusCode)
+	}
+	set := &JWKSet{}
+	if err = json.Unmarshal(b, set); err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal %s: %v", reqURL, err)
+	}
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		key, err := jwk.PublicKey()
+		if err != nil {
+			glog.Errorf("Skipping key from %s: %v", reqURL, err)
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	glog.Infof("Fetched %d token verification keys from %s", len(keys), reqURL)
+	return keys, nil
+}
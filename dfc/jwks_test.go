@@ -0,0 +1,101 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ */
+package dfc
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestAsymmetricTokens(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	set := &JWKSet{}
+	for kid, pub := range map[string]crypto.PublicKey{"rsa1": &rsaKey.PublicKey, "ec1": &ecKey.PublicKey} {
+		jwk, err := NewJWK(kid, "", pub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	fetches := 0
+	authn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		jsbytes, _ := json.Marshal(set)
+		w.Write(jsbytes)
+	}))
+	defer authn.Close()
+
+	oldauth, oldkeys := ctx.config.Auth, authnKeys
+	defer func() { ctx.config.Auth, authnKeys = oldauth, oldkeys }()
+	ctx.config.Auth.Secret = ""
+	ctx.config.Auth.AuthnURL = authn.URL
+	authnKeys = &jwksCache{keys: make(map[string]crypto.PublicKey)}
+
+	issued := time.Now()
+	sign := func(method jwt.SigningMethod, kid string, key interface{}) string {
+		token := jwt.NewWithClaims(method, jwt.MapClaims{
+			"issued":   issued.Format(time.RFC822),
+			"expires":  issued.Add(time.Hour).Format(time.RFC822),
+			"username": "user",
+		})
+		token.Header["kid"] = kid
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatalf("Failed to sign token: %v", err)
+		}
+		return signed
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tcs := []struct {
+		name  string
+		token string
+		valid bool
+	}{
+		{"RS256", sign(jwt.SigningMethodRS256, "rsa1", rsaKey), true},
+		{"ES256", sign(jwt.SigningMethodES256, "ec1", ecKey), true},
+		{"wrong key", sign(jwt.SigningMethodRS256, "rsa1", otherKey), false},
+		{"key of another type", sign(jwt.SigningMethodRS256, "ec1", rsaKey), false},
+		{"unknown key", sign(jwt.SigningMethodRS256, "rsa2", rsaKey), false},
+		// no secret - HMAC is disabled
+		{"HS256", sign(jwt.SigningMethodHS256, "", []byte("")), false},
+	}
+	for _, tc := range tcs {
+		if _, err := decryptToken(tc.token); (err == nil) != tc.valid {
+			t.Errorf("%s: expected valid=%t, err: %v", tc.name, tc.valid, err)
+		}
+	}
+	// the unknown key does not make every token refetch the key set
+	if fetches != 1 {
+		t.Errorf("Expected the key set to be fetched once, fetched %d times", fetches)
+	}
+
+	for _, jwk := range set.Keys {
+		if _, err := jwk.PublicKey(); err != nil {
+			t.Errorf("Failed to decode key %s: %v", jwk.Kid, err)
+		}
+	}
+	if _, err := (&JWK{Kty: "EC", Kid: "bad", Crv: "P-256", X: "AQ", Y: "AQ"}).PublicKey(); err == nil {
+		t.Error("Invalid EC key was decoded")
+	}
+}
@@ -8,6 +8,7 @@ package dfc
 import (
 	"fmt"
 	"net/http"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -43,12 +44,16 @@ type kalive struct {
 
 type proxykalive struct {
 	kalive
-	p *proxyrunner
+	p          *proxyrunner
+	suspicions suspicions // gossip reports (see gossip.go)
 }
 
 type targetkalive struct {
 	kalive
-	t *targetrunner
+	t          *targetrunner
+	gossipMtx  sync.Mutex
+	gossip     *gossiper
+	registered time.Time // last registered with the primary
 }
 
 // KeepaliveTracker defines the interface for keep alive tracking.
@@ -95,6 +100,9 @@ func newtargetkalive(t *targetrunner) *targetkalive {
 		&t.statsdC,
 	)
 	k.interval = ctx.config.KeepaliveTracker.Target.Interval
+	if ctx.config.KeepaliveTracker.Gossip.Enabled {
+		k.interval = ctx.config.KeepaliveTracker.Gossip.Interval
+	}
 	return k
 }
 
@@ -251,13 +259,14 @@ func (r *proxykalive) primaryLiveAndSync(checkProxies bool) (stopped, repeat, no
 			nonprimary = true
 			return
 		}
-		if !r.timedOut(sid) {
+		if !r.failing(sid, checkProxies) {
 			continue
 		}
-		url := si.DirectURL + URLPath(Rversion, Rhealth)
+		url := si.controlURL() + URLPath(Rversion, Rhealth)
 		url += from
 		res := r.p.call(nil, si, url, http.MethodGet, nil, kalivetimeout)
 		if res.err == nil {
+			r.suspicions.clear(sid)
 			continue
 		}
 
@@ -269,6 +278,7 @@ func (r *proxykalive) primaryLiveAndSync(checkProxies bool) (stopped, repeat, no
 			return
 		}
 		if responded {
+			r.suspicions.clear(sid)
 			continue
 		}
 
@@ -394,10 +404,18 @@ func (r *targetkalive) keepalive(err error) (stopped bool) {
 	if err != nil {
 		glog.Infof("target %s keepalive triggered by err %v", r.t.si.DaemonID, err)
 	}
+	if ctx.config.KeepaliveTracker.Gossip.Enabled && err == nil {
+		r.gossipRound()
+		if time.Since(r.registered) < ctx.config.KeepaliveTracker.Gossip.PrimaryInterval {
+			return
+		}
+	}
 
 	stopped = keepaliveCommon(r.t, r.controlCh)
 	if stopped {
 		r.t.onPrimaryProxyFailure()
+	} else {
+		r.registered = time.Now()
 	}
 
 	return stopped
@@ -0,0 +1,95 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"golang.org/x/oauth2/google"
+	cloudkms "google.golang.org/api/cloudkms/v1"
+)
+
+// Cloud KMS secrets providers.
+// A KMS does not keep secrets, it keeps the keys that encrypt them. The
+// secrets are kept in a JSON file (the "path" of the secrets config) with
+// name-value pairs, each value base64-encoded ciphertext as produced by
+// `aws kms encrypt` or `gcloud kms encrypt`; the file is safe to distribute
+// to every node. At load time each value is decrypted with the KMS. For
+// AWS KMS the ciphertext identifies its key, "url" is the optional region;
+// for GCP KMS "url" is the resource name of the key:
+// projects/<project>/locations/<location>/keyRings/<ring>/cryptoKeys/<key>.
+// Credentials are the default ones of the SDKs: environment, shared config
+// files or the instance role.
+
+type kmsDecrypter func(ciphertext []byte) ([]byte, error)
+
+// Reads the file of encrypted secrets and decrypts each value
+func decryptSecrets(path string, decrypt kmsDecrypter) (map[string]string, error) {
+	encrypted := make(map[string]string)
+	if err := LocalLoad(path, &encrypted); err != nil {
+		return nil, fmt.Errorf("Failed to load encrypted secrets from %s: %v", path, err)
+	}
+	secrets := make(map[string]string, len(encrypted))
+	for name, value := range encrypted {
+		ciphertext, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid encrypted secret %s: %v", name, err)
+		}
+		plain, err := decrypt(ciphertext)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to decrypt secret %s: %v", name, err)
+		}
+		secrets[name] = string(plain)
+	}
+	return secrets, nil
+}
+
+func fetchAWSKMSSecrets(region, path string) (map[string]string, error) {
+	opts := session.Options{SharedConfigState: session.SharedConfigEnable}
+	if region != "" {
+		opts.Config.Region = aws.String(region)
+	}
+	sess, err := session.NewSessionWithOptions(opts)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create AWS session: %v", err)
+	}
+	svc := kms.New(sess)
+	return decryptSecrets(path, func(ciphertext []byte) ([]byte, error) {
+		out, err := svc.Decrypt(&kms.DecryptInput{CiphertextBlob: ciphertext})
+		if err != nil {
+			return nil, err
+		}
+		return out.Plaintext, nil
+	})
+}
+
+func fetchGCPKMSSecrets(keyName, path string) (map[string]string, error) {
+	if keyName == "" {
+		return nil, fmt.Errorf("GCP KMS key name is not defined")
+	}
+	client, err := google.DefaultClient(context.Background(), cloudkms.CloudPlatformScope)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get GCP credentials: %v", err)
+	}
+	svc, err := cloudkms.New(client)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create GCP KMS client: %v", err)
+	}
+	keys := svc.Projects.Locations.KeyRings.CryptoKeys
+	return decryptSecrets(path, func(ciphertext []byte) ([]byte, error) {
+		req := &cloudkms.DecryptRequest{Ciphertext: base64.StdEncoding.EncodeToString(ciphertext)}
+		resp, err := keys.Decrypt(keyName, req).Do()
+		if err != nil {
+			return nil, err
+		}
+		return base64.StdEncoding.DecodeString(resp.Plaintext)
+	})
+}
@@ -0,0 +1,101 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"container/heap"
+	"sort"
+)
+
+// ============================= Background ==================================
+// Every target returns its own page of up to pageSize objects sorted by name,
+// all past the requested marker. The proxy k-way merges the pages into one:
+//   * an object found on two targets (e.g., while being rebalanced) is
+//     listed once
+//   * a target that sets its page marker may have more objects past it, so
+//     the merged page never goes beyond the smallest such marker - otherwise
+//     the objects in between would be skipped by the next page
+//   * the page marker is set only if there is more to list, so a bucket of
+//     exactly pageSize objects is listed with a single page
+// ============================= Background ==================================
+
+// entryCursors is a min-heap of the remaining entries of sorted target pages
+type entryCursors [][]*BucketEntry
+
+func (h entryCursors) Len() int            { return len(h) }
+func (h entryCursors) Less(i, j int) bool  { return h[i][0].Name < h[j][0].Name }
+func (h entryCursors) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *entryCursors) Push(x interface{}) { *h = append(*h, x.([]*BucketEntry)) }
+func (h *entryCursors) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
+
+// next removes and returns the smallest entry
+func (h *entryCursors) next() *BucketEntry {
+	entries := (*h)[0]
+	if len(entries) > 1 {
+		(*h)[0] = entries[1:]
+		heap.Fix(h, 0)
+	} else {
+		heap.Pop(h)
+	}
+	return entries[0]
+}
+
+// mergeBucketLists merges the target pages into a page of up to pageSize objects
+func mergeBucketLists(lists []*BucketList, pageSize int) *BucketList {
+	var (
+		h        = make(entryCursors, 0, len(lists))
+		prefixes = make(map[string]bool)
+		bound    string // the smallest page marker of the targets
+		merged   = &BucketList{Entries: make([]*BucketEntry, 0, pageSize)}
+	)
+	for _, list := range lists {
+		for _, prefix := range list.CommonPrefixes {
+			prefixes[prefix] = true
+		}
+		if len(list.Entries) == 0 {
+			continue
+		}
+		entries := list.Entries
+		if !sort.SliceIsSorted(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name }) {
+			sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+		}
+		if list.PageMarker != "" && (bound == "" || list.PageMarker < bound) {
+			bound = list.PageMarker
+		}
+		h = append(h, entries)
+	}
+	heap.Init(&h)
+
+	last := ""
+	for h.Len() > 0 {
+		if bound != "" && h[0][0].Name > bound {
+			break
+		}
+		entry := h.next()
+		if len(merged.Entries) > 0 && entry.Name == last {
+			continue
+		}
+		if len(merged.Entries) == pageSize {
+			// there is at least one more object
+			merged.PageMarker = last
+			break
+		}
+		merged.Entries = append(merged.Entries, entry)
+		last = entry.Name
+	}
+	if bound != "" && merged.PageMarker == "" && len(merged.Entries) > 0 {
+		// a target has more objects past the bound
+		merged.PageMarker = last
+	}
+	merged.CommonPrefixes = pagePrefixes(prefixes, merged.PageMarker)
+	return merged
+}
@@ -0,0 +1,129 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// targetPage lists the objects of a target the way the target does: sorted,
+// past the marker, and up to limit objects with the page marker set if the
+// target has more
+func targetPage(objects []string, marker string, limit int) *BucketList {
+	list := &BucketList{}
+	for _, name := range objects {
+		if name <= marker {
+			continue
+		}
+		if len(list.Entries) == limit {
+			list.PageMarker = list.Entries[limit-1].Name
+			break
+		}
+		list.Entries = append(list.Entries, &BucketEntry{Name: name})
+	}
+	return list
+}
+
+// listAll pages through the bucket and returns all listed names
+func listAll(t *testing.T, targets [][]string, limits []int, pageSize int) (names []string, pages int) {
+	marker := ""
+	for {
+		lists := make([]*BucketList, len(targets))
+		for i, objects := range targets {
+			lists[i] = targetPage(objects, marker, limits[i])
+		}
+		// the order of the replies is random
+		rand.Shuffle(len(lists), func(i, j int) { lists[i], lists[j] = lists[j], lists[i] })
+		page := mergeBucketLists(lists, pageSize)
+		if len(page.Entries) > pageSize {
+			t.Fatalf("Page of %d entries exceeds page size %d", len(page.Entries), pageSize)
+		}
+		pages++
+		for _, e := range page.Entries {
+			names = append(names, e.Name)
+		}
+		if page.PageMarker == "" {
+			return
+		}
+		if page.PageMarker != page.Entries[len(page.Entries)-1].Name {
+			t.Fatalf("Page marker %q is not the last entry %q", page.PageMarker, page.Entries[len(page.Entries)-1].Name)
+		}
+		marker = page.PageMarker
+	}
+}
+
+func TestMergeBucketLists(t *testing.T) {
+	rnd := rand.New(rand.NewSource(42))
+	for iter := 0; iter < 500; iter++ {
+		var (
+			numTargets = 1 + rnd.Intn(5)
+			numObjects = rnd.Intn(200)
+			pageSize   = 1 + rnd.Intn(50)
+			capped     = rnd.Intn(2) == 0 // targets may return fewer objects than asked for
+			targets    = make([][]string, numTargets)
+			limits     = make([]int, numTargets)
+			expected   = make([]string, 0, numObjects)
+		)
+		for i := 0; i < numObjects; i++ {
+			name := fmt.Sprintf("obj-%05d", rnd.Intn(100000))
+			idx := rnd.Intn(numTargets)
+			targets[idx] = append(targets[idx], name)
+			if rnd.Intn(10) == 0 {
+				// being rebalanced: found on two targets
+				targets[(idx+1)%numTargets] = append(targets[(idx+1)%numTargets], name)
+			}
+			expected = append(expected, name)
+		}
+		for i := range targets {
+			sort.Strings(targets[i])
+			targets[i] = uniqueStrings(targets[i])
+			limits[i] = pageSize
+			if capped {
+				limits[i] = 1 + rnd.Intn(pageSize)
+			}
+		}
+		sort.Strings(expected)
+		expected = uniqueStrings(expected)
+
+		names, pages := listAll(t, targets, limits, pageSize)
+		if len(names) != len(expected) || (len(names) > 0 && !reflect.DeepEqual(names, expected)) {
+			t.Fatalf("Iteration %d (%d targets, page size %d, capped %t): listed %d objects, expected %d",
+				iter, numTargets, pageSize, capped, len(names), len(expected))
+		}
+		if minPages := (len(expected) + pageSize - 1) / pageSize; !capped && pages != minPages && !(minPages == 0 && pages == 1) {
+			t.Fatalf("Iteration %d: listed %d objects of page size %d in %d pages, expected %d",
+				iter, len(expected), pageSize, pages, minPages)
+		}
+	}
+}
+
+func TestMergeBucketListsPrefixes(t *testing.T) {
+	lists := []*BucketList{
+		{Entries: []*BucketEntry{{Name: "a"}, {Name: "c"}}, PageMarker: "c", CommonPrefixes: []string{"b/"}},
+		{Entries: []*BucketEntry{{Name: "e"}}, CommonPrefixes: []string{"d/"}},
+	}
+	page := mergeBucketLists(lists, 10)
+	if page.PageMarker != "c" || len(page.Entries) != 2 || !reflect.DeepEqual(page.CommonPrefixes, []string{"b/"}) {
+		t.Errorf("Unexpected page %+v", page)
+	}
+}
+
+func uniqueStrings(list []string) []string {
+	if len(list) < 2 {
+		return list
+	}
+	last := 0
+	for i := 1; i < len(list); i++ {
+		if list[i] != list[last] {
+			last++
+			list[last] = list[i]
+		}
+	}
+	return list[:last+1]
+}
@@ -49,16 +49,17 @@ type xactDeleteEvict struct {
 //
 //===========================
 
-func (t *targetrunner) getListFromRangeCloud(ct context.Context, bucket string, msg *GetMsg) (bucketList *BucketList, err error) {
+func (t *targetrunner) getListFromRangeCloud(ct context.Context, bucket string, msg *GetMsg) (bucketList *BucketList, pages int, err error) {
 	bucketList = &BucketList{Entries: make([]*BucketEntry, 0)}
 	for i := 0; i < maxPrefetchPages; i++ {
-		jsbytes, errstr, errcode := getcloudif().listbucket(ct, bucket, msg)
-		if errstr != "" {
-			return nil, fmt.Errorf("Error listing cloud bucket %s: %d(%s)", bucket, errcode, errstr)
+		jsbytes, cerr := t.cloudif.listbucket(ct, bucket, msg)
+		pages++
+		if cerr != nil {
+			return nil, pages, fmt.Errorf("Error listing cloud bucket %s: %d(%s)", bucket, cerr.Status, cerr.Message)
 		}
 		reslist := &BucketList{}
 		if err := json.Unmarshal(jsbytes, reslist); err != nil {
-			return nil, fmt.Errorf("Error unmarshalling BucketList: %v", err)
+			return nil, pages, fmt.Errorf("Error unmarshalling BucketList: %v", err)
 		}
 		bucketList.Entries = append(bucketList.Entries, reslist.Entries...)
 		if reslist.PageMarker == "" {
@@ -73,39 +74,57 @@ func (t *targetrunner) getListFromRangeCloud(ct context.Context, bucket string,
 }
 
 func (t *targetrunner) getListFromRange(ct context.Context, bucket, prefix, regex string, min, max int64) ([]string, error) {
+	entries, _, err := t.getEntriesFromRange(ct, bucket, prefix, regex, min, max)
+	if err != nil {
+		return nil, err
+	}
+	objs := make([]string, 0, len(entries))
+	for _, be := range entries {
+		objs = append(objs, be.Name)
+	}
+	return objs, nil
+}
+
+// getEntriesFromRange returns the entries of the range owned by this target
+// and the number of cloud list pages it took to get them
+func (t *targetrunner) getEntriesFromRange(ct context.Context, bucket, prefix, regex string,
+	min, max int64) (entries []*BucketEntry, pages int, err error) {
 	msg := &GetMsg{GetPrefix: prefix}
-	var (
-		fullbucketlist *BucketList
-		err            error
-	)
+	var fullbucketlist *BucketList
 	islocal := t.bmdowner.get().islocal(bucket)
 	if islocal {
 		fullbucketlist, err = t.prepareLocalObjectList(bucket, msg)
 	} else {
-		fullbucketlist, err = t.getListFromRangeCloud(ct, bucket, msg)
+		msg.GetProps = GetPropsSize
+		fullbucketlist, pages, err = t.getListFromRangeCloud(ct, bucket, msg)
 	}
 	if err != nil {
-		return nil, err
+		return nil, pages, err
 	}
 
-	objs := make([]string, 0)
+	entries = make([]*BucketEntry, 0)
 	re, err := regexp.Compile(regex)
 	if err != nil {
-		return nil, fmt.Errorf("Could not compile regex: %v", err)
+		return nil, pages, fmt.Errorf("Could not compile regex: %v", err)
 	}
 	for _, be := range fullbucketlist.Entries {
 		if !acceptRegexRange(be.Name, prefix, re, min, max) {
 			continue
 		}
-		if si, errstr := HrwTarget(bucket, be.Name, t.smapowner.get()); si == nil || si.DaemonID == t.si.DaemonID {
+		// local objects are placed by their placement group, if any
+		name := be.Name
+		if islocal {
+			name = t.placementName(t.fqn(bucket, be.Name, islocal), be.Name)
+		}
+		if si, errstr := HrwTarget(bucket, name, t.smapowner.get()); si == nil || si.DaemonID == t.si.DaemonID {
 			if errstr != "" {
-				return nil, fmt.Errorf(errstr)
+				return nil, pages, fmt.Errorf(errstr)
 			}
-			objs = append(objs, be.Name)
+			entries = append(entries, be)
 		}
 	}
 
-	return objs, nil
+	return entries, pages, nil
 }
 
 func acceptRegexRange(name, prefix string, regex *regexp.Regexp, min, max int64) bool {
@@ -483,6 +502,18 @@ func parseRangeListMsgBase(jsmap map[string]interface{}) (pmb *RangeListMsgBase,
 		}
 		pmb.Wait = wait
 	}
+	for _, flag := range []struct {
+		name string
+		v    *bool
+	}{{"plan", &pmb.Plan}, {"confirm", &pmb.Confirm}} {
+		if v, ok := jsmap[flag.name]; ok {
+			b, ok := v.(bool)
+			if !ok {
+				return pmb, fmt.Sprintf("%s (%s: %v, %T)", s, flag.name, v, v)
+			}
+			*flag.v = b
+		}
+	}
 	return
 }
 
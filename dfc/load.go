@@ -0,0 +1,160 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/NVIDIA/dfcpub/3rdparty/glog"
+)
+
+// Load reporting. With every keepalive a target reports its load to the
+// primary proxy: disk utilization and queue sizes (as computed by iostat over
+// the stats interval) and network throughput since the previous keepalive,
+// as well as the state of its mountpaths and its request and error counters.
+// The primary keeps the last report of each target, exposes the cluster load
+// view, along with the probe SLIs, via GET /v1/cluster?what=load and evaluates
+// alerting rules against it.
+
+// TargetLoad is the load of a target as of its last keepalive
+type TargetLoad struct {
+	Time        time.Time          `json:"time"`
+	DiskUtil    map[string]float64 `json:"disk_util"`  // device => busy %
+	DiskQueue   map[string]float64 `json:"disk_queue"` // device => average queue size
+	NetRxMBps   float64            `json:"net_rx_mbps"`
+	NetTxMBps   float64            `json:"net_tx_mbps"`
+	Capacity    map[string]uint32  `json:"capacity"`               // mountpath => used %
+	Offline     []string           `json:"offline,omitempty"`      // offline mountpaths
+	Requests    int64              `json:"requests"`               // total since the target started or its stats were reset
+	Errors      int64              `json:"errors"`                 // ditto
+	CloudEgress map[string]int64   `json:"cloud_egress,omitempty"` // bucket => bytes fetched from the Cloud since the target started
+}
+
+// ClusterLoad is the aggregated load of the cluster's targets
+type ClusterLoad struct {
+	Targets     map[string]*TargetLoad `json:"targets"`
+	MaxDiskUtil float64                `json:"max_disk_util"`
+	NetRxMBps   float64                `json:"net_rx_mbps"`
+	NetTxMBps   float64                `json:"net_tx_mbps"`
+	Probes      map[string]*ProbeSLI   `json:"probes,omitempty"` // see probe.go
+}
+
+// keepaliveMsg is the body of the keepalive request: the daemon's info and,
+// for targets, their load
+type keepaliveMsg struct {
+	daemonInfo
+	Load *TargetLoad `json:"load,omitempty"`
+}
+
+// netsample is the network counters of the target as of its last keepalive
+type netsample struct {
+	rx, tx int64
+	time   time.Time
+}
+
+// load returns the target's current load
+func (t *targetrunner) load() *TargetLoad {
+	now := time.Now()
+	load := &TargetLoad{
+		Time:      now,
+		DiskUtil:  make(map[string]float64),
+		DiskQueue: make(map[string]float64),
+		Capacity:  make(map[string]uint32),
+	}
+	if r, ok := t.statsif.(*storstatsrunner); ok {
+		r.Lock()
+		for mpath, fscapacity := range r.Capacity {
+			load.Capacity[mpath] = fscapacity.Usedpct
+		}
+		core := &r.Core
+		load.Requests = core.Numget + core.Numput + core.Numpost + core.Numdelete + core.Numrename + core.Numlist
+		load.Errors = core.Numerr
+		r.Unlock()
+	}
+	load.CloudEgress = t.cloudEgress.get()
+	ctx.mountpaths.Lock()
+	for mpath := range ctx.mountpaths.Offline {
+		load.Offline = append(load.Offline, mpath)
+	}
+	ctx.mountpaths.Unlock()
+	if riostat := getiostatrunner(); riostat != nil {
+		riostat.Lock()
+		for dev, iometrics := range riostat.Disk {
+			if util, err := strconv.ParseFloat(iometrics["%util"], 64); err == nil {
+				load.DiskUtil[dev] = util
+			}
+			// the name depends on the iostat version
+			for _, name := range []string{"aqu-sz", "avgqu-sz"} {
+				if queue, err := strconv.ParseFloat(iometrics[name], 64); err == nil {
+					load.DiskQueue[dev] = queue
+					break
+				}
+			}
+		}
+		riostat.Unlock()
+	}
+	rx, tx, err := netifBytes()
+	if err != nil {
+		glog.Errorf("Failed to read network counters, err: %v", err)
+		return load
+	}
+	if prev := t.netsample; !prev.time.IsZero() && rx >= prev.rx && tx >= prev.tx {
+		elapsed := now.Sub(prev.time)
+		load.NetRxMBps = mbps(rx-prev.rx, elapsed)
+		load.NetTxMBps = mbps(tx-prev.tx, elapsed)
+	}
+	t.netsample = netsample{rx: rx, tx: tx, time: now}
+	return load
+}
+
+// clusterLoads keeps the last load report of each target (primary proxy only)
+type clusterLoads struct {
+	sync.Mutex
+	loads map[string]*TargetLoad
+}
+
+func (c *clusterLoads) put(sid string, load *TargetLoad) {
+	c.Lock()
+	if c.loads == nil {
+		c.loads = make(map[string]*TargetLoad)
+	}
+	c.loads[sid] = load
+	c.Unlock()
+}
+
+// get returns the target's last reported load, nil if none
+func (c *clusterLoads) get(sid string) *TargetLoad {
+	c.Lock()
+	load := c.loads[sid]
+	c.Unlock()
+	return load
+}
+
+// clusterLoad aggregates the loads of the targets in the cluster map
+func (p *proxyrunner) clusterLoad() *ClusterLoad {
+	smap := p.smapowner.get()
+	cload := &ClusterLoad{Targets: make(map[string]*TargetLoad, len(smap.Tmap))}
+	for sid := range smap.Tmap {
+		load := p.loads.get(sid)
+		if load == nil {
+			continue
+		}
+		cload.Targets[sid] = load
+		for _, util := range load.DiskUtil {
+			if util > cload.MaxDiskUtil {
+				cload.MaxDiskUtil = util
+			}
+		}
+		cload.NetRxMBps += load.NetRxMBps
+		cload.NetTxMBps += load.NetTxMBps
+	}
+	if r := getproberunner(); r != nil {
+		cload.Probes = r.get()
+	}
+	return cload
+}
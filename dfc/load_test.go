@@ -0,0 +1,60 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ */
+package dfc
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestLoadReport(t *testing.T) {
+	oldrg := ctx.rg
+	defer func() { ctx.rg = oldrg }()
+	riostat := &iostatrunner{Disk: map[string]simplekvs{
+		"sda": {"%util": "42.50", "aqu-sz": "1.25"},
+		"sdb": {"%util": "90.00", "avgqu-sz": "4.00"},
+	}}
+	ctx.rg = &rungroup{runmap: map[string]runner{xiostat: riostat}}
+
+	target := &targetrunner{}
+	target.si = &daemonInfo{DaemonID: "t1", NodeIPAddr: "127.0.0.1", DirectURL: "http://127.0.0.1:8081"}
+	load := target.load()
+	if load.DiskUtil["sda"] != 42.5 || load.DiskUtil["sdb"] != 90 {
+		t.Errorf("Unexpected disk utilization %v", load.DiskUtil)
+	}
+	if load.DiskQueue["sda"] != 1.25 || load.DiskQueue["sdb"] != 4 {
+		t.Errorf("Unexpected disk queues %v", load.DiskQueue)
+	}
+
+	// the keepalive message is the daemon info with the load
+	jsbytes, err := json.Marshal(&keepaliveMsg{daemonInfo: *target.si, Load: load})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var si daemonInfo
+	if err = json.Unmarshal(jsbytes, &si); err != nil || si.DaemonID != "t1" || si.DirectURL != target.si.DirectURL {
+		t.Fatalf("Expected daemon info %+v, got %+v, err: %v", target.si, si, err)
+	}
+	var kmsg keepaliveMsg
+	if err = json.Unmarshal(jsbytes, &kmsg); err != nil || kmsg.DaemonID != "t1" || kmsg.Load == nil {
+		t.Fatalf("Unexpected keepalive message %+v, err: %v", kmsg, err)
+	}
+
+	proxy := &proxyrunner{}
+	proxy.smapowner = &smapowner{}
+	smap := newSmap()
+	smap.addTarget(target.si)
+	smap.addTarget(&daemonInfo{DaemonID: "t2"})
+	proxy.smapowner.put(smap)
+	proxy.loads.put("t1", kmsg.Load)
+	proxy.loads.put("t2", &TargetLoad{DiskUtil: map[string]float64{"sdc": 10}, NetRxMBps: 100, NetTxMBps: 50})
+	proxy.loads.put("gone", &TargetLoad{DiskUtil: map[string]float64{"sdd": 100}})
+	cload := proxy.clusterLoad()
+	if len(cload.Targets) != 2 || cload.Targets["gone"] != nil {
+		t.Errorf("Expected the load of the targets in the cluster map, got %v", cload.Targets)
+	}
+	if cload.MaxDiskUtil != 90 || cload.NetRxMBps != 100+load.NetRxMBps || cload.NetTxMBps != 50+load.NetTxMBps {
+		t.Errorf("Unexpected cluster load %+v", cload)
+	}
+}
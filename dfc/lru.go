@@ -164,7 +164,13 @@ func (lctx *lructx) lruwalkfn(fqn string, osfi os.FileInfo, err error) error {
 	} else if mtime.After(atime) {
 		usetime = mtime
 	}
-	now := time.Now()
+	now := lctx.t.clock.Now()
+	// pinned objects stay, expired ones go first (see objmeta.go, pin.go)
+	if meta, _ := getObjectMeta(fqn); lctx.t.pinned(fqn, meta) {
+		return nil
+	} else if meta.expired(now) {
+		usetime = time.Time{}
+	}
 	dontevictime := now.Add(-ctx.config.LRU.DontEvictTime)
 	if usetime.After(dontevictime) {
 		if glog.V(3) {
@@ -218,6 +224,9 @@ func (t *targetrunner) doLRU(toevict int64, bucketdir string, lctx *lructx) erro
 		toevict -= fi.size
 		bevicted += fi.size
 		fevicted++
+		if bucket, _, errstr := t.fqn2bckobj(fi.fqn); errstr == "" {
+			t.addBucketStats(bucket, "filesevicted", int64(1), "bytesevicted", fi.size)
+		}
 	}
 	t.statsif.add("bytesevicted", bevicted)
 	t.statsif.add("filesevicted", fevicted)
@@ -242,6 +251,7 @@ func (t *targetrunner) lruEvict(fqn string) error {
 	if err := os.Remove(fqn); err != nil {
 		return err
 	}
+	t.removeMirrors(bucket, objname, t.bmdowner.get().islocal(bucket), nil)
 	glog.Infof("LRU: evicted %s/%s", bucket, objname)
 	return nil
 }
@@ -102,3 +102,32 @@ func TestLRUBasic(t *testing.T) {
 		}
 	}
 }
+
+func TestAtimeClock(t *testing.T) {
+	lruEnabled := ctx.config.LRU.LRUEnabled
+	ctx.config.LRU.LRUEnabled = true
+	defer func() { ctx.config.LRU.LRUEnabled = lruEnabled }()
+
+	now := time.Date(2018, time.July, 1, 12, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(now)
+	// unbuffered channels: stop() returns only after touch() has been processed
+	r := &atimerunner{
+		chstop:   make(chan struct{}),
+		chfqn:    make(chan string),
+		atimemap: &atimemap{m: make(map[string]time.Time)},
+		clock:    clock,
+	}
+	r.setname("atime")
+	go r.run()
+	r.touch("/tmp/obj1")
+	clock.Advance(time.Hour)
+	r.touch("/tmp/obj2")
+	r.stop(nil)
+
+	if atime, ok := r.atime("/tmp/obj1"); !ok || !atime.Equal(now) {
+		t.Errorf("Expected atime %v, got %v (cached: %v)", now, atime, ok)
+	}
+	if atime, ok := r.atime("/tmp/obj2"); !ok || !atime.Equal(now.Add(time.Hour)) {
+		t.Errorf("Expected atime %v, got %v (cached: %v)", now.Add(time.Hour), atime, ok)
+	}
+}
@@ -0,0 +1,205 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+// Metadata response cache (proxy).
+// The proxy redirects HEAD bucket and HEAD object requests to targets and
+// collects the cluster statistics from all of them - dashboards and monitoring
+// that poll these calls keep loading the targets. With metacache.ttl configured,
+// the proxy performs the HEAD requests itself and keeps the responses of
+// HEAD bucket, HEAD object (including 404) and GET /v1/cluster?what=stats|xaction
+// for the TTL. The versions of the cluster map and of the bucket metadata are
+// part of the key, so that any change of either - e.g. new bucket properties -
+// stales the cached responses. In addition, the proxy drops the responses of an
+// object that is put or deleted via the proxy, of the objects of a bucket upon
+// list/range operations and object actions, and all responses upon bucket
+// actions that may change objects. Changes that bypass this proxy - made via
+// other proxies or direct-to-target clients - become visible within the TTL.
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const metaCacheMaxEntries = 10000 // default metacache.max_entries
+
+// resource of the cluster-wide responses: bucket names do not start with a slash
+const metaClusterResource = "/"
+
+type (
+	metaCache struct {
+		mtx       sync.Mutex
+		resources map[string]map[string]*metaResponse // bucket or bucket/object => variant => response
+		count     int
+	}
+	metaResponse struct {
+		status  int
+		header  http.Header
+		body    []byte
+		expires time.Time
+	}
+	// responseRecorder keeps the response of a handler for the cache
+	responseRecorder struct {
+		header http.Header
+		status int
+		body   bytes.Buffer
+	}
+)
+
+func (mc *metaCache) get(resource, variant string) *metaResponse {
+	mc.mtx.Lock()
+	defer mc.mtx.Unlock()
+	resp, ok := mc.resources[resource][variant]
+	if !ok {
+		return nil
+	}
+	if time.Now().After(resp.expires) {
+		mc.delete(resource, variant)
+		return nil
+	}
+	return resp
+}
+
+func (mc *metaCache) put(resource, variant string, resp *metaResponse, max int) {
+	mc.mtx.Lock()
+	defer mc.mtx.Unlock()
+	if mc.resources == nil {
+		mc.resources = make(map[string]map[string]*metaResponse)
+	}
+	if mc.count >= max {
+		now := time.Now()
+		for res, variants := range mc.resources {
+			for v, cached := range variants {
+				if now.After(cached.expires) {
+					mc.delete(res, v)
+				}
+			}
+		}
+		if mc.count >= max {
+			return
+		}
+	}
+	variants, ok := mc.resources[resource]
+	if !ok {
+		variants = make(map[string]*metaResponse)
+		mc.resources[resource] = variants
+	}
+	if _, ok = variants[variant]; !ok {
+		mc.count++
+	}
+	variants[variant] = resp
+}
+
+// delete is called under the lock
+func (mc *metaCache) delete(resource, variant string) {
+	variants := mc.resources[resource]
+	if _, ok := variants[variant]; !ok {
+		return
+	}
+	delete(variants, variant)
+	mc.count--
+	if len(variants) == 0 {
+		delete(mc.resources, resource)
+	}
+}
+
+// invalidate drops the responses of the object
+func (mc *metaCache) invalidate(bucket, objname string) {
+	mc.mtx.Lock()
+	resource := bucket + "/" + objname
+	mc.count -= len(mc.resources[resource])
+	delete(mc.resources, resource)
+	mc.mtx.Unlock()
+}
+
+// invalidateBucket drops the responses of the bucket and of its objects
+func (mc *metaCache) invalidateBucket(bucket string) {
+	mc.mtx.Lock()
+	for resource, variants := range mc.resources {
+		if resource == bucket || strings.HasPrefix(resource, bucket+"/") {
+			mc.count -= len(variants)
+			delete(mc.resources, resource)
+		}
+	}
+	mc.mtx.Unlock()
+}
+
+func (mc *metaCache) clear() {
+	mc.mtx.Lock()
+	mc.resources, mc.count = nil, 0
+	mc.mtx.Unlock()
+}
+
+func (resp *metaResponse) write(w http.ResponseWriter) {
+	for key, values := range resp.header {
+		w.Header()[key] = values
+	}
+	w.WriteHeader(resp.status)
+	w.Write(resp.body)
+}
+
+func newResponseRecorder() *responseRecorder {
+	return &responseRecorder{header: make(http.Header), status: http.StatusOK}
+}
+
+func (rec *responseRecorder) Header() http.Header         { return rec.header }
+func (rec *responseRecorder) Write(b []byte) (int, error) { return rec.body.Write(b) }
+func (rec *responseRecorder) WriteHeader(status int)      { rec.status = status }
+
+//
+// proxy
+//
+
+// serveCached serves the cached response or else the response of the handler,
+// caching the latter if it is a success, or 404 to HEAD
+func (p *proxyrunner) serveCached(w http.ResponseWriter, r *http.Request, resource string, handler func(w http.ResponseWriter)) {
+	variant := fmt.Sprintf("%s %s smap:%d bmd:%d %s %s", r.Method, r.URL.RawQuery,
+		p.smapowner.get().version(), p.bmdowner.get().version(),
+		r.Header.Get("Authorization"), r.Header.Get(HeaderDfcCustomerKey))
+	if resp := p.metacache.get(resource, variant); resp != nil {
+		p.statsif.add("nummetahit", 1)
+		resp.write(w)
+		return
+	}
+	p.statsif.add("nummetamiss", 1)
+	rec := newResponseRecorder()
+	handler(rec)
+	resp := &metaResponse{status: rec.status, header: rec.header, body: rec.body.Bytes(),
+		expires: time.Now().Add(ctx.config.MetaCache.TTL)}
+	if resp.status == http.StatusOK || (r.Method == http.MethodHead && resp.status == http.StatusNotFound) {
+		p.metacache.put(resource, variant, resp, ctx.config.MetaCache.MaxEntries)
+	}
+	resp.write(w)
+}
+
+// headTarget performs the HEAD request at the target instead of redirecting
+// the client there
+func (p *proxyrunner) headTarget(w http.ResponseWriter, r *http.Request, targeturl string) {
+	request, err := http.NewRequest(http.MethodHead, targeturl, nil)
+	if err != nil {
+		p.invalmsghdlr(w, r, err.Error())
+		return
+	}
+	for _, key := range []string{"Authorization", HeaderDfcCustomerKey} {
+		if value := r.Header.Get(key); value != "" {
+			request.Header.Set(key, value)
+		}
+	}
+	response, err := p.httpclient.Do(request)
+	if err != nil {
+		p.invalmsghdlr(w, r, fmt.Sprintf("Failed to HEAD %s, err: %v", targeturl, err), http.StatusBadGateway)
+		return
+	}
+	response.Body.Close()
+	for key, values := range response.Header {
+		w.Header()[key] = values
+	}
+	w.WriteHeader(response.StatusCode)
+}
@@ -0,0 +1,61 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestMetaCache(t *testing.T) {
+	mc := &metaCache{}
+	expires := time.Now().Add(time.Minute)
+	ok := &metaResponse{status: http.StatusOK, expires: expires}
+	mc.put("b", "HEAD", ok, 4)
+	mc.put("b/o1", "HEAD", ok, 4)
+	mc.put("b/o1", "HEAD check_cached=true", ok, 4)
+	mc.put("bb/o1", "HEAD", ok, 4)
+	mc.put("b/o2", "HEAD", ok, 4) // full
+	if mc.get("b/o2", "HEAD") != nil || mc.count != 4 {
+		t.Errorf("Cached past max entries: %d", mc.count)
+	}
+	if mc.get("b/o1", "HEAD check_cached=true") != ok || mc.get("b/o1", "GET") != nil {
+		t.Error("Unexpected cached responses of b/o1")
+	}
+
+	mc.invalidate("b", "o1")
+	if mc.get("b/o1", "HEAD") != nil || mc.count != 2 {
+		t.Errorf("Expected the responses of b/o1 to be dropped, %d left", mc.count)
+	}
+	mc.put("b/o1", "HEAD", ok, 4)
+	mc.invalidateBucket("b")
+	if mc.get("b", "HEAD") != nil || mc.get("b/o1", "HEAD") != nil || mc.get("bb/o1", "HEAD") == nil || mc.count != 1 {
+		t.Errorf("Expected the responses of bucket b only to be dropped, %d left", mc.count)
+	}
+
+	// expired responses are not served and make room for new ones
+	mc.put("b/o3", "HEAD", &metaResponse{status: http.StatusNotFound, expires: time.Now().Add(-time.Second)}, 4)
+	if mc.get("b/o3", "HEAD") != nil || mc.count != 1 {
+		t.Errorf("Served an expired response, %d left", mc.count)
+	}
+	mc.put("b/o4", "HEAD", &metaResponse{expires: time.Now().Add(-time.Second)}, 2)
+	mc.put("b/o5", "HEAD", ok, 2)
+	if mc.get("b/o5", "HEAD") != ok || mc.count != 2 {
+		t.Errorf("Expected expired responses to be dropped when full, %d left", mc.count)
+	}
+	mc.clear()
+	if mc.get("bb/o1", "HEAD") != nil || mc.count != 0 {
+		t.Error("Expected no responses after clear")
+	}
+
+	rec := newResponseRecorder()
+	rec.Header().Set("Content-Type", "application/json")
+	rec.WriteHeader(http.StatusAccepted)
+	rec.Write([]byte("{}"))
+	if rec.status != http.StatusAccepted || rec.body.String() != "{}" || rec.header.Get("Content-Type") != "application/json" {
+		t.Errorf("Unexpected recorded response %d %q %v", rec.status, rec.body.String(), rec.header)
+	}
+}
@@ -195,6 +195,7 @@ func (y *metasyncer) doSync(revsvec []interface{}) {
 		jsbytes, jsmsg         []byte
 		err                    error
 		payload                = make(simplekvs)
+		jsdelta, jsdeltamsg    []byte // Smap delta and its action message, if enabled
 		newversions            = make(map[string]revs)
 		check4newmembers       bool
 	)
@@ -225,6 +226,13 @@ func (y *metasyncer) doSync(revsvec []interface{}) {
 		// new smap always carries the previously sync-ed version (in the action message value field)
 		if tag == smaptag {
 			assert(msg.Value == nil, "reserved for the previously sync-ed copy")
+			if smapSynced != nil && ctx.config.SmapSync.Delta {
+				// receivers of the delta have the previously sync-ed copy
+				jsdelta, err = json.Marshal(newSmapDelta(smapSynced, revs.(*Smap)))
+				assert(err == nil, err)
+				jsdeltamsg, err = json.Marshal(msg)
+				assert(err == nil, err)
+			}
 			if smapSynced != nil {
 				// note: this assignment modifies the original msg's value field
 				msg.Value = smapSynced
@@ -239,6 +247,20 @@ func (y *metasyncer) doSync(revsvec []interface{}) {
 	}
 	jsbytes, err = json.Marshal(payload)
 	assert(err == nil, err)
+	jsbytes = compressPayload(jsbytes)
+	body := jsbytes // full payload unless sending the Smap delta
+	if jsdelta != nil {
+		dpayload := make(simplekvs, len(payload))
+		for tag, value := range payload {
+			dpayload[tag] = value
+		}
+		delete(dpayload, smaptag)
+		dpayload[smapdeltatag] = string(jsdelta)
+		dpayload[smaptag+actiontag] = string(jsdeltamsg)
+		jsdbytes, err := json.Marshal(dpayload)
+		assert(err == nil, err)
+		body = compressPayload(jsdbytes)
+	}
 
 	smap := y.p.smapowner.get()
 	if v, ok := newversions[smaptag]; ok {
@@ -264,15 +286,21 @@ func (y *metasyncer) doSync(revsvec []interface{}) {
 		urlPath,
 		nil, // query
 		http.MethodPut,
-		jsbytes,
+		body,
 		smap4bcast,
 		ctx.config.Timeout.CplaneOperation,
 	)
 
+	var stale []*daemonInfo
 	for r := range res {
 		if r.err == nil {
 			continue
 		}
+		if jsdelta != nil && r.status == http.StatusPreconditionFailed {
+			// the Smap delta does not apply - fall back to the full Smap
+			stale = append(stale, r.si)
+			continue
+		}
 
 		glog.Warningf("Failed to sync %s, err: %v (%d)", r.si.DaemonID, r.err, r.status)
 
@@ -282,6 +310,17 @@ func (y *metasyncer) doSync(revsvec []interface{}) {
 		}
 	}
 
+	if len(stale) > 0 {
+		res = y.p.broadcast(urlPath, nil, http.MethodPut, jsbytes,
+			stale, ctx.config.Timeout.CplaneOperation)
+		for r := range res {
+			if r.err != nil {
+				glog.Warningf("Failed to full-sync %s, err: %v (%d)", r.si.DaemonID, r.err, r.status)
+				y.pending.diamonds[r.si.DaemonID] = r.si
+			}
+		}
+	}
+
 	// handle connection-refused right away
 	for i := 0; i < 2; i++ {
 		if len(y.pending.refused) == 0 {
@@ -340,6 +379,7 @@ func (y *metasyncer) handlePending() {
 
 	jsbytes, err = json.Marshal(payload)
 	assert(err == nil, err)
+	jsbytes = compressPayload(jsbytes)
 
 	var servers []*daemonInfo
 	for _, s := range y.pending.diamonds {
@@ -0,0 +1,224 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/NVIDIA/dfcpub/3rdparty/glog"
+)
+
+// ============================= Mirroring ===================================
+// Within a target, an object of a bucket with BucketProps.Copies > 1 is kept
+// on that many distinct mountpaths: the object itself is stored as usual (see
+// placement.go), and its copies - on the next mountpaths in the order of the
+// object's preference (hrwMpaths), in the ".mirror" directory of each, so that
+// they are not listed, walked or rebalanced as objects. ObjectMeta.Replicas,
+// if set, overrides the number of copies of the object.
+// The copies are written along with the object by PUT, cold GET and rename,
+// refreshed when the object's properties change, and removed along with the
+// object. When the object cannot be found on its mountpath - e.g., the
+// mountpath failed and was disabled - GET serves a surviving copy and puts the
+// object back in the background. If the target has fewer mountpaths than
+// copies, it keeps as many as it can.
+// ============================= Mirroring ===================================
+
+const (
+	mirrorDir       = ".mirror" // per mountpath
+	mirrorMaxCopies = 16
+)
+
+func validateMirrorProps(props *BucketProps) error {
+	if props.Copies < 0 || props.Copies > mirrorMaxCopies {
+		return fmt.Errorf("invalid number of copies %d, must be between 0 and %d", props.Copies, mirrorMaxCopies)
+	}
+	return nil
+}
+
+func makePathMirror(mpath string) string {
+	return filepath.Join(mpath, mirrorDir)
+}
+
+// mirror2fqn returns the fqn of the object's copy on the mountpath
+func mirror2fqn(mpath, bucket, objname string, islocal bool) string {
+	return mpath2fqn(makePathMirror(mpath), bucket, objname, islocal)
+}
+
+// objectCopies returns the number of copies of the object stored at fqn, the
+// object itself included
+func (t *targetrunner) objectCopies(bucket string, islocal bool, fqn string) int {
+	if meta, errstr := getObjectMeta(fqn); errstr == "" && meta.Replicas > 0 {
+		return meta.Replicas
+	}
+	_, props := t.bmdowner.get().get(bucket, islocal)
+	return props.Copies
+}
+
+// mirrorMpaths returns the mountpaths for the copies of the object stored at fqn
+func (t *targetrunner) mirrorMpaths(bucket, objname, fqn string, copies int) []string {
+	mpaths := make([]string, 0, copies)
+	if copies <= 1 {
+		return mpaths
+	}
+	objmpath := fqn2mpath(fqn)
+	for _, mpath := range t.hrwMpaths(bucket, objname) {
+		if len(mpaths) == copies-1 {
+			break
+		}
+		if mpath != objmpath {
+			mpaths = append(mpaths, mpath)
+		}
+	}
+	return mpaths
+}
+
+// mirrorObject writes the copies of the object stored at fqn and removes the
+// ones it no longer needs; the caller must hold the object's exclusive lock
+func (t *targetrunner) mirrorObject(bucket, objname string, islocal bool, fqn string) (errstr string) {
+	copies := t.objectCopies(bucket, islocal, fqn)
+	mpaths := t.mirrorMpaths(bucket, objname, fqn, copies)
+	keep := make(map[string]bool, len(mpaths))
+	for _, mpath := range mpaths {
+		keep[mpath] = true
+		if errstr = t.writeMirror(fqn, mirror2fqn(mpath, bucket, objname, islocal), bucket); errstr != "" {
+			return
+		}
+	}
+	if copies > len(mpaths)+1 {
+		glog.Warningf("%s/%s: %d copies requested, %d mountpaths available", bucket, objname, copies, len(mpaths)+1)
+	}
+	t.removeMirrors(bucket, objname, islocal, keep)
+	return
+}
+
+// writeMirror copies the object to mfqn or, if the copy has the object's
+// content already, only updates the copy's xattrs
+func (t *targetrunner) writeMirror(fqn, mfqn, bucket string) string {
+	if sameContent(fqn, mfqn) {
+		for _, name := range objectXattrs {
+			val, errstr := Getxattr(fqn, name)
+			if errstr != "" {
+				return errstr
+			}
+			if val != nil {
+				errstr = Setxattr(mfqn, name, val)
+			} else if old, _ := Getxattr(mfqn, name); old != nil {
+				errstr = Deletexattr(mfqn, name)
+			}
+			if errstr != "" {
+				return errstr
+			}
+		}
+		return ""
+	}
+	workfqn := t.fqn2workfile(mfqn)
+	err := copyObject(fqn, workfqn)
+	if err == nil {
+		err = t.commitWorkfile(workfqn, mfqn, bucket)
+	}
+	if err != nil {
+		os.Remove(workfqn)
+		t.runFSKeeper(mfqn)
+		return fmt.Sprintf("Failed to copy %s => %s, err: %v", fqn, mfqn, err)
+	}
+	return ""
+}
+
+// sameContent tells whether both files have the same size and checksum
+func sameContent(fqn, otherfqn string) bool {
+	finfo, err := os.Stat(fqn)
+	if err != nil {
+		return false
+	}
+	otherfinfo, err := os.Stat(otherfqn)
+	if err != nil || finfo.Size() != otherfinfo.Size() {
+		return false
+	}
+	cksum, _ := Getxattr(fqn, XattrXXHashVal)
+	othercksum, _ := Getxattr(otherfqn, XattrXXHashVal)
+	return cksum != nil && bytes.Equal(cksum, othercksum)
+}
+
+// removeMirrors removes the copies of the object except the ones on the keep
+// mountpaths, returns true if there were any
+func (t *targetrunner) removeMirrors(bucket, objname string, islocal bool, keep map[string]bool) (removed bool) {
+	for mpath := range ctx.mountpaths.Available {
+		if keep[mpath] {
+			continue
+		}
+		if err := os.Remove(mirror2fqn(mpath, bucket, objname, islocal)); err == nil {
+			removed = true
+		} else if !os.IsNotExist(err) {
+			glog.Errorf("Failed to remove the copy of %s/%s on %s, err: %v", bucket, objname, mpath, err)
+		}
+	}
+	return
+}
+
+// findMirror returns the fqn of a copy of the object, "" if there are none
+func (t *targetrunner) findMirror(bucket, objname string, islocal bool) string {
+	for _, mpath := range t.hrwMpaths(bucket, objname) {
+		mfqn := mirror2fqn(mpath, bucket, objname, islocal)
+		if _, err := os.Stat(mfqn); err == nil {
+			return mfqn
+		}
+	}
+	return ""
+}
+
+// lookupMirror returns the copy of the object to serve if the object at fqn
+// cannot be accessed, and puts the object back in the background; returns ""
+// if the object is fine or there are no copies
+func (t *targetrunner) lookupMirror(bucket, objname string, islocal bool, fqn string) string {
+	if _, err := os.Stat(fqn); err == nil {
+		return ""
+	}
+	mfqn := t.findMirror(bucket, objname, islocal)
+	if mfqn != "" {
+		glog.Warningf("%s/%s: %s is not accessible, serving its copy %s", bucket, objname, fqn, mfqn)
+		go t.restoreMirrored(bucket, objname, islocal)
+	}
+	return mfqn
+}
+
+// restoreMirrored puts the object back from one of its copies and mirrors it again
+func (t *targetrunner) restoreMirrored(bucket, objname string, islocal bool) {
+	uname := uniquename(bucket, objname)
+	t.rtnamemap.lockname(uname, true, &pendinginfo{Time: time.Now(), fqn: t.fqn(bucket, objname, islocal)}, time.Second)
+	defer t.rtnamemap.unlockname(uname, true)
+	if _, exists := t.findfqn(bucket, objname, islocal); exists { // restored or deleted in the meantime
+		return
+	}
+	mfqn := t.findMirror(bucket, objname, islocal)
+	if mfqn == "" {
+		return
+	}
+	fqn, hrwmpath := t.placefqn(bucket, objname, islocal)
+	workfqn := t.fqn2workfile(fqn)
+	err := copyObject(mfqn, workfqn)
+	if err == nil {
+		err = t.commitWorkfile(workfqn, fqn, bucket)
+	}
+	if err != nil {
+		os.Remove(workfqn)
+		glog.Errorf("Failed to restore %s/%s from its copy %s, err: %v", bucket, objname, mfqn, err)
+		return
+	}
+	if hrwmpath != "" {
+		if errstr := Setxattr(fqn, XattrDisplaced, []byte(hrwmpath)); errstr != "" {
+			glog.Errorln(errstr)
+		}
+	}
+	if errstr := t.mirrorObject(bucket, objname, islocal, fqn); errstr != "" {
+		glog.Errorf("Restored %s/%s, failed to mirror it, err: %s", bucket, objname, errstr)
+		return
+	}
+	glog.Infof("Restored %s/%s from its copy %s", bucket, objname, mfqn)
+}
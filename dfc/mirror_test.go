@@ -0,0 +1,91 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ */
+package dfc
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMirror(t *testing.T) {
+	const bucket = "lbucket"
+	dir, err := ioutil.TempDir("", "mirror")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	oldavail := ctx.mountpaths.Available
+	defer func() { ctx.mountpaths.Available = oldavail }()
+	ctx.mountpaths.Available = make(map[string]*mountPath)
+	for _, mp := range []string{"mp1", "mp2", "mp3"} {
+		mpath := filepath.Join(dir, mp)
+		ctx.mountpaths.Available[mpath] = &mountPath{Path: mpath}
+	}
+
+	target, _ := newTestTarget(map[string]BucketProps{bucket: {Copies: 3}})
+
+	for _, copies := range []int{-1, mirrorMaxCopies + 1} {
+		if err := validateMirrorProps(&BucketProps{Copies: copies}); err == nil {
+			t.Errorf("Expected %d copies to be invalid", copies)
+		}
+	}
+
+	order := target.hrwMpaths(bucket, "obj")
+	fqn := target.fqn(bucket, "obj", true)
+	if err = CreateDir(filepath.Dir(fqn)); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(fqn, []byte("mirrored"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if errstr := Setxattr(fqn, XattrXXHashVal, []byte("8e1ab47f2c6d3e90")); errstr != "" {
+		t.Skipf("Extended attributes are not supported: %s", errstr)
+	}
+	checkCopies := func(expected ...string) {
+		for _, mpath := range order {
+			_, err := os.Stat(mirror2fqn(mpath, bucket, "obj", true))
+			if exists := err == nil; exists != contains(expected, mpath) {
+				t.Errorf("Copy on %s: exists %t, expected on %v", mpath, exists, expected)
+			}
+		}
+	}
+
+	// the object on the home mountpath, the copies on the other two
+	if errstr := target.mirrorObject(bucket, "obj", true, fqn); errstr != "" {
+		t.Fatal(errstr)
+	}
+	checkCopies(order[1], order[2])
+
+	// the object's own number of copies overrides the bucket's
+	if errstr := setObjectMeta(fqn, &ObjectMeta{Replicas: 2}); errstr != "" {
+		t.Fatal(errstr)
+	}
+	if errstr := target.mirrorObject(bucket, "obj", true, fqn); errstr != "" {
+		t.Fatal(errstr)
+	}
+	checkCopies(order[1])
+	if meta, _ := getObjectMeta(mirror2fqn(order[1], bucket, "obj", true)); meta.Replicas != 2 {
+		t.Errorf("Expected the copy to carry the object's properties, got %+v", meta)
+	}
+
+	// the object is lost: restored from its copy
+	if err = os.Remove(fqn); err != nil {
+		t.Fatal(err)
+	}
+	if mfqn := target.findMirror(bucket, "obj", true); mfqn != mirror2fqn(order[1], bucket, "obj", true) {
+		t.Fatalf("Unexpected copy %q", mfqn)
+	}
+	target.restoreMirrored(bucket, "obj", true)
+	if data, err := ioutil.ReadFile(fqn); err != nil || string(data) != "mirrored" {
+		t.Fatalf("Expected the object restored at %s, err: %v", fqn, err)
+	}
+	checkCopies(order[1])
+
+	if !target.removeMirrors(bucket, "obj", true, nil) {
+		t.Error("Expected the copies to be removed")
+	}
+	checkCopies()
+}
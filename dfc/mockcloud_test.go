@@ -0,0 +1,392 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ */
+package dfc
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mockcloud is an in-memory implementation of cloudif for unit tests of the
+// cloud data path. Every call is delayed by latency and fails with probability
+// failRate (with errcode); with versioning every PUT produces a new object
+// version - GCP-like - otherwise objects have no version - like unversioned S3
+// buckets. The numbers of calls are counted per operation so that tests can
+// check retries
+type (
+	mockcloud struct {
+		t          *targetrunner
+		latency    time.Duration
+		failRate   float64
+		errcode    int // http.StatusServiceUnavailable by default
+		versioning bool
+
+		mtx     sync.Mutex
+		rnd     *rand.Rand
+		buckets map[string]map[string]*mockobject // bucket => object name => object
+		calls   map[string]int                    // operation => number of calls
+	}
+	mockobject struct {
+		data       []byte
+		md5        string
+		cksum      cksumvalue
+		generation int64
+		updated    time.Time
+	}
+)
+
+func newMockCloud(t *targetrunner, buckets ...string) *mockcloud {
+	m := &mockcloud{
+		t:       t,
+		errcode: http.StatusServiceUnavailable,
+		rnd:     rand.New(rand.NewSource(1)),
+		buckets: make(map[string]map[string]*mockobject),
+		calls:   make(map[string]int),
+	}
+	for _, bucket := range buckets {
+		m.buckets[bucket] = make(map[string]*mockobject)
+	}
+	return m
+}
+
+// Simulates a call: counts it, waits for latency and fails it with failRate
+func (m *mockcloud) call(ct context.Context, op string) *Error {
+	m.mtx.Lock()
+	m.calls[op]++
+	fail := m.failRate > 0 && m.rnd.Float64() < m.failRate
+	m.mtx.Unlock()
+
+	if m.latency > 0 {
+		select {
+		case <-time.After(m.latency):
+		case <-ct.Done():
+			return NewError(http.StatusRequestTimeout, "%s: %v", op, ct.Err())
+		}
+	}
+	if fail {
+		return cloudError(ProviderAmazon, m.errcode, "", "%s: injected mock cloud failure", op)
+	}
+	return nil
+}
+
+func (m *mockcloud) numCalls(op string) int {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	return m.calls[op]
+}
+
+// Returns the object, or an error if the bucket or the object does not exist.
+// The caller must hold the lock
+func (m *mockcloud) lookup(bucket, objname string) (*mockobject, *Error) {
+	objects, ok := m.buckets[bucket]
+	if !ok {
+		return nil, NewError(http.StatusNotFound, "Bucket %s does not exist", bucket)
+	}
+	obj, ok := objects[objname]
+	if !ok {
+		return nil, NewError(http.StatusNotFound, "Object %s/%s does not exist", bucket, objname)
+	}
+	return obj, nil
+}
+
+func (obj *mockobject) version() string {
+	if obj.generation == 0 {
+		return ""
+	}
+	return strconv.FormatInt(obj.generation, 10)
+}
+
+func (m *mockcloud) listbucket(ct context.Context, bucket string, msg *GetMsg) (jsbytes []byte, cerr *Error) {
+	if cerr = m.call(ct, "listbucket"); cerr != nil {
+		return
+	}
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	objects, ok := m.buckets[bucket]
+	if !ok {
+		return nil, NewError(http.StatusNotFound, "Bucket %s does not exist", bucket)
+	}
+	names := make([]string, 0, len(objects))
+	for name := range objects {
+		if strings.HasPrefix(name, msg.GetPrefix) && name > msg.GetPageMarker {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	reslist := BucketList{Entries: make([]*BucketEntry, 0, len(names))}
+	for _, name := range names {
+		if msg.GetPageSize != 0 && len(reslist.Entries) == msg.GetPageSize {
+			reslist.PageMarker = reslist.Entries[len(reslist.Entries)-1].Name
+			break
+		}
+		obj := objects[name]
+		entry := &BucketEntry{Name: name}
+		if strings.Contains(msg.GetProps, GetPropsSize) {
+			entry.Size = int64(len(obj.data))
+		}
+		if strings.Contains(msg.GetProps, GetPropsCtime) {
+			entry.Ctime = formatTime(obj.updated, msg.GetTimeFormat)
+		}
+		if strings.Contains(msg.GetProps, GetPropsChecksum) {
+			entry.Checksum = obj.md5
+		}
+		if strings.Contains(msg.GetProps, GetPropsVersion) {
+			entry.Version = obj.version()
+		}
+		reslist.Entries = append(reslist.Entries, entry)
+	}
+	jsbytes, err := json.Marshal(reslist)
+	assert(err == nil, err)
+	return
+}
+
+func (m *mockcloud) headbucket(ct context.Context, bucket string) (bucketprops simplekvs, cerr *Error) {
+	if cerr = m.call(ct, "headbucket"); cerr != nil {
+		return
+	}
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if _, ok := m.buckets[bucket]; !ok {
+		return nil, NewError(http.StatusNotFound, "Bucket %s does not exist", bucket)
+	}
+	bucketprops = simplekvs{CloudProvider: ProviderAmazon, Versioning: VersionNone}
+	if m.versioning {
+		bucketprops[Versioning] = VersionCloud
+	}
+	return
+}
+
+func (m *mockcloud) getbucketnames(ct context.Context) (buckets []string, cerr *Error) {
+	if cerr = m.call(ct, "getbucketnames"); cerr != nil {
+		return
+	}
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	for bucket := range m.buckets {
+		buckets = append(buckets, bucket)
+	}
+	sort.Strings(buckets)
+	return
+}
+
+func (m *mockcloud) headobject(ct context.Context, bucket string, objname string) (objmeta simplekvs, cerr *Error) {
+	if cerr = m.call(ct, "headobject"); cerr != nil {
+		return
+	}
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	obj, cerr := m.lookup(bucket, objname)
+	if cerr != nil {
+		return
+	}
+	objmeta = simplekvs{CloudProvider: ProviderAmazon, Size: strconv.Itoa(len(obj.data))}
+	if v := obj.version(); v != "" {
+		objmeta["version"] = v
+	}
+	return
+}
+
+func (m *mockcloud) getobj(ct context.Context, fqn, bucket, objname string) (props *objectProps, cerr *Error) {
+	if cerr = m.call(ct, "getobj"); cerr != nil {
+		return
+	}
+	m.mtx.Lock()
+	obj, cerr := m.lookup(bucket, objname)
+	m.mtx.Unlock()
+	if cerr != nil {
+		return
+	}
+	props = &objectProps{version: obj.version()}
+	cksum := cloudCksum{kind: CloudCksumMD5, val: obj.md5}
+	if size := int64(len(obj.data)); m.t.parallelColdGet(bucket) && size > ctx.config.ColdGet.PartSize {
+		getpart := func(ct context.Context, offset, length int64) (io.ReadCloser, *Error) {
+			if cerr := m.call(ct, "getpart"); cerr != nil {
+				return nil, cerr
+			}
+			return ioutil.NopCloser(bytes.NewReader(obj.data[offset : offset+length])), nil
+		}
+		return props, m.t.receiveParts(ct, fqn, bucket, objname, size, cksum, obj.cksum, props, getpart)
+	}
+	errstr := m.t.receiveCloud(fqn, bucket, objname, cksum, obj.cksum, bytes.NewReader(obj.data), props)
+	return props, errorFromStr(errstr, http.StatusInternalServerError)
+}
+
+func (m *mockcloud) getobjrange(ct context.Context, bucket, objname string, rng *httpRange) (rr *rangeReader, cerr *Error) {
+	if cerr = m.call(ct, "getobjrange"); cerr != nil {
+		return
+	}
+	m.mtx.Lock()
+	obj, cerr := m.lookup(bucket, objname)
+	m.mtx.Unlock()
+	if cerr != nil {
+		return
+	}
+	size := int64(len(obj.data))
+	offset, length, ok := rng.resolve(size)
+	if !ok {
+		return nil, errRangeNotSatisfiable(bucket, objname, rng, size)
+	}
+	rc := ioutil.NopCloser(bytes.NewReader(obj.data[offset : offset+length]))
+	return &rangeReader{ReadCloser: rc, offset: offset, length: length, size: size, version: obj.version()}, nil
+}
+
+func (m *mockcloud) putobj(ct context.Context, file io.Reader, bucket, objname string, ohobj cksumvalue) (version string, cerr *Error) {
+	if cerr = m.call(ct, "putobj"); cerr != nil {
+		return
+	}
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		return "", NewError(http.StatusInternalServerError, "PUT %s/%s: failed to read, err: %v", bucket, objname, err)
+	}
+	sum := md5.Sum(data)
+	obj := &mockobject{data: data, md5: hex.EncodeToString(sum[:]), cksum: ohobj, updated: time.Now()}
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	objects, ok := m.buckets[bucket]
+	if !ok {
+		return "", NewError(http.StatusNotFound, "Bucket %s does not exist", bucket)
+	}
+	if m.versioning {
+		obj.generation = 1
+		if prev, ok := objects[objname]; ok {
+			obj.generation = prev.generation + 1
+		}
+	}
+	objects[objname] = obj
+	return obj.version(), nil
+}
+
+func (m *mockcloud) deleteobj(ct context.Context, bucket, objname string) (cerr *Error) {
+	if cerr = m.call(ct, "deleteobj"); cerr != nil {
+		return
+	}
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	obj, cerr := m.lookup(bucket, objname)
+	if cerr != nil {
+		return
+	}
+	if pc := preconditionFromContext(ct); pc != nil {
+		st := &objstate{version: obj.version(), cksums: []string{obj.md5}, modified: obj.updated}
+		if obj.cksum != nil {
+			_, hval := obj.cksum.get()
+			st.cksums = append(st.cksums, hval)
+		}
+		if cerr = pc.check(bucket, objname, st); cerr != nil {
+			return
+		}
+	}
+	delete(m.buckets[bucket], objname)
+	return
+}
+
+func (m *mockcloud) restoreobj(ct context.Context, bucket, objname string, msg *RestoreMsg) (cerr *Error) {
+	if cerr = m.call(ct, "restoreobj"); cerr != nil {
+		return
+	}
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	_, cerr = m.lookup(bucket, objname)
+	return
+}
+
+func TestMockCloud(t *testing.T) {
+	const bucket = "mockbucket"
+	dir, err := ioutil.TempDir("", "mockcloud")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ctx.config.Cksum.Checksum = ChecksumXXHash
+
+	target := &targetrunner{}
+	target.bmdowner = &bmdowner{}
+	target.bmdowner.put(newBucketMD())
+	m := newMockCloud(target, bucket)
+	m.versioning = true
+	ct := context.Background()
+
+	data := []byte("The quick brown fox jumps over the lazy dog")
+	for i := 1; i <= 2; i++ {
+		version, cerr := m.putobj(ct, bytes.NewReader(data), bucket, "obj", nil)
+		if cerr != nil {
+			t.Fatal(cerr)
+		}
+		if version != strconv.Itoa(i) {
+			t.Errorf("Expected version %d, got %q", i, version)
+		}
+	}
+
+	// cold GET writes the object to the local filesystem
+	fqn := filepath.Join(dir, "obj")
+	props, cerr := m.getobj(ct, fqn, bucket, "obj")
+	if cerr != nil {
+		t.Fatal(cerr)
+	}
+	if props.version != "2" || props.size != int64(len(data)) {
+		t.Errorf("Unexpected object properties: version %q, size %d", props.version, props.size)
+	}
+	if local, err := ioutil.ReadFile(fqn); err != nil || !bytes.Equal(local, data) {
+		t.Errorf("Local copy differs from the cloud object, err: %v", err)
+	}
+
+	jsbytes, cerr := m.listbucket(ct, bucket, &GetMsg{GetProps: GetPropsSize + "," + GetPropsVersion})
+	if cerr != nil {
+		t.Fatal(cerr)
+	}
+	list := &BucketList{}
+	if err = json.Unmarshal(jsbytes, list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Entries) != 1 || list.Entries[0].Size != int64(len(data)) || list.Entries[0].Version != "2" {
+		t.Errorf("Unexpected bucket list: %+v", list.Entries)
+	}
+
+	// failures
+	m.failRate = 1
+	if _, cerr := m.headobject(ct, bucket, "obj"); cerr == nil || cerr.Status != http.StatusServiceUnavailable {
+		t.Errorf("Expected failure with %d, got %+v", http.StatusServiceUnavailable, cerr)
+	} else if !cerr.Retryable || cerr.Code != ErrCodeUnavailable || cerr.Provider != ProviderAmazon {
+		t.Errorf("Unexpected error %+v", cerr)
+	}
+	if n := m.numCalls("headobject"); n != 1 {
+		t.Errorf("Expected 1 call, got %d", n)
+	}
+	m.failRate = 0
+
+	// latency and cancellation
+	m.latency = time.Hour
+	cancelled, cancel := context.WithTimeout(ct, 10*time.Millisecond)
+	defer cancel()
+	if _, cerr := m.headbucket(cancelled, bucket); cerr == nil || cerr.Status != http.StatusRequestTimeout {
+		t.Errorf("Expected timeout, got %+v", cerr)
+	}
+	m.latency = 0
+
+	if cerr := m.deleteobj(ct, bucket, "obj"); cerr != nil {
+		t.Fatal(cerr)
+	}
+	if _, cerr := m.headobject(ct, bucket, "obj"); cerr == nil || cerr.Status != http.StatusNotFound {
+		t.Errorf("Expected %d for deleted object, got %+v", http.StatusNotFound, cerr)
+	} else if cerr.Retryable || cerr.Code != ErrCodeNotFound {
+		t.Errorf("Unexpected error %+v", cerr)
+	}
+}
@@ -249,10 +249,11 @@ func TestDiscoverServers(t *testing.T) {
 		for _, s := range tc.servers {
 			ts := s.httpHandler(s.smapVersion, s.bmdVersion)
 			ip, port := getServerIPAndPort(ts.URL)
+			si := &daemonInfo{DaemonID: s.id, NodeIPAddr: ip, DaemonPort: port, DirectURL: ts.URL}
 			if s.isProxy {
-				discoverSmap.addProxy(&daemonInfo{DaemonID: s.id, NodeIPAddr: ip, DaemonPort: port})
+				discoverSmap.addProxy(si)
 			} else {
-				discoverSmap.addTarget(&daemonInfo{DaemonID: s.id, NodeIPAddr: ip, DaemonPort: port})
+				discoverSmap.addTarget(si)
 			}
 		}
 
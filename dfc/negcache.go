@@ -0,0 +1,133 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+// Negative cache (target).
+// A GET of an object that is neither cached nor in the Cloud costs a request
+// to the Cloud provider every time. With negcache.ttl configured, a target
+// remembers the Cloud objects that the provider has reported missing (404) for
+// the TTL, and fails the GETs of these objects right away. A PUT of the object
+// via the target drops the entry; objects created in the Cloud by other means
+// become visible within the TTL. The number of the GETs answered from the cache
+// (numneghit) and the most requested missing objects are reported with the
+// target stats, to detect clients that keep requesting missing objects.
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	negCacheMaxEntries = 10000 // default negcache.max_entries
+	negCacheHottest    = 10    // most requested missing objects in the stats
+)
+
+type (
+	negCache struct {
+		mtx     sync.Mutex
+		entries map[string]*negEntry // bucket/object => entry
+	}
+	negEntry struct {
+		expires time.Time
+		hits    int64
+	}
+	// NegCacheStats describes the negative cache of a target
+	NegCacheStats struct {
+		Entries int              `json:"entries"`
+		Hottest []*NegCacheEntry `json:"hottest,omitempty"` // by hits, descending
+	}
+	// NegCacheEntry is a missing object and the number of GETs answered from the cache
+	NegCacheEntry struct {
+		Name string `json:"name"`
+		Hits int64  `json:"hits"`
+	}
+)
+
+// missing tells whether the object is known to be missing
+func (nc *negCache) missing(uname string, now time.Time) bool {
+	nc.mtx.Lock()
+	defer nc.mtx.Unlock()
+	entry, ok := nc.entries[uname]
+	if !ok {
+		return false
+	}
+	if now.After(entry.expires) {
+		delete(nc.entries, uname)
+		return false
+	}
+	entry.hits++
+	return true
+}
+
+func (nc *negCache) add(uname string, now time.Time) {
+	conf := &ctx.config.NegCache
+	if conf.TTL == 0 {
+		return
+	}
+	nc.mtx.Lock()
+	defer nc.mtx.Unlock()
+	if nc.entries == nil {
+		nc.entries = make(map[string]*negEntry)
+	}
+	if _, ok := nc.entries[uname]; !ok && len(nc.entries) >= conf.MaxEntries {
+		for name, entry := range nc.entries {
+			if now.After(entry.expires) {
+				delete(nc.entries, name)
+			}
+		}
+		if len(nc.entries) >= conf.MaxEntries {
+			return
+		}
+	}
+	nc.entries[uname] = &negEntry{expires: now.Add(conf.TTL)}
+}
+
+func (nc *negCache) invalidate(uname string) {
+	nc.mtx.Lock()
+	delete(nc.entries, uname)
+	nc.mtx.Unlock()
+}
+
+func (nc *negCache) stats(now time.Time) *NegCacheStats {
+	nc.mtx.Lock()
+	defer nc.mtx.Unlock()
+	if len(nc.entries) == 0 {
+		return nil
+	}
+	stats := &NegCacheStats{}
+	for name, entry := range nc.entries {
+		if now.After(entry.expires) {
+			delete(nc.entries, name)
+			continue
+		}
+		stats.Entries++
+		if entry.hits > 0 {
+			stats.Hottest = append(stats.Hottest, &NegCacheEntry{Name: name, Hits: entry.hits})
+		}
+	}
+	sort.Slice(stats.Hottest, func(i, j int) bool {
+		if stats.Hottest[i].Hits != stats.Hottest[j].Hits {
+			return stats.Hottest[i].Hits > stats.Hottest[j].Hits
+		}
+		return stats.Hottest[i].Name < stats.Hottest[j].Name
+	})
+	if len(stats.Hottest) > negCacheHottest {
+		stats.Hottest = stats.Hottest[:negCacheHottest]
+	}
+	return stats
+}
+
+// coldMissing fails the cold GET of the object known to be missing
+func (t *targetrunner) coldMissing(bucket, objname string) (errstr string, errcode int) {
+	if !t.negcache.missing(uniquename(bucket, objname), time.Now()) {
+		return
+	}
+	t.statsif.add("numneghit", 1)
+	return fmt.Sprintf("Object %s/%s %s (cached)", bucket, objname, doesnotexist), http.StatusNotFound
+}
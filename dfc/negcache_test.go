@@ -0,0 +1,93 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestNegCache(t *testing.T) {
+	oldconf := ctx.config.NegCache
+	defer func() { ctx.config.NegCache = oldconf }()
+	ctx.config.NegCache = negcacheconf{TTL: time.Minute, MaxEntries: 3}
+
+	var (
+		nc  = &negCache{}
+		now = time.Unix(1500000000, 0)
+	)
+	if nc.missing("b/o1", now) || nc.stats(now) != nil {
+		t.Fatal("Expected the cache to be empty")
+	}
+	nc.add("b/o1", now)
+	nc.add("b/o2", now)
+	nc.add("b/o3", now.Add(30*time.Second))
+	nc.add("b/o4", now) // full
+	if nc.missing("b/o4", now) {
+		t.Error("Cached past max entries")
+	}
+	for i := 0; i < 3; i++ {
+		nc.missing("b/o2", now)
+	}
+	if !nc.missing("b/o1", now.Add(time.Minute)) || nc.missing("b/o1", now.Add(time.Minute+time.Second)) {
+		t.Error("Expected b/o1 to be missing for the TTL")
+	}
+
+	// a PUT drops the entry
+	nc.invalidate("b/o3")
+	if nc.missing("b/o3", now) {
+		t.Error("Expected b/o3 to be dropped")
+	}
+
+	// expired entries make room for new ones
+	nc.add("b/o5", now)
+	nc.add("b/o6", now) // full
+	nc.add("b/o4", now.Add(70*time.Second))
+	if !nc.missing("b/o4", now.Add(70*time.Second)) {
+		t.Error("Expected b/o4 to replace the expired entries")
+	}
+	if nc.missing("b/o2", now.Add(70*time.Second)) {
+		t.Error("Expected b/o2 to expire")
+	}
+	stats := nc.stats(now.Add(70 * time.Second))
+	if stats.Entries != 1 || len(stats.Hottest) != 1 || stats.Hottest[0].Name != "b/o4" || stats.Hottest[0].Hits != 1 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+
+	// disabled
+	ctx.config.NegCache.TTL = 0
+	nc.add("b/o5", now)
+	if nc.missing("b/o5", now) {
+		t.Error("Expected the cache to be disabled")
+	}
+}
+
+func TestNegCacheHottest(t *testing.T) {
+	oldconf := ctx.config.NegCache
+	defer func() { ctx.config.NegCache = oldconf }()
+	ctx.config.NegCache = negcacheconf{TTL: time.Minute, MaxEntries: negCacheMaxEntries}
+
+	var (
+		nc  = &negCache{}
+		now = time.Now()
+	)
+	for i := 0; i < 2*negCacheHottest; i++ {
+		uname := fmt.Sprintf("b/o%02d", i)
+		nc.add(uname, now)
+		for j := 0; j < i; j++ {
+			nc.missing(uname, now)
+		}
+	}
+	stats := nc.stats(now)
+	if stats.Entries != 2*negCacheHottest || len(stats.Hottest) != negCacheHottest {
+		t.Fatalf("Unexpected stats: %d entries, %d hottest", stats.Entries, len(stats.Hottest))
+	}
+	for i, entry := range stats.Hottest {
+		if expected := fmt.Sprintf("b/o%02d", 2*negCacheHottest-1-i); entry.Name != expected {
+			t.Errorf("Expected %s at %d, got %s", expected, i, entry.Name)
+		}
+	}
+}
@@ -10,3 +10,10 @@ package dfc
 func netifSpeed(netifName string) int {
 	return 0
 }
+
+// netifBytes returns the total number of bytes received and sent by the
+// network interfaces
+// FIXME TODO: not implemented for OSX
+func netifBytes() (rx, tx int64, err error) {
+	return
+}
@@ -5,6 +5,13 @@
  */
 package dfc
 
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+)
+
 /*
 #include <stdio.h>
 #include <sys/socket.h>
@@ -64,3 +71,34 @@ func netifSpeed(netifName string) int {
 func netifSpeed(netifName string) int {
 	return 0
 }
+
+// netifBytes returns the total number of bytes received and sent by all
+// network interfaces except loopback, see /proc/net/dev
+func netifBytes() (rx, tx int64, err error) {
+	file, err := os.Open("/proc/net/dev")
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// "  eth0: rxbytes rxpackets ... (8 receive fields) txbytes ..."
+		line := scanner.Text()
+		i := strings.IndexByte(line, ':')
+		if i < 0 || strings.TrimSpace(line[:i]) == "lo" {
+			continue
+		}
+		fields := strings.Fields(line[i+1:])
+		if len(fields) < 9 {
+			continue
+		}
+		r, err1 := strconv.ParseInt(fields[0], 10, 64)
+		t, err2 := strconv.ParseInt(fields[8], 10, 64)
+		if err1 == nil && err2 == nil {
+			rx += r
+			tx += t
+		}
+	}
+	err = scanner.Err()
+	return
+}
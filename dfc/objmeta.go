@@ -0,0 +1,238 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+// Object properties set by the user.
+// Similar to the properties of a bucket, an object has properties of its own:
+// GET /v1/objects/bucket-name/object-name?what=objmeta returns them, and PATCH
+// of the object with ObjectMetaPatch changes them. The properties are kept in
+// XattrObjMeta of the object stored by its target - the object must be cached -
+// and travel with it between mountpaths; a PUT of the object resets them.
+// LRU never evicts a pinned object and evicts the objects whose TTL has expired
+// first, regardless of lru_config.dont_evict_time. The desired number of
+// replicas overrides the number of copies the bucket keeps (see mirror.go).
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/NVIDIA/dfcpub/3rdparty/glog"
+)
+
+// getObjectMeta returns the properties of the object, empty if none are set
+func getObjectMeta(fqn string) (*ObjectMeta, string) {
+	meta := &ObjectMeta{}
+	b, errstr := Getxattr(fqn, XattrObjMeta)
+	if errstr != "" || b == nil {
+		return meta, errstr
+	}
+	if err := json.Unmarshal(b, meta); err != nil {
+		return meta, fmt.Sprintf("Invalid properties of %s, err: %v", fqn, err)
+	}
+	return meta, ""
+}
+
+func setObjectMeta(fqn string, meta *ObjectMeta) string {
+	if meta.empty() {
+		if b, _ := Getxattr(fqn, XattrObjMeta); b == nil {
+			return ""
+		}
+		return Deletexattr(fqn, XattrObjMeta)
+	}
+	b, err := json.Marshal(meta)
+	assert(err == nil, err)
+	if len(b) >= maxAttrSize {
+		return fmt.Sprintf("Properties of %s are too large: %d bytes (max %d)", fqn, len(b), maxAttrSize-1)
+	}
+	return Setxattr(fqn, XattrObjMeta, b)
+}
+
+func (meta *ObjectMeta) empty() bool {
+	return !meta.Pinned && meta.Expires == "" && len(meta.Tags) == 0 && meta.Replicas == 0
+}
+
+// expired tells whether the TTL of the object has expired
+func (meta *ObjectMeta) expired(now time.Time) bool {
+	if meta.Expires == "" {
+		return false
+	}
+	expires, err := time.Parse(time.RFC3339, meta.Expires)
+	return err == nil && !now.Before(expires)
+}
+
+// apply validates the patch and applies it to the properties
+func (meta *ObjectMeta) apply(patch *ObjectMetaPatch, now time.Time) string {
+	if patch.TTL != nil && *patch.TTL != "" {
+		ttl, err := time.ParseDuration(*patch.TTL)
+		if err != nil || ttl <= 0 {
+			return fmt.Sprintf("Invalid TTL %q", *patch.TTL)
+		}
+	}
+	if patch.Replicas != nil && (*patch.Replicas < 0 || *patch.Replicas > mirrorMaxCopies) {
+		return fmt.Sprintf("Invalid number of replicas %d", *patch.Replicas)
+	}
+	for k := range patch.Tags {
+		if k == "" {
+			return "Empty tag name"
+		}
+	}
+	if patch.Pinned != nil {
+		meta.Pinned = *patch.Pinned
+	}
+	if patch.TTL != nil {
+		meta.Expires = ""
+		if *patch.TTL != "" {
+			ttl, _ := time.ParseDuration(*patch.TTL)
+			meta.Expires = now.Add(ttl).UTC().Format(time.RFC3339)
+		}
+	}
+	for k, v := range patch.Tags {
+		if v == "" {
+			delete(meta.Tags, k)
+			continue
+		}
+		if meta.Tags == nil {
+			meta.Tags = make(map[string]string)
+		}
+		meta.Tags[k] = v
+	}
+	if patch.Replicas != nil {
+		meta.Replicas = *patch.Replicas
+	}
+	return ""
+}
+
+//
+// target
+//
+
+// GET /v1/objects/bucket-name/object-name?what=objmeta
+func (t *targetrunner) httpobjmetaget(w http.ResponseWriter, r *http.Request, bucket, objname string) {
+	fqn, exists := t.findfqn(bucket, objname, t.bmdowner.get().islocal(bucket))
+	if !exists {
+		t.invalmsghdlr(w, r, fmt.Sprintf("Object %s/%s %s", bucket, objname, doesnotexist), http.StatusNotFound)
+		return
+	}
+	uname := uniquename(bucket, objname)
+	t.rtnamemap.lockname(uname, false, &pendinginfo{Time: time.Now(), fqn: fqn}, time.Second)
+	meta, errstr := getObjectMeta(fqn)
+	t.rtnamemap.unlockname(uname, false)
+	if errstr != "" {
+		t.invalmsghdlr(w, r, errstr, http.StatusInternalServerError)
+		return
+	}
+	jsbytes, err := json.Marshal(meta)
+	assert(err == nil, err)
+	t.writeJSON(w, r, jsbytes, "objmeta")
+}
+
+// GET /v1/objects/bucket-name/object-name?what=pgroup
+// Returns the placement group of the stored object, "" if it has none
+func (t *targetrunner) httppgroupget(w http.ResponseWriter, r *http.Request, bucket, objname string) {
+	fqn, exists := t.findfqn(bucket, objname, t.bmdowner.get().islocal(bucket))
+	if !exists {
+		// the common case of a broadcast lookup: not an error
+		status := http.StatusNotFound
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	pgroup, errstr := Getxattr(fqn, XattrPlacementGroup)
+	if errstr != "" {
+		t.invalmsghdlr(w, r, errstr, http.StatusInternalServerError)
+		return
+	}
+	jsbytes, err := json.Marshal(string(pgroup))
+	assert(err == nil, err)
+	t.writeJSON(w, r, jsbytes, "pgroup")
+}
+
+// PATCH /v1/objects/bucket-name/object-name
+func (t *targetrunner) httpobjpatch(w http.ResponseWriter, r *http.Request) {
+	apitems := t.restAPIItems(r.URL.Path, 5)
+	if apitems = t.checkRestAPI(w, r, apitems, 2, Rversion, Robjects); apitems == nil {
+		return
+	}
+	bucket, objname := apitems[0], strings.Join(apitems[1:], "/")
+	if !t.validatebckname(w, r, bucket) {
+		return
+	}
+	patch := &ObjectMetaPatch{}
+	if t.readJSON(w, r, patch) != nil {
+		return
+	}
+	islocal := t.bmdowner.get().islocal(bucket)
+	fqn, exists := t.findfqn(bucket, objname, islocal)
+	if !exists {
+		t.invalmsghdlr(w, r, fmt.Sprintf("Object %s/%s %s", bucket, objname, doesnotexist), http.StatusNotFound)
+		return
+	}
+	if patch.Pinned != nil && *patch.Pinned {
+		if errstr, errcode := t.checkPin(bucket, objname, fqn); errstr != "" {
+			t.invalmsghdlr(w, r, errstr, errcode)
+			return
+		}
+	}
+	uname := uniquename(bucket, objname)
+	t.rtnamemap.lockname(uname, true, &pendinginfo{Time: time.Now(), fqn: fqn}, time.Second)
+	meta, errstr := getObjectMeta(fqn)
+	if errstr == "" {
+		if errstr = meta.apply(patch, time.Now()); errstr != "" {
+			t.rtnamemap.unlockname(uname, true)
+			t.invalmsghdlr(w, r, errstr)
+			return
+		}
+		if errstr = setObjectMeta(fqn, meta); errstr == "" {
+			errstr = t.mirrorObject(bucket, objname, islocal, fqn) // the copies carry the properties too
+		}
+	}
+	t.rtnamemap.unlockname(uname, true)
+	if errstr != "" {
+		t.invalmsghdlr(w, r, errstr, http.StatusInternalServerError)
+		return
+	}
+	glog.Infof("PATCH %s/%s: %+v", bucket, objname, meta)
+	jsbytes, err := json.Marshal(meta)
+	assert(err == nil, err)
+	t.writeJSON(w, r, jsbytes, "objmeta")
+}
+
+//
+// proxy
+//
+
+// PATCH /v1/objects/bucket-name/object-name
+func (p *proxyrunner) httpobjpatch(w http.ResponseWriter, r *http.Request) {
+	apitems := p.restAPIItems(r.URL.Path, 5)
+	if apitems = p.checkRestAPI(w, r, apitems, 2, Rversion, Robjects); apitems == nil {
+		return
+	}
+	bucket := apitems[0]
+	if !p.validatebckname(w, r, bucket) {
+		return
+	}
+	objname, ok := p.checkObjname(w, r)
+	if !ok {
+		return
+	}
+	pgroup := r.URL.Query().Get(URLParamPlacementGroup)
+	si, errstr := HrwTarget(bucket, hrwName(objname, pgroup), p.smapowner.get())
+	if errstr != "" {
+		p.invalmsghdlr(w, r, errstr)
+		return
+	}
+	p.metacache.invalidate(bucket, objname)
+	redirecturl := si.DirectURL + r.URL.EscapedPath()
+	if r.URL.RawQuery != "" {
+		redirecturl += "?" + r.URL.RawQuery
+	}
+	if glog.V(4) {
+		glog.Infof("%s %s/%s => %s", r.Method, bucket, objname, si.DaemonID)
+	}
+	http.Redirect(w, r, redirecturl, http.StatusTemporaryRedirect)
+}
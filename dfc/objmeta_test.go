@@ -0,0 +1,94 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestObjectMetaApply(t *testing.T) {
+	var (
+		pinned   = true
+		ttl      = "1h"
+		replicas = 2
+		now      = time.Date(2018, time.July, 1, 12, 0, 0, 0, time.UTC)
+		meta     = &ObjectMeta{}
+	)
+	if !meta.empty() || meta.expired(now) {
+		t.Fatal("Expected no properties")
+	}
+	patch := &ObjectMetaPatch{Pinned: &pinned, TTL: &ttl, Tags: map[string]string{"k1": "v1", "k2": "v2"}, Replicas: &replicas}
+	if errstr := meta.apply(patch, now); errstr != "" {
+		t.Fatal(errstr)
+	}
+	expected := &ObjectMeta{Pinned: true, Expires: "2018-07-01T13:00:00Z", Tags: map[string]string{"k1": "v1", "k2": "v2"}, Replicas: 2}
+	if !reflect.DeepEqual(meta, expected) {
+		t.Fatalf("Expected %+v, got %+v", expected, meta)
+	}
+	if meta.expired(now.Add(59*time.Minute)) || !meta.expired(now.Add(time.Hour)) {
+		t.Error("Expected the TTL to expire in an hour")
+	}
+
+	// nil fields are unchanged, empty values clear
+	pinned, ttl = false, ""
+	if errstr := meta.apply(&ObjectMetaPatch{Pinned: &pinned, TTL: &ttl, Tags: map[string]string{"k1": ""}}, now); errstr != "" {
+		t.Fatal(errstr)
+	}
+	expected = &ObjectMeta{Tags: map[string]string{"k2": "v2"}, Replicas: 2}
+	if !reflect.DeepEqual(meta, expected) {
+		t.Fatalf("Expected %+v, got %+v", expected, meta)
+	}
+
+	// invalid patches change nothing
+	badttl, badreplicas := "-1h", -1
+	for _, patch := range []*ObjectMetaPatch{
+		{TTL: &badttl},
+		{Replicas: &badreplicas},
+		{Pinned: &pinned, Tags: map[string]string{"": "v"}},
+	} {
+		if errstr := meta.apply(patch, now); errstr == "" {
+			t.Errorf("Expected %+v to fail", patch)
+		}
+	}
+	if !reflect.DeepEqual(meta, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, meta)
+	}
+}
+
+func TestObjectMetaXattr(t *testing.T) {
+	file, err := ioutil.TempFile("", "objmeta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+	defer os.Remove(file.Name())
+	fqn := file.Name()
+
+	meta := &ObjectMeta{Pinned: true, Tags: map[string]string{"owner": "dfc"}}
+	if errstr := setObjectMeta(fqn, meta); errstr != "" {
+		t.Skipf("Extended attributes are not supported: %s", errstr)
+	}
+	if stored, errstr := getObjectMeta(fqn); errstr != "" || !reflect.DeepEqual(stored, meta) {
+		t.Errorf("Expected %+v, got %+v (%s)", meta, stored, errstr)
+	}
+	meta.Tags["large"] = strings.Repeat("x", maxAttrSize)
+	if errstr := setObjectMeta(fqn, meta); errstr == "" {
+		t.Error("Expected too large properties to fail")
+	}
+	if errstr := setObjectMeta(fqn, &ObjectMeta{}); errstr != "" {
+		t.Fatal(errstr)
+	}
+	if val, _ := Getxattr(fqn, XattrObjMeta); val != nil {
+		t.Error("Expected empty properties to be removed")
+	}
+	if stored, errstr := getObjectMeta(fqn); errstr != "" || !stored.empty() {
+		t.Errorf("Expected no properties, got %+v (%s)", stored, errstr)
+	}
+}
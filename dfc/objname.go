@@ -0,0 +1,271 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/NVIDIA/dfcpub/3rdparty/glog"
+	"golang.org/x/text/unicode/norm"
+)
+
+// ============================= Background ==================================
+// Object names are validated and normalized by the proxy, the same way for
+// local and Cloud buckets, so that a name that cannot be stored fails with
+// 400 upfront rather than with a provider-specific error later:
+//   * slashes - leading and trailing slashes are allowed, rejected or trimmed
+//   * normalize - Unicode normalization form (NFC, NFD, NFKC, NFKD), so that
+//     differently composed names refer to the same object
+//   * max_length - in bytes, after normalization
+//   * charset - printable (valid UTF-8 sans control characters), ascii
+//     (printable ASCII) or safe (S3 "safe characters")
+// Empty, "." and ".." path segments are never allowed. Every request that
+// addresses an object (GET, HEAD, PUT, DELETE, PATCH, rename, restore, pin)
+// gets redirected with the normalized name; renaming requires the new name to
+// be normalized already; list, range, locate and HEAD-many operations
+// normalize the names and prefixes in their messages; listing normalizes the
+// prefix. The policy applies to all requests alike, so a stored object is
+// addressed the same way by all of them.
+// Older versions stored objects under HTML-escaped names ("a&b" as "a&amp;b")
+// placed by the escaped name. With legacy_escaped, a target that does not have
+// an object of a local bucket redirects GET, HEAD and DELETE to the target of
+// the escaped name; listing returns the escaped names, which remain valid.
+// ============================= Background ==================================
+
+const objnameMaxLength = 1024 // S3 and GCS limit
+
+// objnameconf.Charset enum
+const (
+	charsetPrintable = "printable"
+	charsetASCII     = "ascii"
+	charsetSafe      = "safe"
+)
+
+// objnameconf.Slashes enum
+const (
+	slashesAllow  = "allow"
+	slashesReject = "reject"
+	slashesTrim   = "trim"
+)
+
+var normForms = map[string]norm.Form{"nfc": norm.NFC, "nfd": norm.NFD, "nfkc": norm.NFKC, "nfkd": norm.NFKD}
+
+func validateObjnameConf(cnf *objnameconf) error {
+	if cnf.MaxLength < 0 {
+		return fmt.Errorf("Invalid objname max_length: %d", cnf.MaxLength)
+	}
+	if cnf.MaxLength == 0 {
+		cnf.MaxLength = objnameMaxLength
+	}
+	switch cnf.Charset {
+	case "":
+		cnf.Charset = charsetPrintable
+	case charsetPrintable, charsetASCII, charsetSafe:
+	default:
+		return fmt.Errorf("Invalid objname charset %q (expecting %s, %s or %s)", cnf.Charset, charsetPrintable, charsetASCII, charsetSafe)
+	}
+	if _, ok := normForms[cnf.Normalize]; !ok && cnf.Normalize != "" {
+		return fmt.Errorf("Invalid objname normalize %q (expecting nfc, nfd, nfkc or nfkd)", cnf.Normalize)
+	}
+	switch cnf.Slashes {
+	case "":
+		cnf.Slashes = slashesAllow
+	case slashesAllow, slashesReject, slashesTrim:
+	default:
+		return fmt.Errorf("Invalid objname slashes %q (expecting %s, %s or %s)", cnf.Slashes, slashesAllow, slashesReject, slashesTrim)
+	}
+	return nil
+}
+
+func allowedRune(charset string, r rune) bool {
+	switch charset {
+	case charsetASCII:
+		return r >= ' ' && r <= '~'
+	case charsetSafe:
+		return r < utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("!-_.*'()/", r))
+	}
+	return unicode.IsPrint(r)
+}
+
+// normalizeName applies the policy to an object name or, if prefix, to a
+// list prefix - the latter may be empty and end with a slash
+func normalizeName(cnf *objnameconf, name string, prefix bool) (string, error) {
+	if !utf8.ValidString(name) {
+		return "", fmt.Errorf("Invalid object name %q: not a valid UTF-8 string", name)
+	}
+	switch cnf.Slashes {
+	case slashesReject:
+		if strings.HasPrefix(name, "/") || (!prefix && strings.HasSuffix(name, "/")) {
+			return "", fmt.Errorf("Invalid object name %q: leading and trailing slashes are not allowed", name)
+		}
+	case slashesTrim:
+		if name = strings.TrimLeft(name, "/"); !prefix {
+			name = strings.TrimRight(name, "/")
+		}
+	}
+	if form, ok := normForms[cnf.Normalize]; ok {
+		name = form.String(name)
+	}
+	if name == "" {
+		if prefix {
+			return "", nil
+		}
+		return "", fmt.Errorf("Invalid object name: empty")
+	}
+	if len(name) > cnf.MaxLength {
+		return "", fmt.Errorf("Invalid object name %.64q...: longer than %d bytes", name, cnf.MaxLength)
+	}
+	for _, r := range name {
+		if !allowedRune(cnf.Charset, r) {
+			return "", fmt.Errorf("Invalid object name %q: character %q is not allowed (charset %s)", name, r, cnf.Charset)
+		}
+	}
+	segments := strings.Split(strings.TrimLeft(name, "/"), "/")
+	if prefix || strings.HasSuffix(name, "/") {
+		// the last segment of a prefix is incomplete, if any
+		segments = segments[:len(segments)-1]
+	}
+	for _, segment := range segments {
+		if segment == "" || segment == "." || segment == ".." {
+			return "", fmt.Errorf("Invalid object name %q: empty, \".\" and \"..\" path segments are not allowed", name)
+		}
+	}
+	return name, nil
+}
+
+//
+// target
+//
+
+// redirectLegacyName redirects the request for an object of a local bucket the
+// target does not have to the target of the object's HTML-escaped name, with
+// the escaped name; returns false if the name is the same escaped, the object
+// is not stored under it, or the lookup is disabled
+func (t *targetrunner) redirectLegacyName(w http.ResponseWriter, r *http.Request, bucket, objname string) bool {
+	if !ctx.config.Objname.LegacyEscaped {
+		return false
+	}
+	// an escaped name is not escaped again, so that a missing object takes one redirect at most
+	legacy := html.EscapeString(objname)
+	if legacy == objname || html.UnescapeString(objname) != objname {
+		return false
+	}
+	si, errstr := HrwTarget(bucket, legacy, t.smapowner.get())
+	if errstr != "" {
+		return false
+	}
+	if si.DaemonID == t.si.DaemonID {
+		if _, exists := t.findfqn(bucket, legacy, true); !exists {
+			return false
+		}
+	}
+	redirecturl := si.DirectURL + URLEscapedPath(Rversion, Robjects, bucket, legacy)
+	if r.URL.RawQuery != "" {
+		redirecturl += "?" + r.URL.RawQuery
+	}
+	if glog.V(4) {
+		glog.Infof("%s %s/%s => %s (legacy name %s)", r.Method, bucket, objname, si.DaemonID, legacy)
+	}
+	http.Redirect(w, r, redirecturl, http.StatusTemporaryRedirect)
+	return true
+}
+
+//
+// proxy
+//
+
+// checkObjname validates the object name of the request and, if normalized,
+// rewrites the request path
+func (p *proxyrunner) checkObjname(w http.ResponseWriter, r *http.Request) (objname string, ok bool) {
+	split := strings.SplitN(r.URL.Path, "/", 5) // "", version, objects, bucket, object name
+	if len(split) < 5 {
+		p.invalmsghdlr(w, r, "Invalid object name: empty")
+		return
+	}
+	raw := split[4]
+	normalized, err := normalizeName(&ctx.config.Objname, raw, false)
+	if err != nil {
+		p.invalmsghdlr(w, r, err.Error())
+		return
+	}
+	if normalized != raw {
+		split[4] = normalized
+		r.URL.Path = strings.Join(split, "/")
+		r.URL.RawPath = ""
+	}
+	return normalized, true
+}
+
+// checkRename requires the new name of a renamed object to be valid and normalized
+func (p *proxyrunner) checkRename(w http.ResponseWriter, r *http.Request, newname string) bool {
+	normalized, err := normalizeName(&ctx.config.Objname, newname, false)
+	if err == nil && normalized != newname {
+		err = fmt.Errorf("Invalid object name %q: not normalized (expecting %q)", newname, normalized)
+	}
+	if err != nil {
+		p.invalmsghdlr(w, r, err.Error())
+		return false
+	}
+	return true
+}
+
+// normalizeObjnames normalizes, in place, the object names of a list message
+func normalizeObjnames(objnames []string) error {
+	for i, objname := range objnames {
+		normalized, err := normalizeName(&ctx.config.Objname, objname, false)
+		if err != nil {
+			return err
+		}
+		objnames[i] = normalized
+	}
+	return nil
+}
+
+// normalizeListRange normalizes, in place, the object names or the prefix of
+// a list or range operation message
+func normalizeListRange(jsmap map[string]interface{}) error {
+	if objnames, ok := jsmap["objnames"].([]interface{}); ok {
+		for i, v := range objnames {
+			objname, ok := v.(string)
+			if !ok {
+				continue // fails parsing
+			}
+			normalized, err := normalizeName(&ctx.config.Objname, objname, false)
+			if err != nil {
+				return err
+			}
+			objnames[i] = normalized
+		}
+	}
+	if prefix, ok := jsmap["prefix"].(string); ok {
+		normalized, err := normalizeName(&ctx.config.Objname, prefix, true)
+		if err != nil {
+			return err
+		}
+		jsmap["prefix"] = normalized
+	}
+	return nil
+}
+
+// normalizeListPrefix returns the list message with the prefix normalized
+func normalizeListPrefix(listmsgjson []byte) ([]byte, error) {
+	var getmsg GetMsg
+	if err := json.Unmarshal(listmsgjson, &getmsg); err != nil || getmsg.GetPrefix == "" {
+		return listmsgjson, nil
+	}
+	prefix, err := normalizeName(&ctx.config.Objname, getmsg.GetPrefix, true)
+	if err != nil || prefix == getmsg.GetPrefix {
+		return listmsgjson, err
+	}
+	getmsg.GetPrefix = prefix
+	return json.Marshal(&getmsg)
+}
@@ -0,0 +1,183 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeName(t *testing.T) {
+	const composed, decomposed = "caf\u00e9", "cafe\u0301"
+	for _, test := range []struct {
+		cnf        objnameconf
+		name       string
+		prefix     bool
+		normalized string
+		ok         bool
+	}{
+		{objnameconf{}, "a/b c/d.tar", false, "a/b c/d.tar", true},
+		{objnameconf{}, "/a/b/", false, "/a/b/", true},
+		{objnameconf{}, "a//b", false, "", false},
+		{objnameconf{}, "a/../b", false, "", false},
+		{objnameconf{}, "./a", false, "", false},
+		{objnameconf{}, "a\nb", false, "", false},
+		{objnameconf{}, "a\xffb", false, "", false},
+		{objnameconf{}, "", false, "", false},
+		{objnameconf{}, "", true, "", true},
+		{objnameconf{}, "a/", true, "a/", true},
+		{objnameconf{}, "a/..", true, "a/..", true},
+		{objnameconf{}, "a/../", true, "", false},
+		{objnameconf{Slashes: slashesReject}, "/a", false, "", false},
+		{objnameconf{Slashes: slashesReject}, "a/", false, "", false},
+		{objnameconf{Slashes: slashesReject}, "a/", true, "a/", true},
+		{objnameconf{Slashes: slashesTrim}, "//a/b/", false, "a/b", true},
+		{objnameconf{Slashes: slashesTrim}, "/a/", true, "a/", true},
+		{objnameconf{Slashes: slashesTrim}, "/", false, "", false},
+		{objnameconf{Normalize: "nfc"}, decomposed, false, composed, true},
+		{objnameconf{Normalize: "nfd"}, composed, false, decomposed, true},
+		{objnameconf{Charset: charsetASCII}, composed, false, "", false},
+		{objnameconf{Charset: charsetSafe}, "a/b-c_d.(1)*'!", false, "a/b-c_d.(1)*'!", true},
+		{objnameconf{Charset: charsetSafe}, "a b", false, "", false},
+		{objnameconf{MaxLength: 4}, "abcd", false, "abcd", true},
+		{objnameconf{MaxLength: 4}, "abcde", false, "", false},
+		{objnameconf{MaxLength: 5, Normalize: "nfd"}, composed, false, "", false},
+	} {
+		cnf := test.cnf
+		if err := validateObjnameConf(&cnf); err != nil {
+			t.Fatal(err)
+		}
+		normalized, err := normalizeName(&cnf, test.name, test.prefix)
+		if (err == nil) != test.ok || normalized != test.normalized {
+			t.Errorf("%+v %q (prefix %t): expected %q (ok=%t), got %q, err: %v",
+				test.cnf, test.name, test.prefix, test.normalized, test.ok, normalized, err)
+		}
+	}
+}
+
+func TestValidateObjnameConf(t *testing.T) {
+	cnf := &objnameconf{}
+	if err := validateObjnameConf(cnf); err != nil {
+		t.Fatal(err)
+	}
+	if cnf.MaxLength != objnameMaxLength || cnf.Charset != charsetPrintable || cnf.Slashes != slashesAllow {
+		t.Errorf("Unexpected defaults %+v", cnf)
+	}
+	for _, cnf := range []objnameconf{{MaxLength: -1}, {Charset: "utf8"}, {Normalize: "nfx"}, {Slashes: "keep"}} {
+		if err := validateObjnameConf(&cnf); err == nil {
+			t.Errorf("Expected %+v to fail", cnf)
+		}
+	}
+}
+
+func TestCheckObjname(t *testing.T) {
+	oldcnf := ctx.config.Objname
+	defer func() { ctx.config.Objname = oldcnf }()
+	ctx.config.Objname = objnameconf{Normalize: "nfc", Slashes: slashesTrim}
+	if err := validateObjnameConf(&ctx.config.Objname); err != nil {
+		t.Fatal(err)
+	}
+	p := &proxyrunner{}
+	p.statsif = &proxystatsrunner{}
+	r := httptest.NewRequest(http.MethodGet, "/v1/objects/bucket/cafe%CC%81/a&b/", nil)
+	objname, ok := p.checkObjname(httptest.NewRecorder(), r)
+	if !ok || objname != "caf\u00e9/a&b" || r.URL.Path != "/v1/objects/bucket/caf\u00e9/a&b" {
+		t.Errorf("Unexpected %q (ok=%t), path %q", objname, ok, r.URL.Path)
+	}
+	w := httptest.NewRecorder()
+	if _, ok = p.checkObjname(w, httptest.NewRequest(http.MethodGet, "/v1/objects/bucket/a/../b", nil)); ok || w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400, got %d", w.Code)
+	}
+
+	listmsgjson, _ := json.Marshal(&GetMsg{GetPrefix: "/cafe\u0301/", GetProps: "size"})
+	normalized, err := normalizeListPrefix(listmsgjson)
+	if err != nil || !strings.Contains(string(normalized), "\"prefix\":\"caf\u00e9/\"") || !strings.Contains(string(normalized), `"props":"size"`) {
+		t.Errorf("Unexpected list message %s, err: %v", normalized, err)
+	}
+}
+
+func TestObjnameRoutes(t *testing.T) {
+	oldcnf := ctx.config.Objname
+	defer func() { ctx.config.Objname = oldcnf }()
+	ctx.config.Objname = objnameconf{Normalize: "nfc"}
+	if err := validateObjnameConf(&ctx.config.Objname); err != nil {
+		t.Fatal(err)
+	}
+	p := &proxyrunner{}
+	p.statsif = &proxystatsrunner{}
+	p.bmdowner = &bmdowner{}
+	p.bmdowner.put(newBucketMD())
+	p.smapowner = &smapowner{}
+	smap := newSmap()
+	smap.addTarget(&daemonInfo{DaemonID: "t1", DirectURL: "http://t1:8081"})
+	p.smapowner.put(smap)
+
+	// DELETE is redirected with the normalized name, like GET
+	w := httptest.NewRecorder()
+	p.httpobjdelete(w, httptest.NewRequest(http.MethodDelete, "/v1/objects/bucket/cafe%CC%81", nil))
+	if loc := w.Header().Get("Location"); w.Code != http.StatusTemporaryRedirect || loc != "http://t1:8081/v1/objects/bucket/caf%C3%A9" {
+		t.Errorf("Unexpected %d, location %q", w.Code, loc)
+	}
+	w = httptest.NewRecorder()
+	p.httpobjdelete(w, httptest.NewRequest(http.MethodDelete, "/v1/objects/bucket/a/../b", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400, got %d", w.Code)
+	}
+
+	jsmap := map[string]interface{}{"objnames": []interface{}{"a", "cafe\u0301"}, "prefix": "cafe\u0301/"}
+	if err := normalizeListRange(jsmap); err != nil {
+		t.Fatal(err)
+	}
+	if objnames := jsmap["objnames"].([]interface{}); objnames[1] != "caf\u00e9" || jsmap["prefix"] != "caf\u00e9/" {
+		t.Errorf("Unexpected list message %v", jsmap)
+	}
+	objnames := []string{"cafe\u0301", "a//b"}
+	if err := normalizeObjnames(objnames); err == nil || objnames[0] != "caf\u00e9" {
+		t.Errorf("Unexpected %v, err: %v", objnames, err)
+	}
+}
+
+func TestRedirectLegacyName(t *testing.T) {
+	oldcnf := ctx.config.Objname
+	defer func() { ctx.config.Objname = oldcnf }()
+	ctx.config.Objname.LegacyEscaped = true
+	target := &targetrunner{}
+	target.si = &daemonInfo{DaemonID: "t1", DirectURL: "http://t1:8081"}
+	target.smapowner = &smapowner{}
+	smap := newSmap()
+	smap.addTarget(target.si)
+	smap.addTarget(&daemonInfo{DaemonID: "t2", DirectURL: "http://t2:8081"})
+	target.smapowner.put(smap)
+
+	// an object whose escaped name is placed on the other target
+	var objname string
+	for i := 0; ; i++ {
+		objname = fmt.Sprintf("a&b/%d", i)
+		if si, _ := HrwTarget("bucket", html.EscapeString(objname), smap); si.DaemonID == "t2" {
+			break
+		}
+	}
+	r := httptest.NewRequest(http.MethodGet, "/v1/objects/bucket/x?local=true", nil)
+	w := httptest.NewRecorder()
+	expected := "http://t2:8081/v1/objects/bucket/" + html.EscapeString(objname) + "?local=true"
+	if !target.redirectLegacyName(w, r, "bucket", objname) || w.Header().Get("Location") != expected {
+		t.Errorf("Expected redirect to %s, got %d %q", expected, w.Code, w.Header().Get("Location"))
+	}
+	// nothing to look up
+	for _, name := range []string{"a/b", "a&amp;b"} {
+		if target.redirectLegacyName(httptest.NewRecorder(), r, "bucket", name) {
+			t.Errorf("Unexpected redirect of %s", name)
+		}
+	}
+	ctx.config.Objname.LegacyEscaped = false
+	if target.redirectLegacyName(httptest.NewRecorder(), r, "bucket", objname) {
+		t.Error("Unexpected redirect with legacy_escaped off")
+	}
+}
@@ -0,0 +1,154 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+// Target object walk - enumerates the objects stored by a target as they are
+// on its mountpaths: fqn, bucket, name, size and stored checksum. External
+// backup and verification tools send GET /v1/daemon?what=objects directly to
+// the target, optionally for one bucket, and get the objects page by page.
+// The objects are visited in the order filepath.Walk visits them, which is
+// the order of the fqns compared by path components (see fqnLess); the marker
+// of a page is the fqn of its last object, so a walk can be resumed from any
+// page, e.g. after the tool or the target restarts, even if the object itself
+// has been removed in the meantime. Objects that are not where HRW would put
+// them (being rebalanced, displaced) are listed as well; work files are not.
+// Subsystems that visit all objects of a target can use walkObjects directly.
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const objwalkLimit = 1000 // default number of objects in a page
+
+var errWalkStop = errors.New("walk stopped")
+
+// fqnLess compares paths by their components, as filepath.Walk visits them
+func fqnLess(a, b string) bool {
+	ac, bc := strings.Split(a, "/"), strings.Split(b, "/")
+	for i := 0; i < len(ac) && i < len(bc); i++ {
+		if ac[i] != bc[i] {
+			return ac[i] < bc[i]
+		}
+	}
+	return len(ac) < len(bc)
+}
+
+// walkedBefore tells whether all the objects under the path precede the marker
+func walkedBefore(path, marker string) bool {
+	return marker != "" && fqnLess(path, marker) && !strings.HasPrefix(marker, path+"/")
+}
+
+// walkObjects calls fn for the objects stored by the target that follow the
+// marker, in the walk order, until fn returns false; bucket "" - all buckets
+func (t *targetrunner) walkObjects(bucket, marker string, fn func(obj *RawObject) bool) error {
+	type root struct {
+		dir     string // the directory of the buckets
+		islocal bool
+	}
+	roots := make([]root, 0, 2*len(ctx.mountpaths.Available))
+	for mpath := range ctx.mountpaths.Available {
+		roots = append(roots, root{makePathCloud(mpath), false}, root{makePathLocal(mpath), true})
+	}
+	sort.Slice(roots, func(i, j int) bool { return fqnLess(roots[i].dir, roots[j].dir) })
+
+	for _, root := range roots {
+		top := root.dir
+		if bucket != "" {
+			top = filepath.Join(root.dir, bucket)
+		}
+		if walkedBefore(top, marker) {
+			continue
+		}
+		err := filepath.Walk(top, func(fqn string, finfo os.FileInfo, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			if finfo.IsDir() {
+				if walkedBefore(fqn, marker) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if marker != "" && !fqnLess(marker, fqn) {
+				return nil
+			}
+			if iswork, _ := t.isworkfile(fqn); iswork {
+				return nil
+			}
+			items := strings.SplitN(strings.TrimPrefix(fqn, root.dir+"/"), "/", 2)
+			if len(items) < 2 {
+				return nil // not in a bucket directory
+			}
+			obj := &RawObject{FQN: fqn, Bucket: items[0], Name: items[1], IsLocal: root.islocal, Size: objectSize(fqn, finfo)}
+			if cksum, errstr := Getxattr(fqn, XattrXXHashVal); errstr == "" && cksum != nil {
+				obj.Checksum = string(cksum)
+			}
+			if !fn(obj) {
+				return errWalkStop
+			}
+			return nil
+		})
+		if err == errWalkStop {
+			return nil
+		}
+		if err != nil {
+			t.runFSKeeper(top)
+			return err
+		}
+	}
+	return nil
+}
+
+// walkPage returns up to limit objects that follow the marker
+func (t *targetrunner) walkPage(bucket, marker string, limit int) (*ObjectWalkPage, error) {
+	page := &ObjectWalkPage{Objects: make([]*RawObject, 0, limit)}
+	err := t.walkObjects(bucket, marker, func(obj *RawObject) bool {
+		if len(page.Objects) == limit {
+			// there is at least one more object
+			page.Marker = page.Objects[limit-1].FQN
+			return false
+		}
+		page.Objects = append(page.Objects, obj)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// GET /v1/daemon?what=objects
+func (t *targetrunner) httpwalk(w http.ResponseWriter, r *http.Request) (page *ObjectWalkPage, ok bool) {
+	var (
+		q     = r.URL.Query()
+		limit = objwalkLimit
+		err   error
+	)
+	if s := q.Get(URLParamLimit); s != "" {
+		if limit, err = strconv.Atoi(s); err != nil || limit <= 0 || limit > MaxPageSize {
+			t.invalmsghdlr(w, r, "Invalid "+URLParamLimit+": "+s)
+			return
+		}
+	}
+	bucket := q.Get(URLParamBucket)
+	if bucket != "" && !t.validatebckname(w, r, bucket) {
+		return
+	}
+	if page, err = t.walkPage(bucket, q.Get(URLParamMarker), limit); err != nil {
+		t.invalmsghdlr(w, r, "Failed to walk the objects, err: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	return page, true
+}
@@ -0,0 +1,128 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestFqnLess(t *testing.T) {
+	for _, test := range []struct {
+		a, b string
+		less bool
+	}{
+		{"/m/a/b/c", "/m/a/b-x", true}, // unlike the strings: '/' > '-'
+		{"/m/a/b", "/m/a/b/c", true},
+		{"/m/a/b/c", "/m/a/b", false},
+		{"/m/a", "/m/a", false},
+		{"/m1/z", "/m2/a", true},
+	} {
+		if fqnLess(test.a, test.b) != test.less {
+			t.Errorf("fqnLess(%q, %q): expected %t", test.a, test.b, test.less)
+		}
+	}
+}
+
+func TestWalkObjects(t *testing.T) {
+	var mpaths []string
+	oldavail, oldlocal, oldcloud := ctx.mountpaths.Available, ctx.config.LocalBuckets, ctx.config.CloudBuckets
+	defer func() {
+		ctx.mountpaths.Available, ctx.config.LocalBuckets, ctx.config.CloudBuckets = oldavail, oldlocal, oldcloud
+	}()
+	ctx.mountpaths.Available = make(map[string]*mountPath)
+	ctx.config.LocalBuckets, ctx.config.CloudBuckets = "local", "cloud"
+	for i := 0; i < 2; i++ {
+		mpath, err := ioutil.TempDir("", "objwalk")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(mpath)
+		ctx.mountpaths.Available[mpath] = &mountPath{Path: mpath}
+		mpaths = append(mpaths, mpath)
+	}
+	target, _ := newTestTarget(nil)
+
+	var all []string
+	for _, mpath := range mpaths {
+		for _, islocal := range []bool{false, true} {
+			for _, objname := range []string{"a/b/c", "a/b-x", "a/bz", "top", "d/e/f/g"} {
+				bucket := "cloudbucket"
+				if islocal {
+					bucket = "localbucket"
+				}
+				fqn := mpath2fqn(mpath, bucket, objname, islocal)
+				if err := CreateDir(filepath.Dir(fqn)); err != nil {
+					t.Fatal(err)
+				}
+				if err := ioutil.WriteFile(fqn, []byte(objname), 0644); err != nil {
+					t.Fatal(err)
+				}
+				all = append(all, fqn)
+			}
+		}
+		workfqn := filepath.Join(makePathLocal(mpath), "localbucket", workfileprefix+"top.1f")
+		if err := ioutil.WriteFile(workfqn, []byte("work"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sort.Slice(all, func(i, j int) bool { return fqnLess(all[i], all[j]) })
+
+	for limit := 1; limit <= len(all)+1; limit++ {
+		var (
+			walked []string
+			marker string
+			pages  int
+		)
+		for {
+			page, err := target.walkPage("", marker, limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pages++
+			for _, obj := range page.Objects {
+				walked = append(walked, obj.FQN)
+			}
+			if page.Marker == "" {
+				break
+			}
+			marker = page.Marker
+		}
+		if !reflect.DeepEqual(walked, all) {
+			t.Fatalf("Limit %d: walked %v, expected %v", limit, walked, all)
+		}
+		if expected := (len(all) + limit - 1) / limit; pages != expected {
+			t.Errorf("Limit %d: walked %d pages, expected %d", limit, pages, expected)
+		}
+	}
+
+	// one bucket, resumed after the marker object is removed
+	page, err := target.walkPage("localbucket", "", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	obj := page.Objects[1]
+	if obj.Bucket != "localbucket" || !obj.IsLocal || obj.Size != int64(len(obj.Name)) {
+		t.Fatalf("Unexpected object %+v", obj)
+	}
+	if err = os.Remove(page.Marker); err != nil {
+		t.Fatal(err)
+	}
+	if page, err = target.walkPage("localbucket", page.Marker, 100); err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Objects) != len(all)/2-2 || page.Marker != "" {
+		t.Fatalf("Expected the rest of %d objects, got %d", len(all)/2-2, len(page.Objects))
+	}
+	for _, obj := range page.Objects {
+		if obj.Bucket != "localbucket" {
+			t.Errorf("Unexpected object %+v", obj)
+		}
+	}
+}
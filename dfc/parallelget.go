@@ -0,0 +1,220 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/NVIDIA/dfcpub/3rdparty/glog"
+	"github.com/OneOfOne/xxhash"
+)
+
+// Parallel cold GET: a cloud provider that knows the object size before
+// downloading it (see coldgetconf) reads large objects with concurrent range
+// requests, each writing its part at the part's offset in the local file.
+// The parts cannot be checksummed as they arrive; the checksum is computed by
+// reading the file back - or offloaded to the scrubber (see checksum offload)
+
+// partReader returns the object's data in the range [offset, offset+length)
+type partReader func(ct context.Context, offset, length int64) (io.ReadCloser, *Error)
+
+// offsetWriter writes sequentially to the file starting at the offset
+type offsetWriter struct {
+	file   *os.File
+	offset int64
+}
+
+func (w *offsetWriter) Write(p []byte) (n int, err error) {
+	n, err = w.file.WriteAt(p, w.offset)
+	w.offset += int64(n)
+	return
+}
+
+// Returns true if large objects of the bucket are to be downloaded in parts
+func (t *targetrunner) parallelColdGet(bucket string) bool {
+	conf := &ctx.config.ColdGet
+	// encryption is a stream: parts cannot be encrypted independently
+	return conf.PartSize > 0 && conf.Concurrency > 1 && !t.encryptionEnabled(bucket)
+}
+
+// receiveParts downloads the object in parts and checksums (or, with checksum
+// offload, schedules verification of) the result
+func (t *targetrunner) receiveParts(ct context.Context, fqn, bucket, objname string, size int64,
+	cksum cloudCksum, ohobj cksumvalue, props *objectProps, getpart partReader) (cerr *Error) {
+	if errstr := t.faults.diskWriteError(fqn); errstr != "" {
+		return NewError(http.StatusInternalServerError, "%s", errstr)
+	}
+	file, err := CreateFile(fqn)
+	if err != nil {
+		t.runFSKeeper(fqn)
+		return NewError(http.StatusInternalServerError, "Failed to create %s, err: %v", fqn, err)
+	}
+	defer func() {
+		if cerr == nil {
+			return
+		}
+		t.runFSKeeper(fqn)
+		if err := os.Remove(fqn); err != nil {
+			glog.Errorf("Nested error %s => (remove %s => err: %v)", cerr, fqn, err)
+		}
+	}()
+	if err = file.Truncate(size); err != nil {
+		file.Close()
+		return NewError(http.StatusInternalServerError, "Failed to allocate %s, err: %v", fqn, err)
+	}
+	cerr = t.downloadParts(ct, file, size, getpart)
+	if err = file.Close(); err != nil && cerr == nil {
+		cerr = NewError(http.StatusInternalServerError, "Failed to close received file %s, err: %v", fqn, err)
+	}
+	if cerr != nil {
+		return
+	}
+	props.size = size
+	if offloadCksum(cksum) {
+		props.cloudcksum = cksum.String()
+		return
+	}
+	var omd5 string
+	if cksum.kind == CloudCksumMD5 {
+		omd5 = cksum.val
+	}
+	props.nhobj, cerr = t.cksumReceived(fqn, objname, omd5, ohobj)
+	return
+}
+
+func (t *targetrunner) downloadParts(ct context.Context, file *os.File, size int64, getpart partReader) (cerr *Error) {
+	var (
+		conf        = &ctx.config.ColdGet
+		offsets     = make(chan int64, (size+conf.PartSize-1)/conf.PartSize)
+		wg          = &sync.WaitGroup{}
+		mtx         sync.Mutex
+		cancelct, c = context.WithCancel(ct)
+	)
+	defer c()
+	for offset := int64(0); offset < size; offset += conf.PartSize {
+		offsets <- offset
+	}
+	close(offsets)
+	fail := func(err *Error) {
+		mtx.Lock()
+		if cerr == nil {
+			cerr = err
+			c()
+		}
+		mtx.Unlock()
+	}
+	for i := 0; i < conf.Concurrency && i < cap(offsets); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			slab := selectslab(conf.PartSize)
+			buf := slab.alloc()
+			defer slab.free(buf)
+			for offset := range offsets {
+				if cancelct.Err() != nil {
+					return
+				}
+				length := conf.PartSize
+				if offset+length > size {
+					length = size - offset
+				}
+				if err := downloadPart(cancelct, file, offset, length, buf, getpart); err != nil {
+					fail(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return
+}
+
+func downloadPart(ct context.Context, file *os.File, offset, length int64, buf []byte, getpart partReader) *Error {
+	rc, cerr := getpart(ct, offset, length)
+	if cerr != nil {
+		return cerr
+	}
+	defer rc.Close()
+	n, err := io.CopyBuffer(&offsetWriter{file: file, offset: offset}, io.LimitReader(rc, length), buf)
+	if err != nil {
+		return NewError(http.StatusInternalServerError, "Failed to receive part [%d, %d) of %s, err: %v",
+			offset, offset+length, file.Name(), err)
+	}
+	if n != length {
+		return NewError(http.StatusBadGateway, "Part [%d, %d) of %s: received %d bytes",
+			offset, offset+length, file.Name(), n)
+	}
+	return nil
+}
+
+// cksumReceived computes the checksum of the received object and validates it
+// the same way receive does
+func (t *targetrunner) cksumReceived(fqn, objname, omd5 string, ohobj cksumvalue) (nhobj cksumvalue, cerr *Error) {
+	var (
+		cksumcfg = &ctx.config.Cksum
+		xx       hash.Hash64
+		md       hash.Hash
+		hashes   []hash.Hash
+	)
+	if cksumcfg.Checksum != ChecksumNone {
+		xx = xxhash.New64()
+		hashes = append(hashes, xx)
+	} else if omd5 != "" && cksumcfg.ValidateColdGet {
+		md = md5.New()
+		hashes = append(hashes, md)
+	}
+	if len(hashes) == 0 {
+		return
+	}
+	file, err := os.Open(fqn)
+	if err != nil {
+		return nil, NewError(http.StatusInternalServerError, "Failed to read %s, err: %v", fqn, err)
+	}
+	slab := selectslab(0)
+	buf := slab.alloc()
+	written, errstr := ReceiveAndChecksum(ioutil.Discard, file, buf, hashes...)
+	slab.free(buf)
+	file.Close()
+	if errstr != "" {
+		return nil, NewError(http.StatusInternalServerError, "%s", errstr)
+	}
+	if xx != nil {
+		b := make([]byte, 8)
+		binary.BigEndian.PutUint64(b, xx.Sum64())
+		nhval := hex.EncodeToString(b)
+		nhobj = newcksumvalue(ChecksumXXHash, nhval)
+		if ohobj == nil {
+			return
+		}
+		if _, ohval := ohobj.get(); ohval != nhval {
+			t.statsif.addMany("numbadchecksum", int64(1), "bytesbadchecksum", written)
+			return nil, NewError(http.StatusInternalServerError, "Bad checksum: %s %s %s... != %s... computed for the %q",
+				objname, cksumcfg.Checksum, ohval[:8], nhval[:8], fqn)
+		}
+		return
+	}
+	if md5hash := hex.EncodeToString(md.Sum(nil)); md5hash != omd5 {
+		t.statsif.addMany("numbadchecksum", int64(1), "bytesbadchecksum", written)
+		return nil, NewError(http.StatusInternalServerError, "Bad checksum: cold GET %s md5 %s... != %s... computed for the %q",
+			objname, omd5[:8], md5hash[:8], fqn)
+	}
+	return
+}
+
+// rangeHeader returns the HTTP Range of the part
+func rangeHeader(offset, length int64) string {
+	return fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)
+}
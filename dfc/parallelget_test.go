@@ -0,0 +1,93 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ */
+package dfc
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParallelColdGet(t *testing.T) {
+	const bucket = "mockbucket"
+	dir, err := ioutil.TempDir("", "parallelget")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	oldcksum, oldcoldget := ctx.config.Cksum, ctx.config.ColdGet
+	defer func() { ctx.config.Cksum, ctx.config.ColdGet = oldcksum, oldcoldget }()
+	ctx.config.Cksum = cksumconfig{Checksum: ChecksumXXHash}
+
+	target := &targetrunner{}
+	target.bmdowner = &bmdowner{}
+	target.bmdowner.put(newBucketMD())
+	m := newMockCloud(target, bucket)
+	ct := context.Background()
+	data := make([]byte, 95)
+	rand.New(rand.NewSource(1)).Read(data)
+	if _, cerr := m.putobj(ct, bytes.NewReader(data), bucket, "obj", nil); cerr != nil {
+		t.Fatal(cerr)
+	}
+
+	// single stream
+	ctx.config.ColdGet = coldgetconf{}
+	fqn := filepath.Join(dir, "obj")
+	expected, cerr := m.getobj(ct, fqn, bucket, "obj")
+	if cerr != nil {
+		t.Fatal(cerr)
+	}
+	if n := m.numCalls("getpart"); n != 0 {
+		t.Errorf("Expected single stream GET, got %d parts", n)
+	}
+
+	ctx.config.ColdGet = coldgetconf{PartSize: 10, Concurrency: 3}
+	fqn = filepath.Join(dir, "parts")
+	props, cerr := m.getobj(ct, fqn, bucket, "obj")
+	if cerr != nil {
+		t.Fatal(cerr)
+	}
+	if n := m.numCalls("getpart"); n != 10 {
+		t.Errorf("Expected 10 parts, got %d", n)
+	}
+	if local, err := ioutil.ReadFile(fqn); err != nil || !bytes.Equal(local, data) {
+		t.Errorf("Local copy differs from the cloud object, err: %v", err)
+	}
+	if props.size != int64(len(data)) || props.nhobj == nil {
+		t.Fatalf("Unexpected object properties %+v", props)
+	}
+	_, want := expected.nhobj.get()
+	if _, val := props.nhobj.get(); val != want {
+		t.Errorf("Expected checksum %s, got %s", want, val)
+	}
+
+	// checksum offload
+	ctx.config.Cksum.OffloadColdGet = true
+	if props, cerr = m.getobj(ct, fqn, bucket, "obj"); cerr != nil {
+		t.Fatal(cerr)
+	}
+	if props.nhobj != nil || props.cloudcksum == "" {
+		t.Errorf("Expected the object not to be checksummed, got %+v", props)
+	}
+	ctx.config.Cksum.OffloadColdGet = false
+
+	// a failed part fails the GET and removes the file
+	m.failRate = 1
+	fqn = filepath.Join(dir, "failed")
+	if _, cerr = m.getobj(ct, fqn, bucket, "obj"); cerr == nil {
+		t.Fatal("Expected GET to fail")
+	}
+	if _, err = os.Stat(fqn); !os.IsNotExist(err) {
+		t.Errorf("Expected %s to be removed, err: %v", fqn, err)
+	}
+
+	ctx.config.ColdGet.Concurrency = 1
+	if target.parallelColdGet(bucket) {
+		t.Error("Expected parallel cold GET to be disabled with concurrency 1")
+	}
+}
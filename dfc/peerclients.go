@@ -0,0 +1,193 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+// Intra-cluster HTTP clients and their connection pools.
+// By default, all requests to other daemons share two clients - with the
+// default and the long timeout - whose transports keep a few idle connections
+// per peer: in a large, busy cluster connections keep being closed and dialed
+// again. With netconfig.http.pool.per_peer, every peer gets clients with a
+// transport, and therefore a connection pool, of its own. The pool size, the
+// dial, TLS handshake, response header and idle connection timeouts are
+// configurable (netconfig.http.pool) in both modes. Every transport counts
+// the connections it dials and reuses and the connections that are open;
+// GET /v1/daemon?what=connpool returns the counters per peer (per_peer) or of
+// the shared clients, and the core stats include the totals.
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ID of the shared clients in ConnPoolStats
+const sharedClientsID = "*"
+
+type (
+	peerClient struct {
+		short     *http.Client // the default timeout
+		long      *http.Client // the long timeout
+		transport *http.Transport
+		stats     PeerConnStats // atomic
+	}
+	peerClients struct {
+		mtx   sync.Mutex
+		m     map[string]*peerClient // daemon ID => clients
+		smapv int64                  // version of the Smap the clients were last pruned with
+	}
+	// countingTransport counts the reused connections
+	countingTransport struct {
+		*http.Transport
+		pc      *peerClient
+		statsif statsif
+	}
+	// countedConn counts the open connections
+	countedConn struct {
+		net.Conn
+		pc   *peerClient
+		once sync.Once
+	}
+)
+
+func (h *httprunner) newPeerClient(perhost, numDaemons int) *peerClient {
+	pc := &peerClient{}
+	pc.transport = h.createTransport(perhost, numDaemons)
+	dialer := &net.Dialer{
+		Timeout:   ctx.config.Net.HTTP.Pool.DialTimeout,
+		KeepAlive: 30 * time.Second,
+		DualStack: true,
+	}
+	pc.transport.DialContext = func(c context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dialer.DialContext(c, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		atomic.AddInt64(&pc.stats.Dialed, 1)
+		atomic.AddInt64(&pc.stats.Open, 1)
+		h.statsif.add("numconndial", 1)
+		return &countedConn{Conn: conn, pc: pc}, nil
+	}
+	transport := &countingTransport{Transport: pc.transport, pc: pc, statsif: h.statsif}
+	pc.short = &http.Client{Transport: transport, Timeout: ctx.config.Timeout.Default}
+	pc.long = &http.Client{Transport: transport, Timeout: ctx.config.Timeout.DefaultLong}
+	return pc
+}
+
+func (h *httprunner) createTransport(perhost, numDaemons int) *http.Transport {
+	pool := &ctx.config.Net.HTTP.Pool
+	if pool.MaxIdleConnsPerPeer > 0 {
+		perhost = pool.MaxIdleConnsPerPeer
+	}
+	defaultTransport := http.DefaultTransport.(*http.Transport)
+	transport := &http.Transport{
+		// defaults
+		Proxy: defaultTransport.Proxy,
+		DialContext: (&net.Dialer{ // defaultTransport.DialContext,
+			Timeout:   pool.DialTimeout,
+			KeepAlive: 30 * time.Second,
+			DualStack: true,
+		}).DialContext,
+		ExpectContinueTimeout: defaultTransport.ExpectContinueTimeout,
+		// configurable
+		IdleConnTimeout:       pool.IdleConnTimeout,
+		TLSHandshakeTimeout:   pool.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: pool.ResponseHeaderTimeout,
+		MaxIdleConnsPerHost:   perhost,
+		MaxIdleConns:          perhost * numDaemons,
+	}
+	if ctx.config.Net.HTTP.UseHTTPS {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	return transport
+}
+
+// client returns the client for requests to the peer: its own if per-peer
+// clients are configured, the shared one otherwise. A runner that has only
+// the plain clients set (as unit tests do) uses them
+func (h *httprunner) client(si *daemonInfo, long bool) *http.Client {
+	pc := h.sharedClient
+	if ctx.config.Net.HTTP.Pool.PerPeer && si != nil && si.DaemonID != "" {
+		pc = h.peerClient(si.DaemonID)
+	}
+	if pc == nil {
+		if long {
+			return h.httpclientLongTimeout
+		}
+		return h.httpclient
+	}
+	if long {
+		return pc.long
+	}
+	return pc.short
+}
+
+func (h *httprunner) peerClient(id string) *peerClient {
+	h.peers.mtx.Lock()
+	defer h.peers.mtx.Unlock()
+	if pc, ok := h.peers.m[id]; ok {
+		return pc
+	}
+	if h.peers.m == nil {
+		h.peers.m = make(map[string]*peerClient)
+	}
+	// drop the clients of the daemons that have left the cluster
+	if smap := h.smapowner.get(); smap != nil && smap.version() != h.peers.smapv {
+		for pid, pc := range h.peers.m {
+			if smap.getTarget(pid) == nil && smap.getProxy(pid) == nil {
+				pc.transport.CloseIdleConnections()
+				delete(h.peers.m, pid)
+			}
+		}
+		h.peers.smapv = smap.version()
+	}
+	pc := h.newPeerClient(h.perhost, 1)
+	h.peers.m[id] = pc
+	return pc
+}
+
+// connPoolStats returns the connection counters of the clients
+func (h *httprunner) connPoolStats() *ConnPoolStats {
+	stats := &ConnPoolStats{PerPeer: ctx.config.Net.HTTP.Pool.PerPeer, Peers: make(map[string]*PeerConnStats)}
+	if h.sharedClient != nil {
+		stats.Peers[sharedClientsID] = h.sharedClient.snapshot()
+	}
+	h.peers.mtx.Lock()
+	for id, pc := range h.peers.m {
+		stats.Peers[id] = pc.snapshot()
+	}
+	h.peers.mtx.Unlock()
+	return stats
+}
+
+func (pc *peerClient) snapshot() *PeerConnStats {
+	return &PeerConnStats{
+		Dialed: atomic.LoadInt64(&pc.stats.Dialed),
+		Reused: atomic.LoadInt64(&pc.stats.Reused),
+		Open:   atomic.LoadInt64(&pc.stats.Open),
+	}
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				atomic.AddInt64(&t.pc.stats.Reused, 1)
+				t.statsif.add("numconnreuse", 1)
+			}
+		},
+	}
+	return t.Transport.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+}
+
+func (c *countedConn) Close() error {
+	c.once.Do(func() { atomic.AddInt64(&c.pc.stats.Open, -1) })
+	return c.Conn.Close()
+}
@@ -0,0 +1,64 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPeerClients(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	oldpool := ctx.config.Net.HTTP.Pool
+	defer func() { ctx.config.Net.HTTP.Pool = oldpool }()
+	ctx.config.Net.HTTP.Pool = httppoolconf{PerPeer: true, DialTimeoutStr: "5s"}
+	if err := validateHTTPPool(&ctx.config.Net.HTTP.Pool); err != nil {
+		t.Fatal(err)
+	}
+
+	h := &httprunner{statsif: &storstatsrunner{}, smapowner: &smapowner{}, perhost: targetMaxIdleConnsPer}
+	h.sharedClient = h.newPeerClient(targetMaxIdleConnsPer, 4)
+	smap := newSmap()
+	t1 := &daemonInfo{DaemonID: "t1", DirectURL: server.URL}
+	smap.addTarget(t1)
+	h.smapowner.put(smap)
+
+	client := h.client(t1, false)
+	if client == h.sharedClient.short || client != h.client(t1, false) || h.client(nil, false) != h.sharedClient.short {
+		t.Fatal("Expected a client of its own for t1 and the shared one otherwise")
+	}
+	for i := 0; i < 3; i++ {
+		response, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ioutil.ReadAll(response.Body)
+		response.Body.Close()
+	}
+	stats := h.connPoolStats()
+	if peer := stats.Peers["t1"]; !stats.PerPeer || peer == nil || peer.Dialed != 1 || peer.Reused != 2 || peer.Open != 1 {
+		t.Errorf("Unexpected connection stats %+v", peer)
+	}
+	core := &h.statsif.(*storstatsrunner).Core
+	if core.Numconndial != 1 || core.Numconnreuse != 2 {
+		t.Errorf("Unexpected core stats: %d dialed, %d reused", core.Numconndial, core.Numconnreuse)
+	}
+
+	// t1 leaves: its clients are dropped once another peer's are created
+	smap = newSmap()
+	smap.Version = 2
+	t2 := &daemonInfo{DaemonID: "t2", DirectURL: server.URL}
+	smap.addTarget(t2)
+	h.smapowner.put(smap)
+	h.client(t2, true)
+	if stats = h.connPoolStats(); stats.Peers["t1"] != nil || stats.Peers["t2"] == nil {
+		t.Errorf("Unexpected peers %v", stats.Peers)
+	}
+}
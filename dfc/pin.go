@@ -0,0 +1,358 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+// Pinning.
+// LRU never evicts a pinned object, regardless of its TTL (see objmeta.go).
+// Objects are pinned one at a time - POST {"action": "pin"} to
+// /v1/objects/bucket-name/object-name or PATCH of the object's "pinned"
+// property - or by prefix: POST {"action": "pin", "value": {"prefix": ...}}
+// to /v1/buckets/bucket-name pins the objects of the bucket with the prefix,
+// including the ones cached later. The pinned prefixes are kept in the bucket
+// metadata. The objects pinned at a target may not take more than pin.capacity
+// bytes: pinning that would exceed the capacity of any target fails with 507
+// Insufficient Storage. Objects cached under a pinned prefix after it has been
+// pinned are not limited. GET /v1/buckets/bucket-name?what=pinned lists the
+// pinned prefixes and objects of the bucket along with the usage of the targets.
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/NVIDIA/dfcpub/3rdparty/glog"
+)
+
+// pinnedPrefix tells whether the object has a pinned prefix
+func pinnedPrefix(props *BucketProps, objname string) bool {
+	for _, prefix := range props.PinnedPrefixes {
+		if strings.HasPrefix(objname, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// addPrefix returns the prefixes with the new one, or nil if already pinned
+func addPrefix(prefixes []string, prefix string) []string {
+	for _, p := range prefixes {
+		if p == prefix {
+			return nil
+		}
+	}
+	pinned := make([]string, 0, len(prefixes)+1)
+	pinned = append(pinned, prefixes...)
+	pinned = append(pinned, prefix)
+	sort.Strings(pinned)
+	return pinned
+}
+
+// removePrefix returns the prefixes without the given one, or nil if not pinned
+func removePrefix(prefixes []string, prefix string) []string {
+	pinned := make([]string, 0, len(prefixes))
+	for _, p := range prefixes {
+		if p != prefix {
+			pinned = append(pinned, p)
+		}
+	}
+	if len(pinned) == len(prefixes) {
+		return nil
+	}
+	return pinned
+}
+
+func parsePinMsg(msg *ActionMsg) (*PinMsg, error) {
+	pinmsg := &PinMsg{}
+	if msg.Value != nil {
+		b, err := json.Marshal(msg.Value)
+		if err == nil {
+			err = json.Unmarshal(b, pinmsg)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Invalid %s parameters %v, err: %v", msg.Action, msg.Value, err)
+		}
+	}
+	if pinmsg.Prefix == "" {
+		return nil, fmt.Errorf("%s of a bucket requires a prefix", msg.Action)
+	}
+	return pinmsg, nil
+}
+
+//
+// target
+//
+
+// pinned tells whether the object stored at fqn is pinned
+func (t *targetrunner) pinned(fqn string, meta *ObjectMeta) bool {
+	if meta.Pinned {
+		return true
+	}
+	bucket, objname, errstr := t.fqn2bckobj(fqn)
+	if errstr != "" {
+		return false
+	}
+	bucketmd := t.bmdowner.get()
+	_, props := bucketmd.get(bucket, bucketmd.islocal(bucket))
+	return pinnedPrefix(&props, objname)
+}
+
+// pinScan returns the pinned objects of the bucket stored by the target and
+// the size of its objects with the prefix that are not pinned yet
+func (t *targetrunner) pinScan(bucket, prefix string) (*TargetPins, error) {
+	pins := &TargetPins{Capacity: ctx.config.Pin.Capacity}
+	for mpath := range ctx.mountpaths.Available {
+		for _, dir := range []string{makePathLocal(mpath), makePathCloud(mpath)} {
+			err := filepath.Walk(dir, func(fqn string, finfo os.FileInfo, err error) error {
+				if err != nil {
+					if os.IsNotExist(err) {
+						return nil
+					}
+					return err
+				}
+				if finfo.IsDir() {
+					return nil
+				}
+				if iswork, _ := t.isworkfile(fqn); iswork {
+					return nil
+				}
+				b, objname, errstr := t.fqn2bckobj(fqn)
+				if errstr != "" {
+					return nil
+				}
+				meta, _ := getObjectMeta(fqn)
+				switch {
+				case t.pinned(fqn, meta):
+					pins.Used += finfo.Size()
+					if b != bucket {
+						break
+					}
+					pins.Size += finfo.Size()
+					if meta.Pinned {
+						pins.Objects = append(pins.Objects, objname)
+					}
+				case b == bucket && prefix != "" && strings.HasPrefix(objname, prefix):
+					pins.PrefixSize += finfo.Size()
+				}
+				return nil
+			})
+			if err != nil {
+				t.runFSKeeper(dir)
+				return nil, fmt.Errorf("Failed to traverse %s, err: %v", dir, err)
+			}
+		}
+	}
+	sort.Strings(pins.Objects)
+	return pins, nil
+}
+
+// checkPin fails pinning the object if it would exceed the pinned capacity
+func (t *targetrunner) checkPin(bucket, objname, fqn string) (errstr string, errcode int) {
+	capacity := ctx.config.Pin.Capacity
+	if capacity == 0 {
+		return
+	}
+	finfo, err := os.Stat(fqn)
+	if err != nil {
+		return fmt.Sprintf("Object %s/%s %s", bucket, objname, doesnotexist), http.StatusNotFound
+	}
+	if meta, _ := getObjectMeta(fqn); t.pinned(fqn, meta) {
+		return
+	}
+	pins, err := t.pinScan("", "")
+	if err != nil {
+		return err.Error(), http.StatusInternalServerError
+	}
+	if pins.Used+finfo.Size() > capacity {
+		return fmt.Sprintf("Cannot pin %s/%s (%d bytes): %d of %d pinned bytes used at %s",
+			bucket, objname, finfo.Size(), pins.Used, capacity, t.si.DaemonID), http.StatusInsufficientStorage
+	}
+	return
+}
+
+// POST {"action": "pin" | "unpin"} /v1/objects/bucket-name/object-name
+func (t *targetrunner) pinobject(w http.ResponseWriter, r *http.Request, pin bool) {
+	apitems := t.restAPIItems(r.URL.Path, 5)
+	if apitems = t.checkRestAPI(w, r, apitems, 2, Rversion, Robjects); apitems == nil {
+		return
+	}
+	bucket, objname := apitems[0], strings.Join(apitems[1:], "/")
+	if !t.validatebckname(w, r, bucket) {
+		return
+	}
+	fqn, exists := t.findfqn(bucket, objname, t.bmdowner.get().islocal(bucket))
+	if !exists {
+		t.invalmsghdlr(w, r, fmt.Sprintf("Object %s/%s %s", bucket, objname, doesnotexist), http.StatusNotFound)
+		return
+	}
+	if pin {
+		if errstr, errcode := t.checkPin(bucket, objname, fqn); errstr != "" {
+			t.invalmsghdlr(w, r, errstr, errcode)
+			return
+		}
+	}
+	uname := uniquename(bucket, objname)
+	t.rtnamemap.lockname(uname, true, &pendinginfo{Time: time.Now(), fqn: fqn}, time.Second)
+	meta, errstr := getObjectMeta(fqn)
+	if errstr == "" && meta.Pinned != pin {
+		meta.Pinned = pin
+		errstr = setObjectMeta(fqn, meta)
+	}
+	t.rtnamemap.unlockname(uname, true)
+	if errstr != "" {
+		t.invalmsghdlr(w, r, errstr, http.StatusInternalServerError)
+		return
+	}
+	glog.Infof("%s/%s pinned: %t", bucket, objname, pin)
+}
+
+// GET /v1/buckets/bucket-name?what=pinned
+func (t *targetrunner) httppinned(w http.ResponseWriter, r *http.Request, bucket string) {
+	pins, err := t.pinScan(bucket, r.URL.Query().Get(URLParamPrefix))
+	if err != nil {
+		t.invalmsghdlr(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	jsbytes, err := json.Marshal(pins)
+	assert(err == nil, err)
+	t.writeJSON(w, r, jsbytes, "pinned")
+}
+
+//
+// proxy
+//
+
+// POST {"action": "pin" | "unpin"} /v1/objects/bucket-name/object-name
+func (p *proxyrunner) objpin(w http.ResponseWriter, r *http.Request) {
+	apitems := p.restAPIItems(r.URL.Path, 5)
+	if apitems = p.checkRestAPI(w, r, apitems, 2, Rversion, Robjects); apitems == nil {
+		return
+	}
+	bucket := apitems[0]
+	objname, ok := p.checkObjname(w, r)
+	if !ok {
+		return
+	}
+	pgroup := r.URL.Query().Get(URLParamPlacementGroup)
+	si, errstr := HrwTarget(bucket, hrwName(objname, pgroup), p.smapowner.get())
+	if errstr != "" {
+		p.invalmsghdlr(w, r, errstr)
+		return
+	}
+	redirecturl := si.DirectURL + r.URL.EscapedPath()
+	if r.URL.RawQuery != "" {
+		redirecturl += "?" + r.URL.RawQuery
+	}
+	if glog.V(3) {
+		glog.Infof("PIN %s %s/%s => %s", r.Method, bucket, objname, si.DaemonID)
+	}
+	http.Redirect(w, r, redirecturl, http.StatusTemporaryRedirect)
+}
+
+// POST {"action": "pin" | "unpin", "value": {"prefix": ...}} /v1/buckets/bucket-name
+func (p *proxyrunner) pinprefix(w http.ResponseWriter, r *http.Request, bucket string, msg *ActionMsg) {
+	pinmsg, err := parsePinMsg(msg)
+	if err != nil {
+		p.invalmsghdlr(w, r, err.Error())
+		return
+	}
+	pin := msg.Action == ActPin
+	if pin && ctx.config.Pin.Capacity > 0 {
+		pins, errstr := p.targetPins(bucket, pinmsg.Prefix)
+		if errstr != "" {
+			p.invalmsghdlr(w, r, errstr)
+			return
+		}
+		for sid, tpins := range pins {
+			if tpins.Used+tpins.PrefixSize > tpins.Capacity {
+				p.invalmsghdlr(w, r, fmt.Sprintf("Cannot pin %s/%s* (%d bytes at %s): %d of %d pinned bytes used",
+					bucket, pinmsg.Prefix, tpins.PrefixSize, sid, tpins.Used, tpins.Capacity), http.StatusInsufficientStorage)
+				return
+			}
+		}
+	}
+
+	p.bmdowner.Lock()
+	clone := p.bmdowner.get().clone()
+	islocal := clone.islocal(bucket)
+	exists, props := clone.get(bucket, islocal)
+	if !exists {
+		assert(!islocal)
+		clone.add(bucket, false, BucketProps{})
+	}
+	var prefixes []string
+	if pin {
+		prefixes = addPrefix(props.PinnedPrefixes, pinmsg.Prefix)
+	} else {
+		prefixes = removePrefix(props.PinnedPrefixes, pinmsg.Prefix)
+	}
+	if prefixes == nil {
+		p.bmdowner.Unlock()
+		return
+	}
+	props.PinnedPrefixes = prefixes
+	clone.set(bucket, islocal, props)
+	if errstr := p.savebmdconf(clone); errstr != "" {
+		glog.Errorln(errstr)
+	}
+	p.bmdowner.put(clone)
+	p.bmdowner.Unlock()
+	p.metasyncer.sync(true, &revspair{clone, msg})
+	glog.Infof("%s/%s* pinned: %t", bucket, pinmsg.Prefix, pin)
+}
+
+// targetPins collects the pinned objects of the bucket from the targets
+func (p *proxyrunner) targetPins(bucket, prefix string) (map[string]*TargetPins, string) {
+	q := url.Values{}
+	q.Set(URLParamWhat, GetWhatPinned)
+	q.Set(URLParamPrefix, prefix)
+	results := p.broadcastTargets(URLPath(Rversion, Rbuckets, bucket), q, http.MethodGet, nil,
+		p.smapowner.get(), ctx.config.Timeout.DefaultLong)
+	pins := make(map[string]*TargetPins)
+	for res := range results {
+		if res.err != nil {
+			return nil, fmt.Sprintf("Failed to get the pinned objects of %s from %s: %v (%d: %s)",
+				bucket, res.si.DaemonID, res.err, res.status, res.errstr)
+		}
+		tpins := &TargetPins{}
+		if err := json.Unmarshal(res.outjson, tpins); err != nil {
+			return nil, fmt.Sprintf("Invalid pinned objects of %s from %s, err: %v", bucket, res.si.DaemonID, err)
+		}
+		pins[res.si.DaemonID] = tpins
+	}
+	return pins, ""
+}
+
+// GET /v1/buckets/bucket-name?what=pinned
+func (p *proxyrunner) httppinned(w http.ResponseWriter, r *http.Request, bucket string) {
+	targets, errstr := p.targetPins(bucket, "")
+	if errstr != "" {
+		p.invalmsghdlr(w, r, errstr)
+		return
+	}
+	bucketmd := p.bmdowner.get()
+	_, props := bucketmd.get(bucket, bucketmd.islocal(bucket))
+	jsbytes, err := json.Marshal(newPinnedList(bucket, props.PinnedPrefixes, targets))
+	assert(err == nil, err)
+	p.writeJSON(w, r, jsbytes, "pinned")
+}
+
+// newPinnedList aggregates the pinned objects of the targets
+func newPinnedList(bucket string, prefixes []string, targets map[string]*TargetPins) *PinnedList {
+	list := &PinnedList{Bucket: bucket, Prefixes: prefixes, Targets: targets}
+	for _, tpins := range targets {
+		list.Objects = append(list.Objects, tpins.Objects...)
+		list.Size += tpins.Size
+		tpins.Objects = nil
+	}
+	sort.Strings(list.Objects)
+	return list
+}
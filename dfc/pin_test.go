@@ -0,0 +1,108 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPinnedPrefixes(t *testing.T) {
+	prefixes := addPrefix(nil, "b/")
+	prefixes = addPrefix(prefixes, "a/")
+	if !reflect.DeepEqual(prefixes, []string{"a/", "b/"}) || addPrefix(prefixes, "a/") != nil {
+		t.Fatalf("Unexpected pinned prefixes %v", prefixes)
+	}
+	props := &BucketProps{PinnedPrefixes: prefixes}
+	if !pinnedPrefix(props, "a/obj") || pinnedPrefix(props, "c/obj") {
+		t.Error("Expected a/obj only to be pinned")
+	}
+	if removePrefix(prefixes, "c/") != nil {
+		t.Error("Expected no prefix to be removed")
+	}
+	if unpinned := removePrefix(prefixes, "a/"); !reflect.DeepEqual(unpinned, []string{"b/"}) || len(prefixes) != 2 {
+		t.Errorf("Unexpected prefixes %v after unpinning a/ of %v", unpinned, prefixes)
+	}
+
+	list := newPinnedList("bucket", props.PinnedPrefixes, map[string]*TargetPins{
+		"t1": {Objects: []string{"c/2"}, Size: 10},
+		"t2": {Objects: []string{"c/1", "c/3"}, Size: 20},
+	})
+	if !reflect.DeepEqual(list.Objects, []string{"c/1", "c/2", "c/3"}) || list.Size != 30 || list.Targets["t1"].Objects != nil {
+		t.Errorf("Unexpected pinned list %+v", list)
+	}
+}
+
+func TestPinScan(t *testing.T) {
+	const bucket = "pinbucket"
+	mpath, err := ioutil.TempDir("", "pin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(mpath)
+	oldavail, oldconf := ctx.mountpaths.Available, ctx.config
+	defer func() { ctx.mountpaths.Available, ctx.config = oldavail, oldconf }()
+	ctx.mountpaths.Available = map[string]*mountPath{mpath: {Path: mpath}}
+	ctx.config.LocalBuckets, ctx.config.CloudBuckets = "local", "cloud"
+
+	target, _ := newTestTarget(map[string]BucketProps{
+		bucket:  {PinnedPrefixes: []string{"a/"}},
+		"other": {PinnedPrefixes: []string{"d/"}},
+	})
+
+	fqns := make(map[string]string)
+	for _, obj := range []struct {
+		bucket, objname string
+		size            int
+	}{
+		{bucket, "a/1", 10},
+		{bucket, "a/2", 20},
+		{bucket, "b/1", 40},
+		{bucket, "b/2", 80},
+		{bucket, "c/1", 160},
+		{"other", "d/1", 320},
+	} {
+		fqn := target.fqn(obj.bucket, obj.objname, true)
+		if err = CreateDir(filepath.Dir(fqn)); err != nil {
+			t.Fatal(err)
+		}
+		if err = ioutil.WriteFile(fqn, make([]byte, obj.size), 0644); err != nil {
+			t.Fatal(err)
+		}
+		fqns[obj.objname] = fqn
+	}
+	if errstr := setObjectMeta(fqns["c/1"], &ObjectMeta{Pinned: true}); errstr != "" {
+		t.Skipf("Extended attributes are not supported: %s", errstr)
+	}
+	if meta, _ := getObjectMeta(fqns["a/1"]); !target.pinned(fqns["a/1"], meta) {
+		t.Error("Expected a/1 to be pinned by prefix")
+	}
+
+	pins, err := target.pinScan(bucket, "b/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &TargetPins{Objects: []string{"c/1"}, Size: 190, Used: 510, PrefixSize: 120}
+	if !reflect.DeepEqual(pins, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, pins)
+	}
+
+	// pinned capacity
+	ctx.config.Pin.Capacity = 550
+	if errstr, errcode := target.checkPin(bucket, "b/1", fqns["b/1"]); errstr != "" {
+		t.Errorf("Expected b/1 to fit, err: %s (%d)", errstr, errcode)
+	}
+	if _, errcode := target.checkPin(bucket, "b/2", fqns["b/2"]); errcode != http.StatusInsufficientStorage {
+		t.Errorf("Expected b/2 not to fit, status %d", errcode)
+	}
+	ctx.config.Pin.Capacity = 100
+	if errstr, _ := target.checkPin(bucket, "a/2", fqns["a/2"]); errstr != "" {
+		t.Errorf("Expected pinned a/2 to be pinned again, err: %s", errstr)
+	}
+}
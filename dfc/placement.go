@@ -0,0 +1,373 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/NVIDIA/dfcpub/3rdparty/glog"
+	"github.com/OneOfOne/xxhash"
+)
+
+// Disk utilization-aware placement. Within a target, an object is stored on
+// its home mountpath: selected by HRW (hrwMpath) among the mountpaths labeled
+// as the bucket prefers (BucketProps.MpathLabel), or among all of them if
+// there are no such. With placementconf.MaxUsedPct set, a new object whose
+// home mountpath is fuller than that goes to the next mountpath in the order
+// of preference (hrwMpaths) that is not; the object is "displaced" and carries
+// XattrDisplaced. Lookups that miss the home mountpath search the others in
+// the same order. Once a full mountpath gets below the threshold again, or
+// mountpath labels change, the resilver xaction moves objects home.
+
+// xattrs that travel with an object moved between mountpaths
+var objectXattrs = []string{XattrXXHashVal, XattrObjVersion, XattrDataKey, XattrCustomerKeyHash,
+	XattrPlacementGroup, XattrCloudCksum, XattrObjMeta}
+
+// fullmpaths is the set of mountpaths above the placement threshold,
+// map[string]bool updated with the capacity stats
+var fullmpaths atomic.Value
+
+func init() {
+	fullmpaths.Store(map[string]bool{})
+}
+
+// updateFullMpaths recomputes the set of full mountpaths and returns true if
+// some of them are not full anymore, i.e., it is time to resilver
+func updateFullMpaths(capacity map[string]*fscapacity) (freed bool) {
+	maxpct := ctx.config.Placement.MaxUsedPct
+	full, prev := make(map[string]bool), fullmpaths.Load().(map[string]bool)
+	for mpath, fscapacity := range capacity {
+		if maxpct > 0 && fscapacity.Usedpct >= maxpct {
+			full[mpath] = true
+		}
+	}
+	for mpath := range prev {
+		if !full[mpath] {
+			freed = true
+		}
+	}
+	fullmpaths.Store(full)
+	return
+}
+
+func isFullMpath(mpath string) bool {
+	return fullmpaths.Load().(map[string]bool)[mpath]
+}
+
+// mpathLabel returns the bucket's preferred mountpath label, if any
+func (t *targetrunner) mpathLabel(bucket string) string {
+	bucketmd := t.bmdowner.get()
+	_, props := bucketmd.get(bucket, bucketmd.islocal(bucket))
+	return props.MpathLabel
+}
+
+// homeMpath returns the mountpath the object belongs to
+func (t *targetrunner) homeMpath(bucket, objname string) string {
+	if label := t.mpathLabel(bucket); label != "" {
+		if mpath := hrwMpathLabel(bucket, objname, label); mpath != "" {
+			return mpath
+		}
+	}
+	return hrwMpath(bucket, objname)
+}
+
+// hrwMpaths returns all available mountpaths in the order of preference for
+// the object: the ones with the bucket's label first, each group in the
+// descending order of HRW weights; the first one is homeMpath
+func (t *targetrunner) hrwMpaths(bucket, objname string) []string {
+	var (
+		name    = uniquename(bucket, objname)
+		label   = t.mpathLabel(bucket)
+		mpaths  = make([]string, 0, len(ctx.mountpaths.Available))
+		weights = make(map[string]uint64, len(ctx.mountpaths.Available))
+		labeled = make(map[string]bool, len(ctx.mountpaths.Available))
+	)
+	for path, mp := range ctx.mountpaths.Available {
+		mpaths = append(mpaths, path)
+		weights[path] = xxhash.ChecksumString64S(path+":"+name, mLCG32)
+		labeled[path] = label != "" && mp.Label == label
+	}
+	sort.Slice(mpaths, func(i, j int) bool {
+		if labeled[mpaths[i]] != labeled[mpaths[j]] {
+			return labeled[mpaths[i]]
+		}
+		return weights[mpaths[i]] > weights[mpaths[j]]
+	})
+	return mpaths
+}
+
+// placeMpath selects the mountpath for a new object: the home one, unless full
+func (t *targetrunner) placeMpath(bucket, objname string) (mpath string) {
+	mpath = t.homeMpath(bucket, objname)
+	if !isFullMpath(mpath) {
+		return
+	}
+	for _, path := range t.hrwMpaths(bucket, objname) {
+		if !isFullMpath(path) {
+			return path
+		}
+	}
+	return // all full: home
+}
+
+// mpathLabelsChanged returns true if some bucket's preferred mountpath label
+// differs in the new bucket metadata
+func mpathLabelsChanged(bucketmd, newbucketmd *bucketMD) bool {
+	for _, m := range []struct{ old, new map[string]BucketProps }{
+		{bucketmd.LBmap, newbucketmd.LBmap}, {bucketmd.CBmap, newbucketmd.CBmap}} {
+		for bucket, props := range m.new {
+			if props.MpathLabel != m.old[bucket].MpathLabel {
+				return true
+			}
+		}
+		for bucket, props := range m.old {
+			if _, ok := m.new[bucket]; !ok && props.MpathLabel != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func mpath2fqn(mpath, bucket, objname string, islocal bool) string {
+	if islocal {
+		return filepath.Join(makePathLocal(mpath), bucket, objname)
+	}
+	return filepath.Join(makePathCloud(mpath), bucket, objname)
+}
+
+// lookupfqn returns the fqn of the stored object: the HRW fqn or, if the
+// object is not there, the fqn on the other mountpath where it is displaced to.
+// Returns the HRW fqn if the object does not exist
+func (t *targetrunner) lookupfqn(bucket, objname string, islocal bool) string {
+	fqn, _ := t.findfqn(bucket, objname, islocal)
+	return fqn
+}
+
+func (t *targetrunner) findfqn(bucket, objname string, islocal bool) (fqn string, exists bool) {
+	fqn = t.fqn(bucket, objname, islocal)
+	if _, err := os.Stat(fqn); err == nil || len(ctx.mountpaths.Available) < 2 {
+		return fqn, err == nil
+	}
+	for _, mpath := range t.hrwMpaths(bucket, objname)[1:] {
+		dfqn := mpath2fqn(mpath, bucket, objname, islocal)
+		if _, err := os.Stat(dfqn); err == nil {
+			return dfqn, true
+		}
+	}
+	return
+}
+
+// placefqn returns the fqn to write the object to: the existing object is
+// overwritten in place, a new one is placed by placeMpath. The returned
+// hrwmpath is non-empty if the fqn is displaced from the object's home mountpath
+func (t *targetrunner) placefqn(bucket, objname string, islocal bool) (fqn, hrwmpath string) {
+	fqn, exists := t.findfqn(bucket, objname, islocal)
+	if !exists && ctx.config.Placement.MaxUsedPct > 0 {
+		fqn = mpath2fqn(t.placeMpath(bucket, objname), bucket, objname, islocal)
+	}
+	if home := t.homeMpath(bucket, objname); fqn2mpath(fqn) != home {
+		hrwmpath = home
+		t.statsif.add("numdisplaced", 1)
+	}
+	return
+}
+
+// removeDisplaced removes copies of the object other than fqn that concurrent
+// writes may have placed on other mountpaths; the caller must hold the
+// object's exclusive lock
+func (t *targetrunner) removeDisplaced(bucket, objname string, islocal bool, fqn string) {
+	if ctx.config.Placement.MaxUsedPct == 0 {
+		return
+	}
+	for mpath := range ctx.mountpaths.Available {
+		if dfqn := mpath2fqn(mpath, bucket, objname, islocal); dfqn != fqn {
+			if err := os.Remove(dfqn); err == nil {
+				glog.Infof("Removed stale copy %s of %s/%s", dfqn, bucket, objname)
+			}
+		}
+	}
+}
+
+// parsefqn returns the bucket and the name of the object stored at the fqn,
+// whichever mountpath it is stored on
+func (t *targetrunner) parsefqn(fqn string) (bucket, objname string, islocal, ok bool) {
+	for mpath := range ctx.mountpaths.Available {
+		for _, local := range []bool{false, true} {
+			dir := makePathCloud(mpath) + "/"
+			if local {
+				dir = makePathLocal(mpath) + "/"
+			}
+			if !strings.HasPrefix(fqn, dir) {
+				continue
+			}
+			items := strings.SplitN(fqn[len(dir):], "/", 2)
+			if len(items) < 2 || items[1] == "" || t.bmdowner.get().islocal(items[0]) != local {
+				continue
+			}
+			return items[0], items[1], local, true
+		}
+	}
+	return
+}
+
+// isdisplaced returns true if the object is stored off its home mountpath on purpose
+func isdisplaced(fqn string) bool {
+	val, _ := Getxattr(fqn, XattrDisplaced)
+	return val != nil
+}
+
+//===========================================================================
+//
+// resilver: move objects stored off their home mountpaths back home
+//
+//===========================================================================
+
+func (t *targetrunner) runResilver() {
+	xres := t.xactinp.renewResilver(t)
+	if xres == nil {
+		return
+	}
+	glog.Infoln(xres.tostring())
+	var moved, nbytes int64
+	for mpath := range ctx.mountpaths.Available {
+		for _, dir := range []string{makePathLocal(mpath), makePathCloud(mpath)} {
+			walkf := func(fqn string, osfi os.FileInfo, err error) error {
+				if err != nil {
+					if os.IsNotExist(err) {
+						return nil
+					}
+					return err
+				}
+				select {
+				case <-xres.abrt:
+					return fmt.Errorf("%s aborted, exiting walk", xres.tostring())
+				default:
+				}
+				if osfi.IsDir() {
+					return nil
+				}
+				if t.resilverObject(fqn) {
+					moved++
+					nbytes += osfi.Size()
+				}
+				return nil
+			}
+			if err := filepath.Walk(dir, walkf); err != nil {
+				glog.Errorf("Resilver: failed to traverse %s, err: %v", dir, err)
+			}
+		}
+	}
+	if moved > 0 {
+		t.statsif.addMany("numresilvered", moved, "bytesresilvered", nbytes)
+	}
+	xres.etime = time.Now()
+	glog.Infof("%s: moved %d objects, %d bytes", xres.tostring(), moved, nbytes)
+	t.xactinp.del(xres.id)
+}
+
+// resilverObject moves the object to its home mountpath, if it is not there
+// and the home mountpath is not full
+func (t *targetrunner) resilverObject(fqn string) (moved bool) {
+	if iswork, _ := t.isworkfile(fqn); iswork {
+		return
+	}
+	bucket, objname, islocal, ok := t.parsefqn(fqn)
+	if !ok {
+		return
+	}
+	hrwfqn := t.fqn(bucket, objname, islocal)
+	if hrwfqn == fqn || isFullMpath(fqn2mpath(hrwfqn)) {
+		return
+	}
+	uname := uniquename(bucket, objname)
+	t.rtnamemap.lockname(uname, true, &pendinginfo{Time: time.Now(), fqn: fqn}, time.Second)
+	defer t.rtnamemap.unlockname(uname, true)
+	if _, err := os.Stat(fqn); err != nil { // deleted or replaced in the meantime
+		return
+	}
+	if _, err := os.Stat(hrwfqn); err == nil {
+		glog.Warningf("Resilver: %s and %s both exist, removing the former", fqn, hrwfqn)
+		os.Remove(fqn)
+		return
+	}
+	if err := t.moveObject(fqn, hrwfqn, bucket); err != nil {
+		glog.Errorf("Resilver: failed to move %s => %s, err: %v", fqn, hrwfqn, err)
+		return
+	}
+	return true
+}
+
+// moveObject moves the object with its xattrs to another mountpath
+func (t *targetrunner) moveObject(fqn, tofqn, bucket string) (err error) {
+	frommp, tomp := ctx.mountpaths.Available[fqn2mpath(fqn)], ctx.mountpaths.Available[fqn2mpath(tofqn)]
+	if frommp != nil && tomp != nil && frommp.Fsid == tomp.Fsid {
+		if err = CreateDir(filepath.Dir(tofqn)); err != nil {
+			return
+		}
+		if err = os.Rename(fqn, tofqn); err != nil {
+			return
+		}
+		return deleteDisplacedXattr(tofqn)
+	}
+	workfqn := t.fqn2workfile(tofqn)
+	if err = copyObject(fqn, workfqn); err != nil {
+		os.Remove(workfqn)
+		return
+	}
+	if err = t.commitWorkfile(workfqn, tofqn, bucket); err != nil {
+		os.Remove(workfqn)
+		return
+	}
+	return os.Remove(fqn)
+}
+
+// copyObject copies the object's content and xattrs as is (e.g., encrypted)
+func copyObject(fqn, tofqn string) error {
+	src, err := os.Open(fqn)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := CreateFile(tofqn)
+	if err != nil {
+		return err
+	}
+	slab := selectslab(0)
+	buf := slab.alloc()
+	_, err = io.CopyBuffer(dst, src, buf)
+	slab.free(buf)
+	if err1 := dst.Close(); err == nil {
+		err = err1
+	}
+	if err != nil {
+		return err
+	}
+	for _, name := range objectXattrs {
+		val, errstr := Getxattr(fqn, name)
+		if errstr == "" && val != nil {
+			errstr = Setxattr(tofqn, name, val)
+		}
+		if errstr != "" {
+			return fmt.Errorf("%s", errstr)
+		}
+	}
+	return nil
+}
+
+func deleteDisplacedXattr(fqn string) error {
+	if errstr := Deletexattr(fqn, XattrDisplaced); errstr != "" {
+		return fmt.Errorf("%s", errstr)
+	}
+	return nil
+}
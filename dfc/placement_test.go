@@ -0,0 +1,171 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ */
+package dfc
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPlacementDisplacement(t *testing.T) {
+	const bucket = "lbucket"
+	dir, err := ioutil.TempDir("", "placement")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	mpaths := []string{filepath.Join(dir, "mp1"), filepath.Join(dir, "mp2"), filepath.Join(dir, "mp3")}
+	oldavail, oldplacement := ctx.mountpaths.Available, ctx.config.Placement
+	defer func() {
+		ctx.mountpaths.Available, ctx.config.Placement = oldavail, oldplacement
+		fullmpaths.Store(map[string]bool{})
+	}()
+	ctx.mountpaths.Available = make(map[string]*mountPath)
+	capacity := make(map[string]*fscapacity)
+	for _, mpath := range mpaths {
+		ctx.mountpaths.Available[mpath] = &mountPath{Path: mpath}
+		capacity[mpath] = &fscapacity{Usedpct: 50}
+	}
+	ctx.config.Placement.MaxUsedPct = 90
+
+	target, _ := newTestTarget(map[string]BucketProps{bucket: {}})
+
+	order := target.hrwMpaths(bucket, "obj")
+	if len(order) != len(mpaths) || order[0] != hrwMpath(bucket, "obj") {
+		t.Fatalf("Unexpected HRW order %v (HRW %s)", order, hrwMpath(bucket, "obj"))
+	}
+
+	// the HRW mountpath is full: the object goes to the next one
+	capacity[order[0]].Usedpct = 95
+	if updateFullMpaths(capacity) {
+		t.Error("Expected no mountpaths to be freed")
+	}
+	fqn, hrwmpath := target.placefqn(bucket, "obj", true)
+	if fqn2mpath(fqn) != order[1] || hrwmpath != order[0] {
+		t.Fatalf("Expected %s displaced from %s to %s, got %s (%s)", "obj", order[0], order[1], fqn, hrwmpath)
+	}
+	if err = CreateDir(filepath.Dir(fqn)); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(fqn, []byte("displaced"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if errstr := target.finalizeobj(fqn, &objectProps{displaced: hrwmpath}); errstr != "" {
+		t.Skipf("Extended attributes are not supported: %s", errstr)
+	}
+	if lfqn := target.lookupfqn(bucket, "obj", true); lfqn != fqn {
+		t.Errorf("Expected lookup to find %s, got %s", fqn, lfqn)
+	}
+	if b, o, errstr := target.fqn2bckobj(fqn); errstr != "" || b != bucket || o != "obj" {
+		t.Errorf("Expected displaced %s to map to %s/obj, got %s/%s, %s", fqn, bucket, b, o, errstr)
+	}
+	// existing object is overwritten in place
+	if wfqn, _ := target.placefqn(bucket, "obj", true); wfqn != fqn {
+		t.Errorf("Expected the object to be overwritten in place %s, got %s", fqn, wfqn)
+	}
+
+	// the HRW mountpath has space again: resilver moves the object back
+	capacity[order[0]].Usedpct = 50
+	if !updateFullMpaths(capacity) {
+		t.Error("Expected the HRW mountpath to be freed")
+	}
+	target.runResilver()
+	hrwfqn := target.fqn(bucket, "obj", true)
+	if data, err := ioutil.ReadFile(hrwfqn); err != nil || string(data) != "displaced" {
+		t.Fatalf("Expected the object at %s, err: %v", hrwfqn, err)
+	}
+	if _, err = os.Stat(fqn); !os.IsNotExist(err) {
+		t.Errorf("Expected %s to be removed, err: %v", fqn, err)
+	}
+	if isdisplaced(hrwfqn) {
+		t.Errorf("Expected %s not to be marked displaced", hrwfqn)
+	}
+	if n := target.statsif.(*storstatsrunner).Core.Numresilvered; n != 1 {
+		t.Errorf("Expected 1 resilvered object, got %d", n)
+	}
+}
+
+func TestPlacementLabels(t *testing.T) {
+	const bucket = "lbucket"
+	dir, err := ioutil.TempDir("", "labels")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	oldavail := ctx.mountpaths.Available
+	defer func() { ctx.mountpaths.Available = oldavail }()
+	ctx.mountpaths.Available = map[string]*mountPath{
+		filepath.Join(dir, "nvme0"): {Path: filepath.Join(dir, "nvme0"), Label: "nvme"},
+		filepath.Join(dir, "nvme1"): {Path: filepath.Join(dir, "nvme1"), Label: "nvme"},
+		filepath.Join(dir, "hdd0"):  {Path: filepath.Join(dir, "hdd0"), Label: "hdd"},
+		filepath.Join(dir, "hdd1"):  {Path: filepath.Join(dir, "hdd1"), Label: "hdd"},
+	}
+
+	target, _ := newTestTarget(nil)
+	setlabel := func(label string) (changed bool) {
+		bucketmd := target.bmdowner.get()
+		newbucketmd := newBucketMD()
+		newbucketmd.add(bucket, true, BucketProps{MpathLabel: label})
+		newbucketmd.Version = 1
+		if bucketmd != nil {
+			newbucketmd.Version = bucketmd.Version + 1
+			changed = mpathLabelsChanged(bucketmd, newbucketmd)
+		}
+		target.bmdowner.put(newbucketmd)
+		return
+	}
+	setlabel("nvme")
+
+	var fqns []string
+	for _, objname := range []string{"a", "b", "c", "d", "e", "f"} {
+		fqn := target.fqn(bucket, objname, true)
+		if mp := ctx.mountpaths.Available[fqn2mpath(fqn)]; mp == nil || mp.Label != "nvme" {
+			t.Fatalf("Expected %s on an nvme mountpath, got %s", objname, fqn)
+		}
+		if order := target.hrwMpaths(bucket, objname); order[0] != fqn2mpath(fqn) ||
+			ctx.mountpaths.Available[order[1]].Label != "nvme" {
+			t.Errorf("Unexpected order of mountpaths %v for %s", order, fqn)
+		}
+		if err = CreateDir(filepath.Dir(fqn)); err != nil {
+			t.Fatal(err)
+		}
+		if err = ioutil.WriteFile(fqn, []byte(objname), 0644); err != nil {
+			t.Fatal(err)
+		}
+		fqns = append(fqns, fqn)
+	}
+
+	// relabel the bucket: resilver moves its objects to hdd
+	if !setlabel("hdd") {
+		t.Fatal("Expected the label change to be detected")
+	}
+	for i, objname := range []string{"a", "b", "c", "d", "e", "f"} {
+		if fqn := target.lookupfqn(bucket, objname, true); fqn != fqns[i] {
+			t.Errorf("Expected lookup to find %s before resilver, got %s", fqns[i], fqn)
+		}
+	}
+	target.runResilver()
+	for _, objname := range []string{"a", "b", "c", "d", "e", "f"} {
+		fqn := target.fqn(bucket, objname, true)
+		if ctx.mountpaths.Available[fqn2mpath(fqn)].Label != "hdd" {
+			t.Fatalf("Expected %s on an hdd mountpath, got %s", objname, fqn)
+		}
+		if data, err := ioutil.ReadFile(fqn); err != nil || string(data) != objname {
+			t.Errorf("Expected %s at %s, err: %v", objname, fqn, err)
+		}
+	}
+	for _, fqn := range fqns {
+		if _, err = os.Stat(fqn); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be moved, err: %v", fqn, err)
+		}
+	}
+
+	// no mountpaths with the label: all of them
+	setlabel("ssd")
+	if mpath := target.homeMpath(bucket, "a"); mpath != hrwMpath(bucket, "a") {
+		t.Errorf("Expected HRW mountpath %s, got %s", hrwMpath(bucket, "a"), mpath)
+	}
+}
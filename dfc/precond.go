@@ -0,0 +1,111 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Conditional DELETE. To avoid deleting an object that was overwritten after
+// it was looked at, a DELETE of the object may carry preconditions. With
+// If-Match - comma-separated versions or checksums (xxhash or, for Cloud
+// objects, MD5) - the object is deleted if any of them is the current one, "*"
+// matches any existing object. With If-Unmodified-Since - HTTP date - the
+// object is deleted if it was not modified after that time. A DELETE whose
+// preconditions are not met fails with 412 Precondition Failed.
+// The objects of local buckets are checked under their exclusive locks. The
+// objects of Cloud buckets are checked against the Cloud: GCS deletes the
+// object only if its generation is still the checked one; S3 has no
+// conditional DELETE - the object is checked by HEAD right before the DELETE.
+type (
+	precondition struct {
+		match      []string  // If-Match; "*" - any
+		unmodified time.Time // If-Unmodified-Since; zero - none
+	}
+	// the current state of the object the preconditions are checked against
+	objstate struct {
+		version  string
+		cksums   []string
+		modified time.Time
+	}
+)
+
+// parsePrecondition returns the preconditions of the request, nil if none
+func parsePrecondition(r *http.Request) (pc *precondition, errstr string) {
+	ifmatch, ifunmodified := r.Header.Get(HeaderIfMatch), r.Header.Get(HeaderIfUnmodified)
+	if ifmatch == "" && ifunmodified == "" {
+		return
+	}
+	pc = &precondition{}
+	for _, tag := range strings.Split(ifmatch, ",") {
+		tag = strings.Trim(strings.TrimPrefix(strings.TrimSpace(tag), "W/"), `"`)
+		if tag != "" {
+			pc.match = append(pc.match, tag)
+		}
+	}
+	if ifmatch != "" && len(pc.match) == 0 {
+		return nil, fmt.Sprintf("Invalid %s header: %q", HeaderIfMatch, ifmatch)
+	}
+	if ifunmodified != "" {
+		var err error
+		if pc.unmodified, err = http.ParseTime(ifunmodified); err != nil {
+			return nil, fmt.Sprintf("Invalid %s header: %q, err: %v", HeaderIfUnmodified, ifunmodified, err)
+		}
+	}
+	return
+}
+
+func preconditionFromContext(ct context.Context) *precondition {
+	if pc, ok := ct.Value(ctxPrecond).(*precondition); ok {
+		return pc
+	}
+	return nil
+}
+
+// check returns 412 if the object in the given state does not meet the preconditions
+func (pc *precondition) check(bucket, objname string, st *objstate) *Error {
+	if len(pc.match) > 0 && !pc.matches(st) {
+		return NewError(http.StatusPreconditionFailed, "%s/%s: %s %s does not match (version %q, checksums %v)",
+			bucket, objname, HeaderIfMatch, strings.Join(pc.match, ","), st.version, st.cksums)
+	}
+	// HTTP dates have a precision of one second
+	if !pc.unmodified.IsZero() && st.modified.Truncate(time.Second).After(pc.unmodified) {
+		return NewError(http.StatusPreconditionFailed, "%s/%s was modified at %s, after %s",
+			bucket, objname, st.modified.UTC().Format(http.TimeFormat), pc.unmodified.UTC().Format(http.TimeFormat))
+	}
+	return nil
+}
+
+func (pc *precondition) matches(st *objstate) bool {
+	for _, tag := range pc.match {
+		if tag == "*" || (st.version != "" && tag == st.version) {
+			return true
+		}
+		for _, cksum := range st.cksums {
+			if cksum != "" && tag == cksum {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// localObjstate returns the state of the object stored by the target
+func localObjstate(fqn string, finfo os.FileInfo) *objstate {
+	st := &objstate{modified: finfo.ModTime()}
+	if b, errstr := Getxattr(fqn, XattrObjVersion); errstr == "" {
+		st.version = string(b)
+	}
+	if b, errstr := Getxattr(fqn, XattrXXHashVal); errstr == "" && len(b) > 0 {
+		st.cksums = append(st.cksums, string(b))
+	}
+	return st
+}
@@ -0,0 +1,120 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ */
+package dfc
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPrecondition(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	for _, test := range []struct {
+		ifmatch, ifunmodified string
+		invalid, none         bool
+		match                 []string
+	}{
+		{none: true},
+		{ifmatch: `"3", W/"abc" ,*`, match: []string{"3", "abc", "*"}},
+		{ifunmodified: now.Format(http.TimeFormat)},
+		{ifmatch: " , ", invalid: true},
+		{ifunmodified: "yesterday", invalid: true},
+	} {
+		r := httptest.NewRequest(http.MethodDelete, "/v1/objects/bucket/obj", nil)
+		if test.ifmatch != "" {
+			r.Header.Set(HeaderIfMatch, test.ifmatch)
+		}
+		if test.ifunmodified != "" {
+			r.Header.Set(HeaderIfUnmodified, test.ifunmodified)
+		}
+		pc, errstr := parsePrecondition(r)
+		if (errstr != "") != test.invalid || (pc == nil) != (test.none || test.invalid) {
+			t.Errorf("%q, %q: unexpected %+v, %s", test.ifmatch, test.ifunmodified, pc, errstr)
+			continue
+		}
+		if pc == nil {
+			continue
+		}
+		if len(pc.match) != len(test.match) {
+			t.Errorf("%q: expected %v, got %v", test.ifmatch, test.match, pc.match)
+		}
+		if test.ifunmodified != "" && !pc.unmodified.Equal(now) {
+			t.Errorf("%q: got %v", test.ifunmodified, pc.unmodified)
+		}
+	}
+
+	st := &objstate{version: "2", cksums: []string{"", "abcd"}, modified: now.Add(500 * time.Millisecond)}
+	for _, test := range []struct {
+		pc precondition
+		ok bool
+	}{
+		{precondition{match: []string{"2"}}, true},
+		{precondition{match: []string{"1", "abcd"}}, true},
+		{precondition{match: []string{"*"}}, true},
+		{precondition{match: []string{"1", ""}}, false},
+		{precondition{unmodified: now}, true},
+		{precondition{unmodified: now.Add(-time.Second)}, false},
+		{precondition{match: []string{"2"}, unmodified: now.Add(-time.Second)}, false},
+	} {
+		cerr := test.pc.check("bucket", "obj", st)
+		if (cerr == nil) != test.ok || (cerr != nil && cerr.Status != http.StatusPreconditionFailed) {
+			t.Errorf("%+v: expected ok %t, got %v", test.pc, test.ok, cerr)
+		}
+	}
+}
+
+func TestConditionalDelete(t *testing.T) {
+	const bucket = "condbucket"
+	target := &targetrunner{}
+	m := newMockCloud(target, bucket)
+	m.versioning = true
+	ct := context.Background()
+	for i := 0; i < 2; i++ {
+		if _, cerr := m.putobj(ct, bytes.NewReader([]byte("data")), bucket, "obj", nil); cerr != nil {
+			t.Fatal(cerr)
+		}
+	}
+	// overwritten since version 1 was seen
+	pct := context.WithValue(ct, ctxPrecond, &precondition{match: []string{"1"}})
+	if cerr := m.deleteobj(pct, bucket, "obj"); cerr == nil || cerr.Status != http.StatusPreconditionFailed {
+		t.Fatalf("Expected %d, got %v", http.StatusPreconditionFailed, cerr)
+	}
+	pct = context.WithValue(ct, ctxPrecond, &precondition{match: []string{"2"}})
+	if cerr := m.deleteobj(pct, bucket, "obj"); cerr != nil {
+		t.Fatal(cerr)
+	}
+	if cerr := m.deleteobj(pct, bucket, "obj"); cerr == nil || cerr.Status != http.StatusNotFound {
+		t.Errorf("Expected %d, got %v", http.StatusNotFound, cerr)
+	}
+
+	// objects stored by the target
+	dir, err := ioutil.TempDir("", "precond")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fqn := filepath.Join(dir, "obj")
+	if err = ioutil.WriteFile(fqn, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	finfo, err := os.Stat(fqn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := localObjstate(fqn, finfo)
+	if !st.modified.Equal(finfo.ModTime()) {
+		t.Errorf("Expected modified %v, got %v", finfo.ModTime(), st.modified)
+	}
+	pc := &precondition{unmodified: time.Now().Add(-time.Hour)}
+	if cerr := pc.check(bucket, "obj", st); cerr == nil {
+		t.Error("Expected the object modified after the time to fail the precondition")
+	}
+}
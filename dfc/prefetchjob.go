@@ -0,0 +1,377 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/NVIDIA/dfcpub/3rdparty/glog"
+)
+
+// ============================= Prefetch jobs ===============================
+// A training job reads the shards of a Cloud bucket in some order, epoch
+// after epoch. A prefetch job, started at a proxy with the "prefetchjob"
+// action, follows that order: it prefetches each shard at the target that
+// owns it no more than lookahead shards ahead of the consumer, which reports
+// its position (the epoch and the number of shards of the epoch it has read)
+// to the same proxy with the "jobposition" action. The order is either given
+// or made of the objects with the prefix; with "shuffle" it is shuffled anew
+// every epoch with the seed. Optionally, the job evicts the shards the
+// consumer has read, unless they are prefetched again for the epoch to
+// come, and caps its prefetch bandwidth with a token bucket. Jobs are kept in
+// the memory of the proxy: GET /v1/cluster?what=prefetchjobs returns their
+// progress; "jobstop" stops a job.
+// ============================= Prefetch jobs ===============================
+
+const defaultLookahead = 4
+
+type (
+	prefetchJob struct {
+		mu       sync.Mutex
+		cond     *sync.Cond
+		info     PrefetchJobInfo
+		msg      *PrefetchJobMsg
+		token    string
+		shards   []string
+		sizes    map[string]int64
+		orders   map[int][]string // by epoch, shuffled
+		consumed int              // shards read by the consumer, all epochs
+		window   map[string]int   // prefetched shards not read yet
+		limiter  *tokenBucket     // nil - unlimited
+		stopped  bool
+	}
+	prefetchJobs struct {
+		sync.Mutex
+		m     map[string]*prefetchJob
+		count int
+	}
+)
+
+func parsePrefetchJobMsg(msg *ActionMsg) (*PrefetchJobMsg, error) {
+	jobmsg := &PrefetchJobMsg{}
+	if msg.Value != nil {
+		b, err := json.Marshal(msg.Value)
+		if err == nil {
+			err = json.Unmarshal(b, jobmsg)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Invalid prefetch job parameters %v, err: %v", msg.Value, err)
+		}
+	}
+	if jobmsg.Epochs < 0 || jobmsg.Lookahead < 0 || jobmsg.Bandwidth < 0 {
+		return nil, fmt.Errorf("Invalid prefetch job parameters %+v", jobmsg)
+	}
+	if jobmsg.Lookahead == 0 {
+		jobmsg.Lookahead = defaultLookahead
+	}
+	return jobmsg, nil
+}
+
+func newPrefetchJob(id, bucket string, jobmsg *PrefetchJobMsg, shards []string, sizes map[string]int64) *prefetchJob {
+	job := &prefetchJob{
+		info:   PrefetchJobInfo{ID: id, Bucket: bucket, Shards: len(shards), Running: true, Started: time.Now()},
+		msg:    jobmsg,
+		shards: shards,
+		sizes:  sizes,
+		orders: make(map[int][]string),
+		window: make(map[string]int),
+	}
+	job.cond = sync.NewCond(&job.mu)
+	if jobmsg.Bandwidth > 0 {
+		job.limiter = newTokenBucket(jobmsg.Bandwidth)
+	}
+	return job
+}
+
+// order returns the shards in the order of the epoch; is called under lock
+func (job *prefetchJob) order(epoch int) []string {
+	if !job.msg.Shuffle {
+		return job.shards
+	}
+	if order, ok := job.orders[epoch]; ok {
+		return order
+	}
+	order := make([]string, len(job.shards))
+	for i, j := range epochRand(job.msg.Seed, int64(epoch)).Perm(len(job.shards)) {
+		order[i] = job.shards[j]
+	}
+	for e := range job.orders {
+		if e < epoch-1 {
+			delete(job.orders, e)
+		}
+	}
+	job.orders[epoch] = order
+	return order
+}
+
+// next waits until the shard at the position (counting from the start of the
+// job) is within the lookahead of the consumer and returns it; returns an
+// empty name if the consumer has read it already, and false once the job is
+// stopped
+func (job *prefetchJob) next(pos int) (string, bool) {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	for !job.stopped && pos >= job.consumed+job.msg.Lookahead {
+		job.cond.Wait()
+	}
+	if job.stopped {
+		return "", false
+	}
+	if pos < job.consumed {
+		return "", true
+	}
+	n := len(job.shards)
+	return job.order(pos / n)[pos%n], true
+}
+
+func (job *prefetchJob) prefetched(shard string, errstr string) {
+	job.mu.Lock()
+	if errstr != "" {
+		job.info.Failed++
+		job.info.Error = errstr
+	} else {
+		job.window[shard]++
+		job.info.Prefetched++
+		job.info.Bytes += job.sizes[shard]
+	}
+	job.mu.Unlock()
+}
+
+// advance moves the consumer to the position and returns the shards to evict
+func (job *prefetchJob) advance(epoch, position int) ([]string, error) {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	n := len(job.shards)
+	if position < 0 || position > n || epoch < 0 || (job.msg.Epochs > 0 && epoch >= job.msg.Epochs) {
+		return nil, fmt.Errorf("Invalid position %d of epoch %d: %d shards, %d epochs",
+			position, epoch, n, job.msg.Epochs)
+	}
+	if epoch > job.consumed/n+1 {
+		return nil, fmt.Errorf("Invalid epoch %d: the consumer is at epoch %d", epoch, job.consumed/n)
+	}
+	pos := epoch*n + position
+	if pos < job.consumed {
+		return nil, fmt.Errorf("Invalid position %d of epoch %d: the consumer cannot move back", position, epoch)
+	}
+	var evict []string
+	for ; job.consumed < pos; job.consumed++ {
+		shard := job.order(job.consumed / n)[job.consumed%n]
+		if job.window[shard] > 1 {
+			job.window[shard]--
+			continue
+		}
+		delete(job.window, shard)
+		if job.msg.Evict {
+			evict = append(evict, shard)
+		}
+	}
+	job.info.Epoch, job.info.Position = epoch, position
+	job.info.Evicted += int64(len(evict))
+	job.cond.Broadcast()
+	return evict, nil
+}
+
+func (job *prefetchJob) stop() {
+	job.mu.Lock()
+	job.stopped = true
+	job.cond.Broadcast()
+	job.mu.Unlock()
+}
+
+func (job *prefetchJob) finish(errstr string) {
+	job.mu.Lock()
+	job.info.Running = false
+	job.info.Finished = time.Now()
+	if errstr != "" {
+		job.info.Error = errstr
+	}
+	job.mu.Unlock()
+}
+
+func (job *prefetchJob) getInfo() *PrefetchJobInfo {
+	job.mu.Lock()
+	info := job.info
+	job.mu.Unlock()
+	return &info
+}
+
+//
+// proxy
+//
+
+// POST {"action":"prefetchjob"} /v1/buckets/bucket-name
+func (p *proxyrunner) startPrefetchJob(w http.ResponseWriter, r *http.Request, bucket string, msg *ActionMsg) {
+	if p.bmdowner.get().islocal(bucket) {
+		p.invalmsghdlr(w, r, fmt.Sprintf("Cannot prefetch from a local bucket: %s", bucket))
+		return
+	}
+	jobmsg, err := parsePrefetchJobMsg(msg)
+	if err != nil {
+		p.invalmsghdlr(w, r, err.Error())
+		return
+	}
+	token := r.Header.Get("Authorization")
+	entries, err := p.listObjects(bucket, jobmsg.Prefix, GetPropsSize, token)
+	if err != nil {
+		p.invalmsghdlr(w, r, fmt.Sprintf("Failed to list bucket %s, err: %v", bucket, err))
+		return
+	}
+	sizes := make(map[string]int64, len(entries))
+	for _, entry := range entries {
+		sizes[entry.Name] = entry.Size
+	}
+	shards := jobmsg.Shards
+	if len(shards) == 0 {
+		for _, entry := range entries {
+			shards = append(shards, entry.Name)
+		}
+	}
+	for _, shard := range shards {
+		if _, ok := sizes[shard]; !ok {
+			p.invalmsghdlr(w, r, fmt.Sprintf("Shard %s/%s does not exist", bucket, shard), http.StatusNotFound)
+			return
+		}
+	}
+	if len(shards) == 0 {
+		p.invalmsghdlr(w, r, fmt.Sprintf("No shards with prefix %q in bucket %s", jobmsg.Prefix, bucket))
+		return
+	}
+
+	p.prefetchJobs.Lock()
+	if p.prefetchJobs.m == nil {
+		p.prefetchJobs.m = make(map[string]*prefetchJob)
+	}
+	p.prefetchJobs.count++
+	id := fmt.Sprintf("%s-%d", bucket, p.prefetchJobs.count)
+	job := newPrefetchJob(id, bucket, jobmsg, shards, sizes)
+	job.token = token
+	p.prefetchJobs.m[id] = job
+	p.prefetchJobs.Unlock()
+
+	glog.Infof("Prefetch job %s: %d shards, %d epochs, lookahead %d", id, len(shards), jobmsg.Epochs, jobmsg.Lookahead)
+	go p.runPrefetchJob(job)
+	jsbytes, err := json.Marshal(job.getInfo())
+	assert(err == nil, err)
+	p.writeJSON(w, r, jsbytes, "prefetchjob")
+}
+
+func (p *proxyrunner) runPrefetchJob(job *prefetchJob) {
+	n := len(job.shards)
+	for epoch := 0; job.msg.Epochs == 0 || epoch < job.msg.Epochs; epoch++ {
+		for i := 0; i < n; i++ {
+			shard, ok := job.next(epoch*n + i)
+			if !ok {
+				job.finish("")
+				return
+			}
+			if shard == "" {
+				continue
+			}
+			if ctx.config.Egress.Refuse {
+				if errstr := p.egressExhausted(job.info.Bucket); errstr != "" {
+					job.finish(errstr)
+					return
+				}
+			}
+			errstr := p.prefetchShard(job, shard)
+			if errstr != "" {
+				glog.Errorf("Prefetch job %s: %s", job.info.ID, errstr)
+			}
+			job.prefetched(shard, errstr)
+			if job.limiter != nil && errstr == "" {
+				job.limiter.take(int(job.sizes[shard]))
+			}
+		}
+	}
+	glog.Infof("Prefetch job %s: done", job.info.ID)
+	job.finish("")
+}
+
+// prefetchShard makes the target that owns the shard prefetch it and waits
+func (p *proxyrunner) prefetchShard(job *prefetchJob, shard string) string {
+	return p.shardAction(job, ActPrefetch, http.MethodPost, []string{shard})
+}
+
+func (p *proxyrunner) shardAction(job *prefetchJob, action, method string, shards []string) string {
+	bucket := job.info.Bucket
+	pertarget := make(map[*daemonInfo][]string)
+	smap := p.smapowner.get()
+	for _, shard := range shards {
+		si, errstr := HrwTarget(bucket, shard, smap)
+		if errstr != "" {
+			return errstr
+		}
+		pertarget[si] = append(pertarget[si], shard)
+	}
+	for si, objnames := range pertarget {
+		listmsg := &ListMsg{RangeListMsgBase: RangeListMsgBase{Wait: true}, Objnames: objnames}
+		jsbytes, err := json.Marshal(&ActionMsg{Action: action, Value: listmsg})
+		assert(err == nil, err)
+		url := si.controlURL() + URLPath(Rversion, Rbuckets, bucket) + "?" + URLParamLocal + "=false"
+		if _, err = p.requestURL(method, url, jsbytes, job.token); err != nil {
+			return fmt.Sprintf("Failed to %s %v at %s, err: %v", action, objnames, si.DaemonID, err)
+		}
+	}
+	return ""
+}
+
+// POST {"action":"jobposition"|"jobstop"} /v1/buckets/bucket-name
+func (p *proxyrunner) prefetchJobAction(w http.ResponseWriter, r *http.Request, bucket string, msg *ActionMsg) {
+	posmsg := &JobPositionMsg{}
+	b, err := json.Marshal(msg.Value)
+	if err == nil {
+		err = json.Unmarshal(b, posmsg)
+	}
+	if err != nil {
+		p.invalmsghdlr(w, r, fmt.Sprintf("Invalid job position %v, err: %v", msg.Value, err))
+		return
+	}
+	p.prefetchJobs.Lock()
+	job, ok := p.prefetchJobs.m[posmsg.ID]
+	p.prefetchJobs.Unlock()
+	if !ok || job.info.Bucket != bucket {
+		p.invalmsghdlr(w, r, fmt.Sprintf("Prefetch job %s of bucket %s %s", posmsg.ID, bucket, doesnotexist),
+			http.StatusNotFound)
+		return
+	}
+	if msg.Action == ActJobStop {
+		job.stop()
+		glog.Infof("Prefetch job %s: stopped", job.info.ID)
+	} else {
+		evict, err := job.advance(posmsg.Epoch, posmsg.Position)
+		if err != nil {
+			p.invalmsghdlr(w, r, err.Error())
+			return
+		}
+		if len(evict) > 0 {
+			go func() {
+				if errstr := p.shardAction(job, ActEvict, http.MethodDelete, evict); errstr != "" {
+					glog.Errorf("Prefetch job %s: %s", job.info.ID, errstr)
+				}
+			}()
+		}
+	}
+	jsbytes, err := json.Marshal(job.getInfo())
+	assert(err == nil, err)
+	p.writeJSON(w, r, jsbytes, "prefetchjob")
+}
+
+// GET /v1/cluster?what=prefetchjobs
+func (p *proxyrunner) prefetchJobsInfo() []*PrefetchJobInfo {
+	p.prefetchJobs.Lock()
+	defer p.prefetchJobs.Unlock()
+	infos := make([]*PrefetchJobInfo, 0, len(p.prefetchJobs.m))
+	for _, job := range p.prefetchJobs.m {
+		infos = append(infos, job.getInfo())
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Started.Before(infos[j].Started) })
+	return infos
+}
@@ -0,0 +1,117 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ */
+package dfc
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestPrefetchJob(t *testing.T) {
+	shards := []string{"s0", "s1", "s2", "s3"}
+	sizes := map[string]int64{"s0": 10, "s1": 10, "s2": 10, "s3": 10}
+	jobmsg, err := parsePrefetchJobMsg(&ActionMsg{Action: ActPrefetchJob,
+		Value: map[string]interface{}{"lookahead": 2, "evict": true, "epochs": 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := newPrefetchJob("job", "bucket", jobmsg, shards, sizes)
+
+	// prefetch up to the lookahead
+	for pos := 0; pos < 2; pos++ {
+		shard, ok := job.next(pos)
+		if !ok || shard != shards[pos] {
+			t.Fatalf("Expected shard %s, got %q", shards[pos], shard)
+		}
+		job.prefetched(shard, "")
+	}
+	nextch := make(chan string, 1)
+	go func() {
+		shard, _ := job.next(2)
+		nextch <- shard
+	}()
+	select {
+	case shard := <-nextch:
+		t.Fatalf("Expected to wait for the consumer, got %s", shard)
+	case <-time.After(50 * time.Millisecond):
+	}
+	evict, err := job.advance(0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if shard := <-nextch; shard != "s2" {
+		t.Fatalf("Expected shard s2, got %s", shard)
+	}
+	if !reflect.DeepEqual(evict, []string{"s0"}) {
+		t.Errorf("Expected s0 to be evicted, got %v", evict)
+	}
+
+	// the consumer passes the prefetcher
+	if _, err = job.advance(0, 4); err != nil {
+		t.Fatal(err)
+	}
+	if shard, ok := job.next(3); !ok || shard != "" {
+		t.Errorf("Expected shard s3 to be skipped, got %q", shard)
+	}
+	if info := job.getInfo(); info.Prefetched != 2 || info.Bytes != 20 || info.Evicted != 4 {
+		t.Errorf("Unexpected job progress %+v", info)
+	}
+
+	if _, err = job.advance(0, 3); err == nil {
+		t.Error("Expected the consumer not to move back")
+	}
+	if _, err = job.advance(2, 0); err == nil {
+		t.Error("Expected epoch 2 of 2 to be invalid")
+	}
+	job.stop()
+	if _, ok := job.next(5); ok {
+		t.Error("Expected the stopped job to stop prefetching")
+	}
+}
+
+func TestPrefetchJobShuffle(t *testing.T) {
+	shards := []string{"s0", "s1", "s2", "s3", "s4", "s5", "s6", "s7"}
+	jobmsg := &PrefetchJobMsg{Shuffle: true, Seed: 3, Lookahead: len(shards) + 1, Evict: true}
+	job := newPrefetchJob("job", "bucket", jobmsg, shards, map[string]int64{})
+
+	// each epoch is a permutation of the shards
+	var epochs [][]string
+	for epoch := 0; epoch < 3; epoch++ {
+		order := append([]string(nil), job.order(epoch)...)
+		sorted := append([]string(nil), order...)
+		sort.Strings(sorted)
+		if !reflect.DeepEqual(sorted, shards) {
+			t.Fatalf("Epoch %d: unexpected order %v", epoch, order)
+		}
+		epochs = append(epochs, order)
+	}
+	if reflect.DeepEqual(epochs[0], epochs[1]) && reflect.DeepEqual(epochs[1], epochs[2]) {
+		t.Errorf("Expected the epochs to be shuffled differently")
+	}
+
+	// all of epoch 0 and the first shard of epoch 1 are prefetched: the
+	// latter is not evicted when the consumer finishes epoch 0
+	n := len(shards)
+	for pos := 0; pos <= n; pos++ {
+		shard, _ := job.next(pos)
+		job.prefetched(shard, "")
+	}
+	evict, err := job.advance(0, n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(evict) != n-1 {
+		t.Fatalf("Expected %d shards to be evicted, got %v", n-1, evict)
+	}
+	for _, shard := range evict {
+		if shard == epochs[1][0] {
+			t.Errorf("Shard %s to be read next epoch is evicted", shard)
+		}
+	}
+	if evict, _ = job.advance(1, 1); !reflect.DeepEqual(evict, []string{epochs[1][0]}) {
+		t.Errorf("Expected %s to be evicted, got %v", epochs[1][0], evict)
+	}
+}
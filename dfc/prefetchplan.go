@@ -0,0 +1,223 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/NVIDIA/dfcpub/3rdparty/glog"
+)
+
+// ============================= Prefetch planning ===========================
+// Before prefetching, the proxy can ask each target to estimate its share:
+// the objects it would fetch from the Cloud (not cached yet), their total
+// size and the number of cloud requests - the list pages for a range, HEADs
+// of the listed objects that are missing, and one GET per object. The proxy
+// prices the estimate as per prefetchplanconf. With "plan" set in the
+// prefetch message the estimate is returned and nothing is prefetched; with
+// confirm_threshold configured, prefetches estimated to cost more are
+// refused unless "confirm" is set. Note that planning a range lists it at
+// every target - as the prefetch itself does.
+// ============================= Prefetch planning ===========================
+
+// PrefetchPlan is the estimated cost of a prefetch
+type PrefetchPlan struct {
+	Objects  int64                    `json:"objects"`           // objects to fetch from the Cloud
+	Cached   int64                    `json:"cached"`            // objects cached already
+	Bytes    int64                    `json:"bytes"`             // cloud egress
+	Requests int64                    `json:"requests"`          // cloud requests: list pages, HEADs and GETs
+	Cost     float64                  `json:"cost"`              // see prefetchplanconf
+	Targets  map[string]*PrefetchPlan `json:"targets,omitempty"` // per target, in the cluster plan only
+}
+
+func (plan *PrefetchPlan) price() {
+	conf := &ctx.config.PrefetchPlan
+	plan.Cost = float64(plan.Requests)/1000*conf.RequestCost + float64(plan.Bytes)/GiB*conf.EgressCost
+}
+
+func (plan *PrefetchPlan) missing(size int64) {
+	plan.Objects++
+	plan.Bytes += size
+	plan.Requests++ // GET
+}
+
+//
+// target
+//
+
+// planPrefetch writes the estimate of the target's share of the list or range prefetch
+func (t *targetrunner) planPrefetch(w http.ResponseWriter, r *http.Request, listMsg *ListMsg, rangeMsg *RangeMsg) {
+	apitems := t.restAPIItems(r.URL.Path, 5)
+	if apitems = t.checkRestAPI(w, r, apitems, 1, Rversion, Rbuckets); apitems == nil {
+		return
+	}
+	bucket := apitems[0]
+	if t.bmdowner.get().islocal(bucket) {
+		t.invalmsghdlr(w, r, fmt.Sprintf("Cannot prefetch from a local bucket: %s", bucket))
+		return
+	}
+	var (
+		plan *PrefetchPlan
+		err  error
+		ct   = t.contextWithAuth(r)
+	)
+	if listMsg != nil {
+		plan, err = t.planPrefetchList(ct, bucket, listMsg.Objnames)
+	} else {
+		plan, err = t.planPrefetchRange(ct, bucket, rangeMsg)
+	}
+	if err != nil {
+		t.invalmsghdlr(w, r, err.Error())
+		return
+	}
+	jsbytes, err := json.Marshal(plan)
+	assert(err == nil, err)
+	t.writeJSON(w, r, jsbytes, "planprefetch")
+}
+
+func (t *targetrunner) isCached(bucket, objname string) bool {
+	fqn := t.lookupfqn(bucket, objname, false)
+	coldget, _, _, errstr := t.lookupLocally(bucket, objname, fqn)
+	return !coldget && errstr == ""
+}
+
+func (t *targetrunner) planPrefetchList(ct context.Context, bucket string, objnames []string) (*PrefetchPlan, error) {
+	var (
+		plan = &PrefetchPlan{}
+		smap = t.smapowner.get()
+	)
+	for _, objname := range objnames {
+		si, errstr := HrwTarget(bucket, objname, smap)
+		if errstr != "" {
+			return nil, errors.New(errstr)
+		}
+		if si.DaemonID != t.si.DaemonID {
+			continue
+		}
+		if t.isCached(bucket, objname) {
+			plan.Cached++
+			continue
+		}
+		plan.Requests++ // HEAD
+		objmeta, cerr := t.cloudif.headobject(ct, bucket, objname)
+		if cerr != nil {
+			if cerr.Status == http.StatusNotFound {
+				continue // nothing to prefetch
+			}
+			return nil, fmt.Errorf("Failed to HEAD %s/%s: %d(%s)", bucket, objname, cerr.Status, cerr.Message)
+		}
+		size, err := strconv.ParseInt(objmeta[Size], 10, 64)
+		if err != nil {
+			glog.Warningf("Unknown size of %s/%s: %q", bucket, objname, objmeta[Size])
+		}
+		plan.missing(size)
+	}
+	return plan, nil
+}
+
+func (t *targetrunner) planPrefetchRange(ct context.Context, bucket string, rangeMsg *RangeMsg) (*PrefetchPlan, error) {
+	min, max, err := parseRange(rangeMsg.Range)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing range string (%s): %v", rangeMsg.Range, err)
+	}
+	entries, pages, err := t.getEntriesFromRange(ct, bucket, rangeMsg.Prefix, rangeMsg.Regex, min, max)
+	if err != nil {
+		return nil, err
+	}
+	plan := &PrefetchPlan{Requests: int64(pages)}
+	for _, be := range entries {
+		if t.isCached(bucket, be.Name) {
+			plan.Cached++
+		} else {
+			plan.missing(be.Size)
+		}
+	}
+	return plan, nil
+}
+
+//
+// proxy
+//
+
+// prefetch plans the prefetch when asked to, or when the cost needs to be
+// confirmed, and broadcasts it to the targets otherwise
+func (p *proxyrunner) prefetch(w http.ResponseWriter, r *http.Request, bucket string, msg *ActionMsg) {
+	jsmap, ok := msg.Value.(map[string]interface{})
+	if !ok {
+		p.invalmsghdlr(w, r, fmt.Sprintf("Unexpected Value format %+v, %T", msg.Value, msg.Value))
+		return
+	}
+	base, errstr := parseRangeListMsgBase(jsmap)
+	if errstr != "" {
+		p.invalmsghdlr(w, r, errstr)
+		return
+	}
+	threshold := ctx.config.PrefetchPlan.ConfirmThreshold
+	if !base.Plan && (base.Confirm || threshold <= 0) {
+		p.actionlistrange(w, r, msg)
+		return
+	}
+	plan, errstr := p.planPrefetch(bucket, msg)
+	if errstr != "" {
+		p.invalmsghdlr(w, r, errstr)
+		return
+	}
+	if base.Plan {
+		jsbytes, err := json.Marshal(plan)
+		assert(err == nil, err)
+		p.writeJSON(w, r, jsbytes, "planprefetch")
+		return
+	}
+	if plan.Cost > threshold {
+		p.invalmsghdlr(w, r, fmt.Sprintf("Prefetch from bucket %s is estimated to cost %.2f (%d objects, %d bytes, "+
+			"%d requests) which is above %.2f: set \"confirm\" to proceed",
+			bucket, plan.Cost, plan.Objects, plan.Bytes, plan.Requests, threshold), http.StatusPreconditionFailed)
+		return
+	}
+	p.actionlistrange(w, r, msg)
+}
+
+// planPrefetch collects the targets' estimates
+func (p *proxyrunner) planPrefetch(bucket string, msg *ActionMsg) (plan *PrefetchPlan, errstr string) {
+	value := make(map[string]interface{}, len(msg.Value.(map[string]interface{}))+1)
+	for k, v := range msg.Value.(map[string]interface{}) {
+		value[k] = v
+	}
+	value["plan"] = true
+	jsbytes, err := json.Marshal(&ActionMsg{Action: msg.Action, Name: msg.Name, Value: value})
+	assert(err == nil, err)
+
+	q := url.Values{}
+	q.Set(URLParamLocal, strconv.FormatBool(p.bmdowner.get().islocal(bucket)))
+	results := p.broadcastTargets(URLPath(Rversion, Rbuckets, bucket), q, http.MethodPost, jsbytes,
+		p.smapowner.get(), ctx.config.Timeout.DefaultLong)
+
+	plan = &PrefetchPlan{Targets: make(map[string]*PrefetchPlan)}
+	for res := range results {
+		if res.err != nil {
+			return nil, fmt.Sprintf("Failed to plan prefetch at %s: %v (%d: %s)",
+				res.si.DaemonID, res.err, res.status, res.errstr)
+		}
+		tplan := &PrefetchPlan{}
+		if err := json.Unmarshal(res.outjson, tplan); err != nil {
+			return nil, fmt.Sprintf("Failed to unmarshal prefetch plan from %s, err: %v", res.si.DaemonID, err)
+		}
+		tplan.price()
+		plan.Targets[res.si.DaemonID] = tplan
+		plan.Objects += tplan.Objects
+		plan.Cached += tplan.Cached
+		plan.Bytes += tplan.Bytes
+		plan.Requests += tplan.Requests
+	}
+	plan.price()
+	return
+}
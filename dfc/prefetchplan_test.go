@@ -0,0 +1,78 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ */
+package dfc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPrefetchPlan(t *testing.T) {
+	const bucket = "mockbucket"
+	dir, err := ioutil.TempDir("", "prefetchplan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	oldavail, oldconf := ctx.mountpaths.Available, ctx.config.PrefetchPlan
+	defer func() { ctx.mountpaths.Available, ctx.config.PrefetchPlan = oldavail, oldconf }()
+	ctx.mountpaths.Available = map[string]*mountPath{dir: {Path: dir}}
+
+	target := &targetrunner{}
+	target.si = &daemonInfo{DaemonID: "target"}
+	target.bmdowner = &bmdowner{}
+	target.bmdowner.put(newBucketMD())
+	target.smapowner = &smapowner{}
+	smap := newSmap()
+	smap.addTarget(target.si)
+	target.smapowner.put(smap)
+	m := newMockCloud(target, bucket)
+	target.cloudif = m
+	ct := context.Background()
+	for i := 0; i < 10; i++ {
+		data := make([]byte, 100*(i+1))
+		if _, cerr := m.putobj(ct, bytes.NewReader(data), bucket, fmt.Sprintf("shard-%d.tar", i), nil); cerr != nil {
+			t.Fatal(cerr)
+		}
+	}
+	// cached
+	fqn := target.fqn(bucket, "shard-0.tar", false)
+	if err = CreateDir(filepath.Dir(fqn)); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(fqn, make([]byte, 100), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	plan, err := target.planPrefetchRange(ct, bucket, &RangeMsg{Prefix: "shard-", Regex: "\\d", Range: "0:4"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// shard-1 through shard-4 are missing, one list page and 4 GETs
+	if plan.Objects != 4 || plan.Cached != 1 || plan.Bytes != 1400 || plan.Requests != 5 {
+		t.Fatalf("Unexpected range plan %+v", plan)
+	}
+
+	plan, err = target.planPrefetchList(ct, bucket, []string{"shard-0.tar", "shard-9.tar", "nonexistent"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 2 HEADs and 1 GET
+	if plan.Objects != 1 || plan.Cached != 1 || plan.Bytes != 1000 || plan.Requests != 3 {
+		t.Fatalf("Unexpected list plan %+v", plan)
+	}
+
+	ctx.config.PrefetchPlan = prefetchplanconf{RequestCost: 0.4, EgressCost: 0.09}
+	plan = &PrefetchPlan{Requests: 2000, Bytes: 10 * GiB}
+	plan.price()
+	if math.Abs(plan.Cost-1.7) > 1e-9 {
+		t.Fatalf("Expected cost 1.7, got %v", plan.Cost)
+	}
+}
@@ -0,0 +1,256 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/NVIDIA/dfcpub/3rdparty/glog"
+)
+
+// Synthetic probing. Every probeconf.Interval the primary proxy probes each
+// target directly: it PUTs the target's canary object - an object of the
+// local bucket probeBucket that the target stores - GETs and validates it,
+// and lists the bucket. The results make up per-target availability and
+// latency SLIs computed over the last probeconf.Window probes; the SLIs are
+// part of the cluster load view (see load.go), are evaluated by the
+// alerting rules, and the probe counters are accounted in the proxy stats
+// separately from the user traffic.
+
+const (
+	probeBucket = "__dfcprobe"
+	probeSize   = 4 * KiB
+	probeWindow = 10
+)
+
+// ProbeSLI is the availability and latency of a target as seen by the prober
+type ProbeSLI struct {
+	Time         time.Time     `json:"time"`         // last probe
+	Probes       int64         `json:"probes"`       // total since the proxy became primary
+	Failures     int64         `json:"failures"`     // ditto
+	Availability float64       `json:"availability"` // % of the successful probes in the window
+	PutLatency   time.Duration `json:"put_latency"`  // average over the successful probes in the window
+	GetLatency   time.Duration `json:"get_latency"`  // ditto
+	ListLatency  time.Duration `json:"list_latency"` // ditto
+	LastError    string        `json:"last_error,omitempty"`
+	window       []*probeResult
+}
+
+type probeResult struct {
+	err            string
+	put, get, list time.Duration
+}
+
+type proberunner struct {
+	namedrunner
+	sync.Mutex
+	p      *proxyrunner
+	conf   *probeconf
+	slis   map[string]*ProbeSLI
+	chstop chan struct{}
+}
+
+func newproberunner(p *proxyrunner, conf *probeconf) *proberunner {
+	return &proberunner{
+		p:      p,
+		conf:   conf,
+		slis:   make(map[string]*ProbeSLI),
+		chstop: make(chan struct{}, 4),
+	}
+}
+
+func (r *proberunner) run() error {
+	glog.Infof("Starting %s", r.name)
+	ticker := time.NewTicker(r.conf.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			// the targets may not have the cluster map yet
+			if !r.p.smapowner.get().isPrimary(r.p.si) || r.p.startedup(0) == 0 {
+				continue
+			}
+			r.probe()
+		case <-r.chstop:
+			return nil
+		}
+	}
+}
+
+func (r *proberunner) stop(err error) {
+	glog.Infof("Stopping %s, err: %v", r.name, err)
+	var v struct{}
+	r.chstop <- v
+	close(r.chstop)
+}
+
+// probe probes all targets in parallel and records the results
+func (r *proberunner) probe() {
+	if !r.p.bmdowner.get().islocal(probeBucket) {
+		if errstr := r.p.createLocalBucket(probeBucket, &ActionMsg{Action: ActCreateLB}); errstr != "" {
+			glog.Errorf("Failed to create probe bucket %s: %s", probeBucket, errstr)
+			return
+		}
+	}
+	var (
+		wg       sync.WaitGroup
+		smap     = r.p.smapowner.get()
+		objnames = hrwObjnames(probeBucket, probeBucket, smap)
+		results  = make(map[string]*probeResult, len(smap.Tmap))
+		mu       sync.Mutex
+	)
+	for sid, si := range smap.Tmap {
+		objname, ok := objnames[sid]
+		if !ok {
+			continue
+		}
+		wg.Add(1)
+		go func(si *daemonInfo, objname string) {
+			res := r.probeTarget(si, objname)
+			mu.Lock()
+			results[si.DaemonID] = res
+			mu.Unlock()
+			wg.Done()
+		}(si, objname)
+	}
+	wg.Wait()
+
+	now := time.Now()
+	for sid, res := range results {
+		r.record(sid, res, now)
+		if res.err != "" {
+			glog.Errorf("Probe %s: %s", sid, res.err)
+			r.p.statsif.addMany("numprobe", int64(1), "numprobeerr", int64(1))
+		} else {
+			r.p.statsif.addMany("numprobe", int64(1), "probelatency", int64((res.put+res.get+res.list)/time.Microsecond))
+		}
+	}
+	r.Lock()
+	for sid := range r.slis {
+		if _, ok := smap.Tmap[sid]; !ok {
+			delete(r.slis, sid)
+		}
+	}
+	r.Unlock()
+}
+
+// probeTarget PUTs, GETs and validates the target's canary object and lists
+// the probe bucket on the target
+func (r *proberunner) probeTarget(si *daemonInfo, objname string) (res *probeResult) {
+	res = &probeResult{}
+	size := r.conf.Size
+	if size == 0 {
+		size = probeSize
+	}
+	data := make([]byte, size)
+	rand.Read(data)
+	url := fmt.Sprintf("%s%s?%s=true&%s=%s", si.DirectURL, URLEscapedPath(Rversion, Robjects, probeBucket, objname),
+		URLParamLocal, URLParamDaemonID, r.p.si.DaemonID)
+
+	started := time.Now()
+	result := r.p.call(nil, si, url, http.MethodPut, data, ctx.config.Timeout.Default)
+	if result.err != nil {
+		res.err = fmt.Sprintf("PUT %s/%s: %s", probeBucket, objname, result.errstr)
+		return
+	}
+	res.put = time.Since(started)
+
+	started = time.Now()
+	result = r.p.call(nil, si, url, http.MethodGet, nil, ctx.config.Timeout.Default)
+	if result.err != nil {
+		res.err = fmt.Sprintf("GET %s/%s: %s", probeBucket, objname, result.errstr)
+		return
+	}
+	if !bytes.Equal(result.outjson, data) {
+		res.err = fmt.Sprintf("GET %s/%s: data differs from the data written (%d/%d bytes)",
+			probeBucket, objname, len(result.outjson), len(data))
+		return
+	}
+	res.get = time.Since(started)
+
+	jsbytes, err := json.Marshal(&ActionMsg{Action: ActListObjects, Value: &GetMsg{GetPrefix: objname}})
+	assert(err == nil, err)
+	url = fmt.Sprintf("%s%s?%s=true", si.DirectURL, URLPath(Rversion, Rbuckets, probeBucket), URLParamLocal)
+	started = time.Now()
+	result = r.p.call(nil, si, url, http.MethodPost, jsbytes, ctx.config.Timeout.Default)
+	if result.err != nil {
+		res.err = fmt.Sprintf("list %s: %s", probeBucket, result.errstr)
+		return
+	}
+	res.list = time.Since(started)
+	bucketList := &BucketList{}
+	if err = json.Unmarshal(result.outjson, bucketList); err != nil {
+		res.err = fmt.Sprintf("list %s: %v", probeBucket, err)
+		return
+	}
+	for _, entry := range bucketList.Entries {
+		if entry.Name == objname {
+			return
+		}
+	}
+	res.err = fmt.Sprintf("list %s: %s is not listed", probeBucket, objname)
+	return
+}
+
+// record adds the result to the target's SLIs
+func (r *proberunner) record(sid string, res *probeResult, now time.Time) {
+	window := r.conf.Window
+	if window == 0 {
+		window = probeWindow
+	}
+	r.Lock()
+	defer r.Unlock()
+	sli, ok := r.slis[sid]
+	if !ok {
+		sli = &ProbeSLI{}
+		r.slis[sid] = sli
+	}
+	sli.Time = now
+	sli.Probes++
+	sli.LastError = res.err
+	if res.err != "" {
+		sli.Failures++
+	}
+	sli.window = append(sli.window, res)
+	if len(sli.window) > window {
+		sli.window = sli.window[len(sli.window)-window:]
+	}
+
+	var put, get, list time.Duration
+	passed := 0
+	for _, res := range sli.window {
+		if res.err != "" {
+			continue
+		}
+		passed++
+		put, get, list = put+res.put, get+res.get, list+res.list
+	}
+	sli.Availability = float64(passed) * 100 / float64(len(sli.window))
+	sli.PutLatency, sli.GetLatency, sli.ListLatency = 0, 0, 0
+	if passed > 0 {
+		n := time.Duration(passed)
+		sli.PutLatency, sli.GetLatency, sli.ListLatency = put/n, get/n, list/n
+	}
+}
+
+// get returns a copy of the targets' SLIs
+func (r *proberunner) get() map[string]*ProbeSLI {
+	r.Lock()
+	slis := make(map[string]*ProbeSLI, len(r.slis))
+	for sid, sli := range r.slis {
+		clone := *sli
+		clone.window = nil
+		slis[sid] = &clone
+	}
+	r.Unlock()
+	return slis
+}
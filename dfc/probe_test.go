@@ -0,0 +1,122 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ */
+package dfc
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NVIDIA/dfcpub/dfc/statsd"
+)
+
+func TestProbe(t *testing.T) {
+	// a target that stores objects in memory, and a target that fails PUTs
+	objects := make(map[string][]byte)
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPut:
+			if r.URL.Query().Get(URLParamDaemonID) != "primary" {
+				http.Error(w, "PUT requests are expected to be redirected", http.StatusBadRequest)
+				return
+			}
+			objects[r.URL.Path], _ = ioutil.ReadAll(r.Body)
+		case http.MethodGet:
+			w.Write(objects[r.URL.Path])
+		case http.MethodPost:
+			bucketList := &BucketList{}
+			prefix := URLPath(Rversion, Robjects, probeBucket) + "/"
+			for path := range objects {
+				bucketList.Entries = append(bucketList.Entries, &BucketEntry{Name: strings.TrimPrefix(path, prefix)})
+			}
+			jsbytes, _ := json.Marshal(bucketList)
+			w.Write(jsbytes)
+		}
+	}))
+	defer good.Close()
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "out of space", http.StatusInternalServerError)
+	}))
+	defer bad.Close()
+
+	proxy := &proxyrunner{}
+	proxy.si = &daemonInfo{DaemonID: "primary"}
+	proxy.httpclient = &http.Client{}
+	proxy.httpclientLongTimeout = &http.Client{}
+	oldtracker := ctx.config.KeepaliveTracker.Proxy
+	defer func() { ctx.config.KeepaliveTracker.Proxy = oldtracker }()
+	ctx.config.KeepaliveTracker.Proxy.Name = "heartbeat"
+	proxy.kalive = newproxykalive(proxy)
+	proxy.callStatsServer = NewCallStatsServer(nil, 1, &statsd.Client{})
+	proxy.callStatsServer.Start()
+	defer proxy.callStatsServer.Stop()
+	r := newproberunner(proxy, &probeconf{Window: 4})
+
+	now := time.Now()
+	res := r.probeTarget(&daemonInfo{DaemonID: "t1", DirectURL: good.URL}, probeBucket+"/1")
+	if res.err != "" {
+		t.Fatalf("Expected the probe to succeed, got %s", res.err)
+	}
+	if len(objects) != 1 || len(objects[URLPath(Rversion, Robjects, probeBucket, probeBucket, "1")]) != probeSize {
+		t.Errorf("Expected a %d bytes canary object, got %v", probeSize, objects)
+	}
+	r.record("t1", res, now)
+	res = r.probeTarget(&daemonInfo{DaemonID: "t2", DirectURL: bad.URL}, probeBucket+"/2")
+	if res.err == "" {
+		t.Fatal("Expected the probe to fail")
+	}
+	r.record("t2", res, now)
+
+	// t2 recovers: 1 of 4 probes failed
+	for i := 0; i < 3; i++ {
+		r.record("t2", &probeResult{put: time.Millisecond, get: 2 * time.Millisecond, list: 3 * time.Millisecond}, now)
+	}
+	slis := r.get()
+	if sli := slis["t1"]; sli.Availability != 100 || sli.Probes != 1 || sli.Failures != 0 || sli.GetLatency == 0 {
+		t.Errorf("Unexpected t1 SLIs %+v", sli)
+	}
+	if sli := slis["t2"]; sli.Availability != 75 || sli.Probes != 4 || sli.Failures != 1 || sli.LastError != "" ||
+		sli.ListLatency != 3*time.Millisecond {
+		t.Errorf("Unexpected t2 SLIs %+v", sli)
+	}
+	// the failure leaves the window
+	r.record("t2", &probeResult{put: time.Millisecond, get: 2 * time.Millisecond, list: 3 * time.Millisecond}, now)
+	if sli := r.get()["t2"]; sli.Availability != 100 || sli.Probes != 5 || sli.Failures != 1 {
+		t.Errorf("Unexpected t2 SLIs %+v", sli)
+	}
+
+	// alerting
+	conf := &alertconf{Rules: []alertrule{
+		{Kind: AlertProbeAvailability, Threshold: 80},
+		{Kind: AlertProbeLatency, Threshold: 2.5},
+	}}
+	for _, rule := range conf.Rules {
+		if err := validateAlertRule(rule); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if validateAlertRule(alertrule{Kind: AlertProbeLatency}) == nil {
+		t.Error("Expected zero probe latency threshold to be invalid")
+	}
+	ar := newalertrunner(proxy, conf)
+	events := ar.evaluate(&ClusterLoad{Probes: map[string]*ProbeSLI{
+		"t1": {Availability: 100, PutLatency: time.Millisecond},
+		"t2": {Availability: 75, ListLatency: 3 * time.Millisecond, LastError: "out of space"},
+	}}, now)
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 alerts, got %d", len(events))
+	}
+	for _, event := range events {
+		if event.Target != "t2" || event.Status != AlertFiring {
+			t.Errorf("Unexpected alert %+v", event)
+		}
+		if event.Kind == AlertProbeLatency && event.Value != 3 {
+			t.Errorf("Expected probe latency 3ms, got %v", event.Value)
+		}
+	}
+}
@@ -8,8 +8,10 @@ package dfc
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"net/url"
@@ -65,14 +67,20 @@ func wrapHandler(h http.HandlerFunc, wraps ...func(http.HandlerFunc) http.Handle
 //===========================================================================
 type proxyrunner struct {
 	httprunner
-	starttime   time.Time
-	smapversion int64
-	xactinp     *xactInProgress
-	syncmapinp  int64
-	statsdC     statsd.Client
-	authn       *authManager
-	startedUp   int64
-	metasyncer  *metasyncer
+	starttime    time.Time
+	smapversion  int64
+	xactinp      *xactInProgress
+	syncmapinp   int64
+	statsdC      statsd.Client
+	authn        *authManager
+	startedUp    int64
+	metasyncer   *metasyncer
+	loads        clusterLoads
+	egress       egressTracker
+	samples      sampleIndexes
+	prefetchJobs prefetchJobs
+	metacache    metaCache
+	summaries    summaryCache
 }
 
 // start proxy runner
@@ -100,6 +108,7 @@ func (p *proxyrunner) run() error {
 		}
 	}
 	p.bmdowner.put(bucketmd)
+	p.egress.load()
 
 	// A proxy starts as primary if either (or both):
 	// 1. The DFCPRIMARYPROXY environment variable is set to a non-empty-string value.
@@ -126,7 +135,7 @@ func (p *proxyrunner) run() error {
 		}
 
 		// register with the current primary
-		err = p.registerWithRetry(smap.ProxySI.DirectURL, 0)
+		err = p.registerWithRetry(smap.ProxySI.controlURL(), 0)
 		if err != nil {
 			return fmt.Errorf("Failed to register with the primary %s: %v", smap.ProxySI.DirectURL, err)
 		}
@@ -173,7 +182,11 @@ func (p *proxyrunner) run() error {
 	p.metasyncer = getmetasyncer() // utilize the runner
 	p.authn = &authManager{
 		tokens:        make(map[string]*authRec),
-		revokedTokens: make(map[string]bool),
+		revokedTokens: make(map[string]time.Time),
+		clock:         SystemClock{},
+	}
+	if ctx.config.Auth.Enabled && ctx.config.Auth.AuthnURL != "" {
+		go p.authn.pullRevokedList(ctx.config.Auth.AuthnURL)
 	}
 
 	// startup: register and sync across
@@ -205,6 +218,7 @@ func (p *proxyrunner) run() error {
 	p.httprunner.registerhdlr(URLPath(Rversion, Rhealth), p.httpHealth)
 	p.httprunner.registerhdlr(URLPath(Rversion, Rvote)+"/", p.voteHandler)
 	p.httprunner.registerhdlr(URLPath(Rversion, Rtokens), p.tokenHandler)
+	p.httprunner.registerhdlr(URLPath(Rversion, Rgossip), p.gossipHandler)
 
 	if ctx.config.Net.HTTP.UseAsProxy {
 		p.httprunner.registerhdlr("/", p.reverseProxyHandler)
@@ -236,7 +250,7 @@ func (p *proxyrunner) register(timeout time.Duration) (status int, err error) {
 
 	smap := p.smapowner.get()
 	if smap.ProxySI != nil {
-		url = smap.ProxySI.DirectURL
+		url = smap.ProxySI.controlURL()
 	} else {
 		// Smap has not yet been synced
 		url = ctx.config.Proxy.Primary.URL
@@ -365,7 +379,7 @@ func (p *proxyrunner) discoverMeta() {
 
 	glog.Infof("This proxy '%s' appears to be non-primary in the max-versioned Smap v%d", p.si.DaemonID, maxVerSmap.version())
 	glog.Infof("Registering with the true primary %s", maxVerSmap.ProxySI.DaemonID)
-	err = p.registerWithRetry(maxVerSmap.ProxySI.DirectURL, ctx.config.Timeout.Default)
+	err = p.registerWithRetry(maxVerSmap.ProxySI.controlURL(), ctx.config.Timeout.Default)
 	if err != nil {
 		glog.Errorf("Error registering with primary proxy %v: %v. Retrying.", maxVerSmap.ProxySI.DaemonID, err)
 	} else {
@@ -439,6 +453,8 @@ func (p *proxyrunner) objectHandler(w http.ResponseWriter, r *http.Request) {
 		p.httpobjpost(w, r)
 	case http.MethodHead:
 		p.httpobjhead(w, r)
+	case http.MethodPatch:
+		p.httpobjpatch(w, r)
 	default:
 		invalhdlr(w, r)
 	}
@@ -463,6 +479,29 @@ func (p *proxyrunner) httpbckget(w http.ResponseWriter, r *http.Request) {
 		p.getbucketnames(w, r, bucket)
 		return
 	}
+	switch r.URL.Query().Get(URLParamWhat) {
+	case GetWhatSamples:
+		p.httpsamples(w, r, bucket)
+		return
+	case GetWhatDigest:
+		p.httpdigest(w, r, bucket)
+		return
+	case GetWhatPinned:
+		p.httppinned(w, r, bucket)
+		return
+	case GetWhatWarmup:
+		p.httpwarmup(w, r, bucket)
+		return
+	case GetWhatDatasets:
+		p.httpdatasets(w, r, bucket)
+		return
+	case GetWhatDiff:
+		p.httpdiff(w, r, bucket)
+		return
+	case GetWhatSummary:
+		p.httpsummary(w, r, bucket)
+		return
+	}
 	s := fmt.Sprintf("Invalid route /buckets/%s", bucket)
 	p.invalmsghdlr(w, r, s)
 }
@@ -478,12 +517,22 @@ func (p *proxyrunner) httpobjget(w http.ResponseWriter, r *http.Request) {
 	if apitems = p.checkRestAPI(w, r, apitems, 2, Rversion, Robjects); apitems == nil {
 		return
 	}
-	bucket, objname := apitems[0], apitems[1]
+	bucket := apitems[0]
 	if !p.validatebckname(w, r, bucket) {
 		return
 	}
+	objname, ok := p.checkObjname(w, r)
+	if !ok {
+		return
+	}
+	objname = p.resolveLatest(r, bucket, objname)
 
-	si, errstr := HrwTarget(bucket, objname, p.smapowner.get())
+	pgroup := r.URL.Query().Get(URLParamPlacementGroup)
+	// cold GET puts the cached copy into the group
+	if pgroup != "" && !p.bmdowner.get().islocal(bucket) && !p.recordPlacementGroups(w, r, bucket) {
+		return
+	}
+	si, errstr := HrwTarget(bucket, hrwName(objname, pgroup), p.smapowner.get())
 	if errstr != "" {
 		p.invalmsghdlr(w, r, errstr)
 		return
@@ -491,9 +540,9 @@ func (p *proxyrunner) httpobjget(w http.ResponseWriter, r *http.Request) {
 	var redirecturl string
 	islocal := p.bmdowner.get().islocal(bucket)
 	if r.URL.RawQuery != "" {
-		redirecturl = fmt.Sprintf("%s%s?%s&%s=%t", si.DirectURL, r.URL.Path, r.URL.RawQuery, URLParamLocal, islocal)
+		redirecturl = fmt.Sprintf("%s%s?%s&%s=%t", si.DirectURL, r.URL.EscapedPath(), r.URL.RawQuery, URLParamLocal, islocal)
 	} else {
-		redirecturl = fmt.Sprintf("%s%s?%s=%t", si.DirectURL, r.URL.Path, URLParamLocal, islocal)
+		redirecturl = fmt.Sprintf("%s%s?%s=%t", si.DirectURL, r.URL.EscapedPath(), URLParamLocal, islocal)
 	}
 	if glog.V(4) {
 		glog.Infof("%s %s/%s => %s", r.Method, bucket, objname, si.DaemonID)
@@ -544,14 +593,29 @@ func (p *proxyrunner) httpobjput(w http.ResponseWriter, r *http.Request) {
 	//
 	// FIXME: add protection against putting into non-existing local bucket
 	//
-	objname := strings.Join(apitems[1:], "/")
-	si, errstr := HrwTarget(bucket, objname, p.smapowner.get())
+	if errstr := p.pendingDestroy(bucket); errstr != "" {
+		p.invalmsghdlr(w, r, errstr, http.StatusConflict)
+		return
+	}
+	objname, ok := p.checkObjname(w, r)
+	if !ok {
+		return
+	}
+	pgroup := r.URL.Query().Get(URLParamPlacementGroup)
+	if pgroup != "" && !p.recordPlacementGroups(w, r, bucket) {
+		return
+	}
+	si, errstr := HrwTarget(bucket, hrwName(objname, pgroup), p.smapowner.get())
 	if errstr != "" {
 		p.invalmsghdlr(w, r, errstr)
 		return
 	}
-	redirecturl := fmt.Sprintf("%s%s?%s=%t&%s=%s", si.DirectURL, r.URL.Path, URLParamLocal,
+	p.metacache.invalidate(bucket, objname)
+	redirecturl := fmt.Sprintf("%s%s?%s=%t&%s=%s", si.DirectURL, r.URL.EscapedPath(), URLParamLocal,
 		p.bmdowner.get().islocal(bucket), URLParamDaemonID, p.httprunner.si.DaemonID)
+	if pgroup != "" {
+		redirecturl += "&" + URLParamPlacementGroup + "=" + url.QueryEscape(pgroup)
+	}
 	if glog.V(4) {
 		glog.Infof("%s %s/%s => %s", r.Method, bucket, objname, si.DaemonID)
 	}
@@ -574,6 +638,50 @@ func (p *proxyrunner) httpobjput(w http.ResponseWriter, r *http.Request) {
 	p.statsif.addMany("numput", int64(1), "putlatency", int64(delta/1000))
 }
 
+// recordPlacementGroups records in the bucket metadata that the bucket has
+// objects in placement groups: only then targets look up the group of an object
+// requested without one (see redirectPlaced). Only the primary updates the
+// bucket metadata, so a non-primary proxy redirects the first request with
+// a group to the primary. Returns false if the request has been handled
+func (p *proxyrunner) recordPlacementGroups(w http.ResponseWriter, r *http.Request, bucket string) bool {
+	bucketmd := p.bmdowner.get()
+	islocal := bucketmd.islocal(bucket)
+	if _, props := bucketmd.get(bucket, islocal); props.PGroups {
+		return true
+	}
+	smap := p.smapowner.get()
+	if !smap.isPrimary(p.si) {
+		if smap.ProxySI == nil {
+			p.invalmsghdlr(w, r, "Primary proxy is unknown", http.StatusServiceUnavailable)
+			return false
+		}
+		http.Redirect(w, r, smap.ProxySI.DirectURL+r.URL.RequestURI(), http.StatusTemporaryRedirect)
+		return false
+	}
+
+	p.bmdowner.Lock()
+	clone := p.bmdowner.get().clone()
+	exists, props := clone.get(bucket, islocal)
+	if props.PGroups {
+		p.bmdowner.Unlock()
+		return true
+	}
+	if !exists {
+		assert(!islocal)
+		clone.add(bucket, false, BucketProps{})
+	}
+	props.PGroups = true
+	clone.set(bucket, islocal, props)
+	if errstr := p.savebmdconf(clone); errstr != "" {
+		glog.Errorln(errstr)
+	}
+	p.bmdowner.put(clone)
+	p.bmdowner.Unlock()
+	glog.Infof("Bucket %s has objects in placement groups", bucket)
+	p.metasyncer.sync(true, clone)
+	return true
+}
+
 // DELETE { action } /Rversion/Rbuckets
 func (p *proxyrunner) httpbckdelete(w http.ResponseWriter, r *http.Request) {
 	var msg ActionMsg
@@ -585,31 +693,24 @@ func (p *proxyrunner) httpbckdelete(w http.ResponseWriter, r *http.Request) {
 	if err := p.readJSON(w, r, &msg); err != nil {
 		return
 	}
+	p.metacache.invalidateBucket(bucket)
 	switch msg.Action {
 	case ActDestroyLB:
-		bucketmd := p.bmdowner.get()
-		if !bucketmd.islocal(bucket) {
-			p.invalmsghdlr(w, r, fmt.Sprintf("Bucket %s does not appear to be local", bucket))
-			return
-		}
-		p.bmdowner.Lock()
-		clone := bucketmd.clone()
-		if !clone.del(bucket, true) {
-			p.bmdowner.Unlock()
-			s := fmt.Sprintf("Local bucket %s "+doesnotexist, bucket)
-			p.invalmsghdlr(w, r, s)
+		marked, errstr, status := p.requestDestroy(bucket, &msg)
+		if errstr != "" {
+			p.invalmsghdlr(w, r, errstr, status)
 			return
 		}
-		if errstr := p.savebmdconf(clone); errstr != "" {
-			p.bmdowner.Unlock()
-			p.invalmsghdlr(w, r, errstr)
-			return
+		if marked {
+			w.WriteHeader(http.StatusAccepted)
 		}
-		p.bmdowner.put(clone)
-		p.bmdowner.Unlock()
-		pair := &revspair{clone, &msg}
-		p.metasyncer.sync(true, pair)
 	case ActDelete, ActEvict:
+		if msg.Action == ActDelete {
+			if errstr := p.wormRetained(bucket); errstr != "" {
+				p.wormRefuse(w, r, errstr)
+				return
+			}
+		}
 		p.actionlistrange(w, r, &msg)
 	default:
 		p.invalmsghdlr(w, r, fmt.Sprintf("Unsupported Action: %s", msg.Action))
@@ -623,13 +724,22 @@ func (p *proxyrunner) httpobjdelete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	bucket := apitems[0]
-	objname := strings.Join(apitems[1:], "/")
-	si, errstr := HrwTarget(bucket, objname, p.smapowner.get())
+	objname, ok := p.checkObjname(w, r)
+	if !ok {
+		return
+	}
+	if errstr := p.wormRetained(bucket); errstr != "" {
+		p.wormRefuse(w, r, errstr)
+		return
+	}
+	pgroup := r.URL.Query().Get(URLParamPlacementGroup)
+	si, errstr := HrwTarget(bucket, hrwName(objname, pgroup), p.smapowner.get())
 	if errstr != "" {
 		p.invalmsghdlr(w, r, errstr)
 		return
 	}
-	redirecturl := si.DirectURL + r.URL.Path
+	p.metacache.invalidate(bucket, objname)
+	redirecturl := si.DirectURL + r.URL.EscapedPath()
 	if glog.V(4) {
 		glog.Infof("%s %s/%s => %s", r.Method, bucket, objname, si.DaemonID)
 	}
@@ -654,6 +764,50 @@ func (p *proxyrunner) httpHealth(w http.ResponseWriter, r *http.Request) {
 	p.writeJSON(w, r, jsbytes, "targetcorestats")
 }
 
+// createLocalBucket adds the local bucket to the bucket-metadata and
+// synchronizes the latter with the cluster (primary proxy only)
+func (p *proxyrunner) createLocalBucket(bucket string, msg *ActionMsg) (errstr string) {
+	p.bmdowner.Lock()
+	clone := p.bmdowner.get().clone()
+	if !clone.add(bucket, true, BucketProps{}) {
+		p.bmdowner.Unlock()
+		return fmt.Sprintf("Local bucket %s already exists", bucket)
+	}
+	if errstr = p.savebmdconf(clone); errstr != "" {
+		p.bmdowner.Unlock()
+		return
+	}
+	p.bmdowner.put(clone)
+	p.bmdowner.Unlock()
+	pair := &revspair{clone, msg}
+	p.metasyncer.sync(true, pair)
+	return
+}
+
+// destroyLocalBucket removes the local bucket from the bucket-metadata and
+// synchronizes the latter with the cluster
+func (p *proxyrunner) destroyLocalBucket(bucket string, msg *ActionMsg) (errstr string) {
+	bucketmd := p.bmdowner.get()
+	if !bucketmd.islocal(bucket) {
+		return fmt.Sprintf("Bucket %s does not appear to be local", bucket)
+	}
+	p.bmdowner.Lock()
+	clone := bucketmd.clone()
+	if !clone.del(bucket, true) {
+		p.bmdowner.Unlock()
+		return fmt.Sprintf("Local bucket %s "+doesnotexist, bucket)
+	}
+	if errstr = p.savebmdconf(clone); errstr != "" {
+		p.bmdowner.Unlock()
+		return
+	}
+	p.bmdowner.put(clone)
+	p.bmdowner.Unlock()
+	pair := &revspair{clone, msg}
+	p.metasyncer.sync(true, pair)
+	return
+}
+
 // POST { action } /v1/buckets/bucket-name
 func (p *proxyrunner) httpbckpost(w http.ResponseWriter, r *http.Request) {
 	started := time.Now()
@@ -670,26 +824,27 @@ func (p *proxyrunner) httpbckpost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	switch msg.Action {
-	case ActCreateLB:
-		if !p.checkPrimaryProxy("create local bucket", w, r) {
+	case ActListObjects, ActLocate, ActGetBatch, ActHeadObjects:
+	default:
+		p.metacache.clear() // the action may change objects of this and other buckets
+	}
+	switch msg.Action {
+	case ActUndestroyLB:
+		if !p.checkPrimaryProxy("undestroy local bucket", w, r) {
 			return
 		}
-		p.bmdowner.Lock()
-		clone := p.bmdowner.get().clone()
-		if !clone.add(lbucket, true, BucketProps{}) {
-			p.bmdowner.Unlock()
-			p.invalmsghdlr(w, r, fmt.Sprintf("Local bucket %s already exists", lbucket))
+		if errstr := p.undestroy(lbucket, &msg); errstr != "" {
+			p.invalmsghdlr(w, r, errstr)
+			return
+		}
+	case ActCreateLB:
+		if !p.checkPrimaryProxy("create local bucket", w, r) {
 			return
 		}
-		if errstr := p.savebmdconf(clone); errstr != "" {
-			p.bmdowner.Unlock()
+		if errstr := p.createLocalBucket(lbucket, &msg); errstr != "" {
 			p.invalmsghdlr(w, r, errstr)
 			return
 		}
-		p.bmdowner.put(clone)
-		p.bmdowner.Unlock()
-		pair := &revspair{clone, &msg}
-		p.metasyncer.sync(true, pair)
 	case ActRenameLB:
 		if !p.checkPrimaryProxy("rename local bucket", w, r) {
 			return
@@ -708,6 +863,10 @@ func (p *proxyrunner) httpbckpost(w http.ResponseWriter, r *http.Request) {
 			p.invalmsghdlr(w, r, s)
 			return
 		}
+		if props.WORM {
+			p.wormRefuse(w, r, fmt.Sprintf("Local bucket %s is write-once (WORM)", bucketFrom))
+			return
+		}
 		ok, _ = clone.get(bucketTo, true)
 		if ok {
 			s := fmt.Sprintf("Local bucket %s already exists", bucketTo)
@@ -725,9 +884,53 @@ func (p *proxyrunner) httpbckpost(w http.ResponseWriter, r *http.Request) {
 		}
 		p.metasyncer.sync(false, p.bmdowner.get())
 	case ActPrefetch:
-		p.actionlistrange(w, r, &msg)
+		if ctx.config.Egress.Refuse {
+			if errstr := p.egressExhausted(lbucket); errstr != "" {
+				p.invalmsghdlr(w, r, errstr, http.StatusForbidden)
+				return
+			}
+		}
+		p.prefetch(w, r, lbucket, &msg)
 	case ActListObjects:
 		p.listBucketAndCollectStats(w, r, lbucket, msg, started)
+	case ActLocate:
+		p.locateObjects(w, r, lbucket, &msg)
+	case ActHeadObjects:
+		p.headObjects(w, r, lbucket, &msg)
+	case ActImport:
+		p.importBucket(w, r, lbucket, &msg)
+	case ActExport:
+		p.exportBucket(w, r, lbucket, &msg)
+	case ActConvert:
+		p.convertBucket(w, r, lbucket, &msg)
+	case ActBackup, ActRestoreBak, ActBackupStop:
+		p.backupBucket(w, r, lbucket, &msg)
+	case ActGetBatch:
+		p.getBatch(w, r, lbucket, &msg)
+	case ActPrefetchJob:
+		p.startPrefetchJob(w, r, lbucket, &msg)
+	case ActJobPosition, ActJobStop:
+		p.prefetchJobAction(w, r, lbucket, &msg)
+	case ActPin, ActUnpin:
+		if !p.checkPrimaryProxy("pin objects", w, r) {
+			return
+		}
+		p.pinprefix(w, r, lbucket, &msg)
+	case ActWarmup:
+		if !p.checkPrimaryProxy("register warm-up manifests", w, r) {
+			return
+		}
+		p.warmupManifest(w, r, lbucket, &msg)
+	case ActPublish:
+		if !p.checkPrimaryProxy("publish datasets", w, r) {
+			return
+		}
+		p.publishDataset(w, r, lbucket, &msg)
+	case ActRollback:
+		if !p.checkPrimaryProxy("roll back datasets", w, r) {
+			return
+		}
+		p.rollbackDataset(w, r, lbucket, &msg)
 	default:
 		s := fmt.Sprintf("Unexpected ActionMsg <- JSON [%v]", msg)
 		p.invalmsghdlr(w, r, s)
@@ -779,10 +982,17 @@ func (p *proxyrunner) httpobjpost(w http.ResponseWriter, r *http.Request) {
 	if p.readJSON(w, r, &msg) != nil {
 		return
 	}
+	p.metacache.invalidateBucket(lbucket)
 	switch msg.Action {
 	case ActRename:
 		p.filrename(w, r, &msg)
 		return
+	case ActRestore:
+		p.objrestore(w, r)
+		return
+	case ActPin, ActUnpin:
+		p.objpin(w, r)
+		return
 	default:
 		s := fmt.Sprintf("Unexpected ActionMsg <- JSON [%v]", msg)
 		p.invalmsghdlr(w, r, s)
@@ -806,10 +1016,14 @@ func (p *proxyrunner) httpbckhead(w http.ResponseWriter, r *http.Request) {
 	for _, si = range smap.Tmap {
 		break
 	}
-	redirecturl := fmt.Sprintf("%s%s?%s=%t", si.DirectURL, r.URL.Path, URLParamLocal, p.bmdowner.get().islocal(bucket))
+	redirecturl := fmt.Sprintf("%s%s?%s=%t", si.DirectURL, r.URL.EscapedPath(), URLParamLocal, p.bmdowner.get().islocal(bucket))
 	if glog.V(3) {
 		glog.Infof("%s %s => %s", r.Method, bucket, si.DaemonID)
 	}
+	if ctx.config.MetaCache.TTL > 0 {
+		p.serveCached(w, r, bucket, func(w http.ResponseWriter) { p.headTarget(w, r, redirecturl) })
+		return
+	}
 	http.Redirect(w, r, redirecturl, http.StatusTemporaryRedirect)
 }
 
@@ -842,6 +1056,11 @@ func (p *proxyrunner) httpbckput(w http.ResponseWriter, r *http.Request) {
 		p.invalmsghdlr(w, r, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if n := p.smapowner.get().countTargets(); props.ECData > 0 && n < props.ECData+props.ECParity+1 {
+		p.invalmsghdlr(w, r, fmt.Sprintf("Erasure coding with %d data and %d parity slices requires at least %d targets, the cluster has %d",
+			props.ECData, props.ECParity, props.ECData+props.ECParity+1, n))
+		return
+	}
 
 	p.bmdowner.Lock()
 	clone := bucketmd.clone()
@@ -850,8 +1069,36 @@ func (p *proxyrunner) httpbckput(w http.ResponseWriter, r *http.Request) {
 		assert(!isLocal)
 		clone.add(bucket, false, BucketProps{})
 	}
+	if err := validateWORM(&oldProps, props); err != nil {
+		p.bmdowner.Unlock()
+		p.wormRefuse(w, r, err.Error())
+		return
+	}
+	if props.WORM != oldProps.WORM || props.Retention != oldProps.Retention {
+		glog.Infof("WORM: bucket %s: write-once %t, retention %q (was %t, %q), from %s",
+			bucket, props.WORM, props.Retention, oldProps.WORM, oldProps.Retention, r.RemoteAddr)
+	}
 	oldProps.NextTierURL = props.NextTierURL
 	oldProps.CloudProvider = props.CloudProvider
+	oldProps.Encrypt = props.Encrypt
+	oldProps.CloudSSE = props.CloudSSE
+	oldProps.CloudSSEKeyID = props.CloudSSEKeyID
+	oldProps.RequesterPays = props.RequesterPays
+	oldProps.StorageClass = props.StorageClass
+	oldProps.Fsync = props.Fsync
+	oldProps.MpathLabel = props.MpathLabel
+	oldProps.IngressLimit = props.IngressLimit
+	oldProps.EgressLimit = props.EgressLimit
+	oldProps.EgressBudget = props.EgressBudget
+	oldProps.Protected = props.Protected
+	oldProps.ServeStale = props.ServeStale
+	oldProps.MaxStale = props.MaxStale
+	oldProps.WORM = props.WORM
+	oldProps.Retention = props.Retention
+	oldProps.ECData = props.ECData
+	oldProps.ECParity = props.ECParity
+	oldProps.ECMinSize = props.ECMinSize
+	oldProps.Copies = props.Copies
 	if props.ReadPolicy != "" {
 		oldProps.ReadPolicy = props.ReadPolicy
 	}
@@ -875,22 +1122,33 @@ func (p *proxyrunner) httpobjhead(w http.ResponseWriter, r *http.Request) {
 	if apitems = p.checkRestAPI(w, r, apitems, 2, Rversion, Robjects); apitems == nil {
 		return
 	}
-	bucket, objname := apitems[0], apitems[1]
+	bucket := apitems[0]
 	if !p.validatebckname(w, r, bucket) {
 		return
 	}
+	objname, ok := p.checkObjname(w, r)
+	if !ok {
+		return
+	}
+	objname = p.resolveLatest(r, bucket, objname)
 	var si *daemonInfo
-	si, errstr := HrwTarget(bucket, objname, p.smapowner.get())
+	pgroup := r.URL.Query().Get(URLParamPlacementGroup)
+	si, errstr := HrwTarget(bucket, hrwName(objname, pgroup), p.smapowner.get())
 	if errstr != "" {
 		return
 	}
-	redirecturl := fmt.Sprintf("%s%s?%s=%t", si.DirectURL, r.URL.Path, URLParamLocal, p.bmdowner.get().islocal(bucket))
+	redirecturl := fmt.Sprintf("%s%s?%s=%t", si.DirectURL, r.URL.EscapedPath(), URLParamLocal, p.bmdowner.get().islocal(bucket))
 	if checkCached {
 		redirecturl += fmt.Sprintf("&%s=true", URLParamCheckCached)
 	}
 	if glog.V(3) {
 		glog.Infof("%s %s/%s => %s", r.Method, bucket, objname, si.DaemonID)
 	}
+	if ctx.config.MetaCache.TTL > 0 {
+		p.serveCached(w, r, bucket+"/"+objname,
+			func(w http.ResponseWriter) { p.headTarget(w, r, redirecturl) })
+		return
+	}
 	http.Redirect(w, r, redirecturl, http.StatusTemporaryRedirect)
 }
 
@@ -958,7 +1216,7 @@ func (p *proxyrunner) getbucketnames(w http.ResponseWriter, r *http.Request, buc
 		break
 	}
 
-	u := si.DirectURL + URLPath(Rversion, Rbuckets, bucketspec)
+	u := si.controlURL() + URLPath(Rversion, Rbuckets, bucketspec)
 	res := p.call(r, si, u, r.Method, nil)
 	if res.err != nil {
 		p.invalmsghdlr(w, r, res.errstr)
@@ -971,7 +1229,7 @@ func (p *proxyrunner) getbucketnames(w http.ResponseWriter, r *http.Request, buc
 // For cached = false goes to the Cloud, otherwise returns locally cached files
 func (p *proxyrunner) targetListBucket(r *http.Request, bucket string, dinfo *daemonInfo,
 	getMsg *GetMsg, islocal bool, cached bool) (*bucketResp, error) {
-	url := fmt.Sprintf("%s/%s/%s/%s?%s=%v&%s=%v", dinfo.DirectURL, Rversion,
+	url := fmt.Sprintf("%s/%s/%s/%s?%s=%v&%s=%v", dinfo.controlURL(), Rversion,
 		Rbuckets, bucket, URLParamLocal, islocal, URLParamCached, cached)
 
 	actionMsgBytes, err := json.Marshal(ActionMsg{Action: ActListObjects, Value: getMsg})
@@ -1134,15 +1392,15 @@ func (p *proxyrunner) collectCachedFileList(bucket string, fileList *BucketList,
 	return
 }
 
-func (p *proxyrunner) getLocalBucketObjects(bucket string, listmsgjson []byte) (allentries *BucketList, err error) {
+// Reads object lists from all targets and merges them into a page of up to
+// pageSize objects (see mergeBucketLists). Used for local buckets and to list only the objects of
+// a cloud bucket that are cached in the cluster
+func (p *proxyrunner) getTargetsBucketObjects(bucket string, listmsgjson []byte, islocal bool) (allentries *BucketList, err error) {
 	type targetReply struct {
 		resp *bucketResp
 		err  error
 	}
-	const (
-		islocal    = true
-		cachedObjs = false
-	)
+	cachedObjs := !islocal
 	msg := &GetMsg{}
 	if err = json.Unmarshal(listmsgjson, msg); err != nil {
 		return
@@ -1153,7 +1411,7 @@ func (p *proxyrunner) getLocalBucketObjects(bucket string, listmsgjson []byte) (
 	}
 
 	if pageSize > MaxPageSize {
-		glog.Warningf("Page size(%d) for local bucket %s exceeds the limit(%d)", msg.GetPageSize, bucket, MaxPageSize)
+		glog.Warningf("Page size(%d) for bucket %s exceeds the limit(%d)", msg.GetPageSize, bucket, MaxPageSize)
 	}
 
 	smap := p.smapowner.get()
@@ -1175,8 +1433,8 @@ func (p *proxyrunner) getLocalBucketObjects(bucket string, listmsgjson []byte) (
 	wg.Wait()
 	close(chresult)
 
-	// combine results
-	allentries = &BucketList{Entries: make([]*BucketEntry, 0, pageSize)}
+	// merge the sorted pages of the targets
+	lists := make([]*BucketList, 0, len(smap.Tmap))
 	for r := range chresult {
 		if r.err != nil {
 			err = r.err
@@ -1191,32 +1449,10 @@ func (p *proxyrunner) getLocalBucketObjects(bucket string, listmsgjson []byte) (
 		if err = json.Unmarshal(r.resp.outjson, &bucketList); err != nil {
 			return
 		}
-
-		if len(bucketList.Entries) == 0 {
-			continue
-		}
-
-		allentries.Entries = append(allentries.Entries, bucketList.Entries...)
-	}
-
-	// return the list always sorted in alphabetical order
-	entryLess := func(i, j int) bool {
-		return allentries.Entries[i].Name < allentries.Entries[j].Name
-	}
-	sort.Slice(allentries.Entries, entryLess)
-
-	// shrink the result to `pageSize` entries. If the page is full than
-	// mark the result incomplete by setting PageMarker
-	if len(allentries.Entries) >= pageSize {
-		for i := pageSize; i < len(allentries.Entries); i++ {
-			allentries.Entries[i] = nil
-		}
-
-		allentries.Entries = allentries.Entries[:pageSize]
-		allentries.PageMarker = allentries.Entries[pageSize-1].Name
+		lists = append(lists, bucketList)
 	}
 
-	return allentries, nil
+	return mergeBucketLists(lists, pageSize), nil
 }
 
 func (p *proxyrunner) getCloudBucketObjects(r *http.Request, bucket string, listmsgjson []byte) (allentries *BucketList, err error) {
@@ -1254,14 +1490,21 @@ func (p *proxyrunner) getCloudBucketObjects(r *http.Request, bucket string, list
 	if len(allentries.Entries) == 0 {
 		return
 	}
-	if strings.Contains(msg.GetProps, GetTargetURL) {
+	needURL, needID := strings.Contains(msg.GetProps, GetTargetURL), strings.Contains(msg.GetProps, GetPropsTargetID)
+	if needURL || needID {
+		smap := p.smapowner.get()
 		for _, e := range allentries.Entries {
-			si, errStr := HrwTarget(bucket, e.Name, p.smapowner.get())
+			si, errStr := HrwTarget(bucket, e.Name, smap)
 			if errStr != "" {
 				err = errors.New(errStr)
 				return
 			}
-			e.TargetURL = si.DirectURL
+			if needURL {
+				e.TargetURL = si.DirectURL
+			}
+			if needID {
+				e.TargetID = si.DaemonID
+			}
 		}
 	}
 	if strings.Contains(msg.GetProps, GetPropsAtime) ||
@@ -1273,7 +1516,7 @@ func (p *proxyrunner) getCloudBucketObjects(r *http.Request, bucket string, list
 	return
 }
 
-// Local bucket:
+// Local bucket or cloud bucket with cachedonly=true:
 //   - reads object list from all targets, combines, sorts and returns the
 //     first pageSize objects
 // Cloud bucket:
@@ -1291,8 +1534,19 @@ func (p *proxyrunner) listbucket(w http.ResponseWriter, r *http.Request, bucket
 		return
 	}
 
-	if p.bmdowner.get().islocal(bucket) {
-		allentries, err = p.getLocalBucketObjects(bucket, listmsgjson)
+	cachedOnly, err := parsebool(r.URL.Query().Get(URLParamCached))
+	if err != nil {
+		s := fmt.Sprintf("Invalid URL query parameter: %s=%s (expecting: '' | true | false)",
+			URLParamCached, r.URL.Query().Get(URLParamCached))
+		p.invalmsghdlr(w, r, s)
+		return
+	}
+	if listmsgjson, err = normalizeListPrefix(listmsgjson); err != nil {
+		p.invalmsghdlr(w, r, err.Error())
+		return
+	}
+	if islocal := p.bmdowner.get().islocal(bucket); islocal || cachedOnly {
+		allentries, err = p.getTargetsBucketObjects(bucket, listmsgjson, islocal)
 	} else {
 		allentries, err = p.getCloudBucketObjects(r, bucket, listmsgjson)
 	}
@@ -1343,19 +1597,31 @@ func (p *proxyrunner) filrename(w http.ResponseWriter, r *http.Request, msg *Act
 	if apitems = p.checkRestAPI(w, r, apitems, 2, Rversion, Robjects); apitems == nil {
 		return
 	}
-	lbucket, objname := apitems[0], strings.Join(apitems[1:], "/")
+	lbucket := apitems[0]
+	objname, ok := p.checkObjname(w, r)
+	if !ok {
+		return
+	}
 	if !p.bmdowner.get().islocal(lbucket) {
 		s := fmt.Sprintf("Rename/move is supported only for cache-only buckets (%s does not appear to be local)", lbucket)
 		p.invalmsghdlr(w, r, s)
 		return
 	}
+	if !p.checkRename(w, r, msg.Name) {
+		return
+	}
+	if errstr := p.wormRetained(lbucket); errstr != "" {
+		p.wormRefuse(w, r, errstr)
+		return
+	}
 
-	si, errstr := HrwTarget(lbucket, objname, p.smapowner.get())
+	pgroup := r.URL.Query().Get(URLParamPlacementGroup)
+	si, errstr := HrwTarget(lbucket, hrwName(objname, pgroup), p.smapowner.get())
 	if errstr != "" {
 		p.invalmsghdlr(w, r, errstr)
 		return
 	}
-	redirecturl := si.DirectURL + r.URL.Path
+	redirecturl := si.DirectURL + r.URL.EscapedPath()
 	if glog.V(3) {
 		glog.Infof("RENAME %s %s/%s => %s", r.Method, lbucket, objname, si.DaemonID)
 	}
@@ -1376,6 +1642,35 @@ func (p *proxyrunner) filrename(w http.ResponseWriter, r *http.Request, msg *Act
 	http.Redirect(w, r, redirecturl, http.StatusTemporaryRedirect)
 }
 
+// Redirects a request to restore an archived object of a cloud bucket.
+// Restoring is done by the cloud, so any target can handle the request: HRW
+// target is chosen to keep requests for the same object on the same target
+func (p *proxyrunner) objrestore(w http.ResponseWriter, r *http.Request) {
+	apitems := p.restAPIItems(r.URL.Path, 5)
+	if apitems = p.checkRestAPI(w, r, apitems, 2, Rversion, Robjects); apitems == nil {
+		return
+	}
+	bucket := apitems[0]
+	objname, ok := p.checkObjname(w, r)
+	if !ok {
+		return
+	}
+	if p.bmdowner.get().islocal(bucket) {
+		s := fmt.Sprintf("Restore is supported only for cloud buckets (%s is local)", bucket)
+		p.invalmsghdlr(w, r, s)
+		return
+	}
+	si, errstr := HrwTarget(bucket, objname, p.smapowner.get())
+	if errstr != "" {
+		p.invalmsghdlr(w, r, errstr)
+		return
+	}
+	if glog.V(3) {
+		glog.Infof("RESTORE %s %s/%s => %s", r.Method, bucket, objname, si.DaemonID)
+	}
+	http.Redirect(w, r, si.DirectURL+r.URL.EscapedPath(), http.StatusTemporaryRedirect)
+}
+
 func (p *proxyrunner) actionlistrange(w http.ResponseWriter, r *http.Request, actionMsg *ActionMsg) {
 	var (
 		err    error
@@ -1389,17 +1684,23 @@ func (p *proxyrunner) actionlistrange(w http.ResponseWriter, r *http.Request, ac
 	bucket := apitems[0]
 	islocal := p.bmdowner.get().islocal(bucket)
 	wait := false
-	if jsmap, ok := actionMsg.Value.(map[string]interface{}); !ok {
+	jsmap, ok := actionMsg.Value.(map[string]interface{})
+	if !ok {
 		s := fmt.Sprintf("Failed to unmarshal JSMAP: Not a map[string]interface")
 		p.invalmsghdlr(w, r, s)
 		return
-	} else if waitstr, ok := jsmap["wait"]; ok {
+	}
+	if waitstr, ok := jsmap["wait"]; ok {
 		if wait, ok = waitstr.(bool); !ok {
 			s := fmt.Sprintf("Failed to read ListRangeMsgBase Wait: Not a bool")
 			p.invalmsghdlr(w, r, s)
 			return
 		}
 	}
+	if err = normalizeListRange(jsmap); err != nil {
+		p.invalmsghdlr(w, r, err.Error())
+		return
+	}
 	// Send json message to all
 	jsonbytes, err := json.Marshal(actionMsg)
 	assert(err == nil, err)
@@ -1459,6 +1760,92 @@ func (p *proxyrunner) actionlistrange(w http.ResponseWriter, r *http.Request, ac
 	}
 }
 
+// For every object in the list returns its owning target and whether the
+// object is cached. Objects are grouped by target, and each target is asked
+// only about the objects it owns
+func (p *proxyrunner) locateObjects(w http.ResponseWriter, r *http.Request, bucket string, actionMsg *ActionMsg) {
+	jsmap, ok := actionMsg.Value.(map[string]interface{})
+	if !ok {
+		p.invalmsghdlr(w, r, fmt.Sprintf("Unexpected Value format %+v, %T", actionMsg.Value, actionMsg.Value))
+		return
+	}
+	listMsg, errstr := parseListMsg(jsmap)
+	if errstr != "" {
+		p.invalmsghdlr(w, r, errstr)
+		return
+	}
+	if err := normalizeObjnames(listMsg.Objnames); err != nil {
+		p.invalmsghdlr(w, r, err.Error())
+		return
+	}
+
+	var (
+		smap      = p.smapowner.get()
+		pgroup    = r.URL.Query().Get(URLParamPlacementGroup)
+		result    = &LocateResult{Objects: make([]*ObjectLocation, 0, len(listMsg.Objnames))}
+		pertarget = make(map[string][]string)
+		located   = make(map[string]*ObjectLocation, len(listMsg.Objnames))
+	)
+	for _, objname := range listMsg.Objnames {
+		if loc, ok := located[objname]; ok {
+			result.Objects = append(result.Objects, loc)
+			continue
+		}
+		si, errstr := HrwTarget(bucket, hrwName(objname, pgroup), smap)
+		if errstr != "" {
+			p.invalmsghdlr(w, r, errstr)
+			return
+		}
+		loc := &ObjectLocation{Name: objname, TargetID: si.DaemonID, TargetURL: si.DirectURL}
+		located[objname] = loc
+		result.Objects = append(result.Objects, loc)
+		pertarget[si.DaemonID] = append(pertarget[si.DaemonID], objname)
+	}
+
+	var (
+		q       = url.Values{}
+		wg      = &sync.WaitGroup{}
+		results = make(chan callResult, len(pertarget))
+	)
+	q.Set(URLParamLocal, strconv.FormatBool(p.bmdowner.get().islocal(bucket)))
+	for tid, objnames := range pertarget {
+		msg := ActionMsg{Action: ActLocate, Value: ListMsg{Objnames: objnames}}
+		injson, err := json.Marshal(msg)
+		assert(err == nil, err)
+		wg.Add(1)
+		go func(si *daemonInfo, injson []byte) {
+			reqURL := si.controlURL() + URLPath(Rversion, Rbuckets, bucket) + "?" + q.Encode()
+			results <- p.call(r, si, reqURL, http.MethodPost, injson, ctx.config.Timeout.Default)
+			wg.Done()
+		}(smap.Tmap[tid], injson)
+	}
+	wg.Wait()
+	close(results)
+
+	for res := range results {
+		if res.err != nil {
+			p.invalmsghdlr(w, r, fmt.Sprintf("Failed to locate objects at %s: %v (%d: %s)",
+				res.si.DaemonID, res.err, res.status, res.errstr))
+			return
+		}
+		cached := &LocateResult{}
+		if err := json.Unmarshal(res.outjson, cached); err != nil {
+			p.invalmsghdlr(w, r, fmt.Sprintf("Failed to unmarshal locate response from %s, err: %v",
+				res.si.DaemonID, err))
+			return
+		}
+		for _, loc := range cached.Objects {
+			if l, ok := located[loc.Name]; ok {
+				l.IsCached = loc.IsCached
+			}
+		}
+	}
+
+	jsbytes, err := json.Marshal(result)
+	assert(err == nil, err)
+	p.writeJSON(w, r, jsbytes, "locateobjects")
+}
+
 //===========================
 //
 // control plane
@@ -1501,6 +1888,14 @@ func (p *proxyrunner) httpdaeget(w http.ResponseWriter, r *http.Request) {
 		jsbytes, err := json.Marshal(msg)
 		assert(err == nil, err)
 		p.writeJSON(w, r, jsbytes, "httpdaeget")
+	case GetWhatDaemonID:
+		jsbytes, err := json.Marshal(p.daemonIDInfo())
+		assert(err == nil, err)
+		p.writeJSON(w, r, jsbytes, "httpdaeget")
+	case GetWhatConnPool:
+		jsbytes, err := json.Marshal(p.connPoolStats())
+		assert(err == nil, err)
+		p.writeJSON(w, r, jsbytes, "httpdaeget")
 	default:
 		s := fmt.Sprintf("Unexpected GET request, invalid param 'what': [%s]", getWhat)
 		p.invalmsghdlr(w, r, s)
@@ -1563,7 +1958,7 @@ func (p *proxyrunner) httpdaeput(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		switch msg.Name {
-		case "loglevel", "stats_time", "passthru", "vmodule":
+		case "loglevel", "stats_time", "stats_history", "passthru", "vmodule":
 			if errstr := p.setconfig(msg.Name, value); errstr != "" {
 				p.invalmsghdlr(w, r, errstr)
 			}
@@ -1579,6 +1974,16 @@ func (p *proxyrunner) httpdaeput(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		_ = syscall.Kill(syscall.Getpid(), syscall.SIGINT)
+	case ActInjectFault, ActClearFaults:
+		p.httpfaults(w, r, &msg)
+	case ActResetStats:
+		p.statsif.reset()
+	case ActRotateID:
+		if p.smapowner.get().isPrimary(p.si) {
+			p.invalmsghdlr(w, r, "Cannot rotate the ID of the primary proxy")
+			return
+		}
+		p.rotateDaemonID(w, r, &msg)
 	default:
 		s := fmt.Sprintf("Unexpected ActionMsg <- JSON [%v]", msg)
 		p.invalmsghdlr(w, r, s)
@@ -1644,6 +2049,12 @@ func (p *proxyrunner) httpdaesetprimaryproxy(w http.ResponseWriter, r *http.Requ
 }
 
 func (p *proxyrunner) becomeNewPrimary(proxyidToRemove string) (errstr string) {
+	epoch := p.smapowner.get().Epoch + 1
+	if ctx.config.Proxy.Fencing {
+		if errstr = p.claimEpoch(p.smapowner.get(), epoch); errstr != "" {
+			return
+		}
+	}
 	p.smapowner.Lock()
 	smap := p.smapowner.get()
 	if !smap.isPresent(p.si, true) {
@@ -1656,6 +2067,7 @@ func (p *proxyrunner) becomeNewPrimary(proxyidToRemove string) (errstr string) {
 	}
 	clone.ProxySI = p.si
 	clone.Version += 100
+	clone.Epoch = epoch
 	if errstr = p.smapowner.persist(clone, true); errstr != "" {
 		p.smapowner.Unlock()
 		glog.Errorln(errstr)
@@ -1766,6 +2178,8 @@ func (p *proxyrunner) tokenHandler(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodDelete:
 		p.httpTokenDelete(w, r)
+	case http.MethodGet:
+		p.httpTokenGet(w, r)
 	default:
 		invalhdlr(w, r)
 	}
@@ -1793,22 +2207,63 @@ func (p *proxyrunner) reverseProxyHandler(w http.ResponseWriter, r *http.Request
 func (p *proxyrunner) httpcluget(w http.ResponseWriter, r *http.Request) {
 	getWhat := r.URL.Query().Get(URLParamWhat)
 	switch getWhat {
-	case GetWhatStats:
-		ok := p.invokeHttpGetClusterStats(w, r)
-		if !ok {
+	case GetWhatStats, GetWhatXaction:
+		if ctx.config.MetaCache.TTL > 0 {
+			p.serveCached(w, r, metaClusterResource, func(w http.ResponseWriter) { p.clusterStats(w, r, getWhat) })
 			return
 		}
-	case GetWhatXaction:
-		ok := p.invokeHttpGetXaction(w, r)
-		if !ok {
+		p.clusterStats(w, r, getWhat)
+	case GetWhatLoad:
+		if !p.checkPrimaryProxy("get cluster load", w, r) {
 			return
 		}
+		jsbytes, err := json.Marshal(p.clusterLoad())
+		assert(err == nil, err)
+		p.writeJSON(w, r, jsbytes, "httpcluget")
+	case GetWhatEgress:
+		if !p.checkPrimaryProxy("get cloud egress", w, r) {
+			return
+		}
+		jsbytes, err := json.Marshal(p.egressReport())
+		assert(err == nil, err)
+		p.writeJSON(w, r, jsbytes, "httpcluget")
+	case GetWhatJobs:
+		jsbytes, err := json.Marshal(p.prefetchJobsInfo())
+		assert(err == nil, err)
+		p.writeJSON(w, r, jsbytes, "httpcluget")
+	case GetWhatBckStats:
+		report, errstr := p.bucketStats(r.URL.Query().Get(URLParamBucket))
+		if errstr != "" {
+			p.invalmsghdlr(w, r, errstr)
+			return
+		}
+		jsbytes, err := json.Marshal(report)
+		assert(err == nil, err)
+		p.writeJSON(w, r, jsbytes, "httpcluget")
+	case GetWhatImport, GetWhatExport, GetWhatConvert, GetWhatBackup:
+		results, errstr := p.targetResults(getWhat)
+		if errstr != "" {
+			p.invalmsghdlr(w, r, errstr)
+			return
+		}
+		jsbytes, err := json.Marshal(results)
+		assert(err == nil, err)
+		p.writeJSON(w, r, jsbytes, "httpcluget")
 	default:
 		s := fmt.Sprintf("Unexpected GET request, invalid param 'what': [%s]", getWhat)
 		p.invalmsghdlr(w, r, s)
 	}
 }
 
+// clusterStats collects the statistics or the xactions of all targets
+func (p *proxyrunner) clusterStats(w http.ResponseWriter, r *http.Request, getWhat string) {
+	if getWhat == GetWhatStats {
+		p.invokeHttpGetClusterStats(w, r)
+	} else {
+		p.invokeHttpGetXaction(w, r)
+	}
+}
+
 func (p *proxyrunner) invokeHttpGetXaction(w http.ResponseWriter, r *http.Request) bool {
 	getProps := r.URL.Query().Get(URLParamProps)
 	kind, err := p.getXactionKindFromProperties(getProps)
@@ -1874,6 +2329,27 @@ func (p *proxyrunner) invokeHttpGetMsgOnTargets(w http.ResponseWriter, r *http.R
 	return targetResults, true
 }
 
+// targetResults collects the results of the targets' xaction, e.g. import,
+// skipping the targets that have never run it
+func (p *proxyrunner) targetResults(what string) (map[string]json.RawMessage, string) {
+	q := url.Values{}
+	q.Set(URLParamWhat, what)
+	results := p.broadcastTargets(URLPath(Rversion, Rdaemon), q, http.MethodGet, nil,
+		p.smapowner.get(), ctx.config.Timeout.Default)
+	out := make(map[string]json.RawMessage)
+	for res := range results {
+		if res.err != nil {
+			if res.status == http.StatusNotFound {
+				continue
+			}
+			return nil, fmt.Sprintf("Failed to get %s results from %s: %v (%d: %s)",
+				what, res.si.DaemonID, res.err, res.status, res.errstr)
+		}
+		out[res.si.DaemonID] = json.RawMessage(res.outjson)
+	}
+	return out, ""
+}
+
 // FIXME: read-lock
 func (p *proxyrunner) invokeHttpGetClusterStats(
 	w http.ResponseWriter, r *http.Request) bool {
@@ -1902,7 +2378,7 @@ func (p *proxyrunner) invokeHttpGetClusterStats(
 // register|keepalive target
 func (p *proxyrunner) httpclupost(w http.ResponseWriter, r *http.Request) {
 	var (
-		nsi                          daemonInfo
+		kmsg                         keepaliveMsg
 		keepalive, register, isproxy bool
 		msg                          *ActionMsg
 	)
@@ -1918,12 +2394,17 @@ func (p *proxyrunner) httpclupost(w http.ResponseWriter, r *http.Request) {
 			keepalive = apitems[1] == Rkeepalive
 		}
 	}
-	if p.readJSON(w, r, &nsi) != nil {
+	if p.readJSON(w, r, &kmsg) != nil {
 		return
 	}
+	nsi := kmsg.daemonInfo
 	if !p.checkPrimaryProxy(fmt.Sprintf("register %s (isproxy=%t, keepalive=%t)", nsi.DaemonID, isproxy, keepalive), w, r) {
 		return
 	}
+	if kmsg.Load != nil && !isproxy {
+		p.loads.put(nsi.DaemonID, kmsg.Load)
+		p.updateEgress(nsi.DaemonID, kmsg.Load.CloudEgress)
+	}
 	if net.ParseIP(nsi.NodeIPAddr) == nil {
 		s := fmt.Sprintf("register target %s: invalid IP address %v", nsi.DaemonID, nsi.NodeIPAddr)
 		p.invalmsghdlr(w, r, s)
@@ -1958,7 +2439,7 @@ func (p *proxyrunner) httpclupost(w http.ResponseWriter, r *http.Request) {
 			if glog.V(3) {
 				glog.Infof("register target %s (count targets before %d)", nsi.DaemonID, smap.countTargets())
 			}
-			u := nsi.DirectURL + URLPath(Rversion, Rdaemon, Rregister)
+			u := nsi.controlURL() + URLPath(Rversion, Rdaemon, Rregister)
 			res := p.call(nil, &nsi, u, http.MethodPost, nil, ProxyPingTimeout)
 			if res.err != nil {
 				p.smapowner.Unlock()
@@ -2022,7 +2503,7 @@ func (p *proxyrunner) addOrUpdateNode(nsi *daemonInfo, osi *daemonInfo, keepaliv
 			return true
 		}
 
-		if osi.NodeIPAddr != nsi.NodeIPAddr || osi.DaemonPort != nsi.DaemonPort {
+		if !osi.sameNetworks(nsi) {
 			glog.Warningf("register/keepalive %s %s: info changed - renewing", kind, nsi.DaemonID)
 			return true
 		}
@@ -2031,10 +2512,11 @@ func (p *proxyrunner) addOrUpdateNode(nsi *daemonInfo, osi *daemonInfo, keepaliv
 		return false
 	}
 	if osi != nil {
-		if osi.NodeIPAddr == nsi.NodeIPAddr && osi.DaemonPort == nsi.DaemonPort && osi.DirectURL == nsi.DirectURL {
+		if osi.sameNetworks(nsi) {
 			glog.Infof("register %s %s: already done", kind, nsi.DaemonID)
 			return false
 		}
+		// same (persisted) ID at a new address is not a membership change - see daemonid.go
 		glog.Warningf("register %s %s: renewing the registration %+v => %+v", kind, nsi.DaemonID, osi, nsi)
 	}
 	return true
@@ -2094,7 +2576,7 @@ func (p *proxyrunner) httpcludel(w http.ResponseWriter, r *http.Request) {
 		if glog.V(3) {
 			glog.Infof("Unregistered target {%s} (count targets %d)", sid, clone.countTargets())
 		}
-		u := osi.DirectURL + URLPath(Rversion, Rdaemon)
+		u := osi.controlURL() + URLPath(Rversion, Rdaemon)
 		res := p.call(nil, osi, u, http.MethodDelete, nil, ProxyPingTimeout)
 		if res.err != nil {
 			glog.Warningf("The target %s that is being unregistered failed to respond back: %v, %s",
@@ -2127,6 +2609,7 @@ func (p *proxyrunner) httpcludel(w http.ResponseWriter, r *http.Request) {
 // '{"action": "syncsmap"}' /v1/cluster => (proxy) => PUT '{Smap}' /v1/daemon/syncsmap => target(s)
 // '{"action": "rebalance"}' /v1/cluster => (proxy) => PUT '{Smap}' /v1/daemon/rebalance => target(s)
 // '{"action": "setconfig"}' /v1/cluster => (proxy) =>
+// '{"action": "resetstats"}' /v1/cluster => (proxy) => PUT '{"action": "resetstats"}' /v1/daemon => all
 func (p *proxyrunner) httpcluput(w http.ResponseWriter, r *http.Request) {
 	apitems := p.restAPIItems(r.URL.Path, 5)
 	if apitems = p.checkRestAPI(w, r, apitems, 0, Rversion, Rcluster); apitems == nil {
@@ -2192,6 +2675,12 @@ func (p *proxyrunner) httpcluput(w http.ResponseWriter, r *http.Request) {
 		pair := &revspair{p.smapowner.get(), &msg}
 		p.metasyncer.sync(false, pair)
 
+	case ActSelfTest:
+		p.httpselftest(w, r, &msg)
+
+	case ActResetStats:
+		p.resetClusterStats(w, r, &msg)
+
 	default:
 		s := fmt.Sprintf("Unexpected ActionMsg <- JSON [%v]", msg)
 		p.invalmsghdlr(w, r, s)
@@ -2282,11 +2771,11 @@ func (p *proxyrunner) httpTokenDelete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	p.authn.updateRevokedList(tokenList)
+	revoked := p.authn.updateRevokedList(tokenList)
 
 	if p.smapowner.get().isPrimary(p.si) {
 		url := URLPath(Rversion, Rtokens)
-		jsonList, err := json.Marshal(tokenList)
+		jsonList, err := json.Marshal(revoked)
 		if err != nil {
 			glog.Errorf("Failed to marshal token list: %v", err)
 			return
@@ -2303,6 +2792,31 @@ func (p *proxyrunner) httpTokenDelete(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// Token introspection: checks a token and returns its owner and scope, so
+// external services can validate tokens without knowing the secret
+func (p *proxyrunner) httpTokenGet(w http.ResponseWriter, r *http.Request) {
+	msg := &TokenMsg{}
+	apitems := p.restAPIItems(r.URL.Path, 5)
+	if apitems = p.checkRestAPI(w, r, apitems, 0, Rversion, Rtokens); apitems == nil {
+		return
+	}
+	if !ctx.config.Auth.Enabled {
+		p.invalmsghdlr(w, r, "Authentication is disabled")
+		return
+	}
+	if err := p.readJSON(w, r, msg); err != nil {
+		return
+	}
+	if msg.Token == "" {
+		p.invalmsghdlr(w, r, "Token is not defined")
+		return
+	}
+
+	jsbytes, err := json.Marshal(p.authn.introspectToken(msg.Token))
+	assert(err == nil, err)
+	p.writeJSON(w, r, jsbytes, "introspecttoken")
+}
+
 // Read a token from request header and validates it
 // Header format:
 //		'Authorization: Bearer <token>'
@@ -2325,6 +2839,22 @@ func (p *proxyrunner) validateToken(r *http.Request) (*authRec, error) {
 	return auth, nil
 }
 
+// Returns the access a request requires. Listing and HEAD-ing objects are the
+// only POST requests that do not modify data, so POST body is checked and restored
+func (p *proxyrunner) requestAccess(r *http.Request) string {
+	if r.Method != http.MethodPost || r.Body == nil {
+		return methodAccess(r.Method)
+	}
+	b, err := ioutil.ReadAll(r.Body)
+	r.Body.Close()
+	r.Body = ioutil.NopCloser(bytes.NewReader(b))
+	msg := ActionMsg{}
+	if err == nil && json.Unmarshal(b, &msg) == nil && (msg.Action == ActListObjects || msg.Action == ActHeadObjects) {
+		return AccessRead
+	}
+	return AccessWrite
+}
+
 // A wrapper to check any request before delegating the request to real handler
 // If authentication is disabled, it does nothing.
 // If authentication is enabled, it looks for token in request header and
@@ -2342,8 +2872,22 @@ func (p *proxyrunner) checkHTTPAuth(h http.HandlerFunc) http.HandlerFunc {
 				p.invalmsghdlr(w, r, "Not authorized", http.StatusUnauthorized)
 				return
 			}
+			// tokens can be limited to a set of buckets and HTTP methods
+			bucket := ""
+			if apitems := p.restAPIItems(r.URL.Path, 5); len(apitems) > 2 {
+				bucket = apitems[2]
+			}
+			if !auth.allows(bucket, r.Method, p.requestAccess(r)) {
+				glog.Errorf("Token of %s: %s %s is out of scope", auth.userID, r.Method, bucket)
+				p.invalmsghdlr(w, r, "Not authorized", http.StatusForbidden)
+				return
+			}
 			if glog.V(3) {
-				glog.Infof("Logged as %s", auth.userID)
+				if auth.apiKey != "" {
+					glog.Infof("Logged as %s with API key %s", auth.userID, auth.apiKey)
+				} else {
+					glog.Infof("Logged as %s", auth.userID)
+				}
 			}
 		}
 
@@ -2365,6 +2909,11 @@ func (p *proxyrunner) receiveMeta(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if errstr, status := p.expandSmapDelta(payload); errstr != "" {
+		p.invalmsghdlr(w, r, errstr, status)
+		return
+	}
+
 	newsmap, _, _, errstr := p.extractSmap(payload)
 	if errstr != "" {
 		p.invalmsghdlr(w, r, errstr)
@@ -2529,14 +3078,47 @@ func (p *proxyrunner) discoverClusterMeta(discoverySmap *Smap, deadline time.Tim
 }
 
 func validateBucketProps(props *BucketProps, isLocal bool) error {
+	if props.IngressLimit < 0 || props.EgressLimit < 0 {
+		return fmt.Errorf("invalid bandwidth limits: ingress %d, egress %d", props.IngressLimit, props.EgressLimit)
+	}
+	if props.EgressBudget < 0 {
+		return fmt.Errorf("invalid cloud egress budget: %d", props.EgressBudget)
+	}
+	if props.MaxStale != "" {
+		if d, err := time.ParseDuration(props.MaxStale); err != nil || d <= 0 {
+			return fmt.Errorf("invalid max_stale: %s", props.MaxStale)
+		}
+	}
+	if props.WORM && !isLocal {
+		return fmt.Errorf("write-once (WORM) is supported only for local buckets")
+	}
+	if props.Retention != "" {
+		if !props.WORM {
+			return fmt.Errorf("retention requires write-once (WORM)")
+		}
+		if d, err := time.ParseDuration(props.Retention); err != nil || d <= 0 {
+			return fmt.Errorf("invalid retention: %s", props.Retention)
+		}
+	}
 	if props.NextTierURL != "" {
-		if _, err := url.ParseRequestURI(props.NextTierURL); err != nil {
+		u, err := url.ParseRequestURI(props.NextTierURL)
+		if err != nil {
 			return fmt.Errorf("invalid next tier URL: %s, err: %v", props.NextTierURL, err)
 		}
+		// the targets send requests to the next tier as is
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid next tier URL: %s, must be an absolute http(s) URL", props.NextTierURL)
+		}
 	}
 	if err := ValidateCloudProvider(props.CloudProvider, isLocal); err != nil {
 		return err
 	}
+	if err := validateECProps(props, isLocal); err != nil {
+		return err
+	}
+	if err := validateMirrorProps(props); err != nil {
+		return err
+	}
 	if props.ReadPolicy != "" && props.ReadPolicy != RWPolicyCloud && props.ReadPolicy != RWPolicyNextTier {
 		return fmt.Errorf("invalid read policy: %s", props.ReadPolicy)
 	}
@@ -2549,6 +3131,34 @@ func validateBucketProps(props *BucketProps, isLocal bool) error {
 	if props.WritePolicy == RWPolicyCloud && isLocal {
 		return fmt.Errorf("write policy for local bucket cannot be '%s'", RWPolicyCloud)
 	}
+	if props.CloudSSE != "" {
+		if isLocal || ctx.config.CloudProvider != ProviderAmazon {
+			return fmt.Errorf("cloud server-side encryption is supported only for %s buckets", ProviderAmazon)
+		}
+		if props.CloudSSE != CloudSSEAES256 && props.CloudSSE != CloudSSEKMS {
+			return fmt.Errorf("invalid cloud server-side encryption: %s, must be one of (%s | %s)",
+				props.CloudSSE, CloudSSEAES256, CloudSSEKMS)
+		}
+	}
+	if props.CloudSSEKeyID != "" && props.CloudSSE != CloudSSEKMS {
+		return fmt.Errorf("KMS key ID requires '%s' cloud server-side encryption", CloudSSEKMS)
+	}
+	if props.RequesterPays || props.StorageClass != "" {
+		if isLocal {
+			return fmt.Errorf("requester pays and storage class are supported only for cloud buckets")
+		}
+		classes := awsStorageClasses
+		if ctx.config.CloudProvider == ProviderGoogle {
+			classes = gcpStorageClasses
+		}
+		if props.StorageClass != "" && !classes[props.StorageClass] {
+			return fmt.Errorf("invalid %s storage class: %s", ctx.config.CloudProvider, props.StorageClass)
+		}
+	}
+	if props.Fsync != "" && !validFsyncPolicy(props.Fsync) {
+		return fmt.Errorf("invalid fsync policy: %s, must be one of (%s | %s | %s)",
+			props.Fsync, FsyncNever, FsyncFile, FsyncDir)
+	}
 	if props.NextTierURL != "" {
 		if props.CloudProvider == "" {
 			return fmt.Errorf("tiered bucket must use one of the supported cloud providers (%s | %s | %s)",
@@ -0,0 +1,390 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+// Dataset publishing.
+// A version of a dataset of a local bucket is uploaded, object by object,
+// under <dataset>/<version>/, where readers do not look for it. Then
+// POST {"action": "publish", "value": {"dataset": ..., "version": ...,
+// "objnames": [...]}} to /v1/buckets/bucket-name publishes it: the proxy
+// checks that all the objects of the manifest are there, stores the manifest
+// as <dataset>/<version>/.manifest.json and flips the current version of the
+// dataset in the bucket metadata. Readers read <dataset>/latest/<object> -
+// the proxy resolves it to the current version - or, to see one version
+// throughout, get the current version with GET ?what=datasets and read it
+// directly. Only publish.keep versions of a dataset are kept: older ones are
+// deleted once a new version is published. The "rollback" action makes one of
+// the kept versions current again, and GET ?what=datasetdiff compares the
+// manifests and the objects of two kept versions.
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/NVIDIA/dfcpub/3rdparty/glog"
+)
+
+const (
+	publishKeep     = 2                // default publish.keep
+	datasetLatest   = "latest"         // <dataset>/latest/ - the current version
+	datasetManifest = ".manifest.json" // <dataset>/<version>/.manifest.json
+)
+
+func parsePublishMsg(msg *ActionMsg) (*PublishMsg, error) {
+	pubmsg, err := parseDatasetMsg(msg)
+	if err != nil {
+		return nil, err
+	}
+	if pubmsg.Version == datasetLatest {
+		return nil, fmt.Errorf("Invalid dataset version %q", pubmsg.Version)
+	}
+	if len(pubmsg.Objnames) == 0 {
+		return nil, fmt.Errorf("No objects in the manifest of %s/%s", pubmsg.Dataset, pubmsg.Version)
+	}
+	for _, objname := range pubmsg.Objnames {
+		if objname == "" || objname == datasetManifest {
+			return nil, fmt.Errorf("Invalid object name %q in the manifest of %s/%s", objname, pubmsg.Dataset, pubmsg.Version)
+		}
+	}
+	return pubmsg, nil
+}
+
+// parseDatasetMsg parses the dataset and the version of publish and rollback
+func parseDatasetMsg(msg *ActionMsg) (*PublishMsg, error) {
+	pubmsg := &PublishMsg{}
+	if msg.Value != nil {
+		b, err := json.Marshal(msg.Value)
+		if err == nil {
+			err = json.Unmarshal(b, pubmsg)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Invalid %s parameters %v, err: %v", msg.Action, msg.Value, err)
+		}
+	}
+	if pubmsg.Dataset == "" || strings.Contains(pubmsg.Dataset, "/") {
+		return nil, fmt.Errorf("Invalid dataset name %q", pubmsg.Dataset)
+	}
+	if pubmsg.Version == "" || strings.Contains(pubmsg.Version, "/") {
+		return nil, fmt.Errorf("Invalid dataset version %q", pubmsg.Version)
+	}
+	return pubmsg, nil
+}
+
+func datasetPrefix(dataset, version string) string {
+	return dataset + "/" + version + "/"
+}
+
+// missingObjects returns the objects of the manifest not found in the listed
+// objects of the version
+func missingObjects(pubmsg *PublishMsg, entries []*BucketEntry) []string {
+	prefix := datasetPrefix(pubmsg.Dataset, pubmsg.Version)
+	found := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		found[strings.TrimPrefix(entry.Name, prefix)] = true
+	}
+	missing := make([]string, 0)
+	for _, objname := range pubmsg.Objnames {
+		if !found[objname] {
+			missing = append(missing, objname)
+		}
+	}
+	return missing
+}
+
+// publishVersion returns the datasets with the new current version and the
+// versions to delete, keeping the given number of versions
+func publishVersion(datasets []DatasetInfo, dataset, version string, keep int) ([]DatasetInfo, []string, error) {
+	published := make([]DatasetInfo, 0, len(datasets)+1)
+	info := DatasetInfo{Name: dataset}
+	for _, ds := range datasets {
+		if ds.Name == dataset {
+			info = ds
+			continue
+		}
+		published = append(published, ds)
+	}
+	for _, v := range info.Versions {
+		if v == version {
+			return nil, nil, fmt.Errorf("Version %s of dataset %s is already published", version, dataset)
+		}
+	}
+	versions := make([]string, 0, len(info.Versions)+1)
+	versions = append(versions, info.Versions...)
+	versions = append(versions, version)
+	var removed []string
+	if len(versions) > keep {
+		removed = versions[:len(versions)-keep]
+		versions = versions[len(versions)-keep:]
+	}
+	info.Current, info.Versions = version, versions
+	published = append(published, info)
+	sort.Slice(published, func(i, j int) bool { return published[i].Name < published[j].Name })
+	return published, removed, nil
+}
+
+// rollbackVersion returns the datasets with the kept version current again
+func rollbackVersion(datasets []DatasetInfo, dataset, version string) ([]DatasetInfo, error) {
+	for i, ds := range datasets {
+		if ds.Name != dataset {
+			continue
+		}
+		for _, v := range ds.Versions {
+			if v != version {
+				continue
+			}
+			rolledback := make([]DatasetInfo, len(datasets))
+			copy(rolledback, datasets)
+			rolledback[i].Current = version
+			return rolledback, nil
+		}
+		return nil, fmt.Errorf("Version %s of dataset %s %s", version, dataset, doesnotexist)
+	}
+	return nil, fmt.Errorf("Dataset %s %s", dataset, doesnotexist)
+}
+
+// diffVersions compares the manifests of two versions and, for the objects in
+// both, the listed checksums and sizes
+func diffVersions(from, to *PublishMsg, fromEntries, toEntries []*BucketEntry) *DatasetDiff {
+	entries := func(pubmsg *PublishMsg, list []*BucketEntry) map[string]*BucketEntry {
+		prefix := datasetPrefix(pubmsg.Dataset, pubmsg.Version)
+		m := make(map[string]*BucketEntry, len(list))
+		for _, entry := range list {
+			m[strings.TrimPrefix(entry.Name, prefix)] = entry
+		}
+		return m
+	}
+	fromMap, toMap := entries(from, fromEntries), entries(to, toEntries)
+	diff := &DatasetDiff{Dataset: to.Dataset, From: from.Version, To: to.Version,
+		Added: []string{}, Removed: []string{}, Changed: []string{}}
+	inFrom := make(map[string]bool, len(from.Objnames))
+	for _, objname := range from.Objnames {
+		inFrom[objname] = true
+	}
+	inTo := make(map[string]bool, len(to.Objnames))
+	for _, objname := range to.Objnames {
+		inTo[objname] = true
+		if !inFrom[objname] {
+			diff.Added = append(diff.Added, objname)
+			continue
+		}
+		f, t := fromMap[objname], toMap[objname]
+		if f == nil || t == nil || f.Size != t.Size || f.Checksum != t.Checksum {
+			diff.Changed = append(diff.Changed, objname)
+		}
+	}
+	for _, objname := range from.Objnames {
+		if !inTo[objname] {
+			diff.Removed = append(diff.Removed, objname)
+		}
+	}
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	sort.Strings(diff.Changed)
+	return diff
+}
+
+// resolveDataset resolves <dataset>/latest/<object> to the current version of
+// the dataset
+func resolveDataset(props *BucketProps, objname string) (string, bool) {
+	items := strings.SplitN(objname, "/", 3)
+	if len(items) < 3 || items[1] != datasetLatest {
+		return objname, false
+	}
+	for _, ds := range props.Datasets {
+		if ds.Name == items[0] && ds.Current != "" {
+			return datasetPrefix(ds.Name, ds.Current) + items[2], true
+		}
+	}
+	return objname, false
+}
+
+//
+// proxy
+//
+
+// resolveLatest rewrites the request for <dataset>/latest/<object>
+func (p *proxyrunner) resolveLatest(r *http.Request, bucket, objname string) string {
+	bucketmd := p.bmdowner.get()
+	if !bucketmd.islocal(bucket) {
+		return objname
+	}
+	_, props := bucketmd.get(bucket, true)
+	resolved, ok := resolveDataset(&props, objname)
+	if ok {
+		r.URL.Path = URLPath(Rversion, Robjects, bucket, resolved)
+		r.URL.RawPath = ""
+	}
+	return resolved
+}
+
+// POST {"action": "publish", "value": {"dataset": ..., "version": ..., "objnames": [...]}} /v1/buckets/bucket-name
+func (p *proxyrunner) publishDataset(w http.ResponseWriter, r *http.Request, bucket string, msg *ActionMsg) {
+	pubmsg, err := parsePublishMsg(msg)
+	if err != nil {
+		p.invalmsghdlr(w, r, err.Error())
+		return
+	}
+	if !p.bmdowner.get().islocal(bucket) {
+		p.invalmsghdlr(w, r, fmt.Sprintf("Cannot publish to Cloud bucket %s", bucket))
+		return
+	}
+	token := r.Header.Get("Authorization")
+	prefix := datasetPrefix(pubmsg.Dataset, pubmsg.Version)
+	entries, err := p.listObjects(bucket, prefix, "", token)
+	if err != nil {
+		p.invalmsghdlr(w, r, fmt.Sprintf("Failed to list %s/%s, err: %v", bucket, prefix, err))
+		return
+	}
+	if missing := missingObjects(pubmsg, entries); len(missing) > 0 {
+		p.invalmsghdlr(w, r, fmt.Sprintf("Cannot publish %s/%s: %d of %d objects are missing, e.g. %s",
+			bucket, prefix, len(missing), len(pubmsg.Objnames), missing[0]), http.StatusConflict)
+		return
+	}
+	jsbytes, err := json.Marshal(pubmsg)
+	assert(err == nil, err)
+	if _, err = p.selfRequest(http.MethodPut, URLEscapedPath(Rversion, Robjects, bucket, prefix+datasetManifest), jsbytes, token); err != nil {
+		p.invalmsghdlr(w, r, fmt.Sprintf("Failed to store the manifest of %s/%s, err: %v", bucket, prefix, err))
+		return
+	}
+
+	p.bmdowner.Lock()
+	clone := p.bmdowner.get().clone()
+	exists, props := clone.get(bucket, true)
+	if !exists {
+		p.bmdowner.Unlock()
+		p.invalmsghdlr(w, r, fmt.Sprintf("Local bucket %s %s", bucket, doesnotexist), http.StatusNotFound)
+		return
+	}
+	datasets, removed, err := publishVersion(props.Datasets, pubmsg.Dataset, pubmsg.Version, ctx.config.Publish.Keep)
+	if err != nil {
+		p.bmdowner.Unlock()
+		p.invalmsghdlr(w, r, err.Error(), http.StatusConflict)
+		return
+	}
+	props.Datasets = datasets
+	clone.set(bucket, true, props)
+	if errstr := p.savebmdconf(clone); errstr != "" {
+		glog.Errorln(errstr)
+	}
+	p.bmdowner.put(clone)
+	p.bmdowner.Unlock()
+	p.metasyncer.sync(true, &revspair{clone, msg})
+	glog.Infof("Published %s/%s: %d objects", bucket, prefix, len(pubmsg.Objnames))
+	if len(removed) > 0 {
+		go p.removeVersions(bucket, pubmsg.Dataset, removed, token)
+	}
+}
+
+// removeVersions deletes the objects of the old versions of the dataset
+func (p *proxyrunner) removeVersions(bucket, dataset string, versions []string, token string) {
+	for _, version := range versions {
+		prefix := datasetPrefix(dataset, version)
+		jsbytes, err := json.Marshal(&ActionMsg{Action: ActDelete, Value: map[string]interface{}{
+			"prefix": prefix, "regex": "", "range": "", "wait": true}})
+		assert(err == nil, err)
+		if _, err = p.selfRequest(http.MethodDelete, URLPath(Rversion, Rbuckets, bucket), jsbytes, token); err != nil {
+			glog.Errorf("Failed to delete %s/%s, err: %v", bucket, prefix, err)
+			continue
+		}
+		glog.Infof("Deleted %s/%s", bucket, prefix)
+	}
+}
+
+// POST {"action": "rollback", "value": {"dataset": ..., "version": ...}} /v1/buckets/bucket-name
+func (p *proxyrunner) rollbackDataset(w http.ResponseWriter, r *http.Request, bucket string, msg *ActionMsg) {
+	pubmsg, err := parseDatasetMsg(msg)
+	if err != nil {
+		p.invalmsghdlr(w, r, err.Error())
+		return
+	}
+	p.bmdowner.Lock()
+	clone := p.bmdowner.get().clone()
+	exists, props := clone.get(bucket, true)
+	if !exists {
+		p.bmdowner.Unlock()
+		p.invalmsghdlr(w, r, fmt.Sprintf("Local bucket %s %s", bucket, doesnotexist), http.StatusNotFound)
+		return
+	}
+	datasets, err := rollbackVersion(props.Datasets, pubmsg.Dataset, pubmsg.Version)
+	if err != nil {
+		p.bmdowner.Unlock()
+		p.invalmsghdlr(w, r, err.Error(), http.StatusNotFound)
+		return
+	}
+	props.Datasets = datasets
+	clone.set(bucket, true, props)
+	if errstr := p.savebmdconf(clone); errstr != "" {
+		glog.Errorln(errstr)
+	}
+	p.bmdowner.put(clone)
+	p.bmdowner.Unlock()
+	p.metasyncer.sync(true, &revspair{clone, msg})
+	glog.Infof("Rolled back %s/%s to %s", bucket, pubmsg.Dataset, pubmsg.Version)
+}
+
+// GET /v1/buckets/bucket-name?what=datasets[&dataset=name]
+func (p *proxyrunner) httpdatasets(w http.ResponseWriter, r *http.Request, bucket string) {
+	_, props := p.bmdowner.get().get(bucket, true)
+	var out interface{} = props.Datasets
+	if props.Datasets == nil {
+		out = []DatasetInfo{}
+	}
+	if name := r.URL.Query().Get(URLParamDataset); name != "" {
+		out = nil
+		for i := range props.Datasets {
+			if props.Datasets[i].Name == name {
+				out = &props.Datasets[i]
+			}
+		}
+		if out == nil {
+			p.invalmsghdlr(w, r, fmt.Sprintf("Dataset %s/%s %s", bucket, name, doesnotexist), http.StatusNotFound)
+			return
+		}
+	}
+	jsbytes, err := json.Marshal(out)
+	assert(err == nil, err)
+	p.writeJSON(w, r, jsbytes, "datasets")
+}
+
+// GET /v1/buckets/bucket-name?what=datasetdiff&dataset=name&from_version=v1&to_version=v2
+func (p *proxyrunner) httpdiff(w http.ResponseWriter, r *http.Request, bucket string) {
+	var (
+		query   = r.URL.Query()
+		token   = r.Header.Get("Authorization")
+		dataset = query.Get(URLParamDataset)
+		pubmsgs = make([]*PublishMsg, 0, 2)
+		lists   = make([][]*BucketEntry, 0, 2)
+	)
+	for _, version := range []string{query.Get(URLParamFromVersion), query.Get(URLParamToVersion)} {
+		if dataset == "" || version == "" {
+			p.invalmsghdlr(w, r, fmt.Sprintf("Expecting %s, %s and %s", URLParamDataset, URLParamFromVersion, URLParamToVersion))
+			return
+		}
+		prefix := datasetPrefix(dataset, version)
+		b, err := p.selfRequest(http.MethodGet, URLEscapedPath(Rversion, Robjects, bucket, prefix+datasetManifest), nil, token)
+		if err != nil {
+			p.invalmsghdlr(w, r, fmt.Sprintf("Failed to read the manifest of %s/%s, err: %v", bucket, prefix, err), http.StatusNotFound)
+			return
+		}
+		pubmsg := &PublishMsg{}
+		if err = json.Unmarshal(b, pubmsg); err != nil {
+			p.invalmsghdlr(w, r, fmt.Sprintf("Invalid manifest of %s/%s, err: %v", bucket, prefix, err))
+			return
+		}
+		entries, err := p.listObjects(bucket, prefix, GetPropsChecksum+", "+GetPropsSize, token)
+		if err != nil {
+			p.invalmsghdlr(w, r, fmt.Sprintf("Failed to list %s/%s, err: %v", bucket, prefix, err))
+			return
+		}
+		pubmsgs, lists = append(pubmsgs, pubmsg), append(lists, entries)
+	}
+	jsbytes, err := json.Marshal(diffVersions(pubmsgs[0], pubmsgs[1], lists[0], lists[1]))
+	assert(err == nil, err)
+	p.writeJSON(w, r, jsbytes, "datasetdiff")
+}
@@ -0,0 +1,130 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePublishMsg(t *testing.T) {
+	pubmsg, err := parsePublishMsg(&ActionMsg{Action: ActPublish, Value: map[string]interface{}{
+		"dataset": "imagenet", "version": "v1", "objnames": []string{"train/1.tar", "val/1.tar"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &PublishMsg{Dataset: "imagenet", Version: "v1", Objnames: []string{"train/1.tar", "val/1.tar"}}
+	if !reflect.DeepEqual(pubmsg, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, pubmsg)
+	}
+	for _, value := range []map[string]interface{}{
+		{"dataset": "", "version": "v1", "objnames": []string{"a"}},
+		{"dataset": "a/b", "version": "v1", "objnames": []string{"a"}},
+		{"dataset": "imagenet", "version": datasetLatest, "objnames": []string{"a"}},
+		{"dataset": "imagenet", "version": "v/1", "objnames": []string{"a"}},
+		{"dataset": "imagenet", "version": "v1"},
+		{"dataset": "imagenet", "version": "v1", "objnames": []string{"a", datasetManifest}},
+	} {
+		if _, err = parsePublishMsg(&ActionMsg{Action: ActPublish, Value: value}); err == nil {
+			t.Errorf("Expected %v to fail", value)
+		}
+	}
+}
+
+func TestMissingObjects(t *testing.T) {
+	pubmsg := &PublishMsg{Dataset: "ds", Version: "v2", Objnames: []string{"a", "b/c", "d"}}
+	entries := []*BucketEntry{{Name: "ds/v2/a"}, {Name: "ds/v2/b/c"}, {Name: "ds/v2/e"}}
+	if missing := missingObjects(pubmsg, entries); !reflect.DeepEqual(missing, []string{"d"}) {
+		t.Errorf("Expected d to be missing, got %v", missing)
+	}
+	entries = append(entries, &BucketEntry{Name: "ds/v2/d"})
+	if missing := missingObjects(pubmsg, entries); len(missing) != 0 {
+		t.Errorf("Expected no objects to be missing, got %v", missing)
+	}
+}
+
+func TestPublishVersion(t *testing.T) {
+	other := DatasetInfo{Name: "other", Current: "x", Versions: []string{"x"}}
+	datasets, removed, err := publishVersion([]DatasetInfo{other}, "ds", "v1", 2)
+	if err != nil || removed != nil {
+		t.Fatalf("Unexpected removed %v, err: %v", removed, err)
+	}
+	datasets, removed, err = publishVersion(datasets, "ds", "v2", 2)
+	if err != nil || removed != nil {
+		t.Fatalf("Unexpected removed %v, err: %v", removed, err)
+	}
+	previous := datasets
+	datasets, removed, err = publishVersion(datasets, "ds", "v3", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []DatasetInfo{{Name: "ds", Current: "v3", Versions: []string{"v2", "v3"}}, other}
+	if !reflect.DeepEqual(datasets, expected) || !reflect.DeepEqual(removed, []string{"v1"}) {
+		t.Errorf("Expected %+v, got %+v, removed %v", expected, datasets, removed)
+	}
+	if previous[0].Current != "v2" {
+		t.Errorf("Expected the previous datasets to stay unchanged, got %+v", previous)
+	}
+	if _, _, err = publishVersion(datasets, "ds", "v3", 2); err == nil {
+		t.Error("Expected publishing v3 again to fail")
+	}
+}
+
+func TestResolveDataset(t *testing.T) {
+	props := &BucketProps{Datasets: []DatasetInfo{{Name: "ds", Current: "v3", Versions: []string{"v2", "v3"}}}}
+	for _, test := range []struct {
+		objname, resolved string
+		ok                bool
+	}{
+		{"ds/latest/a/b", "ds/v3/a/b", true},
+		{"ds/latest/" + datasetManifest, "ds/v3/" + datasetManifest, true},
+		{"ds/v2/a", "ds/v2/a", false},
+		{"ds/latest", "ds/latest", false},
+		{"other/latest/a", "other/latest/a", false},
+	} {
+		if resolved, ok := resolveDataset(props, test.objname); resolved != test.resolved || ok != test.ok {
+			t.Errorf("%s: expected %s (%t), got %s (%t)", test.objname, test.resolved, test.ok, resolved, ok)
+		}
+	}
+}
+
+func TestRollbackVersion(t *testing.T) {
+	datasets := []DatasetInfo{{Name: "ds", Current: "v3", Versions: []string{"v2", "v3"}}}
+	rolledback, err := rollbackVersion(datasets, "ds", "v2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rolledback[0].Current != "v2" || datasets[0].Current != "v3" {
+		t.Errorf("Expected v2 to be current, got %+v (was %+v)", rolledback, datasets)
+	}
+	if _, err = rollbackVersion(datasets, "ds", "v1"); err == nil {
+		t.Error("Expected rollback to a deleted version to fail")
+	}
+	if _, err = rollbackVersion(datasets, "other", "v2"); err == nil {
+		t.Error("Expected rollback of an unknown dataset to fail")
+	}
+}
+
+func TestDiffVersions(t *testing.T) {
+	from := &PublishMsg{Dataset: "ds", Version: "v1", Objnames: []string{"a", "b", "c", "d"}}
+	to := &PublishMsg{Dataset: "ds", Version: "v2", Objnames: []string{"e", "d", "c", "a"}}
+	fromEntries := []*BucketEntry{
+		{Name: "ds/v1/a", Size: 1, Checksum: "1"},
+		{Name: "ds/v1/b", Size: 2, Checksum: "2"},
+		{Name: "ds/v1/c", Size: 3, Checksum: "3"},
+		{Name: "ds/v1/d", Size: 4, Checksum: "4"},
+	}
+	toEntries := []*BucketEntry{
+		{Name: "ds/v2/a", Size: 1, Checksum: "1"},
+		{Name: "ds/v2/c", Size: 3, Checksum: "33"},
+		{Name: "ds/v2/d", Size: 44, Checksum: "4"},
+		{Name: "ds/v2/e", Size: 5, Checksum: "5"},
+	}
+	expected := &DatasetDiff{Dataset: "ds", From: "v1", To: "v2",
+		Added: []string{"e"}, Removed: []string{"b"}, Changed: []string{"c", "d"}}
+	if diff := diffVersions(from, to, fromEntries, toEntries); !reflect.DeepEqual(diff, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, diff)
+	}
+}
@@ -40,7 +40,7 @@ func (t *targetrunner) runRebalance(newsmap *Smap, newtargetid string) {
 		if sid == t.si.DaemonID {
 			continue
 		}
-		url := si.DirectURL + "/" + Rversion + "/" + Rhealth
+		url := si.controlURL() + "/" + Rversion + "/" + Rhealth
 		url += from
 		pollstarted, ok := time.Now(), false
 		timeout := kalivetimeout
@@ -101,18 +101,16 @@ func (t *targetrunner) runRebalance(newsmap *Smap, newtargetid string) {
 		allr = append(allr, rl)
 	}
 	wg.Wait()
-	if pmarker != "" {
-		var aborted bool
-		for _, r := range allr {
-			if r.aborted {
-				aborted = true
-				break
-			}
+	var aborted bool
+	for _, r := range allr {
+		if r.aborted {
+			aborted = true
+			break
 		}
-		if !aborted {
-			if err := os.Remove(pmarker); err != nil {
-				glog.Errorf("Failed to remove rebalance-in-progress mark %s, err: %v", pmarker, err)
-			}
+	}
+	if pmarker != "" && !aborted {
+		if err := os.Remove(pmarker); err != nil {
+			glog.Errorf("Failed to remove rebalance-in-progress mark %s, err: %v", pmarker, err)
 		}
 	}
 	if newtargetid == t.si.DaemonID {
@@ -122,6 +120,10 @@ func (t *targetrunner) runRebalance(newsmap *Smap, newtargetid string) {
 	xreb.etime = time.Now()
 	glog.Infoln(xreb.tostring())
 	t.xactinp.del(xreb.id)
+	if !aborted {
+		// the objects of the manifests may have moved here
+		t.warmup(warmupBuckets(newBucketMD(), t.bmdowner.get()))
+	}
 }
 
 func (t *targetrunner) pollRebalancingDone(newsmap *Smap) {
@@ -132,7 +134,7 @@ func (t *targetrunner) pollRebalancingDone(newsmap *Smap) {
 			if sid == t.si.DaemonID {
 				continue
 			}
-			url := si.DirectURL + "/" + Rversion + "/" + Rhealth
+			url := si.controlURL() + "/" + Rversion + "/" + Rhealth
 			res := t.call(nil, si, url, http.MethodGet, nil)
 			// retry once
 			if res.err == context.DeadlineExceeded {
@@ -213,7 +215,7 @@ func (rcl *xrebpathrunner) rebwalkf(fqn string, osfi os.FileInfo, err error) err
 		glog.Warningf("%s - skipping...", errstr)
 		return nil
 	}
-	si, errstr := HrwTarget(bucket, objname, rcl.newsmap)
+	si, errstr := HrwTarget(bucket, rcl.t.placementName(fqn, objname), rcl.newsmap)
 	if errstr != "" {
 		return fmt.Errorf(errstr)
 	}
@@ -229,6 +231,8 @@ func (rcl *xrebpathrunner) rebwalkf(fqn string, osfi os.FileInfo, err error) err
 		// FIXME: TODO: delay the removal or (even) rely on the LRU
 		if err := os.Remove(fqn); err != nil {
 			glog.Errorf("Failed to delete %s after it has been moved, err: %v", fqn, err)
+		} else {
+			rcl.t.removeMirrors(bucket, objname, rcl.t.bmdowner.get().islocal(bucket), nil)
 		}
 	}
 	return nil
@@ -0,0 +1,246 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/NVIDIA/dfcpub/3rdparty/glog"
+)
+
+// Sample index. GET /v1/buckets/bucket-name?what=samples answers sample-level
+// queries about a bucket of tar shards, so that data loaders can read the
+// samples (tar members) with range reads of the shards:
+// - name=X: which shard contains sample X and at which offset;
+// - count=N[&ext=.jpg][&seed=S]: N random samples, optionally of the given
+//   extension;
+// - none of the above: the number of indexed shards and samples.
+// The proxy builds the index of a bucket upon the first query from the
+// shards' manifests (see export) - the objects named <shard-name>.json - and
+// keeps it in memory; reload=true rebuilds it, e.g. after more shards have
+// been added.
+
+type (
+	sampleIndex struct {
+		info    SampleIndexInfo
+		samples []*SampleLocation // sorted by name
+		byname  map[string]*SampleLocation
+		shards  map[string][]*SampleLocation // shard => samples in the manifest's order
+	}
+	sampleIndexes struct {
+		sync.Mutex
+		m map[string]*sampleIndex // bucket => index
+	}
+)
+
+func newSampleIndex(bucket string, manifests []*ExportManifest) *sampleIndex {
+	idx := &sampleIndex{
+		info:   SampleIndexInfo{Bucket: bucket, Shards: len(manifests), Loaded: time.Now()},
+		byname: make(map[string]*SampleLocation),
+		shards: make(map[string][]*SampleLocation, len(manifests)),
+	}
+	sort.Slice(manifests, func(i, j int) bool { return manifests[i].Shard < manifests[j].Shard })
+	duplicates := 0
+	for _, manifest := range manifests {
+		locations := make([]*SampleLocation, len(manifest.Objects))
+		idx.shards[manifest.Shard] = locations
+		for i, obj := range manifest.Objects {
+			sample := &SampleLocation{Name: obj.Name, Shard: manifest.Shard, Offset: obj.Offset,
+				Size: obj.Size, Checksum: obj.Checksum}
+			locations[i] = sample
+			if _, ok := idx.byname[obj.Name]; ok {
+				duplicates++ // the first shard wins
+				continue
+			}
+			idx.byname[obj.Name] = sample
+			idx.samples = append(idx.samples, sample)
+		}
+	}
+	if duplicates > 0 {
+		glog.Warningf("Sample index %s: %d samples are found in more than one shard", bucket, duplicates)
+	}
+	sort.Slice(idx.samples, func(i, j int) bool { return idx.samples[i].Name < idx.samples[j].Name })
+	idx.info.Samples = len(idx.samples)
+	return idx
+}
+
+// random returns up to count distinct samples with the extension, if given
+func (idx *sampleIndex) random(count int, ext string, rnd *rand.Rand) []*SampleLocation {
+	if ext != "" && !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	candidates := make([]*SampleLocation, 0, len(idx.samples))
+	for _, sample := range idx.samples {
+		if ext == "" || strings.HasSuffix(sample.Name, ext) {
+			candidates = append(candidates, sample)
+		}
+	}
+	if count > len(candidates) {
+		count = len(candidates)
+	}
+	// partial Fisher-Yates
+	for i := 0; i < count; i++ {
+		j := i + rnd.Intn(len(candidates)-i)
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	}
+	return candidates[:count]
+}
+
+//
+// proxy
+//
+
+// GET /v1/buckets/bucket-name?what=samples
+func (p *proxyrunner) httpsamples(w http.ResponseWriter, r *http.Request, bucket string) {
+	var (
+		query  = r.URL.Query()
+		reload = query.Get(URLParamReload) == "true"
+		out    interface{}
+	)
+	idx, errstr := p.sampleIndex(bucket, r.Header.Get("Authorization"), reload)
+	if errstr != "" {
+		p.invalmsghdlr(w, r, errstr)
+		return
+	}
+	if name := query.Get(URLParamName); name != "" {
+		sample, ok := idx.byname[name]
+		if !ok {
+			p.invalmsghdlr(w, r, fmt.Sprintf("Sample %s/%s %s", bucket, name, doesnotexist), http.StatusNotFound)
+			return
+		}
+		out = sample
+	} else if countstr := query.Get(URLParamCount); countstr != "" {
+		count, err := strconv.Atoi(countstr)
+		if err != nil || count < 0 {
+			p.invalmsghdlr(w, r, fmt.Sprintf("Invalid number of samples %q", countstr))
+			return
+		}
+		seed := time.Now().UnixNano()
+		if seedstr := query.Get(URLParamSeed); seedstr != "" {
+			if seed, err = strconv.ParseInt(seedstr, 10, 64); err != nil {
+				p.invalmsghdlr(w, r, fmt.Sprintf("Invalid seed %q", seedstr))
+				return
+			}
+		}
+		out = idx.random(count, query.Get(URLParamExt), rand.New(rand.NewSource(seed)))
+	} else {
+		out = &idx.info
+	}
+	jsbytes, err := json.Marshal(out)
+	assert(err == nil, err)
+	p.writeJSON(w, r, jsbytes, "samples")
+}
+
+// sampleIndex returns the index of the bucket, building it if need be
+func (p *proxyrunner) sampleIndex(bucket, token string, reload bool) (*sampleIndex, string) {
+	p.samples.Lock()
+	idx, ok := p.samples.m[bucket]
+	p.samples.Unlock()
+	if ok && !reload {
+		return idx, ""
+	}
+	manifests, err := p.loadManifests(bucket, token)
+	if err != nil {
+		return nil, fmt.Sprintf("Failed to load the shard manifests of %s, err: %v", bucket, err)
+	}
+	idx = newSampleIndex(bucket, manifests)
+	glog.Infof("Sample index %s: %d samples in %d shards", bucket, idx.info.Samples, idx.info.Shards)
+	p.samples.Lock()
+	if p.samples.m == nil {
+		p.samples.m = make(map[string]*sampleIndex)
+	}
+	p.samples.m[bucket] = idx
+	p.samples.Unlock()
+	return idx, ""
+}
+
+// loadManifests lists the bucket and reads the shard manifests through the
+// proxy's own REST API, on behalf of the requester
+func (p *proxyrunner) loadManifests(bucket, token string) ([]*ExportManifest, error) {
+	entries, err := p.listObjects(bucket, "", "", token)
+	if err != nil {
+		return nil, err
+	}
+	var manifests []*ExportManifest
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name, ".tar"+manifestExt) {
+			continue
+		}
+		b, err := p.selfRequest(http.MethodGet, URLEscapedPath(Rversion, Robjects, bucket, entry.Name), nil, token)
+		if err != nil {
+			return nil, err
+		}
+		manifest := &ExportManifest{}
+		if err = json.Unmarshal(b, manifest); err != nil {
+			return nil, fmt.Errorf("invalid manifest %s: %v", entry.Name, err)
+		}
+		// the shard is the object next to its manifest
+		manifest.Shard = strings.TrimSuffix(entry.Name, manifestExt)
+		manifests = append(manifests, manifest)
+	}
+	return manifests, nil
+}
+
+// listObjects returns all objects of the bucket with the prefix, page by page
+func (p *proxyrunner) listObjects(bucket, prefix, props, token string) ([]*BucketEntry, error) {
+	var (
+		entries []*BucketEntry
+		msg     = &GetMsg{GetPrefix: prefix, GetProps: props}
+	)
+	for {
+		jsbytes, err := json.Marshal(&ActionMsg{Action: ActListObjects, Value: msg})
+		assert(err == nil, err)
+		b, err := p.selfRequest(http.MethodPost, URLPath(Rversion, Rbuckets, bucket), jsbytes, token)
+		if err != nil {
+			return nil, err
+		}
+		list := &BucketList{}
+		if err = json.Unmarshal(b, list); err != nil {
+			return nil, err
+		}
+		entries = append(entries, list.Entries...)
+		if list.PageMarker == "" {
+			return entries, nil
+		}
+		msg.GetPageMarker = list.PageMarker
+	}
+}
+
+// selfRequest sends the request to this proxy; the path must be escaped (see URLEscapedPath)
+func (p *proxyrunner) selfRequest(method, path string, body []byte, token string) ([]byte, error) {
+	return p.requestURL(method, p.si.DirectURL+path, body, token)
+}
+
+// requestURL sends the request on behalf of the requester with the token
+func (p *proxyrunner) requestURL(method, url string, body []byte, token string) ([]byte, error) {
+	request, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		request.Header.Set("Authorization", token)
+	}
+	response, err := p.httpclientLongTimeout.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	if err == nil && response.StatusCode >= http.StatusBadRequest {
+		err = fmt.Errorf("%s %s failed, status %d: %s", method, url, response.StatusCode, string(b))
+	}
+	return b, err
+}
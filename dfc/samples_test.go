@@ -0,0 +1,55 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ */
+package dfc
+
+import (
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSampleIndex(t *testing.T) {
+	manifests := []*ExportManifest{
+		{Shard: "s-1.tar", Objects: []*ExportedObject{
+			{Name: "c.jpg", Offset: 512, Size: 10},
+			{Name: "c.cls", Offset: 1536, Size: 1},
+			{Name: "a.jpg", Offset: 2560, Size: 20}, // duplicate
+		}},
+		{Shard: "s-0.tar", Objects: []*ExportedObject{
+			{Name: "a.jpg", Offset: 512, Size: 20},
+			{Name: "a.cls", Offset: 1536, Size: 1},
+			{Name: "b.jpg", Offset: 2560, Size: 30},
+		}},
+	}
+	idx := newSampleIndex("bucket", manifests)
+	if idx.info.Shards != 2 || idx.info.Samples != 5 {
+		t.Fatalf("Unexpected index %+v", idx.info)
+	}
+	if sample := idx.byname["a.jpg"]; sample == nil || sample.Shard != "s-0.tar" || sample.Offset != 512 {
+		t.Errorf("Unexpected location of a.jpg: %+v", sample)
+	}
+	if sample := idx.byname["c.cls"]; sample == nil || sample.Shard != "s-1.tar" || sample.Offset != 1536 {
+		t.Errorf("Unexpected location of c.cls: %+v", sample)
+	}
+
+	samples := idx.random(2, "jpg", rand.New(rand.NewSource(1)))
+	if len(samples) != 2 || samples[0] == samples[1] {
+		t.Fatalf("Expected 2 distinct samples, got %v", samples)
+	}
+	for _, sample := range samples {
+		if !strings.HasSuffix(sample.Name, ".jpg") {
+			t.Errorf("Unexpected sample %s", sample.Name)
+		}
+	}
+	if again := idx.random(2, ".jpg", rand.New(rand.NewSource(1))); !reflect.DeepEqual(again, samples) {
+		t.Errorf("Expected the same samples with the same seed, got %v and %v", samples, again)
+	}
+	if samples = idx.random(10, ".cls", rand.New(rand.NewSource(1))); len(samples) != 2 {
+		t.Errorf("Expected all 2 .cls samples, got %d", len(samples))
+	}
+	if samples = idx.random(10, "", rand.New(rand.NewSource(1))); len(samples) != 5 {
+		t.Errorf("Expected all 5 samples, got %d", len(samples))
+	}
+}
@@ -0,0 +1,213 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/NVIDIA/dfcpub/3rdparty/glog"
+	"github.com/OneOfOne/xxhash"
+)
+
+// Checksum offload: with cksumconfig.OffloadColdGet, a cold GET that receives
+// a trustworthy hash from the cloud provider - MD5 ETag of a non-multipart S3
+// object, MD5 or CRC32C of a GCS object - stores the object without computing
+// its checksum. Instead, the provider's hash is kept in XattrCloudCksum and the
+// object is queued to the scrubber that verifies it in the background and sets
+// the DFC checksum. An object that fails the verification is removed, so that
+// the next GET fetches it again; an object that does not make it into the
+// queue is verified by the next warm GET with checksum validation.
+
+// Cloud checksum types
+const (
+	CloudCksumMD5    = "md5"
+	CloudCksumCRC32C = "crc32c"
+)
+
+const chscrubSize = 1024
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+type (
+	// cloudCksum is an object hash computed by a cloud provider, hex-encoded
+	cloudCksum struct {
+		kind string // CloudCksumMD5 or CloudCksumCRC32C
+		val  string
+	}
+	scrubrunner struct {
+		namedrunner
+		t      *targetrunner
+		chfqn  chan string
+		chstop chan struct{}
+	}
+)
+
+func newscrubrunner(t *targetrunner) *scrubrunner {
+	return &scrubrunner{
+		t:      t,
+		chfqn:  make(chan string, chscrubSize),
+		chstop: make(chan struct{}, 4),
+	}
+}
+
+func (r *scrubrunner) run() error {
+	glog.Infof("Starting %s", r.name)
+	for {
+		select {
+		case fqn := <-r.chfqn:
+			r.scrub(fqn)
+		case <-r.chstop:
+			return nil
+		}
+	}
+}
+
+func (r *scrubrunner) stop(err error) {
+	glog.Infof("Stopping %s, err: %v", r.name, err)
+	var v struct{}
+	r.chstop <- v
+	close(r.chstop)
+}
+
+// enqueue schedules the verification of the object; never blocks
+func (r *scrubrunner) enqueue(fqn string) {
+	select {
+	case r.chfqn <- fqn:
+	default:
+		glog.Warningf("Scrubber queue is full, %s will be verified upon warm GET", fqn)
+	}
+}
+
+func (r *scrubrunner) scrub(fqn string) {
+	bucket, objname, errstr := r.t.fqn2bckobj(fqn)
+	if errstr != "" {
+		glog.Errorf("Scrubber: %s", errstr)
+		return
+	}
+	uname := uniquename(bucket, objname)
+	r.t.rtnamemap.lockname(uname, false, &pendinginfo{Time: time.Now(), fqn: fqn}, time.Second)
+	ok, errstr := r.t.verifyCloudCksum(fqn)
+	r.t.rtnamemap.unlockname(uname, false)
+	if errstr != "" {
+		glog.Errorf("Scrubber: %s", errstr)
+		return
+	}
+	if !ok {
+		r.t.rtnamemap.lockname(uname, true, &pendinginfo{Time: time.Now(), fqn: fqn}, time.Second)
+		r.t.removeBadCloudCksum(bucket, objname, fqn)
+		r.t.rtnamemap.unlockname(uname, true)
+	}
+}
+
+func (c cloudCksum) String() string {
+	return c.kind + ":" + c.val
+}
+
+func parseCloudCksum(s string) (c cloudCksum, ok bool) {
+	items := strings.SplitN(s, ":", 2)
+	if len(items) != 2 || items[1] == "" {
+		return
+	}
+	c = cloudCksum{kind: items[0], val: items[1]}
+	return c, c.kind == CloudCksumMD5 || c.kind == CloudCksumCRC32C
+}
+
+func (c cloudCksum) newhash() hash.Hash {
+	if c.kind == CloudCksumCRC32C {
+		return crc32.New(crc32cTable)
+	}
+	return md5.New()
+}
+
+// Returns true if the cold GET may skip checksumming and trust the provider's hash
+func offloadCksum(cksum cloudCksum) bool {
+	cksumcfg := &ctx.config.Cksum
+	return cksumcfg.OffloadColdGet && cksumcfg.Checksum != ChecksumNone && cksum.val != ""
+}
+
+// receiveCloud receives the object of a cold GET; with checksum offload, the
+// object is not checksummed and props.cloudcksum is set instead of props.nhobj
+func (t *targetrunner) receiveCloud(fqn, bucket, objname string, cksum cloudCksum, ohobj cksumvalue,
+	reader io.Reader, props *objectProps) (errstr string) {
+	if !offloadCksum(cksum) {
+		var omd5 string
+		if cksum.kind == CloudCksumMD5 {
+			omd5 = cksum.val
+		}
+		_, props.nhobj, props.size, errstr = t.receive(fqn, bucket, objname, omd5, ohobj, reader)
+		return
+	}
+	if props.size, errstr = t.receiveNoCksum(fqn, bucket, objname, reader); errstr == "" {
+		props.cloudcksum = cksum.String()
+	}
+	return
+}
+
+// verifyCloudCksum verifies the object against the provider's hash kept in
+// XattrCloudCksum, if any, and replaces the latter with the DFC checksum.
+// The caller must hold the object's lock
+func (t *targetrunner) verifyCloudCksum(fqn string) (ok bool, errstr string) {
+	val, errstr := Getxattr(fqn, XattrCloudCksum)
+	if errstr != "" || val == nil {
+		return val == nil && errstr == "", errstr
+	}
+	cksum, valid := parseCloudCksum(string(val))
+	if !valid {
+		return false, fmt.Sprintf("Invalid cloud checksum %q of %s", val, fqn)
+	}
+	file, size, err := openObject(fqn)
+	if err != nil {
+		if os.IsNotExist(err) { // evicted or deleted in the meantime
+			return true, ""
+		}
+		return false, fmt.Sprintf("Failed to read object %s, err: %v", fqn, err)
+	}
+	slab := selectslab(size)
+	buf, xx, h := slab.alloc(), xxhash.New64(), cksum.newhash()
+	_, errstr = ReceiveAndChecksum(ioutil.Discard, file, buf, xx, h)
+	file.Close()
+	slab.free(buf)
+	if errstr != "" {
+		return false, errstr
+	}
+	if hex.EncodeToString(h.Sum(nil)) != cksum.val {
+		return false, ""
+	}
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, xx.Sum64())
+	if errstr = Setxattr(fqn, XattrXXHashVal, []byte(hex.EncodeToString(b))); errstr != "" {
+		return false, errstr
+	}
+	return true, Deletexattr(fqn, XattrCloudCksum)
+}
+
+// removeBadCloudCksum removes the object that does not match the provider's
+// hash; the caller must hold the object's exclusive lock
+func (t *targetrunner) removeBadCloudCksum(bucket, objname, fqn string) {
+	finfo, err := os.Stat(fqn)
+	if err != nil {
+		return
+	}
+	// the object might have been replaced while unlocked
+	if val, _ := Getxattr(fqn, XattrCloudCksum); val == nil {
+		return
+	}
+	glog.Errorf("Bad checksum: %s/%s does not match the cloud checksum, removing %s", bucket, objname, fqn)
+	if err = os.Remove(fqn); err != nil {
+		glog.Errorf("Failed to remove %s, err: %v", fqn, err)
+	}
+	t.statsif.addMany("numbadchecksum", int64(1), "bytesbadchecksum", finfo.Size())
+}
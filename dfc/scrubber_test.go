@@ -0,0 +1,88 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ */
+package dfc
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestChecksumOffload(t *testing.T) {
+	const bucket = "mockbucket"
+	dir, err := ioutil.TempDir("", "scrubber")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	oldcfg := ctx.config.Cksum
+	defer func() { ctx.config.Cksum = oldcfg }()
+	ctx.config.Cksum.Checksum = ChecksumXXHash
+	ctx.config.Cksum.OffloadColdGet = true
+
+	target := &targetrunner{}
+	target.bmdowner = &bmdowner{}
+	target.bmdowner.put(newBucketMD())
+	m := newMockCloud(target, bucket)
+	ct := context.Background()
+	data := []byte("The quick brown fox jumps over the lazy dog")
+	if _, cerr := m.putobj(ct, bytes.NewReader(data), bucket, "obj", nil); cerr != nil {
+		t.Fatal(cerr)
+	}
+
+	fqn := filepath.Join(dir, "obj")
+	props, cerr := m.getobj(ct, fqn, bucket, "obj")
+	if cerr != nil {
+		t.Fatal(cerr)
+	}
+	if props.nhobj != nil || props.cloudcksum != CloudCksumMD5+":9e107d9d372bb6826bd81d3542a419d6" {
+		t.Fatalf("Expected the object not to be checksummed, got %+v", props)
+	}
+	if errstr := target.finalizeobj(fqn, props); errstr != "" {
+		t.Skipf("Extended attributes are not supported: %s", errstr)
+	}
+
+	ok, errstr := target.verifyCloudCksum(fqn)
+	if !ok || errstr != "" {
+		t.Fatalf("Expected the object to pass verification, got %v, %s", ok, errstr)
+	}
+	if val, _ := Getxattr(fqn, XattrCloudCksum); val != nil {
+		t.Errorf("Expected the cloud checksum to be removed, got %q", val)
+	}
+	if val, _ := Getxattr(fqn, XattrXXHashVal); val == nil {
+		t.Error("Expected the object to have the DFC checksum")
+	}
+
+	// corrupted object
+	if err = ioutil.WriteFile(fqn, []byte("The quick brown fox jumps over the lazy cat"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if errstr = Setxattr(fqn, XattrCloudCksum, []byte(props.cloudcksum)); errstr != "" {
+		t.Fatal(errstr)
+	}
+	if ok, errstr = target.verifyCloudCksum(fqn); ok || errstr != "" {
+		t.Errorf("Expected the corrupted object to fail verification, got %v, %s", ok, errstr)
+	}
+
+	// crc32c
+	cksum, valid := parseCloudCksum(CloudCksumCRC32C + ":22620404")
+	h := cksum.newhash()
+	h.Write(data)
+	if !valid || hex.EncodeToString(h.Sum(nil)) != cksum.val {
+		t.Errorf("Unexpected crc32c checksum %+v: %x", cksum, h.Sum(nil))
+	}
+
+	// without offload, cold GET is checksummed
+	ctx.config.Cksum.OffloadColdGet = false
+	if props, cerr = m.getobj(ct, fqn, bucket, "obj"); cerr != nil {
+		t.Fatal(cerr)
+	}
+	if props.nhobj == nil || props.cloudcksum != "" {
+		t.Errorf("Expected the object to be checksummed, got %+v", props)
+	}
+}
@@ -0,0 +1,229 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/NVIDIA/dfcpub/3rdparty/glog"
+)
+
+// Secrets providers: where sensitive configuration is fetched from instead
+// of the configuration file
+const (
+	SecretsProviderFile  = "file"    // JSON file with name-value pairs, e.g, mounted by orchestrator
+	SecretsProviderEnv   = "env"     // environment variables DFC_SECRET_<NAME>, e.g DFC_SECRET_AUTH_SECRET
+	SecretsProviderVault = "vault"   // HashiCorp Vault KV secrets engine (v1 or v2)
+	SecretsProviderAWS   = "aws_kms" // JSON file with values encrypted by AWS KMS, see kms.go
+	SecretsProviderGCP   = "gcp_kms" // JSON file with values encrypted by GCP Cloud KMS, ditto
+)
+
+// Secret names
+const (
+	SecretAuth      = "auth_secret"       // overrides Auth.Secret - the key to sign and verify tokens
+	SecretTLSCert   = "tls_certificate"   // PEM encoded certificate, overrides Net.HTTP.Certificate
+	SecretTLSKey    = "tls_key"           // PEM encoded key, overrides Net.HTTP.Key
+	SecretObjectKey = "object_master_key" // base64 encoded 32-byte key to encrypt data keys of cached objects
+)
+
+const (
+	secretsEnvPrefix   = "DFC_SECRET_"
+	vaultTokenEnvVar   = "VAULT_TOKEN"
+	vaultTokenHeader   = "X-Vault-Token"
+	secretsHTTPTimeout = 30 * time.Second
+)
+
+type secretsKeeper struct {
+	namedrunner
+	sync.RWMutex
+	config  *secretsconf
+	secrets simplekvs
+	cert    *tls.Certificate
+	chStop  chan struct{}
+}
+
+func newSecretsKeeper(conf *secretsconf) *secretsKeeper {
+	return &secretsKeeper{
+		config: conf,
+		chStop: make(chan struct{}, 4),
+	}
+}
+
+// FetchSecrets reads all secrets from a secrets provider. For file provider
+// path is the path to JSON file, for vault it is the secret path (e.g,
+// "secret/data/dfc") and url is Vault address. Vault token is read
+// from VAULT_TOKEN environment variable. For KMS providers path is the path
+// to JSON file with encrypted values, url is AWS region or GCP key name
+func FetchSecrets(provider, url, path string) (map[string]string, error) {
+	switch provider {
+	case SecretsProviderFile:
+		secrets := make(map[string]string)
+		if err := LocalLoad(path, &secrets); err != nil {
+			return nil, fmt.Errorf("Failed to load secrets from %s: %v", path, err)
+		}
+		return secrets, nil
+	case SecretsProviderEnv:
+		secrets := make(map[string]string)
+		for _, kv := range os.Environ() {
+			if !strings.HasPrefix(kv, secretsEnvPrefix) {
+				continue
+			}
+			pair := strings.SplitN(strings.TrimPrefix(kv, secretsEnvPrefix), "=", 2)
+			if len(pair) == 2 {
+				secrets[strings.ToLower(pair[0])] = pair[1]
+			}
+		}
+		return secrets, nil
+	case SecretsProviderVault:
+		return fetchVaultSecrets(url, path)
+	case SecretsProviderAWS:
+		return fetchAWSKMSSecrets(url, path)
+	case SecretsProviderGCP:
+		return fetchGCPKMSSecrets(url, path)
+	default:
+		return nil, fmt.Errorf("Invalid secrets provider: %s", provider)
+	}
+}
+
+// Reads a secret from Vault KV secrets engine. Supports both versions of
+// the engine: v1 returns secret values in "data", v2 - in "data.data"
+func fetchVaultSecrets(url, path string) (map[string]string, error) {
+	var resp struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	reqURL := strings.TrimSuffix(url, "/") + "/v1/" + strings.TrimPrefix(path, "/")
+	req, err := http.NewRequest(http.MethodGet, reqURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(vaultTokenHeader, os.Getenv(vaultTokenEnvVar))
+	client := &http.Client{Timeout: secretsHTTPTimeout}
+	r, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read secrets from %s: %v", reqURL, err)
+	}
+	b, err := ioutil.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read secrets from %s: %v", reqURL, err)
+	}
+	if r.StatusCode >= http.StatusBadRequest {
+		return nil, fmt.Errorf("Failed to read secrets from %s: status %d", reqURL, r.StatusCode)
+	}
+	if err = json.Unmarshal(b, &resp); err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal secrets from %s: %v", reqURL, err)
+	}
+
+	data := resp.Data
+	if inner, ok := data["data"].(map[string]interface{}); ok {
+		data = inner
+	}
+	secrets := make(map[string]string, len(data))
+	for name, value := range data {
+		if s, ok := value.(string); ok {
+			secrets[name] = s
+		}
+	}
+	return secrets, nil
+}
+
+// Fetches secrets from the provider and applies them. On error the
+// previously loaded secrets stay in use
+func (k *secretsKeeper) load() error {
+	secrets, err := FetchSecrets(k.config.Provider, k.config.URL, k.config.Path)
+	if err != nil {
+		return err
+	}
+
+	var cert *tls.Certificate
+	certPEM, keyPEM := secrets[SecretTLSCert], secrets[SecretTLSKey]
+	if certPEM != "" || keyPEM != "" {
+		pair, err := tls.X509KeyPair([]byte(certPEM), []byte(keyPEM))
+		if err != nil {
+			return fmt.Errorf("Invalid TLS certificate or key: %v", err)
+		}
+		cert = &pair
+	}
+
+	k.Lock()
+	updated := k.secrets != nil && k.secrets[SecretAuth] != secrets[SecretAuth]
+	k.secrets = secrets
+	if cert != nil {
+		k.cert = cert
+	}
+	k.Unlock()
+	if updated {
+		glog.Infof("%s: %s has been updated", k.name, SecretAuth)
+	}
+	return nil
+}
+
+func (k *secretsKeeper) run() error {
+	glog.Infof("Starting %s", k.name)
+	if k.config.Refresh == 0 {
+		<-k.chStop
+		return nil
+	}
+	ticker := time.NewTicker(k.config.Refresh)
+	for {
+		select {
+		case <-ticker.C:
+			if err := k.load(); err != nil {
+				glog.Errorf("Failed to refresh secrets: %v", err)
+			}
+		case <-k.chStop:
+			ticker.Stop()
+			return nil
+		}
+	}
+}
+
+func (k *secretsKeeper) stop(err error) {
+	glog.Infof("Stopping %s, err: %v", k.name, err)
+	var v struct{}
+	k.chStop <- v
+	close(k.chStop)
+}
+
+func (k *secretsKeeper) get(name string) string {
+	k.RLock()
+	value := k.secrets[name]
+	k.RUnlock()
+	return value
+}
+
+func (k *secretsKeeper) hasCertificate() bool {
+	k.RLock()
+	defer k.RUnlock()
+	return k.cert != nil
+}
+
+// tls.Config callback: the certificate can be replaced on refresh without
+// restarting the server
+func (k *secretsKeeper) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	k.RLock()
+	defer k.RUnlock()
+	return k.cert, nil
+}
+
+// Returns the key to sign and verify tokens: from secrets provider if it is
+// configured and the secret is defined, or from configuration file otherwise
+func authSecret() string {
+	if k := getsecretskeeper(); k != nil {
+		if secret := k.get(SecretAuth); secret != "" {
+			return secret
+		}
+	}
+	return ctx.config.Auth.Secret
+}
@@ -0,0 +1,87 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ */
+package dfc
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFetchSecrets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secrets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "secrets.json")
+	if err = LocalSave(path, map[string]string{SecretAuth: "fileSecret"}); err != nil {
+		t.Fatal(err)
+	}
+	secrets, err := FetchSecrets(SecretsProviderFile, "", path)
+	if err != nil {
+		t.Fatalf("Failed to read secrets from file: %v", err)
+	}
+	if secrets[SecretAuth] != "fileSecret" {
+		t.Errorf("Expected %s=fileSecret, got %q", SecretAuth, secrets[SecretAuth])
+	}
+	if _, err = FetchSecrets(SecretsProviderFile, "", filepath.Join(dir, "absent.json")); err == nil {
+		t.Error("Reading secrets from absent file must fail")
+	}
+
+	os.Setenv("DFC_SECRET_AUTH_SECRET", "envSecret")
+	defer os.Unsetenv("DFC_SECRET_AUTH_SECRET")
+	if secrets, err = FetchSecrets(SecretsProviderEnv, "", ""); err != nil {
+		t.Fatalf("Failed to read secrets from environment: %v", err)
+	}
+	if secrets[SecretAuth] != "envSecret" {
+		t.Errorf("Expected %s=envSecret, got %q", SecretAuth, secrets[SecretAuth])
+	}
+
+	if _, err = FetchSecrets("unknown", "", ""); err == nil {
+		t.Error("Unknown secrets provider must fail")
+	}
+}
+
+func TestDecryptSecrets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the fake KMS "encrypts" by prefixing
+	const prefix = "kms:"
+	decrypt := func(ciphertext []byte) ([]byte, error) {
+		if len(ciphertext) < len(prefix) || string(ciphertext[:len(prefix)]) != prefix {
+			return nil, fmt.Errorf("invalid ciphertext")
+		}
+		return ciphertext[len(prefix):], nil
+	}
+	path := filepath.Join(dir, "secrets.json")
+	encrypted := map[string]string{SecretAuth: base64.StdEncoding.EncodeToString([]byte(prefix + "kmsSecret"))}
+	if err = LocalSave(path, encrypted); err != nil {
+		t.Fatal(err)
+	}
+	secrets, err := decryptSecrets(path, decrypt)
+	if err != nil {
+		t.Fatalf("Failed to decrypt secrets: %v", err)
+	}
+	if secrets[SecretAuth] != "kmsSecret" {
+		t.Errorf("Expected %s=kmsSecret, got %q", SecretAuth, secrets[SecretAuth])
+	}
+
+	for _, value := range []string{"not base64!", base64.StdEncoding.EncodeToString([]byte("plain"))} {
+		if err = LocalSave(path, map[string]string{SecretAuth: value}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = decryptSecrets(path, decrypt); err == nil {
+			t.Errorf("Decrypting %q must fail", value)
+		}
+	}
+}
@@ -0,0 +1,306 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/NVIDIA/dfcpub/3rdparty/glog"
+	"github.com/OneOfOne/xxhash"
+)
+
+// Cluster self-test. Upon PUT {"action": "selftest"} /v1/cluster the primary
+// proxy:
+// - asks each target to write, read back, verify and remove a canary file on
+//   each of its mountpaths;
+// - creates a temporary local bucket, and PUTs, GETs and DELETEs a canary
+//   object stored on each target, validating the object's checksum;
+// - for each of the given cloud buckets, PUTs a canary object, evicts it,
+//   reads it back via cold GET, and DELETEs it.
+// The response is a SelfTestReport: a pass/fail result per check.
+
+const (
+	selfTestSize   = MiB
+	selfTestPrefix = "__selftest"
+)
+
+func parseSelfTestMsg(msg *ActionMsg) (*SelfTestMsg, error) {
+	testmsg := &SelfTestMsg{}
+	if msg.Value != nil {
+		b, err := json.Marshal(msg.Value)
+		if err == nil {
+			err = json.Unmarshal(b, testmsg)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Invalid self-test parameters %v, err: %v", msg.Value, err)
+		}
+	}
+	if testmsg.Size < 0 {
+		return nil, fmt.Errorf("Invalid self-test object size %d", testmsg.Size)
+	}
+	if testmsg.Size == 0 {
+		testmsg.Size = selfTestSize
+	}
+	return testmsg, nil
+}
+
+//
+// target
+//
+
+// PUT {"action": "selftest"} /v1/daemon
+func (t *targetrunner) httpselftest(w http.ResponseWriter, r *http.Request, msg *ActionMsg) {
+	testmsg, err := parseSelfTestMsg(msg)
+	if err != nil {
+		t.invalmsghdlr(w, r, err.Error())
+		return
+	}
+	jsbytes, err := json.Marshal(t.selfTestMpaths(testmsg.Size))
+	assert(err == nil, err)
+	t.writeJSON(w, r, jsbytes, "selftest")
+}
+
+func (t *targetrunner) selfTestMpaths(size int64) (checks []*SelfTestCheck) {
+	data := make([]byte, size)
+	rand.Read(data)
+	for mpath := range ctx.mountpaths.Available {
+		started := time.Now()
+		check := &SelfTestCheck{Name: SelfTestMountpath, Target: t.si.DaemonID, Mountpath: mpath}
+		if err := selfTestFile(filepath.Join(mpath, mpathWorkDir, selfTestPrefix), data); err != nil {
+			check.Error = err.Error()
+		}
+		checks = append(checks, check.done(started))
+	}
+	return
+}
+
+func selfTestFile(fqn string, data []byte) error {
+	if err := CreateDir(filepath.Dir(fqn)); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(fqn, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(fqn)
+	if _, err = file.Write(data); err == nil {
+		err = file.Sync()
+	}
+	if errc := file.Close(); err == nil {
+		err = errc
+	}
+	if err != nil {
+		return err
+	}
+	read, err := ioutil.ReadFile(fqn)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(read, data) {
+		return fmt.Errorf("data read back from %s differs from the data written", fqn)
+	}
+	return os.Remove(fqn)
+}
+
+//
+// proxy
+//
+
+// PUT {"action": "selftest"} /v1/cluster
+func (p *proxyrunner) httpselftest(w http.ResponseWriter, r *http.Request, msg *ActionMsg) {
+	if !p.checkPrimaryProxy("run self-test", w, r) {
+		return
+	}
+	testmsg, err := parseSelfTestMsg(msg)
+	if err != nil {
+		p.invalmsghdlr(w, r, err.Error())
+		return
+	}
+	report := p.selfTest(testmsg, r.Header.Get("Authorization"))
+	jsbytes, err := json.Marshal(report)
+	assert(err == nil, err)
+	p.writeJSON(w, r, jsbytes, "selftest")
+}
+
+func (p *proxyrunner) selfTest(testmsg *SelfTestMsg, token string) *SelfTestReport {
+	var (
+		report = &SelfTestReport{}
+		smap   = p.smapowner.get()
+		data   = make([]byte, testmsg.Size)
+	)
+	rand.Read(data)
+	cksum, _ := ComputeXXHash(bytes.NewReader(data), nil, xxhash.New64())
+
+	// mountpaths
+	jsbytes, err := json.Marshal(&ActionMsg{Action: ActSelfTest, Value: testmsg})
+	assert(err == nil, err)
+	results := p.broadcastTargets(URLPath(Rversion, Rdaemon), nil, http.MethodPut, jsbytes, smap,
+		ctx.config.Timeout.DefaultLong)
+	for res := range results {
+		var checks []*SelfTestCheck
+		if res.err == nil {
+			res.err = json.Unmarshal(res.outjson, &checks)
+		}
+		if res.err != nil {
+			checks = []*SelfTestCheck{{Name: SelfTestMountpath, Target: res.si.DaemonID,
+				Error: fmt.Sprintf("%v, %s", res.err, res.errstr)}}
+		}
+		report.Checks = append(report.Checks, checks...)
+	}
+
+	// objects, through each target
+	bucket := selfTestPrefix + strconv.FormatInt(time.Now().UnixNano(), 16)
+	if errstr := p.createLocalBucket(bucket, &ActionMsg{Action: ActCreateLB}); errstr != "" {
+		for sid := range smap.Tmap {
+			report.Checks = append(report.Checks,
+				&SelfTestCheck{Name: SelfTestObject, Target: sid, Bucket: bucket, Error: errstr})
+		}
+	} else {
+		objnames := hrwObjnames(bucket, selfTestPrefix, smap)
+		for sid := range smap.Tmap {
+			started := time.Now()
+			check := &SelfTestCheck{Name: SelfTestObject, Target: sid, Bucket: bucket}
+			if objname, ok := objnames[sid]; ok {
+				check.Error = p.selfTestObject(bucket, objname, data, cksum, token, false /*evict*/)
+			} else {
+				check.Error = "failed to find an object name that maps to the target"
+			}
+			report.Checks = append(report.Checks, check.done(started))
+		}
+		if errstr := p.destroyLocalBucket(bucket, &ActionMsg{Action: ActDestroyLB}); errstr != "" {
+			glog.Errorf("Self-test: %s", errstr)
+		}
+	}
+
+	// cold GET
+	bucketmd := p.bmdowner.get()
+	for _, bucket := range testmsg.CloudBuckets {
+		started := time.Now()
+		check := &SelfTestCheck{Name: SelfTestColdGet, Bucket: bucket, Provider: ctx.config.CloudProvider}
+		if _, props := bucketmd.get(bucket, false); props.CloudProvider != "" {
+			check.Provider = props.CloudProvider
+		}
+		objname := selfTestPrefix + "/" + strconv.FormatInt(time.Now().UnixNano(), 16)
+		if si, errstr := HrwTarget(bucket, objname, smap); errstr == "" {
+			check.Target = si.DaemonID
+		}
+		if bucketmd.islocal(bucket) {
+			check.Error = fmt.Sprintf("%s is a local bucket", bucket)
+		} else {
+			check.Error = p.selfTestObject(bucket, objname, data, cksum, token, true /*evict*/)
+		}
+		report.Checks = append(report.Checks, check.done(started))
+	}
+
+	report.Passed = true
+	for _, check := range report.Checks {
+		if !check.Passed {
+			report.Passed = false
+		}
+	}
+	sort.Slice(report.Checks, func(i, j int) bool {
+		a, b := report.Checks[i], report.Checks[j]
+		if a.Name != b.Name {
+			return a.Name > b.Name // mountpath, object, coldget
+		}
+		if a.Target != b.Target {
+			return a.Target < b.Target
+		}
+		return a.Mountpath+a.Bucket < b.Mountpath+b.Bucket
+	})
+	return report
+}
+
+// done sets the check's result and duration
+func (check *SelfTestCheck) done(started time.Time) *SelfTestCheck {
+	check.Passed = check.Error == ""
+	check.Duration = time.Since(started)
+	return check
+}
+
+// hrwObjnames returns, for each target, the name of an object stored on it
+func hrwObjnames(bucket, prefix string, smap *Smap) map[string]string {
+	objnames := make(map[string]string, len(smap.Tmap))
+	for i := 0; len(objnames) < len(smap.Tmap) && i < 1000*len(smap.Tmap); i++ {
+		objname := prefix + "/" + strconv.Itoa(i)
+		si, errstr := HrwTarget(bucket, objname, smap)
+		if errstr != "" {
+			break
+		}
+		if _, ok := objnames[si.DaemonID]; !ok {
+			objnames[si.DaemonID] = objname
+		}
+	}
+	return objnames
+}
+
+// selfTestObject PUTs the object, optionally evicts it, GETs and validates it,
+// and DELETEs it
+func (p *proxyrunner) selfTestObject(bucket, objname string, data []byte, cksum, token string, evict bool) (errstr string) {
+	url := p.si.DirectURL + URLEscapedPath(Rversion, Robjects, bucket, objname)
+	do := func(method string, body []byte, header http.Header) (*http.Response, []byte, error) {
+		request, err := http.NewRequest(method, url, bytes.NewReader(body))
+		if err != nil {
+			return nil, nil, err
+		}
+		for key, values := range header {
+			request.Header[key] = values
+		}
+		if token != "" {
+			request.Header.Set("Authorization", token)
+		}
+		response, err := p.httpclientLongTimeout.Do(request)
+		if err != nil {
+			return nil, nil, err
+		}
+		b, err := ioutil.ReadAll(response.Body)
+		response.Body.Close()
+		if err == nil && response.StatusCode >= http.StatusBadRequest {
+			err = fmt.Errorf("%s failed, status %d: %s", method, response.StatusCode, string(b))
+		}
+		return response, b, err
+	}
+	header := http.Header{}
+	header.Set(HeaderDfcChecksumType, ChecksumXXHash)
+	header.Set(HeaderDfcChecksumVal, cksum)
+	if _, _, err := do(http.MethodPut, data, header); err != nil {
+		return fmt.Sprintf("PUT %s/%s: %v", bucket, objname, err)
+	}
+	defer func() {
+		if _, _, err := do(http.MethodDelete, nil, nil); err != nil && errstr == "" {
+			errstr = fmt.Sprintf("DELETE %s/%s: %v", bucket, objname, err)
+		}
+	}()
+	if evict {
+		jsbytes, err := json.Marshal(&ActionMsg{Action: ActEvict})
+		assert(err == nil, err)
+		if _, _, err = do(http.MethodDelete, jsbytes, nil); err != nil {
+			return fmt.Sprintf("evict %s/%s: %v", bucket, objname, err)
+		}
+	}
+	response, read, err := do(http.MethodGet, nil, nil)
+	if err != nil {
+		return fmt.Sprintf("GET %s/%s: %v", bucket, objname, err)
+	}
+	if !bytes.Equal(read, data) {
+		return fmt.Sprintf("GET %s/%s: data differs from the data written (%d/%d bytes)",
+			bucket, objname, len(read), len(data))
+	}
+	if htype, hval := response.Header.Get(HeaderDfcChecksumType), response.Header.Get(HeaderDfcChecksumVal); htype == ChecksumXXHash && hval != cksum {
+		return fmt.Sprintf("GET %s/%s: checksum %s, expected %s", bucket, objname, hval, cksum)
+	}
+	return
+}
@@ -0,0 +1,73 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ */
+package dfc
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestSelfTest(t *testing.T) {
+	testmsg, err := parseSelfTestMsg(&ActionMsg{Action: ActSelfTest})
+	if err != nil || testmsg.Size != selfTestSize {
+		t.Errorf("Expected the default self-test size %d, got %+v, err: %v", selfTestSize, testmsg, err)
+	}
+	msg := &ActionMsg{Action: ActSelfTest, Value: map[string]interface{}{"size": 4096, "cloud_buckets": []string{"b"}}}
+	if testmsg, err = parseSelfTestMsg(msg); err != nil || testmsg.Size != 4096 || len(testmsg.CloudBuckets) != 1 {
+		t.Errorf("Unexpected self-test parameters %+v, err: %v", testmsg, err)
+	}
+	if _, err = parseSelfTestMsg(&ActionMsg{Action: ActSelfTest, Value: map[string]interface{}{"size": -1}}); err == nil {
+		t.Error("Expected negative self-test size to be invalid")
+	}
+
+	// mountpaths: one of them is not writable
+	dir, err := ioutil.TempDir("", "selftest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	good, bad := filepath.Join(dir, "mp1"), filepath.Join(dir, "mp2")
+	if err = ioutil.WriteFile(bad, []byte("not a directory"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	oldavail := ctx.mountpaths.Available
+	defer func() { ctx.mountpaths.Available = oldavail }()
+	ctx.mountpaths.Available = map[string]*mountPath{good: {Path: good}, bad: {Path: bad}}
+
+	target := &targetrunner{}
+	target.si = &daemonInfo{DaemonID: "t1"}
+	checks := target.selfTestMpaths(4096)
+	if len(checks) != 2 {
+		t.Fatalf("Expected 2 mountpath checks, got %d", len(checks))
+	}
+	for _, check := range checks {
+		if check.Name != SelfTestMountpath || check.Target != "t1" {
+			t.Errorf("Unexpected check %+v", check)
+		}
+		if passed := check.Mountpath == good; check.Passed != passed || (check.Error == "") != passed {
+			t.Errorf("Expected mountpath %s check passed=%t, got %+v", check.Mountpath, passed, check)
+		}
+	}
+	if _, err = os.Stat(filepath.Join(good, mpathWorkDir, selfTestPrefix)); !os.IsNotExist(err) {
+		t.Errorf("Expected the self-test file to be removed, err: %v", err)
+	}
+
+	// an object name for each target
+	smap := newSmap()
+	for i := 0; i < 10; i++ {
+		smap.addTarget(&daemonInfo{DaemonID: "t" + strconv.Itoa(i)})
+	}
+	objnames := hrwObjnames("bucket", selfTestPrefix, smap)
+	if len(objnames) != len(smap.Tmap) {
+		t.Fatalf("Expected an object name for each of the %d targets, got %v", len(smap.Tmap), objnames)
+	}
+	for sid, objname := range objnames {
+		if si, errstr := HrwTarget("bucket", objname, smap); errstr != "" || si.DaemonID != sid {
+			t.Errorf("Object %s does not map to target %s", objname, sid)
+		}
+	}
+}
@@ -20,7 +20,20 @@ cat > $CONFFILE <<EOL
 		"secret": "$SECRETKEY",
 		"username": "$AUTH_SU_NAME",
 		"password": "$AUTH_SU_PASS",
-		"expiration_time": "30m"
+		"expiration_time": "30m",
+		"apikey_expiration_time": "8760h",
+		"max_expiration_time": "",
+		"roles": {},
+		"signing_method": "HS256",
+		"private_key": "",
+		"time_format": "RFC3339Nano",
+		"password_cost": 10
+	},
+	"secrets": {
+		"provider": "",
+		"url": "",
+		"path": "",
+		"refresh_time": "0s"
 	},
 	"timeout": {
 		"default_timeout": "30s"
@@ -4,6 +4,7 @@
 	"cloudprovider":		"${CLDPROVIDER}",
 	"cloud_buckets":		"cloud",
 	"local_buckets":		"local",
+	"time_format":		"RFC3339Nano",
 	"log": {
 		"logdir":		"$LOGDIR",
 		"loglevel": 		"${LOGLEVEL}",
@@ -12,7 +13,8 @@
 	},
 	"periodic": {
 		"stats_time":		"10s",
-		"retry_sync_time":	"2s"
+		"retry_sync_time":	"2s",
+		"stats_history":	0
 	},
 	"timeout": {
 		"default_timeout":	"30s",
@@ -33,7 +35,8 @@
 			"id":		"${PROXYID}",
 			"url": 		"${PROXYURL}",
 			"passthru": 	true
-		}
+		},
+		"fencing":	false
 	},
 	"lru_config": {
 		"lowwm":		75,
@@ -52,7 +55,8 @@
                  "checksum":                    "xxhash",
                  "validate_checksum_cold_get":  true,
                  "validate_checksum_warm_get":  false,
-                 "enable_read_range_checksum":  false
+                 "enable_read_range_checksum":  false,
+                 "offload_checksum_cold_get":   false
 	},
 	"version_config": {
 		"validate_version_warm_get":    false,
@@ -68,6 +72,8 @@
 	},
 	"netconfig": {
 		"ipv4": "$IPV4LIST",
+		"ipv6": "$IPV6LIST",
+		"family": "${NETFAMILY:-ipv4}",
 		"l4": {
 			"proto": 	"tcp",
 			"port":		"${PORT}"
@@ -78,7 +84,28 @@
 			"use_http2":          false,
 			"use_as_proxy":       false,
 			"server_certificate": "server.crt",
-			"server_key":         "server.key"
+			"server_key":         "server.key",
+			"pool": {
+				"per_peer":                false,
+				"max_idle_conns_per_peer": 0,
+				"dial_timeout":            "30s",
+				"tls_handshake_timeout":   "10s",
+				"response_header_timeout": "",
+				"idle_conn_timeout":       "90s"
+			}
+		},
+		"external": {
+			"host":     "",
+			"port":     "",
+			"discover": false
+		},
+		"intra_control": {
+			"addrs": "",
+			"port":  "$INTRA_CONTROL_PORT"
+		},
+		"intra_data": {
+			"addrs": "",
+			"port":  "$INTRA_DATA_PORT"
 		}
 	},
 	"fskeeper": {
@@ -89,7 +116,95 @@
 	"auth": {
 		"secret": "$SECRETKEY",
 		"enabled": $AUTHENABLED,
-		"creddir": "$CREDDIR"
+		"creddir": "$CREDDIR",
+		"max_token_lifetime": "",
+		"authn_url": ""
+	},
+	"secrets": {
+		"provider": "",
+		"url": "",
+		"path": "",
+		"refresh_time": "0s"
+	},
+	"coldget": {
+		"part_size":	67108864,
+		"concurrency":	8
+	},
+	"commit": {
+		"fsync":	"never"
+	},
+	"direct_io": {
+		"threshold":	0
+	},
+	"placement": {
+		"max_used_pct":	0
+	},
+	"alerts": {
+		"interval":	"",
+		"rules":	[],
+		"webhooks":	[],
+		"smtp":		"",
+		"from":		"",
+		"to":		[]
+	},
+	"probe": {
+		"interval":	"",
+		"size":		0,
+		"window":	0
+	},
+	"smap_sync": {
+		"delta":		true,
+		"compress_size":	65536
+	},
+	"cloud_egress": {
+		"budget":	0,
+		"soft_pct":	80,
+		"refuse":	false
+	},
+	"prefetch_plan": {
+		"request_cost":		0.0004,
+		"egress_cost":		0.09,
+		"confirm_threshold":	0
+	},
+	"zerocopy": {
+		"socket":	""
+	},
+	"metacache": {
+		"ttl":		"",
+		"max_entries":	10000
+	},
+	"destroy": {
+		"grace":	""
+	},
+	"next_tier": {
+		"failures":		5,
+		"probe_interval":	"10s"
+	},
+	"cloud_breaker": {
+		"failures":		5,
+		"probe_interval":	"10s",
+		"serve_stale":		false
+	},
+	"negcache": {
+		"ttl":		"",
+		"max_entries":	10000
+	},
+	"pin": {
+		"capacity":	0
+	},
+	"publish": {
+		"keep":		2
+	},
+	"objname": {
+		"max_length":	1024,
+		"charset":	"printable",
+		"normalize":	"",
+		"slashes":	"allow",
+		"legacy_escaped":	true
+	},
+	"summary": {
+		"workers":	0,
+		"cache_time":	""
 	},
 	"keepalivetracker": {
 		"proxy": {
@@ -103,6 +218,14 @@
 			"name": "heartbeat",
 			"max": "20s",
 			"factor": 3
+		},
+		"gossip": {
+			"enabled": false,
+			"interval": "2s",
+			"fanout": 3,
+			"suspect_time": "30s",
+			"confirmations": 3,
+			"primary_interval": "60s"
 		}
 	},
 	"callstats": {
@@ -4,6 +4,8 @@
 #
 # Usage: deploy.sh [-loglevel=0|1|2|3] [-statstime=<DURATION>]
 #
+# To run the targets against the built-in fake S3 instead of the cloud, set FAKES3=<directory>.
+#
 # To deploy DFC with code coverage enabled, set ENABLE_CODE_COVERAGE=1.
 # After runs, to collect code coverage data:
 # 1. run: make kill
@@ -122,6 +124,9 @@ do
 	LOGDIR="$LOGROOT/$c/log"
 	source $DIR/config.sh
 	((PORT++))
+	# separate intra-cluster networks, if requested, get a port per daemon as well
+	if [ -n "$INTRA_CONTROL_PORT" ]; then ((INTRA_CONTROL_PORT++)); fi
+	if [ -n "$INTRA_DATA_PORT" ]; then ((INTRA_DATA_PORT++)); fi
 done
 
 # conf file for authn
@@ -139,7 +144,8 @@ BUILD=`git rev-parse --short HEAD`
 if [ "$ENABLE_CODE_COVERAGE" == "" ]
 then
 	EXE=$GOPATH/bin/dfc
-	go build && go install && GOBIN=$GOPATH/bin go install -ldflags "-X github.com/NVIDIA/dfcpub/dfc.build=$BUILD" setup/dfc.go
+	# BUILD_TAGS=debug enables failure injection (see dfc/faults.go)
+	go build && go install && GOBIN=$GOPATH/bin go install -tags "$BUILD_TAGS" -ldflags "-X github.com/NVIDIA/dfcpub/dfc.build=$BUILD" setup/dfc.go
 else
 	EXE=$GOPATH/bin/dfc_coverage.test
 	rm $LOGROOT/*.cov
@@ -162,6 +168,10 @@ do
 
 	PROXY_PARAM="-config=$CONFFILE -role=proxy -ntargets=$servcount $1 $2"
 	TARGET_PARAM="-config=$CONFFILE -role=target $1 $2"
+	if [ "$FAKES3" != "" ]
+	then
+		TARGET_PARAM="$TARGET_PARAM -fakes3=$FAKES3"
+	fi
 	if [ "$ENABLE_CODE_COVERAGE" == "" ]
 	then
 		CMD=$EXE
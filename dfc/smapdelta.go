@@ -0,0 +1,155 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// ============================= Smap delta ==================================
+// With hundreds of nodes the full Smap is a heavy payload to send to every
+// node on every membership change. When enabled (see smapsyncconf) the
+// metasyncer sends, instead, the changes since the previously sync-ed Smap:
+// added (or updated) and removed targets and proxies. A receiver applies
+// the delta to its local Smap if and only if the latter is the version the
+// delta is based on; otherwise it responds with http.StatusPreconditionFailed
+// and the metasyncer falls back to sending the full Smap to this receiver.
+//
+// Separately, metasync payloads larger than the configured size are gzip-ed
+// on the wire.
+// ============================= Smap delta ==================================
+
+const smapdeltatag = "smapdeltatag"
+
+// gzip stream starts with these two bytes; JSON never does
+var gzipMagic = []byte{0x1f, 0x8b}
+
+type smapDelta struct {
+	From    int64                  `json:"from"` // version of the Smap the delta is based on
+	Version int64                  `json:"version"`
+	ProxySI *daemonInfo            `json:"proxy_si"`
+	Epoch   int64                  `json:"epoch,omitempty"`
+	AddTmap map[string]*daemonInfo `json:"add_tmap,omitempty"` // new and updated targets
+	DelTmap []string               `json:"del_tmap,omitempty"`
+	AddPmap map[string]*daemonInfo `json:"add_pmap,omitempty"` // new and updated proxies
+	DelPmap []string               `json:"del_pmap,omitempty"`
+}
+
+func newSmapDelta(from, to *Smap) *smapDelta {
+	d := &smapDelta{From: from.version(), Version: to.version(), ProxySI: to.ProxySI, Epoch: to.Epoch}
+	d.AddTmap, d.DelTmap = diffDaemons(from.Tmap, to.Tmap)
+	d.AddPmap, d.DelPmap = diffDaemons(from.Pmap, to.Pmap)
+	return d
+}
+
+func diffDaemons(from, to map[string]*daemonInfo) (added map[string]*daemonInfo, deleted []string) {
+	for id, si := range to {
+		if old, ok := from[id]; !ok || *old != *si {
+			if added == nil {
+				added = make(map[string]*daemonInfo)
+			}
+			added[id] = si
+		}
+	}
+	for id := range from {
+		if _, ok := to[id]; !ok {
+			deleted = append(deleted, id)
+		}
+	}
+	return
+}
+
+// apply returns the new Smap built from the base one that must be the version
+// the delta is based on
+func (d *smapDelta) apply(base *Smap) (smap *Smap, errstr string) {
+	if base == nil || base.version() != d.From {
+		ver := int64(-1)
+		if base != nil {
+			ver = base.version()
+		}
+		errstr = fmt.Sprintf("Smap delta v%d => v%d does not apply to local Smap v%d", d.From, d.Version, ver)
+		return
+	}
+	smap = base.clone()
+	for id, si := range d.AddTmap {
+		smap.Tmap[id] = si
+	}
+	for _, id := range d.DelTmap {
+		delete(smap.Tmap, id)
+	}
+	for id, pi := range d.AddPmap {
+		smap.Pmap[id] = pi
+	}
+	for _, id := range d.DelPmap {
+		delete(smap.Pmap, id)
+	}
+	smap.ProxySI = d.ProxySI
+	smap.Version = d.Version
+	smap.Epoch = d.Epoch
+	return
+}
+
+// expandSmapDelta replaces the Smap delta in the received metasync payload
+// with the full Smap and, as the previous version, the local Smap - so that
+// the payload can then be extracted as usual (see extractSmap)
+func (h *httprunner) expandSmapDelta(payload simplekvs) (errstr string, status int) {
+	deltavalue, ok := payload[smapdeltatag]
+	if !ok {
+		return
+	}
+	delete(payload, smapdeltatag)
+	d := &smapDelta{}
+	if err := json.Unmarshal([]byte(deltavalue), d); err != nil {
+		return fmt.Sprintf("Failed to unmarshal Smap delta, err: %v", err), http.StatusBadRequest
+	}
+	localsmap := h.smapowner.get()
+	if localsmap != nil && localsmap.version() == d.Version {
+		delete(payload, smaptag+actiontag)
+		return
+	}
+	newsmap, errstr := d.apply(localsmap)
+	if errstr != "" {
+		return errstr, http.StatusPreconditionFailed
+	}
+	msg := &ActionMsg{}
+	if msgvalue, ok := payload[smaptag+actiontag]; ok {
+		if err := json.Unmarshal([]byte(msgvalue), msg); err != nil {
+			return fmt.Sprintf("Failed to unmarshal action message, err: %v", err), http.StatusBadRequest
+		}
+	}
+	msg.Value = localsmap
+	jsmsg, err := json.Marshal(msg)
+	assert(err == nil, err)
+	jsbytes, err := newsmap.marshal()
+	assert(err == nil, err)
+	payload[smaptag] = string(jsbytes)
+	payload[smaptag+actiontag] = string(jsmsg)
+	return
+}
+
+// compressPayload gzips metasync payloads larger than the configured size
+func compressPayload(jsbytes []byte) []byte {
+	limit := ctx.config.SmapSync.CompressSize
+	if limit <= 0 || int64(len(jsbytes)) <= limit {
+		return jsbytes
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write(jsbytes)
+	if err == nil {
+		err = zw.Close()
+	}
+	assert(err == nil, err)
+	return buf.Bytes()
+}
+
+func isGzipped(b []byte) bool {
+	return bytes.HasPrefix(b, gzipMagic)
+}
@@ -0,0 +1,250 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ */
+
+package dfc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// newLargeSmap returns Smap with the given number of targets and proxies
+func newLargeSmap(ntargets, nproxies int) *Smap {
+	smap := &Smap{}
+	smap.init(ntargets, nproxies)
+	for i := 0; i < ntargets; i++ {
+		id := fmt.Sprintf("target%04d", i)
+		smap.Tmap[id] = &daemonInfo{
+			DaemonID:   id,
+			NodeIPAddr: fmt.Sprintf("10.0.%d.%d", i/256, i%256),
+			DaemonPort: "8081",
+			DirectURL:  fmt.Sprintf("http://10.0.%d.%d:8081", i/256, i%256),
+		}
+	}
+	for i := 0; i < nproxies; i++ {
+		id := fmt.Sprintf("proxy%02d", i)
+		smap.Pmap[id] = &daemonInfo{
+			DaemonID:   id,
+			NodeIPAddr: fmt.Sprintf("10.1.0.%d", i),
+			DaemonPort: "8080",
+			DirectURL:  fmt.Sprintf("http://10.1.0.%d:8080", i),
+		}
+	}
+	smap.ProxySI = smap.Pmap["proxy00"]
+	smap.Version = int64(ntargets + nproxies)
+	return smap
+}
+
+func TestSmapDelta(t *testing.T) {
+	from := newLargeSmap(1000, 10)
+	to := from.clone()
+	for i := 1000; i < 1005; i++ {
+		id := fmt.Sprintf("target%04d", i)
+		to.addTarget(&daemonInfo{DaemonID: id, NodeIPAddr: "10.2.0.1", DaemonPort: "8081"})
+	}
+	to.delTarget("target0001")
+	to.delTarget("target0500")
+	to.delProxy("proxy09")
+	// re-registered with a new IP
+	si := *to.Tmap["target0002"]
+	si.NodeIPAddr = "10.3.0.2"
+	to.Tmap[si.DaemonID] = &si
+	to.ProxySI = to.Pmap["proxy01"]
+	to.Version++
+
+	d := newSmapDelta(from, to)
+	if len(d.AddTmap) != 6 || len(d.DelTmap) != 2 || len(d.AddPmap) != 0 || len(d.DelPmap) != 1 {
+		t.Fatalf("Unexpected delta: %d/%d targets, %d/%d proxies added/deleted",
+			len(d.AddTmap), len(d.DelTmap), len(d.AddPmap), len(d.DelPmap))
+	}
+
+	smap, errstr := d.apply(from)
+	if errstr != "" {
+		t.Fatal(errstr)
+	}
+	if !reflect.DeepEqual(smap, to) {
+		t.Fatalf("Smap built from delta differs: v%d, %d targets, %d proxies",
+			smap.Version, smap.countTargets(), smap.countProxies())
+	}
+	if from.countTargets() != 1000 || from.countProxies() != 10 {
+		t.Fatal("Applying delta modified the base Smap")
+	}
+
+	if _, errstr = d.apply(to); errstr == "" {
+		t.Fatal("Delta applied to the wrong Smap version")
+	}
+	if _, errstr = d.apply(nil); errstr == "" {
+		t.Fatal("Delta applied to no Smap")
+	}
+
+	jsfull, _ := to.marshal()
+	jsdelta, _ := json.Marshal(d)
+	if len(jsdelta)*10 > len(jsfull) {
+		t.Errorf("Delta is too large: %d bytes, full Smap %d bytes", len(jsdelta), len(jsfull))
+	}
+}
+
+func TestSmapDeltaExpand(t *testing.T) {
+	from := newLargeSmap(1000, 3)
+	to := from.clone()
+	to.delTarget("target0999")
+	jsdelta, _ := json.Marshal(newSmapDelta(from, to))
+	jsmsg, _ := json.Marshal(&ActionMsg{Action: ActUnregTarget})
+
+	target := targetrunner{}
+	target.smapowner = &smapowner{}
+	target.smapowner.put(from)
+	payload := simplekvs{smapdeltatag: string(jsdelta), smaptag + actiontag: string(jsmsg)}
+	if errstr, _ := target.expandSmapDelta(payload); errstr != "" {
+		t.Fatal(errstr)
+	}
+	newsmap, oldsmap, msg, errstr := target.extractSmap(payload)
+	if errstr != "" {
+		t.Fatal(errstr)
+	}
+	if !reflect.DeepEqual(newsmap, to) {
+		t.Fatal("Expanded Smap differs")
+	}
+	if oldsmap.version() != from.version() || oldsmap.countTargets() != 1000 || msg.Action != ActUnregTarget {
+		t.Fatalf("Unexpected previous Smap v%d (%d targets), action %s",
+			oldsmap.version(), oldsmap.countTargets(), msg.Action)
+	}
+
+	// stale local Smap
+	target.smapowner.put(newLargeSmap(10, 1))
+	payload = simplekvs{smapdeltatag: string(jsdelta), smaptag + actiontag: string(jsmsg)}
+	if errstr, status := target.expandSmapDelta(payload); errstr == "" || status != http.StatusPreconditionFailed {
+		t.Fatalf("Expected precondition failure, got %q (%d)", errstr, status)
+	}
+
+	// already up to date
+	target.smapowner.put(to)
+	payload = simplekvs{smapdeltatag: string(jsdelta), smaptag + actiontag: string(jsmsg)}
+	if errstr, _ := target.expandSmapDelta(payload); errstr != "" || len(payload) != 0 {
+		t.Fatalf("Unexpected result for up-to-date Smap: %q, payload %v", errstr, payload)
+	}
+}
+
+func TestSmapDeltaSync(t *testing.T) {
+	oldconf := ctx.config.SmapSync
+	defer func() { ctx.config.SmapSync = oldconf }()
+	ctx.config.SmapSync = smapsyncconf{Delta: true, CompressSize: 1024}
+
+	primary := newPrimary()
+	defer primary.callStatsServer.Stop()
+	syncer := newmetasyncer(primary)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		syncer.run()
+	}()
+	defer func() {
+		syncer.stop(nil)
+		wg.Wait()
+	}()
+
+	// the receiver applies what it gets to its own Smap
+	receiver := targetrunner{}
+	receiver.statsif = &storstatsrunner{}
+	receiver.smapowner = &smapowner{}
+	receiver.smapowner.put(newSmap())
+	var (
+		mu       sync.Mutex
+		received []string // delta or full, per sync call
+	)
+	f := func(w http.ResponseWriter, r *http.Request) {
+		payload := make(simplekvs)
+		if receiver.readJSON(w, r, &payload) != nil {
+			return
+		}
+		kind := "full"
+		if _, ok := payload[smapdeltatag]; ok {
+			kind = "delta"
+		}
+		mu.Lock()
+		received = append(received, kind)
+		mu.Unlock()
+		if errstr, status := receiver.expandSmapDelta(payload); errstr != "" {
+			receiver.invalmsghdlr(w, r, errstr, status)
+			return
+		}
+		if newsmap, _, _, errstr := receiver.extractSmap(payload); errstr != "" {
+			receiver.invalmsghdlr(w, r, errstr)
+		} else if newsmap != nil {
+			receiver.smapowner.put(newsmap)
+		}
+	}
+	s := httptest.NewServer(http.HandlerFunc(f))
+	defer s.Close()
+
+	smap := newSmap()
+	smap.addProxy(primary.si)
+	smap.ProxySI = primary.si
+	ip, port := getServerIPAndPort(s.URL)
+	smap.addTarget(&daemonInfo{DaemonID: "receiver", DirectURL: s.URL, NodeIPAddr: ip, DaemonPort: port})
+	primary.smapowner.put(smap)
+
+	// first sync: nothing to compute the delta against
+	syncer.sync(true, smap)
+	// second sync: the receiver has the previous version
+	next := smap.clone()
+	next.Version++
+	primary.smapowner.put(next)
+	syncer.sync(true, next)
+	// third sync: the receiver misses the previous version and gets the full Smap
+	receiver.smapowner.put(smap)
+	last := next.clone()
+	last.Version++
+	primary.smapowner.put(last)
+	syncer.sync(true, last)
+
+	mu.Lock()
+	defer mu.Unlock()
+	exp := []string{"full", "delta", "delta", "full"}
+	if !reflect.DeepEqual(received, exp) {
+		t.Fatalf("exp = %v, act = %v", exp, received)
+	}
+	if !reflect.DeepEqual(receiver.smapowner.get(), last) {
+		t.Fatalf("Receiver has Smap v%d, expected v%d", receiver.smapowner.get().version(), last.version())
+	}
+}
+
+func TestCompressPayload(t *testing.T) {
+	oldconf := ctx.config.SmapSync
+	defer func() { ctx.config.SmapSync = oldconf }()
+
+	jsbytes, _ := newLargeSmap(1000, 10).marshal()
+	ctx.config.SmapSync.CompressSize = 0
+	if b := compressPayload(jsbytes); !bytes.Equal(b, jsbytes) {
+		t.Fatal("Payload compressed with compression disabled")
+	}
+	ctx.config.SmapSync.CompressSize = int64(len(jsbytes))
+	if b := compressPayload(jsbytes); !bytes.Equal(b, jsbytes) {
+		t.Fatal("Payload compressed below the size limit")
+	}
+
+	ctx.config.SmapSync.CompressSize = 1024
+	zipped := compressPayload(jsbytes)
+	if !isGzipped(zipped) || len(zipped) >= len(jsbytes)/4 {
+		t.Fatalf("Poorly compressed payload: %d => %d bytes", len(jsbytes), len(zipped))
+	}
+
+	h := &httprunner{}
+	r := httptest.NewRequest(http.MethodPut, "/", bytes.NewReader(zipped))
+	r.Header.Set("Content-Encoding", "gzip")
+	smap := &Smap{}
+	if err := h.readJSON(httptest.NewRecorder(), r, smap); err != nil {
+		t.Fatal(err)
+	}
+	if smap.countTargets() != 1000 || smap.countProxies() != 10 {
+		t.Fatalf("Unexpected decompressed Smap: %d targets, %d proxies", smap.countTargets(), smap.countProxies())
+	}
+}
@@ -45,6 +45,8 @@ type statslogger interface {
 type statsif interface {
 	add(name string, val int64)
 	addMany(nameval ...interface{})
+	reset()         // zero the counters, see statsreset.go
+	restartWindow() // start a new sampling window
 }
 
 // TODO: use static map[string]int64
@@ -59,29 +61,48 @@ type proxyCoreStats struct {
 	Putlatency  int64 `json:"putlatency"`  // ---/---
 	Listlatency int64 `json:"listlatency"` // ---/---
 	Numerr      int64 `json:"numerr"`
+	// synthetic probes (see probe.go), not included in the above
+	Numprobe     int64 `json:"numprobe"`
+	Numprobeerr  int64 `json:"numprobeerr"`
+	Probelatency int64 `json:"probelatency"` // microseconds
+	// metadata response cache (see metacache.go)
+	Nummetahit  int64 `json:"nummetahit"`
+	Nummetamiss int64 `json:"nummetamiss"`
+	// intra-cluster connections (see peerclients.go)
+	Numconndial  int64 `json:"numconndial"`
+	Numconnreuse int64 `json:"numconnreuse"`
 	// omitempty
-	ngets  int64
-	nputs  int64
-	nlists int64
-	logged bool
+	ngets   int64
+	nputs   int64
+	nlists  int64
+	nprobes int64
+	logged  bool
 }
 
 type targetCoreStats struct {
 	proxyCoreStats
-	Numcoldget       int64 `json:"numcoldget"`
-	Bytesloaded      int64 `json:"bytesloaded"`
-	Bytesevicted     int64 `json:"bytesevicted"`
-	Filesevicted     int64 `json:"filesevicted"`
-	Numsentfiles     int64 `json:"numsentfiles"`
-	Numsentbytes     int64 `json:"numsentbytes"`
-	Numrecvfiles     int64 `json:"numrecvfiles"`
-	Numrecvbytes     int64 `json:"numrecvbytes"`
-	Numprefetch      int64 `json:"numprefetch"`
-	Bytesprefetched  int64 `json:"bytesprefetched"`
-	Numvchanged      int64 `json:"numvchanged"`
-	Bytesvchanged    int64 `json:"bytesvchanged"`
-	Numbadchecksum   int64 `json:"numbadchecksum"`
-	Bytesbadchecksum int64 `json:"bytesbadchecksum"`
+	Numcoldget           int64 `json:"numcoldget"`
+	Bytesloaded          int64 `json:"bytesloaded"`
+	Bytesevicted         int64 `json:"bytesevicted"`
+	Filesevicted         int64 `json:"filesevicted"`
+	Numsentfiles         int64 `json:"numsentfiles"`
+	Numsentbytes         int64 `json:"numsentbytes"`
+	Numrecvfiles         int64 `json:"numrecvfiles"`
+	Numrecvbytes         int64 `json:"numrecvbytes"`
+	Numprefetch          int64 `json:"numprefetch"`
+	Bytesprefetched      int64 `json:"bytesprefetched"`
+	Numvchanged          int64 `json:"numvchanged"`
+	Bytesvchanged        int64 `json:"bytesvchanged"`
+	Numbadchecksum       int64 `json:"numbadchecksum"`
+	Bytesbadchecksum     int64 `json:"bytesbadchecksum"`
+	Numorphanworkfiles   int64 `json:"numorphanworkfiles"`
+	Bytesorphanworkfiles int64 `json:"bytesorphanworkfiles"`
+	Numdisplaced         int64 `json:"numdisplaced"`
+	Numresilvered        int64 `json:"numresilvered"`
+	Bytesresilvered      int64 `json:"bytesresilvered"`
+	Numpurged            int64 `json:"numpurged"`
+	Bytespurged          int64 `json:"bytespurged"`
+	Numneghit            int64 `json:"numneghit"`
 }
 
 type statsrunner struct {
@@ -89,6 +110,7 @@ type statsrunner struct {
 	namedrunner
 	statslogger
 	chsts chan struct{}
+	chwin chan struct{} // restart the sampling window
 }
 
 type proxystatsrunner struct {
@@ -103,9 +125,21 @@ type storstatsrunner struct {
 	// iostat
 	CPUidle string               `json:"cpuidle"`
 	Disk    map[string]simplekvs `json:"disk"`
+	// bandwidth of the limited buckets, see bandwidth.go
+	Bandwidth map[string]*BandwidthStats `json:"bandwidth,omitempty"`
+	// health of the next tiers and the Cloud buckets, see breaker.go
+	Tiers map[string]*BreakerStats `json:"tiers,omitempty"`
+	Cloud map[string]*BreakerStats `json:"cloud,omitempty"`
+	// missing Cloud objects, see negcache.go
+	NegCache *NegCacheStats `json:"negcache,omitempty"`
+	// per-bucket counters, see bucketstats.go
+	Buckets map[string]*BucketStats `json:"buckets,omitempty"`
+	// the latest sampling windows, see statsreset.go
+	History []*StatsSample `json:"history,omitempty"`
 	// omitempty
 	timeUpdatedCapacity time.Time
 	timeCheckedLogSizes time.Time
+	resilver            bool // some of the full mountpaths are not full anymore
 	fsmap               map[syscall.Fsid]string
 }
 
@@ -165,6 +199,12 @@ type (
 		NumBytesPrefetched int64            `json:"numBytesPrefetched"`
 	}
 
+	DestroyTargetStats struct {
+		Xactions       []XactionDetails `json:"xactionDetails"`
+		NumFilesPurged int64            `json:"numFilesPurged"`
+		NumBytesPurged int64            `json:"numBytesPurged"`
+	}
+
 	PrefetchStats struct {
 		Kind        string                   `json:"kind"`
 		TargetStats map[string]PrefetchStats `json:"target"`
@@ -178,6 +218,7 @@ type (
 //==================
 func (r *statsrunner) runcommon(logger statslogger) error {
 	r.chsts = make(chan struct{}, 4)
+	r.chwin = make(chan struct{}, 1)
 
 	glog.Infof("Starting %s", r.name)
 	ticker := time.NewTicker(ctx.config.Periodic.StatsTime)
@@ -186,6 +227,9 @@ func (r *statsrunner) runcommon(logger statslogger) error {
 		case <-ticker.C:
 			runlru := logger.log()
 			logger.housekeep(runlru)
+		case <-r.chwin:
+			ticker.Stop()
+			ticker = time.NewTicker(ctx.config.Periodic.StatsTime)
 		case <-r.chsts:
 			ticker.Stop()
 			return nil
@@ -234,9 +278,12 @@ func (r *proxystatsrunner) log() (runlru bool) {
 	if r.Core.nlists > 0 {
 		r.Core.Listlatency /= r.Core.nlists
 	}
+	if r.Core.nprobes > 0 {
+		r.Core.Probelatency /= r.Core.nprobes
+	}
 	b, err := json.Marshal(r.Core)
-	r.Core.Getlatency, r.Core.Putlatency, r.Core.Listlatency = 0, 0, 0
-	r.Core.ngets, r.Core.nputs, r.Core.nlists = 0, 0, 0
+	r.Core.Getlatency, r.Core.Putlatency, r.Core.Listlatency, r.Core.Probelatency = 0, 0, 0, 0
+	r.Core.ngets, r.Core.nputs, r.Core.nlists, r.Core.nprobes = 0, 0, 0, 0
 	r.Unlock()
 
 	if err == nil {
@@ -294,6 +341,21 @@ func (r *proxystatsrunner) addL(name string, val int64) {
 		s.nlists++
 	case "numerr":
 		v = &s.Numerr
+	case "numprobe":
+		v = &s.Numprobe
+	case "numprobeerr":
+		v = &s.Numprobeerr
+	case "probelatency":
+		v = &s.Probelatency
+		s.nprobes++
+	case "nummetahit":
+		v = &s.Nummetahit
+	case "nummetamiss":
+		v = &s.Nummetamiss
+	case "numconndial":
+		v = &s.Numconndial
+	case "numconnreuse":
+		v = &s.Numconnreuse
 	default:
 		assert(false, "Invalid stats name "+name)
 	}
@@ -329,6 +391,8 @@ func (r *storstatsrunner) log() (runlru bool) {
 	if r.Core.nlists > 0 {
 		r.Core.Listlatency /= r.Core.nlists
 	}
+	sample := &StatsSample{Time: time.Now(), Numget: r.Core.ngets, Numput: r.Core.nputs,
+		Getlatency: r.Core.Getlatency, Putlatency: r.Core.Putlatency, Listlatency: r.Core.Listlatency}
 
 	b, err := json.Marshal(r.Core)
 	r.Core.Getlatency, r.Core.Putlatency, r.Core.Listlatency = 0, 0, 0
@@ -382,6 +446,36 @@ func (r *storstatsrunner) log() (runlru bool) {
 		riostat.Unlock()
 	}
 
+	// bandwidth
+	r.Bandwidth = gettarget().bandwidth.stats()
+	for bucket, bw := range r.Bandwidth {
+		b, err := json.Marshal(bw)
+		if err == nil {
+			lines = append(lines, bucket+": "+string(b))
+		}
+	}
+	sample.Bandwidth = r.Bandwidth
+	r.addSampleL(sample)
+
+	// next tiers and Cloud buckets
+	r.Tiers, r.Cloud = gettarget().tiers.stats(), gettarget().cloudbreakers.stats()
+	for _, breakers := range []map[string]*BreakerStats{r.Tiers, r.Cloud} {
+		for key, st := range breakers {
+			b, err := json.Marshal(st)
+			if err == nil {
+				lines = append(lines, key+": "+string(b))
+			}
+		}
+	}
+
+	// missing Cloud objects
+	if r.NegCache = gettarget().negcache.stats(time.Now()); r.NegCache != nil {
+		b, err := json.Marshal(r.NegCache)
+		if err == nil {
+			lines = append(lines, "negcache: "+string(b))
+		}
+	}
+
 	r.Core.logged = true
 	r.Unlock()
 
@@ -399,6 +493,15 @@ func (r *storstatsrunner) housekeep(runlru bool) {
 		go t.runLRU()
 	}
 
+	// move displaced objects back once their mountpaths have space
+	r.Lock()
+	resilver := r.resilver
+	r.resilver = false
+	r.Unlock()
+	if resilver {
+		go t.runResilver()
+	}
+
 	// Run prefetch operation if there are items to be prefetched
 	if len(t.prefetchQueue) > 0 {
 		go t.doPrefetch()
@@ -484,6 +587,9 @@ func (r *storstatsrunner) updateCapacity() (runlru bool) {
 			runlru = true
 		}
 	}
+	if updateFullMpaths(r.Capacity) {
+		r.resilver = true
+	}
 	return
 }
 
@@ -515,6 +621,7 @@ func (r *storstatsrunner) init() {
 		r.Capacity[mpath] = &fscapacity{}
 		r.fillfscap(r.Capacity[mpath], statfs)
 	}
+	updateFullMpaths(r.Capacity)
 }
 
 func (r *storstatsrunner) add(name string, val int64) {
@@ -567,6 +674,10 @@ func (r *storstatsrunner) addL(name string, val int64) {
 		s.nlists++
 	case "numerr":
 		v = &s.Numerr
+	case "numconndial":
+		v = &s.Numconndial
+	case "numconnreuse":
+		v = &s.Numconnreuse
 	// target only
 	case "numcoldget":
 		v = &s.Numcoldget
@@ -596,6 +707,22 @@ func (r *storstatsrunner) addL(name string, val int64) {
 		v = &s.Numbadchecksum
 	case "bytesbadchecksum":
 		v = &s.Bytesbadchecksum
+	case "numorphanworkfiles":
+		v = &s.Numorphanworkfiles
+	case "bytesorphanworkfiles":
+		v = &s.Bytesorphanworkfiles
+	case "numdisplaced":
+		v = &s.Numdisplaced
+	case "numresilvered":
+		v = &s.Numresilvered
+	case "bytesresilvered":
+		v = &s.Bytesresilvered
+	case "numpurged":
+		v = &s.Numpurged
+	case "bytespurged":
+		v = &s.Bytespurged
+	case "numneghit":
+		v = &s.Numneghit
 	default:
 		assert(false, "Invalid stats name "+name)
 	}
@@ -624,6 +751,27 @@ func (p PrefetchTargetStats) getStats(allXactionDetails []XactionDetails) (
 	return jsonBytes, nil
 }
 
+func (d DestroyTargetStats) getStats(allXactionDetails []XactionDetails) (
+	[]byte, error) {
+	storageStatsRunner := getstorstatsrunner()
+	storageStatsRunner.Lock()
+	destroyXactionStats := DestroyTargetStats{
+		Xactions:       allXactionDetails,
+		NumFilesPurged: storageStatsRunner.Core.Numpurged,
+		NumBytesPurged: storageStatsRunner.Core.Bytespurged,
+	}
+	storageStatsRunner.Unlock()
+	jsonBytes, err := json.Marshal(destroyXactionStats)
+	if err != nil {
+		err = fmt.Errorf(
+			"Unable to marshal destroyXactionStats. Error: %v",
+			err)
+		return []byte{}, err
+	}
+
+	return jsonBytes, nil
+}
+
 func (r RebalanceTargetStats) getStats(allXactionDetails []XactionDetails) (
 	[]byte, error) {
 	storageStatsRunner := getstorstatsrunner()
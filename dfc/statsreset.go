@@ -0,0 +1,112 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/NVIDIA/dfcpub/3rdparty/glog"
+)
+
+// ============================= Stats reset =================================
+// PUT /v1/daemon {"action": "resetstats"} zeroes the counters of the daemon,
+// proxy or target, and starts a new sampling window; PUT /v1/cluster with the
+// same message resets all daemons of the cluster - a benchmark can start from
+// a clean slate without restarting them. A target resets its core and
+// per-bucket counters (see bucketstats.go), the bandwidth of the limited
+// buckets and the history of the sampling windows. What the stats merely
+// report on - cloud egress budgets, circuit breakers, capacity - stays as is.
+// Latencies and bandwidth are averaged over a sampling window, which is the
+// stats interval (periodic.stats_time). With periodic.stats_history > 0, a
+// target keeps the averages of that many latest windows, idle ones skipped,
+// and reports them as the history of its stats. Both can be changed at
+// runtime with setconfig; the new stats_time starts a new window right away.
+// ============================= Stats reset =================================
+
+// StatsSample is the averages of a target over a sampling window
+type StatsSample struct {
+	Time        time.Time                  `json:"time"`                // end of the window
+	Numget      int64                      `json:"numget"`              // in the window
+	Numput      int64                      `json:"numput"`              // ditto
+	Getlatency  int64                      `json:"getlatency"`          // microseconds, average over the window
+	Putlatency  int64                      `json:"putlatency"`          // ditto
+	Listlatency int64                      `json:"listlatency"`         // ditto
+	Bandwidth   map[string]*BandwidthStats `json:"bandwidth,omitempty"` // of the limited buckets
+}
+
+// restartWindow makes the runner start a new sampling window now
+func (r *statsrunner) restartWindow() {
+	select {
+	case r.chwin <- struct{}{}:
+	default: // restarting already
+	}
+}
+
+func (r *proxystatsrunner) reset() {
+	r.Lock()
+	r.Core = proxyCoreStats{}
+	r.Unlock()
+	r.restartWindow()
+}
+
+func (r *storstatsrunner) reset() {
+	r.Lock()
+	r.Core = targetCoreStats{}
+	r.Buckets, r.History = nil, nil
+	r.Unlock()
+	r.restartWindow()
+}
+
+// addSampleL keeps the sample in the history of the latest windows; the
+// caller must hold the lock
+func (r *storstatsrunner) addSampleL(sample *StatsSample) {
+	n := ctx.config.Periodic.StatsHistory
+	if n <= 0 {
+		r.History = nil
+		return
+	}
+	r.History = append(r.History, sample)
+	if len(r.History) > n {
+		r.History = append(r.History[:0], r.History[len(r.History)-n:]...)
+	}
+}
+
+//
+// target
+//
+
+func (t *targetrunner) resetStats() {
+	t.statsif.reset()
+	t.bandwidth.resetUsage(time.Now())
+	glog.Infoln("Stats reset")
+}
+
+//
+// proxy
+//
+
+// PUT /v1/cluster {"action": "resetstats"}
+func (p *proxyrunner) resetClusterStats(w http.ResponseWriter, r *http.Request, msg *ActionMsg) {
+	p.statsif.reset()
+	p.metacache.clear()                // the cached cluster stats
+	msgbytes, err := json.Marshal(msg) // same message -> all targets and proxies
+	assert(err == nil, err)
+	results := p.broadcastCluster(URLPath(Rversion, Rdaemon), nil, http.MethodPut, msgbytes, p.smapowner.get())
+	var errstr string
+	for res := range results {
+		if res.err != nil && errstr == "" {
+			errstr = fmt.Sprintf("Failed to reset the stats of %s: %v (%d: %s)", res.si.DaemonID, res.err, res.status, res.errstr)
+		}
+	}
+	if errstr != "" {
+		p.invalmsghdlr(w, r, errstr)
+		return
+	}
+	glog.Infoln("Cluster stats reset")
+}
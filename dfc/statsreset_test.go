@@ -0,0 +1,49 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ */
+package dfc
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStatsReset(t *testing.T) {
+	oldhistory := ctx.config.Periodic.StatsHistory
+	defer func() { ctx.config.Periodic.StatsHistory = oldhistory }()
+	ctx.config.Periodic.StatsHistory = 2
+
+	r := &storstatsrunner{}
+	r.chwin = make(chan struct{}, 1)
+	for i := int64(1); i <= 3; i++ {
+		r.addSampleL(&StatsSample{Numget: i})
+	}
+	if len(r.History) != 2 || r.History[0].Numget != 2 || r.History[1].Numget != 3 {
+		t.Errorf("Expected the latest 2 samples, got %+v", r.History)
+	}
+	ctx.config.Periodic.StatsHistory = 0
+	if r.addSampleL(&StatsSample{Numget: 4}); r.History != nil {
+		t.Errorf("Expected no history, got %+v", r.History)
+	}
+
+	r.Core.Numget, r.Core.ngets = 10, 2
+	r.Buckets = map[string]*BucketStats{"bucket": {}}
+	r.History = []*StatsSample{{Numget: 2}}
+	r.reset()
+	if r.Core != (targetCoreStats{}) || r.Buckets != nil || r.History != nil {
+		t.Errorf("Expected the stats reset, got %+v, %v, %v", r.Core, r.Buckets, r.History)
+	}
+	// the window restarts once, however many times reset
+	r.reset()
+	if len(r.chwin) != 1 {
+		t.Errorf("Expected a pending window restart, got %d", len(r.chwin))
+	}
+
+	var s bandwidthShapers
+	tb := s.get("bucket", 1000, true)
+	tb.take(500)
+	s.resetUsage(time.Now())
+	if _, rate := tb.usage(time.Now().Add(time.Second)); rate != 0 {
+		t.Errorf("Expected no bandwidth used since the reset, got %d", rate)
+	}
+}
@@ -0,0 +1,315 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+// Bucket summary (du) - the number and the size of the objects of a bucket,
+// optionally only of those with the given prefix, without listing them.
+// Upon GET /v1/buckets/bucket-name?what=summary the proxy asks all targets to
+// summarize the objects they store. A target walks the bucket directories of
+// its mountpaths with a pool of summary.workers walkers, one top-level
+// directory at a time, so that a bucket with a few large directories is still
+// walked in parallel. For a Cloud bucket the proxy, in addition, pages through
+// the Cloud listing (sizes only) to count the objects that are not cached -
+// unless cachedonly=true. With summary.cache_time configured the proxy keeps
+// the summaries for that long; reload=true bypasses the cache.
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const summaryCacheMaxEntries = 1000
+
+type summaryCache struct {
+	mtx       sync.Mutex
+	summaries map[string]*BucketSummary
+}
+
+func (sc *summaryCache) get(key string, ttl time.Duration) *BucketSummary {
+	sc.mtx.Lock()
+	defer sc.mtx.Unlock()
+	summary, ok := sc.summaries[key]
+	if !ok || time.Since(summary.Time) > ttl {
+		return nil
+	}
+	return summary
+}
+
+func (sc *summaryCache) put(key string, summary *BucketSummary, ttl time.Duration) {
+	sc.mtx.Lock()
+	defer sc.mtx.Unlock()
+	if sc.summaries == nil {
+		sc.summaries = make(map[string]*BucketSummary)
+	}
+	if len(sc.summaries) >= summaryCacheMaxEntries {
+		for k, cached := range sc.summaries {
+			if time.Since(cached.Time) > ttl {
+				delete(sc.summaries, k)
+			}
+		}
+		if len(sc.summaries) >= summaryCacheMaxEntries {
+			return
+		}
+	}
+	sc.summaries[key] = summary
+}
+
+// matchPrefix tells whether the directory (with the trailing slash) may
+// contain objects with the prefix
+func matchPrefix(dirname, prefix string) bool {
+	return strings.HasPrefix(prefix, dirname) || strings.HasPrefix(dirname, prefix)
+}
+
+//
+// target
+//
+
+// GET /v1/buckets/bucket-name?what=summary
+func (t *targetrunner) httpsummary(w http.ResponseWriter, r *http.Request, bucket string) {
+	summary, err := t.bucketSummary(bucket, r.URL.Query().Get(URLParamPrefix))
+	if err != nil {
+		t.invalmsghdlr(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	jsbytes, err := json.Marshal(summary)
+	assert(err == nil, err)
+	t.writeJSON(w, r, jsbytes, "summary")
+}
+
+// bucketSummary sums up the objects of the bucket stored by the target
+func (t *targetrunner) bucketSummary(bucket, prefix string) (*TargetSummary, error) {
+	var (
+		summary = &TargetSummary{}
+		islocal = t.bmdowner.get().islocal(bucket)
+		dirs    = make(chan string, 64)
+		mtx     = &sync.Mutex{}
+		wg      = &sync.WaitGroup{}
+		workers = ctx.config.Summary.Workers
+		failed  error
+	)
+	add := func(fqn string, finfo os.FileInfo, s *TargetSummary) {
+		if iswork, _ := t.isworkfile(fqn); iswork {
+			return
+		}
+		s.Objects++
+		s.Size += objectSize(fqn, finfo)
+		s.DiskSize += finfo.Size()
+	}
+	fail := func(dir string, err error) {
+		t.runFSKeeper(dir)
+		mtx.Lock()
+		if failed == nil {
+			failed = fmt.Errorf("Failed to traverse %s, err: %v", dir, err)
+		}
+		mtx.Unlock()
+	}
+	if workers == 0 {
+		workers = len(ctx.mountpaths.Available)
+	}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			local := &TargetSummary{}
+			for dir := range dirs {
+				root := filepath.Dir(dir)
+				err := filepath.Walk(dir, func(fqn string, finfo os.FileInfo, err error) error {
+					if err != nil {
+						if os.IsNotExist(err) {
+							return nil
+						}
+						return err
+					}
+					relname, _ := filepath.Rel(root, fqn)
+					name := filepath.ToSlash(relname)
+					if finfo.IsDir() {
+						if !matchPrefix(name+"/", prefix) {
+							return filepath.SkipDir
+						}
+						return nil
+					}
+					if strings.HasPrefix(name, prefix) {
+						add(fqn, finfo, local)
+					}
+					return nil
+				})
+				if err != nil {
+					fail(dir, err)
+				}
+			}
+			mtx.Lock()
+			summary.Objects += local.Objects
+			summary.Size += local.Size
+			summary.DiskSize += local.DiskSize
+			mtx.Unlock()
+		}()
+	}
+
+	// the objects at the top are summed up right away, the directories - by the workers
+	top := &TargetSummary{}
+	for mpath := range ctx.mountpaths.Available {
+		root := filepath.Join(makePathCloud(mpath), bucket)
+		if islocal {
+			root = filepath.Join(makePathLocal(mpath), bucket)
+		}
+		finfos, err := ioutil.ReadDir(root)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				fail(root, err)
+			}
+			continue
+		}
+		for _, finfo := range finfos {
+			switch {
+			case finfo.IsDir():
+				if matchPrefix(finfo.Name()+"/", prefix) {
+					dirs <- filepath.Join(root, finfo.Name())
+				}
+			case strings.HasPrefix(finfo.Name(), prefix):
+				add(filepath.Join(root, finfo.Name()), finfo, top)
+			}
+		}
+	}
+	close(dirs)
+	wg.Wait()
+	if failed != nil {
+		return nil, failed
+	}
+	summary.Objects += top.Objects
+	summary.Size += top.Size
+	summary.DiskSize += top.DiskSize
+	return summary, nil
+}
+
+//
+// proxy
+//
+
+// GET /v1/buckets/bucket-name?what=summary
+func (p *proxyrunner) httpsummary(w http.ResponseWriter, r *http.Request, bucket string) {
+	q := r.URL.Query()
+	cachedOnly, err := parsebool(q.Get(URLParamCached))
+	if err != nil {
+		p.invalmsghdlr(w, r, fmt.Sprintf("Invalid URL query parameter: %s=%s (expecting: '' | true | false)",
+			URLParamCached, q.Get(URLParamCached)))
+		return
+	}
+	reload, err := parsebool(q.Get(URLParamReload))
+	if err != nil {
+		p.invalmsghdlr(w, r, fmt.Sprintf("Invalid URL query parameter: %s=%s (expecting: '' | true | false)",
+			URLParamReload, q.Get(URLParamReload)))
+		return
+	}
+	var (
+		prefix = q.Get(URLParamPrefix)
+		cloud  = !cachedOnly && !p.bmdowner.get().islocal(bucket)
+		key    = bucket + "/" + prefix + "?" + strconv.FormatBool(cloud)
+		ttl    = ctx.config.Summary.CacheTime
+	)
+	var summary *BucketSummary
+	if ttl > 0 && !reload {
+		summary = p.summaries.get(key, ttl)
+	}
+	if summary == nil {
+		if summary, err = p.bucketSummary(r, bucket, prefix, cloud); err != nil {
+			p.invalmsghdlr(w, r, err.Error())
+			return
+		}
+		if ttl > 0 {
+			p.summaries.put(key, summary, ttl)
+		}
+	}
+	jsbytes, err := json.Marshal(summary)
+	assert(err == nil, err)
+	p.writeJSON(w, r, jsbytes, "summary")
+}
+
+// bucketSummary collects the summaries of the targets and, if cloud, counts
+// the objects of the Cloud bucket
+func (p *proxyrunner) bucketSummary(r *http.Request, bucket, prefix string, cloud bool) (*BucketSummary, error) {
+	var (
+		summary = &BucketSummary{Bucket: bucket, Prefix: prefix, Time: time.Now(), Targets: make(map[string]*TargetSummary)}
+		cloudch = make(chan error, 1)
+		q       = url.Values{}
+	)
+	if cloud {
+		go func() { cloudch <- p.cloudSummary(r, bucket, prefix, summary) }()
+	}
+	q.Set(URLParamWhat, GetWhatSummary)
+	q.Set(URLParamPrefix, prefix)
+	results := p.broadcastTargets(URLPath(Rversion, Rbuckets, bucket), q, http.MethodGet, nil,
+		p.smapowner.get(), ctx.config.Timeout.DefaultLong)
+	var err error
+	for res := range results {
+		if res.err != nil {
+			err = fmt.Errorf("Failed to get the summary of %s from %s: %v (%d: %s)",
+				bucket, res.si.DaemonID, res.err, res.status, res.errstr)
+			continue
+		}
+		tsummary := &TargetSummary{}
+		if e := json.Unmarshal(res.outjson, tsummary); e != nil {
+			err = fmt.Errorf("Invalid summary of %s from %s, err: %v", bucket, res.si.DaemonID, e)
+			continue
+		}
+		summary.Targets[res.si.DaemonID] = tsummary
+		summary.CachedObjects += tsummary.Objects
+		summary.CachedSize += tsummary.DiskSize
+		if !cloud {
+			summary.Objects += tsummary.Objects
+			summary.Size += tsummary.Size
+		}
+	}
+	if cloud {
+		if e := <-cloudch; e != nil && err == nil {
+			err = e
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
+
+// cloudSummary pages through the Cloud listing to count the objects and their sizes
+func (p *proxyrunner) cloudSummary(r *http.Request, bucket, prefix string, summary *BucketSummary) error {
+	msg := &GetMsg{GetPrefix: prefix, GetProps: GetPropsSize}
+	for {
+		var si *daemonInfo
+		for _, si = range p.smapowner.get().Tmap {
+			break
+		}
+		if si == nil {
+			return fmt.Errorf("No registered targets yet")
+		}
+		resp, err := p.targetListBucket(r, bucket, si, msg, false /* islocal */, false /* cached */)
+		if err != nil {
+			return fmt.Errorf("Failed to list %s, err: %v", bucket, err)
+		}
+		list := &BucketList{}
+		if len(resp.outjson) > 0 {
+			if err = json.Unmarshal(resp.outjson, list); err != nil {
+				return fmt.Errorf("Invalid list of %s, err: %v", bucket, err)
+			}
+		}
+		for _, entry := range list.Entries {
+			summary.Objects++
+			summary.Size += entry.Size
+		}
+		if list.PageMarker == "" {
+			return nil
+		}
+		msg.GetPageMarker = list.PageMarker
+	}
+}
@@ -0,0 +1,92 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBucketSummary(t *testing.T) {
+	const bucket = "summarybucket"
+	var mpaths []string
+	oldavail, oldworkers := ctx.mountpaths.Available, ctx.config.Summary.Workers
+	defer func() { ctx.mountpaths.Available, ctx.config.Summary.Workers = oldavail, oldworkers }()
+	ctx.mountpaths.Available = make(map[string]*mountPath)
+	for i := 0; i < 2; i++ {
+		mpath, err := ioutil.TempDir("", "summary")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(mpath)
+		ctx.mountpaths.Available[mpath] = &mountPath{Path: mpath}
+		mpaths = append(mpaths, mpath)
+	}
+
+	target, _ := newTestTarget(map[string]BucketProps{bucket: {}})
+
+	objnames := []string{"top", "topmost", "a/x", "a/b/y", "a/b/z", "ab/w", "c/d/e/f"}
+	for i, objname := range objnames {
+		fqn := mpath2fqn(mpaths[i%2], bucket, objname, true)
+		if err := CreateDir(filepath.Dir(fqn)); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(fqn, make([]byte, i+1), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// in-progress PUTs are not counted
+	workfqn := filepath.Join(filepath.Dir(mpath2fqn(mpaths[0], bucket, "a/x", true)), workfileprefix+"x.1f")
+	if err := ioutil.WriteFile(workfqn, []byte("work"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, workers := range []int{0, 1, 3} {
+		ctx.config.Summary.Workers = workers
+		for _, prefix := range []string{"", "top", "a", "a/", "a/b/", "a/b/z", "c/d/", "none"} {
+			var expected TargetSummary
+			for i, objname := range objnames {
+				if strings.HasPrefix(objname, prefix) {
+					expected.Objects++
+					expected.Size += int64(i + 1)
+				}
+			}
+			expected.DiskSize = expected.Size
+			summary, err := target.bucketSummary(bucket, prefix)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *summary != expected {
+				t.Errorf("%d workers, prefix %q: expected %+v, got %+v", workers, prefix, expected, *summary)
+			}
+		}
+	}
+}
+
+func TestSummaryCache(t *testing.T) {
+	sc := &summaryCache{}
+	if sc.get("b/?true", time.Minute) != nil {
+		t.Fatal("Expected an empty cache")
+	}
+	sc.put("b/?true", &BucketSummary{Bucket: "b", Time: time.Now()}, time.Minute)
+	sc.put("old/?true", &BucketSummary{Bucket: "old", Time: time.Now().Add(-2 * time.Minute)}, time.Minute)
+	if summary := sc.get("b/?true", time.Minute); summary == nil || summary.Bucket != "b" {
+		t.Errorf("Expected the cached summary, got %+v", summary)
+	}
+	if summary := sc.get("old/?true", time.Minute); summary != nil {
+		t.Errorf("Expected the summary to expire, got %+v", summary)
+	}
+	for i := 0; i < summaryCacheMaxEntries; i++ {
+		sc.put(fmt.Sprintf("b%d/?true", i), &BucketSummary{Time: time.Now()}, time.Minute)
+	}
+	if len(sc.summaries) > summaryCacheMaxEntries {
+		t.Errorf("Expected at most %d summaries, got %d", summaryCacheMaxEntries, len(sc.summaries))
+	}
+}
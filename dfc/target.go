@@ -40,8 +40,9 @@ const (
 )
 
 type mountPath struct {
-	Path string       `json:"path"`
-	Fsid syscall.Fsid `json:"fsid"`
+	Path  string       `json:"path"`
+	Fsid  syscall.Fsid `json:"fsid"`
+	Label string       `json:"label,omitempty"` // storage class of the mountpath, e.g. nvme, ssd, hdd
 }
 
 type allfinfos struct {
@@ -60,6 +61,8 @@ type allfinfos struct {
 	t            *targetrunner
 	bucket       string
 	limit        int
+	delimiter    string
+	prefixes     map[string]bool // common prefixes when listing with delimiter
 }
 
 type uxprocess struct {
@@ -93,6 +96,16 @@ type targetrunner struct {
 	prefetchQueue chan filesWithDeadline
 	statsdC       statsd.Client
 	authn         *authManager
+	clock         Clock
+	netsample     netsample        // see load()
+	bandwidth     bandwidthShapers // per-bucket limits, see bandwidth.go
+	tiers         breakers         // health of the next tiers, see tierhealth.go
+	cloudbreakers breakers         // health of the Cloud buckets, see cloudbreaker.go
+	negcache      negCache         // missing Cloud objects, see negcache.go
+	cloudEgress   egressCounters   // see egress.go
+	zerocopy      *zerocopyServer  // see zerocopy.go
+	fence         epochFence       // see fencing.go
+	warmedup      int32            // startup warm-up has run, see warmup.go
 }
 
 // start target runner
@@ -109,6 +122,7 @@ func (t *targetrunner) run() error {
 	t.httprunner.kalive = gettargetkalive()
 	t.xactinp = newxactinp()        // extended actions
 	t.rtnamemap = newrtnamemap(128) // lock/unlock name
+	t.fence.load()
 
 	bucketmd := newBucketMD()
 	t.bmdowner.put(bucketmd)
@@ -134,6 +148,8 @@ func (t *targetrunner) run() error {
 	}
 	// fill-in, detect changes, persist
 	t.startupMpaths()
+	go t.removeOrphanWorkfiles()
+	go t.runPurge()
 
 	// cloud provider
 	if ctx.config.CloudProvider == ProviderAmazon {
@@ -144,24 +160,43 @@ func (t *targetrunner) run() error {
 		assert(ctx.config.CloudProvider == ProviderGoogle)
 		t.cloudif = &gcpimpl{t}
 	}
+	if faultsEnabled {
+		t.cloudif = &faultycloud{cloudif: t.cloudif, fi: t.faults}
+	}
+	t.cloudbreakers.name, t.cloudbreakers.conf = "Cloud bucket", &ctx.config.CloudBreaker.breakerconf
+	t.cloudif = &breakercloud{cloudif: t.cloudif, b: &t.cloudbreakers}
+	t.tiers.name, t.tiers.conf = "Next tier", &ctx.config.NextTier
 
 	// prefetch
 	t.prefetchQueue = make(chan filesWithDeadline, prefetchChanSize)
 
 	t.authn = &authManager{
 		tokens:        make(map[string]*authRec),
-		revokedTokens: make(map[string]bool),
+		revokedTokens: make(map[string]time.Time),
+		clock:         t.clock,
+	}
+	if ctx.config.Auth.Enabled && ctx.config.Auth.AuthnURL != "" {
+		go t.authn.pullRevokedList(ctx.config.Auth.AuthnURL)
+	}
+	if zerocopyEnabled && ctx.config.ZeroCopy.Socket != "" {
+		if err := t.startZeroCopy(); err != nil {
+			glog.Errorln(err)
+		}
+	} else if ctx.config.ZeroCopy.Socket != "" {
+		glog.Warningf("Zero-copy handoff is not supported by this build: ignoring %s", ctx.config.ZeroCopy.Socket)
 	}
 	//
 	// REST API: register storage target's handler(s) and start listening
 	//
-	t.httprunner.registerhdlr(URLPath(Rversion, Rbuckets)+"/", t.bucketHandler)
-	t.httprunner.registerhdlr(URLPath(Rversion, Robjects)+"/", t.objectHandler)
-	t.httprunner.registerhdlr(URLPath(Rversion, Rdaemon), t.daemonHandler)
-	t.httprunner.registerhdlr(URLPath(Rversion, Rpush)+"/", t.pushHandler)
+	t.httprunner.registerhdlr(URLPath(Rversion, Rbuckets)+"/", wrapHandler(t.bucketHandler, t.fenced))
+	t.httprunner.registerhdlr(URLPath(Rversion, Robjects)+"/", wrapHandler(t.objectHandler, t.fenced))
+	t.httprunner.registerhdlr(URLPath(Rversion, Rdaemon), wrapHandler(t.daemonHandler, t.fenced))
+	t.httprunner.registerhdlr(URLPath(Rversion, Rpush)+"/", wrapHandler(t.pushHandler, t.fenced))
 	t.httprunner.registerhdlr(URLPath(Rversion, Rhealth), t.httpHealth)
 	t.httprunner.registerhdlr(URLPath(Rversion, Rvote)+"/", t.voteHandler)
 	t.httprunner.registerhdlr(URLPath(Rversion, Rtokens), t.tokenHandler)
+	t.httprunner.registerhdlr(URLPath(Rversion, Rgossip), t.gossipHandler)
+	t.httprunner.registerhdlr(URLPath(Rversion, Rslices)+"/", wrapHandler(t.sliceHandler, t.fenced))
 	t.httprunner.registerhdlr("/", invalhdlr)
 	glog.Infof("Target %s is ready", t.si.DaemonID)
 	glog.Flush()
@@ -183,6 +218,9 @@ func (t *targetrunner) stop(err error) {
 	glog.Infof("Stopping %s, err: %v", t.name, err)
 	sleep := t.xactinp.abortAll()
 	t.rtnamemap.stop()
+	if t.zerocopy != nil {
+		t.zerocopy.stop()
+	}
 	if t.httprunner.h != nil {
 		t.unregister() // ignore errors
 	}
@@ -197,7 +235,11 @@ func (t *targetrunner) stop(err error) {
 // target registration with proxy
 func (t *targetrunner) register(timeout time.Duration) (int, error) {
 	var newbucketmd bucketMD
-	jsbytes, err := json.Marshal(t.si)
+	kmsg := &keepaliveMsg{daemonInfo: *t.si}
+	if timeout > 0 { // keepalive
+		kmsg.Load = t.load()
+	}
+	jsbytes, err := json.Marshal(kmsg)
 	if err != nil {
 		return 0, fmt.Errorf("Unexpected failure to json-marshal %+v, err: %v", t.si, err)
 	}
@@ -268,7 +310,7 @@ func (t *targetrunner) getPrimaryURLAndSI() (url string, proxysi *daemonInfo) {
 		return
 	}
 	if smap.ProxySI.DaemonID != "" {
-		url, proxysi = smap.ProxySI.DirectURL, smap.ProxySI
+		url, proxysi = smap.ProxySI.controlURL(), smap.ProxySI
 		return
 	}
 	url, proxysi = ctx.config.Proxy.Primary.URL, smap.ProxySI
@@ -310,6 +352,8 @@ func (t *targetrunner) objectHandler(w http.ResponseWriter, r *http.Request) {
 		t.httpobjpost(w, r)
 	case http.MethodHead:
 		t.httpobjhead(w, r)
+	case http.MethodPatch:
+		t.httpobjpatch(w, r)
 	default:
 		invalhdlr(w, r)
 	}
@@ -330,6 +374,17 @@ func (t *targetrunner) httpbckget(w http.ResponseWriter, r *http.Request) {
 		t.getbucketnames(w, r)
 		return
 	}
+	switch r.URL.Query().Get(URLParamWhat) {
+	case GetWhatDigest:
+		t.httpdigest(w, r, bucket)
+		return
+	case GetWhatPinned:
+		t.httppinned(w, r, bucket)
+		return
+	case GetWhatSummary:
+		t.httpsummary(w, r, bucket)
+		return
+	}
 	s := fmt.Sprintf("Invalid route /buckets/%s", bucket)
 	t.invalmsghdlr(w, r, s)
 }
@@ -343,6 +398,7 @@ func (t *targetrunner) httpobjget(w http.ResponseWriter, r *http.Request) {
 		nhobj                         cksumvalue
 		bucket, objname, fqn          string
 		uname, errstr, version        string
+		stale                         string // Warning of the stale cached object, if served
 		size                          int64
 		props                         *objectProps
 		started                       time.Time
@@ -361,11 +417,29 @@ func (t *targetrunner) httpobjget(w http.ResponseWriter, r *http.Request) {
 	if !t.validatebckname(w, r, bucket) {
 		return
 	}
+	switch r.URL.Query().Get(URLParamWhat) {
+	case GetWhatObjMeta:
+		t.httpobjmetaget(w, r, bucket, objname)
+		return
+	case GetWhatPGroup:
+		t.httppgroupget(w, r, bucket, objname)
+		return
+	}
 	offset, length, readRange, errstr := t.validateOffsetAndLength(r)
 	if errstr != "" {
 		t.invalmsghdlr(w, r, errstr)
 		return
 	}
+	rng, errstr := parseRangeHeader(r.Header.Get(HeaderRange))
+	if errstr != "" {
+		t.invalmsghdlr(w, r, errstr)
+		return
+	}
+	if rng != nil && readRange {
+		t.invalmsghdlr(w, r, fmt.Sprintf("%s header and %s/%s query parameters are mutually exclusive",
+			HeaderRange, URLParamOffset, URLParamLength))
+		return
+	}
 
 	bucketmd := t.bmdowner.get()
 	islocal := bucketmd.islocal(bucket)
@@ -374,26 +448,49 @@ func (t *targetrunner) httpobjget(w http.ResponseWriter, r *http.Request) {
 		t.invalmsghdlr(w, r, errstr, errcode)
 		return
 	}
+	if !t.validateCustomerKey(w, r, islocal) {
+		return
+	}
+	if errstr = validatePlacementGroup(r); errstr != "" {
+		t.invalmsghdlr(w, r, errstr)
+		return
+	}
+	if !t.checkSmapVersion(w, r) {
+		return
+	}
 
 	// lockname(ro)
 	fqn, uname = t.fqn(bucket, objname, islocal), uniquename(bucket, objname)
 	t.rtnamemap.lockname(uname, false, &pendinginfo{Time: time.Now(), fqn: fqn}, time.Second)
+	fqn = t.lookupfqn(bucket, objname, islocal)
 
 	// existence, access & versioning
-	if coldget, size, version, errstr = t.lookupLocally(bucket, objname, fqn); islocal && errstr != "" {
+	coldget, size, version, errstr = t.lookupLocally(bucket, objname, fqn)
+	if errstr != "" {
+		if mfqn := t.lookupMirror(bucket, objname, islocal, fqn); mfqn != "" {
+			fqn = mfqn
+			coldget, size, version, errstr = t.lookupLocally(bucket, objname, fqn)
+		}
+	}
+	if islocal && errstr != "" {
 		errcode = http.StatusInternalServerError
 		// given certain conditions (below) make an effort to locate the object cluster-wide
 		if strings.Contains(errstr, doesnotexist) {
 			errcode = http.StatusNotFound
+			if t.redirectLegacyName(w, r, bucket, objname) || t.redirectPlaced(w, r, bucket, objname) {
+				t.rtnamemap.unlockname(uname, false)
+				return
+			}
 			aborted, running := t.xactinp.isAbortedOrRunningRebalance()
 			if aborted || running {
 				if props := t.getFromNeighbor(bucket, objname, r, islocal); props != nil {
 					size, nhobj = props.size, props.nhobj
+					fqn = t.lookupfqn(bucket, objname, islocal)
 					goto existslocally
 				}
 			} else {
 				_, p := bucketmd.get(bucket, islocal)
-				if p.NextTierURL != "" {
+				if p.NextTierURL != "" && t.tierAvailable(p.NextTierURL) {
 					if inNextTier, errstr, errcode = t.objectInNextTier(p.NextTierURL, bucket, objname); inNextTier {
 						props, errstr, errcode = t.getObjectNextTier(p.NextTierURL, bucket, objname, fqn)
 						if errstr == "" {
@@ -405,20 +502,40 @@ func (t *targetrunner) httpobjget(w http.ResponseWriter, r *http.Request) {
 					}
 				}
 			}
+			if _, p := bucketmd.get(bucket, islocal); p.ECData > 0 {
+				var ecerrstr string
+				if props, ecerrstr, errcode = t.ecRestore(bucket, objname); ecerrstr == "" {
+					size = props.size
+					fqn = t.lookupfqn(bucket, objname, islocal)
+					goto existslocally
+				}
+				if errcode != http.StatusNotFound {
+					errstr = ecerrstr
+				}
+			}
 		}
 		t.invalmsghdlr(w, r, errstr, errcode)
 		t.rtnamemap.unlockname(uname, false)
 		return
 	}
 
+	// not cached here, the object may be cached by the target of its placement group
+	if coldget && t.redirectPlaced(w, r, bucket, objname) {
+		t.rtnamemap.unlockname(uname, false)
+		return
+	}
 	if !coldget && !islocal {
 		if versioncfg.ValidateWarmGet && (version != "" &&
 			t.versioningConfigured(bucket)) {
 			if vchanged, errstr, errcode = t.checkCloudVersion(
 				ct, bucket, objname, version); errstr != "" {
-				t.invalmsghdlr(w, r, errstr, errcode)
-				t.rtnamemap.unlockname(uname, false)
-				return
+				if !t.serveStale(bucket, fqn, errcode) {
+					t.invalmsghdlr(w, r, errstr, errcode)
+					t.rtnamemap.unlockname(uname, false)
+					return
+				}
+				glog.Warningf("Serving cached %s/%s without validating its version, err: %s", bucket, objname, errstr)
+				stale, errstr, errcode = warnRevalidationFailed, "", 0
 			}
 			// TODO: add a knob to return what's cached while upgrading the version async
 			coldget = vchanged
@@ -445,7 +562,22 @@ func (t *targetrunner) httpobjget(w http.ResponseWriter, r *http.Request) {
 	}
 	if coldget {
 		t.rtnamemap.unlockname(uname, false)
-		if props, errstr, errcode = t.coldget(ct, bucket, objname, false); errstr != "" {
+		if rng != nil && !islocal {
+			// read the range from the Cloud without caching the object
+			if t.getCloudRange(ct, w, r, bucket, objname, rng) {
+				t.statsif.addMany("numget", int64(1), "getlatency", int64(time.Since(started)/1000))
+				t.addBucketStats(bucket, "numget", int64(1), "numcoldget", int64(1))
+			}
+			return
+		}
+		if props, errstr, errcode = t.coldget(ct, bucket, objname, false); errstr == "" {
+			size, nhobj = props.size, props.nhobj
+			fqn = t.lookupfqn(bucket, objname, islocal) // cold GET may have displaced the object
+		} else if vchanged && t.serveStale(bucket, fqn, errcode) {
+			glog.Warningf("Serving stale %s/%s: failed to refresh, err: %s", bucket, objname, errstr)
+			t.rtnamemap.lockname(uname, false, &pendinginfo{Time: time.Now(), fqn: fqn}, time.Second)
+			stale, coldget, props, errstr, errcode = warnStale, false, nil, "", 0
+		} else {
 			if errcode == 0 {
 				t.invalmsghdlr(w, r, errstr)
 			} else {
@@ -453,19 +585,36 @@ func (t *targetrunner) httpobjget(w http.ResponseWriter, r *http.Request) {
 			}
 			return
 		}
-		size, nhobj = props.size, props.nhobj
 	}
 
 existslocally:
 	// note: coldget() keeps the read lock if successful
 	defer t.rtnamemap.unlockname(uname, false)
 
+	if errstr, errcode = checkCustomerKey(fqn, customerKeyFromContext(ct)); errstr != "" {
+		t.invalmsghdlr(w, r, errstr, errcode)
+		return
+	}
+
 	//
 	// local file => http response
 	//
 	if size == 0 {
 		glog.Warningf("Unexpected: object %s/%s size is 0 (zero)", bucket, objname)
 	}
+	if rng != nil {
+		var ok bool
+		if offset, length, ok = rng.resolve(size); !ok {
+			w.Header().Set(HeaderContentRange, "bytes */"+strconv.FormatInt(size, 10))
+			errstr = fmt.Sprintf("%s %s/%s: not satisfiable, the size is %d", rng, bucket, objname, size)
+			t.invalmsghdlr(w, r, errstr, http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		w.Header().Set(HeaderContentRange, contentRange(offset, length, size))
+		w.Header().Set("Content-Length", strconv.FormatInt(length, 10))
+		readRange = true
+	}
+	w.Header().Set(HeaderAcceptRanges, "bytes")
 	returnRangeChecksum := readRange && cksumcfg.EnableReadRangeChecksum
 	if !coldget && !returnRangeChecksum && cksumcfg.Checksum != ChecksumNone {
 		hashbinary, errstr := Getxattr(fqn, XattrXXHashVal)
@@ -473,6 +622,9 @@ existslocally:
 			nhobj = newcksumvalue(cksumcfg.Checksum, string(hashbinary))
 		}
 	}
+	if stale != "" {
+		w.Header().Set(HeaderWarning, stale)
+	}
 	if nhobj != nil && !returnRangeChecksum {
 		htype, hval := nhobj.get()
 		w.Header().Add(HeaderDfcChecksumType, htype)
@@ -482,7 +634,7 @@ existslocally:
 		w.Header().Add(HeaderDfcObjVersion, props.version)
 	}
 
-	file, err := os.Open(fqn)
+	file, _, err := openObject(fqn)
 	if err != nil {
 		if os.IsPermission(err) {
 			errstr = fmt.Sprintf("Permission denied: access forbidden to %s", fqn)
@@ -518,17 +670,22 @@ existslocally:
 	}
 
 	var written int64
+	if rng != nil {
+		w.WriteHeader(http.StatusPartialContent)
+	}
+	out := t.egressWriter(bucket, w)
 	if readRange {
 		reader := io.NewSectionReader(file, offset, length)
-		written, err = io.CopyBuffer(w, reader, buf)
+		written, err = io.CopyBuffer(out, reader, buf)
 	} else {
 		// copy
-		written, err = io.CopyBuffer(w, file, buf)
+		written, err = io.CopyBuffer(out, file, buf)
 	}
 	if err != nil {
 		errstr = fmt.Sprintf("Failed to send file %s, err: %v", fqn, err)
 		glog.Errorln(t.errHTTP(r, errstr, http.StatusInternalServerError))
 		t.statsif.add("numerr", 1)
+		t.addBucketStats(bucket, "numerr", int64(1))
 		return
 	}
 	if !coldget {
@@ -557,6 +714,14 @@ existslocally:
 	)
 
 	t.statsif.addMany("numget", int64(1), "getlatency", int64(delta/1000))
+	switch {
+	case coldget:
+		t.addBucketStats(bucket, "numget", int64(1), "numcoldget", int64(1))
+	case inNextTier:
+		t.addBucketStats(bucket, "numget", int64(1), "numcoldget", int64(1), "bytescached", props.size)
+	default:
+		t.addBucketStats(bucket, "numget", int64(1))
+	}
 }
 func (t *targetrunner) validateOffsetAndLength(r *http.Request) (
 	offset int64, length int64, readRange bool, errstr string) {
@@ -615,6 +780,16 @@ func (t *targetrunner) httpobjput(w http.ResponseWriter, r *http.Request) {
 			t.invalmsghdlr(w, r, fmt.Sprintf("PUT from an unknown proxy/gateway ID '%s' - Smap out of sync?", pid))
 			return
 		}
+		if !t.validateCustomerKey(w, r, t.bmdowner.get().islocal(bucket)) {
+			return
+		}
+		if errstr := validatePlacementGroup(r); errstr != "" {
+			t.invalmsghdlr(w, r, errstr)
+			return
+		}
+		if !t.checkSmapVersion(w, r) {
+			return
+		}
 		errstr, errcode := t.doput(w, r, bucket, objname)
 		if errstr != "" {
 			if errcode == 0 {
@@ -713,8 +888,31 @@ func (t *targetrunner) httpobjdelete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if objname != "" {
-		err := t.fildelete(t.contextWithAuth(r), bucket, objname, evict)
-		if err != nil {
+		ct := t.contextWithAuth(r)
+		pc, errstr := parsePrecondition(r)
+		if errstr == "" && pc != nil && evict {
+			errstr = fmt.Sprintf("Preconditions (%s, %s) are not supported with %s", HeaderIfMatch, HeaderIfUnmodified, ActEvict)
+		}
+		if errstr != "" {
+			t.invalmsghdlr(w, r, errstr)
+			return
+		}
+		if pc != nil {
+			ct = context.WithValue(ct, ctxPrecond, pc)
+		}
+		islocal := t.bmdowner.get().islocal(bucket)
+		if _, exists := t.findfqn(bucket, objname, islocal); !exists {
+			if islocal && t.redirectLegacyName(w, r, bucket, objname) {
+				return
+			}
+			if t.redirectPlaced(w, r, bucket, objname) {
+				return
+			}
+		}
+		err := t.fildelete(ct, bucket, objname, evict)
+		if cerr, ok := err.(*Error); ok {
+			t.errorhdlr(w, r, cerr)
+		} else if err != nil {
 			s := fmt.Sprintf("Error deleting %s/%s: %v", bucket, objname, err)
 			t.invalmsghdlr(w, r, s)
 		}
@@ -805,11 +1003,67 @@ func (t *targetrunner) httpbckpost(w http.ResponseWriter, r *http.Request) {
 				glog.Infof("LIST %s: %s, %d µs", tag, lbucket, lat)
 			}
 		}
+	case ActLocate:
+		t.locateObjects(w, r, &msg)
+	case ActHeadObjects:
+		t.headObjects(w, r, &msg)
+	case ActImport:
+		t.startImport(w, r, &msg)
+	case ActExport:
+		t.startExport(w, r, &msg)
+	case ActConvert:
+		t.startConvert(w, r, &msg)
+	case ActBackup, ActRestoreBak:
+		t.startBackup(w, r, &msg)
+	case ActBackupStop:
+		t.stopBackup(w, r)
 	default:
 		t.invalmsghdlr(w, r, "Unexpected action "+msg.Action)
 	}
 }
 
+// Reports which of the listed objects are cached by this target. The proxy
+// sends to each target only the objects the target owns
+func (t *targetrunner) locateObjects(w http.ResponseWriter, r *http.Request, msg *ActionMsg) {
+	apitems := t.restAPIItems(r.URL.Path, 5)
+	if apitems = t.checkRestAPI(w, r, apitems, 1, Rversion, Rbuckets); apitems == nil {
+		return
+	}
+	bucket := apitems[0]
+	if !t.validatebckname(w, r, bucket) {
+		return
+	}
+	jsmap, ok := msg.Value.(map[string]interface{})
+	if !ok {
+		t.invalmsghdlr(w, r, fmt.Sprintf("Unexpected Value format %+v, %T", msg.Value, msg.Value))
+		return
+	}
+	listMsg, errstr := parseListMsg(jsmap)
+	if errstr != "" {
+		t.invalmsghdlr(w, r, errstr)
+		return
+	}
+	islocal := t.bmdowner.get().islocal(bucket)
+	if errstr, errcode := t.checkLocalQueryParameter(bucket, r, islocal); errstr != "" {
+		t.invalmsghdlr(w, r, errstr, errcode)
+		return
+	}
+
+	result := &LocateResult{Objects: make([]*ObjectLocation, 0, len(listMsg.Objnames))}
+	for _, objname := range listMsg.Objnames {
+		_, exists := t.findfqn(bucket, objname, islocal)
+		result.Objects = append(result.Objects, &ObjectLocation{
+			Name:      objname,
+			TargetID:  t.si.DaemonID,
+			TargetURL: t.si.DirectURL,
+			IsCached:  exists,
+		})
+	}
+	jsbytes, err := json.Marshal(result)
+	assert(err == nil, err)
+	t.writeJSON(w, r, jsbytes, "locateobjects")
+}
+
 // POST /Rversion/Robjects/bucket-name/object-name
 func (t *targetrunner) httpobjpost(w http.ResponseWriter, r *http.Request) {
 	var msg ActionMsg
@@ -819,6 +1073,10 @@ func (t *targetrunner) httpobjpost(w http.ResponseWriter, r *http.Request) {
 	switch msg.Action {
 	case ActRename:
 		t.renamefile(w, r, msg)
+	case ActRestore:
+		t.restoreobject(w, r, msg)
+	case ActPin, ActUnpin:
+		t.pinobject(w, r, msg.Action == ActPin)
 	default:
 		t.invalmsghdlr(w, r, "Unexpected action "+msg.Action)
 	}
@@ -850,13 +1108,9 @@ func (t *targetrunner) httpbckhead(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if !islocal {
-		bucketprops, errstr, errcode = getcloudif().headbucket(t.contextWithAuth(r), bucket)
-		if errstr != "" {
-			if errcode == 0 {
-				t.invalmsghdlr(w, r, errstr)
-			} else {
-				t.invalmsghdlr(w, r, errstr, errcode)
-			}
+		var cerr *Error
+		if bucketprops, cerr = getcloudif().headbucket(t.contextWithAuth(r), bucket); cerr != nil {
+			t.errorhdlr(w, r, cerr)
 			return
 		}
 	} else {
@@ -868,14 +1122,69 @@ func (t *targetrunner) httpbckhead(w http.ResponseWriter, r *http.Request) {
 	if !t.versioningConfigured(bucket) {
 		bucketprops[Versioning] = VersionNone
 	}
+	_, props := bucketmd.get(bucket, islocal)
+	// encryption requested by DFC overrides the cloud bucket default
+	if props.CloudSSE != "" {
+		bucketprops[CloudSSE] = props.CloudSSE
+		bucketprops[CloudSSEKeyID] = props.CloudSSEKeyID
+	}
+	if props.StorageClass != "" {
+		bucketprops[StorageClass] = props.StorageClass
+	}
+	if props.RequesterPays {
+		bucketprops[RequesterPays] = "enabled"
+	}
 
 	for k, v := range bucketprops {
 		w.Header().Add(k, v)
 	}
-	_, props := bucketmd.get(bucket, islocal)
 	w.Header().Add(NextTierURL, props.NextTierURL)
 	w.Header().Add(ReadPolicy, props.ReadPolicy)
 	w.Header().Add(WritePolicy, props.WritePolicy)
+	w.Header().Add(Fsync, t.fsyncPolicy(bucket))
+	if props.MpathLabel != "" {
+		w.Header().Add(MpathLabel, props.MpathLabel)
+	}
+	if props.Copies > 1 {
+		w.Header().Add(Copies, strconv.Itoa(props.Copies))
+	}
+	if props.IngressLimit != 0 {
+		w.Header().Add(IngressLimit, strconv.FormatInt(props.IngressLimit, 10))
+	}
+	if props.EgressLimit != 0 {
+		w.Header().Add(EgressLimit, strconv.FormatInt(props.EgressLimit, 10))
+	}
+	if props.EgressBudget != 0 {
+		w.Header().Add(EgressBudget, strconv.FormatInt(props.EgressBudget, 10))
+	}
+	if props.Protected {
+		w.Header().Add(Protected, "true")
+	}
+	if props.DestroyAt != 0 {
+		w.Header().Add(DestroyAt, time.Unix(props.DestroyAt, 0).UTC().Format(time.RFC3339))
+	}
+	if props.ServeStale {
+		w.Header().Add(ServeStale, "true")
+		if props.MaxStale != "" {
+			w.Header().Add(MaxStale, props.MaxStale)
+		}
+	}
+	if props.WORM {
+		w.Header().Add(WORM, "true")
+		if props.Retention != "" {
+			w.Header().Add(Retention, props.Retention)
+		}
+	}
+	if props.ECData > 0 {
+		w.Header().Add(ECData, strconv.Itoa(props.ECData))
+		w.Header().Add(ECParity, strconv.Itoa(props.ECParity))
+		w.Header().Add(ECMinSize, strconv.FormatInt(props.ECMinSize, 10))
+	}
+	if props.Encrypt {
+		w.Header().Add(Encryption, "enabled")
+	} else {
+		w.Header().Add(Encryption, "disabled")
+	}
 }
 
 // HEAD /Rversion/Robjects/bucket-name/object-name
@@ -902,12 +1211,18 @@ func (t *targetrunner) httpobjhead(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if islocal || checkCached {
-		fqn := t.fqn(bucket, objname, islocal)
+		fqn := t.lookupfqn(bucket, objname, islocal)
 		var (
 			size    int64
 			version string
 		)
 		if _, size, version, errstr = t.lookupLocally(bucket, objname, fqn); errstr != "" {
+			if islocal && t.redirectLegacyName(w, r, bucket, objname) {
+				return
+			}
+			if t.redirectPlaced(w, r, bucket, objname) {
+				return
+			}
 			status := http.StatusNotFound
 			http.Error(w, http.StatusText(status), status)
 			return
@@ -917,23 +1232,50 @@ func (t *targetrunner) httpobjhead(w http.ResponseWriter, r *http.Request) {
 		objmeta = make(simplekvs)
 		objmeta["size"] = strconv.FormatInt(size, 10)
 		objmeta["version"] = version
+		objmeta[CloudProvider] = ProviderDfc
+		t.cachedObjectMeta(fqn, objmeta)
 		glog.Infoln("httpobjhead FOUND:", bucket, objname, size, version)
 	} else {
-		objmeta, errstr, errcode = getcloudif().headobject(t.contextWithAuth(r), bucket, objname)
-		if errstr != "" {
-			if errcode == 0 {
-				t.invalmsghdlr(w, r, errstr)
-			} else {
-				t.invalmsghdlr(w, r, errstr, errcode)
-			}
+		var cerr *Error
+		if _, exists := t.findfqn(bucket, objname, islocal); !exists && t.redirectPlaced(w, r, bucket, objname) {
+			return
+		}
+		if objmeta, cerr = getcloudif().headobject(t.contextWithAuth(r), bucket, objname); cerr != nil {
+			t.errorhdlr(w, r, cerr)
 			return
 		}
+		t.cachedObjectMeta(t.lookupfqn(bucket, objname, islocal), objmeta)
 	}
 	for k, v := range objmeta {
 		w.Header().Add(k, v)
 	}
 }
 
+// cachedObjectMeta adds to objmeta whether the object is cached and, if it is,
+// its access time and checksum - unless the Cloud has reported one
+func (t *targetrunner) cachedObjectMeta(fqn string, objmeta simplekvs) {
+	finfo, err := os.Stat(fqn)
+	if err != nil {
+		objmeta[Cached] = "false"
+		return
+	}
+	objmeta[Cached] = "true"
+	atime, mtime, _ := getAmTimes(finfo)
+	if cachedatime, ok := getatimerunner().atime(fqn); ok {
+		atime = cachedatime
+	} else if mtime.After(atime) {
+		atime = mtime
+	}
+	objmeta[Atime] = formatTime(atime, "")
+	if _, ok := objmeta[HeaderDfcChecksumVal]; ok {
+		return
+	}
+	if xxhashval, errstr := Getxattr(fqn, XattrXXHashVal); errstr == "" && xxhashval != nil {
+		objmeta[HeaderDfcChecksumType] = ChecksumXXHash
+		objmeta[HeaderDfcChecksumVal] = string(xxhashval)
+	}
+}
+
 // handler for: "/"+Rversion+"/"+Rtokens
 func (t *targetrunner) tokenHandler(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
@@ -997,7 +1339,7 @@ func (t *targetrunner) pushHandler(w http.ResponseWriter, r *http.Request) {
 		}
 
 		for _, objname := range objnames {
-			err := pusher.Push("/"+Rversion+"/"+Robjects+"/"+bucket+"/"+objname, nil)
+			err := pusher.Push(URLEscapedPath(Rversion, Robjects, bucket, objname), nil)
 			if err != nil {
 				t.invalmsghdlr(w, r, "Error Pushing "+bucket+"/"+objname+": "+err.Error())
 				return
@@ -1090,8 +1432,9 @@ func (renctx *renamectx) walkf(fqn string, osfi os.FileInfo, err error) error {
 // and the object should be refreshed from Cloud storage
 // It should be called only in case of the object is present in DFC cache
 func (t *targetrunner) checkCloudVersion(ct context.Context, bucket, objname, version string) (vchanged bool, errstr string, errcode int) {
-	var objmeta simplekvs
-	if objmeta, errstr, errcode = t.cloudif.headobject(ct, bucket, objname); errstr != "" {
+	objmeta, cerr := t.cloudif.headobject(ct, bucket, objname)
+	if cerr != nil {
+		errstr, errcode = cerr.errstrcode()
 		return
 	}
 	if cloudVersion, ok := objmeta["version"]; ok {
@@ -1113,7 +1456,7 @@ func (t *targetrunner) getFromNeighbor(bucket, objname string, r *http.Request,
 		glog.Infof("getFromNeighbor: found %s/%s at %s", bucket, objname, neighsi.DaemonID)
 	}
 
-	geturl := fmt.Sprintf("%s%s?%s=%t", neighsi.DirectURL, r.URL.Path, URLParamLocal, islocal)
+	geturl := fmt.Sprintf("%s%s?%s=%t", neighsi.dataURL(), r.URL.EscapedPath(), URLParamLocal, islocal)
 	//
 	// http request
 	//
@@ -1140,10 +1483,10 @@ func (t *targetrunner) getFromNeighbor(bucket, objname string, r *http.Request,
 		htype   = response.Header.Get(HeaderDfcChecksumType)
 		hdhobj  = newcksumvalue(htype, hval)
 		version = response.Header.Get(HeaderDfcObjVersion)
-		fqn     = t.fqn(bucket, objname, islocal)
-		getfqn  = t.fqn2workfile(fqn)
 	)
-	if _, nhobj, size, errstr = t.receive(getfqn, objname, "", hdhobj, response.Body); errstr != "" {
+	fqn, hrwmpath := t.placefqn(bucket, objname, islocal)
+	getfqn := t.fqn2workfile(fqn)
+	if _, nhobj, size, errstr = t.receive(getfqn, bucket, objname, "", hdhobj, response.Body); errstr != "" {
 		response.Body.Close()
 		glog.Errorf(errstr)
 		return
@@ -1158,11 +1501,11 @@ func (t *targetrunner) getFromNeighbor(bucket, objname string, r *http.Request,
 		}
 	}
 	// commit
-	if err = os.Rename(getfqn, fqn); err != nil {
+	if err = t.commitWorkfile(getfqn, fqn, bucket); err != nil {
 		glog.Errorf("Failed to rename %s => %s, err: %v", getfqn, fqn, err)
 		return
 	}
-	props = &objectProps{version: version, size: size, nhobj: nhobj}
+	props = &objectProps{version: version, size: size, nhobj: nhobj, displaced: hrwmpath}
 	if errstr = t.finalizeobj(fqn, props); errstr != "" {
 		glog.Errorf("finalizeobj %s/%s: %s (%+v)", bucket, objname, errstr, props)
 		props = nil
@@ -1180,13 +1523,15 @@ func (t *targetrunner) coldget(ct context.Context, bucket, objname string, prefe
 		islocal     = bucketmd.islocal(bucket)
 		fqn         = t.fqn(bucket, objname, islocal)
 		uname       = uniquename(bucket, objname)
-		getfqn      = t.fqn2workfile(fqn)
+		getfqn      string
+		hrwmpath    string
 		versioncfg  = &ctx.config.Ver
 		cksumcfg    = &ctx.config.Cksum
 		errv        string
 		nextTierURL string
 		vchanged    bool
 		inNextTier  bool
+		fromCloud   bool
 		bucketProps BucketProps
 	)
 	// one cold GET at a time
@@ -1198,6 +1543,8 @@ func (t *targetrunner) coldget(ct context.Context, bucket, objname string, prefe
 	} else {
 		t.rtnamemap.lockname(uname, true, &pendinginfo{Time: time.Now(), fqn: fqn}, time.Second)
 	}
+	fqn, hrwmpath = t.placefqn(bucket, objname, islocal)
+	getfqn = t.fqn2workfile(fqn)
 	// existence, access & versioning
 	coldget, size, version, eexists := t.lookupLocally(bucket, objname, fqn)
 	if !coldget && eexists == "" && !islocal {
@@ -1230,7 +1577,7 @@ func (t *targetrunner) coldget(ct context.Context, bucket, objname string, prefe
 	// cold
 	_, bucketProps = bucketmd.get(bucket, islocal)
 	nextTierURL = bucketProps.NextTierURL
-	if nextTierURL != "" && bucketProps.ReadPolicy == RWPolicyNextTier {
+	if nextTierURL != "" && bucketProps.ReadPolicy == RWPolicyNextTier && t.tierAvailable(nextTierURL) {
 		if inNextTier, errstr, errcode = t.objectInNextTier(nextTierURL, bucket, objname); errstr != "" {
 			t.rtnamemap.unlockname(uname, true)
 			return
@@ -1243,10 +1590,20 @@ func (t *targetrunner) coldget(ct context.Context, bucket, objname string, prefe
 		}
 	}
 	if !inNextTier || (inNextTier && errstr != "") {
-		if props, errstr, errcode = getcloudif().getobj(ct, getfqn, bucket, objname); errstr != "" {
+		var cerr *Error
+		if errstr, errcode = t.coldMissing(bucket, objname); errstr != "" {
 			t.rtnamemap.unlockname(uname, true)
 			return
 		}
+		if props, cerr = getcloudif().getobj(ct, getfqn, bucket, objname); cerr != nil {
+			if cerr.Status == http.StatusNotFound {
+				t.negcache.add(uname, time.Now())
+			}
+			errstr, errcode = cerr.errstrcode()
+			t.rtnamemap.unlockname(uname, true)
+			return
+		}
+		fromCloud = true
 	}
 	defer func() {
 		if errstr != "" {
@@ -1257,13 +1614,28 @@ func (t *targetrunner) coldget(ct context.Context, bucket, objname string, prefe
 			t.runFSKeeper(fqn)
 		}
 	}()
-	if err := os.Rename(getfqn, fqn); err != nil {
+	if err := t.commitWorkfile(getfqn, fqn, bucket); err != nil {
 		errstr = fmt.Sprintf("Unexpected failure to rename %s => %s, err: %v", getfqn, fqn, err)
 		return
 	}
+	if pgroup, ok := ct.Value(ctxPGroup).(string); ok {
+		props.pgroup = pgroup
+	}
+	props.displaced = hrwmpath
 	if errstr = t.finalizeobj(fqn, props); errstr != "" {
 		return
 	}
+	t.removeDisplaced(bucket, objname, islocal, fqn)
+	if merr := t.mirrorObject(bucket, objname, islocal, fqn); merr != "" {
+		glog.Errorf("Cold GET %s/%s: %s", bucket, objname, merr)
+	}
+	if fromCloud {
+		t.cloudEgress.add(bucket, props.size)
+	}
+	t.addBucketStats(bucket, "bytescached", props.size)
+	if props.cloudcksum != "" {
+		getscrubber().enqueue(fqn)
+	}
 ret:
 	//
 	// NOTE: GET - downgrade and keep the lock, PREFETCH - unlock
@@ -1333,7 +1705,7 @@ func (t *targetrunner) lookupLocally(bucket, objname, fqn string) (coldget bool,
 		}
 		return
 	}
-	size = finfo.Size()
+	size = objectSize(fqn, finfo)
 	if bytes, errs := Getxattr(fqn, XattrObjVersion); errs == "" {
 		version = string(bytes)
 	} else {
@@ -1361,6 +1733,60 @@ func (t *targetrunner) lookupRemotely(bucket, objname string) *daemonInfo {
 	return nil
 }
 
+// lookupPlaced asks the neighbors for the object stored in a placement group;
+// returns the target that stores it and the group, nil if there is none
+func (t *targetrunner) lookupPlaced(bucket, objname string) (*daemonInfo, string) {
+	query := url.Values{}
+	query.Add(URLParamWhat, GetWhatPGroup)
+	res := t.broadcastNeighbors(
+		URLPath(Rversion, Robjects, bucket, objname),
+		query,
+		http.MethodGet,
+		nil,
+		t.smapowner.get(),
+		ctx.config.Timeout.MaxKeepalive,
+	)
+
+	for r := range res {
+		if r.err != nil {
+			continue
+		}
+		var pgroup string
+		if err := json.Unmarshal(r.outjson, &pgroup); err == nil && pgroup != "" {
+			return r.si, pgroup
+		}
+	}
+
+	return nil, ""
+}
+
+// redirectPlaced handles a request that does not specify the placement group
+// of an object the target does not have: the object may belong to a group and
+// be stored by the target of the group. Redirects the request, with the group
+// added, to that target; returns false if no target stores the object in a group.
+// Buckets that have never had objects in groups are not looked up
+func (t *targetrunner) redirectPlaced(w http.ResponseWriter, r *http.Request, bucket, objname string) bool {
+	query := r.URL.Query()
+	if query.Get(URLParamPlacementGroup) != "" {
+		return false
+	}
+	bucketmd := t.bmdowner.get()
+	if _, props := bucketmd.get(bucket, bucketmd.islocal(bucket)); !props.PGroups {
+		return false
+	}
+	si, pgroup := t.lookupPlaced(bucket, objname)
+	if si == nil {
+		return false
+	}
+	query.Set(URLParamPlacementGroup, pgroup)
+	redirecturl := si.DirectURL + r.URL.EscapedPath() + "?" + query.Encode()
+	if glog.V(4) {
+		glog.Infof("%s %s/%s => %s (placement group %s)", r.Method, bucket, objname, si.DaemonID, pgroup)
+	}
+	http.Redirect(w, r, redirecturl, http.StatusTemporaryRedirect)
+	return true
+}
+
 // should not be called for local buckets
 func (t *targetrunner) listCachedObjects(bucket string, msg *GetMsg) (outbytes []byte, errstr string, errcode int) {
 	reslist, err := t.prepareLocalObjectList(bucket, msg)
@@ -1425,6 +1851,7 @@ func (t *targetrunner) prepareLocalObjectList(bucket string, msg *GetMsg) (*Buck
 	// real size of page is set in newFileWalk, so read it from any of results inside loop
 	pageSize := DefaultPageSize
 	allfinfos := make([]*BucketEntry, 0, 0)
+	prefixes := make(map[string]bool)
 	fileCount := 0
 	for r := range ch {
 		if r.failedPath != "" {
@@ -1435,15 +1862,19 @@ func (t *targetrunner) prepareLocalObjectList(bucket string, msg *GetMsg) (*Buck
 		pageSize = r.infos.limit
 		allfinfos = append(allfinfos, r.infos.files...)
 		fileCount += r.infos.fileCount
+		for prefix := range r.infos.prefixes {
+			prefixes[prefix] = true
+		}
 	}
 
-	// sort the result and return only first `pageSize` entries
+	// sort the result and return only first `pageSize` entries:
+	// the proxy merges the sorted pages of all targets
+	ifLess := func(i, j int) bool {
+		return allfinfos[i].Name < allfinfos[j].Name
+	}
+	sort.Slice(allfinfos, ifLess)
 	marker := ""
 	if fileCount > pageSize {
-		ifLess := func(i, j int) bool {
-			return allfinfos[i].Name < allfinfos[j].Name
-		}
-		sort.Slice(allfinfos, ifLess)
 		// set extra infos to nil to avoid memory leaks
 		// see NOTE on https://github.com/golang/go/wiki/SliceTricks
 		for i := pageSize; i < fileCount; i++ {
@@ -1454,8 +1885,9 @@ func (t *targetrunner) prepareLocalObjectList(bucket string, msg *GetMsg) (*Buck
 	}
 
 	bucketList := &BucketList{
-		Entries:    allfinfos,
-		PageMarker: marker,
+		Entries:        allfinfos,
+		PageMarker:     marker,
+		CommonPrefixes: pagePrefixes(prefixes, marker),
 	}
 
 	if strings.Contains(msg.GetProps, GetTargetURL) {
@@ -1463,6 +1895,11 @@ func (t *targetrunner) prepareLocalObjectList(bucket string, msg *GetMsg) (*Buck
 			e.TargetURL = t.si.DirectURL
 		}
 	}
+	if strings.Contains(msg.GetProps, GetPropsTargetID) {
+		for _, e := range bucketList.Entries {
+			e.TargetID = t.si.DaemonID
+		}
+	}
 
 	return bucketList, nil
 }
@@ -1477,13 +1914,9 @@ func (t *targetrunner) getbucketnames(w http.ResponseWriter, r *http.Request) {
 	q := r.URL.Query()
 	localonly, _ := parsebool(q.Get(URLParamLocal))
 	if !localonly {
-		buckets, errstr, errcode := getcloudif().getbucketnames(t.contextWithAuth(r))
-		if errstr != "" {
-			if errcode == 0 {
-				t.invalmsghdlr(w, r, errstr)
-			} else {
-				t.invalmsghdlr(w, r, errstr, errcode)
-			}
+		buckets, cerr := getcloudif().getbucketnames(t.contextWithAuth(r))
+		if cerr != nil {
+			t.errorhdlr(w, r, cerr)
 			return
 		}
 		bucketnames.Cloud = buckets
@@ -1556,7 +1989,9 @@ func (t *targetrunner) listbucket(w http.ResponseWriter, r *http.Request, bucket
 		jsbytes, errstr, errcode = t.listCachedObjects(bucket, &msg)
 	} else {
 		tag = "cloud"
-		jsbytes, errstr, errcode = getcloudif().listbucket(t.contextWithAuth(r), bucket, &msg)
+		var cerr *Error
+		jsbytes, cerr = getcloudif().listbucket(t.contextWithAuth(r), bucket, &msg)
+		errstr, errcode = cerr.errstrcode()
 	}
 	if errstr != "" {
 		if errcode == 0 {
@@ -1589,11 +2024,13 @@ func (t *targetrunner) newFileWalk(bucket string, msg *GetMsg) *allfinfos {
 		strings.Contains(msg.GetProps, GetPropsCtime),    // needCtime
 		strings.Contains(msg.GetProps, GetPropsChecksum), // needChkSum
 		strings.Contains(msg.GetProps, GetPropsVersion),  // needVersion
-		msg,             // GetMsg
-		"",              // lastFilePath - next page marker
-		t,               // targetrunner
-		bucket,          // bucket
-		DefaultPageSize, // limit - maximun number of objects to return
+		msg,               // GetMsg
+		"",                // lastFilePath - next page marker
+		t,                 // targetrunner
+		bucket,            // bucket
+		DefaultPageSize,   // limit - maximun number of objects to return
+		msg.GetDelimiter,  // delimiter
+		map[string]bool{}, // prefixes
 	}
 
 	if msg.GetPageSize != 0 {
@@ -1638,6 +2075,14 @@ func (ci *allfinfos) processRegularFile(fqn string, osfi os.FileInfo) error {
 		return nil
 	}
 
+	// objects in "directories" are listed as common prefixes only
+	if prefix := commonPrefix(relname, ci.prefix, ci.delimiter); prefix != "" {
+		if ci.marker == "" || prefix > ci.marker {
+			ci.prefixes[prefix] = true
+		}
+		return nil
+	}
+
 	if ci.marker != "" && relname <= ci.marker {
 		return nil
 	}
@@ -1647,22 +2092,10 @@ func (ci *allfinfos) processRegularFile(fqn string, osfi os.FileInfo) error {
 	fileInfo := &BucketEntry{Name: relname, Atime: "", IsCached: true}
 	if ci.needAtime {
 		atime, _, _ := getAmTimes(osfi)
-		if ci.msg.GetTimeFormat == "" {
-			fileInfo.Atime = atime.Format(RFC822)
-		} else {
-			fileInfo.Atime = atime.Format(ci.msg.GetTimeFormat)
-		}
+		fileInfo.Atime = formatTime(atime, ci.msg.GetTimeFormat)
 	}
 	if ci.needCtime {
-		t := osfi.ModTime()
-		switch ci.msg.GetTimeFormat {
-		case "":
-			fallthrough
-		case RFC822:
-			fileInfo.Ctime = t.Format(time.RFC822)
-		default:
-			fileInfo.Ctime = t.Format(ci.msg.GetTimeFormat)
-		}
+		fileInfo.Ctime = formatTime(osfi.ModTime(), ci.msg.GetTimeFormat)
 	}
 	if ci.needChkSum {
 		xxhex, errstr := Getxattr(fqn, XattrXXHashVal)
@@ -1676,7 +2109,7 @@ func (ci *allfinfos) processRegularFile(fqn string, osfi os.FileInfo) error {
 			fileInfo.Version = string(version)
 		}
 	}
-	fileInfo.Size = osfi.Size()
+	fileInfo.Size = objectSize(fqn, osfi)
 	ci.files = append(ci.files, fileInfo)
 	ci.lastFilePath = fqn
 	return nil
@@ -1716,26 +2149,30 @@ func (ci *allfinfos) listwalkf(fqn string, osfi os.FileInfo, err error) error {
 // In both case a new checksum is saved to xattrs
 func (t *targetrunner) doput(w http.ResponseWriter, r *http.Request, bucket, objname string) (errstr string, errcode int) {
 	var (
-		file                       *os.File
+		file                       objectReader
 		err                        error
 		hdhobj, nhobj              cksumvalue
 		xxhashval                  string
 		htype, hval, nhtype, nhval string
 		sgl                        *SGLIO
+		written                    int64
 		started                    time.Time
 	)
 	started = time.Now()
 	cksumcfg := &ctx.config.Cksum
 	islocal := t.bmdowner.get().islocal(bucket)
-	fqn := t.fqn(bucket, objname, islocal)
+	fqn, hrwmpath := t.placefqn(bucket, objname, islocal)
 	putfqn := t.fqn2workfile(fqn)
 	hdhobj = newcksumvalue(r.Header.Get(HeaderDfcChecksumType), r.Header.Get(HeaderDfcChecksumVal))
 	if hdhobj != nil {
 		htype, hval = hdhobj.get()
 	}
-	// optimize out if the checksums do match
-	if hdhobj != nil && cksumcfg.Checksum != ChecksumNone {
-		file, err = os.Open(fqn)
+	ct := t.contextWithAuth(r)
+	csekhash := customerKeyHash(customerKeyFromContext(ct))
+	pgroup := r.URL.Query().Get(URLParamPlacementGroup)
+	// optimize out if the checksums do match (and the object is protected with the same key, if any)
+	if hdhobj != nil && cksumcfg.Checksum != ChecksumNone && csekhash == "" && pgroup == "" {
+		file, _, err = openObject(fqn)
 		// exists - compute checksum and compare with the caller's
 		if err == nil {
 			slab := selectslab(0) // unknown size
@@ -1761,7 +2198,15 @@ func (t *targetrunner) doput(w http.ResponseWriter, r *http.Request, bucket, obj
 			}
 		}
 	}
-	if sgl, nhobj, _, errstr = t.receive(putfqn, objname, "", hdhobj, r.Body); errstr != "" {
+	if islocal {
+		if cerr := t.wormCheck(bucket, objname, t.lookupfqn(bucket, objname, islocal)); cerr != nil {
+			return cerr.errstrcode()
+		}
+	}
+	// TODO: there is no object replication across targets yet: once there is, do not
+	// store-and-forward - tee r.Body into concurrent PUTs to the secondary
+	// target(s) while receiving it here, and commit when all copies are written
+	if sgl, nhobj, written, errstr = t.receive(putfqn, bucket, objname, "", hdhobj, t.ingressReader(bucket, r.Body)); errstr != "" {
 		return
 	}
 	if nhobj != nil {
@@ -1774,9 +2219,14 @@ func (t *targetrunner) doput(w http.ResponseWriter, r *http.Request, bucket, obj
 		return
 	}
 	// commit
-	props := &objectProps{nhobj: nhobj}
+	props := &objectProps{nhobj: nhobj, csekhash: csekhash, pgroup: pgroup, displaced: hrwmpath}
 	if sgl == nil {
-		errstr, errcode = t.putCommit(t.contextWithAuth(r), bucket, objname, putfqn, fqn, props, false /*rebalance*/)
+		errstr, errcode = t.putCommit(ct, bucket, objname, putfqn, fqn, props, false /*rebalance*/)
+		if errstr == "" && islocal {
+			if errstr = t.ecEncode(bucket, objname); errstr != "" {
+				errcode = http.StatusInternalServerError
+			}
+		}
 		if errstr == "" {
 			delta := time.Since(started)
 			t.statsdC.Send("put",
@@ -1794,6 +2244,7 @@ func (t *targetrunner) doput(w http.ResponseWriter, r *http.Request, bucket, obj
 
 			lat := int64(delta / 1000)
 			t.statsif.addMany("numput", int64(1), "putlatency", lat)
+			t.addBucketStats(bucket, "numput", int64(1), "bytescached", written)
 			if glog.V(4) {
 				glog.Infof("PUT: %s/%s, %d µs", bucket, objname, lat)
 			}
@@ -1801,7 +2252,7 @@ func (t *targetrunner) doput(w http.ResponseWriter, r *http.Request, bucket, obj
 		return
 	}
 	// FIXME: use xaction
-	go t.sglToCloudAsync(t.contextWithAuth(r), sgl, bucket, objname, putfqn, fqn, props)
+	go t.sglToCloudAsync(ct, sgl, bucket, objname, putfqn, fqn, props)
 	return
 }
 
@@ -1856,6 +2307,7 @@ func (t *targetrunner) putCommit(ct context.Context, bucket, objname, putfqn, fq
 		renamed bool
 	)
 	errstr, errcode, err, renamed = t.doPutCommit(ct, bucket, objname, putfqn, fqn, objprops, rebalance)
+	t.negcache.invalidate(uniquename(bucket, objname))
 	if errstr != "" && !os.IsNotExist(err) && !renamed {
 		if err = os.Remove(putfqn); err != nil {
 			glog.Errorf("Nested error: %s => (remove %s => err: %v)", errstr, putfqn, err)
@@ -1868,30 +2320,34 @@ func (t *targetrunner) putCommit(ct context.Context, bucket, objname, putfqn, fq
 func (t *targetrunner) doPutCommit(ct context.Context, bucket, objname, putfqn, fqn string,
 	objprops *objectProps, rebalance bool) (errstr string, errcode int, err error, renamed bool) {
 	var (
-		file     *os.File
+		file     objectReader
+		cerr     *Error
 		bucketmd = t.bmdowner.get()
 		islocal  = bucketmd.islocal(bucket)
 	)
 
 	if !islocal && !rebalance {
-		if file, err = os.Open(putfqn); err != nil {
+		if file, _, err = openObject(putfqn); err != nil {
 			errstr = fmt.Sprintf("Failed to reopen %s err: %v", putfqn, err)
 			return
 		}
 		_, p := bucketmd.get(bucket, islocal)
-		if p.NextTierURL != "" && p.WritePolicy == RWPolicyNextTier {
+		if p.NextTierURL != "" && p.WritePolicy == RWPolicyNextTier && t.tierAvailable(p.NextTierURL) {
 			if errstr, errcode = t.putObjectNextTier(p.NextTierURL, bucket, objname, file); errstr != "" {
 				glog.Errorf("Error putting bucket/object: %s/%s to next tier, err: %s, HTTP status code: %d",
 					bucket, objname, errstr, errcode)
-				file, err = os.Open(putfqn)
+				file.Close()
+				file, _, err = openObject(putfqn)
 				if err != nil {
 					errstr = fmt.Sprintf("Failed to reopen %s err: %v", putfqn, err)
 				} else {
-					objprops.version, errstr, errcode = getcloudif().putobj(ct, file, bucket, objname, objprops.nhobj)
+					objprops.version, cerr = getcloudif().putobj(ct, file, bucket, objname, objprops.nhobj)
+					errstr, errcode = cerr.errstrcode()
 				}
 			}
 		} else {
-			objprops.version, errstr, errcode = getcloudif().putobj(ct, file, bucket, objname, objprops.nhobj)
+			objprops.version, cerr = getcloudif().putobj(ct, file, bucket, objname, objprops.nhobj)
+			errstr, errcode = cerr.errstrcode()
 		}
 	} else if islocal {
 		if t.versioningConfigured(bucket) {
@@ -1901,7 +2357,9 @@ func (t *targetrunner) doPutCommit(ct context.Context, bucket, objname, putfqn,
 		}
 		_, p := bucketmd.get(bucket, islocal)
 		if p.NextTierURL != "" {
-			if file, err = os.Open(putfqn); err != nil {
+			if !t.tierAvailable(p.NextTierURL) {
+				errstr, errcode = tierDegraded(p.NextTierURL)
+			} else if file, _, err = openObject(putfqn); err != nil {
 				errstr = fmt.Sprintf("Failed to reopen %s err: %v", putfqn, err)
 			} else if errstr, errcode = t.putObjectNextTier(p.NextTierURL, bucket, objname, file); errstr != "" {
 				glog.Errorf("Error putting bucket/object: %s/%s to next tier, err: %s, HTTP status code: %d",
@@ -1909,7 +2367,9 @@ func (t *targetrunner) doPutCommit(ct context.Context, bucket, objname, putfqn,
 			}
 		}
 	}
-	file.Close()
+	if file != nil {
+		file.Close()
+	}
 	if errstr != "" {
 		return
 	}
@@ -1917,8 +2377,16 @@ func (t *targetrunner) doPutCommit(ct context.Context, bucket, objname, putfqn,
 	// when all set and done:
 	uname := uniquename(bucket, objname)
 	t.rtnamemap.lockname(uname, true, &pendinginfo{Time: time.Now(), fqn: fqn}, time.Second)
+	if islocal && !rebalance {
+		// the object may have been PUT in the meantime
+		if cerr := t.wormCheck(bucket, objname, t.lookupfqn(bucket, objname, islocal)); cerr != nil {
+			t.rtnamemap.unlockname(uname, true)
+			errstr, errcode = cerr.errstrcode()
+			return
+		}
+	}
 
-	if err = os.Rename(putfqn, fqn); err != nil {
+	if err = t.commitWorkfile(putfqn, fqn, bucket); err != nil {
 		t.rtnamemap.unlockname(uname, true)
 		errstr = fmt.Sprintf("Failed to rename %s => %s, err: %v", putfqn, fqn, err)
 		return
@@ -1929,6 +2397,8 @@ func (t *targetrunner) doPutCommit(ct context.Context, bucket, objname, putfqn,
 		glog.Errorf("finalizeobj %s/%s: %s (%+v)", bucket, objname, errstr, objprops)
 		return
 	}
+	t.removeDisplaced(bucket, objname, islocal, fqn)
+	errstr = t.mirrorObject(bucket, objname, islocal, fqn)
 	t.rtnamemap.unlockname(uname, true)
 	return
 }
@@ -1941,7 +2411,7 @@ func (t *targetrunner) dorebalance(r *http.Request, from, to, bucket, objname st
 	}
 	var size int64
 	bucketmd := t.bmdowner.get()
-	fqn := t.fqn(bucket, objname, bucketmd.islocal(bucket))
+	fqn := t.lookupfqn(bucket, objname, bucketmd.islocal(bucket))
 	ver := bucketmd.version()
 	if t.si.DaemonID == from {
 		//
@@ -1978,6 +2448,7 @@ func (t *targetrunner) dorebalance(r *http.Request, from, to, bucket, objname st
 		if glog.V(3) {
 			glog.Infof("Rebalance %s/%s from %s to %s (self, %s, ver %d)", bucket, objname, from, to, fqn, ver)
 		}
+		fqn, hrwmpath := t.placefqn(bucket, objname, bucketmd.islocal(bucket))
 		putfqn := t.fqn2workfile(fqn)
 		_, err := os.Stat(fqn)
 		if err != nil && os.IsExist(err) {
@@ -1986,9 +2457,14 @@ func (t *targetrunner) dorebalance(r *http.Request, from, to, bucket, objname st
 		}
 		var (
 			hdhobj = newcksumvalue(r.Header.Get(HeaderDfcChecksumType), r.Header.Get(HeaderDfcChecksumVal))
-			props  = &objectProps{version: r.Header.Get(HeaderDfcObjVersion)}
+			props  = &objectProps{
+				version:   r.Header.Get(HeaderDfcObjVersion),
+				csekhash:  r.Header.Get(HeaderDfcCustomerHash),
+				pgroup:    r.Header.Get(HeaderDfcPlacement),
+				displaced: hrwmpath,
+			}
 		)
-		if _, props.nhobj, size, errstr = t.receive(putfqn, objname, "", hdhobj, r.Body); errstr != "" {
+		if _, props.nhobj, size, errstr = t.receive(putfqn, bucket, objname, "", hdhobj, r.Body); errstr != "" {
 			return
 		}
 		if props.nhobj != nil {
@@ -2023,23 +2499,36 @@ func (t *targetrunner) dorebalance(r *http.Request, from, to, bucket, objname st
 }
 
 func (t *targetrunner) fildelete(ct context.Context, bucket, objname string, evict bool) error {
-	var (
-		errstr  string
-		errcode int
-	)
-	islocal := t.bmdowner.get().islocal(bucket)
+	bucketmd := t.bmdowner.get()
+	islocal := bucketmd.islocal(bucket)
+	_, props := bucketmd.get(bucket, islocal)
+	ec := islocal && props.ECData > 0
 	fqn := t.fqn(bucket, objname, islocal)
 	uname := uniquename(bucket, objname)
 
 	t.rtnamemap.lockname(uname, true, &pendinginfo{Time: time.Now(), fqn: fqn}, time.Second)
 	defer t.rtnamemap.unlockname(uname, true)
+	fqn = t.lookupfqn(bucket, objname, islocal)
+	if islocal && !evict {
+		if cerr := t.wormCheck(bucket, objname, fqn); cerr != nil {
+			return cerr
+		}
+		// a missing object fails below
+		if finfo, err := os.Stat(fqn); err == nil {
+			if pc := preconditionFromContext(ct); pc != nil {
+				if cerr := pc.check(bucket, objname, localObjstate(fqn, finfo)); cerr != nil {
+					return cerr
+				}
+			}
+		}
+	}
 
 	if !islocal && !evict {
-		if errstr, errcode = getcloudif().deleteobj(ct, bucket, objname); errstr != "" {
-			if errcode == 0 {
-				return fmt.Errorf("%s", errstr)
+		if cerr := getcloudif().deleteobj(ct, bucket, objname); cerr != nil {
+			if cerr.Status == http.StatusPreconditionFailed {
+				return cerr
 			}
-			return fmt.Errorf("%d: %s", errcode, errstr)
+			return fmt.Errorf("%d: %s", cerr.Status, cerr.Message)
 		}
 
 		t.statsdC.Send("delete",
@@ -2051,12 +2540,21 @@ func (t *targetrunner) fildelete(ct context.Context, bucket, objname string, evi
 		)
 
 		t.statsif.add("numdelete", 1)
+		t.addBucketStats(bucket, "numdelete", int64(1))
 	}
 
 	finfo, err := os.Stat(fqn)
 	if err != nil {
 		if os.IsNotExist(err) {
+			// the object lost by the target can still be restored from its copies or slices
+			found := !(evict && islocal) && t.removeMirrors(bucket, objname, islocal, nil)
 			if islocal && !evict {
+				if ec && t.ecDelete(bucket, objname) {
+					found = true
+				}
+				if found {
+					return nil
+				}
 				return fmt.Errorf("DELETE local: file %s (local bucket %s, object %s) %s", fqn, bucket, objname, doesnotexist)
 			}
 
@@ -2083,7 +2581,14 @@ func (t *targetrunner) fildelete(ct context.Context, bucket, objname string, evi
 			)
 
 			t.statsif.addMany("filesevicted", int64(1), "bytesevicted", finfo.Size())
+			t.addBucketStats(bucket, "filesevicted", int64(1), "bytesevicted", finfo.Size())
+		} else if islocal {
+			t.addBucketStats(bucket, "numdelete", int64(1))
+			if ec {
+				t.ecDelete(bucket, objname)
+			}
 		}
+		t.removeMirrors(bucket, objname, islocal, nil)
 	}
 	return nil
 }
@@ -2105,25 +2610,59 @@ func (t *targetrunner) renamefile(w http.ResponseWriter, r *http.Request, msg Ac
 	uname := uniquename(bucket, objname)
 	t.rtnamemap.lockname(uname, true, &pendinginfo{Time: time.Now(), fqn: fqn}, time.Second)
 
-	if errstr = t.renameobject(bucket, objname, bucket, newobjname); errstr != "" {
+	if cerr := t.wormCheck(bucket, objname, t.lookupfqn(bucket, objname, islocal)); cerr != nil {
+		t.errorhdlr(w, r, cerr)
+	} else if errstr = t.renameobject(bucket, objname, bucket, newobjname); errstr != "" {
 		t.invalmsghdlr(w, r, errstr)
 	}
 	t.rtnamemap.unlockname(uname, true)
 }
 
-func (t *targetrunner) renameobject(bucketFrom, objnameFrom, bucketTo, objnameTo string) (errstr string) {
-	var si *daemonInfo
-	if si, errstr = HrwTarget(bucketTo, objnameTo, t.smapowner.get()); errstr != "" {
+func (t *targetrunner) restoreobject(w http.ResponseWriter, r *http.Request, msg ActionMsg) {
+	apitems := t.restAPIItems(r.URL.Path, 5)
+	if apitems = t.checkRestAPI(w, r, apitems, 2, Rversion, Robjects); apitems == nil {
+		return
+	}
+	bucket, objname := apitems[0], strings.Join(apitems[1:], "/")
+	if !t.validatebckname(w, r, bucket) {
 		return
 	}
+	restoreMsg := &RestoreMsg{}
+	if msg.Value != nil {
+		b, err := json.Marshal(msg.Value)
+		if err == nil {
+			err = json.Unmarshal(b, restoreMsg)
+		}
+		if err != nil {
+			t.invalmsghdlr(w, r, fmt.Sprintf("Invalid restore parameters %v, err: %v", msg.Value, err))
+			return
+		}
+	}
+	if restoreMsg.Days <= 0 {
+		t.invalmsghdlr(w, r, fmt.Sprintf("Invalid number of days to restore: %d", restoreMsg.Days))
+		return
+	}
+	if cerr := getcloudif().restoreobj(t.contextWithAuth(r), bucket, objname, restoreMsg); cerr != nil {
+		t.errorhdlr(w, r, cerr)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (t *targetrunner) renameobject(bucketFrom, objnameFrom, bucketTo, objnameTo string) (errstr string) {
+	var si *daemonInfo
 	bucketmd := t.bmdowner.get()
 	islocalFrom := bucketmd.islocal(bucketFrom)
-	fqn := t.fqn(bucketFrom, objnameFrom, islocalFrom)
+	fqn := t.lookupfqn(bucketFrom, objnameFrom, islocalFrom)
 	finfo, err := os.Stat(fqn)
 	if err != nil {
 		errstr = fmt.Sprintf("Rename/move: failed to fstat %s (%s/%s), err: %v", fqn, bucketFrom, objnameFrom, err)
 		return
 	}
+	// the renamed object stays in its placement group
+	if si, errstr = HrwTarget(bucketTo, t.placementName(fqn, objnameTo), t.smapowner.get()); errstr != "" {
+		return
+	}
 	// local rename
 	if si.DaemonID == t.si.DaemonID {
 		islocalTo := bucketmd.islocal(bucketTo)
@@ -2134,6 +2673,15 @@ func (t *targetrunner) renameobject(bucketFrom, objnameFrom, bucketTo, objnameTo
 		} else if err := os.Rename(fqn, newfqn); err != nil {
 			errstr = fmt.Sprintf("Failed to rename %s => %s, err: %v", fqn, newfqn, err)
 		} else {
+			if isdisplaced(newfqn) { // back on its HRW mountpath
+				if err := deleteDisplacedXattr(newfqn); err != nil {
+					glog.Errorf("Renamed %s => %s, err: %v", fqn, newfqn, err)
+				}
+			}
+			t.removeMirrors(bucketFrom, objnameFrom, islocalFrom, nil)
+			if merr := t.mirrorObject(bucketTo, objnameTo, islocalTo, newfqn); merr != "" {
+				glog.Errorf("Renamed %s => %s, err: %s", fqn, newfqn, merr)
+			}
 			t.statsdC.Send("rename",
 				statsd.Metric{
 					Type:  statsd.Counter,
@@ -2166,6 +2714,8 @@ func (t *targetrunner) prefetchfiles(w http.ResponseWriter, r *http.Request, msg
 		// Prefetch with List
 		if prefetchMsg, errstr := parseListMsg(jsmap); errstr != "" {
 			t.invalmsghdlr(w, r, errstr+detail)
+		} else if prefetchMsg.Plan {
+			t.planPrefetch(w, r, prefetchMsg, nil)
 		} else {
 			t.prefetchList(w, r, prefetchMsg)
 		}
@@ -2173,6 +2723,8 @@ func (t *targetrunner) prefetchfiles(w http.ResponseWriter, r *http.Request, msg
 		// Prefetch with Range
 		if prefetchRangeMsg, errstr := parseRangeMsg(jsmap); errstr != "" {
 			t.invalmsghdlr(w, r, errstr+detail)
+		} else if prefetchRangeMsg.Plan {
+			t.planPrefetch(w, r, nil, prefetchRangeMsg)
 		} else {
 			t.prefetchRange(w, r, prefetchRangeMsg)
 		}
@@ -2216,6 +2768,8 @@ func (t *targetrunner) sendfile(method, bucket, objname string, destsi *daemonIn
 		xxhashval string
 		errstr    string
 		version   []byte
+		csekhash  []byte
+		pgroup    []byte
 	)
 	if size == 0 {
 		glog.Warningf("Unexpected: %s/%s size is zero", bucket, objname)
@@ -2228,12 +2782,12 @@ func (t *targetrunner) sendfile(method, bucket, objname string, destsi *daemonIn
 		newbucket = bucket
 	}
 	fromid, toid := t.si.DaemonID, destsi.DaemonID // source=self and destination
-	url := destsi.DirectURL + "/" + Rversion + "/" + Robjects + "/"
-	url += newbucket + "/" + newobjname
+	url := destsi.dataURL() + URLEscapedPath(Rversion, Robjects, newbucket, newobjname)
 	url += fmt.Sprintf("?%s=%s&%s=%s", URLParamFromID, fromid, URLParamToID, toid)
 	islocal := t.bmdowner.get().islocal(bucket)
-	fqn := t.fqn(bucket, objname, islocal)
-	file, err := os.Open(fqn)
+	fqn := t.lookupfqn(bucket, objname, islocal)
+	// encrypted object is sent decrypted: the destination encrypts it with its own data key
+	file, size, err := openObject(fqn)
 	if err != nil {
 		return fmt.Sprintf("Failed to open %q, err: %v", fqn, err)
 	}
@@ -2242,6 +2796,12 @@ func (t *targetrunner) sendfile(method, bucket, objname string, destsi *daemonIn
 	if version, errstr = Getxattr(fqn, XattrObjVersion); errstr != "" {
 		glog.Errorf("Failed to read %q xattr %s, err %s", fqn, XattrObjVersion, errstr)
 	}
+	if csekhash, errstr = Getxattr(fqn, XattrCustomerKeyHash); errstr != "" {
+		glog.Errorf("Failed to read %q xattr %s, err %s", fqn, XattrCustomerKeyHash, errstr)
+	}
+	if pgroup, errstr = Getxattr(fqn, XattrPlacementGroup); errstr != "" {
+		glog.Errorf("Failed to read %q xattr %s, err %s", fqn, XattrPlacementGroup, errstr)
+	}
 
 	slab := selectslab(size)
 	if cksumcfg.Checksum != ChecksumNone {
@@ -2272,6 +2832,13 @@ func (t *targetrunner) sendfile(method, bucket, objname string, destsi *daemonIn
 	if len(version) != 0 {
 		request.Header.Set(HeaderDfcObjVersion, string(version))
 	}
+	// the destination keeps the object protected with the same customer-supplied key
+	if len(csekhash) != 0 {
+		request.Header.Set(HeaderDfcCustomerHash, string(csekhash))
+	}
+	if len(pgroup) != 0 {
+		request.Header.Set(HeaderDfcPlacement, string(pgroup))
+	}
 	// Do
 	contextwith, cancel := context.WithTimeout(context.Background(), ctx.config.Timeout.SendFile)
 	defer cancel()
@@ -2341,6 +2908,28 @@ func (t *targetrunner) checkLocalQueryParameter(bucket string, r *http.Request,
 	return
 }
 
+// A client that sends requests directly to targets computes the location of
+// an object from its cached Smap. The location is valid only if the client's
+// Smap version is the same as the target's - otherwise the request is rejected
+// with 421 (Misdirected Request), and the client retries via proxy
+func (t *targetrunner) checkSmapVersion(w http.ResponseWriter, r *http.Request) bool {
+	verstr := r.URL.Query().Get(URLParamSmapVersion)
+	if verstr == "" {
+		return true
+	}
+	version, err := strconv.ParseInt(verstr, 10, 64)
+	if err != nil {
+		t.invalmsghdlr(w, r, fmt.Sprintf("Invalid URL query parameter: %s=%s (expecting int)", URLParamSmapVersion, verstr))
+		return false
+	}
+	if smapver := t.smapowner.get().version(); version != smapver {
+		s := fmt.Sprintf("Smap version %d differs from the version %d at %s", version, smapver, t.si.DaemonID)
+		t.invalmsghdlr(w, r, s, http.StatusMisdirectedRequest)
+		return false
+	}
+	return true
+}
+
 //===========================
 //
 // control plane
@@ -2414,6 +3003,18 @@ func (t *targetrunner) httpdaeput(w http.ResponseWriter, r *http.Request) {
 		}
 	case ActShutdown:
 		_ = syscall.Kill(syscall.Getpid(), syscall.SIGINT)
+	case ActInjectFault, ActClearFaults:
+		t.httpfaults(w, r, &msg)
+	case ActResetStats:
+		t.resetStats()
+	case ActBenchmark:
+		t.startBenchmark(w, r, &msg)
+	case ActSelfTest:
+		t.httpselftest(w, r, &msg)
+	case ActRotateID:
+		t.rotateDaemonID(w, r, &msg)
+	case ActClaimEpoch:
+		t.claimEpoch(w, r, &msg)
 	default:
 		s := fmt.Sprintf("Unexpected ActionMsg <- JSON [%v]", msg)
 		t.invalmsghdlr(w, r, s)
@@ -2528,6 +3129,83 @@ func (t *targetrunner) httpdaeget(w http.ResponseWriter, r *http.Request) {
 			t.invalmsghdlr(w, r, s)
 			return
 		}
+	case GetWhatBenchmark:
+		result, err := loadBenchmark()
+		if err != nil {
+			t.invalmsghdlr(w, r, fmt.Sprintf("Failed to load the benchmark results, err: %v", err))
+			return
+		}
+		if result == nil {
+			t.invalmsghdlr(w, r, "No benchmark results", http.StatusNotFound)
+			return
+		}
+		jsbytes, err = json.Marshal(result)
+		assert(err == nil, err)
+	case GetWhatDaemonID:
+		jsbytes, err = json.Marshal(t.daemonIDInfo())
+		assert(err == nil, err)
+	case GetWhatConnPool:
+		jsbytes, err = json.Marshal(t.connPoolStats())
+		assert(err == nil, err)
+	case GetWhatImport:
+		result, err := t.importResult()
+		if err != nil {
+			t.invalmsghdlr(w, r, fmt.Sprintf("Failed to load the import results, err: %v", err))
+			return
+		}
+		if result == nil {
+			t.invalmsghdlr(w, r, "No import results", http.StatusNotFound)
+			return
+		}
+		jsbytes, err = json.Marshal(result)
+		assert(err == nil, err)
+	case GetWhatExport:
+		result, err := t.exportResult()
+		if err != nil {
+			t.invalmsghdlr(w, r, fmt.Sprintf("Failed to load the export results, err: %v", err))
+			return
+		}
+		if result == nil {
+			t.invalmsghdlr(w, r, "No export results", http.StatusNotFound)
+			return
+		}
+		jsbytes, err = json.Marshal(result)
+		assert(err == nil, err)
+	case GetWhatObjects:
+		page, ok := t.httpwalk(w, r)
+		if !ok {
+			return
+		}
+		jsbytes, err = json.Marshal(page)
+		assert(err == nil, err)
+	case GetWhatConvert:
+		result, err := t.convertResult()
+		if err != nil {
+			t.invalmsghdlr(w, r, fmt.Sprintf("Failed to load the conversion results, err: %v", err))
+			return
+		}
+		if result == nil {
+			t.invalmsghdlr(w, r, "No conversion results", http.StatusNotFound)
+			return
+		}
+		jsbytes, err = json.Marshal(result)
+		assert(err == nil, err)
+	case GetWhatBackup:
+		result, err := t.backupResult()
+		if err != nil {
+			t.invalmsghdlr(w, r, fmt.Sprintf("Failed to load the backup results, err: %v", err))
+			return
+		}
+		if result == nil {
+			t.invalmsghdlr(w, r, "No backup results", http.StatusNotFound)
+			return
+		}
+		jsbytes, err = json.Marshal(result)
+		assert(err == nil, err)
+	case GetWhatBckStats:
+		storageStatsRunner := getstorstatsrunner()
+		jsbytes, err = json.Marshal(storageStatsRunner.bucketStats(r.URL.Query().Get(URLParamBucket)))
+		assert(err == nil, err)
 	default:
 		s := fmt.Sprintf("Unexpected GET request, what: [%s]", getWhat)
 		t.invalmsghdlr(w, r, s)
@@ -2546,6 +3224,8 @@ func (t *targetrunner) getXactionStatsRetriever(kind string) XactionStatsRetriev
 		xactionStatsRetriever = RebalanceTargetStats{}
 	case XactionPrefetch:
 		xactionStatsRetriever = PrefetchTargetStats{}
+	case XactionDestroy:
+		xactionStatsRetriever = DestroyTargetStats{}
 	}
 
 	return xactionStatsRetriever
@@ -2580,6 +3260,10 @@ func (t *targetrunner) httpdaepost(w http.ResponseWriter, r *http.Request) {
 	if apitems = t.checkRestAPI(w, r, apitems, 0, Rversion, Rdaemon); apitems == nil {
 		return
 	}
+	if len(apitems) > 0 && apitems[0] == Rbenchmark {
+		t.benchmarkSink(w, r)
+		return
+	}
 	if len(apitems) > 0 && apitems[0] == Rregister {
 		if glog.V(3) {
 			glog.Infoln("Sending register signal to target keepalive control channel")
@@ -2611,22 +3295,50 @@ func (t *targetrunner) httpdaedelete(w http.ResponseWriter, r *http.Request) {
 // xxhash is always preferred over md5
 //
 //==============================================================================================
-func (t *targetrunner) receive(fqn string, objname, omd5 string, ohobj cksumvalue,
+func (t *targetrunner) receive(fqn string, bucket, objname, omd5 string, ohobj cksumvalue,
 	reader io.Reader) (sgl *SGLIO, nhobj cksumvalue, written int64, errstr string) {
+	return t.receiveObject(fqn, bucket, objname, omd5, ohobj, reader, false)
+}
+
+// receiveNoCksum receives the object without computing its checksum (see checksum offload)
+func (t *targetrunner) receiveNoCksum(fqn string, bucket, objname string, reader io.Reader) (written int64, errstr string) {
+	_, _, written, errstr = t.receiveObject(fqn, bucket, objname, "", nil, reader, true)
+	return
+}
+
+func (t *targetrunner) receiveObject(fqn string, bucket, objname, omd5 string, ohobj cksumvalue,
+	reader io.Reader, nocksum bool) (sgl *SGLIO, nhobj cksumvalue, written int64, errstr string) {
 	var (
 		err                  error
 		file                 *os.File
 		filewriter           io.Writer
+		encrypter            *encryptWriter
+		direct               *directWriter
 		ohtype, ohval, nhval string
 		cksumcfg             = &ctx.config.Cksum
 	)
 
+	if errstr = t.faults.diskWriteError(fqn); errstr != "" {
+		return
+	}
 	if file, err = CreateFile(fqn); err != nil {
 		t.runFSKeeper(fqn)
 		errstr = fmt.Sprintf("Failed to create %s, err: %s", fqn, err)
 		return
 	}
 	filewriter = file
+	if direct = newDirectWriter(file); direct != nil {
+		filewriter = direct
+	}
+	// checksums are computed over plaintext, so encryption wraps the file only
+	if t.encryptionEnabled(bucket) {
+		if encrypter, errstr = encryptObject(fqn, filewriter); errstr != "" {
+			file.Close()
+			os.Remove(fqn)
+			return
+		}
+		filewriter = encrypter
+	}
 	slab := selectslab(0)
 	buf := slab.alloc()
 	defer func() { // free & cleanup on err
@@ -2634,6 +3346,9 @@ func (t *targetrunner) receive(fqn string, objname, omd5 string, ohobj cksumvalu
 		if errstr == "" {
 			return
 		}
+		if direct != nil {
+			direct.flush()
+		}
 		t.runFSKeeper(fqn)
 		if err = file.Close(); err != nil {
 			glog.Errorf("Nested: failed to close received file %s, err: %v", fqn, err)
@@ -2643,7 +3358,11 @@ func (t *targetrunner) receive(fqn string, objname, omd5 string, ohobj cksumvalu
 		}
 	}()
 	// receive and checksum
-	if cksumcfg.Checksum != ChecksumNone {
+	if nocksum {
+		if written, errstr = ReceiveAndChecksum(filewriter, reader, buf); errstr != "" {
+			return
+		}
+	} else if cksumcfg.Checksum != ChecksumNone {
 		assert(cksumcfg.Checksum == ChecksumXXHash)
 		xx := xxhash.New64()
 		if written, errstr = ReceiveAndChecksum(filewriter, reader, buf, xx); errstr != "" {
@@ -2710,6 +3429,22 @@ func (t *targetrunner) receive(fqn string, objname, omd5 string, ohobj cksumvalu
 			return
 		}
 	}
+	if encrypter != nil {
+		if err = encrypter.Close(); err != nil {
+			errstr = fmt.Sprintf("Failed to encrypt received file %s, err: %v", fqn, err)
+			return
+		}
+	}
+	if direct != nil {
+		if err = direct.flush(); err != nil {
+			errstr = fmt.Sprintf("Failed to write received file %s, err: %v", fqn, err)
+			return
+		}
+	}
+	if err = t.syncfile(file, bucket); err != nil {
+		errstr = fmt.Sprintf("Failed to sync received file %s, err: %v", fqn, err)
+		return
+	}
 	if err = file.Close(); err != nil {
 		errstr = fmt.Sprintf("Failed to close received file %s, err: %v", fqn, err)
 	}
@@ -2731,14 +3466,20 @@ func (t *targetrunner) testingFSPpaths() bool {
 
 // (bucket, object) => (local hashed path, fully qualified name aka fqn)
 func (t *targetrunner) fqn(bucket, objname string, islocal bool) string {
-	mpath := hrwMpath(bucket, objname)
-	if islocal {
-		return filepath.Join(makePathLocal(mpath), bucket, objname)
-	}
-	return filepath.Join(makePathCloud(mpath), bucket, objname)
+	return mpath2fqn(t.homeMpath(bucket, objname), bucket, objname, islocal)
 }
 
 // the opposite
+// Returns the name that defines the placement of a stored object: the object
+// name or the placement group recorded in the object's xattr
+func (t *targetrunner) placementName(fqn, objname string) string {
+	pgroup, errstr := Getxattr(fqn, XattrPlacementGroup)
+	if errstr != "" {
+		glog.Errorf("Failed to read %q xattr %s, err %s", fqn, XattrPlacementGroup, errstr)
+	}
+	return hrwName(objname, string(pgroup))
+}
+
 func (t *targetrunner) fqn2bckobj(fqn string) (bucket, objname, errstr string) {
 	fn := func(path string) bool {
 		if strings.HasPrefix(fqn, path) {
@@ -2753,12 +3494,12 @@ func (t *targetrunner) fqn2bckobj(fqn string) (bucket, objname, errstr string) {
 	bucketmd := t.bmdowner.get()
 	for mpath := range ctx.mountpaths.Available {
 		if fn(makePathCloud(mpath) + "/") {
-			ok = len(objname) > 0 && t.fqn(bucket, objname, false) == fqn
+			ok = len(objname) > 0 && (t.fqn(bucket, objname, false) == fqn || isdisplaced(fqn))
 			break
 		}
 		if fn(makePathLocal(mpath) + "/") {
 			islocal := bucketmd.islocal(bucket)
-			ok = islocal && len(objname) > 0 && t.fqn(bucket, objname, true) == fqn
+			ok = islocal && len(objname) > 0 && (t.fqn(bucket, objname, true) == fqn || isdisplaced(fqn))
 			break
 		}
 	}
@@ -2773,6 +3514,10 @@ func (t *targetrunner) fqn2workfile(fqn string) (workfqn string) {
 	assert(strings.HasSuffix(dir, "/"), dir+" : "+base)
 	assert(base != "", dir+" : "+base)
 
+	// the mountpath's work directory is on the same filesystem as the object
+	if mpath := fqn2mpath(fqn); mpath != "" {
+		dir = filepath.Join(mpath, mpathWorkDir) + "/"
+	}
 	tiebreaker := strconv.FormatInt(time.Now().UnixNano(), 16)
 	workfqn = dir + workfileprefix + base + "." + tiebreaker[5:] + "." + t.uxprocess.spid
 	return
@@ -2808,7 +3553,8 @@ func (t *targetrunner) fspath2mpath() {
 		glog.Errorln("FATAL: no fspaths - see README => Configuration and/or fspaths section in the config.sh")
 		os.Exit(1)
 	}
-	for fp := range ctx.config.FSpaths {
+	for fp, label := range ctx.config.FSpaths {
+		label = strings.TrimSpace(label)
 		if len(fp) > 1 {
 			fp = strings.TrimSuffix(fp, "/")
 		}
@@ -2821,7 +3567,7 @@ func (t *targetrunner) fspath2mpath() {
 			glog.Errorf("FATAL: cannot statfs fspath %q, err: %v", fp, err)
 			os.Exit(1)
 		}
-		mp := &mountPath{Path: fp, Fsid: statfs.Fsid}
+		mp := &mountPath{Path: fp, Fsid: statfs.Fsid, Label: label}
 		_, ok := ctx.mountpaths.Available[mp.Path]
 		if ok {
 			glog.Errorf("FATAL: invalid config: duplicated fspath %q", fp)
@@ -2909,8 +3655,8 @@ func (t *targetrunner) startupMpaths() {
 	} else if len(old.Available) != len(ctx.mountpaths.Available) {
 		changed = true
 	} else {
-		for k := range old.Available {
-			if _, ok := ctx.mountpaths.Available[k]; !ok {
+		for k, oldmp := range old.Available {
+			if mp, ok := ctx.mountpaths.Available[k]; !ok || mp.Label != oldmp.Label {
 				changed = true
 			}
 		}
@@ -2932,6 +3678,13 @@ func (t *targetrunner) startupMpaths() {
 	}
 }
 
+// Returns true if new objects of the bucket must be encrypted at rest
+func (t *targetrunner) encryptionEnabled(bucket string) bool {
+	bucketmd := t.bmdowner.get()
+	_, props := bucketmd.get(bucket, bucketmd.islocal(bucket))
+	return props.Encrypt
+}
+
 // versioningConfigured returns true if versioning for a given bucket is enabled
 // NOTE:
 //    AWS bucket versioning can be disabled on the cloud. In this case we do not
@@ -2956,7 +3709,27 @@ func (t *targetrunner) finalizeobj(fqn string, objprops *objectProps) (errstr st
 		}
 	}
 	if objprops.version != "" {
-		errstr = Setxattr(fqn, XattrObjVersion, []byte(objprops.version))
+		if errstr = Setxattr(fqn, XattrObjVersion, []byte(objprops.version)); errstr != "" {
+			return
+		}
+	}
+	if objprops.csekhash != "" {
+		if errstr = Setxattr(fqn, XattrCustomerKeyHash, []byte(objprops.csekhash)); errstr != "" {
+			return
+		}
+	}
+	if objprops.cloudcksum != "" {
+		if errstr = Setxattr(fqn, XattrCloudCksum, []byte(objprops.cloudcksum)); errstr != "" {
+			return
+		}
+	}
+	if objprops.displaced != "" {
+		if errstr = Setxattr(fqn, XattrDisplaced, []byte(objprops.displaced)); errstr != "" {
+			return
+		}
+	}
+	if objprops.pgroup != "" {
+		errstr = Setxattr(fqn, XattrPlacementGroup, []byte(objprops.pgroup))
 	}
 	return
 }
@@ -3033,6 +3806,14 @@ func (t *targetrunner) userFromRequest(r *http.Request) (*authRec, error) {
 func (t *targetrunner) contextWithAuth(r *http.Request) context.Context {
 	ct := context.Background()
 
+	// customer-supplied key is passed to the cloud with the user's credentials
+	if key, _ := customerKey(r); key != nil {
+		ct = context.WithValue(ct, ctxCustomerKey, key)
+	}
+	// objects cached by cold GET join the placement group of the request
+	if pgroup := r.URL.Query().Get(URLParamPlacementGroup); pgroup != "" {
+		ct = context.WithValue(ct, ctxPGroup, pgroup)
+	}
 	if ctx.config.Auth.CredDir == "" || !ctx.config.Auth.Enabled {
 		return ct
 	}
@@ -3068,6 +3849,11 @@ func (t *targetrunner) receiveMeta(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if errstr, status := t.expandSmapDelta(payload); errstr != "" {
+		t.invalmsghdlr(w, r, errstr, status)
+		return
+	}
+
 	newsmap, oldsmap, actionsmap, errstr := t.extractSmap(payload)
 	if errstr != "" {
 		t.invalmsghdlr(w, r, errstr)
@@ -3114,18 +3900,22 @@ func (t *targetrunner) receiveBucketMD(newbucketmd *bucketMD, msg *ActionMsg) (e
 	t.bmdowner.put(newbucketmd)
 	t.bmdowner.Unlock()
 
+	if mpathLabelsChanged(bucketmd, newbucketmd) {
+		go t.runResilver()
+	}
+	t.changedWarmup(bucketmd, newbucketmd)
+	var destroyed bool
 	for bucket := range bucketmd.LBmap {
 		_, ok := newbucketmd.LBmap[bucket]
 		if !ok {
 			glog.Infof("Destroy local bucket %s", bucket)
-			for mpath := range ctx.mountpaths.Available {
-				localbucketfqn := filepath.Join(makePathLocal(mpath), bucket)
-				if err := os.RemoveAll(localbucketfqn); err != nil {
-					glog.Errorf("Failed to destroy local bucket dir %q, err: %v", localbucketfqn, err)
-				}
-			}
+			t.trashLocalBucket(bucket)
+			destroyed = true
 		}
 	}
+	if destroyed {
+		go t.runPurge()
+	}
 	for mpath := range ctx.mountpaths.Available {
 		for bucket := range bucketmd.LBmap {
 			localbucketfqn := filepath.Join(makePathLocal(mpath), bucket)
@@ -3187,6 +3977,7 @@ func (t *targetrunner) receiveSmap(newsmap, oldsmap *Smap, msg *ActionMsg) (errs
 	for _, ln := range infoln {
 		glog.Infoln(ln)
 	}
+	t.startupWarmup()
 	if msg.Action == ActRebalance {
 		go t.runRebalance(newsmap, newtargetid)
 		return
@@ -3275,11 +4066,15 @@ func (t *targetrunner) validateObjectChecksum(fqn string, checksumAlgo string, s
 	}
 
 	if hashbinary == nil {
+		// checksum offload: the object may have the cloud checksum yet to be verified
+		if val, _ := Getxattr(fqn, XattrCloudCksum); val != nil {
+			return t.verifyCloudCksum(fqn)
+		}
 		glog.Warningf("%s has no checksum - cannot validate", fqn)
 		return true, ""
 	}
 
-	file, err := os.Open(fqn)
+	file, _, err := openObject(fqn)
 	if err != nil {
 		errstr := fmt.Sprintf("Failed to read object %s, err: %v", fqn, err)
 		return false, errstr
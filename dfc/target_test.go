@@ -0,0 +1,31 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import "time"
+
+// newTestTarget returns the target of a single-target cluster for unit tests:
+// with the local buckets and the mock Cloud with the Cloud buckets. The target
+// stores objects on ctx.mountpaths, set up by the test
+func newTestTarget(buckets map[string]BucketProps, cloudbuckets ...string) (*targetrunner, *mockcloud) {
+	target := &targetrunner{uxprocess: &uxprocess{time.Now(), "1f", 0x1f}}
+	target.si = &daemonInfo{DaemonID: "target"}
+	target.statsif = &storstatsrunner{}
+	target.rtnamemap = newrtnamemap(16)
+	target.xactinp = newxactinp()
+	target.bmdowner = &bmdowner{}
+	bucketmd := newBucketMD()
+	for bucket, props := range buckets {
+		bucketmd.add(bucket, true, props)
+	}
+	target.bmdowner.put(bucketmd)
+	target.smapowner = &smapowner{}
+	smap := newSmap()
+	smap.addTarget(target.si)
+	target.smapowner.put(smap)
+	m := newMockCloud(target, cloudbuckets...)
+	target.cloudif = m
+	return target, m
+}
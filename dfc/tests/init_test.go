@@ -14,6 +14,7 @@ import (
 	"github.com/NVIDIA/dfcpub/dfc"
 	"github.com/NVIDIA/dfcpub/pkg/client"
 	"github.com/NVIDIA/dfcpub/pkg/client/readers"
+	"github.com/NVIDIA/dfcpub/pkg/minicluster"
 )
 
 const (
@@ -59,6 +60,7 @@ var (
 	multiProxyTestDuration time.Duration
 	clichecksum            string
 	cycles                 int
+	localcluster           string
 
 	clibucket string
 	proxyurl  string
@@ -97,6 +99,8 @@ func init() {
 	flag.IntVar(&cycles, "cycles", 15, "Number of PUT cycles")
 	flag.DurationVar(&proxyChangeLatency, "proxychangelatency", time.Second*30,
 		"Time for cluster to stablize after a proxy change")
+	flag.StringVar(&localcluster, "minicluster", "",
+		"<proxies>:<targets> - run the tests against a local cluster of processes started by the tests instead of -url")
 
 	flag.Parse()
 
@@ -121,6 +125,21 @@ func TestMain(m *testing.M) {
 		os.Exit(1)
 	}
 
+	var cluster *minicluster.Cluster
+	if localcluster != "" {
+		var cfg minicluster.Config
+		if _, err := fmt.Sscanf(localcluster, "%d:%d", &cfg.Proxies, &cfg.Targets); err != nil {
+			fmt.Printf("Invalid -minicluster %q, expecting <proxies>:<targets>\n", localcluster)
+			os.Exit(1)
+		}
+		c, err := minicluster.Start(cfg)
+		if err != nil {
+			fmt.Printf("Failed to start cluster, err = %v\n", err)
+			os.Exit(1)
+		}
+		cluster, proxyurl = c, c.ProxyURL()
+	}
+
 	// primary proxy can change if proxy tests are run and no new cluster is re-deployed before each test
 	// find out who is the current primary proxy
 	url, err := client.GetPrimaryProxy(proxyurl)
@@ -130,5 +149,11 @@ func TestMain(m *testing.M) {
 	}
 
 	proxyurl = url
-	os.Exit(m.Run())
+	code := m.Run()
+	if cluster != nil {
+		if err := cluster.Stop(); err != nil {
+			fmt.Printf("Failed to stop cluster, err = %v\n", err)
+		}
+	}
+	os.Exit(code)
 }
@@ -703,11 +703,15 @@ func TestHeadObject(t *testing.T) {
 		t.Fatalf("client.Put failed, err = %v", err)
 	}
 
-	propsExp := &client.ObjectProps{Size: fileSize, Version: "1"}
+	propsExp := &client.ObjectProps{Size: fileSize, Version: "1", CloudProvider: dfc.ProviderDfc, Cached: true}
 	props, err := client.HeadObject(proxyurl, TestLocalBucketName, fileName)
 	if err != nil {
-		t.Errorf("client.HeadObject failed, err = %v", err)
+		t.Fatalf("client.HeadObject failed, err = %v", err)
 	}
+	if props.Atime == "" || props.Checksum == "" {
+		t.Errorf("Expected the access time and checksum of the object, got %+v", props)
+	}
+	propsExp.Atime, propsExp.ChecksumType, propsExp.Checksum = props.Atime, props.ChecksumType, props.Checksum
 
 	if !reflect.DeepEqual(props, propsExp) {
 		t.Errorf("Returned object props not correct. Expected: %v, actual: %v", propsExp, props)
@@ -1353,6 +1357,103 @@ func verifyInvalidParams(t *testing.T, bucketName string, fileName string, offse
 	}
 }
 
+func TestRangeHeaderRead(t *testing.T) {
+	var (
+		fileNameChannel = make(chan string, 1)
+		errorChannel    = make(chan error, 1)
+		fileSize        = uint64(1024)
+		full, part      bytes.Buffer
+	)
+	created := createLocalBucketIfNotExists(t, proxyurl, clibucket)
+	putRandomFiles(0, int64(137), fileSize, 1, clibucket, t, nil, errorChannel, fileNameChannel, RangeGetDir, RangeGetStr, "", true, nil)
+	selectErr(errorChannel, "put", t, true)
+	objname := RangeGetStr + "/" + <-fileNameChannel
+	defer func() {
+		if err := client.Del(proxyurl, clibucket, objname, nil, nil, true); err != nil {
+			t.Errorf("Failed to delete %s/%s: %v", clibucket, objname, err)
+		}
+		if created {
+			if err := client.DestroyLocalBucket(proxyurl, clibucket); err != nil {
+				t.Errorf("Failed to delete local bucket: %v", err)
+			}
+		}
+	}()
+
+	if _, _, err := client.GetFile(proxyurl, clibucket, objname, nil, nil, true, false, &full); err != nil {
+		t.Fatalf("Failed to get %s/%s: %v", clibucket, objname, err)
+	}
+	for _, test := range []struct {
+		offset, length int64
+		expected       []byte
+	}{
+		{0, 1, full.Bytes()[:1]},
+		{100, 200, full.Bytes()[100:300]},
+		{1000, 0, full.Bytes()[1000:]},
+		{1000, 100, full.Bytes()[1000:]},
+	} {
+		part.Reset()
+		n, err := client.GetRange(proxyurl, clibucket, objname, test.offset, test.length, &part)
+		if err != nil {
+			t.Errorf("Failed to get the range %d+%d: %v", test.offset, test.length, err)
+			continue
+		}
+		if n != int64(len(test.expected)) || !bytes.Equal(part.Bytes(), test.expected) {
+			t.Errorf("Range %d+%d: got %d bytes, expected %d", test.offset, test.length, n, len(test.expected))
+		}
+	}
+	_, err := client.GetRange(proxyurl, clibucket, objname, int64(fileSize), 1, ioutil.Discard)
+	if herr, ok := err.(*client.HTTPError); !ok || herr.Status != http.StatusRequestedRangeNotSatisfiable {
+		t.Errorf("Expected %d for the range past the end of the object, got %v", http.StatusRequestedRangeNotSatisfiable, err)
+	}
+}
+
+func TestConditionalDelete(t *testing.T) {
+	var (
+		fileNameChannel = make(chan string, 1)
+		errorChannel    = make(chan error, 1)
+		deleted         bool
+	)
+	created := createLocalBucketIfNotExists(t, proxyurl, clibucket)
+	putRandomFiles(0, int64(139), uint64(1024), 1, clibucket, t, nil, errorChannel, fileNameChannel, RangeGetDir, RangeGetStr, "", true, nil)
+	selectErr(errorChannel, "put", t, true)
+	objname := RangeGetStr + "/" + <-fileNameChannel
+	defer func() {
+		if !deleted {
+			client.Del(proxyurl, clibucket, objname, nil, nil, true)
+		}
+		if created {
+			if err := client.DestroyLocalBucket(proxyurl, clibucket); err != nil {
+				t.Errorf("Failed to delete local bucket: %v", err)
+			}
+		}
+	}()
+
+	props, err := client.HeadObject(proxyurl, clibucket, objname)
+	if err != nil {
+		t.Fatalf("Failed to HEAD %s/%s: %v", clibucket, objname, err)
+	}
+	current := props.Version
+	if current == "" {
+		current = props.Checksum
+	}
+	if current == "" {
+		t.Skip("Objects have neither versions nor checksums")
+	}
+	if err = client.DeleteIf(proxyurl, clibucket, objname, []string{"stale"}, time.Time{}); !client.IsPreconditionFailed(err) {
+		t.Fatalf("Expected %d for the stale version, got %v", http.StatusPreconditionFailed, err)
+	}
+	if err = client.DeleteIf(proxyurl, clibucket, objname, nil, time.Now().Add(-time.Hour)); !client.IsPreconditionFailed(err) {
+		t.Fatalf("Expected %d for the object modified since, got %v", http.StatusPreconditionFailed, err)
+	}
+	if err = client.DeleteIf(proxyurl, clibucket, objname, []string{"stale", current}, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("Failed to delete %s/%s: %v", clibucket, objname, err)
+	}
+	deleted = true
+	if _, err = client.HeadObject(proxyurl, clibucket, objname); !client.IsNotFound(err) {
+		t.Errorf("Expected %s/%s to be deleted, got %v", clibucket, objname, err)
+	}
+}
+
 func Test_checksum(t *testing.T) {
 	if testing.Short() {
 		t.Skip("Long run only")
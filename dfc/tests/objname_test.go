@@ -0,0 +1,96 @@
+// Package dfc provides distributed file-based cache with Amazon and Google Cloud backends.
+//
+// Example run:
+// 	go test -v -run=SpecialCharacters -args -bucket=<cloud-bucket>
+//
+// Runs against a local bucket and, if the -bucket is a Cloud one, against
+// the Cloud provider the cluster is deployed with (AWS or GCP).
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc_test
+
+import (
+	"bytes"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/NVIDIA/dfcpub/pkg/client"
+	"github.com/NVIDIA/dfcpub/pkg/client/readers"
+)
+
+const specialCharsDir = "special-chars"
+
+// object names that are special in URLs
+var specialCharsObjnames = []string{
+	"question?mark",
+	"hash#tag",
+	"with space",
+	"plus+sign",
+	"percent%20encoded",
+	"percent%",
+	"ampersand&equals=",
+	"semicolon;colon:at@",
+	"quote'double\"",
+	"brackets[]{}<>",
+	"unicode-ü-日本",
+	"sub dir/nested?name#frag",
+}
+
+func TestSpecialCharactersObjnames(t *testing.T) {
+	if err := client.CreateLocalBucket(proxyurl, TestLocalBucketName); err != nil {
+		t.Fatal(err)
+	}
+	defer client.DestroyLocalBucket(proxyurl, TestLocalBucketName)
+	t.Run("local", func(t *testing.T) { specialCharsRoundTrip(t, TestLocalBucketName) })
+
+	if !isCloudBucket(t, proxyurl, clibucket) {
+		t.Skipf("skipping Cloud bucket test - bucket: %s is not a cloud bucket", clibucket)
+	}
+	t.Run("cloud", func(t *testing.T) { specialCharsRoundTrip(t, clibucket) })
+}
+
+// specialCharsRoundTrip PUTs, HEADs, GETs, lists and DELETEs every object
+func specialCharsRoundTrip(t *testing.T, bucket string) {
+	const fileSize = 1024
+	for _, objname := range specialCharsObjnames {
+		objname = specialCharsDir + "/" + objname
+		r, err := readers.NewRandReader(fileSize, true /* withHash */)
+		checkFatal(err, t)
+		if err = client.Put(proxyurl, r, bucket, objname, true); err != nil {
+			t.Errorf("PUT %q failed: %v", objname, err)
+			continue
+		}
+		props, err := client.HeadObject(proxyurl, bucket, objname)
+		if err != nil || props.Size != fileSize {
+			t.Errorf("HEAD %q: unexpected props %+v, err: %v", objname, props, err)
+		}
+		w := &bytes.Buffer{}
+		if n, _, err := client.GetFile(proxyurl, bucket, objname, nil, nil, true, true, w); err != nil || n != fileSize {
+			t.Errorf("GET %q: read %d bytes, err: %v", objname, n, err)
+		}
+	}
+
+	objnames, err := client.ListObjects(proxyurl, bucket, specialCharsDir+"/", 0)
+	checkFatal(err, t)
+	expected := make([]string, 0, len(specialCharsObjnames))
+	for _, objname := range specialCharsObjnames {
+		expected = append(expected, specialCharsDir+"/"+objname)
+	}
+	sort.Strings(expected)
+	sort.Strings(objnames)
+	if !reflect.DeepEqual(objnames, expected) {
+		t.Errorf("Listed %q, expected %q", objnames, expected)
+	}
+
+	for _, objname := range expected {
+		if err = client.Del(proxyurl, bucket, objname, nil, nil, true); err != nil {
+			t.Errorf("DELETE %q failed: %v", objname, err)
+		}
+	}
+	if objnames, err = client.ListObjects(proxyurl, bucket, specialCharsDir+"/", 0); err != nil || len(objnames) != 0 {
+		t.Errorf("Expected no objects after DELETE, got %q, err: %v", objnames, err)
+	}
+}
@@ -205,10 +205,52 @@ func prefixLookupCornerCases(t *testing.T) {
 	}
 }
 
+func prefixLookupDelimiter(t *testing.T) {
+	tlogf("Testing listing with delimiter\n")
+
+	type testProps struct {
+		prefix   string
+		objCount int
+		prefixes []string
+	}
+	tests := []testProps{
+		{"dir1/", 0, []string{"dir1/dir2/"}},
+		{"dir1/dir2/", 2, nil},
+		{"dir", 0, []string{"dir/", "dir1/"}},
+	}
+
+	for idx, test := range tests {
+		p := fmt.Sprintf("%s/%s", prefixDir, test.prefix)
+		tlogf("%d. Prefix: %s, delimiter: /\n", idx, p)
+		var msg = &dfc.GetMsg{GetPrefix: p, GetDelimiter: "/"}
+		objList, err := client.ListBucket(proxyurl, clibucket, msg, 0)
+		if err != nil {
+			t.Errorf("List files with delimiter failed, err = %v", err)
+			return
+		}
+
+		if len(objList.Entries) != test.objCount {
+			t.Errorf("Expected number of objects with prefix '%s' is %d but found %d",
+				test.prefix, test.objCount, len(objList.Entries))
+		}
+		if len(objList.CommonPrefixes) != len(test.prefixes) {
+			t.Errorf("Expected common prefixes of '%s': %v, found %v", test.prefix, test.prefixes, objList.CommonPrefixes)
+			continue
+		}
+		for i, cp := range test.prefixes {
+			if objList.CommonPrefixes[i] != prefixDir+"/"+cp {
+				t.Errorf("Expected common prefixes of '%s': %v, found %v", test.prefix, test.prefixes, objList.CommonPrefixes)
+				break
+			}
+		}
+	}
+}
+
 func prefixLookup(t *testing.T) {
 	if prefix == "" {
 		prefixLookupDefault(t)
 		prefixLookupCornerCases(t)
+		prefixLookupDelimiter(t)
 	} else {
 		prefixLookupOne(t)
 	}
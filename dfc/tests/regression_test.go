@@ -181,7 +181,8 @@ func TestCloudListBucketGetTargetURL(t *testing.T) {
 	putRandomFiles(0, seed, filesize, num, bucket, t, nil, errch, filenameCh, SmokeDir, SmokeStr, "", true, sgl)
 	selectErr(errch, "put", t, false)
 
-	msg := &dfc.GetMsg{GetPrefix: prefix, GetPageSize: int(pagesize), GetProps: dfc.GetTargetURL}
+	props := strings.Join([]string{dfc.GetTargetURL, dfc.GetPropsTargetID, dfc.GetPropsStorageClass, dfc.GetPropsIsCached}, ",")
+	msg := &dfc.GetMsg{GetPrefix: prefix, GetPageSize: int(pagesize), GetProps: props}
 	bl, err := client.ListBucket(proxyurl, bucket, msg, num)
 	checkFatal(err, t)
 
@@ -193,6 +194,15 @@ func TestCloudListBucketGetTargetURL(t *testing.T) {
 		if e.TargetURL == "" {
 			t.Error("Target URL in response is empty")
 		}
+		if si, ok := smap.Tmap[e.TargetID]; !ok || si.DirectURL != e.TargetURL {
+			t.Errorf("Target ID %q does not match target URL %s", e.TargetID, e.TargetURL)
+		}
+		if e.StorageClass == "" {
+			t.Errorf("Storage class of %s is empty", e.Name)
+		}
+		if !e.IsCached {
+			t.Errorf("%s is not cached right after PUT", e.Name)
+		}
 		if _, ok := targets[e.TargetURL]; !ok {
 			targets[e.TargetURL] = struct{}{}
 		}
@@ -223,6 +233,527 @@ func TestCloudListBucketGetTargetURL(t *testing.T) {
 	}
 }
 
+func TestCloudListBucketCachedOnly(t *testing.T) {
+	const (
+		num      = 100
+		filesize = uint64(1024)
+		seed     = int64(112)
+	)
+	var (
+		filenameCh = make(chan string, num)
+		errch      = make(chan error, num)
+		sgl        *dfc.SGLIO
+		bucket     = clibucket
+		prefix     = SmokeStr + "cached"
+	)
+
+	if !isCloudBucket(t, proxyurl, clibucket) {
+		t.Skip("TestCloudListBucketCachedOnly test is for cloud buckets only")
+	}
+	if usingSG {
+		sgl = dfc.NewSGLIO(filesize)
+		defer sgl.Free()
+	}
+
+	putRandomFiles(0, seed, filesize, num, bucket, t, nil, errch, filenameCh, SmokeDir, prefix, "", true, sgl)
+	selectErr(errch, "put", t, false)
+	close(filenameCh)
+	names := make([]string, 0, num)
+	for name := range filenameCh {
+		names = append(names, prefix+"/"+name)
+	}
+
+	msg := &dfc.GetMsg{GetPrefix: prefix, GetProps: dfc.GetPropsIsCached + "," + dfc.GetPropsTargetID}
+	bl, err := client.ListBucketCached(proxyurl, bucket, msg, 0)
+	checkFatal(err, t)
+	if len(bl.Entries) != num {
+		t.Errorf("Expected %d cached objects, found %d", num, len(bl.Entries))
+	}
+	for _, e := range bl.Entries {
+		if !e.IsCached || e.TargetID == "" {
+			t.Errorf("Invalid cached object entry: %+v", e)
+		}
+	}
+
+	// evicted objects remain in the cloud but disappear from the cached list
+	evicted := names[:num/2]
+	err = client.EvictList(proxyurl, bucket, evicted, true, 0)
+	checkFatal(err, t)
+	bl, err = client.ListBucketCached(proxyurl, bucket, msg, 0)
+	checkFatal(err, t)
+	if len(bl.Entries) != num-len(evicted) {
+		t.Errorf("Expected %d cached objects after eviction, found %d", num-len(evicted), len(bl.Entries))
+	}
+
+	for _, name := range names {
+		if err = client.Del(proxyurl, bucket, name, nil, nil, true); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestLocateObjects(t *testing.T) {
+	const (
+		num      = 50
+		filesize = uint64(1024)
+		seed     = int64(113)
+		bucket   = TestLocalBucketName
+	)
+	var (
+		filenameCh = make(chan string, num)
+		errch      = make(chan error, num)
+		sgl        *dfc.SGLIO
+		missing    = SmokeStr + "/does-not-exist"
+	)
+
+	if usingSG {
+		sgl = dfc.NewSGLIO(filesize)
+		defer sgl.Free()
+	}
+
+	err := client.CreateLocalBucket(proxyurl, bucket)
+	checkFatal(err, t)
+	defer func() {
+		err = client.DestroyLocalBucket(proxyurl, bucket)
+		checkFatal(err, t)
+	}()
+
+	putRandomFiles(0, seed, filesize, num, bucket, t, nil, errch, filenameCh, SmokeDir, SmokeStr, "", true, sgl)
+	selectErr(errch, "put", t, true)
+	close(filenameCh)
+	names := make([]string, 0, num+1)
+	for name := range filenameCh {
+		names = append(names, SmokeStr+"/"+name)
+	}
+	names = append(names, missing)
+
+	// the listing reports the target that stores each object
+	msg := &dfc.GetMsg{GetProps: dfc.GetPropsTargetID}
+	bl, err := client.ListBucket(proxyurl, bucket, msg, 0)
+	checkFatal(err, t)
+	stored := make(map[string]string, len(bl.Entries))
+	for _, e := range bl.Entries {
+		stored[e.Name] = e.TargetID
+	}
+
+	locations, err := client.LocateObjects(proxyurl, bucket, names)
+	checkFatal(err, t)
+	if len(locations) != len(names) {
+		t.Fatalf("Expected %d locations, got %d", len(names), len(locations))
+	}
+	for i, loc := range locations {
+		if loc.Name != names[i] {
+			t.Errorf("Location %d: expected object %s, got %s", i, names[i], loc.Name)
+		}
+		if loc.TargetID == "" || loc.TargetURL == "" {
+			t.Errorf("Object %s: empty target in location %+v", loc.Name, loc)
+		}
+		if loc.Name == missing {
+			if loc.IsCached {
+				t.Errorf("Object %s does not exist but is reported as cached", loc.Name)
+			}
+			continue
+		}
+		if !loc.IsCached {
+			t.Errorf("Object %s is not reported as cached", loc.Name)
+		}
+		if stored[loc.Name] != loc.TargetID {
+			t.Errorf("Object %s: located at %s, stored at %s", loc.Name, loc.TargetID, stored[loc.Name])
+		}
+	}
+}
+
+func TestHeadObjects(t *testing.T) {
+	const (
+		num      = 20
+		filesize = uint64(1024)
+		seed     = int64(117)
+		bucket   = TestLocalBucketName
+	)
+	var (
+		filenameCh = make(chan string, num)
+		errch      = make(chan error, num)
+		missing    = SmokeStr + "/does-not-exist"
+	)
+
+	err := client.CreateLocalBucket(proxyurl, bucket)
+	checkFatal(err, t)
+	defer func() {
+		err = client.DestroyLocalBucket(proxyurl, bucket)
+		checkFatal(err, t)
+	}()
+
+	putRandomFiles(0, seed, filesize, num, bucket, t, nil, errch, filenameCh, SmokeDir, SmokeStr, "", true, nil)
+	selectErr(errch, "put", t, true)
+	close(filenameCh)
+	names := make([]string, 0, num+2)
+	for name := range filenameCh {
+		names = append(names, SmokeStr+"/"+name)
+	}
+	names = append(names, missing, names[0])
+
+	statuses, err := client.HeadObjects(proxyurl, bucket, names, false)
+	checkFatal(err, t)
+	if len(statuses) != len(names) {
+		t.Fatalf("Expected %d statuses, got %d", len(names), len(statuses))
+	}
+	for i, status := range statuses {
+		if status.Name != names[i] {
+			t.Errorf("Status %d: expected object %s, got %s", i, names[i], status.Name)
+		}
+		if status.Error != "" {
+			t.Errorf("Object %s: %s", status.Name, status.Error)
+		}
+		if status.Name == missing {
+			if status.Exists || status.Cached {
+				t.Errorf("Object %s does not exist but is reported as %+v", status.Name, status)
+			}
+			continue
+		}
+		if !status.Exists || !status.Cached || status.Size != int64(filesize) {
+			t.Errorf("Unexpected status of %s: %+v", status.Name, status)
+		}
+	}
+}
+
+func TestBucketStats(t *testing.T) {
+	const (
+		num      = 10
+		filesize = uint64(1024)
+		seed     = int64(131)
+		bucket   = TestLocalBucketName
+	)
+	var (
+		filenameCh = make(chan string, num)
+		errch      = make(chan error, num)
+	)
+
+	err := client.CreateLocalBucket(proxyurl, bucket)
+	checkFatal(err, t)
+	defer func() {
+		err = client.DestroyLocalBucket(proxyurl, bucket)
+		checkFatal(err, t)
+	}()
+	// the targets count since they started
+	before, err := client.BucketStats(proxyurl, bucket)
+	checkFatal(err, t)
+	orig := before.Buckets[bucket]
+	if orig == nil {
+		orig = &dfc.BucketStats{}
+	}
+
+	putRandomFiles(0, seed, filesize, num, bucket, t, nil, errch, filenameCh, SmokeDir, SmokeStr, "", true, nil)
+	selectErr(errch, "put", t, true)
+	close(filenameCh)
+	for name := range filenameCh {
+		_, _, err := client.Get(proxyurl, bucket, SmokeStr+"/"+name, nil, nil, false, false)
+		checkFatal(err, t)
+	}
+
+	report, err := client.BucketStats(proxyurl, bucket)
+	checkFatal(err, t)
+	stats := report.Buckets[bucket]
+	if stats == nil {
+		t.Fatalf("No stats of bucket %s: %+v", bucket, report)
+	}
+	tlogf("Bucket %s: %+v\n", bucket, *stats)
+	if stats.Numput-orig.Numput != num || stats.Numget-orig.Numget != num {
+		t.Errorf("Expected %d PUTs and %d GETs, got %d and %d",
+			num, num, stats.Numput-orig.Numput, stats.Numget-orig.Numget)
+	}
+	if stats.Numcoldget != orig.Numcoldget {
+		t.Errorf("Expected no misses in a local bucket, got %d", stats.Numcoldget-orig.Numcoldget)
+	}
+	if cached := stats.Bytescached - orig.Bytescached; cached != int64(num*filesize) {
+		t.Errorf("Expected %d bytes cached, got %d", num*filesize, cached)
+	}
+	var numget int64
+	for _, targetStats := range report.Targets {
+		if s, ok := targetStats[bucket]; ok {
+			numget += s.Numget
+		}
+	}
+	if numget != stats.Numget {
+		t.Errorf("Expected the targets' GETs to add up to %d, got %d", stats.Numget, numget)
+	}
+}
+
+func TestResetStats(t *testing.T) {
+	const (
+		num      = 5
+		filesize = uint64(1024)
+		seed     = int64(137)
+		bucket   = TestLocalBucketName
+	)
+	var (
+		filenameCh = make(chan string, num)
+		errch      = make(chan error, num)
+		names      []string
+	)
+
+	err := client.CreateLocalBucket(proxyurl, bucket)
+	checkFatal(err, t)
+	defer func() {
+		err = client.DestroyLocalBucket(proxyurl, bucket)
+		checkFatal(err, t)
+	}()
+	putRandomFiles(0, seed, filesize, num, bucket, t, nil, errch, filenameCh, SmokeDir, SmokeStr, "", true, nil)
+	selectErr(errch, "put", t, true)
+	close(filenameCh)
+	for name := range filenameCh {
+		names = append(names, name)
+	}
+
+	err = client.ResetClusterStats(proxyurl)
+	checkFatal(err, t)
+	report, err := client.BucketStats(proxyurl, bucket)
+	checkFatal(err, t)
+	if stats := report.Buckets[bucket]; stats != nil && stats.Numput != 0 {
+		t.Errorf("Expected no PUTs after the reset, got %+v", *stats)
+	}
+	_, _, err = client.Get(proxyurl, bucket, SmokeStr+"/"+names[0], nil, nil, false, false)
+	checkFatal(err, t)
+	report, err = client.BucketStats(proxyurl, bucket)
+	checkFatal(err, t)
+	if stats := report.Buckets[bucket]; stats == nil || stats.Numget != 1 || stats.Numput != 0 {
+		t.Errorf("Expected 1 GET and no PUTs since the reset, got %+v", stats)
+	}
+}
+
+func TestErasureCoding(t *testing.T) {
+	const (
+		num      = 10
+		filesize = uint64(64 * 1024)
+		seed     = int64(111)
+		bucket   = TestLocalBucketName
+	)
+	var (
+		filenameCh = make(chan string, num)
+		errch      = make(chan error, num)
+	)
+	smap, err := client.GetClusterMap(proxyurl)
+	checkFatal(err, t)
+	if len(smap.Tmap) < 4 {
+		t.Skipf("Erasure coding 2+1 requires 4 or more targets, have %d", len(smap.Tmap))
+	}
+
+	err = client.CreateLocalBucket(proxyurl, bucket)
+	checkFatal(err, t)
+	defer func() {
+		err = client.DestroyLocalBucket(proxyurl, bucket)
+		checkFatal(err, t)
+	}()
+	err = client.SetBucketProps(proxyurl, bucket, dfc.BucketProps{ECData: 2, ECParity: 1, ECMinSize: 1024})
+	checkFatal(err, t)
+	props, err := client.HeadBucket(proxyurl, bucket)
+	checkFatal(err, t)
+	if props.ECData != "2" || props.ECParity != "1" || props.ECMinSize != "1024" {
+		t.Fatalf("Unexpected erasure coding properties %s+%s (min size %s)", props.ECData, props.ECParity, props.ECMinSize)
+	}
+
+	putRandomFiles(0, seed, filesize, num, bucket, t, nil, errch, filenameCh, SmokeDir, SmokeStr, "", true, nil)
+	selectErr(errch, "put", t, true)
+	close(filenameCh)
+	for name := range filenameCh {
+		_, _, err := client.Get(proxyurl, bucket, SmokeStr+"/"+name, nil, nil, false, false)
+		checkFatal(err, t)
+	}
+}
+
+func TestMirroring(t *testing.T) {
+	const (
+		num      = 10
+		filesize = uint64(1024)
+		seed     = int64(112)
+		bucket   = TestLocalBucketName
+	)
+	var (
+		filenameCh = make(chan string, num)
+		errch      = make(chan error, num)
+	)
+	err := client.CreateLocalBucket(proxyurl, bucket)
+	checkFatal(err, t)
+	defer func() {
+		err = client.DestroyLocalBucket(proxyurl, bucket)
+		checkFatal(err, t)
+	}()
+	err = client.SetBucketProps(proxyurl, bucket, dfc.BucketProps{Copies: 2})
+	checkFatal(err, t)
+	props, err := client.HeadBucket(proxyurl, bucket)
+	checkFatal(err, t)
+	if props.Copies != "2" {
+		t.Fatalf("Expected 2 copies, got %q", props.Copies)
+	}
+
+	putRandomFiles(0, seed, filesize, num, bucket, t, nil, errch, filenameCh, SmokeDir, SmokeStr, "", true, nil)
+	selectErr(errch, "put", t, true)
+	close(filenameCh)
+	for name := range filenameCh {
+		_, _, err := client.Get(proxyurl, bucket, SmokeStr+"/"+name, nil, nil, false, false)
+		checkFatal(err, t)
+	}
+}
+
+func TestSelfTest(t *testing.T) {
+	testmsg := &dfc.SelfTestMsg{Size: 64 * 1024}
+	if isCloudBucket(t, proxyurl, clibucket) {
+		testmsg.CloudBuckets = []string{clibucket}
+	}
+	smap, err := client.GetClusterMap(proxyurl)
+	checkFatal(err, t)
+
+	report, err := client.SelfTest(proxyurl, testmsg)
+	checkFatal(err, t)
+	counts := make(map[string]int)
+	for _, check := range report.Checks {
+		counts[check.Name]++
+		if !check.Passed {
+			t.Errorf("Self-test check %s failed: target %s, mountpath %q, bucket %q: %s",
+				check.Name, check.Target, check.Mountpath, check.Bucket, check.Error)
+		}
+	}
+	if !report.Passed {
+		t.Errorf("Self-test failed")
+	}
+	if counts[dfc.SelfTestMountpath] < len(smap.Tmap) {
+		t.Errorf("Expected at least %d mountpath checks, got %d", len(smap.Tmap), counts[dfc.SelfTestMountpath])
+	}
+	if counts[dfc.SelfTestObject] != len(smap.Tmap) {
+		t.Errorf("Expected %d object checks, got %d", len(smap.Tmap), counts[dfc.SelfTestObject])
+	}
+	if counts[dfc.SelfTestColdGet] != len(testmsg.CloudBuckets) {
+		t.Errorf("Expected %d cold GET checks, got %d", len(testmsg.CloudBuckets), counts[dfc.SelfTestColdGet])
+	}
+
+	// the temporary bucket is gone
+	buckets, err := client.ListBuckets(proxyurl, true)
+	checkFatal(err, t)
+	for _, bucket := range buckets.Local {
+		if strings.HasPrefix(bucket, "__selftest") {
+			t.Errorf("Self-test bucket %s was not destroyed", bucket)
+		}
+	}
+}
+
+func TestPlacementGroup(t *testing.T) {
+	const (
+		num      = 20
+		filesize = int64(1024)
+		bucket   = TestLocalBucketName
+		pgroup   = "sample-0001"
+	)
+	smap, err := client.GetClusterMap(proxyurl)
+	checkFatal(err, t)
+	if len(smap.Tmap) < 2 {
+		t.Skip("TestPlacementGroup requires at least 2 targets")
+	}
+
+	err = client.CreateLocalBucket(proxyurl, bucket)
+	checkFatal(err, t)
+	defer func() {
+		err = client.DestroyLocalBucket(proxyurl, bucket)
+		checkFatal(err, t)
+	}()
+
+	names := make([]string, 0, num)
+	for i := 0; i < num; i++ {
+		name := fmt.Sprintf("%s/shard-%04d", SmokeStr, i)
+		reader, err := readers.NewRandReader(filesize, true /* withHash */)
+		checkFatal(err, t)
+		err = client.PutInGroup(proxyurl, reader, bucket, name, pgroup, true /* silent */)
+		checkFatal(err, t)
+		names = append(names, name)
+	}
+
+	// all objects of the group are stored by the same target
+	msg := &dfc.GetMsg{GetProps: dfc.GetPropsTargetID}
+	bl, err := client.ListBucket(proxyurl, bucket, msg, 0)
+	checkFatal(err, t)
+	if len(bl.Entries) != num {
+		t.Fatalf("Expected %d objects, found %d", num, len(bl.Entries))
+	}
+	for _, e := range bl.Entries {
+		if e.TargetID != bl.Entries[0].TargetID {
+			t.Errorf("Object %s is stored at %s, expected %s", e.Name, e.TargetID, bl.Entries[0].TargetID)
+		}
+	}
+
+	q := url.Values{}
+	q.Set(dfc.URLParamPlacementGroup, pgroup)
+	for _, name := range names {
+		l, _, err := client.GetWithQuery(proxyurl, bucket, name, nil, nil, true /* silent */, true /* validate */, q)
+		checkFatal(err, t)
+		if l != filesize {
+			t.Errorf("Expected size %d, got %d for %s", filesize, l, name)
+		}
+	}
+
+	// without the group the requests are redirected to the target of the group
+	for _, name := range names {
+		l, _, err := client.Get(proxyurl, bucket, name, nil, nil, true /* silent */, true /* validate */)
+		checkFatal(err, t)
+		if l != filesize {
+			t.Errorf("Expected size %d, got %d for %s", filesize, l, name)
+		}
+		props, err := client.HeadObject(proxyurl, bucket, name)
+		checkFatal(err, t)
+		if props.Size != int(filesize) {
+			t.Errorf("Expected size %d, got %d for %s", filesize, props.Size, name)
+		}
+		err = client.Del(proxyurl, bucket, name, nil, nil, true /* silent */)
+		checkFatal(err, t)
+	}
+	bl, err = client.ListBucket(proxyurl, bucket, msg, 0)
+	checkFatal(err, t)
+	if len(bl.Entries) != 0 {
+		t.Errorf("Expected all objects deleted, found %d", len(bl.Entries))
+	}
+}
+
+// Requires a cluster built with failure injection support (-tags debug)
+func TestFaultInjection(t *testing.T) {
+	const (
+		filesize = int64(1024)
+		bucket   = TestLocalBucketName
+		objname  = SmokeStr + "/fault"
+	)
+	smap, err := client.GetClusterMap(proxyurl)
+	checkFatal(err, t)
+	fault := dfc.FaultMsg{Kind: dfc.FaultDiskWrite, Prob: 1}
+	for _, si := range smap.Tmap {
+		if err = client.InjectFault(si.DirectURL, fault); err != nil {
+			t.Skipf("Failure injection is not supported: %v", err)
+		}
+	}
+	defer func() {
+		for _, si := range smap.Tmap {
+			if err := client.ClearFaults(si.DirectURL); err != nil {
+				t.Error(err)
+			}
+		}
+	}()
+
+	err = client.CreateLocalBucket(proxyurl, bucket)
+	checkFatal(err, t)
+	defer func() {
+		err = client.DestroyLocalBucket(proxyurl, bucket)
+		checkFatal(err, t)
+	}()
+
+	reader, err := readers.NewRandReader(filesize, true /* withHash */)
+	checkFatal(err, t)
+	if err = client.Put(proxyurl, reader, bucket, objname, true /* silent */); err == nil {
+		t.Fatal("PUT succeeded while all disk writes fail")
+	}
+
+	for _, si := range smap.Tmap {
+		err = client.ClearFaults(si.DirectURL)
+		checkFatal(err, t)
+	}
+	err = client.Put(proxyurl, reader, bucket, objname, true /* silent */)
+	checkFatal(err, t)
+}
+
 // 1. PUT file
 // 2. Corrupt the file
 // 3. GET file
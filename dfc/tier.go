@@ -10,17 +10,20 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
+	"time"
 )
 
 func (t *targetrunner) objectInNextTier(nextURL, bucket, objName string) (in bool, errstr string, errcode int) {
-	var url = nextURL + URLPath(Rversion, Robjects, bucket, objName) + fmt.Sprintf(
+	var url = nextURL + URLEscapedPath(Rversion, Robjects, bucket, objName) + fmt.Sprintf(
 		"?%s=true", URLParamCheckCached)
 
 	r, err := t.httprunner.httpclientLongTimeout.Head(url)
 	if err != nil {
+		t.tiers.done(nextURL, true, time.Now())
 		errstr = err.Error()
 		return
 	}
+	t.tiers.done(nextURL, r.StatusCode >= http.StatusInternalServerError, time.Now())
 	if r.StatusCode >= http.StatusBadRequest {
 		if r.StatusCode == http.StatusNotFound {
 			r.Body.Close()
@@ -44,13 +47,15 @@ func (t *targetrunner) objectInNextTier(nextURL, bucket, objName string) (in boo
 }
 
 func (t *targetrunner) getObjectNextTier(nextURL, bucket, objName, fqn string) (p *objectProps, errstr string, errcode int) {
-	var url = nextURL + URLPath(Rversion, Robjects, bucket, objName)
+	var url = nextURL + URLEscapedPath(Rversion, Robjects, bucket, objName)
 
 	r, err := t.httprunner.httpclientLongTimeout.Get(url)
 	if err != nil {
+		t.tiers.done(nextURL, true, time.Now())
 		errstr = err.Error()
 		return
 	}
+	t.tiers.done(nextURL, r.StatusCode >= http.StatusInternalServerError, time.Now())
 
 	if r.StatusCode >= http.StatusBadRequest {
 		errcode = r.StatusCode
@@ -68,13 +73,13 @@ func (t *targetrunner) getObjectNextTier(nextURL, bucket, objName, fqn string) (
 	}
 
 	p = &objectProps{}
-	_, p.nhobj, p.size, errstr = t.receive(fqn, objName, "", nil, r.Body)
+	_, p.nhobj, p.size, errstr = t.receive(fqn, bucket, objName, "", nil, r.Body)
 	r.Body.Close()
 	return
 }
 
 func (t *targetrunner) putObjectNextTier(nextURL, bucket, objName string, body io.Reader) (errstr string, errcode int) {
-	var url = nextURL + URLPath(Rversion, Robjects, bucket, objName)
+	var url = nextURL + URLEscapedPath(Rversion, Robjects, bucket, objName)
 
 	req, err := http.NewRequest(http.MethodPut, url, body)
 	if err != nil {
@@ -84,9 +89,11 @@ func (t *targetrunner) putObjectNextTier(nextURL, bucket, objName string, body i
 
 	resp, err := t.httprunner.httpclientLongTimeout.Do(req)
 	if err != nil {
+		t.tiers.done(nextURL, true, time.Now())
 		errstr = err.Error()
 		return
 	}
+	t.tiers.done(nextURL, resp.StatusCode >= http.StatusInternalServerError, time.Now())
 
 	if resp.StatusCode >= http.StatusBadRequest {
 		errcode = resp.StatusCode
@@ -0,0 +1,25 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ */
+package dfc
+
+import "testing"
+
+func TestNextTierURLValidation(t *testing.T) {
+	for _, test := range []struct {
+		url   string
+		valid bool
+	}{
+		{"http://localhost:8082", true},
+		{"https://tier2.example.com", true},
+		{"/v1/objects", false},
+		{"localhost:8082", false},
+		{"ftp://tier2.example.com", false},
+		{"http://", false},
+	} {
+		props := &BucketProps{CloudProvider: ProviderDfc, NextTierURL: test.url}
+		if err := validateBucketProps(props, true); (err == nil) != test.valid {
+			t.Errorf("%q: expected valid %t, err: %v", test.url, test.valid, err)
+		}
+	}
+}
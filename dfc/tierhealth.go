@@ -0,0 +1,46 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+// Health of the next tiers.
+// Every target keeps a circuit breaker (see breaker.go) per next tier URL. A
+// next tier that fails next_tier.failures requests in a row - with a connection
+// error or a 5xx status - becomes degraded, and the target stops sending it
+// requests: GETs fall back to the Cloud or, for local buckets, fail right away
+// with 404, PUTs to Cloud buckets go directly to the Cloud, and PUTs to local
+// buckets fail with 503. Every next_tier.probe_interval, the target checks the
+// health of a degraded tier in the background, and the first successful check
+// restores it. The state of the breakers is reported with the target stats.
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/NVIDIA/dfcpub/3rdparty/glog"
+)
+
+// tierAvailable tells whether to send the request to the next tier
+func (t *targetrunner) tierAvailable(nextURL string) bool {
+	ok, probe := t.tiers.allow(nextURL, time.Now())
+	if probe {
+		go t.probeTier(nextURL)
+	}
+	return ok
+}
+
+func (t *targetrunner) probeTier(nextURL string) {
+	url := nextURL + URLPath(Rversion, Rhealth)
+	res := t.call(nil, nil, url, http.MethodGet, nil, ctx.config.Timeout.CplaneOperation)
+	if res.err != nil && glog.V(4) {
+		glog.Infof("Next tier %s is still degraded, err: %v", nextURL, res.err)
+	}
+	t.tiers.probed(nextURL, res.err != nil, time.Now())
+}
+
+func tierDegraded(nextURL string) (errstr string, errcode int) {
+	return fmt.Sprintf("Next tier %s is degraded", nextURL), http.StatusServiceUnavailable
+}
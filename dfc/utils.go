@@ -23,19 +23,20 @@ import (
 	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/NVIDIA/dfcpub/3rdparty/glog"
 )
 
 const (
 	maxAttrSize = 1024
-	// use extra algorithms to choose a local IPv4 if there are more than 1 available
-	guessTheBestIPv4 = false
+	// use extra algorithms to choose a local IP if there are more than 1 available
+	guessTheBestIP = false
 )
 
 // Local unicast IP info
-type localIPv4Info struct {
-	ipv4  string
+type localIPInfo struct {
+	ip    string
 	mtu   int
 	speed int
 }
@@ -70,6 +71,45 @@ func divCeil(a, b int64) int64 {
 	return d
 }
 
+func stringInSlice(s string, arr []string) bool {
+	for _, el := range arr {
+		if el == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the "directory" of an object for listing with delimiter: the part
+// of the name up to and including the first delimiter after prefix, or an empty
+// string if the name does not contain delimiter after prefix
+func commonPrefix(name, prefix, delimiter string) string {
+	if delimiter == "" || !strings.HasPrefix(name, prefix) {
+		return ""
+	}
+	idx := strings.Index(name[len(prefix):], delimiter)
+	if idx < 0 {
+		return ""
+	}
+	return name[:len(prefix)+idx+len(delimiter)]
+}
+
+// Returns sorted common prefixes that belong to the page ending with marker:
+// the rest are returned with the following pages
+func pagePrefixes(prefixes map[string]bool, marker string) []string {
+	list := make([]string, 0, len(prefixes))
+	for prefix := range prefixes {
+		if marker == "" || prefix <= marker {
+			list = append(list, prefix)
+		}
+	}
+	if len(list) == 0 {
+		return nil
+	}
+	sort.Strings(list)
+	return list
+}
+
 func copyStruct(dst interface{}, src interface{}) {
 	x := reflect.ValueOf(src)
 	if x.Kind() == reflect.Ptr {
@@ -83,9 +123,23 @@ func copyStruct(dst interface{}, src interface{}) {
 	}
 }
 
-// getLocalIPv4List returns a list of local unicast IPv4 with MTU
-func getLocalIPv4List() (addrlist []*localIPv4Info, err error) {
-	addrlist = make([]*localIPv4Info, 0)
+// ipFamily returns the address family of the IP: ipv4, ipv6, or "" if the IP
+// is not a global or private unicast one - link-local IPv6 need a zone
+func ipFamily(ip net.IP) string {
+	switch {
+	case ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsMulticast() || ip.IsUnspecified():
+		return ""
+	case ip.To4() != nil:
+		return netFamilyIPv4
+	case ip.To16() != nil:
+		return netFamilyIPv6
+	}
+	return ""
+}
+
+// getLocalIPList returns a list of local unicast IPs of the family with MTU
+func getLocalIPList(family string) (addrlist []*localIPInfo, err error) {
+	addrlist = make([]*localIPInfo, 0)
 	addrs, e := net.InterfaceAddrs()
 	if e != nil {
 		err = fmt.Errorf("Failed to get host unicast IPs, err: %v", e)
@@ -98,13 +152,11 @@ func getLocalIPv4List() (addrlist []*localIPv4Info, err error) {
 	}
 
 	for _, addr := range addrs {
-		curr := &localIPv4Info{}
-		if ipnet, ok := addr.(*net.IPNet); ok && !ipnet.IP.IsLoopback() {
-			if ipnet.IP.To4() != nil {
-				curr.ipv4 = ipnet.IP.String()
-			}
+		curr := &localIPInfo{}
+		if ipnet, ok := addr.(*net.IPNet); ok && ipFamily(ipnet.IP) == family {
+			curr.ip = ipnet.IP.String()
 		}
-		if curr.ipv4 == "" {
+		if curr.ip == "" {
 			continue
 		}
 
@@ -115,7 +167,7 @@ func getLocalIPv4List() (addrlist []*localIPv4Info, err error) {
 				continue
 			}
 			for _, ifAddr := range ifAddrs {
-				if ipnet, ok := ifAddr.(*net.IPNet); ok && ipnet.IP.To4() != nil && ipnet.IP.String() == curr.ipv4 {
+				if ipnet, ok := ifAddr.(*net.IPNet); ok && ipnet.IP.String() == curr.ip {
 					curr.mtu = intf.MTU
 					curr.speed = netifSpeed(intf.Name)
 					addrlist = append(addrlist, curr)
@@ -131,27 +183,28 @@ func getLocalIPv4List() (addrlist []*localIPv4Info, err error) {
 	return addrlist, nil
 }
 
-// selectConfiguredIPv4 returns the first IPv4 from a preconfigured IPv4 list that
-// matches any local unicast IPv4
-func selectConfiguredIPv4(addrlist []*localIPv4Info, configuredIPv4s string) (ipv4addr string, errstr string) {
-	glog.Infof("Selecting one of the configured IPv4 addresses: %s...\n", configuredIPv4s)
+// selectConfiguredIP returns the first IP from a preconfigured IP list that
+// matches any local unicast IP. IPv6 may be written in any of its forms
+func selectConfiguredIP(addrlist []*localIPInfo, configuredIPs string) (ipaddr string, errstr string) {
+	glog.Infof("Selecting one of the configured IP addresses: %s...\n", configuredIPs)
 	localList := ""
-	configuredList := strings.Split(configuredIPv4s, ",")
+	configuredList := strings.Split(configuredIPs, ",")
 	for _, localaddr := range addrlist {
-		localList += " " + localaddr.ipv4
-		for _, ipv4 := range configuredList {
-			if localaddr.ipv4 == strings.TrimSpace(ipv4) {
-				glog.Warningf("Selected IPv4 %s from the configuration file\n", ipv4)
-				return ipv4, ""
+		localList += " " + localaddr.ip
+		localip := net.ParseIP(localaddr.ip)
+		for _, ip := range configuredList {
+			if localip.Equal(net.ParseIP(strings.TrimSpace(ip))) {
+				glog.Warningf("Selected IP %s from the configuration file\n", localaddr.ip)
+				return localaddr.ip, ""
 			}
 		}
 	}
 
-	glog.Errorf("Configured IPv4 does not match any local one.\nLocal IPv4 list:%s\n", localList)
-	return "", "Configured IPv4 does not match any local one"
+	glog.Errorf("Configured IP does not match any local one.\nLocal IP list:%s\n", localList)
+	return "", "Configured IP does not match any local one"
 }
 
-func guessIPv4(addrlist []*localIPv4Info) (ipv4addr string, errstr string) {
+func guessIP(addrlist []*localIPInfo) (ipaddr string, errstr string) {
 	glog.Warning("Looking for the fastest network interface")
 	// sort addresses in descendent order by interface speed
 	ifLess := func(i, j int) bool {
@@ -159,70 +212,81 @@ func guessIPv4(addrlist []*localIPv4Info) (ipv4addr string, errstr string) {
 	}
 	sort.Slice(addrlist, ifLess)
 
-	// Take the first IPv4 if it is faster than the others
+	// Take the first IP if it is faster than the others
 	if addrlist[0].speed != addrlist[1].speed {
 		glog.Warningf("Interface %s is the fastest - %dMbit\n",
-			addrlist[0].ipv4, addrlist[0].speed)
+			addrlist[0].ip, addrlist[0].speed)
 		if addrlist[0].mtu <= 1500 {
-			glog.Warningf("IPv4 %s selected but MTU is low: %s\n", addrlist[0].mtu)
+			glog.Warningf("IP %s selected but MTU is low: %s\n", addrlist[0].mtu)
 		}
-		ipv4addr = addrlist[0].ipv4
+		ipaddr = addrlist[0].ip
 		return
 	}
 
-	errstr = fmt.Sprintf("Failed to select one IPv4 of %d available\n", len(addrlist))
+	errstr = fmt.Sprintf("Failed to select one IP of %d available\n", len(addrlist))
 	return
 }
 
-// detectLocalIPv4 takes a list of local IPv4s and returns the best fit for a deamon to listen on it
-func detectLocalIPv4(addrlist []*localIPv4Info) (ipv4addr string, errstr string) {
+// detectLocalIP takes a list of local IPs and returns the best fit for a deamon to listen on it
+func detectLocalIP(addrlist []*localIPInfo) (ipaddr string, errstr string) {
 	if len(addrlist) == 1 {
-		msg := fmt.Sprintf("Found only one IPv4: %s, MTU %d", addrlist[0].ipv4, addrlist[0].mtu)
+		msg := fmt.Sprintf("Found only one IP: %s, MTU %d", addrlist[0].ip, addrlist[0].mtu)
 		if addrlist[0].speed != 0 {
 			msg += fmt.Sprintf(", bandwidth %d", addrlist[0].speed)
 		}
 		glog.Info(msg)
 		if addrlist[0].mtu <= 1500 {
-			glog.Warningf("IPv4 %s MTU size is small: %d\n", addrlist[0].ipv4, addrlist[0].mtu)
+			glog.Warningf("IP %s MTU size is small: %d\n", addrlist[0].ip, addrlist[0].mtu)
 		}
-		ipv4addr = addrlist[0].ipv4
+		ipaddr = addrlist[0].ip
 		return
 	}
 
-	glog.Warningf("Warning: %d IPv4s available", len(addrlist))
+	glog.Warningf("Warning: %d IPs available", len(addrlist))
 	for _, intf := range addrlist {
 		glog.Warningf("    %#v\n", *intf)
 	}
 	// FIXME: temp hack - make sure to keep working on laptops with dockers
-	ipv4addr = addrlist[0].ipv4
+	ipaddr = addrlist[0].ip
 	return
 	/*
-		if guessTheBestIPv4 {
-			return guessIPv4(addrlist)
+		if guessTheBestIP {
+			return guessIP(addrlist)
 		}
-		return "", "Failed to select network interface: more than one IPv4 available"
+		return "", "Failed to select network interface: more than one IP available"
 	*/
 }
 
-// getipv4addr returns an IPv4 for proxy/target to listen on it.
-// 1. If there is an IPv4 in config - it tries to use it
-// 2. If config does not contain IPv4 - it chooses one of local IPv4s
-func getipv4addr() (ipv4addr string, errstr string) {
-	addrlist, err := getLocalIPv4List()
+// getipaddr returns an IP of the configured family (net.family, IPv4 by
+// default) for proxy/target to advertise in the cluster map.
+// 1. If there are IPs of the family in config - it tries to use one of them
+// 2. Otherwise it chooses one of local IPs of the family
+// The daemons listen on all local IPs of both families regardless.
+func getipaddr() (ipaddr string, errstr string) {
+	family, configured := netFamilyIPv4, ctx.config.Net.IPv4
+	if ctx.config.Net.Family == netFamilyIPv6 {
+		family, configured = netFamilyIPv6, ctx.config.Net.IPv6
+	}
+	addrlist, err := getLocalIPList(family)
 	if err != nil {
 		errstr = err.Error()
 		return
 	}
 	if len(addrlist) == 0 {
-		errstr = "The host does not have any IPv4 addresses"
+		errstr = fmt.Sprintf("The host does not have any %s addresses", family)
 		return
 	}
 
-	if ctx.config.Net.IPv4 != "" {
-		return selectConfiguredIPv4(addrlist, ctx.config.Net.IPv4)
+	if configured != "" {
+		return selectConfiguredIP(addrlist, configured)
 	}
 
-	return detectLocalIPv4(addrlist)
+	return detectLocalIP(addrlist)
+}
+
+// daemonURL returns the URL of the daemon: IPv6 goes in square brackets
+func daemonURL(proto, ipaddr, port string) string {
+	return proto + "://" + net.JoinHostPort(ipaddr, port)
 }
 
 func CreateDir(dirname string) (err error) {
@@ -440,3 +504,43 @@ func parsebool(s string) (value bool, err error) {
 	value, err = strconv.ParseBool(s)
 	return
 }
+
+// names of GetMsg.GetTimeFormat enum values
+var timeFormats = map[string]string{
+	"RFC822":      RFC822,
+	"Stamp":       Stamp,
+	"StampMilli":  StampMilli,
+	"RFC822Z":     RFC822Z,
+	"RFC1123":     RFC1123,
+	"RFC1123Z":    RFC1123Z,
+	"RFC3339":     RFC3339,
+	"RFC3339Nano": RFC3339Nano,
+}
+
+// formatTime formats the time as per GetMsg.GetTimeFormat - either the name
+// or the layout; empty format means the configured default, RFC3339Nano if
+// the config does not define it
+func formatTime(t time.Time, format string) string {
+	if format == "" {
+		format = ctx.config.TimeFormat
+	}
+	if layout, ok := timeFormats[format]; ok {
+		format = layout
+	}
+	if format == "" {
+		format = RFC3339Nano
+	}
+	return t.Format(format)
+}
+
+// ParseTime parses the time formatted by DFC or AuthN: RFC3339Nano or,
+// by older versions, RFC822
+func ParseTime(s string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		if t822, err822 := time.Parse(time.RFC822, s); err822 == nil {
+			return t822, nil
+		}
+	}
+	return t, err
+}
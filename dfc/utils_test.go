@@ -0,0 +1,60 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"net"
+	"testing"
+)
+
+func TestDaemonURL(t *testing.T) {
+	for _, test := range []struct {
+		proto, ipaddr, url string
+	}{
+		{"http", "10.0.0.1", "http://10.0.0.1:8080"},
+		{"https", "fd00::1", "https://[fd00::1]:8080"},
+	} {
+		if url := daemonURL(test.proto, test.ipaddr, "8080"); url != test.url {
+			t.Errorf("Expected %s, got %s", test.url, url)
+		}
+	}
+}
+
+func TestIPFamily(t *testing.T) {
+	for _, test := range []struct {
+		ip, family string
+	}{
+		{"10.0.0.1", netFamilyIPv4},
+		{"::ffff:10.0.0.1", netFamilyIPv4},
+		{"fd00::1", netFamilyIPv6},
+		{"2001:db8::10", netFamilyIPv6},
+		{"127.0.0.1", ""},
+		{"::1", ""},
+		{"fe80::1", ""},
+		{"ff02::1", ""},
+		{"::", ""},
+	} {
+		if family := ipFamily(net.ParseIP(test.ip)); family != test.family {
+			t.Errorf("%s: expected %q, got %q", test.ip, test.family, family)
+		}
+	}
+}
+
+func TestSelectConfiguredIP(t *testing.T) {
+	addrlist := []*localIPInfo{{ip: "10.0.0.1"}, {ip: "fd00::1"}}
+	for _, test := range []struct {
+		configured, ipaddr string
+	}{
+		{"10.0.0.2, 10.0.0.1", "10.0.0.1"},
+		{"fd00:0:0:0:0:0:0:1", "fd00::1"},
+		{"FD00::0001", "fd00::1"},
+		{"fd00::2,10.0.0.2", ""},
+	} {
+		ipaddr, errstr := selectConfiguredIP(addrlist, test.configured)
+		if ipaddr != test.ipaddr || (errstr == "") != (test.ipaddr != "") {
+			t.Errorf("%s: expected %q, got %q (%s)", test.configured, test.ipaddr, ipaddr, errstr)
+		}
+	}
+}
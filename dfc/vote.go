@@ -249,7 +249,7 @@ func (p *proxyrunner) httpRequestNewPrimary(w http.ResponseWriter, r *http.Reque
 
 	currSmap := p.smapowner.get()
 	currPrimary := currSmap.ProxySI.DaemonID
-	currPrimaryURL := currSmap.ProxySI.DirectURL
+	currPrimaryURL := currSmap.ProxySI.controlURL()
 	if s := p.smapowner.synchronize(newsmap, true /*saveSmap*/, false /* lesserIsErr */); s != "" {
 		glog.Errorln(s)
 	}
@@ -464,7 +464,7 @@ func (p *proxyrunner) onPrimaryProxyFailure() {
 		return
 	}
 
-	currPrimaryURL := smap.ProxySI.DirectURL
+	currPrimaryURL := smap.ProxySI.controlURL()
 	if glog.V(4) {
 		glog.Infof("Primary proxy %s failure detected {url: %s}", smap.ProxySI.DaemonID, currPrimaryURL)
 	}
@@ -518,7 +518,7 @@ func (t *targetrunner) onPrimaryProxyFailure() {
 }
 
 func (h *httprunner) sendElectionRequest(vr *VoteInitiation, nextPrimaryProxy *daemonInfo) {
-	url := nextPrimaryProxy.DirectURL + "/" + Rversion + "/" + Rvote + "/" + Rvoteinit
+	url := nextPrimaryProxy.controlURL() + "/" + Rversion + "/" + Rvote + "/" + Rvoteinit
 	msg := VoteInitiationMessage{Request: *vr}
 	jsbytes, err := json.Marshal(&msg)
 	assert(err == nil, err)
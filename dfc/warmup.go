@@ -0,0 +1,203 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+// Warm-up manifests.
+// The warm-up manifest of a Cloud bucket lists its must-have objects:
+// POST {"action": "warmup", "value": {"objnames": [...]}} to
+// /v1/buckets/bucket-name registers the manifest, replacing the previous one,
+// and no objects remove it. The manifests are kept in the bucket metadata.
+// A target prefetches the objects of the manifest it owns when it receives a
+// new or changed manifest - including all manifests upon startup, when the
+// target receives the bucket metadata - and once it is done rebalancing, so
+// that a rebooted or resized cluster gets back to its hit ratio on its own.
+// Cached objects are skipped. GET /v1/buckets/bucket-name?what=warmup returns
+// the manifest.
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync/atomic"
+
+	"github.com/NVIDIA/dfcpub/3rdparty/glog"
+)
+
+const maxWarmupObjects = 100000
+
+// parseWarmupMsg returns the sorted manifest without duplicates
+func parseWarmupMsg(msg *ActionMsg) ([]string, error) {
+	warmupmsg := &WarmupMsg{}
+	if msg.Value != nil {
+		b, err := json.Marshal(msg.Value)
+		if err == nil {
+			err = json.Unmarshal(b, warmupmsg)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Invalid warm-up manifest %v, err: %v", msg.Value, err)
+		}
+	}
+	if len(warmupmsg.Objnames) > maxWarmupObjects {
+		return nil, fmt.Errorf("Warm-up manifest is too large: %d objects (max %d)", len(warmupmsg.Objnames), maxWarmupObjects)
+	}
+	objnames := make([]string, 0, len(warmupmsg.Objnames))
+	for _, objname := range warmupmsg.Objnames {
+		if objname == "" {
+			return nil, fmt.Errorf("Empty object name in warm-up manifest")
+		}
+		objnames = append(objnames, objname)
+	}
+	sort.Strings(objnames)
+	manifest := objnames[:0]
+	for i, objname := range objnames {
+		if i == 0 || objname != objnames[i-1] {
+			manifest = append(manifest, objname)
+		}
+	}
+	if len(manifest) == 0 {
+		return nil, nil
+	}
+	return manifest, nil
+}
+
+// warmupBuckets returns the Cloud buckets whose warm-up manifests differ in
+// the new bucket metadata, sorted
+func warmupBuckets(bucketmd, newbucketmd *bucketMD) []string {
+	buckets := make([]string, 0)
+	for bucket, props := range newbucketmd.CBmap {
+		if len(props.Warmup) == 0 {
+			continue
+		}
+		if old, ok := bucketmd.CBmap[bucket]; ok && equalManifests(old.Warmup, props.Warmup) {
+			continue
+		}
+		buckets = append(buckets, bucket)
+	}
+	sort.Strings(buckets)
+	return buckets
+}
+
+func equalManifests(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+//
+// target
+//
+
+// startupWarmup warms up all buckets once, upon receiving the first cluster map
+func (t *targetrunner) startupWarmup() {
+	if atomic.CompareAndSwapInt32(&t.warmedup, 0, 1) {
+		go t.warmup(warmupBuckets(newBucketMD(), t.bmdowner.get()))
+	}
+}
+
+// changedWarmup warms up the buckets with new or changed manifests, if the
+// startup warm-up has run - otherwise it will
+func (t *targetrunner) changedWarmup(bucketmd, newbucketmd *bucketMD) {
+	if atomic.LoadInt32(&t.warmedup) == 0 {
+		return
+	}
+	if buckets := warmupBuckets(bucketmd, newbucketmd); len(buckets) > 0 {
+		go t.warmup(buckets)
+	}
+}
+
+// warmupObjects returns the objects of the manifest this target owns
+func (t *targetrunner) warmupObjects(bucket string, manifest []string, smap *Smap) ([]string, string) {
+	objs := make([]string, 0)
+	for _, objname := range manifest {
+		si, errstr := HrwTarget(bucket, objname, smap)
+		if errstr != "" {
+			return nil, errstr
+		}
+		if si.DaemonID == t.si.DaemonID {
+			objs = append(objs, objname)
+		}
+	}
+	return objs, ""
+}
+
+// warmup prefetches the objects of the warm-up manifests of the buckets
+func (t *targetrunner) warmup(buckets []string) {
+	bucketmd, smap := t.bmdowner.get(), t.smapowner.get()
+	queued := false
+	for _, bucket := range buckets {
+		_, props := bucketmd.get(bucket, false)
+		objs, errstr := t.warmupObjects(bucket, props.Warmup, smap)
+		if errstr != "" {
+			glog.Errorf("Failed to warm up %s: %s", bucket, errstr)
+			break
+		}
+		if len(objs) == 0 {
+			continue
+		}
+		if err := t.addPrefetchList(context.Background(), objs, bucket, 0, nil); err != nil {
+			glog.Errorf("Failed to warm up %s, err: %v", bucket, err)
+			continue
+		}
+		glog.Infof("warm-up: %s, %d of %d objects", bucket, len(objs), len(props.Warmup))
+		queued = true
+	}
+	if queued {
+		t.doPrefetch()
+	}
+}
+
+//
+// proxy
+//
+
+// POST {"action": "warmup", "value": {"objnames": [...]}} /v1/buckets/bucket-name
+func (p *proxyrunner) warmupManifest(w http.ResponseWriter, r *http.Request, bucket string, msg *ActionMsg) {
+	manifest, err := parseWarmupMsg(msg)
+	if err != nil {
+		p.invalmsghdlr(w, r, err.Error())
+		return
+	}
+	p.bmdowner.Lock()
+	clone := p.bmdowner.get().clone()
+	if clone.islocal(bucket) {
+		p.bmdowner.Unlock()
+		p.invalmsghdlr(w, r, fmt.Sprintf("Cannot warm up local bucket %s", bucket))
+		return
+	}
+	exists, props := clone.get(bucket, false)
+	if !exists {
+		clone.add(bucket, false, BucketProps{})
+	}
+	if equalManifests(props.Warmup, manifest) {
+		p.bmdowner.Unlock()
+		return
+	}
+	props.Warmup = manifest
+	clone.set(bucket, false, props)
+	if errstr := p.savebmdconf(clone); errstr != "" {
+		glog.Errorln(errstr)
+	}
+	p.bmdowner.put(clone)
+	p.bmdowner.Unlock()
+	p.metasyncer.sync(true, &revspair{clone, msg})
+	glog.Infof("%s warm-up manifest: %d objects", bucket, len(manifest))
+}
+
+// GET /v1/buckets/bucket-name?what=warmup
+func (p *proxyrunner) httpwarmup(w http.ResponseWriter, r *http.Request, bucket string) {
+	_, props := p.bmdowner.get().get(bucket, false)
+	jsbytes, err := json.Marshal(&WarmupMsg{Objnames: props.Warmup})
+	assert(err == nil, err)
+	p.writeJSON(w, r, jsbytes, "warmup")
+}
@@ -0,0 +1,81 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestParseWarmupMsg(t *testing.T) {
+	manifest, err := parseWarmupMsg(&ActionMsg{Action: ActWarmup,
+		Value: map[string]interface{}{"objnames": []string{"c", "a", "b", "a"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(manifest, []string{"a", "b", "c"}) {
+		t.Errorf("Unexpected manifest %v", manifest)
+	}
+	if manifest, err = parseWarmupMsg(&ActionMsg{Action: ActWarmup}); err != nil || manifest != nil {
+		t.Errorf("Expected no manifest, got %v, err: %v", manifest, err)
+	}
+	for _, value := range []interface{}{
+		map[string]interface{}{"objnames": []string{"a", ""}},
+		map[string]interface{}{"objnames": "a"},
+		map[string]interface{}{"objnames": make([]string, maxWarmupObjects+1)},
+	} {
+		if _, err = parseWarmupMsg(&ActionMsg{Action: ActWarmup, Value: value}); err == nil {
+			t.Errorf("Expected %.40v to fail", value)
+		}
+	}
+}
+
+func TestWarmupBuckets(t *testing.T) {
+	bucketmd := newBucketMD()
+	bucketmd.add("same", false, BucketProps{Warmup: []string{"a", "b"}})
+	bucketmd.add("changed", false, BucketProps{Warmup: []string{"a"}})
+	bucketmd.add("removed", false, BucketProps{Warmup: []string{"a"}})
+	newbucketmd := bucketmd.clone()
+	newbucketmd.set("changed", false, BucketProps{Warmup: []string{"a", "b"}})
+	newbucketmd.set("removed", false, BucketProps{})
+	newbucketmd.add("added", false, BucketProps{Warmup: []string{"c"}})
+	newbucketmd.add("local", true, BucketProps{Warmup: []string{"c"}})
+
+	if buckets := warmupBuckets(bucketmd, newbucketmd); !reflect.DeepEqual(buckets, []string{"added", "changed"}) {
+		t.Errorf("Unexpected changed manifests %v", buckets)
+	}
+	// startup
+	if buckets := warmupBuckets(newBucketMD(), newbucketmd); !reflect.DeepEqual(buckets, []string{"added", "changed", "same"}) {
+		t.Errorf("Unexpected manifests %v", buckets)
+	}
+}
+
+func TestWarmupObjects(t *testing.T) {
+	manifest := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+	smap := newSmap()
+	targets := make([]*targetrunner, 0, 2)
+	for _, id := range []string{"t1", "t2"} {
+		target := &targetrunner{}
+		target.si = &daemonInfo{DaemonID: id}
+		smap.addTarget(target.si)
+		targets = append(targets, target)
+	}
+	all := make([]string, 0, len(manifest))
+	for _, target := range targets {
+		objs, errstr := target.warmupObjects("bucket", manifest, smap)
+		if errstr != "" {
+			t.Fatal(errstr)
+		}
+		all = append(all, objs...)
+	}
+	sort.Strings(all)
+	if !reflect.DeepEqual(all, manifest) {
+		t.Errorf("Expected the targets to own %v once, got %v", manifest, all)
+	}
+	if _, errstr := targets[0].warmupObjects("bucket", manifest, newSmap()); errstr == "" {
+		t.Error("Expected empty cluster map to fail")
+	}
+}
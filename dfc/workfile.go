@@ -0,0 +1,121 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/NVIDIA/dfcpub/3rdparty/glog"
+)
+
+// Write path commit protocol. An object being received - PUT, cold GET,
+// rebalance, etc. - is written to a workfile in the mountpath's work directory
+// (mpathWorkDir), which is on the same filesystem as the object. Once
+// received, the workfile is (optionally) fsync-ed, and atomically renamed
+// into place: readers see either the previous or the new object, never a
+// partial one. Workfiles left over by a previous target process (e.g., killed
+// while receiving) are removed at startup and counted in stats as orphans.
+
+// fsync policies, see commitconf and BucketProps
+const (
+	FsyncNever = "never" // rely on the OS to flush
+	FsyncFile  = "file"  // fsync the object before renaming it into place
+	FsyncDir   = "dir"   // FsyncFile, and fsync the object's directory after renaming
+)
+
+const mpathWorkDir = ".work" // the mountpath's subdirectory for workfiles
+
+// fsyncPolicy returns the fsync policy for the objects of the bucket:
+// the bucket's own, if set, or the cluster default
+func (t *targetrunner) fsyncPolicy(bucket string) string {
+	bucketmd := t.bmdowner.get()
+	if _, props := bucketmd.get(bucket, bucketmd.islocal(bucket)); props.Fsync != "" {
+		return props.Fsync
+	}
+	if ctx.config.Commit.Fsync == "" {
+		return FsyncNever
+	}
+	return ctx.config.Commit.Fsync
+}
+
+func validFsyncPolicy(policy string) bool {
+	return policy == FsyncNever || policy == FsyncFile || policy == FsyncDir
+}
+
+// fqn2mpath returns the mountpath the fqn belongs to, or "" if none
+func fqn2mpath(fqn string) (mpath string) {
+	for key := range ctx.mountpaths.Available {
+		// the longest match: mountpaths /a and /a/b
+		if strings.HasPrefix(fqn, key+"/") && len(key) > len(mpath) {
+			mpath = key
+		}
+	}
+	return
+}
+
+// syncfile flushes the received file to disk if the policy requires that
+func (t *targetrunner) syncfile(file *os.File, bucket string) error {
+	if t.fsyncPolicy(bucket) == FsyncNever {
+		return nil
+	}
+	return file.Sync()
+}
+
+// commitWorkfile renames the received workfile into place and, if the policy
+// requires that, makes the rename durable
+func (t *targetrunner) commitWorkfile(workfqn, fqn, bucket string) error {
+	// the workfile is in the mountpath's work directory, the object's may not exist yet
+	if err := CreateDir(filepath.Dir(fqn)); err != nil {
+		return err
+	}
+	if err := os.Rename(workfqn, fqn); err != nil {
+		return err
+	}
+	if t.fsyncPolicy(bucket) != FsyncDir {
+		return nil
+	}
+	dir, err := os.Open(filepath.Dir(fqn))
+	if err != nil {
+		return err
+	}
+	err = dir.Sync()
+	dir.Close()
+	return err
+}
+
+// removeOrphanWorkfiles removes the workfiles of previous target processes
+func (t *targetrunner) removeOrphanWorkfiles() {
+	var nfiles, nbytes int64
+	for mpath := range ctx.mountpaths.Available {
+		workdir := filepath.Join(mpath, mpathWorkDir)
+		finfos, err := ioutil.ReadDir(workdir)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				glog.Errorf("Failed to read %s, err: %v", workdir, err)
+			}
+			continue
+		}
+		for _, finfo := range finfos {
+			workfqn := filepath.Join(workdir, finfo.Name())
+			if iswork, isold := t.isworkfile(workfqn); finfo.IsDir() || (iswork && !isold) {
+				continue
+			}
+			if err = os.Remove(workfqn); err != nil {
+				glog.Errorf("Failed to remove orphan workfile %s, err: %v", workfqn, err)
+				continue
+			}
+			nfiles++
+			nbytes += finfo.Size()
+		}
+	}
+	if nfiles > 0 {
+		glog.Infof("Removed %d orphan workfiles, %d bytes", nfiles, nbytes)
+		t.statsif.addMany("numorphanworkfiles", nfiles, "bytesorphanworkfiles", nbytes)
+	}
+}
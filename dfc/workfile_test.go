@@ -0,0 +1,94 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ */
+package dfc
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWorkfileCommit(t *testing.T) {
+	mpath, err := ioutil.TempDir("", "workfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(mpath)
+	oldavail, oldcommit := ctx.mountpaths.Available, ctx.config.Commit
+	defer func() { ctx.mountpaths.Available, ctx.config.Commit = oldavail, oldcommit }()
+	ctx.mountpaths.Available = map[string]*mountPath{mpath: {Path: mpath}}
+
+	stats := &storstatsrunner{}
+	target, _ := newTestTarget(nil)
+	target.statsif = stats
+
+	fqn := filepath.Join(makePathLocal(mpath), "bucket", "dir", "obj")
+	workfqn := target.fqn2workfile(fqn)
+	if !strings.HasPrefix(workfqn, filepath.Join(mpath, mpathWorkDir)+"/") {
+		t.Fatalf("Expected workfile %s in the mountpath's work directory", workfqn)
+	}
+	if iswork, isold := target.isworkfile(workfqn); !iswork || isold {
+		t.Errorf("Expected %s to be a workfile of the current process: %v, %v", workfqn, iswork, isold)
+	}
+
+	for _, policy := range []string{"", FsyncNever, FsyncFile, FsyncDir} {
+		ctx.config.Commit.Fsync = policy
+		file, err := CreateFile(workfqn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = file.Write([]byte(policy)); err != nil {
+			t.Fatal(err)
+		}
+		if err = target.syncfile(file, "bucket"); err != nil {
+			t.Errorf("Policy %q: failed to sync, err: %v", policy, err)
+		}
+		file.Close()
+		if err = CreateDir(filepath.Dir(fqn)); err != nil {
+			t.Fatal(err)
+		}
+		if err = target.commitWorkfile(workfqn, fqn, "bucket"); err != nil {
+			t.Fatalf("Policy %q: failed to commit, err: %v", policy, err)
+		}
+		if data, err := ioutil.ReadFile(fqn); err != nil || string(data) != policy {
+			t.Errorf("Policy %q: unexpected object %q, err: %v", policy, data, err)
+		}
+	}
+	// the bucket's policy overrides the cluster default
+	bucketmd := newBucketMD()
+	bucketmd.add("bucket", true, BucketProps{Fsync: FsyncDir})
+	target.bmdowner.put(bucketmd)
+	ctx.config.Commit.Fsync = FsyncNever
+	if policy := target.fsyncPolicy("bucket"); policy != FsyncDir {
+		t.Errorf("Expected bucket fsync policy %q, got %q", FsyncDir, policy)
+	}
+	if policy := target.fsyncPolicy("other"); policy != FsyncNever {
+		t.Errorf("Expected default fsync policy %q, got %q", FsyncNever, policy)
+	}
+	if validFsyncPolicy("always") {
+		t.Error("Expected fsync policy \"always\" to be invalid")
+	}
+
+	// workfiles of the current process are kept, orphans are removed
+	current := target.fqn2workfile(fqn)
+	orphan := filepath.Join(mpath, mpathWorkDir, workfileprefix+"obj.123.2f")
+	for _, f := range []string{current, orphan} {
+		if err = ioutil.WriteFile(f, []byte("data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	target.removeOrphanWorkfiles()
+	if _, err = os.Stat(current); err != nil {
+		t.Errorf("Expected %s to be kept, err: %v", current, err)
+	}
+	if _, err = os.Stat(orphan); !os.IsNotExist(err) {
+		t.Errorf("Expected %s to be removed, err: %v", orphan, err)
+	}
+	if stats.Core.Numorphanworkfiles != 1 || stats.Core.Bytesorphanworkfiles != 4 {
+		t.Errorf("Expected 1 orphan workfile of 4 bytes, got %d, %d",
+			stats.Core.Numorphanworkfiles, stats.Core.Bytesorphanworkfiles)
+	}
+}
@@ -0,0 +1,90 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/NVIDIA/dfcpub/3rdparty/glog"
+)
+
+// Write-once-read-many (WORM) local buckets. An object of a bucket with
+// BucketProps.WORM set cannot be overwritten, deleted or renamed until its
+// retention period (BucketProps.Retention) expires - never, if the retention
+// is not set. The retention of an object counts from the time it was written
+// to the target that stores it (its mtime). The targets check the objects
+// under their exclusive locks; the proxy refuses upfront what no object of
+// the bucket would allow: deleting and renaming the objects of a bucket that
+// retains them forever, renaming and destroying the bucket. Once set, WORM
+// cannot be turned off and the retention cannot be shortened. Every refused
+// request and every change of the settings is logged with the "WORM:" prefix.
+
+// wormRetention returns the retention period of the objects of the WORM bucket, 0 - forever
+func wormRetention(props *BucketProps) time.Duration {
+	if props.Retention == "" {
+		return 0
+	}
+	retention, _ := time.ParseDuration(props.Retention) // validated by validateBucketProps
+	return retention
+}
+
+// validateWORM checks the new WORM settings of the bucket against the current ones
+func validateWORM(oldProps, props *BucketProps) error {
+	if !oldProps.WORM {
+		return nil
+	}
+	if !props.WORM {
+		return fmt.Errorf("write-once (WORM) cannot be turned off")
+	}
+	oldRetention, retention := wormRetention(oldProps), wormRetention(props)
+	if retention != 0 && (oldRetention == 0 || retention < oldRetention) {
+		return fmt.Errorf("retention of the write-once (WORM) bucket cannot be shortened")
+	}
+	return nil
+}
+
+// wormRetained returns the error if the objects of the bucket cannot be
+// deleted or renamed at all
+func (p *proxyrunner) wormRetained(bucket string) (errstr string) {
+	_, props := p.bmdowner.get().get(bucket, true)
+	if props.WORM && props.Retention == "" {
+		errstr = fmt.Sprintf("Objects of the write-once (WORM) bucket %s are retained forever", bucket)
+	}
+	return
+}
+
+// wormRefuse logs and sends the refusal
+func (h *httprunner) wormRefuse(w http.ResponseWriter, r *http.Request, errstr string) {
+	glog.Warningf("WORM: refused %s %s from %s: %s", r.Method, r.URL.Path, r.RemoteAddr, errstr)
+	h.invalmsghdlr(w, r, errstr, http.StatusForbidden)
+}
+
+// wormCheck returns 403 if the object of the WORM bucket exists and is still
+// retained, nil otherwise; the caller holds the object's lock
+func (t *targetrunner) wormCheck(bucket, objname, fqn string) *Error {
+	_, props := t.bmdowner.get().get(bucket, true)
+	if !props.WORM {
+		return nil
+	}
+	finfo, err := os.Stat(fqn)
+	if err != nil {
+		return nil
+	}
+	var cerr *Error
+	if retention := wormRetention(&props); retention == 0 {
+		cerr = NewError(http.StatusForbidden, "%s/%s is write-once (WORM bucket): retained forever", bucket, objname)
+	} else if until := finfo.ModTime().Add(retention); time.Now().Before(until) {
+		cerr = NewError(http.StatusForbidden, "%s/%s is write-once (WORM bucket): retained until %s",
+			bucket, objname, until.UTC().Format(time.RFC3339))
+	} else {
+		return nil
+	}
+	glog.Warningf("WORM: refused to modify %s", cerr.Message)
+	return cerr
+}
@@ -0,0 +1,91 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ */
+package dfc
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWORMSettings(t *testing.T) {
+	for _, test := range []struct {
+		props   BucketProps
+		islocal bool
+		valid   bool
+	}{
+		{BucketProps{WORM: true}, true, true},
+		{BucketProps{WORM: true, Retention: "720h"}, true, true},
+		{BucketProps{WORM: true}, false, false},
+		{BucketProps{Retention: "720h"}, true, false},
+		{BucketProps{WORM: true, Retention: "-1h"}, true, false},
+		{BucketProps{WORM: true, Retention: "month"}, true, false},
+	} {
+		if err := validateBucketProps(&test.props, test.islocal); (err == nil) != test.valid {
+			t.Errorf("%+v, local %t: expected valid %t, err: %v", test.props, test.islocal, test.valid, err)
+		}
+	}
+	for _, test := range []struct {
+		old, props BucketProps
+		valid      bool
+	}{
+		{BucketProps{}, BucketProps{WORM: true, Retention: "1h"}, true},
+		{BucketProps{WORM: true, Retention: "1h"}, BucketProps{WORM: true, Retention: "2h"}, true},
+		{BucketProps{WORM: true, Retention: "1h"}, BucketProps{WORM: true}, true},
+		{BucketProps{WORM: true, Retention: "2h"}, BucketProps{WORM: true, Retention: "1h"}, false},
+		{BucketProps{WORM: true}, BucketProps{WORM: true, Retention: "10000h"}, false},
+		{BucketProps{WORM: true, Retention: "1h"}, BucketProps{}, false},
+	} {
+		if err := validateWORM(&test.old, &test.props); (err == nil) != test.valid {
+			t.Errorf("%+v => %+v: expected valid %t, err: %v", test.old, test.props, test.valid, err)
+		}
+	}
+}
+
+func TestWORMCheck(t *testing.T) {
+	const bucket = "wormbucket"
+	dir, err := ioutil.TempDir("", "worm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	target := &targetrunner{}
+	target.bmdowner = &bmdowner{}
+	setProps := func(props BucketProps) {
+		bucketmd := newBucketMD()
+		bucketmd.add(bucket, true, props)
+		target.bmdowner.put(bucketmd)
+	}
+	setProps(BucketProps{WORM: true, Retention: "1h"})
+
+	fqn := filepath.Join(dir, "obj")
+	if cerr := target.wormCheck(bucket, "obj", fqn); cerr != nil {
+		t.Errorf("Expected a new object to be allowed, got %v", cerr)
+	}
+	if err = ioutil.WriteFile(fqn, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if cerr := target.wormCheck(bucket, "obj", fqn); cerr == nil || cerr.Status != http.StatusForbidden {
+		t.Errorf("Expected the retained object to be refused, got %v", cerr)
+	}
+	written := time.Now().Add(-2 * time.Hour)
+	if err = os.Chtimes(fqn, written, written); err != nil {
+		t.Fatal(err)
+	}
+	if cerr := target.wormCheck(bucket, "obj", fqn); cerr != nil {
+		t.Errorf("Expected the retention to be over, got %v", cerr)
+	}
+
+	setProps(BucketProps{WORM: true})
+	if cerr := target.wormCheck(bucket, "obj", fqn); cerr == nil {
+		t.Error("Expected the object to be retained forever")
+	}
+	setProps(BucketProps{})
+	if cerr := target.wormCheck(bucket, "obj", fqn); cerr != nil {
+		t.Errorf("Expected no WORM, got %v", cerr)
+	}
+}
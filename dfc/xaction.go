@@ -53,6 +53,60 @@ type xactLRU struct {
 	targetrunner *targetrunner
 }
 
+type xactResilver struct {
+	xactBase
+	targetrunner *targetrunner
+}
+
+type xactBenchmark struct {
+	xactBase
+	targetrunner *targetrunner
+}
+
+type xactImport struct {
+	xactBase
+	targetrunner *targetrunner
+	bucket       string
+	msg          *ImportMsg
+	mu           sync.Mutex
+	result       *ImportResult
+}
+
+type xactExport struct {
+	xactBase
+	targetrunner *targetrunner
+	bucket       string
+	msg          *ExportMsg
+	mu           sync.Mutex
+	result       *ExportResult
+}
+
+type xactConvert struct {
+	xactBase
+	targetrunner *targetrunner
+	bucket       string
+	msg          *ConvertMsg
+	mu           sync.Mutex
+	result       *ConvertResult
+}
+
+type xactBackup struct {
+	xactBase
+	targetrunner *targetrunner
+	bucket       string // local bucket
+	msg          *BackupMsg
+	mu           sync.Mutex
+	result       *BackupResult
+}
+
+type xactPurge struct {
+	xactBase
+	targetrunner *targetrunner
+	again        bool  // more has been trashed since the start (under xactInProgress lock)
+	files        int64 // purged so far
+	bytes        int64
+}
+
 type xactElection struct {
 	xactBase
 	proxyrunner *proxyrunner
@@ -241,6 +295,147 @@ func (q *xactInProgress) renewLRU(t *targetrunner) *xactLRU {
 	return xlru
 }
 
+func (q *xactInProgress) renewResilver(t *targetrunner) *xactResilver {
+	q.lock.Lock()
+	_, xx := q.findU(ActResilver)
+	if xx != nil {
+		xres := xx.(*xactResilver)
+		glog.Infof("%s already running, nothing to do", xres.tostring())
+		q.lock.Unlock()
+		return nil
+	}
+	id := q.uniqueid()
+	xres := &xactResilver{xactBase: *newxactBase(id, ActResilver)}
+	xres.targetrunner = t
+	q.add(xres)
+	q.lock.Unlock()
+	return xres
+}
+
+// renewBenchmark returns nil if the benchmark or any other xaction that
+// loads the disks is running
+func (q *xactInProgress) renewBenchmark(t *targetrunner) (xbench *xactBenchmark, errstr string) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	for _, kind := range []string{ActBenchmark, ActRebalance, ActLRU, ActResilver} {
+		if _, xx := q.findU(kind); xx != nil && !xx.finished() {
+			errstr = fmt.Sprintf("Cannot run %s: %s is in progress", ActBenchmark, kind)
+			return
+		}
+	}
+	id := q.uniqueid()
+	xbench = &xactBenchmark{xactBase: *newxactBase(id, ActBenchmark)}
+	xbench.targetrunner = t
+	q.add(xbench)
+	return
+}
+
+// renewImport returns nil if another import is running
+func (q *xactInProgress) renewImport(t *targetrunner, bucket string, msg *ImportMsg) (ximp *xactImport, errstr string) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if _, xx := q.findU(ActImport); xx != nil && !xx.finished() {
+		errstr = fmt.Sprintf("Cannot import into %s: %s is in progress", bucket, xx.tostring())
+		return
+	}
+	id := q.uniqueid()
+	ximp = &xactImport{xactBase: *newxactBase(id, ActImport), targetrunner: t, bucket: bucket, msg: msg}
+	ximp.result = newImportResult(t, bucket, msg)
+	q.add(ximp)
+	return
+}
+
+// renewExport returns nil if another export is running
+func (q *xactInProgress) renewExport(t *targetrunner, bucket string, msg *ExportMsg) (xexp *xactExport, errstr string) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if _, xx := q.findU(ActExport); xx != nil && !xx.finished() {
+		errstr = fmt.Sprintf("Cannot export %s: %s is in progress", bucket, xx.tostring())
+		return
+	}
+	id := q.uniqueid()
+	xexp = &xactExport{xactBase: *newxactBase(id, ActExport), targetrunner: t, bucket: bucket, msg: msg}
+	xexp.result = newExportResult(t, bucket)
+	q.add(xexp)
+	return
+}
+
+// renewConvert returns nil if another conversion is running
+func (q *xactInProgress) renewConvert(t *targetrunner, bucket string, msg *ConvertMsg) (xconv *xactConvert, errstr string) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if _, xx := q.findU(ActConvert); xx != nil && !xx.finished() {
+		errstr = fmt.Sprintf("Cannot convert %s: %s is in progress", bucket, xx.tostring())
+		return
+	}
+	id := q.uniqueid()
+	xconv = &xactConvert{xactBase: *newxactBase(id, ActConvert), targetrunner: t, bucket: bucket, msg: msg}
+	xconv.result = newConvertResult(t, bucket)
+	q.add(xconv)
+	return
+}
+
+// renewBackup returns nil if another backup or restore is running; kind is
+// ActBackup or ActRestoreBak
+func (q *xactInProgress) renewBackup(t *targetrunner, kind, bucket string, msg *BackupMsg) (xbak *xactBackup, errstr string) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	for _, k := range []string{ActBackup, ActRestoreBak} {
+		if _, xx := q.findU(k); xx != nil && !xx.finished() {
+			errstr = fmt.Sprintf("Cannot %s %s: %s is in progress", kind, bucket, xx.tostring())
+			return
+		}
+	}
+	id := q.uniqueid()
+	xbak = &xactBackup{xactBase: *newxactBase(id, kind), targetrunner: t, bucket: bucket, msg: msg}
+	xbak.result = newBackupResult(t, kind, bucket, msg)
+	q.add(xbak)
+	return
+}
+
+// abortBackup aborts the running backup or restore of the bucket, if any
+func (q *xactInProgress) abortBackup(bucket string) (xbak *xactBackup) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	for _, k := range []string{ActBackup, ActRestoreBak} {
+		if _, xx := q.findU(k); xx != nil && !xx.finished() && xx.(*xactBackup).bucket == bucket {
+			xbak = xx.(*xactBackup)
+			xbak.abort()
+			return
+		}
+	}
+	return
+}
+
+// renewPurge returns nil if the purge is running - the latter then purges
+// the newly trashed directories as well
+func (q *xactInProgress) renewPurge(t *targetrunner) *xactPurge {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if _, xx := q.findU(ActDestroyLB); xx != nil && !xx.finished() {
+		xx.(*xactPurge).again = true
+		return nil
+	}
+	id := q.uniqueid()
+	xpurge := &xactPurge{xactBase: *newxactBase(id, ActDestroyLB), targetrunner: t}
+	q.add(xpurge)
+	return xpurge
+}
+
+// purgeDone finishes the purge unless more has been trashed in the meantime
+func (q *xactInProgress) purgeDone(xpurge *xactPurge) bool {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if xpurge.again && !xpurge.finished() {
+		xpurge.again = false
+		return false
+	}
+	if !xpurge.finished() {
+		xpurge.etime = time.Now()
+	}
+	return true
+}
+
 func (q *xactInProgress) renewElection(p *proxyrunner, vr *VoteRecord) *xactElection {
 	q.lock.Lock()
 	_, xx := q.findU(ActElection)
@@ -287,6 +482,162 @@ func (xact *xactLRU) tostring() string {
 		xact.stime.Format("15:04:05.000000"), xact.etime.Format("15:04:05.000000"), d)
 }
 
+//===================
+//
+// xactResilver
+//
+//===================
+func (xact *xactResilver) tostring() string {
+	if !xact.finished() {
+		return fmt.Sprintf("xaction %s:%d started %v", xact.kind, xact.id, xact.stime.Format("15:04:05.000000"))
+	}
+	d := xact.etime.Sub(xact.stime)
+	return fmt.Sprintf("xaction %s:%d %v finished %v (duration %v)", xact.kind, xact.id,
+		xact.stime.Format("15:04:05.000000"), xact.etime.Format("15:04:05.000000"), d)
+}
+
+//===================
+//
+// xactBenchmark
+//
+//===================
+func (xact *xactBenchmark) tostring() string {
+	if !xact.finished() {
+		return fmt.Sprintf("xaction %s:%d started %v", xact.kind, xact.id, xact.stime.Format("15:04:05.000000"))
+	}
+	d := xact.etime.Sub(xact.stime)
+	return fmt.Sprintf("xaction %s:%d %v finished %v (duration %v)", xact.kind, xact.id,
+		xact.stime.Format("15:04:05.000000"), xact.etime.Format("15:04:05.000000"), d)
+}
+
+func (xact *xactBenchmark) aborted() bool {
+	select {
+	case <-xact.abrt:
+		return true
+	default:
+		return false
+	}
+}
+
+//===================
+//
+// xactImport
+//
+//===================
+func (xact *xactImport) tostring() string {
+	if !xact.finished() {
+		return fmt.Sprintf("xaction %s:%d %s started %v", xact.kind, xact.id, xact.bucket,
+			xact.stime.Format("15:04:05.000000"))
+	}
+	d := xact.etime.Sub(xact.stime)
+	return fmt.Sprintf("xaction %s:%d %s %v finished %v (duration %v)", xact.kind, xact.id, xact.bucket,
+		xact.stime.Format("15:04:05.000000"), xact.etime.Format("15:04:05.000000"), d)
+}
+
+func (xact *xactImport) aborted() bool {
+	select {
+	case <-xact.abrt:
+		return true
+	default:
+		return false
+	}
+}
+
+//===================
+//
+// xactExport
+//
+//===================
+func (xact *xactExport) tostring() string {
+	if !xact.finished() {
+		return fmt.Sprintf("xaction %s:%d %s started %v", xact.kind, xact.id, xact.bucket,
+			xact.stime.Format("15:04:05.000000"))
+	}
+	d := xact.etime.Sub(xact.stime)
+	return fmt.Sprintf("xaction %s:%d %s %v finished %v (duration %v)", xact.kind, xact.id, xact.bucket,
+		xact.stime.Format("15:04:05.000000"), xact.etime.Format("15:04:05.000000"), d)
+}
+
+func (xact *xactExport) aborted() bool {
+	select {
+	case <-xact.abrt:
+		return true
+	default:
+		return false
+	}
+}
+
+//===================
+//
+// xactConvert
+//
+//===================
+func (xact *xactConvert) tostring() string {
+	if !xact.finished() {
+		return fmt.Sprintf("xaction %s:%d %s started %v", xact.kind, xact.id, xact.bucket,
+			xact.stime.Format("15:04:05.000000"))
+	}
+	d := xact.etime.Sub(xact.stime)
+	return fmt.Sprintf("xaction %s:%d %s %v finished %v (duration %v)", xact.kind, xact.id, xact.bucket,
+		xact.stime.Format("15:04:05.000000"), xact.etime.Format("15:04:05.000000"), d)
+}
+
+func (xact *xactConvert) aborted() bool {
+	select {
+	case <-xact.abrt:
+		return true
+	default:
+		return false
+	}
+}
+
+//===================
+//
+// xactBackup
+//
+//===================
+func (xact *xactBackup) tostring() string {
+	if !xact.finished() {
+		return fmt.Sprintf("xaction %s:%d %s started %v", xact.kind, xact.id, xact.bucket,
+			xact.stime.Format("15:04:05.000000"))
+	}
+	d := xact.etime.Sub(xact.stime)
+	return fmt.Sprintf("xaction %s:%d %s %v finished %v (duration %v)", xact.kind, xact.id, xact.bucket,
+		xact.stime.Format("15:04:05.000000"), xact.etime.Format("15:04:05.000000"), d)
+}
+
+func (xact *xactBackup) aborted() bool {
+	select {
+	case <-xact.abrt:
+		return true
+	default:
+		return false
+	}
+}
+
+//===================
+//
+// xactPurge
+//
+//===================
+func (xact *xactPurge) tostring() string {
+	if !xact.finished() {
+		return fmt.Sprintf("xaction %s:%d started %v", xact.kind, xact.id, xact.stime.Format("15:04:05.000000"))
+	}
+	d := xact.etime.Sub(xact.stime)
+	return fmt.Sprintf("xaction %s:%d %v finished %v (duration %v)", xact.kind, xact.id,
+		xact.stime.Format("15:04:05.000000"), xact.etime.Format("15:04:05.000000"), d)
+}
+
+func (xact *xactPurge) aborted() bool {
+	select {
+	case <-xact.abrt:
+		return true
+	default:
+		return false
+	}
+}
+
 //===================
 //
 // xactRebalance
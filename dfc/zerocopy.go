@@ -0,0 +1,170 @@
+// Package dfc is a scalable object-storage based caching system with Amazon and Google Cloud backends.
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+// Zero-copy handoff (experimental).
+// A target built with the "zerocopy" tag (go build -tags zerocopy, Linux only)
+// and configured with zerocopy.socket listens on that Unix socket, so that
+// processes on the same host - e.g. the data loaders of a training job - read
+// cached objects without a TCP hop and without copying the data. For each
+// ZeroCopyRequest the target opens the object's file and passes its descriptor
+// (SCM_RIGHTS) along with a ZeroCopyResponse describing the extent; the client
+// maps the extent read-only, sharing the page cache with the target (see
+// client.GetZeroCopy). Objects are never rewritten in place, so a mapping stays
+// a consistent snapshot even if the object is replaced or evicted meanwhile.
+// Only cached, unencrypted objects are handed off: otherwise, the response
+// carries an error and the client falls back to GET. The socket is accessible
+// to the user the target runs as only. In a regular build zerocopyEnabled is
+// false and the socket is not created.
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/NVIDIA/dfcpub/3rdparty/glog"
+)
+
+const zerocopyMsgSize = 4096 // max size of ZeroCopyRequest and ZeroCopyResponse
+
+type zerocopyServer struct {
+	listener *net.UnixListener
+	open     func(req *ZeroCopyRequest, resp *ZeroCopyResponse) (*os.File, string)
+	stopped  int32
+}
+
+// startZeroCopy listens on the configured socket
+func (t *targetrunner) startZeroCopy() error {
+	socket := ctx.config.ZeroCopy.Socket
+	os.Remove(socket) // left over by the previous run
+	zs, err := newZeroCopyServer(socket, t.zerocopyOpen)
+	if err != nil {
+		return fmt.Errorf("Failed to listen on %s, err: %v", socket, err)
+	}
+	t.zerocopy = zs
+	go zs.run()
+	glog.Infof("Zero-copy handoff at %s", socket)
+	return nil
+}
+
+func newZeroCopyServer(socket string,
+	open func(req *ZeroCopyRequest, resp *ZeroCopyResponse) (*os.File, string)) (*zerocopyServer, error) {
+	// SOCK_SEQPACKET keeps the boundaries of the messages
+	listener, err := net.ListenUnix("unixpacket", &net.UnixAddr{Name: socket, Net: "unixpacket"})
+	if err != nil {
+		return nil, err
+	}
+	if err = os.Chmod(socket, 0600); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return &zerocopyServer{listener: listener, open: open}, nil
+}
+
+func (zs *zerocopyServer) run() {
+	for {
+		conn, err := zs.listener.AcceptUnix()
+		if err != nil {
+			if atomic.LoadInt32(&zs.stopped) == 0 {
+				glog.Errorf("Zero-copy handoff stopped, err: %v", err)
+			}
+			return
+		}
+		go zs.serve(conn)
+	}
+}
+
+func (zs *zerocopyServer) stop() {
+	atomic.StoreInt32(&zs.stopped, 1)
+	zs.listener.Close() // removes the socket
+}
+
+// serve answers the requests of one client, one message per request
+func (zs *zerocopyServer) serve(conn *net.UnixConn) {
+	defer conn.Close()
+	buf := make([]byte, zerocopyMsgSize)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			if err != io.EOF {
+				glog.Errorf("Zero-copy handoff: failed to read request, err: %v", err)
+			}
+			return
+		}
+		var (
+			file *os.File
+			oob  []byte
+			req  = &ZeroCopyRequest{}
+			resp = &ZeroCopyResponse{}
+		)
+		if err = json.Unmarshal(buf[:n], req); err != nil {
+			resp.Error = fmt.Sprintf("Invalid zero-copy request, err: %v", err)
+		} else {
+			file, resp.Error = zs.open(req, resp)
+		}
+		if file != nil {
+			oob = syscall.UnixRights(int(file.Fd()))
+		}
+		jsbytes, err := json.Marshal(resp)
+		assert(err == nil, err)
+		_, _, err = conn.WriteMsgUnix(jsbytes, oob, nil)
+		if file != nil {
+			file.Close() // the client has its own descriptor
+		}
+		if err != nil {
+			glog.Errorf("Zero-copy handoff: failed to respond, err: %v", err)
+			return
+		}
+	}
+}
+
+// zerocopyOpen opens the file of the cached object and fills in the extent
+func (t *targetrunner) zerocopyOpen(req *ZeroCopyRequest, resp *ZeroCopyResponse) (*os.File, string) {
+	if req.Bucket == "" || req.Objname == "" {
+		return nil, "Zero-copy request requires the bucket and the object names"
+	}
+	islocal := t.bmdowner.get().islocal(req.Bucket)
+	uname := uniquename(req.Bucket, req.Objname)
+	t.rtnamemap.lockname(uname, false, &pendinginfo{Time: time.Now(), fqn: t.fqn(req.Bucket, req.Objname, islocal)}, time.Second)
+	defer t.rtnamemap.unlockname(uname, false)
+
+	fqn := t.lookupfqn(req.Bucket, req.Objname, islocal)
+	file, err := os.Open(fqn)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Sprintf("%s/%s is not cached at %s", req.Bucket, req.Objname, t.si.DaemonID)
+		}
+		return nil, fmt.Sprintf("Failed to open %s, err: %v", fqn, err)
+	}
+	for _, xattr := range []string{XattrDataKey, XattrCustomerKeyHash} {
+		if value, _ := Getxattr(fqn, xattr); value != nil {
+			file.Close()
+			return nil, fmt.Sprintf("%s/%s is encrypted", req.Bucket, req.Objname)
+		}
+	}
+	finfo, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Sprintf("Failed to stat %s, err: %v", fqn, err)
+	}
+	size := finfo.Size()
+	if req.Offset < 0 || req.Offset > size || req.Length < 0 {
+		file.Close()
+		return nil, fmt.Sprintf("Invalid extent (offset %d, length %d) of %s/%s of %d bytes",
+			req.Offset, req.Length, req.Bucket, req.Objname, size)
+	}
+	resp.Size, resp.Offset, resp.Length = size, req.Offset, req.Length
+	if resp.Length == 0 || resp.Offset+resp.Length > size {
+		resp.Length = size - resp.Offset
+	}
+	getatimerunner().touch(fqn)
+	return file, ""
+}
@@ -0,0 +1,97 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package dfc
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"testing"
+)
+
+func TestZeroCopyServer(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("zero-copy handoff requires Linux")
+	}
+	dir, err := ioutil.TempDir("", "zerocopy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fqn := filepath.Join(dir, "obj")
+	if err = ioutil.WriteFile(fqn, []byte("0123456789"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	open := func(req *ZeroCopyRequest, resp *ZeroCopyResponse) (*os.File, string) {
+		if req.Objname != "obj" {
+			return nil, "not cached"
+		}
+		file, err := os.Open(fqn)
+		if err != nil {
+			return nil, err.Error()
+		}
+		resp.Size, resp.Offset, resp.Length = 10, req.Offset, req.Length
+		return file, ""
+	}
+	socket := filepath.Join(dir, "zerocopy.sock")
+	zs, err := newZeroCopyServer(socket, open)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go zs.run()
+	defer zs.stop()
+
+	conn, err := net.DialUnix("unixpacket", nil, &net.UnixAddr{Name: socket, Net: "unixpacket"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	request := func(req *ZeroCopyRequest) (*ZeroCopyResponse, *os.File) {
+		jsbytes, _ := json.Marshal(req)
+		if _, err := conn.Write(jsbytes); err != nil {
+			t.Fatal(err)
+		}
+		buf, oob := make([]byte, zerocopyMsgSize), make([]byte, syscall.CmsgSpace(4))
+		n, oobn, _, _, err := conn.ReadMsgUnix(buf, oob)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp := &ZeroCopyResponse{}
+		if err = json.Unmarshal(buf[:n], resp); err != nil {
+			t.Fatal(err)
+		}
+		if oobn == 0 {
+			return resp, nil
+		}
+		msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+		if err != nil || len(msgs) != 1 {
+			t.Fatalf("Unexpected control messages %v, err: %v", msgs, err)
+		}
+		fds, err := syscall.ParseUnixRights(&msgs[0])
+		if err != nil || len(fds) != 1 {
+			t.Fatalf("Unexpected descriptors %v, err: %v", fds, err)
+		}
+		return resp, os.NewFile(uintptr(fds[0]), "obj")
+	}
+
+	// the same connection serves several requests
+	resp, file := request(&ZeroCopyRequest{Bucket: "b", Objname: "obj", Offset: 4, Length: 3})
+	if resp.Error != "" || file == nil || resp.Size != 10 || resp.Offset != 4 || resp.Length != 3 {
+		t.Fatalf("Unexpected response %+v", resp)
+	}
+	b := make([]byte, resp.Length)
+	if _, err = file.ReadAt(b, resp.Offset); err != nil || string(b) != "456" {
+		t.Errorf("Read %q from the handed off descriptor, err: %v", b, err)
+	}
+	file.Close()
+	resp, file = request(&ZeroCopyRequest{Bucket: "b", Objname: "other"})
+	if resp.Error == "" || file != nil {
+		t.Errorf("Expected an error without a descriptor, got %+v", resp)
+	}
+}
@@ -8,6 +8,7 @@ package client
 import (
 	"bufio"
 	"bytes"
+	"encoding/base64"
 	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
@@ -36,10 +37,15 @@ const (
 )
 
 type (
+	// apiTransport is an http.RoundTripper that requests the latest DFC API
+	// version (see dfc.APIVersions) unless the request selects one
+	apiTransport struct {
+		transport http.RoundTripper
+	}
 	// traceableTransport is an http.RoundTripper that keeps track of a http
 	// request and implements hooks to report HTTP tracing events.
 	traceableTransport struct {
-		transport             *http.Transport
+		transport             http.RoundTripper
 		current               *http.Request
 		tsBegin               time.Time // request initialized
 		tsProxyConn           time.Time // connected with proxy
@@ -72,19 +78,34 @@ type (
 )
 
 var (
-	transport = &http.Transport{
+	transport = &apiTransport{&http.Transport{
 		DialContext: (&net.Dialer{
 			Timeout: 60 * time.Second,
 		}).DialContext,
 		TLSHandshakeTimeout: 600 * time.Second,
 		MaxIdleConnsPerHost: 100, // arbitrary number, to avoid connect: cannot assign requested address
-	}
+	}}
 	client = &http.Client{
 		Timeout:   600 * time.Second,
 		Transport: transport,
 	}
 )
 
+// RoundTrip sets the Accept header to the latest API version's media type
+func (t *apiTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("Accept") == "" {
+		// a RoundTripper must not modify the request
+		r := *req
+		r.Header = make(http.Header, len(req.Header)+1)
+		for key, value := range req.Header {
+			r.Header[key] = value
+		}
+		r.Header.Set("Accept", dfc.APIMediaType(dfc.APIVersions[len(dfc.APIVersions)-1]))
+		req = &r
+	}
+	return t.transport.RoundTrip(req)
+}
+
 // RoundTrip records the proxy redirect time and keeps track of requests.
 func (t *traceableTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 	if t.connCnt == 1 {
@@ -156,11 +177,37 @@ type BucketProps struct {
 	NextTierURL   string
 	ReadPolicy    string
 	WritePolicy   string
+	Encryption    string
+	CloudSSE      string
+	CloudSSEKeyID string
+	StorageClass  string
+	RequesterPays string
+	Fsync         string
+	MpathLabel    string
+	IngressLimit  string
+	EgressLimit   string
+	EgressBudget  string
+	WORM          string
+	Retention     string
+	ECData        string
+	ECParity      string
+	ECMinSize     string
+	Copies        string
 }
 
 type ObjectProps struct {
-	Size    int
-	Version string
+	Size          int
+	Version       string
+	CloudSSE      string
+	CloudSSEKeyID string
+	StorageClass  string
+	Restore       string
+	CloudProvider string
+	ChecksumType  string
+	Checksum      string
+	Cached        bool
+	Atime         string            // last access time of the cached object
+	Metadata      map[string]string // custom metadata
 }
 
 // Reader is the interface a client works with to read in data and send to a HTTP server
@@ -212,7 +259,7 @@ func readResponse(r *http.Response, w io.Writer, err error, src string, validate
 	// Note: This code can use some cleanup.
 	if err == nil {
 		if r.StatusCode >= http.StatusBadRequest {
-			return 0, "", fmt.Errorf("Bad status code from %s: http status %d", src, r.StatusCode)
+			return 0, "", newHTTPError(r, nil, "Bad status code from "+src)
 		}
 
 		bufreader := bufio.NewReader(r.Body)
@@ -243,7 +290,9 @@ func emitError(r *http.Response, err error, errch chan error) {
 		return
 	}
 
-	if r != nil {
+	if _, ok := err.(*HTTPError); ok {
+		errch <- err
+	} else if r != nil {
 		errObj := newReqError(err.Error(), r.StatusCode)
 		errch <- errObj
 	} else {
@@ -261,7 +310,7 @@ func get(proxyurl, bucket string, keyname string, wg *sync.WaitGroup, errch chan
 		defer wg.Done()
 	}
 
-	url := proxyurl + "/" + dfc.Rversion + "/" + dfc.Robjects + "/" + bucket + "/" + keyname
+	url := proxyurl + dfc.URLEscapedPath(dfc.Rversion, dfc.Robjects, bucket, keyname)
 	req, _ := http.NewRequest("GET", url, nil)
 	req.URL.RawQuery = query.Encode() // golang handles query == nil
 
@@ -350,12 +399,71 @@ func GetFileWithQuery(proxyurl, bucket string, keyname string, wg *sync.WaitGrou
 	return get(proxyurl, bucket, keyname, wg, errch, silent, validate, w, query)
 }
 
+// GetRange reads length bytes of the object starting at the offset - through
+// the end of the object if length is 0 - with the HTTP Range header and writes
+// them to w; returns the number of bytes written
+func GetRange(proxyURL, bucket, objname string, offset, length int64, w io.Writer) (int64, error) {
+	req, err := http.NewRequest(http.MethodGet, proxyURL+dfc.URLEscapedPath(dfc.Rversion, dfc.Robjects, bucket, objname), nil)
+	if err != nil {
+		return 0, err
+	}
+	rng := fmt.Sprintf("bytes=%d-", offset)
+	if length > 0 {
+		rng += strconv.FormatInt(offset+length-1, 10)
+	}
+	req.Header.Set(dfc.HeaderRange, rng)
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to do request, err = %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return 0, newHTTPError(resp, nil, "Get range of "+bucket+"/"+objname)
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		return 0, fmt.Errorf("Get range of %s/%s: unexpected status %s", bucket, objname, resp.Status)
+	}
+	n, err := io.Copy(w, resp.Body)
+	if err != nil {
+		return n, fmt.Errorf("Failed to read http response, err: %v", err)
+	}
+	return n, nil
+}
+
+// DeleteIf deletes the object only if it was not overwritten since the caller
+// has seen it: if ifMatch is not empty, the object must have one of its
+// versions or checksums ("*" - any existing object); if ifUnmodifiedSince is
+// not zero, the object must not have been modified after that time.
+// A failed precondition returns an HTTPError with status 412 (see IsPreconditionFailed)
+func DeleteIf(proxyURL, bucket, objname string, ifMatch []string, ifUnmodifiedSince time.Time) error {
+	req, err := http.NewRequest(http.MethodDelete, proxyURL+dfc.URLEscapedPath(dfc.Rversion, dfc.Robjects, bucket, objname), nil)
+	if err != nil {
+		return err
+	}
+	if len(ifMatch) > 0 {
+		req.Header.Set(dfc.HeaderIfMatch, strings.Join(ifMatch, ","))
+	}
+	if !ifUnmodifiedSince.IsZero() {
+		req.Header.Set(dfc.HeaderIfUnmodified, ifUnmodifiedSince.UTC().Format(http.TimeFormat))
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("Failed to do request, err = %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return newHTTPError(resp, nil, "Delete "+bucket+"/"+objname)
+	}
+	_, err = io.Copy(ioutil.Discard, resp.Body)
+	return err
+}
+
 func Del(proxyurl, bucket string, keyname string, wg *sync.WaitGroup, errch chan error, silent bool) (err error) {
 	if wg != nil {
 		defer wg.Done()
 	}
 
-	delurl := proxyurl + "/" + dfc.Rversion + "/" + dfc.Robjects + "/" + bucket + "/" + keyname
+	delurl := proxyurl + dfc.URLEscapedPath(dfc.Rversion, dfc.Robjects, bucket, keyname)
 	if !silent {
 		fmt.Printf("DEL: %s\n", keyname)
 	}
@@ -385,9 +493,17 @@ func Del(proxyurl, bucket string, keyname string, wg *sync.WaitGroup, errch chan
 // ListBucket returns list of objects in a bucket. objectCountLimit is the
 // maximum number of objects returned by ListBucket (0 - return all objects in a bucket)
 func ListBucket(proxyurl, bucket string, msg *dfc.GetMsg, objectCountLimit int) (*dfc.BucketList, error) {
-	var (
-		url = proxyurl + dfc.URLPath(dfc.Rversion, dfc.Rbuckets, bucket)
-	)
+	return listBucket(proxyurl+dfc.URLPath(dfc.Rversion, dfc.Rbuckets, bucket), msg, objectCountLimit)
+}
+
+// ListBucketCached returns list of objects of a cloud bucket that are cached in the
+// cluster. The cloud is not queried
+func ListBucketCached(proxyurl, bucket string, msg *dfc.GetMsg, objectCountLimit int) (*dfc.BucketList, error) {
+	url := proxyurl + dfc.URLPath(dfc.Rversion, dfc.Rbuckets, bucket) + "?" + dfc.URLParamCached + "=true"
+	return listBucket(url, msg, objectCountLimit)
+}
+
+func listBucket(url string, msg *dfc.GetMsg, objectCountLimit int) (*dfc.BucketList, error) {
 
 	reslist := &dfc.BucketList{Entries: make([]*dfc.BucketEntry, 0, 1000)}
 	// An optimization to read as few objects from bucket as possible.
@@ -438,7 +554,7 @@ func ListBucket(proxyurl, bucket string, msg *dfc.GetMsg, objectCountLimit int)
 		}
 
 		if resp.StatusCode >= http.StatusBadRequest {
-			return nil, fmt.Errorf("HTTP error %d, message = %v", resp.StatusCode, string(b))
+			return nil, newHTTPError(resp, b, "List bucket")
 		}
 
 		err = json.Unmarshal(b, page)
@@ -447,6 +563,7 @@ func ListBucket(proxyurl, bucket string, msg *dfc.GetMsg, objectCountLimit int)
 		}
 
 		reslist.Entries = append(reslist.Entries, page.Entries...)
+		reslist.CommonPrefixes = append(reslist.CommonPrefixes, page.CommonPrefixes...)
 		if page.PageMarker == "" {
 			break
 		}
@@ -478,7 +595,7 @@ func Evict(proxyurl, bucket string, fname string) error {
 		return fmt.Errorf("Failed to marshal EvictMsg: %v", err)
 	}
 
-	req, err = http.NewRequest("DELETE", proxyurl+"/"+dfc.Rversion+"/"+dfc.Robjects+"/"+bucket+"/"+fname, bytes.NewBuffer(injson))
+	req, err = http.NewRequest("DELETE", proxyurl+dfc.URLEscapedPath(dfc.Rversion, dfc.Robjects, bucket, fname), bytes.NewBuffer(injson))
 	if err != nil {
 		return fmt.Errorf("Failed to create request: %v", err)
 	}
@@ -593,13 +710,7 @@ func HeadBucket(proxyURL, bucket string) (*BucketProps, error) {
 		r.Body.Close()
 	}()
 	if r.StatusCode >= http.StatusBadRequest {
-		b, err := ioutil.ReadAll(r.Body)
-		if err != nil {
-			return nil, fmt.Errorf(
-				"ioutil.ReadAll falled on response body, err: %v, HTTP status code: %d", err, r.StatusCode)
-		}
-		return nil, fmt.Errorf("head bucket: %s failed, HTTP status code: %d, HTTP response body: %s",
-			bucket, r.StatusCode, string(b))
+		return nil, newHTTPError(r, nil, "head bucket "+bucket)
 	}
 	return &BucketProps{
 		CloudProvider: r.Header.Get(dfc.CloudProvider),
@@ -607,12 +718,28 @@ func HeadBucket(proxyURL, bucket string) (*BucketProps, error) {
 		NextTierURL:   r.Header.Get(dfc.NextTierURL),
 		ReadPolicy:    r.Header.Get(dfc.ReadPolicy),
 		WritePolicy:   r.Header.Get(dfc.WritePolicy),
+		Encryption:    r.Header.Get(dfc.Encryption),
+		CloudSSE:      r.Header.Get(dfc.CloudSSE),
+		CloudSSEKeyID: r.Header.Get(dfc.CloudSSEKeyID),
+		StorageClass:  r.Header.Get(dfc.StorageClass),
+		RequesterPays: r.Header.Get(dfc.RequesterPays),
+		Fsync:         r.Header.Get(dfc.Fsync),
+		MpathLabel:    r.Header.Get(dfc.MpathLabel),
+		IngressLimit:  r.Header.Get(dfc.IngressLimit),
+		EgressLimit:   r.Header.Get(dfc.EgressLimit),
+		EgressBudget:  r.Header.Get(dfc.EgressBudget),
+		WORM:          r.Header.Get(dfc.WORM),
+		Retention:     r.Header.Get(dfc.Retention),
+		ECData:        r.Header.Get(dfc.ECData),
+		ECParity:      r.Header.Get(dfc.ECParity),
+		ECMinSize:     r.Header.Get(dfc.ECMinSize),
+		Copies:        r.Header.Get(dfc.Copies),
 	}, nil
 }
 
 func HeadObject(proxyurl, bucket, objname string) (objProps *ObjectProps, err error) {
 	var (
-		url = proxyurl + "/" + dfc.Rversion + "/" + dfc.Robjects + "/" + bucket + "/" + objname
+		url = proxyurl + dfc.URLEscapedPath(dfc.Rversion, dfc.Robjects, bucket, objname)
 		r   *http.Response
 	)
 	objProps = &ObjectProps{}
@@ -624,13 +751,7 @@ func HeadObject(proxyurl, bucket, objname string) (objProps *ObjectProps, err er
 		r.Body.Close()
 	}()
 	if r != nil && r.StatusCode >= http.StatusBadRequest {
-		b, ioErr := ioutil.ReadAll(r.Body)
-		if ioErr != nil {
-			err = fmt.Errorf("failed to read response body, err = %s", ioErr)
-			return
-		}
-		err = fmt.Errorf("head bucket/object: %s/%s failed, HTTP status code: %d, HTTP response body: %s",
-			bucket, objname, r.StatusCode, string(b))
+		err = newHTTPError(r, nil, "head bucket/object "+bucket+"/"+objname)
 		return
 	}
 	size, err := strconv.Atoi(r.Header.Get(dfc.Size))
@@ -640,9 +761,203 @@ func HeadObject(proxyurl, bucket, objname string) (objProps *ObjectProps, err er
 
 	objProps.Size = size
 	objProps.Version = r.Header.Get(dfc.Version)
+	objProps.CloudSSE = r.Header.Get(dfc.CloudSSE)
+	objProps.CloudSSEKeyID = r.Header.Get(dfc.CloudSSEKeyID)
+	objProps.StorageClass = r.Header.Get(dfc.StorageClass)
+	objProps.Restore = r.Header.Get(dfc.Restore)
+	objProps.CloudProvider = r.Header.Get(dfc.CloudProvider)
+	objProps.ChecksumType = r.Header.Get(dfc.HeaderDfcChecksumType)
+	objProps.Checksum = r.Header.Get(dfc.HeaderDfcChecksumVal)
+	objProps.Cached, _ = strconv.ParseBool(r.Header.Get(dfc.Cached))
+	objProps.Atime = r.Header.Get(dfc.Atime)
+	for k := range r.Header {
+		if strings.HasPrefix(k, dfc.HeaderDfcMetaPrefix) {
+			if objProps.Metadata == nil {
+				objProps.Metadata = make(map[string]string)
+			}
+			objProps.Metadata[strings.TrimPrefix(k, dfc.HeaderDfcMetaPrefix)] = r.Header.Get(k)
+		}
+	}
 	return
 }
 
+// RestoreObject requests a temporary copy of an archived cloud object for the given
+// number of days. Restoring is asynchronous: use HeadObject to check its progress
+func RestoreObject(proxyURL, bucket, objname string, days int64, tier string) error {
+	msg, err := json.Marshal(dfc.ActionMsg{Action: dfc.ActRestore, Value: dfc.RestoreMsg{Days: days, Tier: tier}})
+	if err != nil {
+		return err
+	}
+	return HTTPRequest(http.MethodPost, proxyURL+dfc.URLEscapedPath(dfc.Rversion, dfc.Robjects, bucket, objname),
+		bytes.NewBuffer(msg))
+}
+
+// LocateObjects returns the owning target of each object and whether the
+// object is cached there. The locations are in the same order as objnames
+func LocateObjects(proxyURL, bucket string, objnames []string) ([]*dfc.ObjectLocation, error) {
+	msg, err := json.Marshal(dfc.ActionMsg{Action: dfc.ActLocate, Value: dfc.ListMsg{Objnames: objnames}})
+	if err != nil {
+		return nil, err
+	}
+	url := proxyURL + dfc.URLPath(dfc.Rversion, dfc.Rbuckets, bucket)
+	resp, err := client.Post(url, "application/json", bytes.NewBuffer(msg))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to do request, err = %v", err)
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read response body, err = %v", err)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil, newHTTPError(resp, b, "Locate objects")
+	}
+
+	result := &dfc.LocateResult{}
+	if err = json.Unmarshal(b, result); err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal object locations, err: %v - [%s]", err, string(b))
+	}
+	return result.Objects, nil
+}
+
+// HeadObjects returns the status of each object: whether it exists and is
+// cached, its size and version. The statuses are in the same order as objnames.
+// With cachedOnly the Cloud is not queried: objects that are not cached are
+// reported as not existing
+func HeadObjects(proxyURL, bucket string, objnames []string, cachedOnly bool) ([]*dfc.ObjectStatus, error) {
+	msg, err := json.Marshal(dfc.ActionMsg{Action: dfc.ActHeadObjects, Value: dfc.ListMsg{Objnames: objnames}})
+	if err != nil {
+		return nil, err
+	}
+	url := proxyURL + dfc.URLPath(dfc.Rversion, dfc.Rbuckets, bucket)
+	if cachedOnly {
+		url += "?" + dfc.URLParamCached + "=true"
+	}
+	resp, err := client.Post(url, "application/json", bytes.NewBuffer(msg))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to do request, err = %v", err)
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read response body, err = %v", err)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil, newHTTPError(resp, b, "HEAD objects")
+	}
+
+	result := &dfc.HeadObjectsResult{}
+	if err = json.Unmarshal(b, result); err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal object statuses, err: %v - [%s]", err, string(b))
+	}
+	return result.Objects, nil
+}
+
+// GetBatch reads a batch of samples of a dataset of exported shards and writes
+// the tar archive of the samples to w. Returns the number of batches in the epoch
+func GetBatch(proxyURL, bucket string, batchmsg *dfc.BatchMsg, w io.Writer) (int, error) {
+	msg, err := json.Marshal(dfc.ActionMsg{Action: dfc.ActGetBatch, Value: batchmsg})
+	if err != nil {
+		return 0, err
+	}
+	url := proxyURL + dfc.URLPath(dfc.Rversion, dfc.Rbuckets, bucket)
+	resp, err := client.Post(url, "application/json", bytes.NewBuffer(msg))
+	if err != nil {
+		return 0, fmt.Errorf("Failed to do request, err = %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return 0, newHTTPError(resp, nil, "Get batch")
+	}
+	count, _ := strconv.Atoi(resp.Header.Get(dfc.HeaderDfcBatchCount))
+	if _, err = io.Copy(w, resp.Body); err != nil {
+		return 0, fmt.Errorf("Failed to read batch %d, err: %v", batchmsg.Batch, err)
+	}
+	return count, nil
+}
+
+// StartPrefetchJob starts a prefetch job for a training job that reads the
+// shards of the cloud bucket. The job's consumer reports its progress with
+// SetJobPosition to the same proxy
+func StartPrefetchJob(proxyURL, bucket string, jobmsg *dfc.PrefetchJobMsg) (*dfc.PrefetchJobInfo, error) {
+	return prefetchJobAction(proxyURL, bucket, dfc.ActPrefetchJob, jobmsg)
+}
+
+// SetJobPosition reports the number of shards of the epoch the consumer of the
+// prefetch job has read
+func SetJobPosition(proxyURL, bucket, id string, epoch, position int) (*dfc.PrefetchJobInfo, error) {
+	return prefetchJobAction(proxyURL, bucket, dfc.ActJobPosition,
+		&dfc.JobPositionMsg{ID: id, Epoch: epoch, Position: position})
+}
+
+// StopPrefetchJob stops the prefetch job
+func StopPrefetchJob(proxyURL, bucket, id string) error {
+	_, err := prefetchJobAction(proxyURL, bucket, dfc.ActJobStop, &dfc.JobPositionMsg{ID: id})
+	return err
+}
+
+func prefetchJobAction(proxyURL, bucket, action string, value interface{}) (*dfc.PrefetchJobInfo, error) {
+	msg, err := json.Marshal(dfc.ActionMsg{Action: action, Value: value})
+	if err != nil {
+		return nil, err
+	}
+	url := proxyURL + dfc.URLPath(dfc.Rversion, dfc.Rbuckets, bucket)
+	resp, err := client.Post(url, "application/json", bytes.NewBuffer(msg))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to do request, err = %v", err)
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read response body, err = %v", err)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil, newHTTPError(resp, b, "Prefetch job "+action)
+	}
+
+	info := &dfc.PrefetchJobInfo{}
+	if err = json.Unmarshal(b, info); err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal prefetch job, err: %v - [%s]", err, string(b))
+	}
+	return info, nil
+}
+
+// SelfTest runs the cluster self-test and returns its report
+func SelfTest(proxyURL string, testmsg *dfc.SelfTestMsg) (*dfc.SelfTestReport, error) {
+	msg, err := json.Marshal(dfc.ActionMsg{Action: dfc.ActSelfTest, Value: testmsg})
+	if err != nil {
+		return nil, err
+	}
+	url := proxyURL + dfc.URLPath(dfc.Rversion, dfc.Rcluster)
+	req, err := http.NewRequest(http.MethodPut, url, bytes.NewBuffer(msg))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create request, err = %v", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to do request, err = %v", err)
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read response body, err = %v", err)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil, newHTTPError(resp, b, "Self-test")
+	}
+
+	report := &dfc.SelfTestReport{}
+	if err = json.Unmarshal(b, report); err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal self-test report, err: %v - [%s]", err, string(b))
+	}
+	return report, nil
+}
+
 func SetBucketProps(proxyurl, bucket string, props dfc.BucketProps) error {
 	var url = proxyurl + dfc.URLPath(dfc.Rversion, dfc.Rbuckets, bucket)
 
@@ -665,19 +980,14 @@ func SetBucketProps(proxyurl, bucket string, props dfc.BucketProps) error {
 	}()
 
 	if resp != nil && resp.StatusCode >= http.StatusBadRequest {
-		b, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			return fmt.Errorf("failed to read response body, err = %s", err)
-		}
-		return fmt.Errorf("failed SetBucketProps, HTTP status code: %d, HTTP response body: %s, bucket: %s",
-			resp.StatusCode, string(b), bucket)
+		return newHTTPError(resp, nil, "SetBucketProps "+bucket)
 	}
 	return nil
 }
 
 func IsCached(proxyurl, bucket, objname string) (bool, error) {
 	var (
-		url = proxyurl + dfc.URLPath(dfc.Rversion, dfc.Robjects, bucket, objname) + "?" + dfc.URLParamCheckCached + "=true"
+		url = proxyurl + dfc.URLEscapedPath(dfc.Rversion, dfc.Robjects, bucket, objname) + "?" + dfc.URLParamCheckCached + "=true"
 		r   *http.Response
 	)
 	r, err := client.Head(url)
@@ -691,24 +1001,357 @@ func IsCached(proxyurl, bucket, objname string) (bool, error) {
 		if r.StatusCode == http.StatusNotFound {
 			return false, nil
 		}
-		b, ioErr := ioutil.ReadAll(r.Body)
-		if ioErr != nil {
-			err = fmt.Errorf("failed to read response body, err = %s", ioErr)
-			return false, err
-		}
-		err = fmt.Errorf("IsCached failed: bucket/object: %s/%s, HTTP status code: %d, HTTP response body: %s",
-			bucket, objname, r.StatusCode, string(b))
-		return false, err
+		return false, newHTTPError(r, nil, "IsCached "+bucket+"/"+objname)
 	}
 	return true, nil
 }
 
+// GetObjectMeta returns the properties of the object set by the user
+func GetObjectMeta(proxyURL, bucket, objname string) (*dfc.ObjectMeta, error) {
+	url := proxyURL + dfc.URLEscapedPath(dfc.Rversion, dfc.Robjects, bucket, objname) + "?" + dfc.URLParamWhat + "=" + dfc.GetWhatObjMeta
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return doObjectMeta(req, "Get object meta "+bucket+"/"+objname)
+}
+
+// PatchObjectMeta changes the properties of the object and returns them
+func PatchObjectMeta(proxyURL, bucket, objname string, patch *dfc.ObjectMetaPatch) (*dfc.ObjectMeta, error) {
+	msg, err := json.Marshal(patch)
+	if err != nil {
+		return nil, err
+	}
+	url := proxyURL + dfc.URLEscapedPath(dfc.Rversion, dfc.Robjects, bucket, objname)
+	req, err := http.NewRequest(http.MethodPatch, url, bytes.NewReader(msg))
+	if err != nil {
+		return nil, err
+	}
+	return doObjectMeta(req, "Patch object meta "+bucket+"/"+objname)
+}
+
+func doObjectMeta(req *http.Request, op string) (*dfc.ObjectMeta, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to do request, err = %v", err)
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read response body, err = %v", err)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil, newHTTPError(resp, b, op)
+	}
+
+	meta := &dfc.ObjectMeta{}
+	if err = json.Unmarshal(b, meta); err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal object meta, err: %v - [%s]", err, string(b))
+	}
+	return meta, nil
+}
+
+// PinObject pins the object, so that LRU never evicts it, or unpins it
+func PinObject(proxyURL, bucket, objname string, pin bool) error {
+	msg, err := json.Marshal(dfc.ActionMsg{Action: pinAction(pin)})
+	if err != nil {
+		return err
+	}
+	return HTTPRequest(http.MethodPost, proxyURL+dfc.URLEscapedPath(dfc.Rversion, dfc.Robjects, bucket, objname),
+		bytes.NewBuffer(msg))
+}
+
+// PinPrefix pins the objects of the bucket with the prefix, or unpins them
+func PinPrefix(proxyURL, bucket, prefix string, pin bool) error {
+	msg, err := json.Marshal(dfc.ActionMsg{Action: pinAction(pin), Value: dfc.PinMsg{Prefix: prefix}})
+	if err != nil {
+		return err
+	}
+	return HTTPRequest(http.MethodPost, proxyURL+dfc.URLPath(dfc.Rversion, dfc.Rbuckets, bucket),
+		bytes.NewBuffer(msg))
+}
+
+func pinAction(pin bool) string {
+	if pin {
+		return dfc.ActPin
+	}
+	return dfc.ActUnpin
+}
+
+// ListPinned returns the pinned prefixes and objects of the bucket
+func ListPinned(proxyURL, bucket string) (*dfc.PinnedList, error) {
+	url := proxyURL + dfc.URLPath(dfc.Rversion, dfc.Rbuckets, bucket) + "?" + dfc.URLParamWhat + "=" + dfc.GetWhatPinned
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to do request, err = %v", err)
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read response body, err = %v", err)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil, newHTTPError(resp, b, "List pinned "+bucket)
+	}
+
+	list := &dfc.PinnedList{}
+	if err = json.Unmarshal(b, list); err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal pinned list, err: %v - [%s]", err, string(b))
+	}
+	return list, nil
+}
+
+// SetWarmup registers the warm-up manifest of the Cloud bucket: the objects
+// the targets prefetch upon startup and rebalance. No objects remove it
+func SetWarmup(proxyURL, bucket string, objnames []string) error {
+	msg, err := json.Marshal(dfc.ActionMsg{Action: dfc.ActWarmup, Value: dfc.WarmupMsg{Objnames: objnames}})
+	if err != nil {
+		return err
+	}
+	return HTTPRequest(http.MethodPost, proxyURL+dfc.URLPath(dfc.Rversion, dfc.Rbuckets, bucket),
+		bytes.NewBuffer(msg))
+}
+
+// GetWarmup returns the warm-up manifest of the bucket
+func GetWarmup(proxyURL, bucket string) ([]string, error) {
+	url := proxyURL + dfc.URLPath(dfc.Rversion, dfc.Rbuckets, bucket) + "?" + dfc.URLParamWhat + "=" + dfc.GetWhatWarmup
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to do request, err = %v", err)
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read response body, err = %v", err)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil, newHTTPError(resp, b, "Get warm-up "+bucket)
+	}
+
+	warmupmsg := &dfc.WarmupMsg{}
+	if err = json.Unmarshal(b, warmupmsg); err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal warm-up manifest, err: %v - [%s]", err, string(b))
+	}
+	return warmupmsg.Objnames, nil
+}
+
+// PublishDataset publishes the version of the dataset uploaded under
+// <dataset>/<version>/ in the local bucket
+func PublishDataset(proxyURL, bucket string, pubmsg *dfc.PublishMsg) error {
+	msg, err := json.Marshal(dfc.ActionMsg{Action: dfc.ActPublish, Value: pubmsg})
+	if err != nil {
+		return err
+	}
+	return HTTPRequest(http.MethodPost, proxyURL+dfc.URLPath(dfc.Rversion, dfc.Rbuckets, bucket),
+		bytes.NewBuffer(msg))
+}
+
+// ListDatasets returns the published datasets of the local bucket
+func ListDatasets(proxyURL, bucket string) ([]dfc.DatasetInfo, error) {
+	url := proxyURL + dfc.URLPath(dfc.Rversion, dfc.Rbuckets, bucket) + "?" + dfc.URLParamWhat + "=" + dfc.GetWhatDatasets
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to do request, err = %v", err)
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read response body, err = %v", err)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil, newHTTPError(resp, b, "List datasets "+bucket)
+	}
+
+	var datasets []dfc.DatasetInfo
+	if err = json.Unmarshal(b, &datasets); err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal datasets, err: %v - [%s]", err, string(b))
+	}
+	return datasets, nil
+}
+
+// RollbackDataset makes the kept version of the dataset current again
+func RollbackDataset(proxyURL, bucket, dataset, version string) error {
+	msg, err := json.Marshal(dfc.ActionMsg{Action: dfc.ActRollback, Value: dfc.PublishMsg{Dataset: dataset, Version: version}})
+	if err != nil {
+		return err
+	}
+	return HTTPRequest(http.MethodPost, proxyURL+dfc.URLPath(dfc.Rversion, dfc.Rbuckets, bucket),
+		bytes.NewBuffer(msg))
+}
+
+// DiffDataset returns the objects added, removed and changed between two versions of the dataset
+func DiffDataset(proxyURL, bucket, dataset, from, to string) (*dfc.DatasetDiff, error) {
+	q := url.Values{}
+	q.Set(dfc.URLParamWhat, dfc.GetWhatDiff)
+	q.Set(dfc.URLParamDataset, dataset)
+	q.Set(dfc.URLParamFromVersion, from)
+	q.Set(dfc.URLParamToVersion, to)
+	resp, err := client.Get(proxyURL + dfc.URLPath(dfc.Rversion, dfc.Rbuckets, bucket) + "?" + q.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("Failed to do request, err = %v", err)
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read response body, err = %v", err)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil, newHTTPError(resp, b, "Diff dataset "+bucket+"/"+dataset)
+	}
+
+	diff := &dfc.DatasetDiff{}
+	if err = json.Unmarshal(b, diff); err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal dataset diff, err: %v - [%s]", err, string(b))
+	}
+	return diff, nil
+}
+
+// BucketSummary returns the number and the size of the objects of the bucket
+// with the prefix; cachedOnly - only the objects stored by the cluster
+func BucketSummary(proxyURL, bucket, prefix string, cachedOnly, reload bool) (*dfc.BucketSummary, error) {
+	q := url.Values{}
+	q.Set(dfc.URLParamWhat, dfc.GetWhatSummary)
+	q.Set(dfc.URLParamPrefix, prefix)
+	q.Set(dfc.URLParamCached, strconv.FormatBool(cachedOnly))
+	q.Set(dfc.URLParamReload, strconv.FormatBool(reload))
+	resp, err := client.Get(proxyURL + dfc.URLPath(dfc.Rversion, dfc.Rbuckets, bucket) + "?" + q.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("Failed to do request, err = %v", err)
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read response body, err = %v", err)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil, newHTTPError(resp, b, "Bucket summary "+bucket)
+	}
+
+	summary := &dfc.BucketSummary{}
+	if err = json.Unmarshal(b, summary); err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal bucket summary, err: %v - [%s]", err, string(b))
+	}
+	return summary, nil
+}
+
+// BucketStats returns the GET, PUT, DELETE, eviction and error counters of the
+// bucket summed up across the cluster's targets; bucket "" - of all buckets
+func BucketStats(proxyURL, bucket string) (*dfc.BucketStatsReport, error) {
+	q := url.Values{}
+	q.Set(dfc.URLParamWhat, dfc.GetWhatBckStats)
+	if bucket != "" {
+		q.Set(dfc.URLParamBucket, bucket)
+	}
+	resp, err := client.Get(proxyURL + dfc.URLPath(dfc.Rversion, dfc.Rcluster) + "?" + q.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("Failed to do request, err = %v", err)
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read response body, err = %v", err)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil, newHTTPError(resp, b, "Bucket stats")
+	}
+
+	report := &dfc.BucketStatsReport{}
+	if err = json.Unmarshal(b, report); err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal bucket stats, err: %v - [%s]", err, string(b))
+	}
+	return report, nil
+}
+
+// WalkObjects returns a page of up to limit objects stored by the target that
+// follow the marker; bucket "" - the objects of all buckets
+func WalkObjects(targetURL, bucket, marker string, limit int) (*dfc.ObjectWalkPage, error) {
+	q := url.Values{}
+	q.Set(dfc.URLParamWhat, dfc.GetWhatObjects)
+	q.Set(dfc.URLParamBucket, bucket)
+	q.Set(dfc.URLParamMarker, marker)
+	if limit != 0 {
+		q.Set(dfc.URLParamLimit, strconv.Itoa(limit))
+	}
+	resp, err := client.Get(targetURL + dfc.URLPath(dfc.Rversion, dfc.Rdaemon) + "?" + q.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("Failed to do request, err = %v", err)
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read response body, err = %v", err)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil, newHTTPError(resp, b, "Walk objects of "+targetURL)
+	}
+
+	page := &dfc.ObjectWalkPage{}
+	if err = json.Unmarshal(b, page); err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal objects, err: %v - [%s]", err, string(b))
+	}
+	return page, nil
+}
+
+// Backup starts the backup of the local bucket to the Cloud bucket or, if
+// restore, the restore of the local bucket from the latter
+func Backup(proxyURL, bucket string, restore bool, bakmsg *dfc.BackupMsg) error {
+	action := dfc.ActBackup
+	if restore {
+		action = dfc.ActRestoreBak
+	}
+	msg, err := json.Marshal(dfc.ActionMsg{Action: action, Value: bakmsg})
+	if err != nil {
+		return err
+	}
+	return HTTPRequest(http.MethodPost, proxyURL+dfc.URLPath(dfc.Rversion, dfc.Rbuckets, bucket),
+		bytes.NewBuffer(msg))
+}
+
+// StopBackup aborts the backup or the restore of the local bucket
+func StopBackup(proxyURL, bucket string) error {
+	msg, err := json.Marshal(dfc.ActionMsg{Action: dfc.ActBackupStop})
+	if err != nil {
+		return err
+	}
+	return HTTPRequest(http.MethodPost, proxyURL+dfc.URLPath(dfc.Rversion, dfc.Rbuckets, bucket),
+		bytes.NewBuffer(msg))
+}
+
+// BackupResults returns the progress of the running backup or restore, or
+// else the results of the last one, by target ID
+func BackupResults(proxyURL string) (map[string]*dfc.BackupResult, error) {
+	resp, err := client.Get(proxyURL + dfc.URLPath(dfc.Rversion, dfc.Rcluster) + "?" + dfc.URLParamWhat + "=" + dfc.GetWhatBackup)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to do request, err = %v", err)
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read response body, err = %v", err)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil, newHTTPError(resp, b, "Backup results")
+	}
+
+	results := make(map[string]*dfc.BackupResult)
+	if err = json.Unmarshal(b, &results); err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal backup results, err: %v - [%s]", err, string(b))
+	}
+	return results, nil
+}
+
 func checkHTTPStatus(resp *http.Response, op string) error {
 	if resp.StatusCode >= http.StatusBadRequest {
-		return ReqError{
-			code:    resp.StatusCode,
-			message: fmt.Sprintf("Bad status code from %s", op),
-		}
+		return newHTTPError(resp, nil, "Bad status code from "+op)
 	}
 
 	return nil
@@ -721,7 +1364,49 @@ func discardHTTPResp(resp *http.Response) {
 
 // Put sends a PUT request to the given URL
 func Put(proxyURL string, reader Reader, bucket string, key string, silent bool) error {
-	url := proxyURL + "/" + dfc.Rversion + "/" + dfc.Robjects + "/" + bucket + "/" + key
+	return put(proxyURL, reader, bucket, key, silent, nil, nil)
+}
+
+// PutInGroup sends a PUT request for an object of a placement group: objects of
+// the same group are stored by the same target. GET requests must specify the
+// same group (see GetWithQuery and dfc.URLParamPlacementGroup)
+func PutInGroup(proxyURL string, reader Reader, bucket, key, pgroup string, silent bool) error {
+	query := url.Values{}
+	query.Set(dfc.URLParamPlacementGroup, pgroup)
+	return put(proxyURL, reader, bucket, key, silent, nil, query)
+}
+
+// PutWithCustomerKey sends a PUT request; the cloud encrypts the object with the
+// customer-supplied key (GCS buckets only). The key is not stored by DFC: the
+// object can be read only with GetWithCustomerKey and the same key
+func PutWithCustomerKey(proxyURL string, reader Reader, bucket, key string, csek []byte) error {
+	header := http.Header{}
+	header.Set(dfc.HeaderDfcCustomerKey, base64.StdEncoding.EncodeToString(csek))
+	return put(proxyURL, reader, bucket, key, true /* silent */, header, nil)
+}
+
+// GetWithCustomerKey reads an object protected with a customer-supplied key and
+// writes it to w
+func GetWithCustomerKey(proxyURL, bucket, key string, csek []byte, w io.Writer) (int64, error) {
+	req, err := http.NewRequest(http.MethodGet, proxyURL+dfc.URLEscapedPath(dfc.Rversion, dfc.Robjects, bucket, key), nil)
+	if err != nil {
+		return 0, err
+	}
+	// the header is forwarded to the target on redirect
+	req.Header.Set(dfc.HeaderDfcCustomerKey, base64.StdEncoding.EncodeToString(csek))
+	resp, err := client.Do(req)
+	defer func() {
+		if resp != nil {
+			resp.Body.Close()
+		}
+	}()
+	len, _, err := readResponse(resp, w, err, fmt.Sprintf("GET (object %s from bucket %s)", key, bucket), false)
+	return len, err
+}
+
+func put(proxyURL string, reader Reader, bucket string, key string, silent bool, header http.Header,
+	query url.Values) error {
+	url := proxyURL + dfc.URLEscapedPath(dfc.Rversion, dfc.Robjects, bucket, key)
 
 	if !silent {
 		fmt.Printf("PUT: %s/%s\n", bucket, key)
@@ -737,6 +1422,7 @@ func Put(proxyURL string, reader Reader, bucket string, key string, silent bool)
 	if err != nil {
 		return fmt.Errorf("Failed to create new http request, err: %v", err)
 	}
+	req.URL.RawQuery = query.Encode() // golang handles query == nil
 
 	// The HTTP package doesn't automatically set this for files, so it has to be done manually
 	// If it wasn't set, we would need to deal with the redirect manually.
@@ -748,6 +1434,9 @@ func Put(proxyURL string, reader Reader, bucket string, key string, silent bool)
 		req.Header.Set(dfc.HeaderDfcChecksumType, dfc.ChecksumXXHash)
 		req.Header.Set(dfc.HeaderDfcChecksumVal, reader.XXHash())
 	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
 
 	resp, err := client.Do(req)
 	if err != nil {
@@ -761,12 +1450,7 @@ func Put(proxyURL string, reader Reader, bucket string, key string, silent bool)
 	}()
 
 	if resp.StatusCode >= http.StatusBadRequest {
-		b, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			return fmt.Errorf("Failed to read response body, err = %v", err)
-		}
-
-		return fmt.Errorf("HTTP error = %d, message = %s", resp.StatusCode, string(b))
+		return newHTTPError(resp, nil, "")
 	}
 
 	return nil
@@ -989,7 +1673,7 @@ func ListBuckets(proxyURL string, local bool) (*dfc.BucketNames, error) {
 		url += "?local=true"
 	}
 
-	resp, err := http.Get(url)
+	resp, err := client.Get(url)
 	if err != nil {
 		return nil, err
 	}
@@ -997,7 +1681,7 @@ func ListBuckets(proxyURL string, local bool) (*dfc.BucketNames, error) {
 	defer resp.Body.Close()
 
 	if resp != nil && resp.StatusCode >= http.StatusBadRequest {
-		return nil, fmt.Errorf("HTTP failed, status = %d", resp.StatusCode)
+		return nil, newHTTPError(resp, nil, "List buckets")
 	}
 
 	var b []byte
@@ -1032,7 +1716,7 @@ func GetClusterMap(url string) (dfc.Smap, error) {
 	}
 
 	if r != nil && r.StatusCode >= http.StatusBadRequest {
-		return dfc.Smap{}, fmt.Errorf("get Smap, http status %d", r.StatusCode)
+		return dfc.Smap{}, newHTTPError(r, nil, "get Smap")
 	}
 
 	var (
@@ -1083,8 +1767,7 @@ func getXactionResponse(proxyURL string, kind string) ([]byte, error) {
 	}
 
 	if r != nil && r.StatusCode >= http.StatusBadRequest {
-		return []byte{},
-			fmt.Errorf("Get xaction, HTTP Status %d", r.StatusCode)
+		return []byte{}, newHTTPError(r, nil, "Get xaction")
 	}
 
 	var response []byte
@@ -1106,6 +1789,43 @@ func GetPrimaryProxy(url string) (string, error) {
 	return smap.ProxySI.DirectURL, nil
 }
 
+// InjectFault injects a fault into a proxy or target; the daemon must be built
+// with the debug build tag
+func InjectFault(daemonURL string, fault dfc.FaultMsg) error {
+	msg, err := json.Marshal(dfc.ActionMsg{Action: dfc.ActInjectFault, Value: fault})
+	if err != nil {
+		return err
+	}
+	return HTTPRequest(http.MethodPut, daemonURL+dfc.URLPath(dfc.Rversion, dfc.Rdaemon), bytes.NewBuffer(msg))
+}
+
+// ClearFaults removes all faults injected into a proxy or target
+func ClearFaults(daemonURL string) error {
+	msg, err := json.Marshal(dfc.ActionMsg{Action: dfc.ActClearFaults})
+	if err != nil {
+		return err
+	}
+	return HTTPRequest(http.MethodPut, daemonURL+dfc.URLPath(dfc.Rversion, dfc.Rdaemon), bytes.NewBuffer(msg))
+}
+
+// ResetStats zeroes the stats counters of a proxy or target
+func ResetStats(daemonURL string) error {
+	msg, err := json.Marshal(dfc.ActionMsg{Action: dfc.ActResetStats})
+	if err != nil {
+		return err
+	}
+	return HTTPRequest(http.MethodPut, daemonURL+dfc.URLPath(dfc.Rversion, dfc.Rdaemon), bytes.NewBuffer(msg))
+}
+
+// ResetClusterStats zeroes the stats counters of all proxies and targets
+func ResetClusterStats(proxyURL string) error {
+	msg, err := json.Marshal(dfc.ActionMsg{Action: dfc.ActResetStats})
+	if err != nil {
+		return err
+	}
+	return HTTPRequest(http.MethodPut, proxyURL+dfc.URLPath(dfc.Rversion, dfc.Rcluster), bytes.NewBuffer(msg))
+}
+
 func UnregisterTarget(proxyURL, sid string) error {
 	smap, err := GetClusterMap(proxyURL)
 	if err != nil {
@@ -1146,12 +1866,7 @@ func HTTPRequest(method string, url string, msg io.Reader) error {
 	}()
 
 	if resp.StatusCode >= http.StatusBadRequest {
-		b, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			return fmt.Errorf("Failed to read response body, err = %v", err)
-		}
-
-		return fmt.Errorf("HTTP error = %d, message = %s", resp.StatusCode, string(b))
+		return newHTTPError(resp, nil, "")
 	}
 
 	return nil
@@ -1182,7 +1897,7 @@ func GetLocalBucketNames(proxyurl string) (*dfc.BucketNames, error) {
 	}
 
 	if resp.StatusCode >= http.StatusBadRequest {
-		return nil, fmt.Errorf("HTTP error = %d, message = %s", resp.StatusCode, string(b))
+		return nil, newHTTPError(resp, b, "")
 	}
 
 	var buckets dfc.BucketNames
@@ -0,0 +1,388 @@
+// Package client provides common operations for files in cloud storage
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package client
+
+// Client-side (end-to-end) encryption of objects.
+// An application encrypts an object before PUT and decrypts it after GET,
+// so DFC and the cloud store only ciphertext. Envelope encryption is used:
+// every object is encrypted with a random data key, and the data key is
+// encrypted with a user key. User keys never leave the application.
+//
+// DFC does not keep user metadata, so an encrypted object is self-describing:
+// it starts with a header that identifies the scheme and contains the user key
+// ID and the encrypted data key. The header is: magic "DFCE", scheme version
+// (1 byte), key ID length (1 byte), key ID, encrypted data key length (1 byte),
+// and encrypted data key. The header is followed by the data split into
+// segments of 64KiB. Every segment is encrypted with AES-256-GCM separately;
+// the segment number is the nonce, and the last segment is marked to detect
+// truncation.
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+const (
+	// EncryptionMagic starts every object encrypted on the client side
+	EncryptionMagic = "DFCE"
+	// EncryptionAESGCM is the scheme version: AES-256-GCM, 64KiB segments
+	EncryptionAESGCM = 1
+
+	encDataKeyLen  = 32
+	encSegmentSize = 64 * 1024
+	encTagSize     = 16
+	encNonceSize   = 12
+	encMaxKeyIDLen = 255
+)
+
+type (
+	// KeyProvider returns a user key by its ID. It is called by decrypting
+	// writer to decrypt the data key of an object
+	KeyProvider func(keyID string) ([]byte, error)
+
+	// encryptStream is a reader that encrypts data read from the source
+	encryptStream struct {
+		src   *bufio.Reader
+		aead  cipher.AEAD
+		out   []byte // encrypted data ready to be read
+		buf   []byte // buffer for encrypted segment
+		plain []byte
+		seg   uint64
+		done  bool
+	}
+
+	// encryptedReader is a client.Reader that encrypts another client.Reader.
+	// Every Open encrypts the data with the same data key, so retries (e.g,
+	// after redirect) send exactly the same ciphertext
+	encryptedReader struct {
+		io.Reader
+		src    Reader
+		header []byte
+		key    []byte
+		xxHash string
+	}
+
+	// DecryptWriter decrypts data encrypted by EncryptReader and writes
+	// the result to the destination writer. Close must be called after the
+	// last write: it verifies that the object is complete
+	DecryptWriter struct {
+		w    io.Writer
+		keys KeyProvider
+		aead cipher.AEAD // nil until the header is parsed
+		buf  []byte
+		seg  uint64
+		err  error
+	}
+)
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func segmentNonce(seg uint64) []byte {
+	nonce := make([]byte, encNonceSize)
+	binary.BigEndian.PutUint64(nonce[encNonceSize-8:], seg)
+	return nonce
+}
+
+func segmentAAD(last bool) []byte {
+	if last {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+// Generates a new data key and the object header with the data key encrypted
+// with the user key. The key ID is authenticated along with the data key
+func newEncryptionHeader(keyID string, userKey []byte) (header, dataKey []byte, err error) {
+	if len(keyID) > encMaxKeyIDLen {
+		return nil, nil, fmt.Errorf("key ID is too long: %d (max %d)", len(keyID), encMaxKeyIDLen)
+	}
+	kek, err := newGCM(userKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid user key: %v", err)
+	}
+	dataKey = make([]byte, encDataKeyLen)
+	nonce := make([]byte, kek.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, dataKey); err != nil {
+		return nil, nil, err
+	}
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, nil, err
+	}
+	wrapped := kek.Seal(nonce, nonce, dataKey, []byte(keyID))
+
+	buf := bytes.NewBufferString(EncryptionMagic)
+	buf.WriteByte(EncryptionAESGCM)
+	buf.WriteByte(byte(len(keyID)))
+	buf.WriteString(keyID)
+	buf.WriteByte(byte(len(wrapped)))
+	buf.Write(wrapped)
+	return buf.Bytes(), dataKey, nil
+}
+
+// Parses the object header. Returns the header length, or 0 if more data
+// is needed to parse the header
+func parseEncryptionHeader(b []byte, keys KeyProvider) (int, cipher.AEAD, error) {
+	fixed := len(EncryptionMagic) + 2
+	if len(b) < fixed {
+		return 0, nil, nil
+	}
+	if string(b[:len(EncryptionMagic)]) != EncryptionMagic {
+		return 0, nil, errors.New("object is not encrypted on the client side")
+	}
+	if b[len(EncryptionMagic)] != EncryptionAESGCM {
+		return 0, nil, fmt.Errorf("unsupported encryption scheme %d", b[len(EncryptionMagic)])
+	}
+	idLen := int(b[fixed-1])
+	if len(b) < fixed+idLen+1 {
+		return 0, nil, nil
+	}
+	keyID := string(b[fixed : fixed+idLen])
+	wrappedLen := int(b[fixed+idLen])
+	headerLen := fixed + idLen + 1 + wrappedLen
+	if len(b) < headerLen {
+		return 0, nil, nil
+	}
+	wrapped := b[fixed+idLen+1 : headerLen]
+
+	userKey, err := keys(keyID)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to get key %q: %v", keyID, err)
+	}
+	kek, err := newGCM(userKey)
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid key %q: %v", keyID, err)
+	}
+	if len(wrapped) < kek.NonceSize() {
+		return 0, nil, errors.New("invalid encrypted data key")
+	}
+	dataKey, err := kek.Open(nil, wrapped[:kek.NonceSize()], wrapped[kek.NonceSize():], []byte(keyID))
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to decrypt data key with key %q: %v", keyID, err)
+	}
+	aead, err := newGCM(dataKey)
+	return headerLen, aead, err
+}
+
+func newEncryptStream(src io.Reader, header, dataKey []byte) (*encryptStream, error) {
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return &encryptStream{
+		src:   bufio.NewReaderSize(src, encSegmentSize),
+		aead:  aead,
+		out:   header,
+		buf:   make([]byte, 0, encSegmentSize+encTagSize),
+		plain: make([]byte, encSegmentSize),
+	}, nil
+}
+
+// Reads and encrypts the next segment. A segment is the last one if
+// the source has no more data after it
+func (e *encryptStream) nextSegment() error {
+	n, err := io.ReadFull(e.src, e.plain)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	last := err != nil
+	if !last {
+		if _, err = e.src.Peek(1); err == io.EOF {
+			last = true
+		} else if err != nil {
+			return err
+		}
+	}
+	e.out = e.aead.Seal(e.buf[:0], segmentNonce(e.seg), e.plain[:n], segmentAAD(last))
+	e.seg++
+	e.done = last
+	return nil
+}
+
+func (e *encryptStream) Read(p []byte) (int, error) {
+	if len(e.out) == 0 {
+		if e.done {
+			return 0, io.EOF
+		}
+		if err := e.nextSegment(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, e.out)
+	e.out = e.out[n:]
+	return n, nil
+}
+
+// EncryptReader returns a reader that encrypts data read from src with
+// a new data key; the data key is encrypted with the user key identified
+// by keyID. The user key must be 16, 24, or 32 bytes long
+func EncryptReader(src io.Reader, keyID string, userKey []byte) (io.Reader, error) {
+	header, dataKey, err := newEncryptionHeader(keyID, userKey)
+	if err != nil {
+		return nil, err
+	}
+	return newEncryptStream(src, header, dataKey)
+}
+
+// NewEncryptedReader wraps a client reader to PUT the object encrypted. If the
+// source reader has a checksum, the checksum of the ciphertext is calculated,
+// so DFC can validate the received data
+func NewEncryptedReader(src Reader, keyID string, userKey []byte) (Reader, error) {
+	header, dataKey, err := newEncryptionHeader(keyID, userKey)
+	if err != nil {
+		return nil, err
+	}
+	r := &encryptedReader{src: src, header: header, key: dataKey}
+	if src.XXHash() != "" {
+		stream, err := r.open()
+		if err != nil {
+			return nil, err
+		}
+		_, r.xxHash, err = ReadWriteWithHash(stream, ioutil.Discard)
+		stream.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err = r.reset(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+type encryptedStreamCloser struct {
+	io.Reader
+	io.Closer
+}
+
+func (r *encryptedReader) open() (io.ReadCloser, error) {
+	src, err := r.src.Open()
+	if err != nil {
+		return nil, err
+	}
+	stream, err := newEncryptStream(src, r.header, r.key)
+	if err != nil {
+		src.Close()
+		return nil, err
+	}
+	return &encryptedStreamCloser{stream, src}, nil
+}
+
+func (r *encryptedReader) reset() error {
+	if _, err := r.src.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	stream, err := newEncryptStream(r.src, r.header, r.key)
+	if err != nil {
+		return err
+	}
+	r.Reader = stream
+	return nil
+}
+
+// Open implements the client.Reader interface
+func (r *encryptedReader) Open() (io.ReadCloser, error) {
+	return r.open()
+}
+
+// Close implements the client.Reader interface
+func (r *encryptedReader) Close() error {
+	return r.src.Close()
+}
+
+// Seek implements the client.Reader interface. Encrypted data can be read
+// only sequentially, so only seeking to the beginning is supported
+func (r *encryptedReader) Seek(offset int64, whence int) (int64, error) {
+	if offset != 0 || whence != io.SeekStart {
+		return 0, errors.New("encrypted reader supports seeking to the beginning only")
+	}
+	return 0, r.reset()
+}
+
+// XXHash implements the client.Reader interface
+func (r *encryptedReader) XXHash() string {
+	return r.xxHash
+}
+
+// Description implements the client.Reader interface
+func (r *encryptedReader) Description() string {
+	return "encrypted " + r.src.Description()
+}
+
+// NewDecryptWriter returns a writer that decrypts objects encrypted by
+// EncryptReader or NewEncryptedReader and writes plaintext to w.
+// It can be passed to GET functions of the client as a destination writer
+func NewDecryptWriter(w io.Writer, keys KeyProvider) *DecryptWriter {
+	return &DecryptWriter{w: w, keys: keys}
+}
+
+// Decrypts and writes a segment
+func (d *DecryptWriter) writeSegment(sealed []byte, last bool) error {
+	plain, err := d.aead.Open(sealed[:0], segmentNonce(d.seg), sealed, segmentAAD(last))
+	if err != nil {
+		return fmt.Errorf("segment %d authentication failed: %v", d.seg, err)
+	}
+	d.seg++
+	_, err = d.w.Write(plain)
+	return err
+}
+
+// Write implements io.Writer. A segment is decrypted when the data of
+// the next one arrives: the last segment is decrypted by Close
+func (d *DecryptWriter) Write(p []byte) (int, error) {
+	if d.err != nil {
+		return 0, d.err
+	}
+	d.buf = append(d.buf, p...)
+	if d.aead == nil {
+		var headerLen int
+		if headerLen, d.aead, d.err = parseEncryptionHeader(d.buf, d.keys); d.err != nil {
+			return 0, d.err
+		}
+		if headerLen == 0 {
+			return len(p), nil
+		}
+		d.buf = d.buf[:copy(d.buf, d.buf[headerLen:])]
+	}
+	sealedLen := encSegmentSize + encTagSize
+	for len(d.buf) > sealedLen {
+		if d.err = d.writeSegment(d.buf[:sealedLen], false); d.err != nil {
+			return 0, d.err
+		}
+		d.buf = d.buf[:copy(d.buf, d.buf[sealedLen:])]
+	}
+	return len(p), nil
+}
+
+// Close decrypts the last segment. It does not close the underlying writer
+func (d *DecryptWriter) Close() error {
+	if d.err != nil {
+		return d.err
+	}
+	if d.aead == nil || len(d.buf) < encTagSize {
+		d.err = io.ErrUnexpectedEOF
+		return d.err
+	}
+	d.err = d.writeSegment(d.buf, true)
+	if d.err == nil {
+		d.err = errors.New("writer is closed")
+		return nil
+	}
+	return d.err
+}
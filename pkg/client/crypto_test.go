@@ -0,0 +1,106 @@
+package client_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/NVIDIA/dfcpub/pkg/client"
+	"github.com/NVIDIA/dfcpub/pkg/client/readers"
+)
+
+func TestClientEncryption(t *testing.T) {
+	keys := map[string][]byte{
+		"key1": []byte("0123456789abcdef0123456789abcdef"),
+		"key2": []byte("fedcba9876543210fedcba9876543210"),
+	}
+	provider := func(keyID string) ([]byte, error) {
+		if key, ok := keys[keyID]; ok {
+			return key, nil
+		}
+		return nil, fmt.Errorf("unknown key %s", keyID)
+	}
+
+	for _, size := range []int{0, 1, 64*1024 - 1, 64 * 1024, 64*1024 + 1, 200 * 1024} {
+		data := make([]byte, size)
+		rand.Read(data)
+		r, err := client.EncryptReader(bytes.NewReader(data), "key1", keys["key1"])
+		if err != nil {
+			t.Fatal(err)
+		}
+		encrypted := &bytes.Buffer{}
+		if _, err = io.Copy(encrypted, r); err != nil {
+			t.Fatalf("Size %d: failed to encrypt: %v", size, err)
+		}
+		// short data may appear in ciphertext by chance
+		if size >= 16 && bytes.Contains(encrypted.Bytes(), data) {
+			t.Errorf("Size %d: encrypted data contains plaintext", size)
+		}
+
+		// write decrypted data in small pieces to split the header and segments
+		decrypted := &bytes.Buffer{}
+		w := client.NewDecryptWriter(decrypted, provider)
+		for chunk := encrypted.Bytes(); len(chunk) > 0; {
+			n := 777
+			if n > len(chunk) {
+				n = len(chunk)
+			}
+			if _, err = w.Write(chunk[:n]); err != nil {
+				t.Fatalf("Size %d: failed to decrypt: %v", size, err)
+			}
+			chunk = chunk[n:]
+		}
+		if err = w.Close(); err != nil {
+			t.Fatalf("Size %d: failed to decrypt: %v", size, err)
+		}
+		if !bytes.Equal(decrypted.Bytes(), data) {
+			t.Errorf("Size %d: decrypted data differs", size)
+		}
+	}
+
+	data := make([]byte, 150*1024)
+	rand.Read(data)
+	r, _ := client.EncryptReader(bytes.NewReader(data), "key2", keys["key2"])
+	encrypted := &bytes.Buffer{}
+	io.Copy(encrypted, r)
+
+	// truncated object
+	w := client.NewDecryptWriter(&bytes.Buffer{}, provider)
+	w.Write(encrypted.Bytes()[:encrypted.Len()-100])
+	if err := w.Close(); err == nil {
+		t.Error("Decrypting truncated object must fail")
+	}
+
+	// unknown key
+	w = client.NewDecryptWriter(&bytes.Buffer{}, func(string) ([]byte, error) {
+		return keys["key1"], nil
+	})
+	if _, err := w.Write(encrypted.Bytes()); err == nil {
+		t.Error("Decrypting with wrong key must fail")
+	}
+
+	// plaintext object
+	w = client.NewDecryptWriter(&bytes.Buffer{}, provider)
+	if _, err := w.Write(data); err == nil {
+		t.Error("Decrypting plaintext must fail")
+	}
+}
+
+func TestPutEncrypted(t *testing.T) {
+	src, err := readers.NewRandReader(100*1024, true /* withHash */)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := client.NewEncryptedReader(src, "key1", []byte("0123456789abcdef"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.XXHash() == "" || r.XXHash() == src.XXHash() {
+		t.Errorf("Invalid checksum of encrypted data: %q", r.XXHash())
+	}
+	if err = client.Put(server.URL, r, "bucket", "key", true /* silent */); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,173 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+
+package client
+
+// Direct-to-target mode.
+// DirectClient caches the cluster map (Smap) and locates objects with the
+// same HRW function the proxy uses, so that GET and PUT requests go straight
+// to the owning target without the proxy redirect round trip. Every direct
+// request carries the version of the cached Smap; a target with a different
+// version rejects the request with 421 (Misdirected Request). In this case, as
+// well as when the target cannot be reached, the client reloads the Smap and
+// repeats the request via the proxy.
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+
+	"github.com/NVIDIA/dfcpub/dfc"
+)
+
+// DirectClient sends object requests directly to targets. It is safe for
+// concurrent use
+type DirectClient struct {
+	proxyURL string
+	mtx      sync.RWMutex
+	smap     *dfc.Smap
+}
+
+// NewDirectClient returns a client that reads and writes objects directly
+// to/from targets of the cluster the proxy belongs to
+func NewDirectClient(proxyURL string) (*DirectClient, error) {
+	c := &DirectClient{proxyURL: proxyURL}
+	if err := c.RefreshSmap(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// RefreshSmap reloads the cluster map from the proxy
+func (c *DirectClient) RefreshSmap() error {
+	smap, err := GetClusterMap(c.proxyURL)
+	if err != nil {
+		return err
+	}
+	c.mtx.Lock()
+	c.smap = &smap
+	c.mtx.Unlock()
+	return nil
+}
+
+// SmapVersion returns the version of the cached cluster map
+func (c *DirectClient) SmapVersion() int64 {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	return c.smap.Version
+}
+
+// TargetURL returns the URL of the target that owns the object as per the
+// cached cluster map. pgroup is the placement group of the object, if any
+func (c *DirectClient) TargetURL(bucket, key, pgroup string) (string, error) {
+	targetURL, _, err := c.locate(bucket, key, pgroup)
+	return targetURL, err
+}
+
+// Returns the owning target of the object and the query of a direct request
+func (c *DirectClient) locate(bucket, key, pgroup string) (string, url.Values, error) {
+	c.mtx.RLock()
+	smap := c.smap
+	c.mtx.RUnlock()
+
+	// objects of a placement group are placed by the group name
+	name := key
+	if pgroup != "" {
+		name = pgroup
+	}
+	si, errstr := dfc.HrwTarget(bucket, name, smap)
+	if errstr != "" {
+		return "", nil, errors.New(errstr)
+	}
+	query := groupQuery(pgroup)
+	query.Set(dfc.URLParamSmapVersion, strconv.FormatInt(smap.Version, 10))
+	// targets accept PUT requests that come from a known proxy
+	if smap.ProxySI != nil {
+		query.Set(dfc.URLParamDaemonID, smap.ProxySI.DaemonID)
+	}
+	return si.DirectURL, query, nil
+}
+
+// Returns true if a direct request has to be repeated via the proxy: the
+// target is unreachable or the cached cluster map is stale. Refreshes the map
+func (c *DirectClient) fallback(resp *http.Response, err error) bool {
+	if err == nil && resp.StatusCode != http.StatusMisdirectedRequest {
+		return false
+	}
+	if resp != nil {
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+	}
+	// the request goes via the proxy anyway; the map is reloaded next time
+	c.RefreshSmap()
+	return true
+}
+
+// Get reads an object directly from its target and writes it to w
+func (c *DirectClient) Get(bucket, key, pgroup string, w io.Writer) (int64, error) {
+	targetURL, query, err := c.locate(bucket, key, pgroup)
+	if err != nil {
+		return 0, err
+	}
+	path := dfc.URLEscapedPath(dfc.Rversion, dfc.Robjects, bucket, key)
+	resp, err := client.Get(targetURL + path + "?" + query.Encode())
+	if c.fallback(resp, err) {
+		resp, err = client.Get(c.proxyURL + path + "?" + groupQuery(pgroup).Encode())
+	}
+	defer func() {
+		if resp != nil {
+			resp.Body.Close()
+		}
+	}()
+
+	n, _, err := readResponse(resp, w, err, fmt.Sprintf("GET (object %s from bucket %s)", key, bucket), false)
+	return n, err
+}
+
+// Put writes an object directly to its target
+func (c *DirectClient) Put(reader Reader, bucket, key, pgroup string) error {
+	targetURL, query, err := c.locate(bucket, key, pgroup)
+	if err != nil {
+		return err
+	}
+	handle, err := reader.Open()
+	if err != nil {
+		return fmt.Errorf("Failed to open reader, err: %v", err)
+	}
+	req, err := http.NewRequest(http.MethodPut, targetURL+dfc.URLEscapedPath(dfc.Rversion, dfc.Robjects, bucket, key), handle)
+	if err != nil {
+		handle.Close()
+		return fmt.Errorf("Failed to create new http request, err: %v", err)
+	}
+	req.URL.RawQuery = query.Encode()
+	if reader.XXHash() != "" {
+		req.Header.Set(dfc.HeaderDfcChecksumType, dfc.ChecksumXXHash)
+		req.Header.Set(dfc.HeaderDfcChecksumVal, reader.XXHash())
+	}
+
+	resp, err := client.Do(req)
+	if c.fallback(resp, err) {
+		return put(c.proxyURL, reader, bucket, key, true /* silent */, nil, groupQuery(pgroup))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return newHTTPError(resp, nil, "")
+	}
+	return nil
+}
+
+func groupQuery(pgroup string) url.Values {
+	query := url.Values{}
+	if pgroup != "" {
+		query.Set(dfc.URLParamPlacementGroup, pgroup)
+	}
+	return query
+}
@@ -0,0 +1,115 @@
+package client_test
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"github.com/NVIDIA/dfcpub/dfc"
+	"github.com/NVIDIA/dfcpub/pkg/client"
+)
+
+// A fake cluster of one proxy and one target: the target serves requests with
+// the current Smap version only, the proxy serves the rest
+type fakeCluster struct {
+	proxy, target *httptest.Server
+	version       int64
+	proxyHits     int64
+	targetHits    int64
+}
+
+func newFakeCluster() *fakeCluster {
+	c := &fakeCluster{version: 1}
+	c.target = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&c.targetHits, 1)
+		version := strconv.FormatInt(atomic.LoadInt64(&c.version), 10)
+		if r.URL.Query().Get(dfc.URLParamSmapVersion) != version {
+			w.WriteHeader(http.StatusMisdirectedRequest)
+			return
+		}
+		w.Write([]byte("target"))
+	}))
+	c.proxy = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == dfc.URLPath(dfc.Rversion, dfc.Rdaemon) {
+			fmt.Fprintf(w, `{"tmap": {"t1": {"daemon_id": "t1", "direct_url": %q}}, "pmap": {}, "version": %d}`,
+				c.target.URL, atomic.LoadInt64(&c.version))
+			return
+		}
+		atomic.AddInt64(&c.proxyHits, 1)
+		w.Write([]byte("proxy"))
+	}))
+	return c
+}
+
+func (c *fakeCluster) close() {
+	c.proxy.Close()
+	c.target.Close()
+}
+
+func TestDirectClientGet(t *testing.T) {
+	cluster := newFakeCluster()
+	defer cluster.close()
+
+	dc, err := client.NewDirectClient(cluster.proxy.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	targetURL, err := dc.TargetURL("bucket", "key", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if targetURL != cluster.target.URL {
+		t.Fatalf("Expected target %s, got %s", cluster.target.URL, targetURL)
+	}
+
+	get := func(expected string) {
+		buf := &bytes.Buffer{}
+		if _, err := dc.Get("bucket", "key", "", buf); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != expected {
+			t.Fatalf("Expected the object from %s, got it from %s", expected, buf.String())
+		}
+	}
+
+	// the Smap is up to date: the target serves the request
+	get("target")
+	if atomic.LoadInt64(&cluster.proxyHits) != 0 {
+		t.Errorf("Direct GET has gone through the proxy")
+	}
+
+	// the Smap changes: the request falls back to the proxy, and the client
+	// reloads the Smap
+	atomic.StoreInt64(&cluster.version, 2)
+	get("proxy")
+	if dc.SmapVersion() != 2 {
+		t.Errorf("Expected Smap version 2, got %d", dc.SmapVersion())
+	}
+	get("target")
+	if hits := atomic.LoadInt64(&cluster.proxyHits); hits != 1 {
+		t.Errorf("Expected 1 request via the proxy, got %d", hits)
+	}
+}
+
+func TestDirectClientUnreachableTarget(t *testing.T) {
+	cluster := newFakeCluster()
+	defer cluster.proxy.Close()
+
+	dc, err := client.NewDirectClient(cluster.proxy.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cluster.target.Close()
+
+	buf := &bytes.Buffer{}
+	if _, err := dc.Get("bucket", "key", "", buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "proxy" {
+		t.Fatalf("Expected the object from the proxy, got it from %s", buf.String())
+	}
+}
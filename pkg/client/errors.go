@@ -0,0 +1,85 @@
+// Package client provides common operations for files in cloud storage
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package client
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/NVIDIA/dfcpub/dfc"
+)
+
+// HTTPError is a failed request to a DFC proxy, target or AuthN server decoded
+// from the JSON error envelope (see dfc.Error). If the response is not an
+// envelope (e.g., it was sent by an older server), Message is the response body
+type HTTPError struct {
+	Op         string // the failed operation
+	Status     int
+	Code       string // dfc.ErrCode*, empty if the response is not an envelope
+	Message    string
+	Provider   string
+	Detail     string
+	Bucket     string
+	Object     string
+	RequestID  string
+	Retryable  bool
+	RetryAfter time.Duration
+}
+
+func (e *HTTPError) Error() string {
+	s := fmt.Sprintf("http status %d", e.Status)
+	if e.Op != "" {
+		s = e.Op + ": " + s
+	}
+	if e.Message != "" {
+		s += ", " + e.Message
+	}
+	return s
+}
+
+// IsNotFound returns true if err is an HTTPError with status 404
+func IsNotFound(err error) bool {
+	e, ok := err.(*HTTPError)
+	return ok && e.Status == http.StatusNotFound
+}
+
+// IsPreconditionFailed returns true if err is an HTTPError with status 412:
+// e.g., a conditional DELETE of an object that was overwritten
+func IsPreconditionFailed(err error) bool {
+	e, ok := err.(*HTTPError)
+	return ok && e.Status == http.StatusPreconditionFailed
+}
+
+// IsRetryable returns true if err is an HTTPError the server marked as transient
+func IsRetryable(err error) bool {
+	e, ok := err.(*HTTPError)
+	return ok && e.Retryable
+}
+
+// newHTTPError decodes the error response; reads the body if it is nil
+func newHTTPError(resp *http.Response, body []byte, op string) *HTTPError {
+	if body == nil {
+		body, _ = ioutil.ReadAll(resp.Body)
+	}
+	herr := &HTTPError{Op: op, Status: resp.StatusCode, RequestID: resp.Header.Get(dfc.HeaderRequestID)}
+	e := dfc.ErrorFromJSON(body)
+	if e == nil {
+		herr.Message = strings.TrimSpace(string(body))
+		return herr
+	}
+	herr.Code, herr.Message = e.Code, e.Message
+	herr.Provider, herr.Detail = e.Provider, e.Detail
+	herr.Bucket, herr.Object = e.Bucket, e.Object
+	herr.Retryable = e.Retryable
+	herr.RetryAfter = time.Duration(e.RetryAfter) * time.Second
+	if e.RequestID != "" {
+		herr.RequestID = e.RequestID
+	}
+	return herr
+}
@@ -0,0 +1,47 @@
+package client_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/NVIDIA/dfcpub/dfc"
+	"github.com/NVIDIA/dfcpub/pkg/client"
+)
+
+func TestHTTPError(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		dfc.WriteError(w, r, dfc.NewError(http.StatusServiceUnavailable, "busy"))
+	}))
+	defer s.Close()
+	// a server that does not send the error envelope
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "plain text error", http.StatusInternalServerError)
+	}))
+	defer plain.Close()
+
+	_, err := client.GetClusterMap(s.URL)
+	herr, ok := err.(*client.HTTPError)
+	if !ok {
+		t.Fatalf("Expected HTTPError, got %T: %v", err, err)
+	}
+	if herr.Status != http.StatusServiceUnavailable || herr.Code != dfc.ErrCodeUnavailable || herr.Message != "busy" {
+		t.Errorf("Unexpected error %+v", herr)
+	}
+	if !client.IsRetryable(err) || herr.RetryAfter != time.Second || herr.RequestID == "" {
+		t.Errorf("Expected retryable error with retry-after and request ID, got %+v", herr)
+	}
+
+	_, err = client.GetClusterMap(plain.URL)
+	herr, ok = err.(*client.HTTPError)
+	if !ok {
+		t.Fatalf("Expected HTTPError, got %T: %v", err, err)
+	}
+	if herr.Status != http.StatusInternalServerError || herr.Code != "" || herr.Message != "plain text error" {
+		t.Errorf("Unexpected error %+v", herr)
+	}
+	if client.IsRetryable(err) || client.IsNotFound(err) {
+		t.Errorf("Unexpected error classification: %+v", herr)
+	}
+}
@@ -0,0 +1,405 @@
+// Package workload runs scenario-driven PUT/GET/DELETE workloads against a DFC cluster
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package workload
+
+// A scenario defines a fixed set of object names (keys), relative weights of
+// operations, number of concurrent workers and think time between operations.
+// Each key is owned by at most one worker at a time, so that operations on the
+// same object never overlap; GET and DELETE pick only the keys that have been
+// PUT before. The keys are passed between the workers over two channels - keys
+// that exist in the cluster and keys that do not - which makes the workers
+// block instead of polling when all keys are busy; the run stops when the
+// context is done or the scenario's number of operations is reached.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/NVIDIA/dfcpub/dfc"
+	"github.com/NVIDIA/dfcpub/pkg/client"
+	"github.com/NVIDIA/dfcpub/pkg/client/readers"
+)
+
+// Op is a kind of workload operation
+type Op int
+
+// Workload operations
+const (
+	OpPut Op = iota
+	OpGet
+	OpDel
+	numOps
+)
+
+const keyLen = 20 // length of randomly generated object names
+
+func (op Op) String() string {
+	switch op {
+	case OpPut:
+		return "PUT"
+	case OpGet:
+		return "GET"
+	case OpDel:
+		return "DEL"
+	default:
+		return fmt.Sprintf("op-%d", int(op))
+	}
+}
+
+// Scenario describes a workload
+type Scenario struct {
+	ProxyURL string
+	Bucket   string
+	Prefix   string   // prefix of object names, e.g. "rwstress/"
+	NumKeys  int      // number of distinct objects the workload creates
+	Existing []string // names of the objects already in the bucket the workload operates on as well
+	Ratio    map[Op]int
+	Workers  int           // number of concurrent operations
+	MaxOps   int64         // number of operations per run, 0 - run until the context is done
+	Think    time.Duration // time a worker pauses between operations
+	ObjSize  int64
+	Sizes    func(rnd *rand.Rand) int64 // if set, returns the size of each PUT instead of ObjSize
+	Reader   string                     // readers.ReaderType*, readers.ReaderTypeRand by default
+	TmpDir   string                     // directory for readers.ReaderTypeFile
+	Validate bool                       // validate checksums of the objects GET returns
+	Seed     int64
+
+	// HRW-aware key selection: when Smap is set, the keys are spread evenly
+	// across Targets (across all targets of Smap if Targets is empty)
+	Smap    *dfc.Smap
+	Targets []string
+
+	// OnOp, if set, is called after each operation
+	OnOp func(res *Result)
+}
+
+// Result describes a performed operation
+type Result struct {
+	Op        Op
+	Key       string
+	Size      int64 // number of bytes transferred
+	Latency   time.Duration
+	Latencies client.HTTPLatencies // breakdown of the latency of GET
+	Err       error
+}
+
+// Stats holds the numbers of performed and failed operations
+type Stats struct {
+	Ops    map[Op]int64
+	Errors map[Op]int64
+}
+
+// Engine runs a scenario. The engine keeps track of the objects it has
+// created, so Run can be called multiple times, followed by Cleanup
+type Engine struct {
+	sc      Scenario
+	keys    []string
+	absent  chan int // indices of the keys that do not exist in the cluster
+	present chan int // indices of the keys that exist
+	weights int
+	issued  int64
+	ops     [numOps]int64
+	errs    [numOps]int64
+	pending [numOps]int64
+	// performs an operation, size is the size of the object to PUT
+	exec func(op Op, idx int, size int64) *Result
+}
+
+// New validates the scenario and generates object names
+func New(sc Scenario) (*Engine, error) {
+	if sc.NumKeys < 0 || sc.NumKeys+len(sc.Existing) == 0 {
+		return nil, fmt.Errorf("Invalid number of keys %d", sc.NumKeys)
+	}
+	if sc.Workers <= 0 {
+		return nil, fmt.Errorf("Invalid number of workers %d", sc.Workers)
+	}
+	if sc.Reader == "" {
+		sc.Reader = readers.ReaderTypeRand
+	}
+	e := &Engine{
+		sc:      sc,
+		absent:  make(chan int, sc.NumKeys+len(sc.Existing)),
+		present: make(chan int, sc.NumKeys+len(sc.Existing)),
+	}
+	for op, w := range sc.Ratio {
+		if op < 0 || op >= numOps || w < 0 {
+			return nil, fmt.Errorf("Invalid weight %d of operation %s", w, op)
+		}
+		e.weights += w
+	}
+	if e.weights == 0 {
+		return nil, errors.New("The scenario has no operations")
+	}
+
+	rnd := rand.New(rand.NewSource(sc.Seed))
+	var err error
+	if sc.Smap != nil {
+		e.keys, err = hrwKeys(rnd, &sc)
+	} else {
+		e.keys = make([]string, sc.NumKeys)
+		for i := range e.keys {
+			e.keys[i] = sc.Prefix + client.FastRandomFilename(rnd, keyLen)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	for i := range e.keys {
+		e.absent <- i
+	}
+	for _, key := range sc.Existing {
+		e.present <- len(e.keys)
+		e.keys = append(e.keys, key)
+	}
+	e.exec = e.do
+	return e, nil
+}
+
+// Generates the keys so that each target gets the same number of them
+func hrwKeys(rnd *rand.Rand, sc *Scenario) ([]string, error) {
+	targets := sc.Targets
+	if len(targets) == 0 {
+		for id := range sc.Smap.Tmap {
+			targets = append(targets, id)
+		}
+	}
+	quota := make(map[string]int, len(targets))
+	for i, id := range targets {
+		if _, ok := sc.Smap.Tmap[id]; !ok {
+			return nil, fmt.Errorf("Target %s is not in the cluster map", id)
+		}
+		quota[id] = sc.NumKeys / len(targets)
+		if i < sc.NumKeys%len(targets) {
+			quota[id]++
+		}
+	}
+
+	keys := make([]string, 0, sc.NumKeys)
+	for len(keys) < sc.NumKeys {
+		key := sc.Prefix + client.FastRandomFilename(rnd, keyLen)
+		si, errstr := dfc.HrwTarget(sc.Bucket, key, sc.Smap)
+		if errstr != "" {
+			return nil, errors.New(errstr)
+		}
+		if quota[si.DaemonID] > 0 {
+			quota[si.DaemonID]--
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// Keys returns the names of the objects the engine operates on, including
+// the existing ones
+func (e *Engine) Keys() []string {
+	return e.keys
+}
+
+// Stats returns the numbers of operations performed so far
+func (e *Engine) Stats() Stats {
+	s := Stats{Ops: make(map[Op]int64), Errors: make(map[Op]int64)}
+	for op := Op(0); op < numOps; op++ {
+		s.Ops[op] = atomic.LoadInt64(&e.ops[op])
+		s.Errors[op] = atomic.LoadInt64(&e.errs[op])
+	}
+	return s
+}
+
+// Pending returns the number of operations of the kind in progress
+func (e *Engine) Pending(op Op) int64 {
+	return atomic.LoadInt64(&e.pending[op])
+}
+
+// Run runs the workload until the context is done or the scenario's number
+// of operations is performed. Returns the context error if the run was cut short
+func (e *Engine) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	atomic.StoreInt64(&e.issued, 0)
+	for i := 0; i < e.sc.Workers; i++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			e.worker(ctx, rand.New(rand.NewSource(seed)))
+		}(e.sc.Seed + int64(i) + 1)
+	}
+	wg.Wait()
+	if e.sc.MaxOps > 0 && atomic.LoadInt64(&e.issued) >= e.sc.MaxOps {
+		return nil
+	}
+	return ctx.Err()
+}
+
+// Cleanup deletes all objects the workload has created
+func (e *Engine) Cleanup(ctx context.Context) error {
+	var (
+		firstErr error
+		failed   []int
+	)
+	defer func() {
+		for _, idx := range failed {
+			e.present <- idx
+		}
+	}()
+	for {
+		var idx int
+		select {
+		case idx = <-e.present:
+		default:
+			return firstErr
+		}
+		if err := ctx.Err(); err != nil {
+			e.present <- idx
+			return err
+		}
+		if res := e.exec(OpDel, idx, 0); res.Err != nil {
+			failed = append(failed, idx)
+			if firstErr == nil {
+				firstErr = res.Err
+			}
+			continue
+		}
+		e.absent <- idx
+	}
+}
+
+func (e *Engine) worker(ctx context.Context, rnd *rand.Rand) {
+	for ctx.Err() == nil {
+		if e.sc.MaxOps > 0 && atomic.AddInt64(&e.issued, 1) > e.sc.MaxOps {
+			return
+		}
+		idx, op, exists, ok := e.acquire(ctx, e.pickOp(rnd))
+		if !ok {
+			return
+		}
+
+		size := e.sc.ObjSize
+		if op == OpPut && e.sc.Sizes != nil {
+			size = e.sc.Sizes(rnd)
+		}
+		atomic.AddInt64(&e.pending[op], 1)
+		started := time.Now()
+		res := e.exec(op, idx, size)
+		res.Latency = time.Since(started)
+		atomic.AddInt64(&e.pending[op], -1)
+		atomic.AddInt64(&e.ops[op], 1)
+		if res.Err != nil {
+			atomic.AddInt64(&e.errs[op], 1)
+		}
+		switch op {
+		case OpPut:
+			exists = exists || res.Err == nil
+		case OpDel:
+			exists = res.Err != nil
+		}
+		e.release(idx, exists)
+		if e.sc.OnOp != nil {
+			e.sc.OnOp(res)
+		}
+
+		if e.sc.Think > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(e.sc.Think):
+			}
+		}
+	}
+}
+
+func (e *Engine) pickOp(rnd *rand.Rand) Op {
+	n := rnd.Intn(e.weights)
+	for op := Op(0); op < numOps; op++ {
+		if n < e.sc.Ratio[op] {
+			return op
+		}
+		n -= e.sc.Ratio[op]
+	}
+	return OpPut
+}
+
+// Takes exclusive ownership of a key suitable for the operation. GET and
+// DELETE require an existing object: if there is none available, the worker
+// either waits for one or PUTs a new object, whichever comes first
+func (e *Engine) acquire(ctx context.Context, op Op) (idx int, actual Op, exists, ok bool) {
+	if op == OpPut {
+		select {
+		case idx = <-e.absent:
+			return idx, op, false, true
+		case idx = <-e.present:
+			return idx, op, true, true
+		case <-ctx.Done():
+			return
+		}
+	}
+
+	select {
+	case idx = <-e.present:
+		return idx, op, true, true
+	default:
+	}
+	select {
+	case idx = <-e.present:
+		return idx, op, true, true
+	case idx = <-e.absent:
+		return idx, OpPut, false, true
+	case <-ctx.Done():
+		return
+	}
+}
+
+func (e *Engine) release(idx int, exists bool) {
+	if exists {
+		e.present <- idx
+	} else {
+		e.absent <- idx
+	}
+}
+
+func (e *Engine) do(op Op, idx int, size int64) *Result {
+	res := &Result{Op: op, Key: e.keys[idx]}
+	switch op {
+	case OpPut:
+		var sgl *dfc.SGLIO
+		if e.sc.Reader == readers.ReaderTypeSG {
+			sgl = dfc.NewSGLIO(uint64(size))
+			defer sgl.Free()
+		}
+		// the key is owned by one worker at a time, so is the file
+		name := strings.Replace(res.Key, "/", "_", -1)
+		r, err := readers.NewReader(readers.ParamReader{
+			Type: e.sc.Reader,
+			SGL:  sgl,
+			Path: e.sc.TmpDir,
+			Name: name,
+			Size: size,
+		})
+		if err != nil {
+			res.Err = err
+			return res
+		}
+		if e.sc.Reader == readers.ReaderTypeFile {
+			defer os.Remove(e.sc.TmpDir + "/" + name)
+		}
+		if res.Err = client.Put(e.sc.ProxyURL, r, e.sc.Bucket, res.Key, true /* silent */); res.Err == nil {
+			res.Size = size
+		}
+	case OpGet:
+		res.Size, res.Latencies, res.Err = client.Get(e.sc.ProxyURL, e.sc.Bucket, res.Key,
+			nil /* wg */, nil /* errch */, true /* silent */, e.sc.Validate)
+	case OpDel:
+		res.Err = client.Del(e.sc.ProxyURL, e.sc.Bucket, res.Key, nil /* wg */, nil /* errch */, true /* silent */)
+	default:
+		res.Err = fmt.Errorf("Invalid operation %s", op)
+	}
+	return res
+}
@@ -0,0 +1,181 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package workload
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/NVIDIA/dfcpub/dfc"
+)
+
+// An in-memory bucket that fails operations that the engine must never issue:
+// concurrent operations on the same object and GET/DELETE of a missing object
+type fakeBucket struct {
+	mtx    sync.Mutex
+	busy   map[int]bool
+	exists map[int]bool
+	errs   []string
+}
+
+func newFakeBucket(e *Engine) *fakeBucket {
+	b := &fakeBucket{busy: make(map[int]bool), exists: make(map[int]bool)}
+	e.exec = b.exec
+	return b
+}
+
+func (b *fakeBucket) exec(op Op, idx int, size int64) *Result {
+	b.mtx.Lock()
+	if b.busy[idx] {
+		b.errs = append(b.errs, fmt.Sprintf("concurrent %s of key %d", op, idx))
+	}
+	if op != OpPut && !b.exists[idx] {
+		b.errs = append(b.errs, fmt.Sprintf("%s of missing key %d", op, idx))
+	}
+	b.busy[idx] = true
+	b.mtx.Unlock()
+
+	time.Sleep(time.Millisecond)
+
+	b.mtx.Lock()
+	b.busy[idx] = false
+	b.exists[idx] = op != OpDel
+	b.mtx.Unlock()
+	return &Result{Op: op, Size: size}
+}
+
+func TestRun(t *testing.T) {
+	e, err := New(Scenario{
+		NumKeys: 10,
+		Workers: 8,
+		MaxOps:  1000,
+		Ratio:   map[Op]int{OpPut: 1, OpGet: 2, OpDel: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := newFakeBucket(e)
+
+	if err := e.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range b.errs {
+		t.Error(s)
+	}
+	stats := e.Stats()
+	total := stats.Ops[OpPut] + stats.Ops[OpGet] + stats.Ops[OpDel]
+	if total != 1000 {
+		t.Errorf("Expected 1000 operations, got %d", total)
+	}
+	if stats.Ops[OpGet] == 0 || stats.Ops[OpDel] == 0 {
+		t.Errorf("Expected all kinds of operations, got %v", stats.Ops)
+	}
+
+	if err := e.Cleanup(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for idx, exists := range b.exists {
+		if exists {
+			t.Errorf("Key %d exists after cleanup", idx)
+		}
+	}
+}
+
+func TestRunCancel(t *testing.T) {
+	e, err := New(Scenario{
+		NumKeys: 2,
+		Workers: 4,
+		Think:   time.Hour,
+		Ratio:   map[Op]int{OpGet: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	newFakeBucket(e)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	started := time.Now()
+	if err := e.Run(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Errorf("The workload did not stop in time: %v", elapsed)
+	}
+	// GET-only workload PUTs each key first
+	if n := e.Stats().Ops[OpPut]; n != 2 {
+		t.Errorf("Expected 2 PUTs, got %d", n)
+	}
+}
+
+func TestExisting(t *testing.T) {
+	e, err := New(Scenario{
+		Existing: []string{"a", "b"},
+		Workers:  2,
+		MaxOps:   100,
+		Ratio:    map[Op]int{OpGet: 1},
+		Sizes:    func(rnd *rand.Rand) int64 { return 1 },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := newFakeBucket(e)
+	b.exists[0], b.exists[1] = true, true
+
+	if err := e.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range b.errs {
+		t.Error(s)
+	}
+	// the existing objects are read without being written first
+	if stats := e.Stats(); stats.Ops[OpGet] != 100 || stats.Ops[OpPut] != 0 {
+		t.Errorf("Expected 100 GETs and no PUTs, got %v", stats.Ops)
+	}
+	if e.Pending(OpGet) != 0 {
+		t.Errorf("Expected no pending GETs, got %d", e.Pending(OpGet))
+	}
+}
+
+func TestHrwKeys(t *testing.T) {
+	var smap dfc.Smap
+	tmap := `{"tmap": {"t1": {"daemon_id": "t1"}, "t2": {"daemon_id": "t2"}, "t3": {"daemon_id": "t3"}}}`
+	if err := json.Unmarshal([]byte(tmap), &smap); err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := New(Scenario{
+		Bucket:  "bucket",
+		NumKeys: 10,
+		Workers: 1,
+		Ratio:   map[Op]int{OpPut: 1},
+		Smap:    &smap,
+		Targets: []string{"t1", "t3"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := make(map[string]int)
+	for _, key := range e.Keys() {
+		si, errstr := dfc.HrwTarget("bucket", key, &smap)
+		if errstr != "" {
+			t.Fatal(errstr)
+		}
+		counts[si.DaemonID]++
+	}
+	if counts["t1"] != 5 || counts["t3"] != 5 {
+		t.Errorf("Expected 5 keys on t1 and t3 each, got %v", counts)
+	}
+
+	_, err = New(Scenario{NumKeys: 1, Workers: 1, Ratio: map[Op]int{OpPut: 1}, Smap: &smap, Targets: []string{"t4"}})
+	if err == nil {
+		t.Error("Expected error for a target that is not in the cluster map")
+	}
+}
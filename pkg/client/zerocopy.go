@@ -0,0 +1,114 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+
+package client
+
+// Zero-copy handoff (experimental, see dfc/zerocopy.go).
+// GetZeroCopy asks the target running on the same host for the descriptor of
+// a cached object and maps the requested extent into the memory of the
+// process: the data is read straight from the page cache the target shares.
+// It works with targets built with the "zerocopy" tag only; upon an error the
+// caller is expected to fall back to a regular GET.
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"syscall"
+
+	"github.com/NVIDIA/dfcpub/dfc"
+)
+
+// ZeroCopyExtent is an extent of an object mapped read-only into memory. It
+// remains valid until Close, even if the object is modified or evicted
+type ZeroCopyExtent struct {
+	Data    []byte // the extent
+	Size    int64  // object size
+	mapping []byte
+}
+
+// GetZeroCopy maps length bytes (0 - to the end) of the object starting at
+// offset; socket is zerocopy.socket of the target that stores the object
+func GetZeroCopy(socket, bucket, objname string, offset, length int64) (*ZeroCopyExtent, error) {
+	conn, err := net.DialUnix("unixpacket", nil, &net.UnixAddr{Name: socket, Net: "unixpacket"})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	jsbytes, err := json.Marshal(&dfc.ZeroCopyRequest{Bucket: bucket, Objname: objname, Offset: offset, Length: length})
+	if err != nil {
+		return nil, err
+	}
+	if _, err = conn.Write(jsbytes); err != nil {
+		return nil, err
+	}
+	buf, oob := make([]byte, 4096), make([]byte, syscall.CmsgSpace(4))
+	n, oobn, _, _, err := conn.ReadMsgUnix(buf, oob)
+	if err != nil {
+		return nil, err
+	}
+	fd, err := receivedFd(oob[:oobn])
+	if err != nil {
+		return nil, err
+	}
+	if fd >= 0 {
+		defer syscall.Close(fd) // the mapping holds a reference to the file
+	}
+	resp := &dfc.ZeroCopyResponse{}
+	if err = json.Unmarshal(buf[:n], resp); err != nil {
+		return nil, err
+	}
+	if resp.Error != "" {
+		return nil, errors.New(resp.Error)
+	}
+	if fd < 0 {
+		return nil, errors.New("zero-copy response without a file descriptor")
+	}
+	extent := &ZeroCopyExtent{Data: []byte{}, Size: resp.Size}
+	if resp.Length == 0 {
+		return extent, nil
+	}
+	// mappings start at page boundaries
+	pgoffset := resp.Offset &^ int64(os.Getpagesize()-1)
+	extent.mapping, err = syscall.Mmap(fd, pgoffset, int(resp.Offset-pgoffset+resp.Length), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, err
+	}
+	extent.Data = extent.mapping[resp.Offset-pgoffset:]
+	return extent, nil
+}
+
+// Close unmaps the extent
+func (e *ZeroCopyExtent) Close() error {
+	if e.mapping == nil {
+		return nil
+	}
+	err := syscall.Munmap(e.mapping)
+	e.mapping, e.Data = nil, nil
+	return err
+}
+
+// receivedFd returns the descriptor passed with the message, -1 if none
+func receivedFd(oob []byte) (int, error) {
+	if len(oob) == 0 {
+		return -1, nil
+	}
+	msgs, err := syscall.ParseSocketControlMessage(oob)
+	if err != nil {
+		return -1, err
+	}
+	for _, msg := range msgs {
+		fds, err := syscall.ParseUnixRights(&msg)
+		if err != nil || len(fds) == 0 {
+			continue
+		}
+		for _, fd := range fds[1:] {
+			syscall.Close(fd)
+		}
+		return fds[0], nil
+	}
+	return -1, nil
+}
@@ -0,0 +1,446 @@
+// Package minicluster deploys a DFC cluster of local processes for integration tests
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package minicluster
+
+// A mini cluster runs each proxy and target as a separate process of the DFC
+// executable (a daemon keeps its configuration and state in globals, so two
+// daemons cannot share one process). Every daemon listens on a random free
+// port and keeps its configuration, logs and mountpaths in a temporary
+// directory that is removed when the cluster stops.
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"text/template"
+	"time"
+
+	"github.com/NVIDIA/dfcpub/dfc"
+	"github.com/NVIDIA/dfcpub/pkg/client"
+)
+
+// Daemon roles
+const (
+	RoleProxy  = "proxy"
+	RoleTarget = "target"
+)
+
+const (
+	defaultMountpaths = 2
+	defaultTimeout    = time.Minute
+	stopTimeout       = 10 * time.Second
+	pollInterval      = 200 * time.Millisecond
+)
+
+// Config describes a mini cluster
+type Config struct {
+	Proxies    int           // number of proxies, the first one is the primary
+	Targets    int           // number of targets
+	Mountpaths int           // number of mountpaths per target, 2 by default
+	Cloud      string        // dfc.ProviderAmazon (default) or dfc.ProviderGoogle
+	Binary     string        // DFC executable; built from dfc/setup when empty
+	BuildTags  string        // tags to build the executable with, e.g. "debug"
+	Dir        string        // root directory for all daemons; temporary when empty
+	Timeout    time.Duration // how long to wait for the cluster to start up, 1 minute by default
+}
+
+// Daemon is a running proxy or target
+type Daemon struct {
+	ID   string
+	Role string
+	URL  string
+	Dir  string // configuration and logs
+	cmd  *exec.Cmd
+	done chan error // receives the result of the process once it exits
+}
+
+// Cluster is a running mini cluster
+type Cluster struct {
+	Proxies []*Daemon
+	Targets []*Daemon
+	dir     string
+	tmpdir  bool
+}
+
+// Start builds the DFC executable (unless provided), starts all daemons and
+// waits until the primary proxy's cluster map includes all of them
+func Start(cfg Config) (c *Cluster, err error) {
+	if cfg.Proxies < 1 {
+		return nil, errors.New("A cluster must have at least one proxy")
+	}
+	if cfg.Mountpaths == 0 {
+		cfg.Mountpaths = defaultMountpaths
+	}
+	if cfg.Cloud == "" {
+		cfg.Cloud = dfc.ProviderAmazon
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = defaultTimeout
+	}
+
+	c = &Cluster{dir: cfg.Dir}
+	if c.dir == "" {
+		if c.dir, err = ioutil.TempDir("", "dfc-minicluster"); err != nil {
+			return nil, err
+		}
+		c.tmpdir = true
+	}
+	defer func() {
+		if err != nil {
+			c.Stop()
+		}
+	}()
+
+	if cfg.Binary == "" {
+		cfg.Binary = filepath.Join(c.dir, "dfc")
+		build := exec.Command("go", "build", "-tags", cfg.BuildTags, "-o", cfg.Binary, "github.com/NVIDIA/dfcpub/dfc/setup")
+		if out, err := build.CombinedOutput(); err != nil {
+			return nil, fmt.Errorf("Failed to build DFC executable, err: %v\n%s", err, out)
+		}
+	}
+
+	for i := 0; i < cfg.Proxies; i++ {
+		d, err := c.newDaemon(&cfg, RoleProxy, i)
+		if err != nil {
+			return nil, err
+		}
+		c.Proxies = append(c.Proxies, d)
+	}
+	for i := 0; i < cfg.Targets; i++ {
+		d, err := c.newDaemon(&cfg, RoleTarget, i)
+		if err != nil {
+			return nil, err
+		}
+		c.Targets = append(c.Targets, d)
+	}
+
+	// the primary goes first: all other daemons register with it
+	if err = c.Proxies[0].start(cfg.Binary, true, cfg.Targets); err != nil {
+		return nil, err
+	}
+	for _, d := range append(c.Proxies[1:], c.Targets...) {
+		if err = d.start(cfg.Binary, false, 0); err != nil {
+			return nil, err
+		}
+	}
+	err = c.waitStartup(cfg.Timeout)
+	return c, err
+}
+
+// ProxyURL returns the URL of the primary proxy
+func (c *Cluster) ProxyURL() string {
+	return c.Proxies[0].URL
+}
+
+// Stop stops all daemons and removes the temporary directory
+func (c *Cluster) Stop() error {
+	var firstErr error
+	for _, d := range append(c.Targets, c.Proxies...) {
+		if err := d.Stop(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if c.tmpdir {
+		if err := os.RemoveAll(c.dir); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (c *Cluster) waitStartup(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		for _, d := range append(c.Proxies, c.Targets...) {
+			if d.exited() {
+				return fmt.Errorf("%s %s exited during startup, see logs in %s", d.Role, d.ID, d.Dir)
+			}
+		}
+		smap, err := client.GetClusterMap(c.ProxyURL())
+		if err == nil && len(smap.Pmap) == len(c.Proxies) && len(smap.Tmap) == len(c.Targets) {
+			if c.synchronized(smap.Version) {
+				return nil
+			}
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("The cluster did not start up in %v: Smap %+v, err: %v", timeout, smap, err)
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+// Returns true if all daemons have received the primary's cluster map
+func (c *Cluster) synchronized(version int64) bool {
+	for _, d := range append(c.Proxies[1:], c.Targets...) {
+		smap, err := client.GetClusterMap(d.URL)
+		if err != nil || smap.Version != version {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *Cluster) newDaemon(cfg *Config, role string, idx int) (*Daemon, error) {
+	port, err := freePort()
+	if err != nil {
+		return nil, err
+	}
+	d := &Daemon{
+		ID:   role[:1] + strconv.Itoa(idx+1),
+		Role: role,
+		URL:  "http://localhost:" + strconv.Itoa(port),
+		Dir:  filepath.Join(c.dir, role[:1]+strconv.Itoa(idx+1)),
+	}
+	if err = dfc.CreateDir(d.Dir); err != nil {
+		return nil, err
+	}
+
+	var primaryURL string
+	if len(c.Proxies) == 0 {
+		primaryURL = d.URL
+	} else {
+		primaryURL = c.Proxies[0].URL
+	}
+	f, err := os.Create(filepath.Join(d.Dir, "dfc.json"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return d, configTemplate.Execute(f, map[string]interface{}{
+		"Confdir":    d.Dir,
+		"Cloud":      cfg.Cloud,
+		"Port":       port,
+		"PrimaryID":  c.primaryID(d),
+		"PrimaryURL": primaryURL,
+		"Root":       filepath.Join(c.dir, "mpaths"),
+		"Mountpaths": cfg.Mountpaths,
+		"Instance":   idx + 1,
+	})
+}
+
+func (c *Cluster) primaryID(d *Daemon) string {
+	if len(c.Proxies) == 0 {
+		return d.ID
+	}
+	return c.Proxies[0].ID
+}
+
+func (d *Daemon) start(binary string, primary bool, ntargets int) error {
+	args := []string{"-config=" + filepath.Join(d.Dir, "dfc.json"), "-role=" + d.Role}
+	if primary {
+		args = append(args, "-ntargets="+strconv.Itoa(ntargets))
+	}
+	out, err := os.Create(filepath.Join(d.Dir, "out.log"))
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	d.cmd = exec.Command(binary, args...)
+	d.cmd.Stdout, d.cmd.Stderr = out, out
+	d.cmd.Env = append(os.Environ(), "DFCDAEMONID="+d.ID)
+	if primary {
+		d.cmd.Env = append(d.cmd.Env, "DFCPRIMARYPROXY=true")
+	}
+	if err = d.cmd.Start(); err != nil {
+		return fmt.Errorf("Failed to start %s %s, err: %v", d.Role, d.ID, err)
+	}
+	d.done = make(chan error, 1)
+	go func() {
+		d.done <- d.cmd.Wait()
+	}()
+	return nil
+}
+
+func (d *Daemon) exited() bool {
+	select {
+	case err := <-d.done:
+		d.done <- err
+		return true
+	default:
+		return false
+	}
+}
+
+// Stop gracefully shuts the daemon down; kills it if it does not exit in time
+func (d *Daemon) Stop() error {
+	if d.cmd == nil || d.exited() {
+		return nil
+	}
+	if err := d.cmd.Process.Signal(syscall.SIGINT); err != nil {
+		return err
+	}
+	select {
+	case <-d.done:
+		return nil
+	case <-time.After(stopTimeout):
+		return d.cmd.Process.Kill()
+	}
+}
+
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+// the same configuration as dfc/setup/config.sh generates, with shorter
+// timeouts and startup delays
+var configTemplate = template.Must(template.New("config").Parse(`{
+	"confdir":		"{{.Confdir}}",
+	"cloudprovider":	"{{.Cloud}}",
+	"cloud_buckets":	"cloud",
+	"local_buckets":	"local",
+	"log": {
+		"logdir":	"{{.Confdir}}/log",
+		"loglevel":	"3",
+		"logmaxsize":	4194304,
+		"logmaxtotal":	67108864
+	},
+	"periodic": {
+		"stats_time":		"10s",
+		"retry_sync_time":	"2s",
+		"stats_history":	0
+	},
+	"timeout": {
+		"default_timeout":	"30s",
+		"default_long_timeout":	"30m",
+		"max_keepalive":	"4s",
+		"proxy_ping":		"100ms",
+		"cplane_operation":	"1s",
+		"send_file_time":	"5m",
+		"startup_time":		"1m"
+	},
+	"proxyconfig": {
+		"primary": {
+			"id":		"{{.PrimaryID}}",
+			"url":		"{{.PrimaryURL}}",
+			"passthru":	true
+		},
+		"original": {
+			"id":		"{{.PrimaryID}}",
+			"url":		"{{.PrimaryURL}}",
+			"passthru":	true
+		}
+	},
+	"lru_config": {
+		"lowwm":		75,
+		"highwm":		90,
+		"atime_cache_max":	65536,
+		"dont_evict_time":	"120m",
+		"capacity_upd_time":	"10m",
+		"lru_enabled":		true
+	},
+	"rebalance_conf": {
+		"startup_delay_time":	"10s",
+		"dest_retry_time":	"2m",
+		"rebalancing_enabled":	true
+	},
+	"cksum_config": {
+		"checksum":			"xxhash",
+		"validate_checksum_cold_get":	true,
+		"validate_checksum_warm_get":	false,
+		"enable_read_range_checksum":	false,
+		"offload_checksum_cold_get":	false
+	},
+	"version_config": {
+		"validate_version_warm_get":	false,
+		"versioning":			"all"
+	},
+	"fspaths": {},
+	"test_fspaths": {
+		"root":		"{{.Root}}",
+		"count":	{{.Mountpaths}},
+		"instance":	{{.Instance}}
+	},
+	"netconfig": {
+		"ipv4": "",
+		"l4": {
+			"proto":	"tcp",
+			"port":		"{{.Port}}"
+		},
+		"http": {
+			"max_num_targets":	16,
+			"use_https":		false,
+			"use_http2":		false,
+			"use_as_proxy":		false,
+			"server_certificate":	"server.crt",
+			"server_key":		"server.key"
+		}
+	},
+	"fskeeper": {
+		"fs_check_time":		"0",
+		"offline_fs_check_time":	"0",
+		"fskeeper_enabled":		false
+	},
+	"auth": {
+		"secret":	"",
+		"enabled":	false,
+		"creddir":	"",
+		"max_token_lifetime":	"",
+		"authn_url":	""
+	},
+	"secrets": {
+		"provider":	"",
+		"url":		"",
+		"path":		"",
+		"refresh_time":	"0s"
+	},
+	"coldget": {
+		"part_size":	67108864,
+		"concurrency":	8
+	},
+	"commit": {
+		"fsync":	"never"
+	},
+	"direct_io": {
+		"threshold":	0
+	},
+	"placement": {
+		"max_used_pct":	0
+	},
+	"alerts": {
+		"interval":	"",
+		"rules":	[],
+		"webhooks":	[],
+		"smtp":		"",
+		"from":		"",
+		"to":		[]
+	},
+	"probe": {
+		"interval":	"",
+		"size":		0,
+		"window":	0
+	},
+	"keepalivetracker": {
+		"proxy": {
+			"interval":	"10s",
+			"name":		"heartbeat",
+			"max":		"20s",
+			"factor":	3
+		},
+		"target": {
+			"interval":	"10s",
+			"name":		"heartbeat",
+			"max":		"20s",
+			"factor":	3
+		}
+	},
+	"callstats": {
+		"request_included":	[ "keepalive", "metasync" ],
+		"factor":		2.5
+	}
+}
+`))
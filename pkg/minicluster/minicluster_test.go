@@ -0,0 +1,52 @@
+/*
+ * Copyright (c) 2018, NVIDIA CORPORATION. All rights reserved.
+ *
+ */
+package minicluster_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/NVIDIA/dfcpub/pkg/client"
+	"github.com/NVIDIA/dfcpub/pkg/client/readers"
+	"github.com/NVIDIA/dfcpub/pkg/minicluster"
+)
+
+func TestMiniCluster(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Long run only")
+	}
+	const bucket = "minicluster"
+
+	cluster, err := minicluster.Start(minicluster.Config{Proxies: 2, Targets: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := cluster.Stop(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	proxyURL := cluster.ProxyURL()
+	if err = client.CreateLocalBucket(proxyURL, bucket); err != nil {
+		t.Fatal(err)
+	}
+	reader, err := readers.NewInMemReader(1024, true /* withHash */)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = client.Put(proxyURL, reader, bucket, "obj", true /* silent */); err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	// any proxy serves the request
+	n, _, err := client.GetFile(cluster.Proxies[1].URL, bucket, "obj", nil, nil, true, true, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1024 {
+		t.Errorf("Expected 1024 bytes, got %d", n)
+	}
+}